@@ -8,12 +8,13 @@ import (
 	"github.com/apcera/nats"
 	"github.com/cloudfoundry/gunk/timeprovider"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/eventbus"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
 	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
 	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/hm9000/store"
 
-	"github.com/cloudfoundry/yagnats"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 )
 
 const HeartbeatSyncTimer = "HeartbeatSyncTimer"
@@ -21,22 +22,43 @@ const HeartbeatSyncTimer = "HeartbeatSyncTimer"
 type ActualStateListener struct {
 	logger                  logger.Logger
 	config                  *config.Config
-	messageBus              yagnats.NATSConn
+	messageBus              messagebus.MessageBus
 	store                   store.Store
 	timeProvider            timeprovider.TimeProvider
 	storeUsageTracker       metricsaccountant.UsageTracker
 	metricsAccountant       metricsaccountant.MetricsAccountant
 	heartbeatsToSave        []models.Heartbeat
+	advertisementsToSave    []models.DeaAdvertisement
 	totalReceivedHeartbeats int
 	totalSavedHeartbeats    int
 
-	lastReceivedHeartbeat time.Time
+	// totalShedInstanceHeartbeats counts the instance heartbeats only
+	// counted, not saved, while shedding load.
+	totalShedInstanceHeartbeats int
+
+	// clockSkews are the skews of the DEAs whose clocks were skewed in the
+	// heartbeats received since the last sync, by DEA guid.
+	clockSkews map[string]time.Duration
+
+	lastReceivedHeartbeat     time.Time
+	lastReceivedAdvertisement time.Time
 
 	heartbeatMutex *sync.Mutex
+
+	// freshness keeps the actual state fresh while the listener is busy
+	// saving, for as long as heartbeats or advertisements keep arriving.
+	freshness *store.FreshnessLease
+
+	events *eventbus.EventBus
+
+	subscriptions       []*nats.Subscription
+	subscriptionMonitor *messagebus.SubscriptionMonitor
+	stop                chan bool
+	stopped             chan bool
 }
 
 func New(config *config.Config,
-	messageBus yagnats.NATSConn,
+	messageBus messagebus.MessageBus,
 	store store.Store,
 	storeUsageTracker metricsaccountant.UsageTracker,
 	metricsAccountant metricsaccountant.MetricsAccountant,
@@ -44,24 +66,42 @@ func New(config *config.Config,
 	logger logger.Logger) *ActualStateListener {
 
 	return &ActualStateListener{
-		logger:            logger,
-		config:            config,
-		messageBus:        messageBus,
-		store:             store,
-		storeUsageTracker: storeUsageTracker,
-		metricsAccountant: metricsAccountant,
-		timeProvider:      timeProvider,
-		heartbeatsToSave:  []models.Heartbeat{},
-		heartbeatMutex:    &sync.Mutex{},
+		logger:               logger,
+		config:               config,
+		messageBus:           messageBus,
+		store:                store,
+		storeUsageTracker:    storeUsageTracker,
+		metricsAccountant:    metricsAccountant,
+		timeProvider:         timeProvider,
+		heartbeatsToSave:     []models.Heartbeat{},
+		advertisementsToSave: []models.DeaAdvertisement{},
+		clockSkews:           map[string]time.Duration{},
+		heartbeatMutex:       &sync.Mutex{},
+		subscriptionMonitor:  messagebus.NewSubscriptionMonitor(logger),
+		freshness:            store.NewActualFreshnessLease(timeProvider),
+		stop:                 make(chan bool),
+		stopped:              make(chan bool),
 	}
 }
 
+// PublishEventsTo has the listener publish ActualStateSynced to events
+// whenever it saves heartbeats.
+func (listener *ActualStateListener) PublishEventsTo(events *eventbus.EventBus) {
+	listener.events = events
+}
+
 func (listener *ActualStateListener) Start() {
 	heartbeatThreshold := time.Duration(listener.config.ActualFreshnessTTL()) * time.Second
 
-	listener.messageBus.Subscribe("dea.advertise", func(message *nats.Msg) {
+	advertiseSubscription, _ := listener.messageBus.QueueSubscribe("dea.advertise", listener.config.NATSQueueGroup, func(message *nats.Msg) {
+		advertisement, err := models.NewDeaAdvertisementFromJSON(message.Data)
+
 		listener.heartbeatMutex.Lock()
 		lastReceived := listener.lastReceivedHeartbeat
+		listener.lastReceivedAdvertisement = listener.timeProvider.Time()
+		if err == nil && advertisement.Zone() != "" {
+			listener.advertisementsToSave = append(listener.advertisementsToSave, advertisement)
+		}
 		listener.heartbeatMutex.Unlock()
 
 		if listener.timeProvider.Time().Sub(lastReceived) >= heartbeatThreshold {
@@ -71,7 +111,7 @@ func (listener *ActualStateListener) Start() {
 		listener.logger.Debug("Received dea.advertise")
 	})
 
-	listener.messageBus.Subscribe("dea.heartbeat", func(message *nats.Msg) {
+	heartbeatSubscription, _ := listener.messageBus.QueueSubscribe("dea.heartbeat", listener.config.NATSQueueGroup, func(message *nats.Msg) {
 		listener.logger.Debug("Got a heartbeat")
 		heartbeat, err := models.NewHeartbeatFromJSON(message.Data)
 		if err != nil {
@@ -79,25 +119,46 @@ func (listener *ActualStateListener) Start() {
 				map[string]string{
 					"MessageBody": string(message.Data),
 				})
+			listener.metricsAccountant.IncrementErrors("Listener", err)
 			return
 		}
 
 		listener.logger.Debug("Decoded the heartbeat")
 
-		listener.heartbeatMutex.Lock()
+		listener.receiveHeartbeat(heartbeat)
+	})
 
-		listener.lastReceivedHeartbeat = listener.timeProvider.Time()
+	listener.subscriptions = []*nats.Subscription{advertiseSubscription, heartbeatSubscription}
 
-		listener.totalReceivedHeartbeats++
-		listener.heartbeatsToSave = append(listener.heartbeatsToSave, heartbeat)
-		numToSave := len(listener.heartbeatsToSave)
+	if listener.config.CellReportsEnabled() {
+		cellReportSubscription, _ := listener.messageBus.QueueSubscribe(listener.config.CellReportsNATSSubject, listener.config.NATSQueueGroup, func(message *nats.Msg) {
+			report, err := models.NewCellReportFromJSON(message.Data)
+			if err != nil {
+				listener.logger.Error("Could not unmarshal cell report", err,
+					map[string]string{
+						"MessageBody": string(message.Data),
+					})
+				listener.metricsAccountant.IncrementErrors("Listener", err)
+				return
+			}
 
-		listener.heartbeatMutex.Unlock()
+			heartbeat, skipped := report.ToHeartbeat()
+			if skipped > 0 {
+				description := report.LogDescription()
+				description["Skipped"] = strconv.Itoa(skipped)
+				listener.logger.Info("Skipped actual LRPs that are unclaimed or name no app", description)
+			}
 
-		listener.logger.Info("Received a heartbeat", map[string]string{
-			"Heartbeats Pending Save": strconv.Itoa(numToSave),
+			listener.receiveHeartbeat(heartbeat)
 		})
-	})
+		listener.subscriptions = append(listener.subscriptions, cellReportSubscription)
+	}
+
+	for _, subscription := range listener.subscriptions {
+		if subscription != nil {
+			listener.subscriptionMonitor.Add(subscription.Subject, subscription)
+		}
+	}
 
 	go listener.syncHeartbeats()
 
@@ -107,84 +168,299 @@ func (listener *ActualStateListener) Start() {
 	}
 }
 
+// receiveHeartbeat queues heartbeat for the next sync.
+func (listener *ActualStateListener) receiveHeartbeat(heartbeat models.Heartbeat) {
+	now := listener.timeProvider.Time()
+	skew := listener.clockSkew(heartbeat, now)
+	if skew > 0 && listener.config.ListenerNormalizeSkewedTimestamps {
+		heartbeat = heartbeat.NormalizeTimestamps(now)
+	}
+
+	listener.heartbeatMutex.Lock()
+
+	listener.lastReceivedHeartbeat = now
+	if skew > 0 {
+		listener.clockSkews[heartbeat.DeaGuid] = skew
+	}
+
+	listener.totalReceivedHeartbeats++
+	listener.heartbeatsToSave = append(listener.heartbeatsToSave, heartbeat)
+	numToSave := len(listener.heartbeatsToSave)
+
+	listener.heartbeatMutex.Unlock()
+
+	listener.logger.Info("Received a heartbeat", map[string]string{
+		"Heartbeats Pending Save": strconv.Itoa(numToSave),
+	})
+}
+
+// clockSkew is how far ahead of now the DEA's clock is, going by its
+// heartbeat, if that is beyond listener_clock_skew_threshold_in_seconds, and
+// 0 otherwise.
+func (listener *ActualStateListener) clockSkew(heartbeat models.Heartbeat, now time.Time) time.Duration {
+	threshold := listener.config.ListenerClockSkewThreshold()
+	if threshold == 0 {
+		return 0
+	}
+
+	skew := heartbeat.ClockSkew(now)
+	if skew <= threshold {
+		return 0
+	}
+
+	description := heartbeat.LogDescription()
+	description["Clock Skew"] = skew.String()
+	description["Normalized"] = strconv.FormatBool(listener.config.ListenerNormalizeSkewedTimestamps)
+	listener.logger.Info("Received a heartbeat from a DEA whose clock is ahead", description)
+	return skew
+}
+
+// HeartbeatsPendingSave is the number of heartbeats received since the last
+// sync to the store.
+func (listener *ActualStateListener) HeartbeatsPendingSave() int {
+	listener.heartbeatMutex.Lock()
+	defer listener.heartbeatMutex.Unlock()
+	return len(listener.heartbeatsToSave)
+}
+
+// Stop unsubscribes from heartbeats and advertisements and then saves the
+// heartbeats received since the last sync, and their metrics, so that none
+// are lost when the listener shuts down.  It leaves the actual freshness to
+// expire.
+func (listener *ActualStateListener) Stop() {
+	for _, subscription := range listener.subscriptions {
+		if subscription != nil {
+			listener.messageBus.Unsubscribe(subscription)
+		}
+	}
+
+	close(listener.stop)
+	<-listener.stopped
+	listener.freshness.Stop()
+}
+
 func (listener *ActualStateListener) syncHeartbeats() {
 	syncInterval := listener.timeProvider.NewTickerChannel(HeartbeatSyncTimer, listener.config.ListenerHeartbeatSyncInterval())
 
 	previousReceivedHeartbeats := -1
 
 	for {
-		listener.heartbeatMutex.Lock()
-		heartbeatsToSave := listener.heartbeatsToSave
-		listener.heartbeatsToSave = []models.Heartbeat{}
-		totalReceivedHeartbeats := listener.totalReceivedHeartbeats
-		listener.heartbeatMutex.Unlock()
+		previousReceivedHeartbeats = listener.syncHeartbeatsOnce(previousReceivedHeartbeats)
+
+		select {
+		case <-syncInterval:
+		case <-listener.stop:
+			listener.syncHeartbeatsOnce(previousReceivedHeartbeats)
+			listener.logger.Info("Stopped listening for actual state")
+			close(listener.stopped)
+			return
+		}
+	}
+}
+
+// trackSubscriptions tracks how far behind the NATS client the listener's
+// handlers are, and logs any messages dropped because they fell too far.
+func (listener *ActualStateListener) trackSubscriptions() {
+	err := listener.metricsAccountant.TrackNATSSubscriptions("Listener", listener.subscriptionMonitor.Check())
+	if err != nil {
+		listener.logger.Error("Could not track the listener's NATS subscriptions", err)
+	}
+}
+
+// syncHeartbeatsOnce saves the pending heartbeats and, if more have arrived
+// since previousReceivedHeartbeats, tracks the count.  It returns the count.
+func (listener *ActualStateListener) syncHeartbeatsOnce(previousReceivedHeartbeats int) int {
+	listener.heartbeatMutex.Lock()
+	heartbeatsToSave := listener.heartbeatsToSave
+	listener.heartbeatsToSave = []models.Heartbeat{}
+	advertisementsToSave := listener.advertisementsToSave
+	listener.advertisementsToSave = []models.DeaAdvertisement{}
+	totalReceivedHeartbeats := listener.totalReceivedHeartbeats
+	clockSkews := listener.clockSkews
+	listener.clockSkews = map[string]time.Duration{}
+	lastReceived := listener.lastReceivedHeartbeat
+	if listener.lastReceivedAdvertisement.After(lastReceived) {
+		lastReceived = listener.lastReceivedAdvertisement
+	}
+	listener.heartbeatMutex.Unlock()
+
+	// A listener that has heard nothing for a heartbeat period (cut off
+	// from NATS, say) stops vouching for the actual state.
+	if listener.timeProvider.Time().Sub(lastReceived) >= listener.config.HeartbeatPeriod.Duration {
+		listener.freshness.SetHealthy(false)
+	}
 
-		if len(heartbeatsToSave) > 0 {
-			listener.logger.Info("Saving Heartbeats", map[string]string{
+	if len(clockSkews) > 0 {
+		err := listener.metricsAccountant.TrackDeaClockSkews(clockSkews)
+		if err != nil {
+			listener.logger.Error("Could not track the clock skews of DEAs", err)
+		}
+	}
+
+	listener.trackSubscriptions()
+
+	if len(heartbeatsToSave) > 0 {
+		listener.logger.Info("Saving Heartbeats", map[string]string{
+			"Heartbeats to Save": strconv.Itoa(len(heartbeatsToSave)),
+		})
+
+		t := time.Now()
+		var err error
+		shed := 0
+		if listener.shouldShed(len(heartbeatsToSave)) {
+			priorityApps := listener.config.ListenerPriorityAppSet()
+			shed = countShedInstanceHeartbeats(heartbeatsToSave, priorityApps)
+			listener.logger.Info("Shedding heartbeat detail: too many heartbeats are pending save", map[string]string{
+				"Heartbeats to Save":          strconv.Itoa(len(heartbeatsToSave)),
+				"Threshold":                   strconv.Itoa(listener.config.ListenerLoadSheddingThreshold),
+				"Instance Heartbeats to Shed": strconv.Itoa(shed),
+			})
+			err = listener.store.SyncHeartbeatsShedding(priorityApps, heartbeatsToSave...)
+		} else if listener.config.ListenerHeartbeatSamplingCohorts > 0 {
+			cohort := listener.sampledCohort()
+			sampledDeas := sampledDeas(heartbeatsToSave, cohort, listener.config.ListenerHeartbeatSamplingCohorts)
+			listener.logger.Info("Sampling heartbeats", map[string]string{
 				"Heartbeats to Save": strconv.Itoa(len(heartbeatsToSave)),
+				"Cohort":             strconv.Itoa(cohort),
+				"Sampled DEAs":       strconv.Itoa(len(sampledDeas)),
 			})
+			err = listener.store.SyncHeartbeatsSampling(sampledDeas, heartbeatsToSave...)
+		} else {
+			err = listener.store.SyncHeartbeats(heartbeatsToSave...)
+		}
 
-			t := time.Now()
-			err := listener.store.SyncHeartbeats(heartbeatsToSave...)
-
-			if err != nil {
-				listener.logger.Error("Could not put instance heartbeats in store:", err)
-				listener.store.RevokeActualFreshness()
+		if err != nil {
+			listener.logger.Error("Could not put instance heartbeats in store:", err)
+			listener.metricsAccountant.IncrementErrors("Listener", err)
+			listener.freshness.SetHealthy(false)
+			listener.freshness.Revoke()
+		} else {
+			dt := time.Since(t)
+			if dt < listener.config.ListenerHeartbeatSyncInterval() {
+				listener.bumpFreshness()
 			} else {
-				dt := time.Since(t)
-				if dt < listener.config.ListenerHeartbeatSyncInterval() {
-					listener.bumpFreshness()
-				} else {
-					listener.logger.Info("Save took too long.  Not bumping freshness.")
-				}
-				listener.logger.Info("Saved Heartbeats", map[string]string{
-					"Heartbeats to Save": strconv.Itoa(len(heartbeatsToSave)),
-					"Duration":           time.Since(t).String(),
-				})
+				listener.freshness.SetHealthy(true)
+				listener.logger.Info("Save took too long.  Not bumping freshness, leaving it to the lease.")
+			}
+			listener.logger.Info("Saved Heartbeats", map[string]string{
+				"Heartbeats to Save": strconv.Itoa(len(heartbeatsToSave)),
+				"Duration":           time.Since(t).String(),
+			})
+
+			listener.heartbeatMutex.Lock()
+			listener.totalSavedHeartbeats += len(heartbeatsToSave)
+			totalSavedHeartbeats := listener.totalSavedHeartbeats
+			listener.heartbeatMutex.Unlock()
+
+			listener.metricsAccountant.TrackSavedHeartbeats(totalSavedHeartbeats)
+			listener.events.Publish(eventbus.ActualStateSynced)
 
+			if shed > 0 {
 				listener.heartbeatMutex.Lock()
-				listener.totalSavedHeartbeats += len(heartbeatsToSave)
-				totalSavedHeartbeats := listener.totalSavedHeartbeats
+				listener.totalShedInstanceHeartbeats += shed
+				totalShedInstanceHeartbeats := listener.totalShedInstanceHeartbeats
 				listener.heartbeatMutex.Unlock()
 
-				listener.metricsAccountant.TrackSavedHeartbeats(totalSavedHeartbeats)
+				listener.metricsAccountant.TrackShedInstanceHeartbeats(totalShedInstanceHeartbeats)
 			}
 		}
+	}
 
-		if previousReceivedHeartbeats != totalReceivedHeartbeats {
-			listener.logger.Debug("Tracking Heartbeat Metrics", map[string]string{
-				"Total Received Heartbeats": strconv.Itoa(totalReceivedHeartbeats),
-			})
-			t := time.Now()
+	if len(heartbeatsToSave) > 0 || len(advertisementsToSave) > 0 {
+		err := listener.store.SyncDeaZones(listener.timeProvider.Time(), heartbeatsToSave, advertisementsToSave)
+		if err != nil {
+			listener.logger.Error("Could not save the zones of DEAs", err)
+		}
+	}
 
-			listener.metricsAccountant.TrackReceivedHeartbeats(totalReceivedHeartbeats)
+	// Every sync, so that a listener the queue group has starved of
+	// heartbeats still shows up with its share.
+	if listener.config.NATSQueueGroup != "" {
+		err := listener.metricsAccountant.TrackQueueGroupMessages("Listener", listener.config.InstanceName(), totalReceivedHeartbeats)
+		if err != nil {
+			listener.logger.Error("Could not track the listener's share of the queue group's heartbeats", err)
+		}
+	}
 
-			listener.logger.Debug("Done Tracking Heartbeat Metrics", map[string]string{
-				"Total Received Heartbeats": strconv.Itoa(totalReceivedHeartbeats),
-				"Duration":                  time.Since(t).String(),
-			})
+	if previousReceivedHeartbeats != totalReceivedHeartbeats {
+		listener.logger.Debug("Tracking Heartbeat Metrics", map[string]string{
+			"Total Received Heartbeats": strconv.Itoa(totalReceivedHeartbeats),
+		})
+		t := time.Now()
+
+		listener.metricsAccountant.TrackReceivedHeartbeats(totalReceivedHeartbeats)
+
+		listener.logger.Debug("Done Tracking Heartbeat Metrics", map[string]string{
+			"Total Received Heartbeats": strconv.Itoa(totalReceivedHeartbeats),
+			"Duration":                  time.Since(t).String(),
+		})
 
-			previousReceivedHeartbeats = totalReceivedHeartbeats
+		previousReceivedHeartbeats = totalReceivedHeartbeats
+	}
+
+	return previousReceivedHeartbeats
+}
+
+// shouldShed is true when more heartbeats are pending save than
+// listener_load_shedding_threshold.
+func (listener *ActualStateListener) shouldShed(pending int) bool {
+	threshold := listener.config.ListenerLoadSheddingThreshold
+	return threshold > 0 && pending > threshold
+}
+
+// countShedInstanceHeartbeats counts the instance heartbeats of apps that
+// are not priority apps.
+func countShedInstanceHeartbeats(heartbeats []models.Heartbeat, priorityApps map[string]bool) int {
+	shed := 0
+	for _, heartbeat := range heartbeats {
+		for _, instanceHeartbeat := range heartbeat.InstanceHeartbeats {
+			if !priorityApps[instanceHeartbeat.AppGuid] {
+				shed++
+			}
 		}
+	}
+	return shed
+}
 
-		<-syncInterval
+// sampledCohort is the cohort whose DEAs' instances are saved this heartbeat
+// period.  The cohorts take turns, so that every DEA's instances are saved
+// at least once every listener_heartbeat_sampling_cohorts periods.
+func (listener *ActualStateListener) sampledCohort() int {
+	period := int64(listener.config.HeartbeatPeriod.Duration)
+	cohorts := int64(listener.config.ListenerHeartbeatSamplingCohorts)
+	return int(listener.timeProvider.Time().UnixNano() / period % cohorts)
+}
+
+// sampledDeas are the DEAs of heartbeats that are in cohort, by guid.
+func sampledDeas(heartbeats []models.Heartbeat, cohort int, cohorts int) map[string]bool {
+	sampled := map[string]bool{}
+	for _, heartbeat := range heartbeats {
+		if models.HeartbeatCohort(heartbeat.DeaGuid, cohorts) == cohort {
+			sampled[heartbeat.DeaGuid] = true
+		}
 	}
+	return sampled
 }
 
 func (listener *ActualStateListener) measureStoreUsage() {
 	usage, _ := listener.storeUsageTracker.MeasureUsage()
 	listener.metricsAccountant.TrackActualStateListenerStoreUsageFraction(usage)
 
-	time.AfterFunc(3*time.Duration(listener.config.HeartbeatPeriod)*time.Second, func() {
+	time.AfterFunc(3*listener.config.HeartbeatPeriod.Duration, func() {
 		listener.measureStoreUsage()
 	})
 }
 
+// bumpFreshness bumps the actual freshness, and starts the lease that keeps
+// it fresh from then on.
 func (listener *ActualStateListener) bumpFreshness() {
+	listener.freshness.SetHealthy(true)
 	err := listener.store.BumpActualFreshness(listener.timeProvider.Time())
 	if err != nil {
 		listener.logger.Error("Could not update actual freshness", err)
+		listener.metricsAccountant.IncrementErrors("Listener", err)
 	} else {
 		listener.logger.Info("Bumped freshness")
+		listener.freshness.Start()
 	}
 }
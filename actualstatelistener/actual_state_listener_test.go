@@ -15,6 +15,8 @@ import (
 
 	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
+	"github.com/cloudfoundry/hm9000/helpers/eventbus"
 	storepackage "github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakemetricsaccountant"
@@ -38,6 +40,7 @@ var _ = Describe("Actual state listener", func() {
 		freshByTime       time.Time
 		usageTracker      *fakeusagetracker.FakeUsageTracker
 		metricsAccountant *fakemetricsaccountant.FakeMetricsAccountant
+		actualStateSynced <-chan struct{}
 	)
 
 	BeforeEach(func() {
@@ -46,6 +49,8 @@ var _ = Describe("Actual state listener", func() {
 
 		Ω(err).ShouldNot(HaveOccurred())
 
+		conf.CellReportsNATSSubject = "diego.cell_reports"
+
 		timeProvider = faketimeprovider.New(time.Unix(100, 0))
 		timeProvider.ProvideFakeChannels = true
 
@@ -66,6 +71,9 @@ var _ = Describe("Actual state listener", func() {
 		metricsAccountant = fakemetricsaccountant.New()
 
 		listener = New(conf, messageBus, store, usageTracker, metricsAccountant, timeProvider, logger)
+		events := eventbus.New()
+		actualStateSynced = events.Subscribe(eventbus.ActualStateSynced)
+		listener.PublishEventsTo(events)
 		listener.Start()
 		Eventually(func() interface{} {
 			return timeProvider.TickerChannelFor(HeartbeatSyncTimer)
@@ -89,6 +97,125 @@ var _ = Describe("Actual state listener", func() {
 		Ω(messageBus.Subscriptions("dea.advertise")).Should(HaveLen(1))
 	})
 
+	It("should subscribe to the cell reports subject", func() {
+		Ω(messageBus.Subscriptions("diego.cell_reports")).Should(HaveLen(1))
+	})
+
+	Context("when cell reports are off", func() {
+		It("should not subscribe to them", func() {
+			conf.CellReportsNATSSubject = ""
+			otherMessageBus := fakeyagnats.Connect()
+			listener = New(conf, otherMessageBus, store, nil, metricsAccountant, timeProvider, logger)
+			listener.Start()
+
+			Ω(otherMessageBus.Subscriptions("dea.heartbeat")).Should(HaveLen(1))
+			Ω(otherMessageBus.Subscriptions("")).Should(BeEmpty())
+		})
+	})
+
+	It("should not subscribe in a queue group", func() {
+		Ω(messageBus.Subscriptions("dea.heartbeat")[0].Queue).Should(BeEmpty())
+		Ω(metricsAccountant.QueueGroupMessages).Should(BeEmpty())
+	})
+
+	Context("with a NATS queue group", func() {
+		var queueMessageBus *fakeyagnats.FakeNATSConn
+
+		BeforeEach(func() {
+			listener.Stop()
+
+			conf.NATSQueueGroup = "hm9000"
+			conf.LeaderElectionCandidate = "listener-0"
+			queueMessageBus = fakeyagnats.Connect()
+			timeProvider = faketimeprovider.New(time.Unix(100, 0))
+			timeProvider.ProvideFakeChannels = true
+			listener = New(conf, queueMessageBus, store, nil, metricsAccountant, timeProvider, logger)
+			listener.Start()
+			Eventually(func() interface{} {
+				return timeProvider.TickerChannelFor(HeartbeatSyncTimer)
+			}).ShouldNot(BeZero())
+		})
+
+		It("should subscribe in the queue group", func() {
+			for _, subject := range []string{"dea.heartbeat", "dea.advertise", "diego.cell_reports"} {
+				Ω(queueMessageBus.Subscriptions(subject)).Should(HaveLen(1))
+				Ω(queueMessageBus.Subscriptions(subject)[0].Queue).Should(Equal("hm9000"))
+			}
+		})
+
+		It("should track its share of the heartbeats on every sync", func() {
+			queueMessageBus.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{
+				Data: dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()).ToJSON(),
+			})
+			forceHeartbeatSync()
+
+			Ω(metricsAccountant.QueueGroupMessages["Listener"]).Should(Equal(map[string]int{"listener-0": 1}))
+		})
+	})
+
+	It("should track its NATS subscriptions on every sync", func() {
+		forceHeartbeatSync()
+
+		Ω(metricsAccountant.TrackedNATSSubscriptions).Should(HaveKey("Listener"))
+	})
+
+	Describe("DEAs whose clocks are ahead", func() {
+		var skewed Heartbeat
+
+		BeforeEach(func() {
+			instance := app.InstanceAtIndex(0).Heartbeat()
+			instance.StateTimestamp = 200
+			skewed = dea.HeartbeatWith(instance)
+		})
+
+		JustBeforeEach(func() {
+			messageBus.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{Data: skewed.ToJSON()})
+			forceHeartbeatSync()
+		})
+
+		It("should report the DEA's skew", func() {
+			Ω(metricsAccountant.TrackedDeaClockSkews).Should(HaveLen(1))
+			Ω(metricsAccountant.TrackedDeaClockSkews[0]).Should(Equal(map[string]time.Duration{dea.DeaGuid: 100 * time.Second}))
+			Ω(logger.LoggedSubjects).Should(ContainElement("Received a heartbeat from a DEA whose clock is ahead"))
+		})
+
+		It("should keep the DEA's timestamps", func() {
+			foundApp, _ := store.GetApp(app.AppGuid, app.AppVersion)
+			Ω(foundApp.InstanceHeartbeats[0].StateTimestamp).Should(Equal(200.0))
+		})
+
+		Context("when timestamps are normalized", func() {
+			BeforeEach(func() {
+				conf.ListenerNormalizeSkewedTimestamps = true
+			})
+
+			It("should bring the DEA's timestamps back to the listener's time", func() {
+				foundApp, _ := store.GetApp(app.AppGuid, app.AppVersion)
+				Ω(foundApp.InstanceHeartbeats[0].StateTimestamp).Should(Equal(100.0))
+			})
+		})
+
+		Context("when the skew is within the threshold", func() {
+			BeforeEach(func() {
+				conf.ListenerClockSkewThresholdInSeconds.Duration = 100 * time.Second
+			})
+
+			It("should not report it", func() {
+				Ω(metricsAccountant.TrackedDeaClockSkews).Should(BeEmpty())
+			})
+		})
+
+		Context("when clock skew is not checked", func() {
+			BeforeEach(func() {
+				conf.ListenerClockSkewThresholdInSeconds.Duration = 0
+			})
+
+			It("should not report it", func() {
+				Ω(metricsAccountant.TrackedDeaClockSkews).Should(BeEmpty())
+			})
+		})
+	})
+
 	It("should start tracking store usage", func() {
 		Ω(usageTracker.DidStart).Should(BeTrue())
 		Ω(metricsAccountant.TrackedActualStateListenerStoreUsageFraction).Should(Equal(0.7))
@@ -227,6 +354,10 @@ var _ = Describe("Actual state listener", func() {
 				isFresh, _ := store.IsActualStateFresh(freshByTime)
 				Ω(isFresh).Should(BeTrue())
 			})
+
+			It("publishes that the actual state has synced", func() {
+				Ω(actualStateSynced).Should(Receive())
+			})
 		})
 
 		Context("when the save succeeds, but takes too long", func() {
@@ -235,7 +366,7 @@ var _ = Describe("Actual state listener", func() {
 					Data: heartbeat.ToJSON(),
 				})
 
-				conf.ListenerHeartbeatSyncIntervalInMilliseconds = 0
+				conf.ListenerHeartbeatSyncIntervalInMilliseconds.Duration = 0
 				forceHeartbeatSync()
 			})
 
@@ -262,6 +393,10 @@ var _ = Describe("Actual state listener", func() {
 				Ω(logger.LoggedSubjects).Should(ContainElement(ContainSubstring("Could not put instance heartbeats in store")))
 			})
 
+			It("counts the error", func() {
+				Ω(metricsAccountant.Errors["Listener"]).Should(Equal([]error{errors.New("oops")}))
+			})
+
 			It("does not bump the SavedHeartbeats metric", func() {
 				Ω(metricsAccountant.SavedHeartbeats).Should(Equal(0))
 			})
@@ -274,6 +409,208 @@ var _ = Describe("Actual state listener", func() {
 				isFresh, _ := store.IsActualStateFresh(freshByTime)
 				Ω(isFresh).Should(BeFalse())
 			})
+
+			It("does not publish that the actual state has synced", func() {
+				Ω(actualStateSynced).ShouldNot(Receive())
+			})
+		})
+
+		Context("when more heartbeats are pending than the load shedding threshold", func() {
+			BeforeEach(func() {
+				conf.ListenerLoadSheddingThreshold = 1
+				conf.ListenerPriorityApps = []string{anotherApp.AppGuid}
+
+				messageBus.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{
+					Data: heartbeat.ToJSON(),
+				})
+				messageBus.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{
+					Data: dea.HeartbeatWith(dea.GetApp(0).InstanceAtIndex(0).Heartbeat()).ToJSON(),
+				})
+
+				forceHeartbeatSync()
+			})
+
+			It("logs that it is shedding", func() {
+				Ω(logger.LoggedSubjects).Should(ContainElement("Shedding heartbeat detail: too many heartbeats are pending save"))
+			})
+
+			It("puts only the priority apps in the store", func() {
+				foundApp, err := store.GetApp(anotherApp.AppGuid, anotherApp.AppVersion)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(foundApp.InstanceHeartbeats).Should(ContainElement(anotherApp.InstanceAtIndex(0).Heartbeat()))
+
+				_, err = store.GetApp(app.AppGuid, app.AppVersion)
+				Ω(err).Should(Equal(storepackage.AppNotFoundError))
+			})
+
+			It("stores counts of the instances of the other apps", func() {
+				shedApps, err := store.GetShedApps()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(shedApps).Should(HaveKey(store.AppKey(app.AppGuid, app.AppVersion)))
+				Ω(shedApps).ShouldNot(HaveKey(store.AppKey(anotherApp.AppGuid, anotherApp.AppVersion)))
+			})
+
+			It("tracks the ShedInstanceHeartbeats and SavedHeartbeats metrics", func() {
+				Ω(metricsAccountant.ShedInstanceHeartbeats).Should(Equal(3))
+				Ω(metricsAccountant.SavedHeartbeats).Should(Equal(2))
+			})
+
+			It("bumps the freshness", func() {
+				isFresh, _ := store.IsActualStateFresh(freshByTime)
+				Ω(isFresh).Should(BeTrue())
+			})
+		})
+	})
+
+	Context("when sampling heartbeats", func() {
+		var sampledDea, otherDea DeaFixture
+
+		heartbeatFrom := func(dea DeaFixture) Heartbeat {
+			return dea.HeartbeatWith(dea.GetApp(0).InstanceAtIndex(0).Heartbeat())
+		}
+
+		isStored := func(dea DeaFixture) bool {
+			_, err := store.GetApp(dea.GetApp(0).AppGuid, dea.GetApp(0).AppVersion)
+			return err == nil
+		}
+
+		BeforeEach(func() {
+			conf.ListenerHeartbeatSamplingCohorts = 2
+
+			// At 100s, ten heartbeat periods in, cohort 0 is sampled.
+			sampledDea = NewDeaFixture()
+			for HeartbeatCohort(sampledDea.DeaGuid, 2) != 0 {
+				sampledDea = NewDeaFixture()
+			}
+			otherDea = NewDeaFixture()
+			for HeartbeatCohort(otherDea.DeaGuid, 2) != 1 {
+				otherDea = NewDeaFixture()
+			}
+
+			messageBus.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{Data: heartbeatFrom(sampledDea).ToJSON()})
+			messageBus.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{Data: heartbeatFrom(otherDea).ToJSON()})
+			forceHeartbeatSync()
+		})
+
+		It("logs that it is sampling", func() {
+			Ω(logger.LoggedSubjects).Should(ContainElement("Sampling heartbeats"))
+		})
+
+		It("saves the instances of the sampled cohort's DEAs only", func() {
+			Ω(isStored(sampledDea)).Should(BeTrue())
+			Ω(isStored(otherDea)).Should(BeFalse())
+		})
+
+		It("summarizes every DEA's heartbeat", func() {
+			summaries, err := store.GetDeaSummaries()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summaries).Should(HaveKey(sampledDea.DeaGuid))
+			Ω(summaries).Should(HaveKey(otherDea.DeaGuid))
+		})
+
+		It("bumps the freshness", func() {
+			isFresh, _ := store.IsActualStateFresh(freshByTime)
+			Ω(isFresh).Should(BeTrue())
+		})
+
+		It("samples the next cohort the next heartbeat period", func() {
+			timeProvider.IncrementBySeconds(uint64(conf.HeartbeatPeriod.Duration / time.Second))
+			messageBus.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{Data: heartbeatFrom(otherDea).ToJSON()})
+			forceHeartbeatSync()
+
+			Ω(isStored(otherDea)).Should(BeTrue())
+		})
+	})
+
+	Context("When DEAs report their zone", func() {
+		BeforeEach(func() {
+			heartbeat := app.Heartbeat(2)
+			heartbeat.Zone = "z1"
+			messageBus.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{
+				Data: heartbeat.ToJSON(),
+			})
+			messageBus.SubjectCallbacks("dea.advertise")[0](&nats.Msg{
+				Data: []byte(`{"id": "advertising-dea", "placement_properties": {"zone": "z2"}}`),
+			})
+
+			forceHeartbeatSync()
+		})
+
+		It("records the zone of each DEA and the indices it is running", func() {
+			deaZones, err := store.GetDeaZones()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deaZones).Should(HaveLen(2))
+
+			Ω(deaZones[app.DeaGuid].Zone).Should(Equal("z1"))
+			Ω(deaZones[app.DeaGuid].LastSeen).Should(BeNumerically("==", 100))
+			Ω(deaZones[app.DeaGuid].Indices).Should(Equal(map[string][]int{
+				store.AppKey(app.AppGuid, app.AppVersion): {0, 1},
+			}))
+
+			Ω(deaZones["advertising-dea"].Zone).Should(Equal("z2"))
+			Ω(deaZones["advertising-dea"].Indices).Should(BeEmpty())
+		})
+	})
+
+	Context("When it receives a Diego cell report", func() {
+		BeforeEach(func() {
+			report := CellReport{
+				CellID: "cell-1",
+				Zone:   "z1",
+				ActualLRPs: []ActualLRP{
+					{ProcessGuid: app.AppGuid + "-" + app.AppVersion, Index: 0, InstanceGuid: "instance-0", State: ActualLRPStateRunning, Since: 1000000000000},
+					{ProcessGuid: app.AppGuid + "-" + app.AppVersion, Index: 1, State: ActualLRPStateUnclaimed},
+				},
+			}
+			messageBus.SubjectCallbacks("diego.cell_reports")[0](&nats.Msg{
+				Data: report.ToJSON(),
+			})
+
+			forceHeartbeatSync()
+		})
+
+		It("puts its instances in the store as if the cell were a DEA", func() {
+			foundApp, err := store.GetApp(app.AppGuid, app.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(foundApp.InstanceHeartbeats).Should(Equal([]InstanceHeartbeat{
+				{
+					AppGuid:        app.AppGuid,
+					AppVersion:     app.AppVersion,
+					InstanceGuid:   "instance-0",
+					InstanceIndex:  0,
+					State:          InstanceStateRunning,
+					StateTimestamp: 1000,
+					DeaGuid:        "cell-1",
+				},
+			}))
+		})
+
+		It("bumps the freshness", func() {
+			isFresh, _ := store.IsActualStateFresh(freshByTime)
+			Ω(isFresh).Should(BeTrue())
+		})
+
+		It("logs the LRPs it skipped", func() {
+			Ω(logger.LoggedSubjects).Should(ContainElement("Skipped actual LRPs that are unclaimed or name no app"))
+		})
+	})
+
+	Context("When it fails to parse a cell report", func() {
+		BeforeEach(func() {
+			messageBus.SubjectCallbacks("diego.cell_reports")[0](&nats.Msg{
+				Data: []byte(`{"actual_lrps": []}`),
+			})
+
+			forceHeartbeatSync()
+		})
+
+		It("does not bump the freshness", func() {
+			isFresh, _ := store.IsActualStateFresh(freshByTime)
+			Ω(isFresh).Should(BeFalse())
+		})
+
+		It("logs about the failed parse", func() {
+			Ω(logger.LoggedSubjects).Should(ContainElement("Could not unmarshal cell report"))
 		})
 	})
 
@@ -299,6 +636,110 @@ var _ = Describe("Actual state listener", func() {
 		It("logs about the failed parse", func() {
 			Ω(logger.LoggedSubjects).Should(ContainElement("Could not unmarshal heartbeat"))
 		})
+
+		It("counts a decode error", func() {
+			Ω(metricsAccountant.Errors["Listener"]).Should(HaveLen(1))
+			Ω(errorcategory.Of(metricsAccountant.Errors["Listener"][0])).Should(Equal(errorcategory.DecodeError))
+		})
+	})
+
+	Describe("the freshness lease", func() {
+		freshnessKeyExists := func() bool {
+			_, err := storeAdapter.Get("/hm/v1" + conf.ActualFreshnessKey)
+			return err == nil
+		}
+
+		leaseTicks := func() bool {
+			ticker := timeProvider.TickerChannelFor(storepackage.ActualFreshnessLeaseTimer)
+			for i := 0; i < 2; i++ {
+				select {
+				case ticker <- time.Now():
+				case <-time.After(100 * time.Millisecond):
+					return false
+				}
+			}
+			return true
+		}
+
+		BeforeEach(func() {
+			messageBus.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{
+				Data: app.Heartbeat(1).ToJSON(),
+			})
+
+			forceHeartbeatSync()
+			store.RevokeActualFreshness()
+		})
+
+		It("refreshes the freshness while heartbeats keep arriving", func() {
+			Ω(leaseTicks()).Should(BeTrue())
+			Ω(freshnessKeyExists()).Should(BeTrue())
+		})
+
+		Context("when nothing has arrived for a heartbeat period", func() {
+			BeforeEach(func() {
+				timeProvider.IncrementBySeconds(uint64(conf.HeartbeatPeriod.Duration / time.Second))
+				forceHeartbeatSync()
+			})
+
+			It("stops refreshing the freshness", func() {
+				Ω(leaseTicks()).Should(BeTrue())
+				Ω(freshnessKeyExists()).Should(BeFalse())
+			})
+		})
+
+		Context("when a save fails", func() {
+			BeforeEach(func() {
+				store.BumpActualFreshness(timeProvider.Time())
+				storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector(anotherApp.InstanceAtIndex(0).InstanceGuid, errors.New("oops"))
+
+				messageBus.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{
+					Data: anotherApp.Heartbeat(1).ToJSON(),
+				})
+
+				forceHeartbeatSync()
+			})
+
+			It("revokes the freshness and stops the lease", func() {
+				Ω(freshnessKeyExists()).Should(BeFalse())
+				Ω(leaseTicks()).Should(BeFalse())
+			})
+		})
+
+		Context("when the listener stops", func() {
+			BeforeEach(func() {
+				listener.Stop()
+			})
+
+			It("stops the lease", func() {
+				Ω(leaseTicks()).Should(BeFalse())
+			})
+		})
+	})
+
+	Describe("stopping", func() {
+		BeforeEach(func() {
+			messageBus.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{
+				Data: app.Heartbeat(1).ToJSON(),
+			})
+
+			listener.Stop()
+		})
+
+		It("unsubscribes from heartbeats and advertisements", func() {
+			Ω(messageBus.Subscriptions("dea.heartbeat")).Should(BeEmpty())
+			Ω(messageBus.Subscriptions("dea.advertise")).Should(BeEmpty())
+		})
+
+		It("saves the heartbeats received since the last sync", func() {
+			foundApp, err := store.GetApp(app.AppGuid, app.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(foundApp.InstanceHeartbeats).Should(ContainElement(app.InstanceAtIndex(0).Heartbeat()))
+		})
+
+		It("tracks their metrics", func() {
+			Ω(metricsAccountant.SavedHeartbeats).Should(Equal(1))
+			Ω(metricsAccountant.ReceivedHeartbeats).Should(Equal(1))
+		})
 	})
 
 	Context("when there are no NATS messages coming down the pipe", func() {
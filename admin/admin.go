@@ -0,0 +1,134 @@
+// Package admin lets operators pause and resume the polling components, and
+// limit the sender's rate, while they keep running, so that responding to an
+// incident needs neither SSH nor monit.  The controls are kept in the store,
+// where they reach every process running a component and outlive restarts.
+package admin
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+// Components are the components that can be controlled, by the names used
+// in "components" sections of the config.
+var Components = []string{"fetcher", "analyzer", "sender", "shredder", "aggregator"}
+
+var UnknownComponentError = errors.New("Unknown component")
+var NegativeMessageLimitError = errors.New("message_limit must not be negative")
+var MessageLimitNotSupportedError = errors.New("Only the sender takes a message_limit")
+
+// Update changes how a component is controlled.  Fields left out keep their
+// current values.  Reason is recorded with the change, for whoever looks at
+// the component next.
+type Update struct {
+	Paused       *bool  `json:"paused,omitempty"`
+	MessageLimit *int   `json:"message_limit,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+type Controller struct {
+	store        store.Store
+	timeProvider timeprovider.TimeProvider
+	logger       logger.Logger
+}
+
+func New(store store.Store, timeProvider timeprovider.TimeProvider, logger logger.Logger) *Controller {
+	return &Controller{
+		store:        store,
+		timeProvider: timeProvider,
+		logger:       logger,
+	}
+}
+
+// Controls returns how every component is controlled, in the order of
+// Components.  Components nobody has controlled are running, unlimited.
+func (controller *Controller) Controls() ([]models.ComponentControl, error) {
+	saved, err := controller.store.GetComponentControls()
+	if err != nil {
+		return nil, err
+	}
+
+	controls := []models.ComponentControl{}
+	for _, component := range Components {
+		controls = append(controls, controlOf(saved, component))
+	}
+	return controls, nil
+}
+
+// Control returns how the component is controlled.
+func (controller *Controller) Control(component string) (models.ComponentControl, error) {
+	if !isComponent(component) {
+		return models.ComponentControl{}, UnknownComponentError
+	}
+
+	saved, err := controller.store.GetComponentControls()
+	if err != nil {
+		return models.ComponentControl{}, err
+	}
+	return controlOf(saved, component), nil
+}
+
+// Apply makes the update to the component's control on behalf of operator,
+// and logs it for audit.
+func (controller *Controller) Apply(component string, update Update, operator string) (models.ComponentControl, error) {
+	if update.MessageLimit != nil {
+		if *update.MessageLimit < 0 {
+			return models.ComponentControl{}, NegativeMessageLimitError
+		}
+		if component != "sender" {
+			return models.ComponentControl{}, MessageLimitNotSupportedError
+		}
+	}
+
+	control, err := controller.Control(component)
+	if err != nil {
+		return models.ComponentControl{}, err
+	}
+
+	if update.Paused != nil {
+		control.Paused = *update.Paused
+	}
+	if update.MessageLimit != nil {
+		control.MessageLimit = *update.MessageLimit
+	}
+	control.Reason = update.Reason
+	control.ChangedBy = operator
+	control.ChangedAt = controller.timeProvider.Time().Unix()
+
+	err = controller.store.SaveComponentControl(control)
+	if err != nil {
+		return models.ComponentControl{}, err
+	}
+
+	controller.logger.Info("Audit: component control changed", map[string]string{
+		"Component":    component,
+		"Paused":       strconv.FormatBool(control.Paused),
+		"MessageLimit": strconv.Itoa(control.MessageLimit),
+		"Reason":       control.Reason,
+		"Operator":     operator,
+	})
+
+	return control, nil
+}
+
+func controlOf(saved map[string]models.ComponentControl, component string) models.ComponentControl {
+	control, ok := saved[component]
+	if !ok {
+		return models.ComponentControl{Component: component}
+	}
+	return control
+}
+
+func isComponent(component string) bool {
+	for _, known := range Components {
+		if known == component {
+			return true
+		}
+	}
+	return false
+}
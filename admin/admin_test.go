@@ -0,0 +1,123 @@
+package admin_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+
+	. "github.com/cloudfoundry/hm9000/admin"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Controller", func() {
+	var (
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		store        storepackage.Store
+		logger       *fakelogger.FakeLogger
+		controller   *Controller
+	)
+
+	paused := true
+	resumed := false
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		logger = fakelogger.NewFakeLogger()
+		controller = New(store, &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}, logger)
+	})
+
+	Describe("Controls", func() {
+		It("reports every component, running unless controlled otherwise", func() {
+			store.SaveComponentControl(models.ComponentControl{Component: "sender", Paused: true})
+
+			controls, err := controller.Controls()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(controls).Should(Equal([]models.ComponentControl{
+				{Component: "fetcher"},
+				{Component: "analyzer"},
+				{Component: "sender", Paused: true},
+				{Component: "shredder"},
+				{Component: "aggregator"},
+			}))
+		})
+
+		It("returns the store's errors", func() {
+			storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("component-controls", storeadapter.ErrorTimeout)
+
+			_, err := controller.Controls()
+			Ω(err).Should(Equal(storeadapter.ErrorTimeout))
+		})
+	})
+
+	Describe("Control", func() {
+		It("reports one component", func() {
+			control, err := controller.Control("analyzer")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(control).Should(Equal(models.ComponentControl{Component: "analyzer"}))
+		})
+
+		It("rejects components that cannot be controlled", func() {
+			_, err := controller.Control("listener")
+			Ω(err).Should(Equal(UnknownComponentError))
+		})
+	})
+
+	Describe("Apply", func() {
+		It("pauses and resumes a component, recording who did it and why", func() {
+			control, err := controller.Apply("analyzer", Update{Paused: &paused, Reason: "incident 42"}, "admin")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(control).Should(Equal(models.ComponentControl{Component: "analyzer", Paused: true, Reason: "incident 42", ChangedBy: "admin", ChangedAt: 100}))
+
+			controls, _ := store.GetComponentControls()
+			Ω(controls["analyzer"]).Should(Equal(control))
+
+			control, err = controller.Apply("analyzer", Update{Paused: &resumed}, "admin")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(control.Paused).Should(BeFalse())
+		})
+
+		It("keeps what the update leaves out", func() {
+			limit := 5
+			controller.Apply("sender", Update{Paused: &paused}, "admin")
+
+			control, err := controller.Apply("sender", Update{MessageLimit: &limit}, "admin")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(control.Paused).Should(BeTrue())
+			Ω(control.MessageLimit).Should(Equal(5))
+		})
+
+		It("logs every change for audit", func() {
+			controller.Apply("sender", Update{Paused: &paused, Reason: "incident 42"}, "admin")
+			Ω(logger.LoggedSubjects).Should(ContainElement("Audit: component control changed"))
+		})
+
+		It("rejects negative message limits", func() {
+			limit := -1
+			_, err := controller.Apply("sender", Update{MessageLimit: &limit}, "admin")
+			Ω(err).Should(Equal(NegativeMessageLimitError))
+		})
+
+		It("rejects message limits for anything but the sender", func() {
+			limit := 5
+			_, err := controller.Apply("analyzer", Update{MessageLimit: &limit}, "admin")
+			Ω(err).Should(Equal(MessageLimitNotSupportedError))
+		})
+
+		It("rejects components that cannot be controlled", func() {
+			_, err := controller.Apply("listener", Update{Paused: &paused}, "admin")
+			Ω(err).Should(Equal(UnknownComponentError))
+
+			controls, _ := store.GetComponentControls()
+			Ω(controls).Should(BeEmpty())
+		})
+	})
+})
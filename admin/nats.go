@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// Request is a request to the admin API over NATS, carrying the admin
+// credentials.  With an Update it applies it to Component; without one it
+// asks how Component is controlled, or every component if Component is
+// empty.
+type Request struct {
+	Username  string  `json:"username"`
+	Password  string  `json:"password"`
+	Component string  `json:"component,omitempty"`
+	Update    *Update `json:"update,omitempty"`
+}
+
+// Response is the reply to a Request: the controls asked for or changed,
+// or why the request failed.
+type Response struct {
+	Controls []models.ComponentControl `json:"controls,omitempty"`
+	Error    string                    `json:"error,omitempty"`
+}
+
+// NATSResponder answers Requests published on a subject, with a reply
+// subject, by the admin user.  With a queue, only one of the responders
+// subscribed in it answers each request.
+type NATSResponder struct {
+	messageBus   messagebus.MessageBus
+	subject      string
+	queue        string
+	username     string
+	password     string
+	controller   *Controller
+	logger       logger.Logger
+	subscription *nats.Subscription
+}
+
+func NewNATSResponder(messageBus messagebus.MessageBus, subject string, queue string, username string, password string, controller *Controller, logger logger.Logger) *NATSResponder {
+	return &NATSResponder{
+		messageBus: messageBus,
+		subject:    subject,
+		queue:      queue,
+		username:   username,
+		password:   password,
+		controller: controller,
+		logger:     logger,
+	}
+}
+
+func (responder *NATSResponder) Start() error {
+	subscription, err := responder.messageBus.QueueSubscribe(responder.subject, responder.queue, func(message *nats.Msg) {
+		if message.Reply == "" {
+			return
+		}
+
+		body, _ := json.Marshal(responder.respond(message.Data))
+		err := responder.messageBus.Publish(message.Reply, body)
+		if err != nil {
+			responder.logger.Error("Failed to reply to admin request", err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	responder.subscription = subscription
+	return nil
+}
+
+func (responder *NATSResponder) Stop() {
+	if responder.subscription != nil {
+		responder.messageBus.Unsubscribe(responder.subscription)
+		responder.subscription = nil
+	}
+}
+
+func (responder *NATSResponder) respond(data []byte) Response {
+	request := Request{}
+	err := json.Unmarshal(data, &request)
+	if err != nil {
+		return Response{Error: "Failed to parse request"}
+	}
+
+	if !sameCredential(request.Username, responder.username) || !sameCredential(request.Password, responder.password) {
+		responder.logger.Info("Rejected admin request with bad credentials", map[string]string{"Username": request.Username})
+		return Response{Error: "Unauthorized"}
+	}
+
+	var controls []models.ComponentControl
+	switch {
+	case request.Update != nil:
+		var control models.ComponentControl
+		control, err = responder.controller.Apply(request.Component, *request.Update, request.Username)
+		controls = []models.ComponentControl{control}
+	case request.Component != "":
+		var control models.ComponentControl
+		control, err = responder.controller.Control(request.Component)
+		controls = []models.ComponentControl{control}
+	default:
+		controls, err = responder.controller.Controls()
+	}
+
+	if err != nil {
+		return Response{Error: err.Error()}
+	}
+	return Response{Controls: controls}
+}
+
+func sameCredential(given, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
@@ -0,0 +1,103 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+
+	. "github.com/cloudfoundry/hm9000/admin"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NATSResponder", func() {
+	var (
+		messageBus *fakeyagnats.FakeNATSConn
+		store      storepackage.Store
+		responder  *NATSResponder
+	)
+
+	request := func(request Request) Response {
+		data, _ := json.Marshal(request)
+		messageBus.SubjectCallbacks("hm9000.admin")[0](&nats.Msg{Subject: "hm9000.admin", Reply: "reply-to", Data: data})
+
+		replies := messageBus.PublishedMessages("reply-to")
+		Ω(replies).ShouldNot(BeEmpty())
+		response := Response{}
+		json.Unmarshal(replies[len(replies)-1].Data, &response)
+		return response
+	}
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		store = storepackage.NewStore(conf, fakestoreadapter.New(), fakelogger.NewFakeLogger())
+		messageBus = fakeyagnats.Connect()
+		controller := New(store, &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}, fakelogger.NewFakeLogger())
+		responder = NewNATSResponder(messageBus, "hm9000.admin", "hm9000", "admin", "secret", controller, fakelogger.NewFakeLogger())
+
+		err := responder.Start()
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("subscribes in the queue group", func() {
+		Ω(messageBus.Subscriptions("hm9000.admin")).Should(HaveLen(1))
+		Ω(messageBus.Subscriptions("hm9000.admin")[0].Queue).Should(Equal("hm9000"))
+	})
+
+	It("reports every component", func() {
+		response := request(Request{Username: "admin", Password: "secret"})
+		Ω(response.Error).Should(BeEmpty())
+		Ω(response.Controls).Should(HaveLen(len(Components)))
+	})
+
+	It("reports one component", func() {
+		response := request(Request{Username: "admin", Password: "secret", Component: "sender"})
+		Ω(response.Controls).Should(HaveLen(1))
+		Ω(response.Controls[0].Component).Should(Equal("sender"))
+	})
+
+	It("applies updates", func() {
+		paused := true
+		response := request(Request{Username: "admin", Password: "secret", Component: "sender", Update: &Update{Paused: &paused}})
+		Ω(response.Error).Should(BeEmpty())
+		Ω(response.Controls[0].Paused).Should(BeTrue())
+		Ω(response.Controls[0].ChangedBy).Should(Equal("admin"))
+
+		controls, _ := store.GetComponentControls()
+		Ω(controls["sender"].Paused).Should(BeTrue())
+	})
+
+	It("replies with the error when a request fails", func() {
+		response := request(Request{Username: "admin", Password: "secret", Component: "listener"})
+		Ω(response.Error).Should(Equal(UnknownComponentError.Error()))
+	})
+
+	It("refuses requests without the admin credentials", func() {
+		paused := true
+		response := request(Request{Username: "admin", Password: "wrong", Component: "sender", Update: &Update{Paused: &paused}})
+		Ω(response.Error).Should(Equal("Unauthorized"))
+
+		controls, _ := store.GetComponentControls()
+		Ω(controls).Should(BeEmpty())
+	})
+
+	It("replies to requests that do not parse", func() {
+		messageBus.SubjectCallbacks("hm9000.admin")[0](&nats.Msg{Subject: "hm9000.admin", Reply: "reply-to", Data: []byte("∂")})
+
+		response := Response{}
+		json.Unmarshal(messageBus.PublishedMessages("reply-to")[0].Data, &response)
+		Ω(response.Error).Should(Equal("Failed to parse request"))
+	})
+
+	It("unsubscribes when stopped", func() {
+		responder.Stop()
+		Ω(messageBus.Subscriptions("hm9000.admin")).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,151 @@
+package aggregator
+
+import (
+	"strconv"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+// Aggregator keeps the store's app summaries in step with the desired and
+// actual state, so that the API and the metrics server can read one small
+// key per app.
+type Aggregator struct {
+	store        store.Store
+	timeProvider timeprovider.TimeProvider
+	logger       logger.Logger
+	conf         *config.Config
+}
+
+func New(store store.Store, timeProvider timeprovider.TimeProvider, logger logger.Logger, conf *config.Config) *Aggregator {
+	return &Aggregator{
+		store:        store,
+		timeProvider: timeProvider,
+		logger:       logger,
+		conf:         conf,
+	}
+}
+
+// Aggregate brings the summaries in line with the store, writing only those
+// that changed, and marks them fresh.  With listener_updates_app_summaries
+// set the listener keeps the instances in the summaries up to date, and only
+// the apps whose desired state has changed are summarized again; otherwise
+// every app is.  It leaves the summaries alone when the store is not fresh,
+// rather than summarize a partial view of the apps.
+func (aggregator *Aggregator) Aggregate() error {
+	err := aggregator.store.VerifyFreshness(aggregator.timeProvider.Time())
+	if err != nil {
+		aggregator.logger.Error("Store is not fresh", err)
+		return err
+	}
+
+	var saved, deleted int
+	if aggregator.conf.ListenerUpdatesAppSummaries {
+		saved, deleted, err = aggregator.syncDesiredStates()
+	} else {
+		saved, deleted, err = aggregator.syncApps()
+	}
+	if err != nil {
+		aggregator.logger.Error("Failed to sync app summaries", err)
+		return err
+	}
+
+	err = aggregator.store.BumpAppSummariesFreshness(aggregator.timeProvider.Time())
+	if err != nil {
+		aggregator.logger.Error("Failed to bump the freshness of the app summaries", err)
+		return err
+	}
+
+	aggregator.logger.Info("Synced app summaries", map[string]string{
+		"Saved":   strconv.Itoa(saved),
+		"Deleted": strconv.Itoa(deleted),
+	})
+	return nil
+}
+
+// syncApps summarizes every app and syncs the summaries.
+func (aggregator *Aggregator) syncApps() (saved int, deleted int, err error) {
+	apps, err := aggregator.store.GetApps()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	summaries := make([]models.AppSummary, 0, len(apps))
+	for _, app := range apps {
+		summaries = append(summaries, models.NewAppSummary(app))
+	}
+
+	return aggregator.store.SyncAppSummaries(summaries...)
+}
+
+// syncDesiredStates summarizes again, from their instance heartbeats, the
+// apps whose desired state differs from the one they were summarized with:
+// those newly desired, changed, or no longer desired.  The summaries of the
+// apps that are neither desired nor have instances left are deleted.
+func (aggregator *Aggregator) syncDesiredStates() (saved int, deleted int, err error) {
+	desiredStates, err := aggregator.store.GetDesiredState()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	summaries, err := aggregator.store.GetAppSummaries()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	changed := []models.AppSummary{}
+	gone := []models.AppSummary{}
+	resummarize := func(appGuid string, appVersion string, desired models.DesiredAppState) error {
+		instanceHeartbeats, err := aggregator.store.GetInstanceHeartbeatsForApp(appGuid, appVersion)
+		if err != nil {
+			return err
+		}
+
+		summary := models.NewAppSummary(models.NewApp(appGuid, appVersion, desired, instanceHeartbeats, map[int]models.CrashCount{}))
+		if summary.IsDesired() || summary.HasInstances() {
+			changed = append(changed, summary)
+		} else {
+			gone = append(gone, summary)
+		}
+		return nil
+	}
+
+	for key, desired := range desiredStates {
+		summary, found := summaries[key]
+		if found && summary.IsSummaryOfDesiredState(desired) {
+			continue
+		}
+		err = resummarize(desired.AppGuid, desired.AppVersion, desired)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	for key, summary := range summaries {
+		if _, desired := desiredStates[key]; desired {
+			continue
+		}
+		if !summary.IsDesired() && summary.HasInstances() {
+			continue
+		}
+		err = resummarize(summary.AppGuid, summary.AppVersion, models.DesiredAppState{})
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	err = aggregator.store.SaveAppSummaries(changed...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = aggregator.store.DeleteAppSummaries(gone...)
+	if err != nil {
+		return len(changed), 0, err
+	}
+
+	return len(changed), len(gone), nil
+}
@@ -0,0 +1,173 @@
+package aggregator_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	. "github.com/cloudfoundry/hm9000/aggregator"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Aggregator", func() {
+	var (
+		aggregator   *Aggregator
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		store        storepackage.Store
+		conf         *config.Config
+		app          appfixture.AppFixture
+		undesiredApp appfixture.AppFixture
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		aggregator = New(store, &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(1000, 0)}, fakelogger.NewFakeLogger(), conf)
+
+		app = appfixture.NewAppFixture()
+		undesiredApp = appfixture.NewAppFixture()
+
+		store.BumpActualFreshness(time.Unix(100, 0))
+		store.BumpDesiredFreshness(time.Unix(100, 0))
+		store.SyncDesiredState(app.DesiredState(3))
+		store.SyncHeartbeats(app.Heartbeat(2), undesiredApp.Heartbeat(1))
+	})
+
+	It("summarizes every app", func() {
+		err := aggregator.Aggregate()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		summaries, err := store.GetAppSummaries()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(summaries).Should(HaveLen(2))
+
+		summary, err := store.GetAppSummary(app.AppGuid, app.AppVersion)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(summary.State).Should(Equal(models.AppStateStarted))
+		Ω(summary.DesiredInstances).Should(Equal(3))
+		Ω(summary.RunningInstances).Should(Equal(2))
+		Ω(summary.MissingIndices).Should(Equal(1))
+
+		summary, err = store.GetAppSummary(undesiredApp.AppGuid, undesiredApp.AppVersion)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(summary.IsDesired()).Should(BeFalse())
+		Ω(summary.RunningInstances).Should(Equal(1))
+	})
+
+	It("only writes the summaries that changed", func() {
+		aggregator.Aggregate()
+		summaryKey := "/hm/v1/apps/summaries/" + undesiredApp.AppGuid + "," + undesiredApp.AppVersion
+		node, _ := storeAdapter.Get(summaryKey)
+		untouched := append(node.Value, ' ')
+		storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: summaryKey, Value: untouched}})
+		store.SyncHeartbeats(app.Heartbeat(3), undesiredApp.Heartbeat(1))
+
+		aggregator.Aggregate()
+
+		node, _ = storeAdapter.Get(summaryKey)
+		Ω(node.Value).Should(Equal(untouched))
+		summary, _ := store.GetAppSummary(app.AppGuid, app.AppVersion)
+		Ω(summary.RunningInstances).Should(Equal(3))
+	})
+
+	It("marks the summaries fresh", func() {
+		fresh, _ := store.AreAppSummariesFresh()
+		Ω(fresh).Should(BeFalse())
+
+		err := aggregator.Aggregate()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fresh, err = store.AreAppSummariesFresh()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(fresh).Should(BeTrue())
+		node, _ := storeAdapter.Get("/hm/v1/app-summaries-fresh")
+		Ω(node.TTL).Should(BeNumerically("==", conf.AppSummariesFreshnessTTL()))
+	})
+
+	It("deletes the summaries of apps that are gone", func() {
+		aggregator.Aggregate()
+		storeAdapter.Delete("/hm/v1/apps/actual/" + undesiredApp.AppGuid + "," + undesiredApp.AppVersion + "/" + undesiredApp.InstanceAtIndex(0).InstanceGuid)
+
+		aggregator.Aggregate()
+
+		_, err := store.GetAppSummary(undesiredApp.AppGuid, undesiredApp.AppVersion)
+		Ω(err).Should(Equal(storepackage.AppNotFoundError))
+	})
+
+	Context("with listener_updates_app_summaries set", func() {
+		BeforeEach(func() {
+			conf.ListenerUpdatesAppSummaries = true
+			err := aggregator.Aggregate()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("summarizes the apps whose desired state changed from their instance heartbeats", func() {
+			summary, err := store.GetAppSummary(app.AppGuid, app.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary.DesiredInstances).Should(Equal(3))
+			Ω(summary.RunningInstances).Should(Equal(2))
+			Ω(summary.MissingIndices).Should(Equal(1))
+
+			store.SyncDesiredState(app.DesiredState(2))
+			err = aggregator.Aggregate()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			summary, _ = store.GetAppSummary(app.AppGuid, app.AppVersion)
+			Ω(summary.DesiredInstances).Should(Equal(2))
+			Ω(summary.MissingIndices).Should(BeZero())
+		})
+
+		It("leaves the instances of the other apps to the listener", func() {
+			storeAdapter.Delete("/hm/v1/apps/actual/" + app.AppGuid + "," + app.AppVersion + "/" + app.InstanceAtIndex(0).InstanceGuid)
+
+			err := aggregator.Aggregate()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			summary, _ := store.GetAppSummary(app.AppGuid, app.AppVersion)
+			Ω(summary.RunningInstances).Should(Equal(2))
+		})
+
+		It("summarizes the apps that left the desired state, deleting those with no instances", func() {
+			other := appfixture.NewAppFixture()
+			store.SyncDesiredState(app.DesiredState(3), other.DesiredState(1))
+			err := aggregator.Aggregate()
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = store.GetAppSummary(other.AppGuid, other.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			store.SyncDesiredState()
+			err = aggregator.Aggregate()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			summary, err := store.GetAppSummary(app.AppGuid, app.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary.IsDesired()).Should(BeFalse())
+			Ω(summary.RunningInstances).Should(Equal(2))
+
+			_, err = store.GetAppSummary(other.AppGuid, other.AppVersion)
+			Ω(err).Should(Equal(storepackage.AppNotFoundError))
+		})
+	})
+
+	Context("when the store is not fresh", func() {
+		BeforeEach(func() {
+			storeAdapter.Delete("/hm/v1/actual-fresh")
+		})
+
+		It("leaves the summaries alone", func() {
+			err := aggregator.Aggregate()
+			Ω(err).Should(Equal(storepackage.ActualIsNotFreshError))
+
+			summaries, _ := store.GetAppSummaries()
+			Ω(summaries).Should(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,112 @@
+package analyzer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// Activity is what a run of the analyzer found to do.
+type Activity struct {
+	StartMessages int
+	StopMessages  int
+	Crashes       int
+	Evacuations   int
+}
+
+func newActivity(startMessages []models.PendingStartMessage, stopMessages []models.PendingStopMessage) Activity {
+	activity := Activity{
+		StartMessages: len(startMessages),
+		StopMessages:  len(stopMessages),
+	}
+	for _, message := range startMessages {
+		switch message.StartReason {
+		case models.PendingStartMessageReasonCrashed:
+			activity.Crashes++
+		case models.PendingStartMessageReasonEvacuating:
+			activity.Evacuations++
+		}
+	}
+	return activity
+}
+
+// IsQuiet is true when the run found nothing to start or stop.
+func (activity Activity) IsQuiet() bool {
+	return activity.StartMessages == 0 && activity.StopMessages == 0
+}
+
+// IsIncident is true when the run found crashed or evacuating instances.
+func (activity Activity) IsIncident() bool {
+	return activity.Crashes > 0 || activity.Evacuations > 0
+}
+
+// AdaptivePolling times the analyzer's runs by how busy they are.  Each quiet
+// run doubles the interval between runs, up to the analyzer's max polling
+// interval, and a run that finds crashes or evacuations drops it straight to
+// the min, so that the analyzer does little while nothing happens and reacts
+// quickly once something does.  Other runs leave it be.
+type AdaptivePolling struct {
+	conf   *config.Config
+	logger logger.Logger
+
+	mutex    *sync.Mutex
+	interval time.Duration
+}
+
+func NewAdaptivePolling(conf *config.Config, logger logger.Logger) *AdaptivePolling {
+	return &AdaptivePolling{
+		conf:     conf,
+		logger:   logger,
+		mutex:    &sync.Mutex{},
+		interval: conf.AnalyzerPollingInterval(),
+	}
+}
+
+// Interval is the time from the start of one run to the start of the next.
+func (polling *AdaptivePolling) Interval() time.Duration {
+	polling.mutex.Lock()
+	defer polling.mutex.Unlock()
+	return polling.bounded(polling.interval)
+}
+
+// Record adjusts the interval for what a run found.
+func (polling *AdaptivePolling) Record(activity Activity) {
+	polling.mutex.Lock()
+	defer polling.mutex.Unlock()
+
+	old := polling.bounded(polling.interval)
+	reason := ""
+	switch {
+	case activity.IsIncident():
+		polling.interval = polling.conf.AnalyzerMinPollingInterval()
+		reason = "crashes or evacuations"
+	case activity.IsQuiet():
+		polling.interval = polling.bounded(old * 2)
+		reason = "nothing to do"
+	default:
+		polling.interval = old
+	}
+
+	if polling.interval != old {
+		polling.logger.Info("Changed the analyzer polling interval", map[string]string{
+			"Old Interval": old.String(),
+			"New Interval": polling.interval.String(),
+			"Reason":       reason,
+		})
+	}
+}
+
+// bounded keeps interval between the min and max polling intervals, which
+// may have been reloaded since it was worked out.
+func (polling *AdaptivePolling) bounded(interval time.Duration) time.Duration {
+	if min := polling.conf.AnalyzerMinPollingInterval(); interval < min {
+		return min
+	}
+	if max := polling.conf.AnalyzerMaxPollingInterval(); interval > max {
+		return max
+	}
+	return interval
+}
@@ -0,0 +1,129 @@
+package analyzer_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/analyzer"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"time"
+)
+
+var _ = Describe("AdaptivePolling", func() {
+	var (
+		conf    *config.Config
+		logger  *fakelogger.FakeLogger
+		polling *AdaptivePolling
+		quiet   Activity
+		busy    Activity
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		conf.HeartbeatPeriod = config.DurationInSeconds{10 * time.Second}
+		conf.AnalyzerPollingIntervalInHeartbeats = 2
+		conf.AnalyzerMinPollingIntervalInHeartbeats = 1
+		conf.AnalyzerMaxPollingIntervalInHeartbeats = 6
+
+		logger = fakelogger.NewFakeLogger()
+		polling = NewAdaptivePolling(conf, logger)
+
+		quiet = Activity{}
+		busy = Activity{StartMessages: 2, StopMessages: 1}
+	})
+
+	It("should start at the analyzer polling interval", func() {
+		Ω(polling.Interval()).Should(Equal(20 * time.Second))
+	})
+
+	Context("when runs find nothing to do", func() {
+		It("should double the interval up to the max", func() {
+			polling.Record(quiet)
+			Ω(polling.Interval()).Should(Equal(40 * time.Second))
+			polling.Record(quiet)
+			Ω(polling.Interval()).Should(Equal(60 * time.Second))
+			polling.Record(quiet)
+			Ω(polling.Interval()).Should(Equal(60 * time.Second))
+		})
+
+		It("should log the change", func() {
+			polling.Record(quiet)
+			Ω(logger.LoggedSubjects).Should(Equal([]string{"Changed the analyzer polling interval"}))
+
+			polling.Record(quiet)
+			polling.Record(quiet)
+			Ω(logger.LoggedSubjects).Should(HaveLen(2))
+		})
+	})
+
+	Context("when a run finds crashes", func() {
+		It("should drop the interval to the min", func() {
+			polling.Record(quiet)
+			polling.Record(Activity{StartMessages: 1, Crashes: 1})
+			Ω(polling.Interval()).Should(Equal(10 * time.Second))
+		})
+	})
+
+	Context("when a run finds evacuations", func() {
+		It("should drop the interval to the min", func() {
+			polling.Record(Activity{StartMessages: 1, Evacuations: 1})
+			Ω(polling.Interval()).Should(Equal(10 * time.Second))
+		})
+	})
+
+	Context("when a run finds other things to do", func() {
+		It("should leave the interval be", func() {
+			polling.Record(quiet)
+			polling.Record(busy)
+			Ω(polling.Interval()).Should(Equal(40 * time.Second))
+
+			polling.Record(Activity{StartMessages: 1, Crashes: 1})
+			polling.Record(busy)
+			Ω(polling.Interval()).Should(Equal(10 * time.Second))
+		})
+
+		It("should not log", func() {
+			polling.Record(busy)
+			Ω(logger.LoggedSubjects).Should(BeEmpty())
+		})
+	})
+
+	Context("when the bounds are 0", func() {
+		BeforeEach(func() {
+			conf.AnalyzerMinPollingIntervalInHeartbeats = 0
+			conf.AnalyzerMaxPollingIntervalInHeartbeats = 0
+		})
+
+		It("should always poll at the analyzer polling interval", func() {
+			polling.Record(quiet)
+			Ω(polling.Interval()).Should(Equal(20 * time.Second))
+			polling.Record(Activity{StartMessages: 1, Crashes: 1})
+			Ω(polling.Interval()).Should(Equal(20 * time.Second))
+			Ω(logger.LoggedSubjects).Should(BeEmpty())
+		})
+	})
+
+	Context("when the bounds are reloaded", func() {
+		It("should keep the interval within the new bounds", func() {
+			polling.Record(quiet)
+			polling.Record(quiet)
+			conf.AnalyzerMaxPollingIntervalInHeartbeats = 3
+			Ω(polling.Interval()).Should(Equal(30 * time.Second))
+		})
+	})
+})
+
+var _ = Describe("Activity", func() {
+	It("should be quiet when there is nothing to start or stop", func() {
+		Ω(Activity{}.IsQuiet()).Should(BeTrue())
+		Ω(Activity{StartMessages: 1}.IsQuiet()).Should(BeFalse())
+		Ω(Activity{StopMessages: 1}.IsQuiet()).Should(BeFalse())
+	})
+
+	It("should be an incident when there are crashes or evacuations", func() {
+		Ω(Activity{StartMessages: 1}.IsIncident()).Should(BeFalse())
+		Ω(Activity{StartMessages: 1, Crashes: 1}.IsIncident()).Should(BeTrue())
+		Ω(Activity{StartMessages: 1, Evacuations: 1}.IsIncident()).Should(BeTrue())
+	})
+})
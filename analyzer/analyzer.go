@@ -1,43 +1,96 @@
 package analyzer
 
 import (
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
 	"github.com/cloudfoundry/gunk/timeprovider"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/countingstoreadapter"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
+	"github.com/cloudfoundry/hm9000/helpers/webhooks"
 	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/hm9000/store"
 )
 
 type Analyzer struct {
-	store store.Store
+	store             store.Store
+	metricsAccountant metricsaccountant.MetricsAccountant
+	notifier          webhooks.Notifier
 
 	logger       logger.Logger
 	timeProvider timeprovider.TimeProvider
 	conf         *config.Config
+
+	activity      Activity
+	appsScanned   int
+	storeRequests *countingstoreadapter.CountingStoreAdapter
 }
 
-func New(store store.Store, timeProvider timeprovider.TimeProvider, logger logger.Logger, conf *config.Config) *Analyzer {
+func New(store store.Store, metricsAccountant metricsaccountant.MetricsAccountant, notifier webhooks.Notifier, timeProvider timeprovider.TimeProvider, logger logger.Logger, conf *config.Config) *Analyzer {
 	return &Analyzer{
-		store:        store,
-		timeProvider: timeProvider,
-		logger:       logger,
-		conf:         conf,
+		store:             store,
+		metricsAccountant: metricsAccountant,
+		notifier:          notifier,
+		timeProvider:      timeProvider,
+		logger:            logger,
+		conf:              conf,
 	}
 }
 
+// CountStoreRequests has the analysis report count the requests made
+// through storeRequests, which should be the adapter under the analyzer's
+// store.  Without it the report counts no store requests.
+func (analyzer *Analyzer) CountStoreRequests(storeRequests *countingstoreadapter.CountingStoreAdapter) {
+	analyzer.storeRequests = storeRequests
+}
+
+// Analyze runs the analysis, and after a successful run saves and tracks an
+// analysis report of what it cost.  The allocations counted are the whole
+// process's, so under hm9000 serve they include the other components'.
 func (analyzer *Analyzer) Analyze() error {
+	if analyzer.storeRequests != nil {
+		analyzer.storeRequests.Collect()
+	}
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+	startedAt := time.Now()
+
+	err := analyzer.analyze()
+	if err != nil {
+		return err
+	}
+
+	analyzer.reportCost(time.Since(startedAt), memStats)
+	return nil
+}
+
+func (analyzer *Analyzer) analyze() error {
 	err := analyzer.store.VerifyFreshness(analyzer.timeProvider.Time())
+	analyzer.notifier.ReportFreshness(err)
 	if err != nil {
 		analyzer.logger.Error("Store is not fresh", err)
 		return err
 	}
 
+	desiredStateSyncing := analyzer.isDesiredStateSyncInProgress()
+
 	apps, err := analyzer.store.GetApps()
 	if err != nil {
 		analyzer.logger.Error("Failed to fetch apps", err)
 		return err
 	}
 
+	if !desiredStateSyncing {
+		desiredStateSyncing = analyzer.isDesiredStateSyncInProgress()
+	}
+	if desiredStateSyncing {
+		analyzer.logger.Info("Deferring stops: the desired state is being synced")
+	}
+
 	existingPendingStartMessages, err := analyzer.store.GetPendingStartMessages()
 	if err != nil {
 		analyzer.logger.Error("Failed to fetch pending start messages", err)
@@ -50,12 +103,97 @@ func (analyzer *Analyzer) Analyze() error {
 		return err
 	}
 
+	undesiredApps := map[string]int{}
+	if analyzer.conf.StoppedAppRequiresTwoSyncs {
+		undesiredApps, err = analyzer.store.GetUndesiredApps()
+		if err != nil {
+			analyzer.logger.Error("Failed to fetch the apps that left the desired state", err)
+			return err
+		}
+	}
+
+	shedApps := map[string][]models.ShedApp{}
+	if analyzer.conf.ListenerLoadSheddingThreshold > 0 {
+		shedApps, err = analyzer.store.GetShedApps()
+		if err != nil {
+			analyzer.logger.Error("Failed to fetch the apps whose heartbeats the listener shed", err)
+			return err
+		}
+	}
+
+	deaSummaries := map[string]models.DeaSummary{}
+	sampledInstances := map[string]map[string]int{}
+	if analyzer.conf.ListenerHeartbeatSamplingCohorts > 0 {
+		deaSummaries, err = analyzer.store.GetDeaSummaries()
+		if err != nil {
+			analyzer.logger.Error("Failed to fetch the summaries of the DEAs' sampled heartbeats", err)
+			return err
+		}
+		sampledInstances = sampledInstancesByApp(deaSummaries)
+	}
+
+	appFreshness := map[string]models.AppFreshness{}
+	presentDeas := map[string]bool{}
+	if analyzer.conf.PerAppFreshness {
+		appFreshness, err = analyzer.store.GetAppFreshness()
+		if err != nil {
+			analyzer.logger.Error("Failed to fetch the freshness of the apps", err)
+			return err
+		}
+
+		presentDeas, err = analyzer.store.GetPresentDeas()
+		if err != nil {
+			analyzer.logger.Error("Failed to fetch the DEAs that are present", err)
+			return err
+		}
+	}
+
+	maintenanceWindows := openMaintenanceWindows(analyzer.conf, analyzer.timeProvider.Time())
+	suppressedStarts := map[string]models.SuppressedStart{}
+	if len(maintenanceWindows) > 0 {
+		suppressedStarts, err = analyzer.store.GetSuppressedStarts()
+		if err != nil {
+			analyzer.logger.Error("Failed to fetch the starts held back during maintenance windows", err)
+			return err
+		}
+	}
+
+	deaZones := analyzer.deaZones()
+	staleZoneIndices := analyzer.staleZoneIndices(deaZones)
+	freshZones := analyzer.freshZones(deaZones)
+	deasShuttingDown := analyzer.deasShuttingDown()
+
 	allStartMessages := []models.PendingStartMessage{}
 	allStopMessages := []models.PendingStopMessage{}
 	allCrashCounts := []models.CrashCount{}
+	appEvents := []models.AppEvent{}
+	allSuppressedStarts := []models.SuppressedStart{}
+	analyzer.appsScanned = len(apps)
 
 	for _, app := range apps {
-		startMessages, stopMessages, crashCounts := newAppAnalyzer(app, analyzer.timeProvider.Time(), existingPendingStartMessages, existingPendingStopMessages, analyzer.logger, analyzer.conf).analyzeApp()
+		if shed, ok := shedApps[analyzer.store.AppKey(app.AppGuid, app.AppVersion)]; ok {
+			analyzer.skipShedApp(app, shed)
+			continue
+		}
+		if deaGuid, behind := storeIsBehindSampledInstances(app, sampledInstances[analyzer.store.AppKey(app.AppGuid, app.AppVersion)], deaSummaries); behind {
+			analyzer.logger.Info("Not analyzing app: its stored instances are behind a DEA's sampled heartbeats", app.LogDescription(), map[string]string{
+				"DEA": deaGuid,
+			})
+			continue
+		}
+
+		appAnalyzer := newAppAnalyzer(app, analyzer.timeProvider.Time(), existingPendingStartMessages, existingPendingStopMessages, analyzer.logger, analyzer.conf)
+		appAnalyzer.staleZoneIndices = staleZoneIndices[analyzer.store.AppKey(app.AppGuid, app.AppVersion)]
+		appAnalyzer.deaZones = deaZones
+		appAnalyzer.freshZones = freshZones
+		appAnalyzer.deasShuttingDown = deasShuttingDown
+		appAnalyzer.undesiredSyncs = undesiredApps[analyzer.store.AppKey(app.AppGuid, app.AppVersion)]
+		appAnalyzer.freshness = appFreshness[analyzer.store.AppKey(app.AppGuid, app.AppVersion)]
+		appAnalyzer.presentDeas = presentDeas
+		appAnalyzer.desiredStateSyncing = desiredStateSyncing
+		appAnalyzer.maintenanceWindow = maintenanceWindowFor(maintenanceWindows, app)
+		appAnalyzer.existingSuppressedStarts = suppressedStarts
+		startMessages, stopMessages, crashCounts := appAnalyzer.analyzeApp()
 		for _, startMessage := range startMessages {
 			allStartMessages = append(allStartMessages, startMessage)
 		}
@@ -63,27 +201,282 @@ func (analyzer *Analyzer) Analyze() error {
 			allStopMessages = append(allStopMessages, stopMessage)
 		}
 		allCrashCounts = append(allCrashCounts, crashCounts...)
+		appEvents = append(appEvents, appAnalyzer.decisions...)
+		allSuppressedStarts = append(allSuppressedStarts, appAnalyzer.suppressedStarts...)
 	}
 
-	err = analyzer.store.SaveCrashCounts(allCrashCounts...)
+	analyzer.activity = newActivity(allStartMessages, allStopMessages)
 
+	enqueueResult, enqueueErr := analyzer.store.EnqueuePendingMessages(allStartMessages, allStopMessages)
+	if enqueueErr != nil {
+		analyzer.logger.Error("Analyzer failed to enqueue messages for some apps", enqueueErr)
+	}
+
+	// Crash counts only count for apps whose messages were enqueued: an app
+	// whose writes were rolled back is analyzed afresh next time.
+	enqueuedCrashCounts := []models.CrashCount{}
+	for _, crashCount := range allCrashCounts {
+		if !enqueueResult.FailedApps[analyzer.store.AppKey(crashCount.AppGuid, crashCount.AppVersion)] {
+			enqueuedCrashCounts = append(enqueuedCrashCounts, crashCount)
+		}
+	}
+
+	err = analyzer.store.SaveCrashCounts(enqueuedCrashCounts...)
 	if err != nil {
 		analyzer.logger.Error("Analyzer failed to save crash counts", err)
 		return err
 	}
 
-	err = analyzer.store.SavePendingStartMessages(allStartMessages...)
+	analyzer.notifyFlapping(enqueuedCrashCounts)
+	analyzer.recordAppEvents(enqueuedCrashCounts, appEvents)
+	analyzer.recordSuppressedStarts(allSuppressedStarts)
 
+	for _, message := range enqueueResult.DeduplicatedStarts {
+		analyzer.logger.Info("Dropping start message equivalent to one already enqueued", message.LogDescription())
+	}
+	for _, message := range enqueueResult.DeduplicatedStops {
+		analyzer.logger.Info("Dropping stop message equivalent to one already enqueued", message.LogDescription())
+	}
+
+	err = analyzer.metricsAccountant.IncrementDeduplicatedMessageMetrics(enqueueResult.DeduplicatedStarts, enqueueResult.DeduplicatedStops)
 	if err != nil {
-		analyzer.logger.Error("Analyzer failed to enqueue start messages", err)
-		return err
+		analyzer.logger.Error("Analyzer failed to track deduplicated messages", err)
 	}
 
-	err = analyzer.store.SavePendingStopMessages(allStopMessages...)
+	err = analyzer.metricsAccountant.TrackPendingMessageEnqueue(enqueueResult)
 	if err != nil {
-		analyzer.logger.Error("Analyzer failed to enqueue stop messages", err)
-		return err
+		analyzer.logger.Error("Analyzer failed to track the enqueue of its messages", err)
 	}
 
-	return nil
+	return enqueueErr
+}
+
+// reportCost saves and tracks the analysis report of a run that took
+// duration and started with the allocations in before.  Failing to is
+// logged and does not fail the run.
+func (analyzer *Analyzer) reportCost(duration time.Duration, before runtime.MemStats) {
+	after := runtime.MemStats{}
+	runtime.ReadMemStats(&after)
+
+	report := models.AnalysisReport{
+		GeneratedAt:            analyzer.timeProvider.Time().Unix(),
+		AppsScanned:            analyzer.appsScanned,
+		DurationInMilliseconds: int64(duration / time.Millisecond),
+		Allocations:            int64(after.Mallocs - before.Mallocs),
+		AllocatedBytes:         int64(after.TotalAlloc - before.TotalAlloc),
+		StartMessages:          analyzer.activity.StartMessages,
+		StopMessages:           analyzer.activity.StopMessages,
+	}
+	if analyzer.storeRequests != nil {
+		counts := analyzer.storeRequests.Collect()
+		report.StoreReads = counts.Reads
+		report.StoreWrites = counts.Writes
+	}
+
+	err := analyzer.store.SaveAnalysisReport(report)
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to save the analysis report", err)
+	}
+
+	err = analyzer.metricsAccountant.TrackAnalysisReport(report)
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to track the analysis report", err)
+	}
+}
+
+// Activity is what the last Analyze found to do, before messages equivalent
+// to ones already enqueued were dropped.
+func (analyzer *Analyzer) Activity() Activity {
+	return analyzer.activity
+}
+
+// deaZones are the zones of the DEAs that report them, or none if they
+// cannot be fetched.
+func (analyzer *Analyzer) deaZones() models.DeaZones {
+	deaZones, err := analyzer.store.GetDeaZones()
+	if err != nil {
+		analyzer.logger.Error("Failed to fetch the zones of DEAs", err)
+		return models.DeaZones{}
+	}
+	return deaZones
+}
+
+// deasShuttingDown are the DEAs deployment tooling is about to shut down, or
+// none if they cannot be fetched.
+func (analyzer *Analyzer) deasShuttingDown() map[string]models.ScheduledDeaShutdown {
+	shutdowns, err := analyzer.store.GetScheduledDeaShutdowns()
+	if err != nil {
+		analyzer.logger.Error("Failed to fetch the DEAs about to shut down", err)
+		return map[string]models.ScheduledDeaShutdown{}
+	}
+	return shutdowns
+}
+
+// staleZoneIndices are the indices, by app key, last seen on DEAs in zones
+// that have stopped heartbeating.  When one zone goes dark the rest keep the
+// actual state fresh, but its instances may well still be running, so they
+// are not started elsewhere until stale_zone_timeout_in_seconds has passed.
+func (analyzer *Analyzer) staleZoneIndices(deaZones models.DeaZones) map[string]map[int]string {
+	ttl := time.Duration(analyzer.conf.HeartbeatTTL()) * time.Second
+	staleIndices := deaZones.StaleIndices(analyzer.timeProvider.Time(), ttl)
+	for zone, freshness := range deaZones.Freshness(analyzer.timeProvider.Time(), ttl) {
+		if !freshness.Fresh {
+			analyzer.logger.Info("Zone is not fresh", map[string]string{
+				"Zone":      zone,
+				"DEAs":      strconv.Itoa(freshness.Deas),
+				"Last Seen": strconv.FormatInt(freshness.LastSeen, 10),
+			})
+		}
+	}
+	return staleIndices
+}
+
+// freshZones are the names of the zones that are fresh, sorted.
+func (analyzer *Analyzer) freshZones(deaZones models.DeaZones) []string {
+	ttl := time.Duration(analyzer.conf.HeartbeatTTL()) * time.Second
+	zones := []string{}
+	for zone, freshness := range deaZones.Freshness(analyzer.timeProvider.Time(), ttl) {
+		if freshness.Fresh {
+			zones = append(zones, zone)
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// isDesiredStateSyncInProgress is asked both before and after the apps are
+// read, so that a sync that starts while they are being read is noticed.
+// isDesiredStateSyncInProgress treats a failure to check as a sync in
+// progress, so that the run defers its stops but still sends its starts.
+func (analyzer *Analyzer) isDesiredStateSyncInProgress() bool {
+	syncing, err := analyzer.store.IsDesiredStateSyncInProgress()
+	if err != nil {
+		analyzer.logger.Error("Failed to check whether the desired state is being synced", err)
+		return true
+	}
+	return syncing
+}
+
+// skipShedApp logs that an app is not analyzed because the listener, under
+// load, only counted its instances: the instances in the store may be out of
+// date, and acting on them could start or stop the wrong ones.
+func (analyzer *Analyzer) skipShedApp(app *models.App, shed []models.ShedApp) {
+	instances := 0
+	for _, shedApp := range shed {
+		instances += shedApp.Instances
+	}
+	analyzer.logger.Info("Not analyzing app: the listener is shedding its heartbeats", app.LogDescription(), map[string]string{
+		"Shed Instances": strconv.Itoa(instances),
+		"Shed DEAs":      strconv.Itoa(len(shed)),
+	})
+}
+
+// sampledInstancesByApp turns the summaries of the DEAs' heartbeats into the
+// number of instances of each app on each DEA, by app key and DEA guid.
+func sampledInstancesByApp(deaSummaries map[string]models.DeaSummary) map[string]map[string]int {
+	byApp := map[string]map[string]int{}
+	for _, summary := range deaSummaries {
+		for appKey, instances := range summary.Apps {
+			if byApp[appKey] == nil {
+				byApp[appKey] = map[string]int{}
+			}
+			byApp[appKey][summary.DeaGuid] = instances
+		}
+	}
+	return byApp
+}
+
+// storeIsBehindSampledInstances is true, with the DEA, when the app's stored
+// instances on a DEA whose heartbeat was summarized are not as many as the
+// DEA last reported, sampled by DEA guid: the DEA's cohort has not been
+// sampled since the app changed there, and acting on the stored instances
+// could start or stop the wrong ones.  DEAs without a summary are not
+// compared.
+func storeIsBehindSampledInstances(app *models.App, sampled map[string]int, deaSummaries map[string]models.DeaSummary) (string, bool) {
+	stored := map[string]int{}
+	for _, heartbeat := range app.InstanceHeartbeats {
+		stored[heartbeat.DeaGuid]++
+	}
+	for deaGuid, instances := range stored {
+		if _, summarized := deaSummaries[deaGuid]; summarized && sampled[deaGuid] != instances {
+			return deaGuid, true
+		}
+	}
+	for deaGuid, instances := range sampled {
+		if stored[deaGuid] != instances {
+			return deaGuid, true
+		}
+	}
+	return "", false
+}
+
+// openMaintenanceWindows are the maintenance windows open at now.
+func openMaintenanceWindows(conf *config.Config, now time.Time) []config.MaintenanceWindow {
+	open := []config.MaintenanceWindow{}
+	for _, window := range conf.MaintenanceWindows {
+		if window.IsOpen(now) {
+			open = append(open, window)
+		}
+	}
+	return open
+}
+
+// maintenanceWindowFor is the first of windows that matches the app, or the
+// zero window if none does.
+func maintenanceWindowFor(windows []config.MaintenanceWindow, app *models.App) config.MaintenanceWindow {
+	for _, window := range windows {
+		if window.Matches(app.Desired.OrganizationGuid, app.AppGuid) {
+			return window
+		}
+	}
+	return config.MaintenanceWindow{}
+}
+
+// recordSuppressedStarts saves the starts held back during maintenance
+// windows for review.  Like history, they are for people, so failing to
+// save them is logged but does not fail the run.
+func (analyzer *Analyzer) recordSuppressedStarts(suppressedStarts []models.SuppressedStart) {
+	err := analyzer.store.SaveSuppressedStarts(suppressedStarts...)
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to record the starts held back during maintenance windows", err)
+	}
+}
+
+// recordAppEvents adds the crashes counted and the decisions made to the
+// apps' histories.  History is for people, so failing to record it is
+// logged but does not fail the run.
+func (analyzer *Analyzer) recordAppEvents(crashCounts []models.CrashCount, decisions []models.AppEvent) {
+	now := analyzer.timeProvider.Time()
+	events := []models.AppEvent{}
+	for _, crashCount := range crashCounts {
+		events = append(events, models.NewCrashObservedEvent(crashCount, now))
+	}
+	events = append(events, decisions...)
+
+	err := analyzer.store.RecordAppEvents(now, events...)
+	if err != nil {
+		analyzer.logger.Error("Analyzer failed to record app history", err)
+	}
+}
+
+// notifyFlapping sends app_flapping for each index whose crash count has
+// just reached number_of_crashes_before_backoff_begins: from its next
+// crash on, restarts are delayed.
+func (analyzer *Analyzer) notifyFlapping(crashCounts []models.CrashCount) {
+	events := []webhooks.Event{}
+	for _, crashCount := range crashCounts {
+		if crashCount.CrashCount != analyzer.conf.NumberOfCrashesBeforeBackoffBegins {
+			continue
+		}
+		events = append(events, webhooks.Event{
+			Type:       webhooks.EventAppFlapping,
+			AppGuid:    crashCount.AppGuid,
+			AppVersion: crashCount.AppVersion,
+			Details: map[string]string{
+				"index":       strconv.Itoa(crashCount.InstanceIndex),
+				"crash_count": strconv.Itoa(crashCount.CrashCount),
+			},
+		})
+	}
+	analyzer.notifier.Notify(events...)
 }
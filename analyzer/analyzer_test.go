@@ -9,11 +9,17 @@ import (
 	"errors"
 	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/countingstoreadapter"
+	"github.com/cloudfoundry/hm9000/helpers/webhooks"
 	"github.com/cloudfoundry/hm9000/models"
 	storepackage "github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakemetricsaccountant"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakenotifier"
+	"github.com/cloudfoundry/storeadapter"
 	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	"strconv"
 	"time"
 )
 
@@ -25,6 +31,7 @@ var _ = Describe("Analyzer", func() {
 		timeProvider *faketimeprovider.FakeTimeProvider
 		dea          appfixture.DeaFixture
 		app          appfixture.AppFixture
+		notifier     *fakenotifier.FakeNotifier
 	)
 
 	conf, _ := config.DefaultConfig()
@@ -42,7 +49,8 @@ var _ = Describe("Analyzer", func() {
 		store.BumpActualFreshness(time.Unix(100, 0))
 		store.BumpDesiredFreshness(time.Unix(100, 0))
 
-		analyzer = New(store, timeProvider, fakelogger.NewFakeLogger(), conf)
+		notifier = fakenotifier.New()
+		analyzer = New(store, fakemetricsaccountant.New(), notifier, timeProvider, fakelogger.NewFakeLogger(), conf)
 	})
 
 	startMessages := func() []models.PendingStartMessage {
@@ -120,6 +128,18 @@ var _ = Describe("Analyzer", func() {
 						Ω(message.Priority).Should(Equal(1.0))
 					}
 				})
+
+				It("should record that the analyzer decided to start them", func() {
+					analyzer.Analyze()
+					for _, message := range startMessages() {
+						Ω(message.Origin).Should(Equal(models.OriginAnalyzer))
+					}
+				})
+
+				It("should report what it found to do", func() {
+					analyzer.Analyze()
+					Ω(analyzer.Activity()).Should(Equal(Activity{StartMessages: 2}))
+				})
 			})
 
 			Context("when there is an existing start message", func() {
@@ -162,6 +182,36 @@ var _ = Describe("Analyzer", func() {
 				})
 			})
 
+			Context("when the missing instances were last seen in a zone that has stopped heartbeating", func() {
+				BeforeEach(func() {
+					heartbeat := dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat())
+					heartbeat.Zone = "z1"
+					store.SyncDeaZones(time.Unix(900, 0), []models.Heartbeat{heartbeat}, nil)
+				})
+
+				It("should only start the instances that were not in that zone", func() {
+					err := analyzer.Analyze()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					expectedMessage := models.NewPendingStartMessage(timeProvider.Time(), conf.GracePeriod(), 0, app.AppGuid, app.AppVersion, 1, 1, models.PendingStartMessageReasonMissing)
+					Ω(startMessages()).Should(HaveLen(1))
+					Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(expectedMessage)))
+				})
+
+				Context("but another DEA in the zone still is", func() {
+					BeforeEach(func() {
+						heartbeat := appfixture.NewDeaFixture().HeartbeatWith()
+						heartbeat.Zone = "z1"
+						store.SyncDeaZones(timeProvider.Time(), []models.Heartbeat{heartbeat}, nil)
+					})
+
+					It("should start every missing instance", func() {
+						analyzer.Analyze()
+						Ω(startMessages()).Should(HaveLen(2))
+					})
+				})
+			})
+
 			Context("When the app has not finished staging", func() {
 				BeforeEach(func() {
 					desiredState := app.DesiredState(2)
@@ -200,6 +250,13 @@ var _ = Describe("Analyzer", func() {
 				expectedMessage = models.NewPendingStopMessage(timeProvider.Time(), 0, conf.GracePeriod(), app.AppGuid, app.AppVersion, app.InstanceAtIndex(2).InstanceGuid, models.PendingStopMessageReasonExtra)
 				Ω(stopMessages()).Should(ContainElement(EqualPendingStopMessage(expectedMessage)))
 			})
+
+			It("should record that the analyzer decided to stop them", func() {
+				analyzer.Analyze()
+				for _, message := range stopMessages() {
+					Ω(message.Origin).Should(Equal(models.OriginAnalyzer))
+				}
+			})
 		})
 
 		Context("when there is an existing stop message", func() {
@@ -261,6 +318,567 @@ var _ = Describe("Analyzer", func() {
 		})
 	})
 
+	Describe("Index gaps", func() {
+		runningAt := func(indices ...int) {
+			heartbeats := []models.InstanceHeartbeat{}
+			for _, index := range indices {
+				heartbeats = append(heartbeats, app.InstanceAtIndex(index).Heartbeat())
+			}
+			store.SyncHeartbeats(dea.HeartbeatWith(heartbeats...))
+		}
+
+		BeforeEach(func() {
+			store.SyncDesiredState(app.DesiredState(5))
+			runningAt(0, 1, 2, 6, 7)
+		})
+
+		Context("with the strict policy", func() {
+			It("should start the missing indices, and leave the extra instances to be stopped once they run", func() {
+				Ω(analyzer.Analyze()).Should(Succeed())
+
+				Ω(startMessages()).Should(HaveLen(2))
+				Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(models.NewPendingStartMessage(timeProvider.Time(), conf.GracePeriod(), 0, app.AppGuid, app.AppVersion, 3, 0.4, models.PendingStartMessageReasonMissing))))
+				Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(models.NewPendingStartMessage(timeProvider.Time(), conf.GracePeriod(), 0, app.AppGuid, app.AppVersion, 4, 0.4, models.PendingStartMessageReasonMissing))))
+				Ω(stopMessages()).Should(BeEmpty())
+			})
+		})
+
+		Context("with the tolerant policy", func() {
+			BeforeEach(func() {
+				conf.IndexGapPolicy = "tolerant"
+			})
+
+			AfterEach(func() {
+				conf.IndexGapPolicy = "strict"
+			})
+
+			It("should let the extra instances stand in for the missing indices", func() {
+				Ω(analyzer.Analyze()).Should(Succeed())
+
+				Ω(startMessages()).Should(BeEmpty())
+				Ω(stopMessages()).Should(BeEmpty())
+			})
+
+			It("should stop the extra instances left over, highest indices first", func() {
+				store.SyncDesiredState(app.DesiredState(4))
+
+				Ω(analyzer.Analyze()).Should(Succeed())
+
+				Ω(startMessages()).Should(BeEmpty())
+				Ω(stopMessages()).Should(HaveLen(1))
+				Ω(stopMessages()[0].InstanceGuid).Should(Equal(app.InstanceAtIndex(7).InstanceGuid))
+			})
+
+			It("should start the missing indices nothing stands in for", func() {
+				runningAt(0, 1, 2, 6)
+
+				Ω(analyzer.Analyze()).Should(Succeed())
+
+				Ω(startMessages()).Should(HaveLen(1))
+				Ω(startMessages()[0].IndexToStart).Should(Equal(4))
+				Ω(stopMessages()).Should(BeEmpty())
+			})
+
+			It("should still restart crashed indices", func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					app.InstanceAtIndex(0).Heartbeat(),
+					app.InstanceAtIndex(1).Heartbeat(),
+					app.InstanceAtIndex(2).Heartbeat(),
+					app.CrashedInstanceHeartbeatAtIndex(3),
+					app.InstanceAtIndex(4).Heartbeat(),
+					app.InstanceAtIndex(6).Heartbeat(),
+				))
+
+				Ω(analyzer.Analyze()).Should(Succeed())
+
+				Ω(startMessages()).Should(HaveLen(1))
+				Ω(startMessages()[0].IndexToStart).Should(Equal(3))
+				Ω(startMessages()[0].StartReason).Should(Equal(models.PendingStartMessageReasonCrashed))
+			})
+		})
+	})
+
+	Describe("Per-app freshness", func() {
+		BeforeEach(func() {
+			store.SyncDesiredState(app.DesiredState(3))
+
+			freshness := models.NewAppFreshness(app.AppGuid, app.AppVersion)
+			freshness.LastSeen = 995
+			freshness.IndicesSeen = []int64{995, 0, 995}
+			freshness.IndexDeas = []string{"dea-a", "", "dea-b"}
+			storeAdapter.SetMulti([]storeadapter.StoreNode{
+				{Key: "/hm/v1/apps/freshness/" + freshness.StoreKey(), Value: freshness.ToJSON()},
+				{Key: "/hm/v1/dea-presence/dea-a", Value: []byte("dea-a")},
+			})
+		})
+
+		It("should ignore the freshness of the apps when per_app_freshness is not set", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(startMessages()).Should(HaveLen(3))
+		})
+
+		Context("with per_app_freshness set", func() {
+			BeforeEach(func() {
+				conf.PerAppFreshness = true
+			})
+
+			AfterEach(func() {
+				conf.PerAppFreshness = false
+			})
+
+			It("should not start the missing indices that a DEA that is still present reports", func() {
+				Ω(analyzer.Analyze()).Should(Succeed())
+
+				Ω(startMessages()).Should(HaveLen(2))
+				Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(models.NewPendingStartMessage(timeProvider.Time(), conf.GracePeriod(), 0, app.AppGuid, app.AppVersion, 1, 1.0, models.PendingStartMessageReasonMissing))))
+				Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(models.NewPendingStartMessage(timeProvider.Time(), conf.GracePeriod(), 0, app.AppGuid, app.AppVersion, 2, 1.0, models.PendingStartMessageReasonMissing))))
+			})
+
+			It("should start them once the DEA's heartbeats stop carrying them", func() {
+				timeProvider.TimeToProvide = time.Unix(995, 0).Add(2 * conf.HeartbeatPeriod.Duration)
+
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(startMessages()).Should(HaveLen(3))
+			})
+
+			It("should start them once the DEA's presence lapses, however recently it reported them", func() {
+				storeAdapter.Delete("/hm/v1/dea-presence/dea-a")
+
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(startMessages()).Should(HaveLen(3))
+			})
+		})
+	})
+
+	Describe("Stopping the instances of an app that has left the desired state", func() {
+		BeforeEach(func() {
+			store.SyncDesiredState(app.DesiredState(2))
+			store.SyncHeartbeats(app.Heartbeat(2))
+		})
+
+		AfterEach(func() {
+			conf.StoppedAppGracePeriodInSeconds = config.DurationInSeconds{0}
+			conf.StoppedAppRequiresTwoSyncs = false
+		})
+
+		Context("with a grace period", func() {
+			BeforeEach(func() {
+				conf.StoppedAppGracePeriodInSeconds = config.DurationInSeconds{time.Minute}
+				store.SyncDesiredState()
+			})
+
+			It("should delay the stops by the grace period", func() {
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(stopMessages()).Should(HaveLen(2))
+
+				expectedMessage := models.NewPendingStopMessage(timeProvider.Time(), 60, conf.GracePeriod(), app.AppGuid, app.AppVersion, app.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonExtra)
+				Ω(stopMessages()).Should(ContainElement(EqualPendingStopMessage(expectedMessage)))
+			})
+
+			It("should not delay stops for instances beyond the desired number of a desired app", func() {
+				store.SyncDesiredState(app.DesiredState(1))
+				Ω(analyzer.Analyze()).Should(Succeed())
+
+				expectedMessage := models.NewPendingStopMessage(timeProvider.Time(), 0, conf.GracePeriod(), app.AppGuid, app.AppVersion, app.InstanceAtIndex(1).InstanceGuid, models.PendingStopMessageReasonExtra)
+				Ω(stopMessages()).Should(ConsistOf(EqualPendingStopMessage(expectedMessage)))
+			})
+		})
+
+		Context("when the stopped state must persist across two syncs", func() {
+			BeforeEach(func() {
+				conf.StoppedAppRequiresTwoSyncs = true
+				store.SyncDesiredState()
+			})
+
+			It("should not stop the instances after the first sync", func() {
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(stopMessages()).Should(BeEmpty())
+			})
+
+			It("should stop the instances after the second", func() {
+				store.SyncDesiredState()
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(stopMessages()).Should(HaveLen(2))
+			})
+
+			It("should leave the instances alone if the app comes back", func() {
+				store.SyncDesiredState(app.DesiredState(2))
+				store.SyncDesiredState()
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(stopMessages()).Should(BeEmpty())
+			})
+
+			It("should stop the instances of an app it never saw desired straight away", func() {
+				otherApp := dea.GetApp(1)
+				store.SyncHeartbeats(otherApp.Heartbeat(1))
+
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(stopMessages()).Should(HaveLen(1))
+				Ω(stopMessages()[0].AppGuid).Should(Equal(otherApp.AppGuid))
+			})
+
+			Context("when the counts fail to fetch", func() {
+				BeforeEach(func() {
+					storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("undesired", errors.New("oops"))
+				})
+
+				It("should return an error and not send any stops", func() {
+					Ω(analyzer.Analyze()).Should(Equal(errors.New("oops")))
+					storeAdapter.ListErrInjector = nil
+					Ω(stopMessages()).Should(BeEmpty())
+				})
+			})
+		})
+	})
+
+	Describe("Recording app history", func() {
+		BeforeEach(func() {
+			conf.AppHistoryMaxEvents = 10
+			store.SyncDesiredState(app.DesiredState(2))
+			store.SyncHeartbeats(dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0)))
+		})
+
+		AfterEach(func() {
+			conf.AppHistoryMaxEvents = 0
+		})
+
+		eventTypes := func() []models.AppEventType {
+			history, err := store.GetAppHistory(app.AppGuid)
+			Ω(err).ShouldNot(HaveOccurred())
+			types := []models.AppEventType{}
+			for _, event := range history.Events {
+				types = append(types, event.Type)
+			}
+			return types
+		}
+
+		It("should record the crashes counted and the decisions made", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(eventTypes()).Should(ConsistOf(models.AppEventCrashObserved, models.AppEventAnalyzerDecision, models.AppEventAnalyzerDecision))
+
+			history, _ := store.GetAppHistory(app.AppGuid)
+			for _, event := range history.Events {
+				Ω(event.Timestamp).Should(Equal(timeProvider.Time().Unix()))
+				Ω(event.AppVersion).Should(Equal(app.AppVersion))
+				if event.Type == models.AppEventAnalyzerDecision {
+					Ω(event.Description).Should(HavePrefix("Enqueuing Start Message"))
+					Ω(event.Details).ShouldNot(HaveKey("AppGuid"))
+				}
+			}
+		})
+
+		It("should not record the same decision again when the messages are already enqueued", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(eventTypes()).Should(HaveLen(3))
+		})
+
+		It("should still succeed when the history cannot be recorded", func() {
+			storeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("app-history", errors.New("oops"))
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(startMessages()).Should(HaveLen(2))
+		})
+	})
+
+	Describe("The analysis report", func() {
+		var metricsAccountant *fakemetricsaccountant.FakeMetricsAccountant
+
+		BeforeEach(func() {
+			store.SyncDesiredState(app.DesiredState(2))
+			store.SyncHeartbeats(app.Heartbeat(1))
+
+			counter := countingstoreadapter.New(storeAdapter)
+			metricsAccountant = fakemetricsaccountant.New()
+			analyzer = New(storepackage.NewStore(conf, counter, fakelogger.NewFakeLogger()), metricsAccountant, notifier, timeProvider, fakelogger.NewFakeLogger(), conf)
+			analyzer.CountStoreRequests(counter)
+		})
+
+		It("should save and track what the run cost", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+
+			report, err := store.GetAnalysisReport()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.GeneratedAt).Should(Equal(timeProvider.Time().Unix()))
+			Ω(report.AppsScanned).Should(Equal(1))
+			Ω(report.StoreReads).Should(BeNumerically(">", 0))
+			Ω(report.StoreWrites).Should(BeNumerically(">", 0))
+			Ω(report.Allocations).Should(BeNumerically(">", 0))
+			Ω(report.StartMessages).Should(Equal(1))
+			Ω(report.StopMessages).Should(Equal(0))
+
+			Ω(metricsAccountant.TrackedAnalysisReports).Should(Equal([]models.AnalysisReport{report}))
+		})
+
+		It("should track the enqueue of its messages", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+
+			Ω(metricsAccountant.TrackedPendingMessageEnqueues).Should(HaveLen(1))
+			Ω(metricsAccountant.TrackedPendingMessageEnqueues[0].Conflicts).Should(BeZero())
+			Ω(metricsAccountant.TrackedPendingMessageEnqueues[0].DeduplicatedStarts).Should(BeEmpty())
+		})
+
+		It("should not count the requests made between runs", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+			first, _ := store.GetAnalysisReport()
+
+			for i := 0; i < 100; i++ {
+				store.GetApps()
+			}
+			Ω(analyzer.Analyze()).Should(Succeed())
+			second, _ := store.GetAnalysisReport()
+			Ω(second.StoreReads).Should(BeNumerically("<=", first.StoreReads))
+		})
+
+		It("should not report a failed run", func() {
+			storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("apps", errors.New("oops"))
+			Ω(analyzer.Analyze()).ShouldNot(Succeed())
+
+			Ω(metricsAccountant.TrackedAnalysisReports).Should(BeEmpty())
+		})
+	})
+
+	Describe("While the desired state is being synced", func() {
+		var otherApp appfixture.AppFixture
+
+		BeforeEach(func() {
+			otherApp = dea.GetApp(1)
+			store.SyncDesiredState(app.DesiredState(1), otherApp.DesiredState(1))
+			store.SyncHeartbeats(dea.HeartbeatWith(
+				app.InstanceAtIndex(0).Heartbeat(),
+				app.InstanceAtIndex(1).Heartbeat(),
+			))
+			store.BeginDesiredStateSync(timeProvider.Time())
+		})
+
+		It("should defer stops, but not starts", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(stopMessages()).Should(BeEmpty())
+			Ω(startMessages()).Should(HaveLen(1))
+			Ω(startMessages()[0].AppGuid).Should(Equal(otherApp.AppGuid))
+		})
+
+		It("should stop the instances once the sync is over", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+			store.EndDesiredStateSync(timeProvider.Time())
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(stopMessages()).Should(HaveLen(1))
+			Ω(stopMessages()[0].InstanceGuid).Should(Equal(app.InstanceAtIndex(1).InstanceGuid))
+		})
+
+		It("should defer stops, but not starts, when it cannot tell whether a sync is in progress", func() {
+			store.EndDesiredStateSync(timeProvider.Time())
+			storeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("desired-sync", errors.New("oops"))
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(stopMessages()).Should(BeEmpty())
+			Ω(startMessages()).Should(HaveLen(1))
+			Ω(startMessages()[0].AppGuid).Should(Equal(otherApp.AppGuid))
+		})
+	})
+
+	Describe("Apps whose heartbeats the listener shed", func() {
+		var otherApp appfixture.AppFixture
+
+		BeforeEach(func() {
+			conf.ListenerLoadSheddingThreshold = 1
+			otherApp = dea.GetApp(1)
+			store.SyncDesiredState(app.DesiredState(2), otherApp.DesiredState(1))
+			store.SyncHeartbeatsShedding(map[string]bool{otherApp.AppGuid: true}, dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+		})
+
+		AfterEach(func() {
+			conf.ListenerLoadSheddingThreshold = 0
+		})
+
+		It("should not analyze them, but should analyze every other app", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(startMessages()).Should(HaveLen(1))
+			Ω(startMessages()[0].AppGuid).Should(Equal(otherApp.AppGuid))
+		})
+
+		It("should return the error when the shed apps cannot be fetched", func() {
+			storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("apps/shed", errors.New("oops"))
+			Ω(analyzer.Analyze()).Should(MatchError("oops"))
+			Ω(startMessages()).Should(BeEmpty())
+		})
+
+		Context("when load shedding is off", func() {
+			BeforeEach(func() {
+				conf.ListenerLoadSheddingThreshold = 0
+			})
+
+			It("should analyze every app, shed instances and all", func() {
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(startMessages()).Should(HaveLen(3))
+			})
+		})
+	})
+
+	Describe("Apps whose heartbeats the listener samples", func() {
+		var otherApp appfixture.AppFixture
+
+		BeforeEach(func() {
+			conf.ListenerHeartbeatSamplingCohorts = 2
+			otherApp = dea.GetApp(1)
+			store.SyncDesiredState(app.DesiredState(2), otherApp.DesiredState(1))
+			store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+		})
+
+		AfterEach(func() {
+			conf.ListenerHeartbeatSamplingCohorts = 0
+		})
+
+		Context("when a DEA reports instances its stored instances are behind on", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeatsSampling(map[string]bool{}, dea.HeartbeatWith(
+					app.InstanceAtIndex(0).Heartbeat(),
+					app.InstanceAtIndex(1).Heartbeat(),
+				))
+			})
+
+			It("should not analyze the app, but should analyze every other app", func() {
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(startMessages()).Should(HaveLen(1))
+				Ω(startMessages()[0].AppGuid).Should(Equal(otherApp.AppGuid))
+			})
+		})
+
+		Context("when a DEA no longer reports instances that are stored", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeatsSampling(map[string]bool{}, dea.HeartbeatWith())
+			})
+
+			It("should not analyze the app", func() {
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(startMessages()).Should(HaveLen(1))
+				Ω(startMessages()[0].AppGuid).Should(Equal(otherApp.AppGuid))
+			})
+		})
+
+		Context("when the stored instances agree with the DEAs' summaries", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeatsSampling(map[string]bool{}, dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+			})
+
+			It("should analyze the app", func() {
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(startMessages()).Should(HaveLen(2))
+			})
+		})
+
+		It("should return the error when the summaries cannot be fetched", func() {
+			storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("dea-summaries", errors.New("oops"))
+			Ω(analyzer.Analyze()).Should(MatchError("oops"))
+			Ω(startMessages()).Should(BeEmpty())
+		})
+	})
+
+	Describe("Maintenance windows", func() {
+		var otherApp appfixture.AppFixture
+
+		BeforeEach(func() {
+			conf.MaintenanceWindows = []config.MaintenanceWindow{
+				{Name: "patching", Schedule: "* * * * *", DurationInSeconds: config.DurationInSeconds{Duration: time.Minute}, AppGuids: []string{app.AppGuid}},
+			}
+			otherApp = dea.GetApp(1)
+			store.SyncDesiredState(app.DesiredState(2), otherApp.DesiredState(1))
+		})
+
+		AfterEach(func() {
+			conf.MaintenanceWindows = nil
+		})
+
+		It("should hold back the starts of the apps in an open window, and record them", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(startMessages()).Should(HaveLen(1))
+			Ω(startMessages()[0].AppGuid).Should(Equal(otherApp.AppGuid))
+
+			suppressed, err := store.GetSuppressedStarts()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(suppressed).Should(HaveLen(2))
+			Ω(suppressed).Should(HaveKey(app.AppGuid + "," + app.AppVersion + ",0"))
+			Ω(suppressed[app.AppGuid+","+app.AppVersion+",1"]).Should(Equal(models.SuppressedStart{
+				AppGuid:           app.AppGuid,
+				AppVersion:        app.AppVersion,
+				IndexToStart:      1,
+				StartReason:       models.PendingStartMessageReasonMissing,
+				MaintenanceWindow: "patching",
+				FirstSuppressedAt: 1000,
+				LastSuppressedAt:  1000,
+			}))
+		})
+
+		It("should keep when a start was first held back while the window stays open", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+			timeProvider.IncrementBySeconds(30)
+			Ω(analyzer.Analyze()).Should(Succeed())
+
+			suppressed, _ := store.GetSuppressedStarts()
+			Ω(suppressed[app.AppGuid+","+app.AppVersion+",0"].FirstSuppressedAt).Should(BeNumerically("==", 1000))
+			Ω(suppressed[app.AppGuid+","+app.AppVersion+",0"].LastSuppressedAt).Should(BeNumerically("==", 1030))
+		})
+
+		It("should match the apps in the window's organizations", func() {
+			desired := otherApp.DesiredState(1)
+			desired.OrganizationGuid = "maintained-org"
+			store.SyncDesiredState(app.DesiredState(2), desired)
+			conf.MaintenanceWindows[0].OrganizationGuids = []string{"maintained-org"}
+
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(startMessages()).Should(BeEmpty())
+		})
+
+		It("should still start an evacuating instance elsewhere", func() {
+			evacuatingHeartbeat := app.InstanceAtIndex(1).Heartbeat()
+			evacuatingHeartbeat.State = models.InstanceStateEvacuating
+			store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat(), evacuatingHeartbeat))
+
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(startMessages()).Should(HaveLen(2))
+			expected := models.NewPendingStartMessage(timeProvider.Time(), 0, conf.GracePeriod(), app.AppGuid, app.AppVersion, 1, 2.0, models.PendingStartMessageReasonEvacuating)
+			Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(expected)))
+		})
+
+		It("should return the error when the starts held back before cannot be fetched", func() {
+			storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("suppressed-starts", errors.New("oops"))
+			Ω(analyzer.Analyze()).Should(MatchError("oops"))
+			Ω(startMessages()).Should(BeEmpty())
+		})
+
+		Context("when the window is closed", func() {
+			BeforeEach(func() {
+				conf.MaintenanceWindows[0].Schedule = "0 0 30 2 *"
+			})
+
+			It("should start the app's instances as usual", func() {
+				Ω(analyzer.Analyze()).Should(Succeed())
+				Ω(startMessages()).Should(HaveLen(3))
+
+				suppressed, _ := store.GetSuppressedStarts()
+				Ω(suppressed).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Unmanaged apps", func() {
+		BeforeEach(func() {
+			desired := app.DesiredState(2)
+			desired.Unmanaged = true
+			otherApp := dea.GetApp(1)
+			store.SyncDesiredState(desired, otherApp.DesiredState(1))
+			store.SyncHeartbeats(dea.HeartbeatWith(
+				app.InstanceAtIndex(2).Heartbeat(),
+				app.InstanceAtIndex(3).Heartbeat(),
+			))
+		})
+
+		It("should neither start nor stop their instances, but should analyze every other app", func() {
+			Ω(analyzer.Analyze()).Should(Succeed())
+			Ω(startMessages()).Should(HaveLen(1))
+			Ω(startMessages()[0].AppGuid).ShouldNot(Equal(app.AppGuid))
+			Ω(stopMessages()).Should(BeEmpty())
+		})
+	})
+
 	Describe("Stopping duplicate instances (index < numDesired)", func() {
 		var (
 			duplicateInstance1 appfixture.Instance
@@ -583,6 +1201,188 @@ var _ = Describe("Analyzer", func() {
 		})
 	})
 
+	Describe("Placement hints", func() {
+		startMessageAtIndex := func(index int) models.PendingStartMessage {
+			for _, message := range startMessages() {
+				if message.IndexToStart == index {
+					return message
+				}
+			}
+			Fail("no start message at that index")
+			return models.PendingStartMessage{}
+		}
+
+		Context("when there is nothing to advise", func() {
+			BeforeEach(func() {
+				store.SyncDesiredState(app.DesiredState(1))
+			})
+
+			It("should not add any", func() {
+				analyzer.Analyze()
+				Ω(startMessageAtIndex(0).PlacementHints).Should(BeNil())
+			})
+		})
+
+		Context("when the desired state has a memory requirement", func() {
+			BeforeEach(func() {
+				desired := app.DesiredState(1)
+				desired.MemoryInMB = 256
+				store.SyncDesiredState(desired)
+			})
+
+			It("should pass it on", func() {
+				analyzer.Analyze()
+				Ω(startMessageAtIndex(0).PlacementHints).Should(Equal(&models.PlacementHints{AvoidDEAs: []string{}, MemoryInMB: 256}))
+			})
+		})
+
+		Context("when the instance crashed", func() {
+			BeforeEach(func() {
+				otherDea := appfixture.NewDeaFixture()
+				crashedElsewhere := app.CrashedInstanceHeartbeatAtIndex(0)
+				crashedElsewhere.DeaGuid = otherDea.DeaGuid
+
+				store.SyncDesiredState(app.DesiredState(1))
+				store.SyncHeartbeats(
+					dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0)),
+					otherDea.HeartbeatWith(crashedElsewhere),
+				)
+			})
+
+			It("should avoid the DEAs it crashed on", func() {
+				analyzer.Analyze()
+				hints := startMessageAtIndex(0).PlacementHints
+				Ω(hints).ShouldNot(BeNil())
+				Ω(hints.AvoidDEAs).Should(HaveLen(2))
+				Ω(hints.AvoidDEAs).Should(ContainElement(dea.DeaGuid))
+			})
+		})
+
+		Context("when the instance is evacuating", func() {
+			BeforeEach(func() {
+				evacuatingHeartbeat := app.InstanceAtIndex(0).Heartbeat()
+				evacuatingHeartbeat.State = models.InstanceStateEvacuating
+
+				store.SyncDesiredState(app.DesiredState(1))
+				store.SyncHeartbeats(dea.HeartbeatWith(evacuatingHeartbeat))
+			})
+
+			It("should avoid the evacuating DEA", func() {
+				analyzer.Analyze()
+				Ω(startMessageAtIndex(0).PlacementHints).Should(Equal(&models.PlacementHints{AvoidDEAs: []string{dea.DeaGuid}}))
+			})
+		})
+
+		Context("when there are several fresh zones", func() {
+			BeforeEach(func() {
+				store.SyncDesiredState(app.DesiredState(3))
+
+				heartbeat := dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat())
+				heartbeat.Zone = "z1"
+				otherHeartbeat := appfixture.NewDeaFixture().HeartbeatWith()
+				otherHeartbeat.Zone = "z2"
+
+				store.SyncHeartbeats(heartbeat, otherHeartbeat)
+				store.SyncDeaZones(timeProvider.Time(), []models.Heartbeat{heartbeat, otherHeartbeat}, nil)
+			})
+
+			It("should prefer the zone with fewest of the app's instances", func() {
+				analyzer.Analyze()
+				Ω(startMessageAtIndex(1).PlacementHints).Should(Equal(&models.PlacementHints{AvoidDEAs: []string{}, PreferredZone: "z2"}))
+				Ω(startMessageAtIndex(2).PlacementHints).Should(Equal(&models.PlacementHints{AvoidDEAs: []string{}, PreferredZone: "z2"}))
+			})
+		})
+	})
+
+	Describe("Preempting DEA shutdowns", func() {
+		var otherDea appfixture.DeaFixture
+
+		BeforeEach(func() {
+			otherDea = appfixture.NewDeaFixture()
+			store.ScheduleDeaShutdowns(timeProvider.Time(), dea.DeaGuid)
+		})
+
+		Context("when an app's one instance runs on a DEA about to shut down", func() {
+			BeforeEach(func() {
+				store.SyncDesiredState(app.DesiredState(1))
+				store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+			})
+
+			It("should start a replacement away from the DEA", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				expectedMessage := models.NewPendingStartMessage(timeProvider.Time(), 0, conf.GracePeriod(), app.AppGuid, app.AppVersion, 0, 0.5, models.PendingStartMessageReasonPreemptive)
+				expectedMessage.PlacementHints = &models.PlacementHints{AvoidDEAs: []string{dea.DeaGuid}}
+				Ω(startMessages()).Should(HaveLen(1))
+				Ω(startMessages()[0]).Should(EqualPendingStartMessage(expectedMessage))
+				Ω(startMessages()[0].PlacementHints).Should(Equal(expectedMessage.PlacementHints))
+				Ω(stopMessages()).Should(BeEmpty())
+			})
+		})
+
+		Context("when the replacement is running", func() {
+			var replacement appfixture.Instance
+
+			BeforeEach(func() {
+				replacement = app.InstanceAtIndex(0)
+				replacement.InstanceGuid = models.Guid()
+				replacementHeartbeat := replacement.Heartbeat()
+				replacementHeartbeat.DeaGuid = otherDea.DeaGuid
+
+				store.SyncDesiredState(app.DesiredState(1))
+				store.SyncHeartbeats(
+					otherDea.HeartbeatWith(replacementHeartbeat),
+					dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()),
+				)
+			})
+
+			It("should stop the instance on the DEA first", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(BeEmpty())
+
+				sendOns := map[string]int64{}
+				for _, message := range stopMessages() {
+					sendOns[message.InstanceGuid] = message.SendOn
+				}
+				Ω(sendOns).Should(Equal(map[string]int64{
+					app.InstanceAtIndex(0).InstanceGuid: int64(1000 + conf.GracePeriod()*4),
+					replacement.InstanceGuid:            int64(1000 + conf.GracePeriod()*5),
+				}))
+			})
+		})
+
+		Context("when the app has more than one instance", func() {
+			BeforeEach(func() {
+				store.SyncDesiredState(app.DesiredState(2))
+				store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat(), app.InstanceAtIndex(1).Heartbeat()))
+			})
+
+			It("should leave it to the evacuator", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(BeEmpty())
+			})
+		})
+
+		Context("when the app's one instance runs on another DEA", func() {
+			BeforeEach(func() {
+				heartbeat := app.InstanceAtIndex(0).Heartbeat()
+				heartbeat.DeaGuid = otherDea.DeaGuid
+
+				store.SyncDesiredState(app.DesiredState(1))
+				store.SyncHeartbeats(otherDea.HeartbeatWith(heartbeat))
+			})
+
+			It("should do nothing", func() {
+				err := analyzer.Analyze()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(startMessages()).Should(BeEmpty())
+			})
+		})
+	})
+
 	Describe("Handling crashed instances", func() {
 		var heartbeat models.Heartbeat
 		Context("When there are multiple crashed instances on the same index", func() {
@@ -613,6 +1413,10 @@ var _ = Describe("Analyzer", func() {
 					Ω(startMessages()).Should(ContainElement(EqualPendingStartMessage(expectMessage)))
 				})
 
+				It("should report the crash", func() {
+					Ω(analyzer.Activity()).Should(Equal(Activity{StartMessages: 1, Crashes: 1}))
+				})
+
 				Context("when there is a running instance on the same index", func() {
 					BeforeEach(func() {
 						heartbeat.InstanceHeartbeats = append(heartbeat.InstanceHeartbeats, app.InstanceAtIndex(0).Heartbeat())
@@ -675,6 +1479,25 @@ var _ = Describe("Analyzer", func() {
 					store.DeletePendingStartMessages(startMessages()...)
 				}
 			})
+
+			It("should notify once, when the backoff begins, that the app is flapping", func() {
+				for i := 0; i < 6; i++ {
+					analyzer.Analyze()
+					store.DeletePendingStartMessages(startMessages()...)
+					if i < conf.NumberOfCrashesBeforeBackoffBegins-1 {
+						Ω(notifier.EventsOfType(webhooks.EventAppFlapping)).Should(BeEmpty())
+					}
+				}
+
+				events := notifier.EventsOfType(webhooks.EventAppFlapping)
+				Ω(events).Should(HaveLen(1))
+				Ω(events[0].AppGuid).Should(Equal(app.AppGuid))
+				Ω(events[0].AppVersion).Should(Equal(app.AppVersion))
+				Ω(events[0].Details).Should(Equal(map[string]string{
+					"index":       "0",
+					"crash_count": strconv.Itoa(conf.NumberOfCrashesBeforeBackoffBegins),
+				}))
+			})
 		})
 
 		Context("When all instances are crashed", func() {
@@ -809,6 +1632,56 @@ var _ = Describe("Analyzer", func() {
 				Ω(startMessages()).Should(BeEmpty())
 				Ω(stopMessages()).Should(BeEmpty())
 			})
+
+			It("should report the freshness to the notifier", func() {
+				analyzer.Analyze()
+				Ω(notifier.ReportedFreshness).Should(Equal([]error{storepackage.ActualIsNotFreshError}))
+			})
+		})
+
+		Context("when enqueueing an app's messages fails part way", func() {
+			var otherApp appfixture.AppFixture
+
+			BeforeEach(func() {
+				store.BumpActualFreshness(time.Unix(10, 0))
+				store.BumpDesiredFreshness(time.Unix(10, 0))
+				otherApp = dea.GetApp(1)
+				store.SyncDesiredState(app.DesiredState(2), otherApp.DesiredState(1))
+				storeAdapter.CreateErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector(app.AppGuid+"-"+app.AppVersion+"-1", errors.New("oops!"))
+			})
+
+			It("should return the store's error, enqueue none of that app's messages, and still enqueue the other apps' messages", func() {
+				err := analyzer.Analyze()
+				Ω(err).Should(Equal(errors.New("oops!")))
+				Ω(startMessages()).Should(HaveLen(1))
+				Ω(startMessages()[0].AppGuid).Should(Equal(otherApp.AppGuid))
+			})
+		})
+
+		Context("when a crashed app's messages fail to enqueue", func() {
+			var otherApp appfixture.AppFixture
+
+			BeforeEach(func() {
+				store.BumpActualFreshness(time.Unix(10, 0))
+				store.BumpDesiredFreshness(time.Unix(10, 0))
+				otherApp = dea.GetApp(1)
+				store.SyncDesiredState(app.DesiredState(1), otherApp.DesiredState(1))
+				store.SyncHeartbeats(dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0), otherApp.CrashedInstanceHeartbeatAtIndex(0)))
+				storeAdapter.CreateErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector(app.AppGuid+"-"+app.AppVersion+"-0", errors.New("oops!"))
+			})
+
+			It("should not count the crash of that app, and still count the other apps' crashes", func() {
+				err := analyzer.Analyze()
+				Ω(err).Should(Equal(errors.New("oops!")))
+
+				storedApp, err := store.GetApp(app.AppGuid, app.AppVersion)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(storedApp.CrashCounts).Should(BeEmpty())
+
+				storedOtherApp, err := store.GetApp(otherApp.AppGuid, otherApp.AppVersion)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(storedOtherApp.CrashCounts[0].CrashCount).Should(Equal(1))
+			})
 		})
 
 		Context("when the apps fail to fetch", func() {
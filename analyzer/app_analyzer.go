@@ -5,7 +5,9 @@ import (
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
 	"github.com/cloudfoundry/hm9000/models"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,9 +19,55 @@ type appAnalyzer struct {
 	currentTime                  time.Time
 	logger                       logger.Logger
 
+	// staleZoneIndices are the indices last seen in a zone that is not
+	// fresh, with the zone of each.
+	staleZoneIndices map[int]string
+
+	// deaZones and freshZones, the zones that are fresh, inform the
+	// placement hints of start messages.
+	deaZones   models.DeaZones
+	freshZones []string
+
+	// deasShuttingDown are the DEAs deployment tooling is about to shut down.
+	deasShuttingDown map[string]models.ScheduledDeaShutdown
+
+	// freshness is, with per_app_freshness set, when and by which DEA an
+	// instance was last reported at each of the app's indices.
+	freshness models.AppFreshness
+
+	// presentDeas are, with per_app_freshness set, the DEAs whose presence
+	// has not lapsed.
+	presentDeas map[string]bool
+
+	// undesiredSyncs is how many desired state syncs in a row the app has
+	// been missing from, if it has recently left the desired state.
+	undesiredSyncs int
+
+	// desiredStateSyncing is set while the fetcher is writing the desired
+	// state: the app may only look undesired, so no stops are enqueued.
+	desiredStateSyncing bool
+
+	// maintenanceWindow is the open maintenance window the app is in, if
+	// any: its starts are held back and recorded in suppressedStarts.
+	// existingSuppressedStarts were held back before.
+	maintenanceWindow        config.MaintenanceWindow
+	existingSuppressedStarts map[string]models.SuppressedStart
+	suppressedStarts         []models.SuppressedStart
+
+	// standIns are, with index_gap_policy tolerant, the instances beyond
+	// the desired indices standing in for missing ones, by missing index.
+	standIns map[int]models.InstanceHeartbeat
+
 	startMessages map[string]models.PendingStartMessage
 	stopMessages  map[string]models.PendingStopMessage
 	crashCounts   []models.CrashCount
+
+	// decisions go into the app's history.
+	decisions []models.AppEvent
+
+	// explaining records each decision in steps instead of logging it.
+	explaining bool
+	steps      []string
 }
 
 func newAppAnalyzer(app *models.App, currentTime time.Time, existingPendingStartMessages map[string]models.PendingStartMessage, existingPendingStopMessages map[string]models.PendingStopMessage, logger logger.Logger, conf *config.Config) *appAnalyzer {
@@ -33,18 +81,30 @@ func newAppAnalyzer(app *models.App, currentTime time.Time, existingPendingStart
 		startMessages:                make(map[string]models.PendingStartMessage, 0),
 		stopMessages:                 make(map[string]models.PendingStopMessage, 0),
 		crashCounts:                  make([]models.CrashCount, 0),
+		decisions:                    []models.AppEvent{},
+		suppressedStarts:             []models.SuppressedStart{},
+		steps:                        []string{},
 	}
 }
 
 func (a *appAnalyzer) analyzeApp() (map[string]models.PendingStartMessage, map[string]models.PendingStopMessage, []models.CrashCount) {
+	if a.app.IsUnmanaged() {
+		a.note("Nothing to do: the app is excluded by fetcher_exclusions, and supervised by something else")
+		return a.startMessages, a.stopMessages, a.crashCounts
+	}
+
+	a.standIns = a.indexGapStandIns()
 	priority := a.computePendingStartMessagePriority()
 	a.generatePendingStartsForMissingInstances(priority)
 	a.generatePendingStartsForCrashedInstances(priority)
 	a.generatePendingStartsAndStopsForEvacuatingInstances()
+	a.generatePreemptiveStartsForDeasShuttingDown()
 
 	if len(a.startMessages) == 0 {
 		a.generatePendingStopsForExtraInstances()
 		a.generatePendingStopsForDuplicateInstances()
+	} else {
+		a.note("Not looking for extra or duplicate instances to stop until the instances being started are running")
 	}
 
 	return a.startMessages, a.stopMessages, a.crashCounts
@@ -52,12 +112,48 @@ func (a *appAnalyzer) analyzeApp() (map[string]models.PendingStartMessage, map[s
 
 func (a *appAnalyzer) generatePendingStartsForMissingInstances(priority float64) {
 	if !a.app.IsStaged() {
+		a.note("Not starting missing or crashed instances: the app is not desired or not staged")
 		return
 	}
 
 	for index := 0; a.app.IsIndexDesired(index); index++ {
 		if !a.app.HasStartingOrRunningInstanceAtIndex(index) && !a.app.HasCrashedInstanceAtIndex(index) {
+			if zone, ok := a.staleZoneIndices[index]; ok {
+				a.decide("Not starting missing instance: its zone is not fresh", map[string]string{
+					"AppGuid":    a.app.AppGuid,
+					"AppVersion": a.app.AppVersion,
+					"Index":      strconv.Itoa(index),
+					"Zone":       zone,
+				}, map[string]string{})
+				continue
+			}
+
+			// The freshness is rewritten at most once a heartbeat period, so an
+			// index its DEA still reports is no more than two periods old.
+			if a.freshness.IsIndexReported(index, a.presentDeas, a.currentTime, 2*a.conf.HeartbeatPeriod.Duration) {
+				a.decideAgain("Not starting missing instance: a DEA still reports an instance at its index", map[string]string{
+					"AppGuid":    a.app.AppGuid,
+					"AppVersion": a.app.AppVersion,
+					"Index":      strconv.Itoa(index),
+					"DEA":        a.freshness.IndexDea(index),
+					"LastSeen":   strconv.FormatInt(a.freshness.IndexSeenAt(index).Unix(), 10),
+				}, map[string]string{})
+				continue
+			}
+
+			if standIn, ok := a.standIns[index]; ok {
+				a.decideAgain("Not starting missing instance: an instance beyond the desired indices stands in for it", map[string]string{
+					"AppGuid":             a.app.AppGuid,
+					"AppVersion":          a.app.AppVersion,
+					"Index":               strconv.Itoa(index),
+					"StandInIndex":        strconv.Itoa(standIn.InstanceIndex),
+					"StandInInstanceGuid": standIn.InstanceGuid,
+				}, map[string]string{})
+				continue
+			}
+
 			message := models.NewPendingStartMessage(a.currentTime, a.conf.GracePeriod(), 0, a.app.AppGuid, a.app.AppVersion, index, priority, models.PendingStartMessageReasonMissing)
+			message.PlacementHints = a.placementHints(index)
 
 			a.appendStartMessageIfNotDuplicate(message, "Identified missing instance", map[string]string{
 				"Desired # of Instances": strconv.Itoa(a.app.NumberOfDesiredInstances()),
@@ -76,12 +172,14 @@ func (a *appAnalyzer) generatePendingStartsForCrashedInstances(priority float64)
 	for index := 0; a.app.IsIndexDesired(index); index++ {
 		if !a.app.HasStartingOrRunningInstanceAtIndex(index) && a.app.HasCrashedInstanceAtIndex(index) {
 			if index != 0 && !a.app.HasStartingOrRunningInstances() {
+				a.note(fmt.Sprintf("Not restarting crashed index %d until an instance of the app is running", index))
 				continue
 			}
 
 			crashCount := a.app.CrashCountAtIndex(index, a.currentTime)
 			delay := a.computeDelayForCrashCount(crashCount)
 			message := models.NewPendingStartMessage(a.currentTime, delay, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, index, priority, models.PendingStartMessageReasonCrashed)
+			message.PlacementHints = a.placementHints(index)
 
 			didAppend := a.appendStartMessageIfNotDuplicate(message, "Identified crashed instance", map[string]string{
 				"Desired # of Instances": strconv.Itoa(a.app.NumberOfDesiredInstances()),
@@ -99,8 +197,25 @@ func (a *appAnalyzer) generatePendingStartsForCrashedInstances(priority float64)
 }
 
 func (a *appAnalyzer) generatePendingStopsForExtraInstances() {
+	delay := 0
+	if !a.app.IsDesired() && a.app.HasStartingOrRunningInstances() {
+		if a.conf.StoppedAppRequiresTwoSyncs && a.undesiredSyncs == 1 {
+			a.decide("Not stopping instances: the app has left the desired state in only one sync", map[string]string{
+				"AppGuid":    a.app.AppGuid,
+				"AppVersion": a.app.AppVersion,
+			}, map[string]string{})
+			return
+		}
+		delay = int(a.conf.StoppedAppGracePeriod().Seconds())
+	}
+
 	for _, extraInstance := range a.app.ExtraStartingOrRunningInstances() {
-		message := models.NewPendingStopMessage(a.currentTime, 0, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, extraInstance.InstanceGuid, models.PendingStopMessageReasonExtra)
+		if a.isStandIn(extraInstance) {
+			a.note(fmt.Sprintf("Not stopping instance %s at index %d: it stands in for a missing index", extraInstance.InstanceGuid, extraInstance.InstanceIndex))
+			continue
+		}
+
+		message := models.NewPendingStopMessage(a.currentTime, delay, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, extraInstance.InstanceGuid, models.PendingStopMessageReasonExtra)
 
 		a.appendStopMessageIfNotDuplicate(message, "Identified extra running instance", map[string]string{
 			"InstanceIndex":          strconv.Itoa(extraInstance.InstanceIndex),
@@ -111,13 +226,58 @@ func (a *appAnalyzer) generatePendingStopsForExtraInstances() {
 	return
 }
 
+// indexGapStandIns pairs, with index_gap_policy tolerant, the missing
+// desired indices, lowest first, with the instances beyond the desired
+// indices, lowest index first.  Rolling DEA upgrades often leave an app
+// running the right number of instances at the wrong indices for a while;
+// pairing them up keeps the analyzer from starting and then stopping an
+// instance for each.  Indices with a crashed instance are not missing.
+func (a *appAnalyzer) indexGapStandIns() map[int]models.InstanceHeartbeat {
+	standIns := map[int]models.InstanceHeartbeat{}
+	if !a.conf.ToleratesIndexGaps() {
+		return standIns
+	}
+
+	extras := a.app.ExtraStartingOrRunningInstances()
+	sort.Sort(instancesByIndex(extras))
+
+	for index := 0; a.app.IsIndexDesired(index) && len(extras) > 0; index++ {
+		if a.app.HasStartingOrRunningInstanceAtIndex(index) || a.app.HasCrashedInstanceAtIndex(index) {
+			continue
+		}
+		standIns[index] = extras[0]
+		extras = extras[1:]
+	}
+	return standIns
+}
+
+func (a *appAnalyzer) isStandIn(instance models.InstanceHeartbeat) bool {
+	for _, standIn := range a.standIns {
+		if standIn.InstanceGuid == instance.InstanceGuid {
+			return true
+		}
+	}
+	return false
+}
+
+type instancesByIndex []models.InstanceHeartbeat
+
+func (s instancesByIndex) Len() int      { return len(s) }
+func (s instancesByIndex) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s instancesByIndex) Less(i, j int) bool {
+	if s[i].InstanceIndex != s[j].InstanceIndex {
+		return s[i].InstanceIndex < s[j].InstanceIndex
+	}
+	return s[i].InstanceGuid < s[j].InstanceGuid
+}
+
 func (a *appAnalyzer) generatePendingStopsForDuplicateInstances() {
 	//stop duplicate instances at indices < numDesired
 	//this works by scheduling stops for *all* duplicate instances at increasing delays
 	//the sender will process the stops one at a time and only send stops that don't put
 	//the system in an invalid state
 	for index := 0; a.app.IsIndexDesired(index); index++ {
-		instances := a.app.StartingOrRunningInstancesAtIndex(index)
+		instances := a.shuttingDownFirst(a.app.StartingOrRunningInstancesAtIndex(index))
 		if len(instances) > 1 {
 			minimumDuplicateInstanceStopDelay := 4 * a.conf.GracePeriod()
 
@@ -143,6 +303,7 @@ func (a *appAnalyzer) generatePendingStartsAndStopsForEvacuatingInstances() {
 
 		if len(evacuatingInstances) > 0 {
 			startMessage := models.NewPendingStartMessage(a.currentTime, 0, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, index, 2.0, models.PendingStartMessageReasonEvacuating)
+			startMessage.PlacementHints = a.placementHints(index)
 			addStopMessages := func(displayReason string, stopReason models.PendingStopMessageReason) {
 				for _, evacuatingInstance := range evacuatingInstances {
 					stopMessage := models.NewPendingStopMessage(a.currentTime, 0, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, evacuatingInstance.InstanceGuid, stopReason)
@@ -177,25 +338,223 @@ func (a *appAnalyzer) generatePendingStartsAndStopsForEvacuatingInstances() {
 	}
 }
 
+// generatePreemptiveStartsForDeasShuttingDown starts a replacement for the
+// one instance of an app when it runs on a DEA about to be shut down, so that
+// the app stays up while the DEA is rolled.  Once the replacement is running
+// the instance on the DEA is a duplicate, and the first to be stopped.  Apps
+// with more instances keep serving from the others and are left to the
+// evacuator.
+func (a *appAnalyzer) generatePreemptiveStartsForDeasShuttingDown() {
+	if len(a.deasShuttingDown) == 0 || !a.app.IsStaged() || a.app.NumberOfDesiredInstances() != 1 {
+		return
+	}
+
+	instances := a.app.StartingOrRunningInstancesAtIndex(0)
+	if len(instances) == 0 {
+		return
+	}
+	for _, instance := range instances {
+		if _, shuttingDown := a.deasShuttingDown[instance.DeaGuid]; !shuttingDown {
+			return
+		}
+	}
+
+	message := models.NewPendingStartMessage(a.currentTime, 0, a.conf.GracePeriod(), a.app.AppGuid, a.app.AppVersion, 0, 0.5, models.PendingStartMessageReasonPreemptive)
+	message.PlacementHints = a.placementHints(0)
+	a.appendStartMessageIfNotDuplicate(message, "The only instance is on a DEA about to shut down.  Starting a replacement.", map[string]string{
+		"DEA": instances[0].DeaGuid,
+	})
+}
+
+// shuttingDownFirst puts the instances on DEAs about to be shut down ahead
+// of the others, keeping their order otherwise.
+func (a *appAnalyzer) shuttingDownFirst(instances []models.InstanceHeartbeat) []models.InstanceHeartbeat {
+	if len(a.deasShuttingDown) == 0 {
+		return instances
+	}
+
+	first := []models.InstanceHeartbeat{}
+	rest := []models.InstanceHeartbeat{}
+	for _, instance := range instances {
+		if _, shuttingDown := a.deasShuttingDown[instance.DeaGuid]; shuttingDown {
+			first = append(first, instance)
+		} else {
+			rest = append(rest, instance)
+		}
+	}
+	return append(first, rest...)
+}
+
+// placementHints advise where to start index: away from the DEAs it has
+// crashed or is evacuating on, or that are about to shut down, in the fresh zone with fewest of the app's
+// instances, on a DEA with the memory the app needs.  They are nil when
+// there is nothing to advise.
+func (a *appAnalyzer) placementHints(index int) *models.PlacementHints {
+	hints := models.PlacementHints{
+		AvoidDEAs:     a.deasToAvoid(index),
+		PreferredZone: a.preferredZone(),
+		MemoryInMB:    a.app.Desired.MemoryInMB,
+	}
+	if hints.IsEmpty() {
+		return nil
+	}
+	return &hints
+}
+
+func (a *appAnalyzer) deasToAvoid(index int) []string {
+	seen := map[string]bool{}
+	deas := []string{}
+	for _, heartbeat := range a.app.InstanceHeartbeatsAtIndex(index) {
+		_, shuttingDown := a.deasShuttingDown[heartbeat.DeaGuid]
+		if (heartbeat.IsCrashed() || heartbeat.IsEvacuating() || shuttingDown) && !seen[heartbeat.DeaGuid] {
+			seen[heartbeat.DeaGuid] = true
+			deas = append(deas, heartbeat.DeaGuid)
+		}
+	}
+	sort.Strings(deas)
+	return deas
+}
+
+// preferredZone is the fresh zone with fewest of the app's starting or
+// running instances, the first by name on a tie, or none when there are
+// not several fresh zones to choose from.
+func (a *appAnalyzer) preferredZone() string {
+	if len(a.freshZones) < 2 {
+		return ""
+	}
+
+	instancesByZone := map[string]int{}
+	for _, heartbeat := range a.app.InstanceHeartbeats {
+		if heartbeat.IsStartingOrRunning() {
+			instancesByZone[a.deaZones[heartbeat.DeaGuid].Zone]++
+		}
+	}
+
+	preferred := a.freshZones[0]
+	for _, zone := range a.freshZones[1:] {
+		if instancesByZone[zone] < instancesByZone[preferred] {
+			preferred = zone
+		}
+	}
+	return preferred
+}
+
 func (a *appAnalyzer) appendStartMessageIfNotDuplicate(message models.PendingStartMessage, loggingMessage string, additionalDetails map[string]string) (didAppend bool) {
+	message.Origin = models.OriginAnalyzer
+	if a.maintenanceWindow.Name != "" && isRestart(message) {
+		a.suppressStart(message, loggingMessage, additionalDetails)
+		return false
+	}
 	existingMessage, alreadyQueued := a.existingPendingStartMessages[message.StoreKey()]
 	if !alreadyQueued {
-		a.logger.Info(fmt.Sprintf("Enqueuing Start Message: %s", loggingMessage), message.LogDescription(), additionalDetails)
+		a.decide(fmt.Sprintf("Enqueuing Start Message: %s", loggingMessage), message.LogDescription(), additionalDetails)
 		a.startMessages[message.StoreKey()] = message
 		return true
 	} else {
-		a.logger.Info(fmt.Sprintf("Skipping Already Enqueued Start Message: %s", loggingMessage), existingMessage.LogDescription(), additionalDetails)
+		a.decideAgain(fmt.Sprintf("Skipping Already Enqueued Start Message: %s", loggingMessage), existingMessage.LogDescription(), additionalDetails)
 		return false
 	}
 }
 
+// isRestart is true of the starts a maintenance window holds back: those of
+// missing and crashed instances.  Starts that replace an instance going away,
+// such as an evacuating one, are let through, as its stop is not held back.
+func isRestart(message models.PendingStartMessage) bool {
+	return message.StartReason == models.PendingStartMessageReasonMissing || message.StartReason == models.PendingStartMessageReasonCrashed
+}
+
+// suppressStart holds a start back while the app is in a maintenance window,
+// and records it.  Only the first time a start is held back while the window
+// is open goes into the app's history.
+func (a *appAnalyzer) suppressStart(message models.PendingStartMessage, loggingMessage string, additionalDetails map[string]string) {
+	details := map[string]string{"Maintenance Window": a.maintenanceWindow.Name}
+	for key, value := range additionalDetails {
+		details[key] = value
+	}
+
+	suppressed := models.NewSuppressedStart(message, a.maintenanceWindow.Name, a.currentTime)
+	existing, heldBackBefore := a.existingSuppressedStarts[suppressed.StoreKey()]
+	sinceHeldBack := a.currentTime.Sub(time.Unix(existing.LastSuppressedAt, 0))
+	if heldBackBefore && existing.MaintenanceWindow == a.maintenanceWindow.Name && sinceHeldBack <= a.maintenanceWindow.DurationInSeconds.Duration {
+		a.decideAgain(fmt.Sprintf("Holding Back Start Message During Maintenance Window: %s", loggingMessage), message.LogDescription(), details)
+		suppressed = existing.SuppressedAgain(message, a.currentTime)
+	} else {
+		a.decide(fmt.Sprintf("Holding Back Start Message During Maintenance Window: %s", loggingMessage), message.LogDescription(), details)
+	}
+	a.suppressedStarts = append(a.suppressedStarts, suppressed)
+}
+
 func (a *appAnalyzer) appendStopMessageIfNotDuplicate(message models.PendingStopMessage, loggingMessage string, additionalDetails map[string]string) {
+	message.Origin = models.OriginAnalyzer
 	existingMessage, alreadyQueued := a.existingPendingStopMessages[message.StoreKey()]
-	if !alreadyQueued {
-		a.logger.Info(fmt.Sprintf("Enqueuing Stop Message: %s", loggingMessage), message.LogDescription(), additionalDetails)
+	if !alreadyQueued && a.desiredStateSyncing {
+		a.decideAgain(fmt.Sprintf("Deferring Stop Message While The Desired State Syncs: %s", loggingMessage), message.LogDescription(), additionalDetails)
+	} else if !alreadyQueued {
+		a.decide(fmt.Sprintf("Enqueuing Stop Message: %s", loggingMessage), message.LogDescription(), additionalDetails)
 		a.stopMessages[message.StoreKey()] = message
 	} else {
-		a.logger.Info(fmt.Sprintf("Skipping Already Enqueued Stop Message: %s", loggingMessage), existingMessage.LogDescription(), additionalDetails)
+		a.decideAgain(fmt.Sprintf("Skipping Already Enqueued Stop Message: %s", loggingMessage), existingMessage.LogDescription(), additionalDetails)
+	}
+}
+
+// unexplainedDetails are left out of explanations: they are the same for
+// every step, or mean nothing to someone reading one.
+var unexplainedDetails = map[string]bool{
+	"AppGuid":    true,
+	"AppVersion": true,
+	"MessageId":  true,
+	"Origin":     true,
+	"SentOn":     true,
+}
+
+// decide logs a decision and adds it to the app's history, or records it
+// when explaining.
+func (a *appAnalyzer) decide(decision string, description map[string]string, additionalDetails map[string]string) {
+	if !a.explaining {
+		a.decisions = append(a.decisions, models.AppEvent{
+			Type:        models.AppEventAnalyzerDecision,
+			Timestamp:   a.currentTime.Unix(),
+			AppGuid:     a.app.AppGuid,
+			AppVersion:  a.app.AppVersion,
+			Description: decision,
+			Details:     explainedDetails(description, additionalDetails),
+		})
+	}
+	a.decideAgain(decision, description, additionalDetails)
+}
+
+// decideAgain is decide for a decision already made in an earlier run, which
+// is left out of the app's history.
+func (a *appAnalyzer) decideAgain(decision string, description map[string]string, additionalDetails map[string]string) {
+	if !a.explaining {
+		a.logger.Info(decision, description, additionalDetails)
+		return
+	}
+
+	details := []string{}
+	for key, value := range explainedDetails(description, additionalDetails) {
+		details = append(details, key+": "+value)
+	}
+	sort.Strings(details)
+	a.steps = append(a.steps, fmt.Sprintf("%s (%s)", decision, strings.Join(details, ", ")))
+}
+
+func explainedDetails(descriptions ...map[string]string) map[string]string {
+	details := map[string]string{}
+	for _, fields := range descriptions {
+		for key, value := range fields {
+			if !unexplainedDetails[key] {
+				details[key] = value
+			}
+		}
+	}
+	return details
+}
+
+// note records, when explaining, a decision not to act.
+func (a *appAnalyzer) note(step string) {
+	if a.explaining {
+		a.steps = append(a.steps, step)
 	}
 }
 
@@ -0,0 +1,58 @@
+package analyzer
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// Explanation is what the analyzer would do for an app, and why.
+type Explanation struct {
+	StartMessages []models.PendingStartMessage `json:"start_messages"`
+	StopMessages  []models.PendingStopMessage  `json:"stop_messages"`
+	Steps         []string                     `json:"steps"`
+}
+
+// Explain runs the analysis of one app as the analyzer would at currentTime,
+// given the pending messages already in the store, and returns what it
+// decided without enqueuing anything or saving crash counts.  Explain does
+// not check freshness: the analyzer does nothing at all if the store is not
+// fresh.
+func Explain(app *models.App, currentTime time.Time, existingPendingStartMessages map[string]models.PendingStartMessage, existingPendingStopMessages map[string]models.PendingStopMessage, conf *config.Config) Explanation {
+	a := newAppAnalyzer(app, currentTime, existingPendingStartMessages, existingPendingStopMessages, nil, conf)
+	a.explaining = true
+	a.maintenanceWindow = maintenanceWindowFor(openMaintenanceWindows(conf, currentTime), app)
+	startMessages, stopMessages, _ := a.analyzeApp()
+
+	explanation := Explanation{
+		StartMessages: []models.PendingStartMessage{},
+		StopMessages:  []models.PendingStopMessage{},
+		Steps:         a.steps,
+	}
+
+	startKeys := []string{}
+	for key := range startMessages {
+		startKeys = append(startKeys, key)
+	}
+	sort.Strings(startKeys)
+	for _, key := range startKeys {
+		explanation.StartMessages = append(explanation.StartMessages, startMessages[key])
+	}
+
+	stopKeys := []string{}
+	for key := range stopMessages {
+		stopKeys = append(stopKeys, key)
+	}
+	sort.Strings(stopKeys)
+	for _, key := range stopKeys {
+		explanation.StopMessages = append(explanation.StopMessages, stopMessages[key])
+	}
+
+	if len(explanation.Steps) == 0 {
+		explanation.Steps = append(explanation.Steps, "Nothing to do: every desired instance is starting or running")
+	}
+
+	return explanation
+}
@@ -0,0 +1,116 @@
+package analyzer_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/analyzer"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+)
+
+var _ = Describe("Explain", func() {
+	var (
+		conf *config.Config
+		app  appfixture.AppFixture
+		now  time.Time
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		app = appfixture.NewAppFixture()
+		now = time.Unix(1000, 0)
+	})
+
+	noMessages := func() (map[string]models.PendingStartMessage, map[string]models.PendingStopMessage) {
+		return map[string]models.PendingStartMessage{}, map[string]models.PendingStopMessage{}
+	}
+
+	explain := func(desired int, running ...models.InstanceHeartbeat) Explanation {
+		starts, stops := noMessages()
+		return Explain(models.NewApp(app.AppGuid, app.AppVersion, app.DesiredState(desired), running, map[int]models.CrashCount{}), now, starts, stops, conf)
+	}
+
+	Context("when every desired instance is running", func() {
+		It("says there is nothing to do", func() {
+			explanation := explain(1, app.InstanceAtIndex(0).Heartbeat())
+			Ω(explanation.StartMessages).Should(BeEmpty())
+			Ω(explanation.StopMessages).Should(BeEmpty())
+			Ω(explanation.Steps).Should(ConsistOf(HavePrefix("Nothing to do")))
+		})
+	})
+
+	Context("when instances are missing", func() {
+		It("explains the starts it would enqueue", func() {
+			explanation := explain(2, app.InstanceAtIndex(0).Heartbeat())
+			Ω(explanation.StartMessages).Should(HaveLen(1))
+			Ω(explanation.StartMessages[0].IndexToStart).Should(Equal(1))
+			Ω(explanation.Steps).Should(HaveLen(2))
+			Ω(explanation.Steps[0]).Should(HavePrefix("Enqueuing Start Message: Identified missing instance"))
+			Ω(explanation.Steps[0]).Should(ContainSubstring("IndexToStart: 1"))
+			Ω(explanation.Steps[0]).Should(ContainSubstring("Desired # of Instances: 2"))
+		})
+
+		It("explains why it would not stop extra instances yet", func() {
+			explanation := explain(2, app.InstanceAtIndex(0).Heartbeat(), app.InstanceAtIndex(2).Heartbeat())
+			Ω(explanation.StopMessages).Should(BeEmpty())
+			Ω(explanation.Steps).Should(ContainElement(HavePrefix("Not looking for extra or duplicate instances")))
+		})
+
+		It("explains that it would skip starts that are already enqueued", func() {
+			starts, stops := noMessages()
+			existing := models.NewPendingStartMessage(now, 30, 0, app.AppGuid, app.AppVersion, 1, 0.5, models.PendingStartMessageReasonMissing)
+			starts[existing.StoreKey()] = existing
+
+			explanation := Explain(models.NewApp(app.AppGuid, app.AppVersion, app.DesiredState(2), []models.InstanceHeartbeat{app.InstanceAtIndex(0).Heartbeat()}, map[int]models.CrashCount{}), now, starts, stops, conf)
+			Ω(explanation.StartMessages).Should(BeEmpty())
+			Ω(explanation.Steps).Should(ConsistOf(HavePrefix("Skipping Already Enqueued Start Message")))
+		})
+	})
+
+	Context("when there are extra instances", func() {
+		It("explains the stops it would enqueue", func() {
+			explanation := explain(1, app.InstanceAtIndex(0).Heartbeat(), app.InstanceAtIndex(1).Heartbeat())
+			Ω(explanation.StopMessages).Should(HaveLen(1))
+			Ω(explanation.StopMessages[0].InstanceGuid).Should(Equal(app.InstanceAtIndex(1).InstanceGuid))
+			Ω(explanation.Steps).Should(ConsistOf(HavePrefix("Enqueuing Stop Message: Identified extra running instance")))
+		})
+	})
+
+	Context("when the app is not staged", func() {
+		It("explains why it would not start anything", func() {
+			desired := app.DesiredState(1)
+			desired.PackageState = models.AppPackageStatePending
+			starts, stops := noMessages()
+
+			explanation := Explain(models.NewApp(app.AppGuid, app.AppVersion, desired, []models.InstanceHeartbeat{}, map[int]models.CrashCount{}), now, starts, stops, conf)
+			Ω(explanation.StartMessages).Should(BeEmpty())
+			Ω(explanation.Steps).Should(ConsistOf(HavePrefix("Not starting missing or crashed instances")))
+		})
+	})
+
+	Context("when the app is unmanaged", func() {
+		It("explains that it would leave the app alone", func() {
+			desired := app.DesiredState(2)
+			desired.Unmanaged = true
+			starts, stops := noMessages()
+
+			explanation := Explain(models.NewApp(app.AppGuid, app.AppVersion, desired, []models.InstanceHeartbeat{app.InstanceAtIndex(3).Heartbeat()}, map[int]models.CrashCount{}), now, starts, stops, conf)
+			Ω(explanation.StartMessages).Should(BeEmpty())
+			Ω(explanation.StopMessages).Should(BeEmpty())
+			Ω(explanation.Steps).Should(ConsistOf(ContainSubstring("fetcher_exclusions")))
+		})
+	})
+
+	Context("when all instances have crashed", func() {
+		It("explains that only index 0 is restarted", func() {
+			explanation := explain(2, app.CrashedInstanceHeartbeatAtIndex(0), app.CrashedInstanceHeartbeatAtIndex(1))
+			Ω(explanation.StartMessages).Should(HaveLen(1))
+			Ω(explanation.StartMessages[0].IndexToStart).Should(Equal(0))
+			Ω(explanation.Steps).Should(ContainElement(HavePrefix("Not restarting crashed index 1")))
+		})
+	})
+})
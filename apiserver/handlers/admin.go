@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cloudfoundry/hm9000/admin"
+	"github.com/cloudfoundry/hm9000/apiserver"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/tedsuo/rata"
+)
+
+// NewAdmin serves the admin API, which shows and changes how components are
+// controlled.  It is meant to be wrapped in the admin user's basic auth.
+func NewAdmin(logger logger.Logger, controller *admin.Controller) (http.Handler, error) {
+	handlers := map[string]http.Handler{
+		"admin_components":       &adminComponentsHandler{logger: logger, controller: controller},
+		"admin_component":        &adminComponentHandler{logger: logger, controller: controller},
+		"admin_update_component": &adminUpdateComponentHandler{logger: logger, controller: controller},
+	}
+
+	return rata.NewRouter(apiserver.AdminRoutes, handlers)
+}
+
+type adminComponentsHandler struct {
+	logger     logger.Logger
+	controller *admin.Controller
+}
+
+func (handler *adminComponentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	controls, err := handler.controller.Controls()
+	if err != nil {
+		handler.logger.Error("Failed to get component controls", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, controls)
+}
+
+type adminComponentHandler struct {
+	logger     logger.Logger
+	controller *admin.Controller
+}
+
+func (handler *adminComponentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	component := r.URL.Query().Get(":component")
+
+	control, err := handler.controller.Control(component)
+	if err == admin.UnknownComponentError {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		handler.logger.Error("Failed to get component control", err, map[string]string{"Component": component})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, control)
+}
+
+type adminUpdateComponentHandler struct {
+	logger     logger.Logger
+	controller *admin.Controller
+}
+
+// ServeHTTP applies the admin.Update in the request body.
+func (handler *adminUpdateComponentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	component := r.URL.Query().Get(":component")
+
+	update := admin.Update{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &update)
+	}
+	if err != nil {
+		http.Error(w, "Failed to parse update", http.StatusBadRequest)
+		return
+	}
+
+	operator, _, _ := r.BasicAuth()
+	control, err := handler.controller.Apply(component, update, operator)
+	switch err {
+	case nil:
+	case admin.UnknownComponentError:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case admin.NegativeMessageLimitError, admin.MessageLimitNotSupportedError:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		handler.logger.Error("Failed to update component control", err, map[string]string{"Component": component})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, control)
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	body, _ := json.Marshal(value)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
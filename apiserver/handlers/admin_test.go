@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry/hm9000/admin"
+	"github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin", func() {
+	var (
+		handler http.Handler
+		store   storepackage.Store
+	)
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		request.SetBasicAuth("admin-jo", "secret")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	BeforeEach(func() {
+		conf := defaultConf()
+		config, _ := config.DefaultConfig()
+		store = storepackage.NewStore(config, conf.StoreAdapter, fakelogger.NewFakeLogger())
+
+		var err error
+		handler, err = handlers.NewAdmin(conf.Logger, admin.New(store, conf.TimeProvider, conf.Logger))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("lists the controls of every component", func() {
+		response := serve("GET", "/admin/components", "")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+
+		controls := []models.ComponentControl{}
+		json.Unmarshal(response.Body.Bytes(), &controls)
+		Ω(controls).Should(HaveLen(len(admin.Components)))
+	})
+
+	It("shows the control of one component", func() {
+		store.SaveComponentControl(models.ComponentControl{Component: "sender", MessageLimit: 3})
+
+		response := serve("GET", "/admin/components/sender", "")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+
+		control := models.ComponentControl{}
+		json.Unmarshal(response.Body.Bytes(), &control)
+		Ω(control).Should(Equal(models.ComponentControl{Component: "sender", MessageLimit: 3}))
+	})
+
+	It("pauses a component on behalf of the admin user", func() {
+		response := serve("PUT", "/admin/components/analyzer", `{"paused": true, "reason": "incident 42"}`)
+		Ω(response.Code).Should(Equal(http.StatusOK))
+
+		controls, _ := store.GetComponentControls()
+		Ω(controls["analyzer"]).Should(Equal(models.ComponentControl{Component: "analyzer", Paused: true, Reason: "incident 42", ChangedBy: "admin-jo", ChangedAt: 100}))
+	})
+
+	It("changes the sender's message limit", func() {
+		response := serve("PUT", "/admin/components/sender", `{"message_limit": 5}`)
+		Ω(response.Code).Should(Equal(http.StatusOK))
+
+		controls, _ := store.GetComponentControls()
+		Ω(controls["sender"].MessageLimit).Should(Equal(5))
+	})
+
+	It("responds 404 for components that cannot be controlled", func() {
+		Ω(serve("GET", "/admin/components/listener", "").Code).Should(Equal(http.StatusNotFound))
+		Ω(serve("PUT", "/admin/components/listener", `{"paused": true}`).Code).Should(Equal(http.StatusNotFound))
+	})
+
+	It("responds 400 for bad updates", func() {
+		Ω(serve("PUT", "/admin/components/sender", `{"paused": "maybe"}`).Code).Should(Equal(http.StatusBadRequest))
+		Ω(serve("PUT", "/admin/components/sender", `{"message_limit": -1}`).Code).Should(Equal(http.StatusBadRequest))
+		Ω(serve("PUT", "/admin/components/analyzer", `{"message_limit": 5}`).Code).Should(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+type analysisReportHandler struct {
+	logger logger.Logger
+	store  store.Store
+}
+
+// NewAnalysisReportHandler serves the latest analysis report: what the
+// analyzer's last successful run cost and found to do.
+func NewAnalysisReportHandler(logger logger.Logger, store store.Store) http.Handler {
+	return &analysisReportHandler{
+		logger: logger,
+		store:  store,
+	}
+}
+
+func (handler *analysisReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report, err := handler.store.GetAnalysisReport()
+	if err == storeadapter.ErrorKeyNotFound {
+		http.Error(w, "No analysis report yet", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		handler.logger.Error("Failed to handle analysis_report request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(report.ToJSON())
+}
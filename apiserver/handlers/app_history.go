@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+const (
+	DefaultAppHistoryPerPage = 50
+	MaxAppHistoryPerPage     = 500
+)
+
+type appHistoryHandler struct {
+	logger logger.Logger
+	store  store.Store
+}
+
+type AppHistoryResponse struct {
+	AppGuid      string            `json:"droplet"`
+	Page         int               `json:"page"`
+	PerPage      int               `json:"per_page"`
+	TotalResults int               `json:"total_results"`
+	NextPage     int               `json:"next_page,omitempty"`
+	Events       []models.AppEvent `json:"events"`
+}
+
+// NewAppHistoryHandler serves what hm9000 did to an app, newest first: the
+// starts and stops sent, the crashes counted and the analyzer's decisions.
+// The since and until query parameters (unix seconds, inclusive) narrow the
+// events by time, and page and per_page page through them.
+func NewAppHistoryHandler(logger logger.Logger, store store.Store) http.Handler {
+	return &appHistoryHandler{
+		logger: logger,
+		store:  store,
+	}
+}
+
+func (handler *appHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	appGuid := query.Get(":app_guid")
+
+	since, err := integerParameter(query.Get("since"), 0)
+	if err != nil || since < 0 {
+		http.Error(w, "since must be a non-negative unix timestamp", http.StatusBadRequest)
+		return
+	}
+	until, err := integerParameter(query.Get("until"), 0)
+	if err != nil || until < 0 {
+		http.Error(w, "until must be a non-negative unix timestamp", http.StatusBadRequest)
+		return
+	}
+	page, err := integerParameter(query.Get("page"), 1)
+	if err != nil || page < 1 {
+		http.Error(w, "page must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	perPage, err := integerParameter(query.Get("per_page"), DefaultAppHistoryPerPage)
+	if err != nil || perPage < 1 || perPage > MaxAppHistoryPerPage {
+		http.Error(w, "per_page must be between 1 and "+strconv.Itoa(MaxAppHistoryPerPage), http.StatusBadRequest)
+		return
+	}
+
+	history, err := handler.store.GetAppHistory(appGuid)
+	if err != nil {
+		handler.logger.Error("Failed to handle app history request", err, map[string]string{"AppGuid": appGuid})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	events := history.Between(int64(since), int64(until))
+	response := AppHistoryResponse{
+		AppGuid:      appGuid,
+		Page:         page,
+		PerPage:      perPage,
+		TotalResults: len(events),
+		Events:       []models.AppEvent{},
+	}
+	start := (page - 1) * perPage
+	if start < len(events) {
+		end := start + perPage
+		if end < len(events) {
+			response.NextPage = page + 1
+		} else {
+			end = len(events)
+		}
+		response.Events = events[start:end]
+	}
+
+	body, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// integerParameter parses a query parameter, or returns defaultValue if it
+// is empty.
+func integerParameter(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
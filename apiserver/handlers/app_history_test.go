@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("App history", func() {
+	var (
+		handler      http.Handler
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+	)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	decode := func(response *httptest.ResponseRecorder) AppHistoryResponse {
+		decoded := AppHistoryResponse{}
+		err := json.Unmarshal(response.Body.Bytes(), &decoded)
+		Ω(err).ShouldNot(HaveOccurred())
+		return decoded
+	}
+
+	timestamps := func(events []models.AppEvent) []int64 {
+		result := []int64{}
+		for _, event := range events {
+			result = append(result, event.Timestamp)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		conf := defaultConf()
+		storeAdapter = conf.StoreAdapter
+
+		var err error
+		handler, _, err = makeHandlerAndStore(conf)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		history := models.AppHistory{AppGuid: "app-guid"}
+		for timestamp := int64(10); timestamp <= 50; timestamp += 10 {
+			history.Events = append(history.Events, models.AppEvent{
+				Type:       models.AppEventStartSent,
+				Timestamp:  timestamp,
+				AppGuid:    "app-guid",
+				AppVersion: "app-version",
+			})
+		}
+		storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/app-history/app-guid", Value: history.ToJSON()}})
+	})
+
+	It("serves the app's events, newest first", func() {
+		response := get("/apps/app-guid/history")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		served := decode(response)
+		Ω(served.AppGuid).Should(Equal("app-guid"))
+		Ω(served.TotalResults).Should(Equal(5))
+		Ω(served.Page).Should(Equal(1))
+		Ω(served.PerPage).Should(Equal(DefaultAppHistoryPerPage))
+		Ω(served.NextPage).Should(BeZero())
+		Ω(timestamps(served.Events)).Should(Equal([]int64{50, 40, 30, 20, 10}))
+		Ω(served.Events[0].Type).Should(Equal(models.AppEventStartSent))
+	})
+
+	It("filters the events by time", func() {
+		served := decode(get("/apps/app-guid/history?since=20&until=40"))
+		Ω(served.TotalResults).Should(Equal(3))
+		Ω(timestamps(served.Events)).Should(Equal([]int64{40, 30, 20}))
+	})
+
+	It("pages through the events", func() {
+		served := decode(get("/apps/app-guid/history?per_page=2"))
+		Ω(timestamps(served.Events)).Should(Equal([]int64{50, 40}))
+		Ω(served.NextPage).Should(Equal(2))
+
+		served = decode(get("/apps/app-guid/history?per_page=2&page=3"))
+		Ω(timestamps(served.Events)).Should(Equal([]int64{10}))
+		Ω(served.NextPage).Should(BeZero())
+
+		served = decode(get("/apps/app-guid/history?per_page=2&page=4"))
+		Ω(served.Events).Should(BeEmpty())
+		Ω(served.TotalResults).Should(Equal(5))
+	})
+
+	It("serves an empty history for an app hm9000 has done nothing to", func() {
+		response := get("/apps/other-guid/history")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		served := decode(response)
+		Ω(served.AppGuid).Should(Equal("other-guid"))
+		Ω(served.Events).Should(BeEmpty())
+	})
+
+	It("rejects bad parameters", func() {
+		for _, query := range []string{"since=yesterday", "until=-1", "page=0", "per_page=0", "per_page=501"} {
+			Ω(get("/apps/app-guid/history?"+query).Code).Should(Equal(http.StatusBadRequest), query)
+		}
+	})
+
+	It("responds 500 when the store fails", func() {
+		storeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("app-history", errors.New("oops"))
+		Ω(get("/apps/app-guid/history").Code).Should(Equal(http.StatusInternalServerError))
+	})
+})
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+type appSummaryHandler struct {
+	logger logger.Logger
+	store  store.Store
+}
+
+// NewAppSummaryHandler serves the aggregator's summary of an app's health,
+// which is as fresh as the aggregator's last run.  An app with no summary is
+// not found.
+func NewAppSummaryHandler(logger logger.Logger, store store.Store) http.Handler {
+	return &appSummaryHandler{
+		logger: logger,
+		store:  store,
+	}
+}
+
+func (handler *appSummaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	appGuid := query.Get(":app_guid")
+	appVersion := query.Get(":app_version")
+
+	summary, err := handler.store.GetAppSummary(appGuid, appVersion)
+	if err == store.AppNotFoundError {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		handler.logger.Error("Failed to handle app summary request", err, map[string]string{"AppGuid": appGuid, "AppVersion": appVersion})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, _ := json.Marshal(summary)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("App summary", func() {
+	var (
+		handler      http.Handler
+		store        store.Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		summary      models.AppSummary
+	)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	BeforeEach(func() {
+		conf := defaultConf()
+		storeAdapter = conf.StoreAdapter
+
+		var err error
+		handler, store, err = makeHandlerAndStore(conf)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		summary = models.AppSummary{AppGuid: "app-guid", AppVersion: "app-version", State: models.AppStateStarted, DesiredInstances: 3, RunningInstances: 2, MissingIndices: 1}
+		_, _, err = store.SyncAppSummaries(summary)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("serves the app's summary", func() {
+		response := get("/apps/app-guid/app-version/summary")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		decoded := models.AppSummary{}
+		err := json.Unmarshal(response.Body.Bytes(), &decoded)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(summary))
+	})
+
+	It("returns 404 for an app without a summary", func() {
+		response := get("/apps/app-guid/other-version/summary")
+		Ω(response.Code).Should(Equal(http.StatusNotFound))
+	})
+
+	It("returns 500 when the store fails", func() {
+		storeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("summaries", errors.New("oops"))
+		response := get("/apps/app-guid/app-version/summary")
+		Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+	})
+})
@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/hm9000/store"
 )
 
@@ -16,6 +21,7 @@ type bulkHandler struct {
 	logger       logger.Logger
 	store        store.Store
 	timeProvider timeprovider.TimeProvider
+	conf         *config.Config
 }
 
 type AppStateRequest struct {
@@ -23,11 +29,16 @@ type AppStateRequest struct {
 	AppVersion string `json:"version"`
 }
 
-func NewBulkAppStateHandler(logger logger.Logger, store store.Store, timeProvider timeprovider.TimeProvider) http.Handler {
+// NewBulkAppStateHandler answers with nothing while the desired or actual
+// state is not fresh, unless api_server_degraded_responses is set.  Then it
+// answers with the state it has, marking each app "stale", with
+// "staleness_in_seconds" since the state was last fresh when that is known.
+func NewBulkAppStateHandler(logger logger.Logger, store store.Store, timeProvider timeprovider.TimeProvider, conf *config.Config) http.Handler {
 	return &bulkHandler{
 		logger:       logger,
 		store:        store,
 		timeProvider: timeProvider,
+		conf:         conf,
 	}
 }
 
@@ -51,21 +62,39 @@ func (handler *bulkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	stale := false
 	err = handler.store.VerifyFreshness(handler.timeProvider.Time())
 	if err != nil {
-		handler.logger.Error("Failed to handle bulk_app_state request", err, map[string]string{
-			"payload":      string(bodyBytes),
-			"elapsed time": fmt.Sprintf("%s", time.Since(startTime)),
-		})
-		w.Write([]byte("{}"))
-		return
+		if !handler.conf.APIServerDegradedResponses || !isFreshnessError(err) {
+			handler.logger.Error("Failed to handle bulk_app_state request", err, map[string]string{
+				"payload":      string(bodyBytes),
+				"elapsed time": fmt.Sprintf("%s", time.Since(startTime)),
+			})
+			w.Write([]byte("{}"))
+			return
+		}
+		stale = true
+	}
+
+	var staleness json.RawMessage
+	if stale {
+		staleness, err = handler.staleness(err)
+		if err != nil {
+			handler.logger.Error("Failed to find how long the state has been stale", err)
+		}
 	}
 
+	filter := newDesiredStateFilter(r.URL.Query())
+
 	var apps = make(map[string]interface{})
 	for _, request := range requests {
 		app, err := handler.store.GetApp(request.AppGuid, request.AppVersion)
-		if err == nil {
-			apps[app.AppGuid] = app
+		if err == nil && filter.matches(app.Desired) {
+			if stale {
+				apps[app.AppGuid] = staleApp(app, staleness)
+			} else {
+				apps[app.AppGuid] = app
+			}
 		}
 	}
 
@@ -79,3 +108,92 @@ func (handler *bulkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	w.Write([]byte(appsJson))
 }
+
+func isFreshnessError(err error) bool {
+	return err == store.ActualIsNotFreshError || err == store.DesiredIsNotFreshError || err == store.ActualAndDesiredAreNotFreshError
+}
+
+// staleness returns the seconds since the state that is not fresh, by
+// freshnessErr, was last fresh, or nil if it has never been.
+func (handler *bulkHandler) staleness(freshnessErr error) (json.RawMessage, error) {
+	lastFresh := []func() (time.Time, error){}
+	if freshnessErr != store.ActualIsNotFreshError {
+		lastFresh = append(lastFresh, handler.store.GetDesiredLastFresh)
+	}
+	if freshnessErr != store.DesiredIsNotFreshError {
+		lastFresh = append(lastFresh, handler.store.GetActualLastFresh)
+	}
+
+	var oldest time.Time
+	for _, get := range lastFresh {
+		freshAt, err := get()
+		if err != nil {
+			return nil, err
+		}
+		if freshAt.IsZero() {
+			return nil, nil
+		}
+		if oldest.IsZero() || freshAt.Before(oldest) {
+			oldest = freshAt
+		}
+	}
+
+	seconds := int64(handler.timeProvider.Time().Sub(oldest) / time.Second)
+	return json.RawMessage(strconv.FormatInt(seconds, 10)), nil
+}
+
+// staleApp is the app's JSON with the stale flag, and the staleness if it
+// is known.
+func staleApp(app *models.App, staleness json.RawMessage) map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	json.Unmarshal(app.ToJSON(), &fields)
+	fields["stale"] = json.RawMessage("true")
+	if staleness != nil {
+		fields["staleness_in_seconds"] = staleness
+	}
+	return fields
+}
+
+// desiredStateFilter narrows a bulk_app_state response to the apps in an
+// organization or space, or with labels, as given by the organization_guid,
+// space_guid and label query parameters.  label may be repeated, and an app
+// must have every label asked for: label=name=value asks for a value and
+// label=name for any value.
+type desiredStateFilter struct {
+	organizationGuid string
+	spaceGuid        string
+	labels           map[string]string
+	labelNames       []string
+}
+
+func newDesiredStateFilter(query url.Values) desiredStateFilter {
+	filter := desiredStateFilter{
+		organizationGuid: query.Get("organization_guid"),
+		spaceGuid:        query.Get("space_guid"),
+		labels:           map[string]string{},
+	}
+	for _, label := range query["label"] {
+		nameAndValue := strings.SplitN(label, "=", 2)
+		if len(nameAndValue) == 2 {
+			filter.labels[nameAndValue[0]] = nameAndValue[1]
+		} else {
+			filter.labelNames = append(filter.labelNames, label)
+		}
+	}
+	return filter
+}
+
+func (filter desiredStateFilter) matches(desired models.DesiredAppState) bool {
+	if filter.organizationGuid != "" && desired.OrganizationGuid != filter.organizationGuid {
+		return false
+	}
+	if filter.spaceGuid != "" && desired.SpaceGuid != filter.spaceGuid {
+		return false
+	}
+	for _, name := range filter.labelNames {
+		if _, ok := desired.Labels[name]; !ok {
+			return false
+		}
+	}
+	return desired.HasLabels(filter.labels)
+}
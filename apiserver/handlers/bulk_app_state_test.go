@@ -34,6 +34,7 @@ type AppResponse struct {
 	Desired            models.DesiredAppState     `json:"desired"`
 	InstanceHeartbeats []models.InstanceHeartbeat `json:"instance_heartbeats"`
 	CrashCounts        []models.CrashCount        `json:"crash_counts"`
+	CrashReasons       []models.CrashReason       `json:"crash_reasons"`
 }
 
 type HandlerConf struct {
@@ -41,6 +42,8 @@ type HandlerConf struct {
 	TimeProvider *faketimeprovider.FakeTimeProvider
 	Logger       logger.Logger
 	MaxInFlight  int
+
+	DegradedResponses bool
 }
 
 func defaultConf() HandlerConf {
@@ -55,10 +58,11 @@ func defaultConf() HandlerConf {
 
 func makeHandlerAndStore(conf HandlerConf) (http.Handler, store.Store, error) {
 	config, _ := config.DefaultConfig()
+	config.APIServerDegradedResponses = conf.DegradedResponses
 
 	store := store.NewStore(config, conf.StoreAdapter, fakelogger.NewFakeLogger())
 
-	handler, err := handlers.New(conf.Logger, store, conf.TimeProvider)
+	handler, err := handlers.New(conf.Logger, store, conf.TimeProvider, config, handlers.NewPendingMessageScanner(conf.Logger, store, conf.TimeProvider))
 	return handler, store, err
 }
 
@@ -116,6 +120,65 @@ var _ = Describe("BulkAppState", func() {
 
 			Expect(response.Body.String()).To(Equal("{}"))
 		})
+
+		Context("with degraded responses", func() {
+			var (
+				app     appfixture.AppFixture
+				handler http.Handler
+				store   store.Store
+				conf    HandlerConf
+			)
+
+			BeforeEach(func() {
+				conf = defaultConf()
+				conf.DegradedResponses = true
+				app = appfixture.NewAppFixture()
+
+				var err error
+				handler, store, err = makeHandlerAndStore(conf)
+				Expect(err).ToNot(HaveOccurred())
+
+				store.SyncDesiredState(app.DesiredState(3))
+				store.SyncHeartbeats(app.Heartbeat(3))
+			})
+
+			bulkAppState := func() map[string]map[string]interface{} {
+				request_body := fmt.Sprintf(`[{"droplet":"%s","version":"%s"}]`, app.AppGuid, app.AppVersion)
+				request, _ := http.NewRequest("POST", "/bulk_app_state", bytes.NewBufferString(request_body))
+				response := httptest.NewRecorder()
+				handler.ServeHTTP(response, request)
+
+				apps := map[string]map[string]interface{}{}
+				Expect(json.Unmarshal(response.Body.Bytes(), &apps)).To(Succeed())
+				return apps
+			}
+
+			It("returns the last state known, marked stale", func() {
+				apps := bulkAppState()
+				Expect(apps).To(HaveLen(1))
+				Expect(apps[app.AppGuid]["droplet"]).To(Equal(app.AppGuid))
+				Expect(apps[app.AppGuid]["instance_heartbeats"]).To(HaveLen(3))
+				Expect(apps[app.AppGuid]["stale"]).To(BeTrue())
+				Expect(apps[app.AppGuid]).NotTo(HaveKey("staleness_in_seconds"))
+			})
+
+			It("says how long ago the state was last fresh", func() {
+				store.BumpDesiredFreshness(time.Unix(70, 0))
+				store.BumpActualFreshness(time.Unix(40, 0))
+				store.RevokeActualFreshness()
+
+				apps := bulkAppState()
+				Expect(apps[app.AppGuid]["stale"]).To(BeTrue())
+				Expect(apps[app.AppGuid]["staleness_in_seconds"]).To(BeNumerically("==", 60))
+			})
+
+			It("does not mark a fresh state stale", func() {
+				freshenTheStore(store)
+
+				apps := bulkAppState()
+				Expect(apps[app.AppGuid]).NotTo(HaveKey("stale"))
+			})
+		})
 	})
 
 	Context("when the store is fresh", func() {
@@ -205,6 +268,32 @@ var _ = Describe("BulkAppState", func() {
 				Expect(receivedApp.Desired).To(Equal(expectedApp.Desired))
 				Expect(receivedApp.InstanceHeartbeats).To(ConsistOf(expectedApp.InstanceHeartbeats))
 				Expect(receivedApp.CrashCounts).To(ConsistOf(expectedApp.CrashCounts))
+				Expect(receivedApp.CrashReasons).To(BeEmpty())
+			})
+
+			It("should say why the app's indices last crashed", func() {
+				conf := defaultConf()
+				app := appfixture.NewAppFixture()
+
+				handler, store, err := makeHandlerAndStore(conf)
+				Expect(err).ToNot(HaveOccurred())
+
+				exited := app.InstanceAtIndex(1).DropletExited(models.DropletExitedReasonCrashed)
+				exited.ExitStatusCode = 137
+				exited.ExitDescription = "out of memory"
+				reason := models.NewCrashReason(exited, conf.TimeProvider.Time())
+
+				store.SyncDesiredState(app.DesiredState(3))
+				store.SaveCrashReasons(reason)
+				freshenTheStore(store)
+
+				request_body := fmt.Sprintf(`[{"droplet":"%s","version":"%s"}]`, app.AppGuid, app.AppVersion)
+				request, _ := http.NewRequest("POST", "/bulk_app_state", bytes.NewBufferString(request_body))
+				response := httptest.NewRecorder()
+				handler.ServeHTTP(response, request)
+
+				receivedApp := decodeBulkResponse(response.Body.String())[app.AppGuid]
+				Expect(receivedApp.CrashReasons).To(Equal([]models.CrashReason{reason}))
 			})
 		})
 
@@ -256,5 +345,70 @@ var _ = Describe("BulkAppState", func() {
 				Expect(receivedApp.CrashCounts).To(ConsistOf(expectedApp.CrashCounts))
 			})
 		})
+
+		Context("when filtering by organization, space or labels", func() {
+			var (
+				handler        http.Handler
+				payments, blog appfixture.AppFixture
+			)
+
+			BeforeEach(func() {
+				var store store.Store
+				var err error
+				handler, store, err = makeHandlerAndStore(defaultConf())
+				Expect(err).ToNot(HaveOccurred())
+				freshenTheStore(store)
+
+				payments = appfixture.NewAppFixture()
+				paymentsDesired := payments.DesiredState(1)
+				paymentsDesired.OrganizationGuid = "org-a"
+				paymentsDesired.SpaceGuid = "space-a"
+				paymentsDesired.Labels = map[string]string{"team": "payments", "tier": "critical"}
+
+				blog = appfixture.NewAppFixture()
+				blogDesired := blog.DesiredState(1)
+				blogDesired.OrganizationGuid = "org-a"
+				blogDesired.SpaceGuid = "space-b"
+				blogDesired.Labels = map[string]string{"team": "marketing"}
+
+				store.SyncDesiredState(paymentsDesired, blogDesired)
+			})
+
+			filtered := func(query string) []string {
+				requestBody := fmt.Sprintf(`[{"droplet":"%s","version":"%s"},{"droplet":"%s","version":"%s"}]`, payments.AppGuid, payments.AppVersion, blog.AppGuid, blog.AppVersion)
+				request, _ := http.NewRequest("POST", "/bulk_app_state?"+query, bytes.NewBufferString(requestBody))
+				response := httptest.NewRecorder()
+				handler.ServeHTTP(response, request)
+
+				guids := []string{}
+				for guid := range decodeBulkResponse(response.Body.String()) {
+					guids = append(guids, guid)
+				}
+				return guids
+			}
+
+			It("includes the metadata in the desired state", func() {
+				request, _ := http.NewRequest("POST", "/bulk_app_state", bytes.NewBufferString(fmt.Sprintf(`[{"droplet":"%s","version":"%s"}]`, payments.AppGuid, payments.AppVersion)))
+				response := httptest.NewRecorder()
+				handler.ServeHTTP(response, request)
+
+				desired := decodeBulkResponse(response.Body.String())[payments.AppGuid].Desired
+				Expect(desired.OrganizationGuid).To(Equal("org-a"))
+				Expect(desired.SpaceGuid).To(Equal("space-a"))
+				Expect(desired.Labels).To(Equal(map[string]string{"team": "payments", "tier": "critical"}))
+			})
+
+			It("responds with only the apps that match", func() {
+				Expect(filtered("")).To(ConsistOf(payments.AppGuid, blog.AppGuid))
+				Expect(filtered("organization_guid=org-a")).To(ConsistOf(payments.AppGuid, blog.AppGuid))
+				Expect(filtered("organization_guid=org-b")).To(BeEmpty())
+				Expect(filtered("space_guid=space-b")).To(ConsistOf(blog.AppGuid))
+				Expect(filtered("label=team%3Dpayments")).To(ConsistOf(payments.AppGuid))
+				Expect(filtered("label=team=payments&label=tier=critical")).To(ConsistOf(payments.AppGuid))
+				Expect(filtered("label=team=payments&label=tier=low")).To(BeEmpty())
+				Expect(filtered("label=tier")).To(ConsistOf(payments.AppGuid))
+				Expect(filtered("label=team&space_guid=space-b")).To(ConsistOf(blog.AppGuid))
+			})
+		})
 	})
 })
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+type cellReportsHandler struct {
+	logger     logger.Logger
+	messageBus messagebus.MessageBus
+	subject    string
+}
+
+// NewCellReportsHandler takes Diego cell reports posted over HTTP and
+// publishes them on subject, for the listener to read as heartbeats the same
+// way as the reports cells publish themselves.
+func NewCellReportsHandler(logger logger.Logger, messageBus messagebus.MessageBus, subject string) http.Handler {
+	return &cellReportsHandler{
+		logger:     logger,
+		messageBus: messageBus,
+		subject:    subject,
+	}
+}
+
+func (handler *cellReportsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	report, err := models.NewCellReportFromJSON(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = handler.messageBus.Publish(handler.subject, report.ToJSON())
+	if err != nil {
+		handler.logger.Error("Failed to publish cell report", err, report.LogDescription())
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,76 @@
+package handlers_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CellReports", func() {
+	var (
+		handler    http.Handler
+		messageBus *fakeyagnats.FakeNATSConn
+		report     models.CellReport
+	)
+
+	serve := func(method string, body []byte) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "/cell_reports", bytes.NewBuffer(body))
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	BeforeEach(func() {
+		messageBus = fakeyagnats.Connect()
+		handler = handlers.NewCellReportsHandler(fakelogger.NewFakeLogger(), messageBus, "diego.cell_reports")
+
+		report = models.CellReport{
+			CellID: "cell-1",
+			ActualLRPs: []models.ActualLRP{
+				{ProcessGuid: "abc-def", Index: 0, State: models.ActualLRPStateRunning},
+			},
+		}
+	})
+
+	It("publishes the report on the cell reports subject", func() {
+		response := serve("POST", report.ToJSON())
+		Ω(response.Code).Should(Equal(http.StatusAccepted))
+
+		messages := messageBus.PublishedMessages("diego.cell_reports")
+		Ω(messages).Should(HaveLen(1))
+		Ω(models.NewCellReportFromJSON(messages[0].Data)).Should(Equal(report))
+	})
+
+	It("rejects reports it cannot decode", func() {
+		response := serve("POST", []byte(`{"actual_lrps": []}`))
+		Ω(response.Code).Should(Equal(http.StatusBadRequest))
+		Ω(messageBus.PublishedMessages("diego.cell_reports")).Should(BeEmpty())
+	})
+
+	It("only accepts POSTs", func() {
+		response := serve("GET", nil)
+		Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+	})
+
+	Context("when publishing fails", func() {
+		BeforeEach(func() {
+			messageBus.WhenPublishing("diego.cell_reports", func(*nats.Msg) error {
+				return errors.New("disconnected")
+			})
+		})
+
+		It("returns a 503", func() {
+			response := serve("POST", report.ToJSON())
+			Ω(response.Code).Should(Equal(http.StatusServiceUnavailable))
+		})
+	})
+})
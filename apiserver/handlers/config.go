@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+type configHandler struct {
+	logger logger.Logger
+	conf   *config.Config
+}
+
+// NewConfigHandler serves the API server's effective config, with
+// credentials redacted.
+func NewConfigHandler(logger logger.Logger, conf *config.Config) http.Handler {
+	return &configHandler{
+		logger: logger,
+		conf:   conf,
+	}
+}
+
+func (handler *configHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	settings, err := handler.conf.Effective()
+	if err != nil {
+		handler.logger.Error("Failed to handle config request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		handler.logger.Error("Failed to handle config request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	It("serves the effective config with credentials redacted", func() {
+		conf, err := config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+		conf.CCAuthPassword = "orangutan4sale"
+
+		handler := handlers.NewConfigHandler(fakelogger.NewFakeLogger(), conf)
+		request, _ := http.NewRequest("GET", "/config", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		settings := map[string]interface{}{}
+		Ω(json.Unmarshal(response.Body.Bytes(), &settings)).Should(Succeed())
+		Ω(settings["cc_auth_password"]).Should(Equal("[REDACTED]"))
+		Ω(settings["heartbeat_period_in_seconds"]).Should(Equal("10s"))
+	})
+
+	It("is routed to GET /config", func() {
+		conf, err := config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler, _, err := makeHandlerAndStore(defaultConf())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		request, _ := http.NewRequest("GET", "/config", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		settings := map[string]interface{}{}
+		Ω(json.Unmarshal(response.Body.Bytes(), &settings)).Should(Succeed())
+		Ω(settings["log_level"]).Should(Equal(conf.LogLevelString))
+	})
+})
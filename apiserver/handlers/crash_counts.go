@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+type resetCrashCountsHandler struct {
+	logger       logger.Logger
+	store        store.Store
+	timeProvider timeprovider.TimeProvider
+}
+
+type ResetCrashCountsResponse struct {
+	Reset       []models.CrashCount          `json:"reset"`
+	Rescheduled []models.PendingStartMessage `json:"rescheduled"`
+}
+
+// NewResetCrashCountsHandler forgets the crash counts, and so the restart
+// backoff, of an app's instances: of the indices given as index query
+// parameters, or of every index if there are none.  Each reset is logged for
+// audit with the user who asked for it and the note query parameter.
+func NewResetCrashCountsHandler(logger logger.Logger, store store.Store, timeProvider timeprovider.TimeProvider) http.Handler {
+	return &resetCrashCountsHandler{
+		logger:       logger,
+		store:        store,
+		timeProvider: timeProvider,
+	}
+}
+
+func (handler *resetCrashCountsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	appGuid := query.Get(":app_guid")
+	appVersion := query.Get(":app_version")
+
+	indices := []int{}
+	for _, value := range query["index"] {
+		index, err := strconv.Atoi(value)
+		if err != nil || index < 0 {
+			http.Error(w, "index must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		indices = append(indices, index)
+	}
+
+	reset, rescheduled, err := handler.store.ResetCrashCounts(appGuid, appVersion, indices, handler.timeProvider.Time())
+	if err != nil {
+		handler.logger.Error("Failed to reset crash counts", err, map[string]string{"AppGuid": appGuid, "AppVersion": appVersion})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	operator, _, _ := r.BasicAuth()
+	handler.logger.Info("Audit: crash counts reset", map[string]string{
+		"AppGuid":     appGuid,
+		"AppVersion":  appVersion,
+		"Indices":     describeIndices(indices),
+		"Reset":       strconv.Itoa(len(reset)),
+		"Rescheduled": strconv.Itoa(len(rescheduled)),
+		"Operator":    operator,
+		"RemoteAddr":  r.RemoteAddr,
+		"Note":        query.Get("note"),
+	})
+
+	body, _ := json.Marshal(ResetCrashCountsResponse{Reset: reset, Rescheduled: rescheduled})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func describeIndices(indices []int) string {
+	if len(indices) == 0 {
+		return "all"
+	}
+
+	described := []string{}
+	for _, index := range indices {
+		described = append(described, strconv.Itoa(index))
+	}
+	return strings.Join(described, ",")
+}
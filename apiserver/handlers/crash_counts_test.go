@@ -0,0 +1,109 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resetting crash counts", func() {
+	var (
+		conf    HandlerConf
+		handler http.Handler
+		store   store.Store
+		logger  *fakelogger.FakeLogger
+		app     appfixture.AppFixture
+	)
+
+	crashCount := func(index int, count int) models.CrashCount {
+		return models.CrashCount{AppGuid: app.AppGuid, AppVersion: app.AppVersion, InstanceIndex: index, CrashCount: count}
+	}
+
+	reset := func(query string) (*httptest.ResponseRecorder, handlers.ResetCrashCountsResponse) {
+		request, _ := http.NewRequest("DELETE", "/crash_counts/"+app.AppGuid+"/"+app.AppVersion+query, nil)
+		request.SetBasicAuth("operator-jo", "secret")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		decoded := handlers.ResetCrashCountsResponse{}
+		json.Unmarshal(response.Body.Bytes(), &decoded)
+		return response, decoded
+	}
+
+	crashCounts := func() map[int]models.CrashCount {
+		storedApp, err := store.GetApp(app.AppGuid, app.AppVersion)
+		Ω(err).ShouldNot(HaveOccurred())
+		return storedApp.CrashCounts
+	}
+
+	BeforeEach(func() {
+		var err error
+		logger = fakelogger.NewFakeLogger()
+		conf = defaultConf()
+		conf.Logger = logger
+		handler, store, err = makeHandlerAndStore(conf)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		app = appfixture.NewAppFixture()
+		store.SyncDesiredState(app.DesiredState(3))
+		store.SaveCrashCounts(crashCount(0, 4), crashCount(2, 7))
+	})
+
+	It("resets the crash counts of the given indices", func() {
+		response, decoded := reset("?index=2")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+		Ω(decoded.Reset).Should(Equal([]models.CrashCount{crashCount(2, 7)}))
+
+		Ω(crashCounts()).Should(Equal(map[int]models.CrashCount{0: crashCount(0, 4)}))
+	})
+
+	It("resets every index if none is given", func() {
+		_, decoded := reset("")
+		Ω(decoded.Reset).Should(Equal([]models.CrashCount{crashCount(0, 4), crashCount(2, 7)}))
+		Ω(crashCounts()).Should(BeEmpty())
+	})
+
+	It("brings forward the start messages that the backoff delayed", func() {
+		delayed := models.NewPendingStartMessage(time.Unix(0, 0), 900, 0, app.AppGuid, app.AppVersion, 2, 1.0, models.PendingStartMessageReasonCrashed)
+		store.SavePendingStartMessages(delayed)
+
+		_, decoded := reset("?index=2")
+		Ω(decoded.Rescheduled).Should(HaveLen(1))
+		Ω(decoded.Rescheduled[0].SendOn).Should(BeNumerically("==", 100))
+	})
+
+	It("logs who reset what, for audit", func() {
+		reset("?index=0&index=2&note=fixed+the+database")
+		Ω(logger.LoggedSubjects).Should(ContainElement("Audit: crash counts reset"))
+
+		message := logger.LoggedMessages[len(logger.LoggedMessages)-1]
+		Ω(message).Should(ContainSubstring(`"Operator":"operator-jo"`))
+		Ω(message).Should(ContainSubstring(`"Indices":"0,2"`))
+		Ω(message).Should(ContainSubstring(`"Note":"fixed the database"`))
+		Ω(message).Should(ContainSubstring(`"AppGuid":"` + app.AppGuid + `"`))
+	})
+
+	It("rejects an index that is not a number", func() {
+		response, _ := reset("?index=first")
+		Ω(response.Code).Should(Equal(http.StatusBadRequest))
+		Ω(crashCounts()).Should(HaveLen(2))
+	})
+
+	It("is only routed to DELETE", func() {
+		request, _ := http.NewRequest("GET", "/crash_counts/"+app.AppGuid+"/"+app.AppVersion, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		Ω(response.Code).ShouldNot(Equal(http.StatusOK))
+		Ω(crashCounts()).Should(HaveLen(2))
+	})
+})
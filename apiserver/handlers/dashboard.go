@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/apiserver"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/status"
+	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/tedsuo/rata"
+)
+
+const (
+	// DashboardRecentStarts is how many of the latest starts the dashboard
+	// lists.
+	DashboardRecentStarts = 20
+
+	// DashboardAppEvents is how many of an app's latest events its page
+	// lists.
+	DashboardAppEvents = 50
+)
+
+// NewDashboard serves a read-only dashboard for operators: an overview of
+// freshness, the pending message queues, the components, the latest starts
+// and the apps restarted too often, and a page for each app.  It only reads
+// what the rest of the API serves, and is meant to be wrapped in the API
+// user's basic auth.
+func NewDashboard(logger logger.Logger, store store.Store, timeProvider timeprovider.TimeProvider, conf *config.Config) (http.Handler, error) {
+	collector := status.New(store, timeProvider, conf)
+	handlers := map[string]http.Handler{
+		"dashboard":     &dashboardHandler{logger: logger, store: store, collector: collector, timeProvider: timeProvider},
+		"dashboard_app": &dashboardAppHandler{logger: logger, store: store, collector: collector, timeProvider: timeProvider},
+	}
+
+	return rata.NewRouter(apiserver.DashboardRoutes, handlers)
+}
+
+// RecentStart is a start the sender sent, as the dashboard lists it.
+type RecentStart struct {
+	AppGuid    string
+	AppVersion string
+	Index      int
+	Reason     models.PendingStartMessageReason
+	SentAt     time.Time
+}
+
+type dashboardPage struct {
+	Now           time.Time
+	Report        status.Report
+	RecentStarts  []RecentStart
+	RestartReport *models.RestartReport
+}
+
+type dashboardHandler struct {
+	logger       logger.Logger
+	store        store.Store
+	collector    *status.Collector
+	timeProvider timeprovider.TimeProvider
+}
+
+func (handler *dashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if appGuid := r.URL.Query().Get("app_guid"); appGuid != "" {
+		http.Redirect(w, r, "/dashboard/apps/"+url.QueryEscape(appGuid), http.StatusFound)
+		return
+	}
+
+	page := dashboardPage{Now: handler.timeProvider.Time()}
+
+	var err error
+	page.Report, err = handler.collector.Collect()
+	if err != nil {
+		handler.logger.Error("Failed to handle dashboard request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	histories, err := handler.store.GetRestartHistories()
+	if err != nil {
+		handler.logger.Error("Failed to handle dashboard request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	page.RecentStarts = recentStarts(histories, DashboardRecentStarts)
+
+	report, err := handler.store.GetRestartReport()
+	if err == nil {
+		page.RestartReport = &report
+	} else if err != storeadapter.ErrorKeyNotFound {
+		handler.logger.Error("Failed to handle dashboard request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	renderDashboard(handler.logger, w, "overview", page)
+}
+
+// recentStarts returns the latest limit starts in the restart histories,
+// newest first.
+func recentStarts(histories map[string]models.RestartHistory, limit int) []RecentStart {
+	starts := []RecentStart{}
+	for _, history := range histories {
+		for _, restart := range history.Restarts {
+			starts = append(starts, RecentStart{
+				AppGuid:    history.AppGuid,
+				AppVersion: history.AppVersion,
+				Index:      restart.Index,
+				Reason:     restart.Reason,
+				SentAt:     time.Unix(restart.SentAt, 0),
+			})
+		}
+	}
+
+	sort.Sort(recentStartsByNewest(starts))
+	if len(starts) > limit {
+		starts = starts[:limit]
+	}
+	return starts
+}
+
+type recentStartsByNewest []RecentStart
+
+func (starts recentStartsByNewest) Len() int      { return len(starts) }
+func (starts recentStartsByNewest) Swap(i, j int) { starts[i], starts[j] = starts[j], starts[i] }
+func (starts recentStartsByNewest) Less(i, j int) bool {
+	if !starts[i].SentAt.Equal(starts[j].SentAt) {
+		return starts[i].SentAt.After(starts[j].SentAt)
+	}
+	if starts[i].AppGuid != starts[j].AppGuid {
+		return starts[i].AppGuid < starts[j].AppGuid
+	}
+	return starts[i].Index < starts[j].Index
+}
+
+type dashboardAppPage struct {
+	Now     time.Time
+	AppGuid string
+	Reports []status.AppReport
+	Events  []models.AppEvent
+}
+
+type dashboardAppHandler struct {
+	logger       logger.Logger
+	store        store.Store
+	collector    *status.Collector
+	timeProvider timeprovider.TimeProvider
+}
+
+func (handler *dashboardAppHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	appGuid := r.URL.Query().Get(":app_guid")
+	page := dashboardAppPage{Now: handler.timeProvider.Time(), AppGuid: appGuid}
+
+	var err error
+	page.Reports, err = handler.collector.InspectApp(appGuid, "")
+	if err == store.AppNotFoundError {
+		page.Reports = []status.AppReport{}
+	} else if err != nil {
+		handler.logger.Error("Failed to handle dashboard app request", err, map[string]string{"AppGuid": appGuid})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	history, err := handler.store.GetAppHistory(appGuid)
+	if err != nil {
+		handler.logger.Error("Failed to handle dashboard app request", err, map[string]string{"AppGuid": appGuid})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	page.Events = history.Between(0, 0)
+	if len(page.Events) > DashboardAppEvents {
+		page.Events = page.Events[:DashboardAppEvents]
+	}
+
+	if len(page.Reports) == 0 && len(page.Events) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	renderDashboard(handler.logger, w, "app", page)
+}
+
+func renderDashboard(logger logger.Logger, w http.ResponseWriter, name string, page interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardTemplates.ExecuteTemplate(w, name, page)
+	if err != nil {
+		logger.Error("Failed to render dashboard", err, map[string]string{"Page": name})
+	}
+}
+
+var dashboardTemplates = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"timestamp": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04:05 MST")
+	},
+	"unix": func(seconds int64) time.Time {
+		return time.Unix(seconds, 0)
+	},
+	"round": func(d time.Duration) time.Duration {
+		return d - d%time.Second
+	},
+}).Parse(dashboardTemplateSource))
+
+const dashboardTemplateSource = `
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>HM9000{{if .}} - {{.}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #eee; }
+.alarm { color: #a00; font-weight: bold; }
+.ok { color: #070; }
+</style>
+{{end}}
+
+{{define "overview"}}{{template "header" ""}}<meta http-equiv="refresh" content="10">
+</head>
+<body>
+<h1>HM9000</h1>
+<p>As of {{timestamp .Now}}.</p>
+
+<form action="/dashboard" method="get">
+<label>App guid <input name="app_guid"></label> <input type="submit" value="Inspect">
+</form>
+
+<h2>Alarms</h2>
+{{with .Report.Alarms}}<ul>{{range .}}<li class="alarm">{{.}}</li>{{end}}</ul>{{else}}<p class="ok">None.</p>{{end}}
+
+<h2>Freshness</h2>
+<table>
+<tr><th>State</th><th>Fresh</th><th>Age</th><th>TTL</th></tr>
+<tr><td>Desired</td><td>{{.Report.DesiredFreshness.Fresh}}</td><td>{{if .Report.DesiredFreshness.Present}}{{round .Report.DesiredFreshness.Age}}{{else}}never fresh{{end}}</td><td>{{.Report.DesiredFreshness.TTL}}</td></tr>
+<tr><td>Actual</td><td>{{.Report.ActualFreshness.Fresh}}</td><td>{{if .Report.ActualFreshness.Present}}{{round .Report.ActualFreshness.Age}}{{else}}never fresh{{end}}</td><td>{{.Report.ActualFreshness.TTL}}</td></tr>
+</table>
+
+<h2>Queues</h2>
+<table>
+<tr><th>Messages</th><th>Pending</th><th>Ready to send</th></tr>
+<tr><td>Start</td><td>{{.Report.PendingStarts}}</td><td>{{.Report.PendingStartsReady}}</td></tr>
+<tr><td>Stop</td><td>{{.Report.PendingStops}}</td><td>{{.Report.PendingStopsReady}}</td></tr>
+</table>
+
+<h2>Apps</h2>
+<table>
+<tr><th>Desired apps</th><th>Desired instances</th><th>Running instances</th><th>Crashed instances</th></tr>
+<tr><td>{{.Report.DesiredApps}}</td><td>{{.Report.DesiredInstances}}</td><td>{{.Report.RunningInstances}}</td><td>{{.Report.CrashedInstances}}</td></tr>
+</table>
+
+<h2>Components</h2>
+<table>
+<tr><th>Component</th><th>Leader</th><th>Last run</th><th>Took</th><th>Error</th><th>Control</th></tr>
+{{range .Report.Components}}<tr><td>{{.Name}}</td><td>{{if .Electing}}{{.Leader}}{{end}}</td><td>{{if .LastRun}}{{round .SinceLastRun}} ago{{else}}never{{end}}</td><td>{{with .LastRun}}{{.DurationInMilliseconds}}ms{{end}}</td><td>{{with .LastRun}}{{.Error}}{{end}}</td><td>{{with .Control}}{{if .Paused}}paused{{end}}{{end}}</td></tr>
+{{end}}</table>
+
+<h2>Recent starts</h2>
+{{with .RecentStarts}}<table>
+<tr><th>Sent</th><th>App</th><th>Version</th><th>Index</th><th>Reason</th></tr>
+{{range .}}<tr><td>{{timestamp .SentAt}}</td><td><a href="/dashboard/apps/{{.AppGuid}}">{{.AppGuid}}</a></td><td>{{.AppVersion}}</td><td>{{.Index}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+
+<h2>Apps restarted too often</h2>
+{{with .RestartReport}}{{with .Apps}}<table>
+<tr><th>App</th><th>Version</th><th>Restarts</th><th>Last restarted</th><th>Last reasons</th></tr>
+{{range .}}<tr><td><a href="/dashboard/apps/{{.AppGuid}}">{{.AppGuid}}</a></td><td>{{.AppVersion}}</td><td>{{.Restarts}}</td><td>{{timestamp (unix .LastRestartedAt)}}</td><td>{{range $i, $reason := .LastReasons}}{{if $i}}, {{end}}{{$reason}}{{end}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}{{else}}<p>No restart report yet.</p>{{end}}
+</body>
+</html>
+{{end}}
+
+{{define "app"}}{{template "header" .AppGuid}}</head>
+<body>
+<p><a href="/dashboard">Overview</a></p>
+<h1>App {{.AppGuid}}</h1>
+<p>As of {{timestamp .Now}}.</p>
+
+{{range .Reports}}<h2>Version {{.AppVersion}}</h2>
+{{with .Desired}}<p>Desired: {{.NumberOfInstances}} instances, {{.State}}, package {{.PackageState}}{{if .Unmanaged}}, unmanaged{{end}}.</p>{{else}}<p>Not desired.</p>{{end}}
+
+{{with .Instances}}<table>
+<tr><th>Index</th><th>Instance</th><th>State</th><th>For</th><th>DEA</th><th>Crashes</th></tr>
+{{range .}}<tr><td>{{.Index}}</td><td>{{.InstanceGuid}}</td><td>{{.State}}</td><td>{{round .Uptime}}</td><td>{{.DeaGuid}}</td><td>{{.CrashCount}}</td></tr>
+{{end}}</table>{{else}}<p>No instances.</p>{{end}}
+
+{{with .PendingStarts}}<h3>Pending starts</h3>
+<table>
+<tr><th>Index</th><th>Reason</th><th>Send on</th><th>Sent on</th></tr>
+{{range .}}<tr><td>{{.IndexToStart}}</td><td>{{.StartReason}}</td><td>{{timestamp (unix .SendOn)}}</td><td>{{if .SentOn}}{{timestamp (unix .SentOn)}}{{end}}</td></tr>
+{{end}}</table>{{end}}
+
+{{with .PendingStops}}<h3>Pending stops</h3>
+<table>
+<tr><th>Instance</th><th>Reason</th><th>Send on</th><th>Sent on</th></tr>
+{{range .}}<tr><td>{{.InstanceGuid}}</td><td>{{.StopReason}}</td><td>{{timestamp (unix .SendOn)}}</td><td>{{if .SentOn}}{{timestamp (unix .SentOn)}}{{end}}</td></tr>
+{{end}}</table>{{end}}
+
+<h3>What the analyzer would do now</h3>
+{{if not .Fresh}}<p class="alarm">The store is not fresh, so the analyzer would do nothing.</p>{{end}}
+<ul>{{range .Explanation.Steps}}<li>{{.}}</li>{{end}}</ul>
+{{else}}<p>HM9000 knows of no version of this app.</p>
+{{end}}
+
+<h2>History</h2>
+{{with .Events}}<table>
+<tr><th>When</th><th>Event</th><th>Version</th><th>Details</th></tr>
+{{range .}}<tr><td>{{timestamp (unix .Timestamp)}}</td><td>{{.Type}}{{with .Description}}: {{.}}{{end}}</td><td>{{.AppVersion}}</td><td>{{range $key, $value := .Details}}{{$key}}={{$value}} {{end}}</td></tr>
+{{end}}</table>{{else}}<p>No history.</p>{{end}}
+</body>
+</html>
+{{end}}
+`
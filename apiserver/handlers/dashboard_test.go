@@ -0,0 +1,100 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	. "github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dashboard", func() {
+	var (
+		handler      http.Handler
+		store        storepackage.Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		app          appfixture.AppFixture
+	)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		conf.AppHistoryMaxEvents = 10
+		storeAdapter = fakestoreadapter.New()
+		store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		app = appfixture.NewAppFixture()
+
+		var err error
+		handler, err = NewDashboard(fakelogger.NewFakeLogger(), store, &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(200, 0)}, conf)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Describe("the overview", func() {
+		It("shows the alarms, queues and recent starts", func() {
+			store.SavePendingStopMessages(models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, "instance", models.PendingStopMessageReasonExtra))
+			store.RecordRestarts(time.Unix(150, 0), models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonCrashed))
+			store.RecordRestarts(time.Unix(160, 0), models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 1, 1.0, models.PendingStartMessageReasonMissing))
+
+			response := get("/dashboard")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+			Ω(response.Header().Get("Content-Type")).Should(Equal("text/html; charset=utf-8"))
+
+			body := response.Body.String()
+			Ω(body).Should(ContainSubstring("Desired state is not fresh"))
+			Ω(body).Should(ContainSubstring("<tr><td>Stop</td><td>1</td><td>1</td></tr>"))
+			Ω(body).Should(ContainSubstring(`<a href="/dashboard/apps/` + app.AppGuid + `">`))
+			Ω(strings.Index(body, string(models.PendingStartMessageReasonMissing))).Should(BeNumerically("<", strings.Index(body, string(models.PendingStartMessageReasonCrashed))))
+			Ω(body).Should(ContainSubstring("No restart report yet."))
+		})
+
+		It("sends an app guid looked up to the app's page", func() {
+			response := get("/dashboard?app_guid=" + app.AppGuid)
+			Ω(response.Code).Should(Equal(http.StatusFound))
+			Ω(response.Header().Get("Location")).Should(Equal("/dashboard/apps/" + app.AppGuid))
+		})
+
+		It("responds 500 when the store fails", func() {
+			storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("start", errors.New("oops"))
+			Ω(get("/dashboard").Code).Should(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	Describe("an app's page", func() {
+		It("shows the app's instances and history", func() {
+			store.SyncDesiredState(app.DesiredState(1))
+			store.SyncHeartbeats(app.Heartbeat(1))
+			store.RecordAppEvents(time.Unix(150, 0), models.NewStartSentEvent(models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing), time.Unix(150, 0)))
+
+			response := get("/dashboard/apps/" + app.AppGuid)
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			body := response.Body.String()
+			Ω(body).Should(ContainSubstring("Version " + app.AppVersion))
+			Ω(body).Should(ContainSubstring(app.InstanceAtIndex(0).InstanceGuid))
+			Ω(body).Should(ContainSubstring("start_sent"))
+		})
+
+		It("responds 404 for an app hm9000 knows nothing of", func() {
+			response := get("/dashboard/apps/nonexistent")
+			Ω(response.Code).Should(Equal(http.StatusNotFound))
+			Ω(response.Body.String()).Should(ContainSubstring("knows of no version of this app"))
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+type deaInstancesHandler struct {
+	logger       logger.Logger
+	store        store.Store
+	timeProvider timeprovider.TimeProvider
+}
+
+type DeaInstancesResponse struct {
+	DeaGuid   string                     `json:"dea"`
+	Instances []models.InstanceHeartbeat `json:"instances"`
+}
+
+// NewDeaInstancesHandler serves every instance a DEA last reported, by app
+// guid, version and index, for drain tooling and capacity audits.  It
+// answers 503 while the actual state is not fresh, as the instances may
+// then be out of date.
+func NewDeaInstancesHandler(logger logger.Logger, store store.Store, timeProvider timeprovider.TimeProvider) http.Handler {
+	return &deaInstancesHandler{
+		logger:       logger,
+		store:        store,
+		timeProvider: timeProvider,
+	}
+}
+
+func (handler *deaInstancesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	deaGuid := r.URL.Query().Get(":dea_guid")
+
+	fresh, err := handler.store.IsActualStateFresh(handler.timeProvider.Time())
+	if err != nil {
+		handler.logger.Error("Failed to handle dea instances request", err, map[string]string{"DeaGuid": deaGuid})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !fresh {
+		http.Error(w, store.ActualIsNotFreshError.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	instanceHeartbeats, err := handler.store.GetInstanceHeartbeats()
+	if err != nil {
+		handler.logger.Error("Failed to handle dea instances request", err, map[string]string{"DeaGuid": deaGuid})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := DeaInstancesResponse{
+		DeaGuid:   deaGuid,
+		Instances: []models.InstanceHeartbeat{},
+	}
+	for _, instanceHeartbeat := range instanceHeartbeats {
+		if instanceHeartbeat.DeaGuid == deaGuid {
+			response.Instances = append(response.Instances, instanceHeartbeat)
+		}
+	}
+	sort.Sort(byAppAndIndex(response.Instances))
+
+	body, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+type byAppAndIndex []models.InstanceHeartbeat
+
+func (instances byAppAndIndex) Len() int { return len(instances) }
+func (instances byAppAndIndex) Swap(i, j int) {
+	instances[i], instances[j] = instances[j], instances[i]
+}
+func (instances byAppAndIndex) Less(i, j int) bool {
+	if instances[i].AppGuid != instances[j].AppGuid {
+		return instances[i].AppGuid < instances[j].AppGuid
+	}
+	if instances[i].AppVersion != instances[j].AppVersion {
+		return instances[i].AppVersion < instances[j].AppVersion
+	}
+	if instances[i].InstanceIndex != instances[j].InstanceIndex {
+		return instances[i].InstanceIndex < instances[j].InstanceIndex
+	}
+	return instances[i].InstanceGuid < instances[j].InstanceGuid
+}
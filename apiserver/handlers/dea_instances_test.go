@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DEA instances", func() {
+	var (
+		handler      http.Handler
+		store        store.Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		dea          appfixture.DeaFixture
+		otherDea     appfixture.DeaFixture
+		crashed      models.InstanceHeartbeat
+	)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	BeforeEach(func() {
+		conf := defaultConf()
+		storeAdapter = conf.StoreAdapter
+
+		var err error
+		handler, store, err = makeHandlerAndStore(conf)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		dea = appfixture.NewDeaFixture()
+		otherDea = appfixture.NewDeaFixture()
+		crashed = dea.GetApp(1).CrashedInstanceHeartbeatAtIndex(0)
+		store.SyncHeartbeats(
+			dea.HeartbeatWith(
+				dea.GetApp(0).InstanceAtIndex(1).Heartbeat(),
+				dea.GetApp(0).InstanceAtIndex(0).Heartbeat(),
+				crashed,
+			),
+			otherDea.HeartbeatWith(otherDea.GetApp(0).InstanceAtIndex(0).Heartbeat()),
+		)
+		store.BumpActualFreshness(time.Unix(0, 0))
+	})
+
+	It("should return every instance on the DEA, by app and index", func() {
+		response := get("/deas/" + dea.DeaGuid + "/instances")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		decoded := DeaInstancesResponse{}
+		Ω(json.Unmarshal(response.Body.Bytes(), &decoded)).Should(Succeed())
+		Ω(decoded.DeaGuid).Should(Equal(dea.DeaGuid))
+		Ω(decoded.Instances).Should(HaveLen(3))
+		Ω(decoded.Instances).Should(ContainElement(crashed))
+
+		app := dea.GetApp(0)
+		appInstances := []models.InstanceHeartbeat{}
+		for _, instance := range decoded.Instances {
+			if instance.AppGuid == app.AppGuid {
+				appInstances = append(appInstances, instance)
+			}
+		}
+		Ω(appInstances).Should(Equal([]models.InstanceHeartbeat{
+			app.InstanceAtIndex(0).Heartbeat(),
+			app.InstanceAtIndex(1).Heartbeat(),
+		}))
+	})
+
+	It("should return no instances for a DEA it has not heard from", func() {
+		response := get("/deas/unknown-dea/instances")
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Body.String()).Should(MatchJSON(`{"dea": "unknown-dea", "instances": []}`))
+	})
+
+	It("should return 503 when the actual state is not fresh", func() {
+		store.RevokeActualFreshness()
+		response := get("/deas/" + dea.DeaGuid + "/instances")
+		Ω(response.Code).Should(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("should return 500 when the store fails", func() {
+		storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("actual", errors.New("oops"))
+		response := get("/deas/" + dea.DeaGuid + "/instances")
+		Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+	})
+})
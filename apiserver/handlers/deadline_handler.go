@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestDeadlines gives each request timeout to be answered in, and lets
+// no more than maxInFlight run at once.  A request given up on keeps its
+// place until it is done with the store, so that requests slower than the
+// timeout cannot pile up.
+type RequestDeadlines struct {
+	timeout time.Duration
+	slots   chan struct{}
+
+	timedOut  int
+	abandoned int
+	inFlight  int
+	lock      *sync.Mutex
+}
+
+// NewRequestDeadlines lets any number of requests run at once when
+// maxInFlight is 0.
+func NewRequestDeadlines(timeout time.Duration, maxInFlight int) *RequestDeadlines {
+	deadlines := &RequestDeadlines{
+		timeout: timeout,
+		lock:    &sync.Mutex{},
+	}
+	if maxInFlight > 0 {
+		deadlines.slots = make(chan struct{}, maxInFlight)
+	}
+	return deadlines
+}
+
+// Counts returns how many requests timed out, and how many were abandoned
+// before they ran, since the last call, and how many are running now.
+func (deadlines *RequestDeadlines) Counts() (timedOut int, abandoned int, inFlight int) {
+	deadlines.lock.Lock()
+	defer deadlines.lock.Unlock()
+
+	timedOut, abandoned, inFlight = deadlines.timedOut, deadlines.abandoned, deadlines.inFlight
+	deadlines.timedOut = 0
+	deadlines.abandoned = 0
+	return timedOut, abandoned, inFlight
+}
+
+// acquire waits for a place for a request until expired fires.
+func (deadlines *RequestDeadlines) acquire(expired <-chan time.Time) bool {
+	if deadlines.slots != nil {
+		select {
+		case deadlines.slots <- struct{}{}:
+		case <-expired:
+			deadlines.count(&deadlines.abandoned, 1)
+			return false
+		}
+	}
+	deadlines.count(&deadlines.inFlight, 1)
+	return true
+}
+
+func (deadlines *RequestDeadlines) release() {
+	deadlines.count(&deadlines.inFlight, -1)
+	if deadlines.slots != nil {
+		<-deadlines.slots
+	}
+}
+
+func (deadlines *RequestDeadlines) count(counter *int, delta int) {
+	deadlines.lock.Lock()
+	*counter += delta
+	deadlines.lock.Unlock()
+}
+
+// DeadlineWrap answers with a 503 Service Unavailable the requests handler
+// has not answered by their deadline, including those that waited for
+// their turn past it, which handler never sees: their requester has given
+// up on them already.
+func DeadlineWrap(handler http.Handler, deadlines *RequestDeadlines) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timer := time.NewTimer(deadlines.timeout)
+		defer timer.Stop()
+
+		if !deadlines.acquire(timer.C) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		response := newBufferedResponse()
+		done := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				panicked := recover()
+				deadlines.release()
+				done <- panicked
+			}()
+			handler.ServeHTTP(response, r)
+		}()
+
+		select {
+		case panicked := <-done:
+			if panicked != nil {
+				panic(panicked)
+			}
+			response.copyTo(w)
+		case <-timer.C:
+			deadlines.count(&deadlines.timedOut, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// bufferedResponse holds a response until it is known to be in time.
+type bufferedResponse struct {
+	header      http.Header
+	code        int
+	wroteHeader bool
+	body        *bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{
+		header: http.Header{},
+		code:   http.StatusOK,
+		body:   &bytes.Buffer{},
+	}
+}
+
+func (response *bufferedResponse) Header() http.Header {
+	return response.header
+}
+
+func (response *bufferedResponse) Write(data []byte) (int, error) {
+	response.wroteHeader = true
+	return response.body.Write(data)
+}
+
+func (response *bufferedResponse) WriteHeader(code int) {
+	if response.wroteHeader {
+		return
+	}
+	response.code = code
+	response.wroteHeader = true
+}
+
+func (response *bufferedResponse) copyTo(w http.ResponseWriter) {
+	for name, values := range response.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(response.code)
+	w.Write(response.body.Bytes())
+}
@@ -0,0 +1,108 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/apiserver/handlers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DeadlineWrap", func() {
+	var (
+		deadlines *handlers.RequestDeadlines
+		handler   http.Handler
+		release   chan struct{}
+		served    chan struct{}
+	)
+
+	serve := func() *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", "/version", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	BeforeEach(func() {
+		// The handlers given up on outlive their test, so they keep their
+		// own channels.
+		releaseRequests := make(chan struct{})
+		servedRequests := make(chan struct{}, 10)
+		release, served = releaseRequests, servedRequests
+
+		deadlines = handlers.NewRequestDeadlines(50*time.Millisecond, 1)
+		handler = handlers.DeadlineWrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			servedRequests <- struct{}{}
+			<-releaseRequests
+			w.Header().Set("X-Answered", "yes")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("answer"))
+		}), deadlines)
+	})
+
+	AfterEach(func() {
+		close(release)
+	})
+
+	It("answers as the handler does when it is in time", func() {
+		go func() {
+			<-served
+			release <- struct{}{}
+		}()
+
+		response := serve()
+		Ω(response.Code).Should(Equal(http.StatusCreated))
+		Ω(response.Header().Get("X-Answered")).Should(Equal("yes"))
+		Ω(response.Body.String()).Should(Equal("answer"))
+
+		timedOut, abandoned, _ := deadlines.Counts()
+		Ω(timedOut).Should(BeZero())
+		Ω(abandoned).Should(BeZero())
+	})
+
+	It("answers with a 503 when the handler is not done by the deadline, and counts it", func() {
+		response := serve()
+		Ω(response.Code).Should(Equal(http.StatusServiceUnavailable))
+		Ω(response.Header().Get("X-Answered")).Should(BeEmpty())
+
+		timedOut, abandoned, inFlight := deadlines.Counts()
+		Ω(timedOut).Should(Equal(1))
+		Ω(abandoned).Should(BeZero())
+		Ω(inFlight).Should(Equal(1))
+
+		timedOut, _, _ = deadlines.Counts()
+		Ω(timedOut).Should(BeZero())
+	})
+
+	It("abandons, without running them, the requests that wait for their turn past the deadline", func() {
+		Ω(serve().Code).Should(Equal(http.StatusServiceUnavailable))
+		Ω(served).Should(HaveLen(1))
+		<-served
+
+		Ω(serve().Code).Should(Equal(http.StatusServiceUnavailable))
+		Ω(served).Should(BeEmpty())
+
+		_, abandoned, inFlight := deadlines.Counts()
+		Ω(abandoned).Should(Equal(1))
+		Ω(inFlight).Should(Equal(1))
+	})
+
+	It("lets the next request run once the one given up on is done", func() {
+		Ω(serve().Code).Should(Equal(http.StatusServiceUnavailable))
+		<-served
+		release <- struct{}{}
+
+		Eventually(func() int {
+			_, _, inFlight := deadlines.Counts()
+			return inFlight
+		}).Should(BeZero())
+
+		go func() {
+			<-served
+			release <- struct{}{}
+		}()
+		Ω(serve().Code).Should(Equal(http.StatusCreated))
+	})
+})
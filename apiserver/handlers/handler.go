@@ -5,14 +5,25 @@ import (
 
 	"github.com/cloudfoundry/gunk/timeprovider"
 	"github.com/cloudfoundry/hm9000/apiserver"
+	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
 	"github.com/cloudfoundry/hm9000/store"
 	"github.com/tedsuo/rata"
 )
 
-func New(logger logger.Logger, store store.Store, timeProvider timeprovider.TimeProvider) (http.Handler, error) {
+func New(logger logger.Logger, store store.Store, timeProvider timeprovider.TimeProvider, conf *config.Config, pendingMessages *PendingMessageScanner) (http.Handler, error) {
 	handlers := map[string]http.Handler{
-		"bulk_app_state": NewBulkAppStateHandler(logger, store, timeProvider),
+		"analysis_report":   NewAnalysisReportHandler(logger, store),
+		"app_history":       NewAppHistoryHandler(logger, store),
+		"app_summary":       NewAppSummaryHandler(logger, store),
+		"bulk_app_state":    NewBulkAppStateHandler(logger, store, timeProvider, conf),
+		"config":            NewConfigHandler(logger, conf),
+		"crash_counts":      NewResetCrashCountsHandler(logger, store, timeProvider),
+		"dea_instances":     NewDeaInstancesHandler(logger, store, timeProvider),
+		"pending_messages":  NewPendingMessagesHandler(pendingMessages),
+		"restart_report":    NewRestartReportHandler(logger, store),
+		"suppressed_starts": NewSuppressedStartsHandler(logger, store),
+		"version":           NewVersionHandler(logger),
 	}
 
 	return rata.NewRouter(apiserver.Routes, handlers)
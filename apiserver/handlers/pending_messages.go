@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+// PendingMessageScanner keeps the distribution of the pending messages in
+// the store as of its latest Scan, so that dashboards polling it do not
+// each read every pending message.
+type PendingMessageScanner struct {
+	logger       logger.Logger
+	store        store.Store
+	timeProvider timeprovider.TimeProvider
+
+	distribution *models.PendingMessageDistribution
+	lock         *sync.Mutex
+}
+
+func NewPendingMessageScanner(logger logger.Logger, store store.Store, timeProvider timeprovider.TimeProvider) *PendingMessageScanner {
+	return &PendingMessageScanner{
+		logger:       logger,
+		store:        store,
+		timeProvider: timeProvider,
+		lock:         &sync.Mutex{},
+	}
+}
+
+// Scan reads the pending messages and replaces the distribution.  On error
+// the previous distribution is kept.
+func (scanner *PendingMessageScanner) Scan() error {
+	starts, err := scanner.store.GetPendingStartMessages()
+	if err != nil {
+		scanner.logger.Error("Failed to scan the pending start messages", err)
+		return err
+	}
+
+	stops, err := scanner.store.GetPendingStopMessages()
+	if err != nil {
+		scanner.logger.Error("Failed to scan the pending stop messages", err)
+		return err
+	}
+
+	distribution := models.NewPendingMessageDistribution(scanner.timeProvider.Time(), starts, stops)
+
+	scanner.lock.Lock()
+	scanner.distribution = &distribution
+	scanner.lock.Unlock()
+	return nil
+}
+
+// Distribution returns the distribution found by the latest successful
+// Scan, and false before there has been one.
+func (scanner *PendingMessageScanner) Distribution() (models.PendingMessageDistribution, bool) {
+	scanner.lock.Lock()
+	defer scanner.lock.Unlock()
+
+	if scanner.distribution == nil {
+		return models.PendingMessageDistribution{}, false
+	}
+	return *scanner.distribution, true
+}
+
+type pendingMessagesHandler struct {
+	scanner *PendingMessageScanner
+}
+
+// NewPendingMessagesHandler serves the distribution of the pending messages
+// that scanner last found.
+func NewPendingMessagesHandler(scanner *PendingMessageScanner) http.Handler {
+	return &pendingMessagesHandler{
+		scanner: scanner,
+	}
+}
+
+func (handler *pendingMessagesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	distribution, scanned := handler.scanner.Distribution()
+	if !scanned {
+		http.Error(w, "The pending messages have not been scanned yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(distribution.ToJSON())
+}
@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pending messages", func() {
+	var (
+		handler      http.Handler
+		scanner      *handlers.PendingMessageScanner
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		store        storepackage.Store
+		timeProvider *faketimeprovider.FakeTimeProvider
+	)
+
+	get := func() *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", "/pending_messages", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		timeProvider = &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}
+		scanner = handlers.NewPendingMessageScanner(fakelogger.NewFakeLogger(), store, timeProvider)
+
+		var err error
+		handler, err = handlers.New(fakelogger.NewFakeLogger(), store, timeProvider, conf, scanner)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		store.SavePendingStartMessages(
+			models.NewPendingStartMessage(time.Unix(100, 0), 0, 10, "a", "version", 0, 1, models.PendingStartMessageReasonCrashed),
+			models.NewPendingStartMessage(time.Unix(100, 0), 30, 10, "b", "version", 0, 1, models.PendingStartMessageReasonMissing),
+		)
+		store.SavePendingStopMessages(
+			models.NewPendingStopMessage(time.Unix(100, 0), 0, 10, "c", "version", "instance", models.PendingStopMessageReasonExtra),
+		)
+	})
+
+	It("serves the distribution of the pending messages the latest scan found", func() {
+		Ω(scanner.Scan()).Should(Succeed())
+
+		response := get()
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		distribution, err := models.NewPendingMessageDistributionFromJSON(response.Body.Bytes())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(distribution).Should(Equal(models.PendingMessageDistribution{
+			ScannedAt: 100,
+			Total:     3,
+			Counts: []models.PendingMessageCount{
+				{State: models.PendingMessageStatePending, Type: "start", Reason: "MISSING", Count: 1},
+				{State: models.PendingMessageStateReady, Type: "start", Reason: "CRASHED", Count: 1},
+				{State: models.PendingMessageStateReady, Type: "stop", Reason: "EXTRA", Count: 1},
+			},
+		}))
+	})
+
+	It("responds 503 before the first scan", func() {
+		Ω(get().Code).Should(Equal(http.StatusServiceUnavailable))
+	})
+
+	Context("when a scan fails", func() {
+		It("keeps serving the previous distribution", func() {
+			scanner.Scan()
+			storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("stop", errors.New("oops"))
+			timeProvider.IncrementBySeconds(10)
+
+			Ω(scanner.Scan()).Should(Equal(errors.New("oops")))
+
+			distribution, _ := models.NewPendingMessageDistributionFromJSON(get().Body.Bytes())
+			Ω(distribution.ScannedAt).Should(BeNumerically("==", 100))
+		})
+	})
+})
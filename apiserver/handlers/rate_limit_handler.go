@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/cloudfoundry/hm9000/helpers/ratelimiter"
+)
+
+const statusTooManyRequests = 429
+
+// RateLimitWrap turns away, with a 429 and a Retry-After, the requests of
+// requesters that have used up their share of limiter.  Requesters are told
+// apart as Requester tells them, believing X-Forwarded-For only from
+// trustedProxies.
+func RateLimitWrap(handler http.Handler, limiter *ratelimiter.RateLimiter, trustedProxies []*net.IPNet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.Allow(Requester(r, trustedProxies)) {
+			retryAfter := int(math.Ceil(limiter.RetryAfter().Seconds()))
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+			w.WriteHeader(statusTooManyRequests)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Requester identifies who made a request by the address it came from.  When
+// that is one of trustedProxies, it is the last address in X-Forwarded-For
+// that is not: each trusted proxy appends the address it was connected from,
+// and anything before the first untrusted one could have been made up by the
+// requester.
+func Requester(r *http.Request, trustedProxies []*net.IPNet) string {
+	requester, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		requester = r.RemoteAddr
+	}
+	if !isTrustedProxy(requester, trustedProxies) {
+		return requester
+	}
+
+	forwardedFor := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwardedFor[i])
+		if address == "" {
+			continue
+		}
+		requester = address
+		if !isTrustedProxy(address, trustedProxies) {
+			break
+		}
+	}
+	return requester
+}
+
+func isTrustedProxy(address string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/helpers/ratelimiter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimitWrap", func() {
+	var (
+		handler http.Handler
+		limiter *ratelimiter.RateLimiter
+		served  int
+	)
+
+	serve := func(remoteAddr string, forwardedFor string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", "/version", nil)
+		request.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			request.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	BeforeEach(func() {
+		served = 0
+		limiter = ratelimiter.New(&faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}, 2, 2, 0)
+		_, routers, _ := net.ParseCIDR("10.0.0.0/24")
+		handler = handlers.RateLimitWrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served++
+		}), limiter, []*net.IPNet{routers})
+	})
+
+	It("serves requests within the limit", func() {
+		Ω(serve("10.0.0.1:5000", "").Code).Should(Equal(http.StatusOK))
+		Ω(serve("10.0.0.1:5001", "").Code).Should(Equal(http.StatusOK))
+		Ω(served).Should(Equal(2))
+	})
+
+	It("turns away the requests over the limit, saying when to retry", func() {
+		serve("10.0.0.1:5000", "")
+		serve("10.0.0.1:5000", "")
+
+		response := serve("10.0.0.1:5000", "")
+		Ω(response.Code).Should(Equal(429))
+		Ω(response.Header().Get("Retry-After")).Should(Equal("1"))
+		Ω(served).Should(Equal(2))
+		Ω(limiter.Rejections()).Should(Equal(map[string]int{"10.0.0.1": 1}))
+	})
+
+	It("limits each requester separately", func() {
+		serve("10.0.0.1:5000", "")
+		serve("10.0.0.1:5000", "")
+
+		Ω(serve("10.0.0.2:5000", "").Code).Should(Equal(http.StatusOK))
+	})
+
+	It("tells the requesters behind a trusted router apart by X-Forwarded-For", func() {
+		serve("10.0.0.1:5000", "192.168.0.1, 10.0.0.2")
+		serve("10.0.0.1:5000", "192.168.0.1, 10.0.0.2")
+
+		Ω(serve("10.0.0.1:5000", "192.168.0.2, 10.0.0.2").Code).Should(Equal(http.StatusOK))
+		Ω(serve("10.0.0.1:5000", "192.168.0.1, 10.0.0.2").Code).Should(Equal(429))
+		Ω(limiter.Rejections()).Should(Equal(map[string]int{"192.168.0.1": 1}))
+	})
+
+	It("ignores X-Forwarded-For from requesters that are not trusted routers", func() {
+		serve("192.168.0.1:5000", "172.16.0.1")
+		serve("192.168.0.1:5000", "172.16.0.2")
+
+		Ω(serve("192.168.0.1:5000", "172.16.0.3").Code).Should(Equal(429))
+		Ω(limiter.Rejections()).Should(Equal(map[string]int{"192.168.0.1": 1}))
+	})
+
+	It("takes the last address in X-Forwarded-For that is not a trusted router, whatever comes before it", func() {
+		serve("10.0.0.1:5000", "1.1.1.1, 192.168.0.1")
+		serve("10.0.0.1:5000", "2.2.2.2, 192.168.0.1")
+
+		Ω(serve("10.0.0.1:5000", "3.3.3.3, 192.168.0.1").Code).Should(Equal(429))
+		Ω(limiter.Rejections()).Should(Equal(map[string]int{"192.168.0.1": 1}))
+	})
+
+	It("takes the router itself when X-Forwarded-For is missing", func() {
+		Ω(handlers.Requester(&http.Request{RemoteAddr: "10.0.0.1:5000", Header: http.Header{}}, nil)).Should(Equal("10.0.0.1"))
+	})
+})
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+type restartReportHandler struct {
+	logger logger.Logger
+	store  store.Store
+}
+
+// NewRestartReportHandler serves the latest restart report: the apps
+// restarted more than restart_report_threshold times in the restart report
+// window, as the sender last saw them.
+func NewRestartReportHandler(logger logger.Logger, store store.Store) http.Handler {
+	return &restartReportHandler{
+		logger: logger,
+		store:  store,
+	}
+}
+
+func (handler *restartReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report, err := handler.store.GetRestartReport()
+	if err == storeadapter.ErrorKeyNotFound {
+		http.Error(w, "No restart report yet", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		handler.logger.Error("Failed to handle restart_report request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(report.ToJSON())
+}
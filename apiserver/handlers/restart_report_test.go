@@ -0,0 +1,48 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Restart report", func() {
+	var (
+		handler http.Handler
+		store   store.Store
+	)
+
+	get := func() *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", "/restart_report", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	BeforeEach(func() {
+		var err error
+		handler, store, err = makeHandlerAndStore(defaultConf())
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("serves the latest restart report", func() {
+		report := models.RestartReport{GeneratedAt: 100, Threshold: 10, Apps: []models.RestartedApp{{AppGuid: "a", AppVersion: "b", Restarts: 11}}}
+		store.SaveRestartReport(report)
+
+		response := get()
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		served, err := models.NewRestartReportFromJSON(response.Body.Bytes())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(served).Should(Equal(report))
+	})
+
+	It("responds 404 before there is a report", func() {
+		Ω(get().Code).Should(Equal(http.StatusNotFound))
+	})
+})
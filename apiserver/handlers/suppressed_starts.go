@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+type suppressedStartsHandler struct {
+	logger logger.Logger
+	store  store.Store
+}
+
+type SuppressedStartsResponse struct {
+	SuppressedStarts []models.SuppressedStart `json:"suppressed_starts"`
+}
+
+// NewSuppressedStartsHandler serves the starts the analyzer held back during
+// maintenance windows, most recently held back first, for review once the
+// maintenance is over.
+func NewSuppressedStartsHandler(logger logger.Logger, store store.Store) http.Handler {
+	return &suppressedStartsHandler{
+		logger: logger,
+		store:  store,
+	}
+}
+
+func (handler *suppressedStartsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	suppressedStarts, err := handler.store.GetSuppressedStarts()
+	if err != nil {
+		handler.logger.Error("Failed to handle suppressed_starts request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := SuppressedStartsResponse{SuppressedStarts: []models.SuppressedStart{}}
+	for _, suppressed := range suppressedStarts {
+		response.SuppressedStarts = append(response.SuppressedStarts, suppressed)
+	}
+	sort.Sort(byLastSuppressed(response.SuppressedStarts))
+
+	body, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+type byLastSuppressed []models.SuppressedStart
+
+func (starts byLastSuppressed) Len() int { return len(starts) }
+func (starts byLastSuppressed) Swap(i, j int) {
+	starts[i], starts[j] = starts[j], starts[i]
+}
+func (starts byLastSuppressed) Less(i, j int) bool {
+	if starts[i].LastSuppressedAt != starts[j].LastSuppressedAt {
+		return starts[i].LastSuppressedAt > starts[j].LastSuppressedAt
+	}
+	return starts[i].StoreKey() < starts[j].StoreKey()
+}
@@ -0,0 +1,67 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Suppressed starts", func() {
+	var (
+		handler      http.Handler
+		store        store.Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+	)
+
+	get := func() *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", "/suppressed_starts", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	suppressedAt := func(index int, at int64) models.SuppressedStart {
+		start := models.NewPendingStartMessage(time.Unix(at, 0), 0, 0, "app", "v", index, 1.0, models.PendingStartMessageReasonMissing)
+		return models.NewSuppressedStart(start, "patching", time.Unix(at, 0))
+	}
+
+	BeforeEach(func() {
+		conf := defaultConf()
+		storeAdapter = conf.StoreAdapter
+		var err error
+		handler, store, err = makeHandlerAndStore(conf)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("serves the starts held back, most recently held back first", func() {
+		store.SaveSuppressedStarts(suppressedAt(0, 100), suppressedAt(1, 200))
+
+		response := get()
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		served := SuppressedStartsResponse{}
+		Ω(json.Unmarshal(response.Body.Bytes(), &served)).Should(Succeed())
+		Ω(served.SuppressedStarts).Should(Equal([]models.SuppressedStart{suppressedAt(1, 200), suppressedAt(0, 100)}))
+	})
+
+	It("serves an empty list when no start was held back", func() {
+		response := get()
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Body.String()).Should(Equal(`{"suppressed_starts":[]}`))
+	})
+
+	It("responds 500 when the store fails", func() {
+		storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("suppressed-starts", errors.New("oops"))
+		Ω(get().Code).Should(Equal(http.StatusInternalServerError))
+	})
+})
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/version"
+)
+
+type versionHandler struct {
+	logger logger.Logger
+}
+
+// NewVersionHandler serves the build of the API server.
+func NewVersionHandler(logger logger.Logger) http.Handler {
+	return &versionHandler{
+		logger: logger,
+	}
+}
+
+func (handler *versionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(version.Get())
+	if err != nil {
+		handler.logger.Error("Failed to handle version request", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,41 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/hm9000/version"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Version", func() {
+	It("serves the build of the API server", func() {
+		handler := handlers.NewVersionHandler(fakelogger.NewFakeLogger())
+		request, _ := http.NewRequest("GET", "/version", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		var info version.Info
+		Ω(json.Unmarshal(response.Body.Bytes(), &info)).Should(Succeed())
+		Ω(info).Should(Equal(version.Get()))
+	})
+
+	It("is routed to GET /version", func() {
+		handler, _, err := makeHandlerAndStore(defaultConf())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		request, _ := http.NewRequest("GET", "/version", nil)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		Ω(response.Code).Should(Equal(http.StatusOK))
+		Ω(response.Body.String()).Should(ContainSubstring(`"git_sha"`))
+	})
+})
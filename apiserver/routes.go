@@ -3,5 +3,29 @@ package apiserver
 import "github.com/tedsuo/rata"
 
 var Routes = rata.Routes{
+	{Method: "GET", Name: "analysis_report", Path: "/analysis_report"},
+	{Method: "GET", Name: "app_history", Path: "/apps/:app_guid/history"},
+	{Method: "GET", Name: "app_summary", Path: "/apps/:app_guid/:app_version/summary"},
 	{Method: "POST", Name: "bulk_app_state", Path: "/bulk_app_state"},
+	{Method: "GET", Name: "config", Path: "/config"},
+	{Method: "DELETE", Name: "crash_counts", Path: "/crash_counts/:app_guid/:app_version"},
+	{Method: "GET", Name: "dea_instances", Path: "/deas/:dea_guid/instances"},
+	{Method: "GET", Name: "pending_messages", Path: "/pending_messages"},
+	{Method: "GET", Name: "restart_report", Path: "/restart_report"},
+	{Method: "GET", Name: "suppressed_starts", Path: "/suppressed_starts"},
+	{Method: "GET", Name: "version", Path: "/version"},
+}
+
+// AdminRoutes are served to the admin user only.
+var AdminRoutes = rata.Routes{
+	{Method: "GET", Name: "admin_components", Path: "/admin/components"},
+	{Method: "GET", Name: "admin_component", Path: "/admin/components/:component"},
+	{Method: "PUT", Name: "admin_update_component", Path: "/admin/components/:component"},
+}
+
+// DashboardRoutes are the pages of the operator dashboard, served when
+// api_server_dashboard is set.
+var DashboardRoutes = rata.Routes{
+	{Method: "GET", Name: "dashboard", Path: "/dashboard"},
+	{Method: "GET", Name: "dashboard_app", Path: "/dashboard/apps/:app_guid"},
 }
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ComponentNames are the sections allowed under "components", one for each
+// process the hm CLI runs.
+var ComponentNames = []string{
+	"aggregator",
+	"analyzer",
+	"apiserver",
+	"dumper",
+	"evacuator",
+	"fetcher",
+	"fsck",
+	"key_rotator",
+	"listener",
+	"metrics_server",
+	"sender",
+	"shredder",
+	"status",
+}
+
+// ForComponent returns a copy of conf with the settings in the component's
+// section of "components" laid over the top-level ones, e.g.
+//
+//	"log_level": "INFO",
+//	"components": {"analyzer": {"log_level": "DEBUG", "analyzer_timeout_in_heartbeats": 20}}
+//
+// gives the analyzer DEBUG logging and a longer timeout, and every other
+// component INFO logging.  A component without a section gets conf as it is.
+func (conf *Config) ForComponent(component string) (*Config, error) {
+	if !isComponentName(component) {
+		return nil, fmt.Errorf("unknown component %q", component)
+	}
+
+	componentConf := *conf
+	componentConf.component = component
+
+	section := conf.Components[component]
+	fields := componentConf.settingFields()
+
+	settings := []string{}
+	for setting := range section {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+
+	for _, setting := range settings {
+		field, ok := fields[setting]
+		if !ok || setting == "components" {
+			return nil, fmt.Errorf("components.%s: unknown config setting %q", component, setting)
+		}
+
+		encoded, err := json.Marshal(section[setting])
+		if err != nil {
+			return nil, fmt.Errorf("components.%s.%s: %s", component, setting, err.Error())
+		}
+
+		parsed := reflect.New(field.Type())
+		err = json.Unmarshal(encoded, parsed.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("components.%s.%s: %s", component, setting, err.Error())
+		}
+		field.Set(parsed.Elem())
+	}
+
+	err := componentConf.resolveSecrets(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &componentConf, nil
+}
+
+// settingFields maps each setting's JSON name to the field that holds it.
+func (conf *Config) settingFields() map[string]reflect.Value {
+	fields := map[string]reflect.Value{}
+	value := reflect.ValueOf(conf).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		setting := settingName(value.Type().Field(i))
+		if setting != "" {
+			fields[setting] = value.Field(i)
+		}
+	}
+	return fields
+}
+
+func isComponentName(component string) bool {
+	for _, name := range ComponentNames {
+		if name == component {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	. "github.com/cloudfoundry/hm9000/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Component sections", func() {
+	var conf *Config
+
+	BeforeEach(func() {
+		var err error
+		conf, err = FromJSON([]byte(`{
+			"log_level": "INFO",
+			"analyzer_timeout_in_heartbeats": 10,
+			"components": {
+				"analyzer": {"log_level": "DEBUG", "analyzer_timeout_in_heartbeats": 20},
+				"sender": {"sender_message_limit": 10}
+			}
+		}`))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("lays the component's settings over the top-level ones", func() {
+		analyzerConf, err := conf.ForComponent("analyzer")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(analyzerConf.LogLevelString).Should(Equal("DEBUG"))
+		Ω(analyzerConf.AnalyzerTimeoutInHeartbeats).Should(Equal(20))
+		Ω(analyzerConf.SenderMessageLimit).Should(Equal(conf.SenderMessageLimit))
+
+		senderConf, err := conf.ForComponent("sender")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(senderConf.LogLevelString).Should(Equal("INFO"))
+		Ω(senderConf.AnalyzerTimeoutInHeartbeats).Should(Equal(10))
+		Ω(senderConf.SenderMessageLimit).Should(Equal(10))
+	})
+
+	It("leaves the top-level config alone", func() {
+		_, err := conf.ForComponent("analyzer")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(conf.LogLevelString).Should(Equal("INFO"))
+		Ω(conf.AnalyzerTimeoutInHeartbeats).Should(Equal(10))
+	})
+
+	It("gives components without a section the top-level settings", func() {
+		listenerConf, err := conf.ForComponent("listener")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(listenerConf.LogLevelString).Should(Equal("INFO"))
+		Ω(listenerConf.AnalyzerTimeoutInHeartbeats).Should(Equal(10))
+	})
+
+	It("does not share lists with the top-level config", func() {
+		conf.StoreURLs = []string{"http://127.0.0.1:4001"}
+		conf.Components["fetcher"] = map[string]interface{}{"store_urls": []interface{}{"http://10.0.0.1:4001"}}
+
+		fetcherConf, err := conf.ForComponent("fetcher")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(fetcherConf.StoreURLs).Should(Equal([]string{"http://10.0.0.1:4001"}))
+		Ω(conf.StoreURLs).Should(Equal([]string{"http://127.0.0.1:4001"}))
+	})
+
+	It("rejects unknown components and settings", func() {
+		_, err := conf.ForComponent("router")
+		Ω(err).Should(HaveOccurred())
+
+		conf.Components["analyzer"]["no_such_setting"] = 1
+		_, err = conf.ForComponent("analyzer")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("rejects nested sections", func() {
+		conf.Components["analyzer"]["components"] = map[string]interface{}{}
+		_, err := conf.ForComponent("analyzer")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("resolves secret references in the section", func() {
+		os.Setenv("HM9000_TEST_API_PASSWORD", "api-secret")
+		defer os.Unsetenv("HM9000_TEST_API_PASSWORD")
+		conf.Components["apiserver"] = map[string]interface{}{"api_server_password": "env://HM9000_TEST_API_PASSWORD"}
+
+		apiConf, err := conf.ForComponent("apiserver")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(apiConf.APIServerPassword).Should(Equal("api-secret"))
+	})
+
+	Describe("validation", func() {
+		var defaultConf *Config
+
+		BeforeEach(func() {
+			var err error
+			defaultConf, err = DefaultConfig()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("reports sections that do not name a component or that do not apply", func() {
+			defaultConf.Components = map[string]map[string]interface{}{
+				"router":   {"log_level": "DEBUG"},
+				"analyzer": {"sender_message_limit": "lots"},
+			}
+
+			err := defaultConf.Validate()
+			Ω(err).Should(HaveOccurred())
+			problems := err.(ValidationError).Problems
+			Ω(problems).Should(HaveLen(2))
+			Ω(problems[0]).Should(ContainSubstring("components.analyzer.sender_message_limit"))
+			Ω(problems[1]).Should(HavePrefix("components.router is not a component"))
+		})
+	})
+
+	Describe("reloading", func() {
+		It("re-applies the component's section", func() {
+			file, err := ioutil.TempFile("", "hm9000_component_config")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer os.Remove(file.Name())
+			file.Close()
+
+			write := func(limit int) {
+				err := ioutil.WriteFile(file.Name(), []byte(`{
+					"cc_base_url": "http://cc", "store_urls": ["http://127.0.0.1:4001"], "nats": [{"host": "127.0.0.1", "port": 4222}], "desired_state_batch_size": 500,
+					"components": {"sender": {"sender_message_limit": `+strconv.Itoa(limit)+`}}
+				}`), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			write(5)
+			conf, err := FromFile(file.Name())
+			Ω(err).ShouldNot(HaveOccurred())
+			senderConf, err := conf.ForComponent("sender")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(senderConf.SenderMessageLimit).Should(Equal(5))
+
+			write(7)
+			_, _, err = senderConf.Reload(file.Name())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(senderConf.SenderMessageLimit).Should(Equal(7))
+		})
+	})
+})
@@ -2,20 +2,68 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/cloudfoundry/gosteno"
+	"github.com/cloudfoundry/hm9000/helpers/cron"
 )
 
 type Config struct {
-	HeartbeatPeriod                 uint64 `json:"heartbeat_period_in_seconds"`
-	HeartbeatTTLInHeartbeats        uint64 `json:"heartbeat_ttl_in_heartbeats"`
-	ActualFreshnessTTLInHeartbeats  uint64 `json:"actual_freshness_ttl_in_heartbeats"`
-	GracePeriodInHeartbeats         uint64 `json:"grace_period_in_heartbeats"`
-	DesiredFreshnessTTLInHeartbeats uint64 `json:"desired_freshness_ttl_in_heartbeats"`
+	HeartbeatPeriod                 DurationInSeconds `json:"heartbeat_period_in_seconds"`
+	HeartbeatTTLInHeartbeats        uint64            `json:"heartbeat_ttl_in_heartbeats"`
+	ActualFreshnessTTLInHeartbeats  uint64            `json:"actual_freshness_ttl_in_heartbeats"`
+	GracePeriodInHeartbeats         uint64            `json:"grace_period_in_heartbeats"`
+	DesiredFreshnessTTLInHeartbeats uint64            `json:"desired_freshness_ttl_in_heartbeats"`
+
+	StaleZoneTimeoutInSeconds DurationInSeconds `json:"stale_zone_timeout_in_seconds"`
+
+	// With DeaShutdownScheduledSubject set, the evacuator records the DEAs
+	// that deployment tooling announces on it as about to be shut down, for
+	// DeaShutdownScheduledTTLInSeconds, and the analyzer starts a replacement
+	// for the apps whose one instance runs on them.
+	DeaShutdownScheduledSubject      string            `json:"dea_shutdown_scheduled_subject"`
+	DeaShutdownScheduledTTLInSeconds DurationInSeconds `json:"dea_shutdown_scheduled_ttl_in_seconds"`
+
+	// The evacuator buffers up to EvacuatorRetryBufferSize starts it failed
+	// to enqueue, and retries each every
+	// EvacuatorRetryIntervalInMilliseconds, up to EvacuatorRetries times.
+	// A start it gives up on, or has no room for, is an evacuation missed.
+	EvacuatorRetryBufferSize             int                    `json:"evacuator_retry_buffer_size"`
+	EvacuatorRetries                     int                    `json:"evacuator_retries"`
+	EvacuatorRetryIntervalInMilliseconds DurationInMilliseconds `json:"evacuator_retry_interval_in_milliseconds"`
+
+	// InstanceMissingGracePeriodInSeconds is how long the instances of a DEA
+	// that has gone silent are kept before they are missing.  0 keeps them
+	// for the heartbeat TTL.
+	InstanceMissingGracePeriodInSeconds DurationInSeconds `json:"instance_missing_grace_period_in_seconds"`
+
+	StoppedAppGracePeriodInSeconds DurationInSeconds `json:"stopped_app_grace_period_in_seconds"`
+	StoppedAppRequiresTwoSyncs     bool              `json:"stopped_app_requires_two_syncs"`
+
+	// With PerAppFreshness set, the listener records when and by which DEA
+	// an instance was last reported at each index of each app, and the
+	// analyzer does not declare an index missing while that DEA is present
+	// and still reporting it: the store has not caught up.
+	PerAppFreshness bool `json:"per_app_freshness"`
+
+	// With ListenerUpdatesAppSummaries set, the listener updates the app
+	// summaries of the apps whose instances change as it syncs heartbeats,
+	// and the aggregator only has to bring them in line with the desired
+	// state.
+	ListenerUpdatesAppSummaries bool `json:"listener_updates_app_summaries"`
+
+	// IndexGapPolicy is how the analyzer treats an app with instances
+	// beyond its desired indices while some desired indices are missing:
+	// strict starts the missing indices and then stops the others, tolerant
+	// lets the others stand in for the missing indices.
+	IndexGapPolicy string `json:"index_gap_policy"`
 
 	SenderPollingIntervalInHeartbeats   int `json:"sender_polling_interval_in_heartbeats"`
 	SenderTimeoutInHeartbeats           int `json:"sender_timeout_in_heartbeats"`
@@ -26,26 +74,177 @@ type Config struct {
 	AnalyzerPollingIntervalInHeartbeats int `json:"analyzer_polling_interval_in_heartbeats"`
 	AnalyzerTimeoutInHeartbeats         int `json:"analyzer_timeout_in_heartbeats"`
 
-	ListenerHeartbeatSyncIntervalInMilliseconds      int `json:"listener_heartbeat_sync_interval_in_milliseconds"`
-	StoreHeartbeatCacheRefreshIntervalInMilliseconds int `json:"store_heartbeat_cache_refresh_interval_in_milliseconds"`
+	AggregatorPollingIntervalInHeartbeats int `json:"aggregator_polling_interval_in_heartbeats"`
+	AggregatorTimeoutInHeartbeats         int `json:"aggregator_timeout_in_heartbeats"`
+
+	AnalyzerMinPollingIntervalInHeartbeats int `json:"analyzer_min_polling_interval_in_heartbeats"`
+	AnalyzerMaxPollingIntervalInHeartbeats int `json:"analyzer_max_polling_interval_in_heartbeats"`
+
+	FetcherSchedule  string `json:"fetcher_schedule"`
+	AnalyzerSchedule string `json:"analyzer_schedule"`
+	SenderSchedule   string `json:"sender_schedule"`
+	ShredderSchedule string `json:"shredder_schedule"`
+
+	LeaderElectionTTLInSeconds DurationInSeconds `json:"leader_election_ttl_in_seconds"`
+	LeaderElectionCandidate    string            `json:"leader_election_candidate"`
+
+	DaemonJitterInMilliseconds              DurationInMilliseconds `json:"daemon_jitter_in_milliseconds"`
+	DaemonMaximumFailureBackoffInHeartbeats int                    `json:"daemon_maximum_failure_backoff_in_heartbeats"`
+	DaemonMaxConsecutiveFailures            int                    `json:"daemon_max_consecutive_failures"`
+	DaemonWatchdogMultiple                  int                    `json:"daemon_watchdog_multiple"`
+	DaemonWatchdogKillsProcess              bool                   `json:"daemon_watchdog_kills_process"`
+
+	ShutdownTimeoutInSeconds DurationInSeconds `json:"shutdown_timeout_in_seconds"`
+
+	// A command that cannot reach the store, NATS or the CC when it starts
+	// retries StartupDependencyRetries times, waiting
+	// StartupDependencyRetryDelayInMilliseconds before the first retry and
+	// twice as long before each one after, before it gives up.
+	StartupDependencyRetries                  int                    `json:"startup_dependency_retries"`
+	StartupDependencyRetryDelayInMilliseconds DurationInMilliseconds `json:"startup_dependency_retry_delay_in_milliseconds"`
+
+	ListenerHeartbeatSyncIntervalInMilliseconds      DurationInMilliseconds `json:"listener_heartbeat_sync_interval_in_milliseconds"`
+	StoreHeartbeatCacheRefreshIntervalInMilliseconds DurationInMilliseconds `json:"store_heartbeat_cache_refresh_interval_in_milliseconds"`
+
+	// When more than ListenerLoadSheddingThreshold heartbeats are pending
+	// at a sync, the listener saves the instances of ListenerPriorityApps
+	// only, and just counts the rest.  It is off when 0.
+	ListenerLoadSheddingThreshold int      `json:"listener_load_shedding_threshold"`
+	ListenerPriorityApps          []string `json:"listener_priority_apps"`
+
+	// With ListenerHeartbeatSamplingCohorts set, the DEAs are divided into
+	// that many cohorts, and each heartbeat period the listener saves the
+	// instances of one cohort's DEAs only, in turn, and summarizes every
+	// DEA's heartbeat.  It is off when 0.
+	ListenerHeartbeatSamplingCohorts int `json:"listener_heartbeat_sampling_cohorts"`
 
-	DesiredStateBatchSize          int    `json:"desired_state_batch_size"`
-	FetcherNetworkTimeoutInSeconds int    `json:"fetcher_network_timeout_in_seconds"`
-	ActualFreshnessKey             string `json:"actual_freshness_key"`
-	DesiredFreshnessKey            string `json:"desired_freshness_key"`
-	CCAuthUser                     string `json:"cc_auth_user"`
-	CCAuthPassword                 string `json:"cc_auth_password"`
-	CCBaseURL                      string `json:"cc_base_url"`
-	SkipSSLVerification            bool   `json:"skip_cert_verify"`
+	// The listener reports the DEAs that send state timestamps further
+	// ahead of its clock than ListenerClockSkewThresholdInSeconds, and with
+	// ListenerNormalizeSkewedTimestamps brings their timestamps back to
+	// its own time.  It is off when 0.
+	ListenerClockSkewThresholdInSeconds DurationInSeconds `json:"listener_clock_skew_threshold_in_seconds"`
+	ListenerNormalizeSkewedTimestamps   bool              `json:"listener_normalize_skewed_timestamps"`
+
+	// The listener reads the Diego cell reports published on
+	// CellReportsNATSSubject as heartbeats, and the API server takes them
+	// over HTTP and republishes them there.  It is off when empty.
+	CellReportsNATSSubject string `json:"cell_reports_nats_subject"`
+
+	// With NATSQueueGroup set, the listener, the evacuator and the API
+	// server's admin responder subscribe in that NATS queue group, so that
+	// each message goes to one of their instances rather than all of them.
+	NATSQueueGroup string `json:"nats_queue_group"`
+
+	DesiredStateBatchSize          int               `json:"desired_state_batch_size"`
+	FetcherNetworkTimeoutInSeconds DurationInSeconds `json:"fetcher_network_timeout_in_seconds"`
+	ActualFreshnessKey             string            `json:"actual_freshness_key"`
+	DesiredFreshnessKey            string            `json:"desired_freshness_key"`
+	CCAuthUser                     string            `json:"cc_auth_user"`
+	CCAuthPassword                 string            `json:"cc_auth_password"`
+	CCBaseURL                      string            `json:"cc_base_url"`
+	SkipSSLVerification            bool              `json:"skip_cert_verify"`
+
+	FetcherRequestRetries            int                          `json:"fetcher_request_retries"`
+	FetcherRetryDelayInMilliseconds  DurationInMilliseconds       `json:"fetcher_retry_delay_in_milliseconds"`
+	FetcherMaxIdleConnectionsPerHost int                          `json:"fetcher_max_idle_connections_per_host"`
+	FetcherHostTimeoutsInSeconds     map[string]DurationInSeconds `json:"fetcher_host_timeouts_in_seconds"`
+
+	// With FetcherVerifyAppCount, the fetcher asks the CC how many apps there
+	// are once it has every bulk page, and aborts the sync when it has been
+	// sent fewer than that by more than FetcherAppCountTolerance, a fraction of
+	// the CC's count, rather than take a truncated response for deleted apps.
+	FetcherVerifyAppCount    bool    `json:"fetcher_verify_app_count"`
+	FetcherAppCountTolerance float64 `json:"fetcher_app_count_tolerance"`
+
+	// FetcherExclusions pick out apps that something else supervises,
+	// such as system apps: the fetcher stores them marked unmanaged, and
+	// the analyzer and sender never start or stop their instances.
+	FetcherExclusions FetcherExclusions `json:"fetcher_exclusions"`
+
+	// During MaintenanceWindows the analyzer enqueues no starts for the
+	// apps they match, so that planned maintenance is not fought, and
+	// records each start it holds back, for
+	// MaintenanceSuppressedStartsTTLInSeconds, for review.
+	MaintenanceWindows                      []MaintenanceWindow `json:"maintenance_windows"`
+	MaintenanceSuppressedStartsTTLInSeconds DurationInSeconds   `json:"maintenance_suppressed_starts_ttl_in_seconds"`
 
 	StoreSchemaVersion         int      `json:"store_schema_version"`
+	StoreType                  string   `json:"store_type"`
 	StoreURLs                  []string `json:"store_urls"`
 	StoreMaxConcurrentRequests int      `json:"store_max_concurrent_requests"`
+	SecondaryStoreURLs         []string `json:"secondary_store_urls"`
+	StoreFailoverThreshold     int      `json:"store_failover_threshold"`
+
+	// With StoreMigrationURLs set, every write is made to both the store and
+	// the store being migrated to, of StoreMigrationType (StoreType if empty),
+	// while reads stay on the store.
+	StoreMigrationType string   `json:"store_migration_type"`
+	StoreMigrationURLs []string `json:"store_migration_urls"`
+
+	// StoreAppLayoutVersion is how the desired and actual state are laid out
+	// under /apps: 1 keeps a directory per app under one directory, 2 spreads
+	// the apps over hashed buckets so no directory grows too wide to list.
+	StoreAppLayoutVersion int `json:"store_app_layout_version"`
+
+	StoreRequestTimeoutInMilliseconds DurationInMilliseconds `json:"store_request_timeout_in_milliseconds"`
+	StoreRequestRetries               int                    `json:"store_request_retries"`
+	StoreRetryDelayInMilliseconds     DurationInMilliseconds `json:"store_retry_delay_in_milliseconds"`
+
+	// Reads from etcd that take longer than StoreHedgedReadThresholdInMilliseconds
+	// (0 to never) are sent again to another of the store's nodes, and the
+	// first answer is used.
+	StoreHedgedReadThresholdInMilliseconds DurationInMilliseconds `json:"store_hedged_read_threshold_in_milliseconds"`
+
+	StoreReadCacheTTLInMilliseconds DurationInMilliseconds `json:"store_read_cache_ttl_in_milliseconds"`
+	StoreReadCacheMaxEntries        int                    `json:"store_read_cache_max_entries"`
+
+	StoreEncryptionActiveKeyLabel string `json:"store_encryption_active_key_label"`
+	StoreEncryptionKeys           []struct {
+		Label   string `json:"label"`
+		Key     string `json:"key"`
+		KeyFile string `json:"key_file"`
+	} `json:"store_encryption_keys"`
 
 	SenderNatsStartSubject string `json:"sender_nats_start_subject"`
 	SenderNatsStopSubject  string `json:"sender_nats_stop_subject"`
 	SenderMessageLimit     int    `json:"sender_message_limit"`
 
+	// SenderStopsPerDeaLimit caps the stops the sender sends to any one DEA
+	// each run, so that no DEA tears down hundreds of instances at once.  The
+	// stops over the cap stay pending for later runs.  0 is no cap.
+	SenderStopsPerDeaLimit int `json:"sender_stops_per_dea_limit"`
+
+	// SenderRouterUnregisterSubject is where the sender asks the routers to
+	// drop the routes of the extra and duplicate instances it stops, for
+	// instances whose DEA sent their address.  Empty turns it off.
+	SenderRouterUnregisterSubject string `json:"sender_router_unregister_subject"`
+
+	// With SenderSigningSecret set, the sender signs each start and stop it
+	// sends with an HMAC-SHA256 of the message keyed by the secret, so that
+	// DEAs and the CC can tell them from spoofed messages.
+	SenderSigningSecret string `json:"sender_signing_secret"`
+
+	TimeToReactSLOInSeconds DurationInSeconds `json:"time_to_react_slo_in_seconds"`
+
+	// The sender counts a start it sent as succeeded, crashed or timed out
+	// by what it sees at the start's index within this window.  0 disables
+	// tracking start effectiveness.
+	StartEffectivenessWindowInSeconds DurationInSeconds `json:"start_effectiveness_window_in_seconds"`
+
+	RestartReportThreshold       int               `json:"restart_report_threshold"`
+	RestartReportWindowInSeconds DurationInSeconds `json:"restart_report_window_in_seconds"`
+
+	AppHistoryMaxEvents    int               `json:"app_history_max_events"`
+	AppHistoryTTLInSeconds DurationInSeconds `json:"app_history_ttl_in_seconds"`
+
+	// The shredder rolls the crashes in app histories older than the
+	// compaction window into daily crash counts, kept for the crash trend
+	// TTL.  A zero window turns compaction off.
+	CrashCompactionWindowInSeconds DurationInSeconds `json:"crash_compaction_window_in_seconds"`
+	CrashTrendTTLInSeconds         DurationInSeconds `json:"crash_trend_ttl_in_seconds"`
+
+	Webhooks []Webhook `json:"webhooks"`
+
 	NumberOfCrashesBeforeBackoffBegins int `json:"number_of_crashes_before_backoff_begins"`
 	StartingBackoffDelayInHeartbeats   int `json:"starting_backoff_delay_in_heartbeats"`
 	MaximumBackoffDelayInHeartbeats    int `json:"maximum_backoff_delay_in_heartbeats"`
@@ -54,36 +253,297 @@ type Config struct {
 	MetricsServerUser     string `json:"metrics_server_user"`
 	MetricsServerPassword string `json:"metrics_server_password"`
 
+	// MetricsServerUseAppSummaries has the metrics server count apps and
+	// instances from the aggregator's app summaries rather than the desired
+	// and actual state.
+	MetricsServerUseAppSummaries bool `json:"metrics_server_use_app_summaries"`
+
+	// With MetricsOrigin set, every metric the metrics server emits is
+	// tagged with it, MetricsIndex and, when set, MetricsJob, so that the
+	// metrics of deployments sharing a collector can be told apart.
+	// MetricsDisabled,
+	// usually set in a component's section of Components, stops the
+	// component from emitting metrics at all.
+	MetricsOrigin   string `json:"metrics_origin"`
+	MetricsJob      string `json:"metrics_job"`
+	MetricsIndex    int    `json:"metrics_index"`
+	MetricsDisabled bool   `json:"metrics_disabled"`
+
+	// DropsondePort is the port of the metron agent on this box, which the
+	// long-running components send their own store request stats to.
+	DropsondePort int `json:"dropsonde_port"`
+
 	APIServerURL      string `json:"api_server_url"`
 	APIServerAddress  string `json:"api_server_address"`
 	APIServerPort     int    `json:"api_server_port"`
 	APIServerUsername string `json:"api_server_username"`
 	APIServerPassword string `json:"api_server_password"`
 
+	// Each requester may make APIServerRateLimitPerSecond requests a second,
+	// in bursts of up to APIServerRateLimitBurst, before the API server turns
+	// its requests away.  The rate limit is off when it is 0.  No more than
+	// APIServerRateLimitMaxRequesters are tracked at once; the requesters
+	// beyond them share one bucket.
+	APIServerRateLimitPerSecond     int `json:"api_server_rate_limit_per_second"`
+	APIServerRateLimitBurst         int `json:"api_server_rate_limit_burst"`
+	APIServerRateLimitMaxRequesters int `json:"api_server_rate_limit_max_requesters"`
+
+	// APIServerTrustedProxies are the addresses and CIDR ranges of the
+	// routers in front of the API server.  Only a request that comes from
+	// one of them has its X-Forwarded-For believed.
+	APIServerTrustedProxies []string `json:"api_server_trusted_proxies"`
+
+	// The API server answers requests it has not answered within
+	// APIServerRequestTimeoutInMilliseconds with a 503, and runs no more than
+	// APIServerMaxRequestsInFlight at once, counting those it has given up
+	// on that are still reading the store.  A request that waits for its
+	// turn past the timeout is given up on without reading the store at all.
+	// Both are off when 0.
+	APIServerRequestTimeoutInMilliseconds DurationInMilliseconds `json:"api_server_request_timeout_in_milliseconds"`
+	APIServerMaxRequestsInFlight          int                    `json:"api_server_max_requests_in_flight"`
+
+	// With APIServerDegradedResponses set, bulk_app_state answers while the
+	// desired or actual state is not fresh, with the last state known and a
+	// stale flag, rather than with nothing.
+	APIServerDegradedResponses bool `json:"api_server_degraded_responses"`
+
+	// With APIServerDashboard set, the API server serves a read-only
+	// dashboard for operators under /dashboard, to the API user.
+	APIServerDashboard bool `json:"api_server_dashboard"`
+
+	// The admin API, which pauses and resumes components, is served over
+	// HTTP by the API server and on AdminNATSSubject, to the admin user only.
+	// It is off unless APIServerAdminUsername is set.
+	APIServerAdminUsername string `json:"api_server_admin_username"`
+	APIServerAdminPassword string `json:"api_server_admin_password"`
+	AdminNATSSubject       string `json:"admin_nats_subject"`
+
 	LogLevelString string `json:"log_level"`
+	LogFormat      string `json:"log_format"`
+
+	LogSamplingBurst             int               `json:"log_sampling_burst"`
+	LogSamplingIntervalInSeconds DurationInSeconds `json:"log_sampling_interval_in_seconds"`
 
-	NATS []struct {
-		Host     string `json:"host"`
-		Port     int    `json:"port"`
-		User     string `json:"user"`
-		Password string `json:"password"`
-	} `json:"nats"`
+	LogSinks []LogSink `json:"log_sinks"`
+
+	DebugServerAddress string `json:"debug_server_address"`
+
+	PIDFile string `json:"pid_file"`
+
+	StrictStartup bool `json:"strict_startup"`
+
+	Components map[string]map[string]interface{} `json:"components"`
+
+	NATS []NATSServer `json:"nats"`
+
+	NATSClusters                      []NATSCluster          `json:"nats_clusters"`
+	NATSFailoverThreshold             int                    `json:"nats_failover_threshold"`
+	NATSHealthCheckIntervalInSeconds  DurationInSeconds      `json:"nats_health_check_interval_in_seconds"`
+	NATSReconnectJitterInMilliseconds DurationInMilliseconds `json:"nats_reconnect_jitter_in_milliseconds"`
+
+	NATSTLS struct {
+		Enabled        bool   `json:"enabled"`
+		CACertFile     string `json:"ca_cert_file"`
+		ClientCertFile string `json:"client_cert_file"`
+		ClientKeyFile  string `json:"client_key_file"`
+		SkipVerify     bool   `json:"skip_cert_verify"`
+	} `json:"nats_tls"`
+
+	// EmbeddedNATS makes hm9000 serve run its own NATS server, listening on
+	// the first NATS server configured, for demos and single-box installs
+	// that have no NATS of their own.
+	EmbeddedNATS bool `json:"embedded_nats"`
+
+	// With ServeEventBus, the components hm9000 serve runs wake each other
+	// as they write to the store: the analyzer runs when the listener or
+	// fetcher has synced, and the sender when the analyzer has enqueued
+	// messages, rather than on their next poll.  A woken component runs no
+	// sooner than ServeEventBusMinIntervalInMilliseconds after it last
+	// started.
+	ServeEventBus                          bool                   `json:"serve_event_bus"`
+	ServeEventBusMinIntervalInMilliseconds DurationInMilliseconds `json:"serve_event_bus_min_interval_in_milliseconds"`
+
+	// FaultInjection slows down, drops or fails a fraction of store, NATS
+	// and CC requests, for resilience testing.  Never enable it in
+	// production.
+	FaultInjection struct {
+		Enabled                    bool                   `json:"enabled"`
+		Seed                       int64                  `json:"seed"`
+		StoreLatencyInMilliseconds DurationInMilliseconds `json:"store_latency_in_milliseconds"`
+		StoreLatencyRate           float64                `json:"store_latency_rate"`
+		NATSDropRate               float64                `json:"nats_drop_rate"`
+		CCFailureRate              float64                `json:"cc_failure_rate"`
+	} `json:"fault_injection"`
+
+	overrides map[string]string
+	format    string
+	component string
+}
+
+type NATSServer struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type NATSCluster struct {
+	Name    string       `json:"name"`
+	Servers []NATSServer `json:"servers"`
+}
+
+// Webhook is a URL that is sent JSON notifications of the given events (see
+// helpers/webhooks), or of every event if none are given.
+type Webhook struct {
+	URL                      string                 `json:"url"`
+	Events                   []string               `json:"events"`
+	AuthUser                 string                 `json:"auth_user"`
+	AuthPassword             string                 `json:"auth_password"`
+	AuthToken                string                 `json:"auth_token"`
+	TimeoutInSeconds         DurationInSeconds      `json:"timeout_in_seconds"`
+	Retries                  int                    `json:"retries"`
+	RetryDelayInMilliseconds DurationInMilliseconds `json:"retry_delay_in_milliseconds"`
+}
+
+// Timeout defaults to 5 seconds.
+func (webhook Webhook) Timeout() time.Duration {
+	if webhook.TimeoutInSeconds.Duration == 0 {
+		return 5 * time.Second
+	}
+	return webhook.TimeoutInSeconds.Duration
+}
+
+// RetryDelay defaults to half a second.
+func (webhook Webhook) RetryDelay() time.Duration {
+	if webhook.RetryDelayInMilliseconds.Duration == 0 {
+		return 500 * time.Millisecond
+	}
+	return webhook.RetryDelayInMilliseconds.Duration
+}
+
+// FetcherExclusions exclude the apps in any of the organizations or spaces,
+// the apps with any of the guids, and the apps whose names match NameRegex.
+type FetcherExclusions struct {
+	OrganizationGuids []string `json:"organization_guids"`
+	SpaceGuids        []string `json:"space_guids"`
+	AppGuids          []string `json:"app_guids"`
+	NameRegex         string   `json:"name_regex"`
+}
+
+// MaintenanceWindow is open for DurationInSeconds from each time Schedule, a
+// cron expression in the machine's local time, matches.  It matches the
+// apps in any of the organizations and the apps with any of the guids.
+type MaintenanceWindow struct {
+	Name              string            `json:"name"`
+	Schedule          string            `json:"schedule"`
+	DurationInSeconds DurationInSeconds `json:"duration_in_seconds"`
+	OrganizationGuids []string          `json:"organization_guids"`
+	AppGuids          []string          `json:"app_guids"`
+}
+
+// IsOpen is true when the window opened at most its duration before t.  An
+// invalid schedule is never open.
+func (window MaintenanceWindow) IsOpen(t time.Time) bool {
+	schedule, err := cron.Parse(window.Schedule)
+	if err != nil {
+		return false
+	}
+	opened := schedule.Next(t.Add(-window.DurationInSeconds.Duration))
+	return !opened.IsZero() && !opened.After(t)
+}
+
+// Matches is true for the apps in the window's organizations and those it
+// names.
+func (window MaintenanceWindow) Matches(organizationGuid string, appGuid string) bool {
+	for _, guid := range window.OrganizationGuids {
+		if guid != "" && guid == organizationGuid {
+			return true
+		}
+	}
+	for _, guid := range window.AppGuids {
+		if guid == appGuid {
+			return true
+		}
+	}
+	return false
+}
+
+// LogSink is somewhere to send log lines: "stdout", "syslog" or "file".  A
+// syslog sink with an address sends RFC5424 messages to that server over
+// network (udp, the default, or tcp); without one it logs to the local
+// syslog.  A file sink writes to path and rotates it.
+type LogSink struct {
+	Type string `json:"type"`
+
+	Network string `json:"network"`
+	Address string `json:"address"`
+
+	Path               string            `json:"path"`
+	MaxSizeInMegabytes int               `json:"max_size_in_megabytes"`
+	MaxAgeInSeconds    DurationInSeconds `json:"max_age_in_seconds"`
+	MaxBackups         int               `json:"max_backups"`
 }
 
 func defaults() Config {
 	return Config{
-		HeartbeatPeriod: 10, // TODO: convert to time.Duration
+		HeartbeatPeriod: DurationInSeconds{10 * time.Second},
 
 		HeartbeatTTLInHeartbeats:        3,
 		ActualFreshnessTTLInHeartbeats:  3,
 		GracePeriodInHeartbeats:         3,
 		DesiredFreshnessTTLInHeartbeats: 12,
 
+		StaleZoneTimeoutInSeconds: DurationInSeconds{10 * time.Minute},
+
+		DeaShutdownScheduledTTLInSeconds: DurationInSeconds{15 * time.Minute},
+
+		EvacuatorRetryBufferSize:             100,
+		EvacuatorRetries:                     5,
+		EvacuatorRetryIntervalInMilliseconds: DurationInMilliseconds{time.Second},
+
+		StoppedAppGracePeriodInSeconds: DurationInSeconds{0},
+		StoppedAppRequiresTwoSyncs:     false,
+
+		IndexGapPolicy: "strict",
+
+		StoreAppLayoutVersion:      1,
+		StoreType:                  "etcd",
 		StoreMaxConcurrentRequests: 30,
+		StoreFailoverThreshold:     5,
+
+		FetcherRequestRetries:            0,
+		FetcherRetryDelayInMilliseconds:  DurationInMilliseconds{500 * time.Millisecond},
+		FetcherMaxIdleConnectionsPerHost: 2,
+		FetcherVerifyAppCount:            false,
+		FetcherAppCountTolerance:         0.05,
+
+		StoreRequestTimeoutInMilliseconds: DurationInMilliseconds{0}, // disabled
+		StoreRequestRetries:               0,
+		StoreRetryDelayInMilliseconds:     DurationInMilliseconds{100 * time.Millisecond},
+
+		StoreHedgedReadThresholdInMilliseconds: DurationInMilliseconds{0}, // disabled
+
+		StoreReadCacheTTLInMilliseconds: DurationInMilliseconds{0}, // disabled
+		StoreReadCacheMaxEntries:        1000,
 
 		SenderNatsStartSubject: "hm9000.start",
 		SenderNatsStopSubject:  "hm9000.stop",
 		SenderMessageLimit:     60, // TODO: unit
+		SenderStopsPerDeaLimit: 0,  // no cap
+
+		TimeToReactSLOInSeconds:           DurationInSeconds{60 * time.Second},
+		StartEffectivenessWindowInSeconds: DurationInSeconds{180 * time.Second},
+
+		RestartReportThreshold:       10,
+		RestartReportWindowInSeconds: DurationInSeconds{24 * time.Hour},
+
+		AppHistoryMaxEvents:    0, // disabled
+		AppHistoryTTLInSeconds: DurationInSeconds{7 * 24 * time.Hour},
+
+		MaintenanceSuppressedStartsTTLInSeconds: DurationInSeconds{7 * 24 * time.Hour},
+
+		CrashCompactionWindowInSeconds: DurationInSeconds{24 * time.Hour},
+		CrashTrendTTLInSeconds:         DurationInSeconds{90 * 24 * time.Hour},
 
 		SenderPollingIntervalInHeartbeats:   1,   // why?
 		SenderTimeoutInHeartbeats:           10,  // why?
@@ -94,14 +554,40 @@ func defaults() Config {
 		AnalyzerPollingIntervalInHeartbeats: 1,   // why?
 		AnalyzerTimeoutInHeartbeats:         10,  // why?
 
+		AggregatorPollingIntervalInHeartbeats: 1,
+		AggregatorTimeoutInHeartbeats:         10,
+
+		LeaderElectionTTLInSeconds: DurationInSeconds{10 * time.Second},
+
+		DaemonJitterInMilliseconds:              DurationInMilliseconds{0}, // disabled
+		DaemonMaximumFailureBackoffInHeartbeats: 0,                         // disabled
+		DaemonMaxConsecutiveFailures:            0,                         // never give up
+		DaemonWatchdogMultiple:                  0,                         // disabled
+		DaemonWatchdogKillsProcess:              false,
+
+		ShutdownTimeoutInSeconds: DurationInSeconds{20 * time.Second},
+
+		StartupDependencyRetries:                  4,
+		StartupDependencyRetryDelayInMilliseconds: DurationInMilliseconds{time.Second},
+
 		NumberOfCrashesBeforeBackoffBegins: 3,
 		StartingBackoffDelayInHeartbeats:   3,  // why?
 		MaximumBackoffDelayInHeartbeats:    96, // why?
 
-		ListenerHeartbeatSyncIntervalInMilliseconds:      1000,  // TODO: convert to time.Duration
-		StoreHeartbeatCacheRefreshIntervalInMilliseconds: 20000, // TODO: convert to time.Duration
+		ListenerHeartbeatSyncIntervalInMilliseconds:      DurationInMilliseconds{time.Second},
+		StoreHeartbeatCacheRefreshIntervalInMilliseconds: DurationInMilliseconds{20 * time.Second},
+		ListenerLoadSheddingThreshold:                    0, // disabled
+		ListenerHeartbeatSamplingCohorts:                 0, // disabled
+		ListenerClockSkewThresholdInSeconds:              DurationInSeconds{30 * time.Second},
 
 		MetricsServerPort: 7879,
+		DropsondePort:     3457,
+
+		NATSFailoverThreshold:             3,
+		NATSHealthCheckIntervalInSeconds:  DurationInSeconds{5 * time.Second},
+		NATSReconnectJitterInMilliseconds: DurationInMilliseconds{0}, // disabled
+
+		ServeEventBusMinIntervalInMilliseconds: DurationInMilliseconds{250 * time.Millisecond},
 
 		APIServerURL:      "https://example.com",
 		APIServerAddress:  "0.0.0.0",
@@ -109,90 +595,447 @@ func defaults() Config {
 		APIServerUsername: "magnet",
 		APIServerPassword: "orangutan4sale",
 
+		APIServerRateLimitPerSecond:     0, // disabled
+		APIServerRateLimitMaxRequesters: 10000,
+		APIServerTrustedProxies:         []string{},
+
+		AdminNATSSubject: "hm9000.admin",
+
 		LogLevelString: "INFO",
+		LogFormat:      "json",
+
+		LogSamplingBurst:             0, // disabled
+		LogSamplingIntervalInSeconds: DurationInSeconds{time.Second},
 
 		ActualFreshnessKey:  "/actual-fresh",
 		DesiredFreshnessKey: "/desired-fresh",
 	}
 }
 
+// heartbeatSeconds is the heartbeat period in whole seconds, the unit of
+// the store's TTLs.
+func (conf *Config) heartbeatSeconds() uint64 {
+	return uint64(conf.HeartbeatPeriod.Duration / time.Second)
+}
+
+func (conf *Config) inHeartbeats(heartbeats int) time.Duration {
+	return time.Duration(heartbeats) * conf.HeartbeatPeriod.Duration
+}
+
 func (conf *Config) HeartbeatTTL() uint64 {
-	return conf.HeartbeatTTLInHeartbeats * conf.HeartbeatPeriod
+	return conf.HeartbeatTTLInHeartbeats * conf.heartbeatSeconds()
 }
 
 func (conf *Config) ActualFreshnessTTL() uint64 {
-	return conf.ActualFreshnessTTLInHeartbeats * conf.HeartbeatPeriod
+	return conf.ActualFreshnessTTLInHeartbeats * conf.heartbeatSeconds()
 }
 
 func (conf *Config) GracePeriod() int {
-	return int(conf.GracePeriodInHeartbeats * conf.HeartbeatPeriod)
+	return int(conf.GracePeriodInHeartbeats * conf.heartbeatSeconds())
 }
 
 func (conf *Config) DesiredFreshnessTTL() uint64 {
-	return conf.DesiredFreshnessTTLInHeartbeats * conf.HeartbeatPeriod
+	return conf.DesiredFreshnessTTLInHeartbeats * conf.heartbeatSeconds()
 }
 
 func (conf *Config) FetcherNetworkTimeout() time.Duration {
-	return time.Duration(conf.FetcherNetworkTimeoutInSeconds) * time.Second
+	return conf.FetcherNetworkTimeoutInSeconds.Duration
+}
+
+// StaleZoneTimeout is how long the analyzer holds back starts for the
+// instances of a zone that has stopped heartbeating.  0 turns off tracking
+// zones.
+func (conf *Config) StaleZoneTimeout() time.Duration {
+	return conf.StaleZoneTimeoutInSeconds.Duration
+}
+
+// DeaShutdownScheduledTTL is how long a DEA is taken to be about to shut
+// down once deployment tooling has said so.
+func (conf *Config) DeaShutdownScheduledTTL() time.Duration {
+	return conf.DeaShutdownScheduledTTLInSeconds.Duration
+}
+
+func (conf *Config) EvacuatorRetryInterval() time.Duration {
+	return conf.EvacuatorRetryIntervalInMilliseconds.Duration
+}
+
+// StoppedAppGracePeriod is how long the analyzer waits before stopping the
+// instances of an app that has left the desired state, in case the app
+// comes back.
+// InstanceMissingGracePeriod is how long, in seconds, the instances of a DEA
+// are kept after its last heartbeat: instance_missing_grace_period_in_seconds
+// if it is set, and the heartbeat TTL if not.
+func (conf *Config) InstanceMissingGracePeriod() uint64 {
+	if conf.InstanceMissingGracePeriodInSeconds.Duration > 0 {
+		return uint64(conf.InstanceMissingGracePeriodInSeconds.Duration / time.Second)
+	}
+	return conf.HeartbeatTTL()
+}
+
+func (conf *Config) StoppedAppGracePeriod() time.Duration {
+	return conf.StoppedAppGracePeriodInSeconds.Duration
+}
+
+// ToleratesIndexGaps is true when instances beyond an app's desired indices
+// stand in for its missing ones.
+func (conf *Config) ToleratesIndexGaps() bool {
+	return conf.IndexGapPolicy == "tolerant"
+}
+
+// MetricsTags are the tags every metric the metrics server emits carries,
+// none unless metrics_origin is set.
+func (conf *Config) MetricsTags() map[string]interface{} {
+	if conf.MetricsOrigin == "" {
+		return nil
+	}
+	tags := map[string]interface{}{
+		"origin": conf.MetricsOrigin,
+		"index":  conf.MetricsIndex,
+	}
+	if conf.MetricsJob != "" {
+		tags["job"] = conf.MetricsJob
+	}
+	return tags
+}
+
+// InstanceName names this process in leader elections, locks and
+// per-instance metrics: leader_election_candidate, or the host name and
+// process id.
+func (conf *Config) InstanceName() string {
+	if conf.LeaderElectionCandidate != "" {
+		return conf.LeaderElectionCandidate
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// AppHistoryEnabled is true when the analyzer and sender record what they
+// do to each app.
+func (conf *Config) AppHistoryEnabled() bool {
+	return conf.AppHistoryMaxEvents > 0
+}
+
+// AppHistoryTTL is how long an app's history keeps an event.
+func (conf *Config) AppHistoryTTL() time.Duration {
+	return conf.AppHistoryTTLInSeconds.Duration
+}
+
+// MaintenanceSuppressedStartsTTL is how long a start held back during a
+// maintenance window is kept for review.
+func (conf *Config) MaintenanceSuppressedStartsTTL() time.Duration {
+	return conf.MaintenanceSuppressedStartsTTLInSeconds.Duration
+}
+
+// CrashCompactionEnabled is true when the shredder rolls old crashes in the
+// app histories into daily crash counts.
+func (conf *Config) CrashCompactionEnabled() bool {
+	return conf.AppHistoryEnabled() && conf.CrashCompactionWindowInSeconds.Duration > 0
+}
+
+// CrashCompactionWindow is how old a crash in an app's history must be for
+// the shredder to roll it into the app's daily crash counts.
+func (conf *Config) CrashCompactionWindow() time.Duration {
+	return conf.CrashCompactionWindowInSeconds.Duration
+}
+
+// CrashTrendTTL is how long an app's daily crash counts are kept.
+func (conf *Config) CrashTrendTTL() time.Duration {
+	return conf.CrashTrendTTLInSeconds.Duration
+}
+
+// RestartReportWindow is how far back the restart report counts restarts.
+func (conf *Config) RestartReportWindow() time.Duration {
+	return conf.RestartReportWindowInSeconds.Duration
+}
+
+// AdminAPIEnabled is true when an admin user is configured.
+func (conf *Config) AdminAPIEnabled() bool {
+	return conf.APIServerAdminUsername != ""
+}
+
+// CellReportsEnabled is true when a cell reports subject is configured.
+func (conf *Config) CellReportsEnabled() bool {
+	return conf.CellReportsNATSSubject != ""
+}
+
+// TimeToReactSLO is how soon after an instance crashes hm9000 should send
+// the start that replaces it.  0 disables counting violations.
+func (conf *Config) TimeToReactSLO() time.Duration {
+	return conf.TimeToReactSLOInSeconds.Duration
+}
+
+// StartEffectivenessWindow is how long the sender waits to see what came of
+// a start it sent.  0 disables tracking start effectiveness.
+func (conf *Config) StartEffectivenessWindow() time.Duration {
+	return conf.StartEffectivenessWindowInSeconds.Duration
+}
+
+func (conf *Config) FetcherRetryDelay() time.Duration {
+	return conf.FetcherRetryDelayInMilliseconds.Duration
+}
+
+// FetcherHostTimeouts are the network timeouts for particular CC hosts,
+// which override FetcherNetworkTimeout.
+func (conf *Config) FetcherHostTimeouts() map[string]time.Duration {
+	timeouts := map[string]time.Duration{}
+	for host, timeout := range conf.FetcherHostTimeoutsInSeconds {
+		timeouts[host] = timeout.Duration
+	}
+	return timeouts
 }
 
 func (conf *Config) SenderPollingInterval() time.Duration {
-	return time.Duration(conf.SenderPollingIntervalInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+	return conf.inHeartbeats(conf.SenderPollingIntervalInHeartbeats)
 }
 
 func (conf *Config) SenderTimeout() time.Duration {
-	return time.Duration(conf.SenderTimeoutInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+	return conf.inHeartbeats(conf.SenderTimeoutInHeartbeats)
 }
 
 func (conf *Config) FetcherPollingInterval() time.Duration {
-	return time.Duration(conf.FetcherPollingIntervalInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+	return conf.inHeartbeats(conf.FetcherPollingIntervalInHeartbeats)
 }
 
 func (conf *Config) FetcherTimeout() time.Duration {
-	return time.Duration(conf.FetcherTimeoutInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+	return conf.inHeartbeats(conf.FetcherTimeoutInHeartbeats)
 }
 
 func (conf *Config) ShredderPollingInterval() time.Duration {
-	return time.Duration(conf.ShredderPollingIntervalInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+	return conf.inHeartbeats(conf.ShredderPollingIntervalInHeartbeats)
 }
 
 func (conf *Config) ShredderTimeout() time.Duration {
-	return time.Duration(conf.ShredderTimeoutInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+	return conf.inHeartbeats(conf.ShredderTimeoutInHeartbeats)
 }
 
 func (conf *Config) AnalyzerPollingInterval() time.Duration {
-	return time.Duration(conf.AnalyzerPollingIntervalInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+	return conf.inHeartbeats(conf.AnalyzerPollingIntervalInHeartbeats)
+}
+
+// AnalyzerMinPollingInterval and AnalyzerMaxPollingInterval bound the
+// analyzer's adaptive polling interval.  Unset, each is the analyzer polling
+// interval, so that with neither set the interval never changes.
+func (conf *Config) AnalyzerMinPollingInterval() time.Duration {
+	if conf.AnalyzerMinPollingIntervalInHeartbeats == 0 {
+		return conf.AnalyzerPollingInterval()
+	}
+	return conf.inHeartbeats(conf.AnalyzerMinPollingIntervalInHeartbeats)
+}
+
+func (conf *Config) AnalyzerMaxPollingInterval() time.Duration {
+	if conf.AnalyzerMaxPollingIntervalInHeartbeats == 0 {
+		return conf.AnalyzerPollingInterval()
+	}
+	return conf.inHeartbeats(conf.AnalyzerMaxPollingIntervalInHeartbeats)
 }
 
 func (conf *Config) AnalyzerTimeout() time.Duration {
-	return time.Duration(conf.AnalyzerTimeoutInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+	return conf.inHeartbeats(conf.AnalyzerTimeoutInHeartbeats)
+}
+
+func (conf *Config) AggregatorPollingInterval() time.Duration {
+	return conf.inHeartbeats(conf.AggregatorPollingIntervalInHeartbeats)
+}
+
+func (conf *Config) AggregatorTimeout() time.Duration {
+	return conf.inHeartbeats(conf.AggregatorTimeoutInHeartbeats)
+}
+
+// AppSummariesFreshnessTTL is how long, in seconds, the app summaries stay
+// fresh after an aggregator run: three of its polling intervals.
+func (conf *Config) AppSummariesFreshnessTTL() uint64 {
+	return 3 * uint64(conf.AggregatorPollingInterval()/time.Second)
+}
+
+// CronSchedule is the cron schedule (fetcher_schedule, ...) the daemon of
+// component (fetcher, analyzer, sender or shredder) runs on instead of its
+// polling interval, or nil if it has none.
+func (conf *Config) CronSchedule(component string) *cron.Schedule {
+	spec := map[string]string{
+		"fetcher":  conf.FetcherSchedule,
+		"analyzer": conf.AnalyzerSchedule,
+		"sender":   conf.SenderSchedule,
+		"shredder": conf.ShredderSchedule,
+	}[component]
+	if spec == "" {
+		return nil
+	}
+
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return nil
+	}
+	return schedule
+}
+
+func (conf *Config) LeaderElectionTTL() time.Duration {
+	return conf.LeaderElectionTTLInSeconds.Duration
+}
+
+func (conf *Config) DaemonJitter() time.Duration {
+	return conf.DaemonJitterInMilliseconds.Duration
+}
+
+func (conf *Config) DaemonMaximumFailureBackoff() time.Duration {
+	return conf.inHeartbeats(conf.DaemonMaximumFailureBackoffInHeartbeats)
+}
+
+func (conf *Config) LogSamplingInterval() time.Duration {
+	return conf.LogSamplingIntervalInSeconds.Duration
+}
+
+func (conf *Config) ShutdownTimeout() time.Duration {
+	return conf.ShutdownTimeoutInSeconds.Duration
+}
+
+func (conf *Config) StartupDependencyRetryDelay() time.Duration {
+	return conf.StartupDependencyRetryDelayInMilliseconds.Duration
 }
 
 func (conf *Config) StartingBackoffDelay() time.Duration {
-	return time.Duration(conf.StartingBackoffDelayInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+	return conf.inHeartbeats(conf.StartingBackoffDelayInHeartbeats)
 }
 
 func (conf *Config) MaximumBackoffDelay() time.Duration {
-	return time.Duration(conf.MaximumBackoffDelayInHeartbeats*int(conf.HeartbeatPeriod)) * time.Second
+	return conf.inHeartbeats(conf.MaximumBackoffDelayInHeartbeats)
 }
 
 func (conf *Config) ListenerHeartbeatSyncInterval() time.Duration {
-	return time.Millisecond * time.Duration(conf.ListenerHeartbeatSyncIntervalInMilliseconds)
+	return conf.ListenerHeartbeatSyncIntervalInMilliseconds.Duration
+}
+
+// ListenerClockSkewThreshold is how far ahead of the listener's clock a
+// DEA's timestamps may be before its clock counts as skewed, or 0 when skew
+// is not checked.
+func (conf *Config) ListenerClockSkewThreshold() time.Duration {
+	return conf.ListenerClockSkewThresholdInSeconds.Duration
+}
+
+// APIServerRateLimitEnabled is true when the API server limits the rate of
+// each requester's requests.
+func (conf *Config) APIServerRateLimitEnabled() bool {
+	return conf.APIServerRateLimitPerSecond > 0
+}
+
+// APIServerRateLimitBurstSize is api_server_rate_limit_burst, or the rate
+// limit itself when no burst is configured.
+func (conf *Config) APIServerRateLimitBurstSize() int {
+	if conf.APIServerRateLimitBurst == 0 {
+		return conf.APIServerRateLimitPerSecond
+	}
+	return conf.APIServerRateLimitBurst
+}
+
+// APIServerTrustedProxyNetworks parses api_server_trusted_proxies, taking a
+// bare address as a range of one.
+func (conf *Config) APIServerTrustedProxyNetworks() ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, proxy := range conf.APIServerTrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// APIServerRequestTimeout is how long the API server gives a request before
+// answering it with a 503, or 0 for as long as it takes.
+func (conf *Config) APIServerRequestTimeout() time.Duration {
+	return conf.APIServerRequestTimeoutInMilliseconds.Duration
+}
+
+// ListenerPriorityAppSet is listener_priority_apps as a set of app guids.
+func (conf *Config) ListenerPriorityAppSet() map[string]bool {
+	priorityApps := map[string]bool{}
+	for _, appGuid := range conf.ListenerPriorityApps {
+		priorityApps[appGuid] = true
+	}
+	return priorityApps
 }
 
 func (conf *Config) StoreHeartbeatCacheRefreshInterval() time.Duration {
-	return time.Millisecond * time.Duration(conf.StoreHeartbeatCacheRefreshIntervalInMilliseconds)
+	return conf.StoreHeartbeatCacheRefreshIntervalInMilliseconds.Duration
+}
+
+func (conf *Config) StoreRequestTimeout() time.Duration {
+	return conf.StoreRequestTimeoutInMilliseconds.Duration
+}
+
+func (conf *Config) StoreRetryDelay() time.Duration {
+	return conf.StoreRetryDelayInMilliseconds.Duration
+}
+
+func (conf *Config) StoreHedgedReadThreshold() time.Duration {
+	return conf.StoreHedgedReadThresholdInMilliseconds.Duration
+}
+
+// StoreMigrationStoreType is the kind of store being migrated to.
+func (conf *Config) StoreMigrationStoreType() string {
+	if conf.StoreMigrationType == "" {
+		return conf.StoreType
+	}
+	return conf.StoreMigrationType
+}
+
+func (conf *Config) StoreReadCacheTTL() time.Duration {
+	return conf.StoreReadCacheTTLInMilliseconds.Duration
+}
+
+func (conf *Config) NATSHealthCheckInterval() time.Duration {
+	return conf.NATSHealthCheckIntervalInSeconds.Duration
 }
 
+func (conf *Config) NATSReconnectJitter() time.Duration {
+	return conf.NATSReconnectJitterInMilliseconds.Duration
+}
+
+func (conf *Config) ServeEventBusMinInterval() time.Duration {
+	return conf.ServeEventBusMinIntervalInMilliseconds.Duration
+}
+
+// EmbeddedNATSServer is the address the embedded NATS server listens on:
+// the first server of the first NATS cluster.
+func (conf *Config) EmbeddedNATSServer() NATSServer {
+	return conf.NATSClusterList()[0].Servers[0]
+}
+
+// NATSClusterList returns nats_clusters, in order of preference.  A config
+// that only has nats gets a single cluster named "default".
+func (conf *Config) NATSClusterList() []NATSCluster {
+	if len(conf.NATSClusters) > 0 {
+		return conf.NATSClusters
+	}
+	return []NATSCluster{{Name: "default", Servers: conf.NATS}}
+}
+
+// LogLevel is the gosteno level named by log_level, in any case, or
+// LOG_INFO if it names none.
 func (conf *Config) LogLevel() gosteno.LogLevel {
-	switch conf.LogLevelString {
-	case "INFO":
-		return gosteno.LOG_INFO
-	case "DEBUG":
-		return gosteno.LOG_DEBUG
-	default:
+	level, err := gosteno.GetLogLevel(strings.ToLower(conf.LogLevelString))
+	if err != nil {
 		return gosteno.LOG_INFO
 	}
+	return level
 }
 
 func DefaultConfig() (*Config, error) {
@@ -202,21 +1045,71 @@ func DefaultConfig() (*Config, error) {
 	return FromFile(pathToJSON)
 }
 
+const (
+	JSONFormat = "json"
+	YAMLFormat = "yaml"
+)
+
+// FormatForPath picks the format of a config file from its extension:
+// .yml and .yaml files are YAML, anything else is JSON.
+func FormatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return YAMLFormat
+	default:
+		return JSONFormat
+	}
+}
+
 func FromFile(path string) (*Config, error) {
-	json, err := ioutil.ReadFile(path)
+	return FromFileInFormat(path, "")
+}
+
+// FromFileInFormat parses the file at path as JSON or YAML.  An empty format
+// picks one from the file's extension.  An explicit format is remembered so
+// that reloading the config parses the file the same way.
+func FromFileInFormat(path string, format string) (*Config, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config *Config
+	switch format {
+	case "":
+		if FormatForPath(path) == YAMLFormat {
+			config, err = FromYAML(contents)
+		} else {
+			config, err = FromJSON(contents)
+		}
+	case JSONFormat:
+		config, err = FromJSON(contents)
+	case YAMLFormat:
+		config, err = FromYAML(contents)
+	default:
+		return nil, fmt.Errorf("unknown config format %q (expected %s or %s)", format, JSONFormat, YAMLFormat)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return FromJSON(json)
+	config.format = format
+	return config, nil
 }
 
+// FromJSON parses a JSON config over the defaults and resolves any secret
+// references among its credentials.
 func FromJSON(JSON []byte) (*Config, error) {
 	config := defaults()
 	err := json.Unmarshal(JSON, &config)
-	if err == nil {
-		return &config, nil
-	} else {
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.resolveAllSecrets()
+	if err != nil {
 		return nil, err
 	}
+
+	return &config, nil
 }
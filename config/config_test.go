@@ -27,9 +27,26 @@ var _ = Describe("Config", func() {
         "cc_auth_password": "testing",
         "cc_base_url": "http://127.0.0.1:6001",
         "skip_cert_verify": true,
+        "fetcher_request_retries": 3,
+        "fetcher_retry_delay_in_milliseconds": 250,
+        "fetcher_max_idle_connections_per_host": 4,
+        "fetcher_host_timeouts_in_seconds": {"cc.example.com": 30},
         "store_schema_version": 1,
+        "store_type": "zookeeper",
         "store_urls": ["http://127.0.0.1:4001"],
         "store_max_concurrent_requests": 30,
+        "secondary_store_urls": ["http://127.0.0.1:4002"],
+        "store_failover_threshold": 7,
+        "store_request_timeout_in_milliseconds": 3000,
+        "store_request_retries": 2,
+        "store_retry_delay_in_milliseconds": 50,
+        "store_read_cache_ttl_in_milliseconds": 2000,
+        "store_read_cache_max_entries": 500,
+        "store_encryption_active_key_label": "new",
+        "store_encryption_keys": [
+            {"label": "old", "key_file": "/var/vcap/jobs/hm9000/config/old.key"},
+            {"label": "new", "key": "YWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWE="}
+        ],
         "sender_nats_start_subject": "hm9000.start",
         "sender_nats_stop_subject": "hm9000.stop",
         "sender_message_limit": 60,
@@ -39,8 +56,15 @@ var _ = Describe("Config", func() {
         "fetcher_timeout_in_heartbeats": 60,
         "shredder_polling_interval_in_heartbeats": 360,
         "shredder_timeout_in_heartbeats": 6,
+        "shredder_schedule": "0 3 * * *",
         "analyzer_polling_interval_in_heartbeats": 1,
         "analyzer_timeout_in_heartbeats": 10,
+        "leader_election_ttl_in_seconds": 15,
+        "leader_election_candidate": "hm9000_z1-0",
+        "daemon_jitter_in_milliseconds": 250,
+        "daemon_maximum_failure_backoff_in_heartbeats": 12,
+        "daemon_max_consecutive_failures": 5,
+        "shutdown_timeout_in_seconds": 45,
         "number_of_crashes_before_backoff_begins": 3,
         "listener_heartbeat_sync_interval_in_milliseconds": 1000,
         "store_heartbeat_cache_refresh_interval_in_milliseconds": 20000,
@@ -55,12 +79,37 @@ var _ = Describe("Config", func() {
         "api_server_password": "orangutan4sale",
         "api_server_address": "0.0.0.0",
         "log_level": "INFO",
+        "log_format": "legacy",
+        "log_sampling_burst": 20,
+        "log_sampling_interval_in_seconds": 5,
+        "log_sinks": [
+            {"type": "stdout"},
+            {"type": "file", "path": "/var/vcap/sys/log/hm9000/hm9000.log", "max_size_in_megabytes": 100, "max_age_in_seconds": "24h", "max_backups": 5}
+        ],
+        "debug_server_address": "127.0.0.1:17017",
+        "pid_file": "/var/vcap/sys/run/hm9000/hm9000.pid",
+        "strict_startup": true,
+        "components": {"analyzer": {"log_level": "DEBUG"}},
         "nats": [{
             "host": "127.0.0.1",
             "port": 4222,
             "user": "",
             "password": ""
-        }]
+        }],
+        "nats_clusters": [
+            {"name": "z1", "servers": [{"host": "10.0.1.1", "port": 4222, "user": "nats", "password": "secret"}]},
+            {"name": "z2", "servers": [{"host": "10.0.2.1", "port": 4222}]}
+        ],
+        "nats_failover_threshold": 4,
+        "nats_health_check_interval_in_seconds": 7,
+        "nats_reconnect_jitter_in_milliseconds": 250,
+        "nats_tls": {
+            "enabled": true,
+            "ca_cert_file": "/var/vcap/jobs/hm9000/config/nats_ca.crt",
+            "client_cert_file": "/var/vcap/jobs/hm9000/config/nats_client.crt",
+            "client_key_file": "/var/vcap/jobs/hm9000/config/nats_client.key",
+            "skip_cert_verify": false
+        }
     }
     `
 
@@ -68,7 +117,7 @@ var _ = Describe("Config", func() {
 		It("deserializes", func() {
 			config, err := FromJSON([]byte(configJSON))
 			Ω(err).ShouldNot(HaveOccurred())
-			Ω(config.HeartbeatPeriod).Should(BeNumerically("==", 11))
+			Ω(config.HeartbeatPeriod.Duration).Should(Equal(11 * time.Second))
 			Ω(config.HeartbeatTTL()).Should(BeNumerically("==", 33))
 			Ω(config.ActualFreshnessTTL()).Should(BeNumerically("==", 33))
 			Ω(config.GracePeriod()).Should(BeNumerically("==", 33))
@@ -80,8 +129,15 @@ var _ = Describe("Config", func() {
 			Ω(config.FetcherTimeout().Seconds()).Should(BeNumerically("==", 660))
 			Ω(config.ShredderPollingInterval().Hours()).Should(BeNumerically("==", 1.1))
 			Ω(config.ShredderTimeout().Minutes()).Should(BeNumerically("==", 1.1))
+			Ω(config.ShredderSchedule).Should(Equal("0 3 * * *"))
 			Ω(config.AnalyzerPollingInterval().Seconds()).Should(BeNumerically("==", 11))
 			Ω(config.AnalyzerTimeout().Seconds()).Should(BeNumerically("==", 110))
+			Ω(config.LeaderElectionTTL()).Should(Equal(15 * time.Second))
+			Ω(config.LeaderElectionCandidate).Should(Equal("hm9000_z1-0"))
+			Ω(config.DaemonJitter()).Should(Equal(250 * time.Millisecond))
+			Ω(config.DaemonMaximumFailureBackoff().Seconds()).Should(BeNumerically("==", 132))
+			Ω(config.DaemonMaxConsecutiveFailures).Should(Equal(5))
+			Ω(config.ShutdownTimeout()).Should(Equal(45 * time.Second))
 
 			Ω(config.NumberOfCrashesBeforeBackoffBegins).Should(BeNumerically("==", 3))
 			Ω(config.StartingBackoffDelay().Seconds()).Should(BeNumerically("==", 33))
@@ -95,13 +151,31 @@ var _ = Describe("Config", func() {
 			Ω(config.CCAuthPassword).Should(Equal("testing"))
 			Ω(config.CCBaseURL).Should(Equal("http://127.0.0.1:6001"))
 			Ω(config.SkipSSLVerification).Should(BeTrue())
+			Ω(config.FetcherRequestRetries).Should(Equal(3))
+			Ω(config.FetcherRetryDelay()).Should(Equal(250 * time.Millisecond))
+			Ω(config.FetcherMaxIdleConnectionsPerHost).Should(Equal(4))
+			Ω(config.FetcherHostTimeouts()).Should(Equal(map[string]time.Duration{"cc.example.com": 30 * time.Second}))
 
 			Ω(config.ListenerHeartbeatSyncInterval()).Should(Equal(time.Second))
 			Ω(config.StoreHeartbeatCacheRefreshInterval()).Should(Equal(20 * time.Second))
 
 			Ω(config.StoreSchemaVersion).Should(Equal(1))
+			Ω(config.StoreType).Should(Equal("zookeeper"))
 			Ω(config.StoreURLs).Should(Equal([]string{"http://127.0.0.1:4001"}))
 			Ω(config.StoreMaxConcurrentRequests).Should(Equal(30))
+			Ω(config.SecondaryStoreURLs).Should(Equal([]string{"http://127.0.0.1:4002"}))
+			Ω(config.StoreFailoverThreshold).Should(Equal(7))
+			Ω(config.StoreRequestTimeout()).Should(Equal(3 * time.Second))
+			Ω(config.StoreRequestRetries).Should(Equal(2))
+			Ω(config.StoreRetryDelay()).Should(Equal(50 * time.Millisecond))
+			Ω(config.StoreReadCacheTTL()).Should(Equal(2 * time.Second))
+			Ω(config.StoreReadCacheMaxEntries).Should(Equal(500))
+			Ω(config.StoreEncryptionActiveKeyLabel).Should(Equal("new"))
+			Ω(config.StoreEncryptionKeys).Should(HaveLen(2))
+			Ω(config.StoreEncryptionKeys[0].Label).Should(Equal("old"))
+			Ω(config.StoreEncryptionKeys[0].KeyFile).Should(Equal("/var/vcap/jobs/hm9000/config/old.key"))
+			Ω(config.StoreEncryptionKeys[1].Label).Should(Equal("new"))
+			Ω(config.StoreEncryptionKeys[1].Key).Should(Equal("YWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWE="))
 
 			Ω(config.SenderNatsStartSubject).Should(Equal("hm9000.start"))
 			Ω(config.SenderNatsStopSubject).Should(Equal("hm9000.stop"))
@@ -122,17 +196,122 @@ var _ = Describe("Config", func() {
 			Ω(config.NATS[0].User).Should(Equal(""))
 			Ω(config.NATS[0].Password).Should(Equal(""))
 
+			Ω(config.NATSClusters).Should(HaveLen(2))
+			Ω(config.NATSClusters[0].Name).Should(Equal("z1"))
+			Ω(config.NATSClusters[0].Servers[0].Password).Should(Equal("secret"))
+			Ω(config.NATSClusters[1].Servers[0].Host).Should(Equal("10.0.2.1"))
+			Ω(config.NATSFailoverThreshold).Should(Equal(4))
+			Ω(config.NATSHealthCheckInterval()).Should(Equal(7 * time.Second))
+			Ω(config.NATSReconnectJitter()).Should(Equal(250 * time.Millisecond))
+
+			Ω(config.NATSTLS.Enabled).Should(BeTrue())
+			Ω(config.NATSTLS.CACertFile).Should(Equal("/var/vcap/jobs/hm9000/config/nats_ca.crt"))
+			Ω(config.NATSTLS.ClientCertFile).Should(Equal("/var/vcap/jobs/hm9000/config/nats_client.crt"))
+			Ω(config.NATSTLS.ClientKeyFile).Should(Equal("/var/vcap/jobs/hm9000/config/nats_client.key"))
+			Ω(config.NATSTLS.SkipVerify).Should(BeFalse())
+
 			Ω(config.LogLevelString).Should(Equal("INFO"))
+			Ω(config.LogFormat).Should(Equal("legacy"))
+			Ω(config.LogSamplingBurst).Should(Equal(20))
+			Ω(config.LogSamplingInterval()).Should(Equal(5 * time.Second))
+			Ω(config.LogSinks).Should(Equal([]LogSink{
+				{Type: "stdout"},
+				{Type: "file", Path: "/var/vcap/sys/log/hm9000/hm9000.log", MaxSizeInMegabytes: 100, MaxAgeInSeconds: DurationInSeconds{24 * time.Hour}, MaxBackups: 5},
+			}))
+			Ω(config.DebugServerAddress).Should(Equal("127.0.0.1:17017"))
+			Ω(config.PIDFile).Should(Equal("/var/vcap/sys/run/hm9000/hm9000.pid"))
+			Ω(config.StrictStartup).Should(BeTrue())
+			Ω(config.Components).Should(Equal(map[string]map[string]interface{}{"analyzer": {"log_level": "DEBUG"}}))
+		})
+	})
+
+	Describe("NATSClusterList", func() {
+		It("returns the configured clusters", func() {
+			config, _ := FromJSON([]byte(configJSON))
+			Ω(config.NATSClusterList()).Should(Equal(config.NATSClusters))
+		})
+
+		It("makes a single cluster of nats when there are none", func() {
+			config, _ := FromJSON([]byte(`{"nats": [{"host": "127.0.0.1", "port": 4222}]}`))
+			clusters := config.NATSClusterList()
+			Ω(clusters).Should(HaveLen(1))
+			Ω(clusters[0].Name).Should(Equal("default"))
+			Ω(clusters[0].Servers).Should(Equal(config.NATS))
+		})
+	})
+
+	Describe("InstanceMissingGracePeriod", func() {
+		It("is the heartbeat TTL unless it is set", func() {
+			config, _ := FromJSON([]byte(configJSON))
+			Ω(config.InstanceMissingGracePeriod()).Should(BeNumerically("==", 33))
+
+			config, _ = FromJSON([]byte(`{"heartbeat_period_in_seconds": 10, "instance_missing_grace_period_in_seconds": 90}`))
+			Ω(config.InstanceMissingGracePeriod()).Should(BeNumerically("==", 90))
+		})
+	})
+
+	Describe("APIServerRateLimitBurstSize", func() {
+		It("is the rate limit unless a burst is set", func() {
+			config, _ := FromJSON([]byte(`{"api_server_rate_limit_per_second": 5}`))
+			Ω(config.APIServerRateLimitBurstSize()).Should(Equal(5))
+
+			config, _ = FromJSON([]byte(`{"api_server_rate_limit_per_second": 5, "api_server_rate_limit_burst": 20}`))
+			Ω(config.APIServerRateLimitBurstSize()).Should(Equal(20))
+		})
+	})
+
+	Describe("MaintenanceWindow", func() {
+		var window MaintenanceWindow
+
+		BeforeEach(func() {
+			window = MaintenanceWindow{
+				Name:              "patching",
+				Schedule:          "0 2 * * *",
+				DurationInSeconds: DurationInSeconds{time.Hour},
+				OrganizationGuids: []string{"org"},
+				AppGuids:          []string{"app"},
+			}
+		})
+
+		It("is open from each time its schedule matches for its duration", func() {
+			Ω(window.IsOpen(time.Date(2014, 6, 1, 1, 59, 0, 0, time.Local))).Should(BeFalse())
+			Ω(window.IsOpen(time.Date(2014, 6, 1, 2, 0, 0, 0, time.Local))).Should(BeTrue())
+			Ω(window.IsOpen(time.Date(2014, 6, 1, 2, 59, 30, 0, time.Local))).Should(BeTrue())
+			Ω(window.IsOpen(time.Date(2014, 6, 1, 3, 0, 30, 0, time.Local))).Should(BeFalse())
+		})
+
+		It("is never open with an invalid schedule", func() {
+			window.Schedule = "0 25 * * *"
+			Ω(window.IsOpen(time.Date(2014, 6, 1, 2, 0, 0, 0, time.Local))).Should(BeFalse())
+		})
+
+		It("matches the apps in its organizations and those it names", func() {
+			Ω(window.Matches("org", "other-app")).Should(BeTrue())
+			Ω(window.Matches("other-org", "app")).Should(BeTrue())
+			Ω(window.Matches("other-org", "other-app")).Should(BeFalse())
+			Ω(window.Matches("", "other-app")).Should(BeFalse())
+		})
+	})
+
+	Describe("StoreMigrationStoreType", func() {
+		It("is the store type unless it is set", func() {
+			config, _ := FromJSON([]byte(`{"store_type": "zookeeper"}`))
+			Ω(config.StoreMigrationStoreType()).Should(Equal("zookeeper"))
+
+			config, _ = FromJSON([]byte(`{"store_type": "zookeeper", "store_migration_type": "etcd"}`))
+			Ω(config.StoreMigrationStoreType()).Should(Equal("etcd"))
 		})
 	})
 
 	Describe("LogLevel", func() {
-		It("should support INFO and DEBUG", func() {
+		It("should support gosteno's levels, in any case", func() {
 			config, _ := FromJSON([]byte(configJSON))
 			config.LogLevelString = "INFO"
 			Ω(config.LogLevel()).Should(Equal(gosteno.LOG_INFO))
 			config.LogLevelString = "DEBUG"
 			Ω(config.LogLevel()).Should(Equal(gosteno.LOG_DEBUG))
+			config.LogLevelString = "warn"
+			Ω(config.LogLevel()).Should(Equal(gosteno.LOG_WARN))
 			config.LogLevelString = "Eggplant"
 			Ω(config.LogLevel()).Should(Equal(gosteno.LOG_INFO))
 		})
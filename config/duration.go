@@ -0,0 +1,99 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DurationInSeconds holds a setting whose name ends in _in_seconds.  It may
+// be given as a duration string ("30s", "5m", "1h30m") or, as it always has
+// been, as a bare number of seconds.
+type DurationInSeconds struct {
+	time.Duration
+}
+
+// DurationInMilliseconds holds a setting whose name ends in
+// _in_milliseconds.  It may be given as a duration string ("250ms", "2s") or
+// as a bare number of milliseconds.
+type DurationInMilliseconds struct {
+	time.Duration
+}
+
+// durationSettings lists, in order, the settings that hold durations.
+func durationSettings() []string {
+	settings := []string{}
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		fieldType := configType.Field(i).Type
+		if fieldType == reflect.TypeOf(DurationInSeconds{}) || fieldType == reflect.TypeOf(DurationInMilliseconds{}) {
+			settings = append(settings, settingName(configType.Field(i)))
+		}
+	}
+	sort.Strings(settings)
+	return settings
+}
+
+func (conf *Config) settingDuration(setting string) time.Duration {
+	return time.Duration(conf.settingFields()[setting].FieldByName("Duration").Int())
+}
+
+func (d *DurationInSeconds) UnmarshalJSON(data []byte) error {
+	return unmarshalDuration(data, time.Second, &d.Duration)
+}
+
+func (d *DurationInSeconds) UnmarshalText(text []byte) error {
+	return parseDuration(string(text), time.Second, &d.Duration)
+}
+
+func (d DurationInSeconds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *DurationInMilliseconds) UnmarshalJSON(data []byte) error {
+	return unmarshalDuration(data, time.Millisecond, &d.Duration)
+}
+
+func (d *DurationInMilliseconds) UnmarshalText(text []byte) error {
+	return parseDuration(string(text), time.Millisecond, &d.Duration)
+}
+
+func (d DurationInMilliseconds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func unmarshalDuration(data []byte, unit time.Duration, duration *time.Duration) error {
+	var text string
+	if strings.HasPrefix(string(data), `"`) {
+		err := json.Unmarshal(data, &text)
+		if err != nil {
+			return err
+		}
+	} else {
+		text = string(data)
+	}
+	return parseDuration(text, unit, duration)
+}
+
+// parseDuration reads a bare number as a multiple of unit and anything else
+// as a time.Duration.
+func parseDuration(text string, unit time.Duration, duration *time.Duration) error {
+	text = strings.TrimSpace(text)
+
+	number, err := strconv.ParseFloat(text, 64)
+	if err == nil {
+		*duration = time.Duration(number * float64(unit))
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return fmt.Errorf("%q is neither a number nor a duration such as \"30s\" or \"5m\"", text)
+	}
+	*duration = parsed
+	return nil
+}
@@ -0,0 +1,110 @@
+package config_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Durations", func() {
+	It("reads bare numbers in the unit the setting is named for", func() {
+		conf, err := FromJSON([]byte(`{
+			"heartbeat_period_in_seconds": 10,
+			"listener_heartbeat_sync_interval_in_milliseconds": 1500,
+			"fetcher_network_timeout_in_seconds": 2.5
+		}`))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(conf.HeartbeatPeriod.Duration).Should(Equal(10 * time.Second))
+		Ω(conf.ListenerHeartbeatSyncInterval()).Should(Equal(1500 * time.Millisecond))
+		Ω(conf.FetcherNetworkTimeout()).Should(Equal(2500 * time.Millisecond))
+	})
+
+	It("reads duration strings", func() {
+		conf, err := FromJSON([]byte(`{
+			"heartbeat_period_in_seconds": "1m",
+			"listener_heartbeat_sync_interval_in_milliseconds": "2s",
+			"store_request_timeout_in_milliseconds": "750ms",
+			"store_read_cache_ttl_in_milliseconds": "1500"
+		}`))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(conf.HeartbeatPeriod.Duration).Should(Equal(time.Minute))
+		Ω(conf.ListenerHeartbeatSyncInterval()).Should(Equal(2 * time.Second))
+		Ω(conf.StoreRequestTimeout()).Should(Equal(750 * time.Millisecond))
+		Ω(conf.StoreReadCacheTTL()).Should(Equal(1500 * time.Millisecond))
+	})
+
+	It("scales the settings counted in heartbeats by the heartbeat period", func() {
+		conf, err := FromJSON([]byte(`{"heartbeat_period_in_seconds": "5s", "analyzer_polling_interval_in_heartbeats": 3, "heartbeat_ttl_in_heartbeats": 4}`))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(conf.AnalyzerPollingInterval()).Should(Equal(15 * time.Second))
+		Ω(conf.HeartbeatTTL()).Should(BeNumerically("==", 20))
+	})
+
+	It("rejects anything else", func() {
+		_, err := FromJSON([]byte(`{"heartbeat_period_in_seconds": "ten seconds"}`))
+		Ω(err).Should(HaveOccurred())
+
+		_, err = FromJSON([]byte(`{"heartbeat_period_in_seconds": true}`))
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("writes durations as strings", func() {
+		encoded, err := json.Marshal(DurationInMilliseconds{1500 * time.Millisecond})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(encoded)).Should(Equal(`"1.5s"`))
+	})
+
+	It("parses overrides of either form", func() {
+		conf, err := DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = conf.ApplyOverrides(map[string]string{
+			"heartbeat_period_in_seconds":           "20",
+			"nats_health_check_interval_in_seconds": "1m",
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(conf.HeartbeatPeriod.Duration).Should(Equal(20 * time.Second))
+		Ω(conf.NATSHealthCheckInterval()).Should(Equal(time.Minute))
+	})
+
+	It("describes changes as durations", func() {
+		conf, err := DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		other := *conf
+		other.StoreRetryDelayInMilliseconds.Duration = 2 * time.Second
+		Ω(conf.Diff(&other)).Should(Equal([]Change{
+			{Setting: "store_retry_delay_in_milliseconds", OldValue: "100ms", NewValue: "2s"},
+		}))
+	})
+
+	Describe("validation", func() {
+		var conf *Config
+
+		BeforeEach(func() {
+			var err error
+			conf, err = DefaultConfig()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("requires the heartbeat period to be a whole number of seconds", func() {
+			conf.HeartbeatPeriod.Duration = 1500 * time.Millisecond
+			err := conf.Validate()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.(ValidationError).Problems).Should(ConsistOf("heartbeat_period_in_seconds must be a positive whole number of seconds"))
+		})
+
+		It("rejects negative durations", func() {
+			conf.StoreRetryDelayInMilliseconds.Duration = -time.Second
+			err := conf.Validate()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.(ValidationError).Problems).Should(ConsistOf("store_retry_delay_in_milliseconds must not be negative"))
+		})
+	})
+})
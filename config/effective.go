@@ -0,0 +1,88 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+const redacted = "[REDACTED]"
+
+// Effective returns every setting conf holds, keyed by its JSON name, after
+// defaults, the component's section and overrides have been applied.
+// Credentials are replaced by "[REDACTED]" (unless they are empty, so that a
+// missing credential still shows up); NATS servers keep their hosts, ports and
+// users.
+func (conf *Config) Effective() (map[string]interface{}, error) {
+	encoded, err := json.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	err = decoder.Decode(&settings)
+	if err != nil {
+		return nil, err
+	}
+
+	for setting, value := range settings {
+		settings[setting] = redactSetting(setting, value)
+	}
+
+	return settings, nil
+}
+
+func redactSetting(setting string, value interface{}) interface{} {
+	switch setting {
+	case "nats":
+		return redactNATSServers(value)
+	case "nats_clusters":
+		clusters, _ := value.([]interface{})
+		for _, cluster := range clusters {
+			if cluster, ok := cluster.(map[string]interface{}); ok {
+				cluster["servers"] = redactNATSServers(cluster["servers"])
+			}
+		}
+		return value
+	case "components":
+		sections, _ := value.(map[string]interface{})
+		for _, section := range sections {
+			if section, ok := section.(map[string]interface{}); ok {
+				for sectionSetting, sectionValue := range section {
+					section[sectionSetting] = redactSetting(sectionSetting, sectionValue)
+				}
+			}
+		}
+		return value
+	}
+
+	if redactedSettings[setting] && !isEmpty(value) {
+		return redacted
+	}
+	return value
+}
+
+func redactNATSServers(value interface{}) interface{} {
+	servers, _ := value.([]interface{})
+	for _, server := range servers {
+		if server, ok := server.(map[string]interface{}); ok && !isEmpty(server["password"]) {
+			server["password"] = redacted
+		}
+	}
+	return value
+}
+
+func isEmpty(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case string:
+		return value == ""
+	case []interface{}:
+		return len(value) == 0
+	case map[string]interface{}:
+		return len(value) == 0
+	}
+	return false
+}
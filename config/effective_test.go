@@ -0,0 +1,84 @@
+package config_test
+
+import (
+	"encoding/json"
+
+	. "github.com/cloudfoundry/hm9000/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Effective", func() {
+	var conf *Config
+
+	BeforeEach(func() {
+		var err error
+		conf, err = FromJSON([]byte(`{
+			"heartbeat_period_in_seconds": 10,
+			"cc_auth_user": "magnet",
+			"cc_auth_password": "orangutan4sale",
+			"api_server_password": "",
+			"sender_signing_secret": "hush",
+			"store_encryption_keys": [{"label": "active", "passphrase": "open sesame"}],
+			"nats": [{"host": "127.0.0.1", "port": 4222, "user": "nats", "password": "nats"}],
+			"nats_clusters": [{"name": "z1", "servers": [{"host": "10.0.1.1", "port": 4222, "user": "nats", "password": "z1-secret"}]}],
+			"components": {"analyzer": {"log_level": "DEBUG", "cc_auth_password": "analyzer-secret"}}
+		}`))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	effective := func() map[string]interface{} {
+		settings, err := conf.Effective()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		encoded, err := json.Marshal(settings)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		decoded := map[string]interface{}{}
+		Ω(json.Unmarshal(encoded, &decoded)).Should(Succeed())
+		return decoded
+	}
+
+	It("includes defaults and overrides", func() {
+		Ω(conf.ApplyOverrides(map[string]string{"sender_message_limit": "12"})).Should(Succeed())
+
+		settings := effective()
+		Ω(settings["sender_message_limit"]).Should(BeNumerically("==", 12))
+		Ω(settings["log_level"]).Should(Equal("INFO"))
+		Ω(settings["heartbeat_period_in_seconds"]).Should(Equal("10s"))
+		Ω(settings["cc_auth_user"]).Should(Equal("magnet"))
+	})
+
+	It("redacts credentials", func() {
+		settings := effective()
+		Ω(settings["cc_auth_password"]).Should(Equal("[REDACTED]"))
+		Ω(settings["store_encryption_keys"]).Should(Equal("[REDACTED]"))
+		Ω(settings["sender_signing_secret"]).Should(Equal("[REDACTED]"))
+
+		nats := settings["nats"].([]interface{})[0].(map[string]interface{})
+		Ω(nats["host"]).Should(Equal("127.0.0.1"))
+		Ω(nats["user"]).Should(Equal("nats"))
+		Ω(nats["password"]).Should(Equal("[REDACTED]"))
+
+		cluster := settings["nats_clusters"].([]interface{})[0].(map[string]interface{})
+		server := cluster["servers"].([]interface{})[0].(map[string]interface{})
+		Ω(server["host"]).Should(Equal("10.0.1.1"))
+		Ω(server["password"]).Should(Equal("[REDACTED]"))
+
+		analyzer := settings["components"].(map[string]interface{})["analyzer"].(map[string]interface{})
+		Ω(analyzer["log_level"]).Should(Equal("DEBUG"))
+		Ω(analyzer["cc_auth_password"]).Should(Equal("[REDACTED]"))
+	})
+
+	It("leaves empty credentials visible", func() {
+		Ω(effective()["api_server_password"]).Should(Equal(""))
+	})
+
+	It("reflects the component's section", func() {
+		var err error
+		conf, err = conf.ForComponent("analyzer")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(effective()["log_level"]).Should(Equal("DEBUG"))
+	})
+})
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvironmentPrefix is prepended to a setting's upper-cased JSON name to
+// form the environment variable that overrides it, e.g.
+// HM9000_HEARTBEAT_PERIOD_IN_SECONDS.
+const EnvironmentPrefix = "HM9000_"
+
+// EnvironmentOverrides picks the settings out of environ (as returned by
+// os.Environ).  Variables that carry the prefix but do not name a setting
+// are ignored: other tools use the prefix too.
+func EnvironmentOverrides(environ []string) map[string]string {
+	settings := map[string]bool{}
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		settings[settingName(configType.Field(i))] = true
+	}
+
+	overrides := map[string]string{}
+	for _, variable := range environ {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], EnvironmentPrefix) {
+			continue
+		}
+
+		setting := strings.ToLower(strings.TrimPrefix(parts[0], EnvironmentPrefix))
+		if setting != "" && settings[setting] {
+			overrides[setting] = parts[1]
+		}
+	}
+	return overrides
+}
+
+// FlagOverrides parses setting=value pairs, as given to --set.
+func FlagOverrides(flags []string) (map[string]string, error) {
+	overrides := map[string]string{}
+	for _, flag := range flags {
+		parts := strings.SplitN(flag, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("config override %q is not of the form setting=value", flag)
+		}
+		overrides[parts[0]] = parts[1]
+	}
+	return overrides, nil
+}
+
+// ApplyOverrides sets each named setting from its string form.  Strings are
+// taken as they are, numbers, booleans and durations are parsed, lists of
+// strings may be comma separated, and anything else (e.g. nats) must be
+// JSON.  Credentials may be given as secret references, as in the file.
+// The overrides are remembered, and re-applied when the config is reloaded.
+func (conf *Config) ApplyOverrides(overrides map[string]string) error {
+	fields := conf.settingFields()
+
+	settings := []string{}
+	for setting := range overrides {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+
+	for _, setting := range settings {
+		field, ok := fields[setting]
+		if !ok {
+			return fmt.Errorf("cannot override unknown config setting %q", setting)
+		}
+
+		err := setFromString(field, overrides[setting])
+		if err != nil {
+			return fmt.Errorf("cannot override config setting %q: %s", setting, err.Error())
+		}
+	}
+
+	err := conf.resolveSecrets(settings)
+	if err != nil {
+		return err
+	}
+
+	if conf.overrides == nil {
+		conf.overrides = map[string]string{}
+	}
+	for setting, override := range overrides {
+		conf.overrides[setting] = override
+	}
+
+	return nil
+}
+
+func setFromString(field reflect.Value, value string) error {
+	if parser, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return parser.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		parsed, err := strconv.ParseInt(value, 10, 0)
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case reflect.Uint64:
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(parsed)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	default:
+		if field.Type() == reflect.TypeOf([]string{}) && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+			field.Set(reflect.ValueOf(strings.Split(value, ",")))
+			return nil
+		}
+
+		parsed := reflect.New(field.Type())
+		err := json.Unmarshal([]byte(value), parsed.Interface())
+		if err != nil {
+			return err
+		}
+		field.Set(parsed.Elem())
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Overrides", func() {
+	var conf *Config
+
+	BeforeEach(func() {
+		var err error
+		conf, err = DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Describe("EnvironmentOverrides", func() {
+		It("picks out the variables that name settings", func() {
+			overrides := EnvironmentOverrides([]string{
+				"HM9000_HEARTBEAT_PERIOD_IN_SECONDS=5",
+				"HM9000_STORE_URLS=http://a:4001,http://b:4001",
+				"HM9000_ZOOKEEPER_URLS=127.0.0.1:2181",
+				"HM9000_=nothing",
+				"PATH=/usr/bin",
+			})
+
+			Ω(overrides).Should(Equal(map[string]string{
+				"heartbeat_period_in_seconds": "5",
+				"store_urls":                  "http://a:4001,http://b:4001",
+			}))
+		})
+	})
+
+	Describe("FlagOverrides", func() {
+		It("parses setting=value pairs", func() {
+			overrides, err := FlagOverrides([]string{"log_level=DEBUG", "cc_base_url=http://cc?x=y"})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(overrides).Should(Equal(map[string]string{
+				"log_level":   "DEBUG",
+				"cc_base_url": "http://cc?x=y",
+			}))
+		})
+
+		It("rejects anything else", func() {
+			_, err := FlagOverrides([]string{"log_level"})
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("ApplyOverrides", func() {
+		It("parses each kind of setting", func() {
+			err := conf.ApplyOverrides(map[string]string{
+				"heartbeat_period_in_seconds": "5",
+				"sender_message_limit":        "20",
+				"skip_cert_verify":            "false",
+				"cc_base_url":                 "http://cc.example.com",
+				"store_urls":                  "http://a:4001,http://b:4001",
+				"secondary_store_urls":        `["http://c:4001"]`,
+				"nats":                        `[{"host": "nats.example.com", "port": 4333, "user": "u", "password": "p"}]`,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(conf.HeartbeatPeriod.Duration).Should(Equal(5 * time.Second))
+			Ω(conf.SenderMessageLimit).Should(Equal(20))
+			Ω(conf.SkipSSLVerification).Should(BeFalse())
+			Ω(conf.CCBaseURL).Should(Equal("http://cc.example.com"))
+			Ω(conf.StoreURLs).Should(Equal([]string{"http://a:4001", "http://b:4001"}))
+			Ω(conf.SecondaryStoreURLs).Should(Equal([]string{"http://c:4001"}))
+			Ω(conf.NATS).Should(HaveLen(1))
+			Ω(conf.NATS[0].Host).Should(Equal("nats.example.com"))
+			Ω(conf.NATS[0].Port).Should(Equal(4333))
+		})
+
+		It("can enable fault injection from the environment", func() {
+			overrides := EnvironmentOverrides([]string{`HM9000_FAULT_INJECTION={"enabled": true, "nats_drop_rate": 0.1, "store_latency_in_milliseconds": 200}`})
+			err := conf.ApplyOverrides(overrides)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(conf.FaultInjection.Enabled).Should(BeTrue())
+			Ω(conf.FaultInjection.NATSDropRate).Should(Equal(0.1))
+			Ω(conf.FaultInjection.StoreLatencyInMilliseconds.Duration).Should(Equal(200 * time.Millisecond))
+		})
+
+		It("rejects unknown settings", func() {
+			err := conf.ApplyOverrides(map[string]string{"no_such_setting": "1"})
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects values that do not parse", func() {
+			err := conf.ApplyOverrides(map[string]string{"sender_message_limit": "lots"})
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("lets later overrides win", func() {
+			conf.ApplyOverrides(map[string]string{"log_level": "DEBUG"})
+			conf.ApplyOverrides(map[string]string{"log_level": "INFO"})
+			Ω(conf.LogLevelString).Should(Equal("INFO"))
+		})
+
+		It("keeps applying across reloads", func() {
+			file, err := ioutil.TempFile("", "hm9000_override_config")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer os.Remove(file.Name())
+			file.Write([]byte(`{"cc_base_url": "http://cc", "store_urls": ["http://a:4001"], "nats": [{"host": "127.0.0.1", "port": 4222}], "desired_state_batch_size": 500, "sender_message_limit": 30}`))
+			file.Close()
+
+			conf, err = FromFile(file.Name())
+			Ω(err).ShouldNot(HaveOccurred())
+			err = conf.ApplyOverrides(map[string]string{"sender_message_limit": "10"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			applied, ignored, err := conf.Reload(file.Name())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(applied).Should(BeEmpty())
+			Ω(ignored).Should(BeEmpty())
+			Ω(conf.SenderMessageLimit).Should(Equal(10))
+		})
+	})
+})
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// reloadableSettings can be changed by reloading the config while the
+// daemons keep running.  Everything else (store and NATS addresses,
+// freshness keys, credentials, ...) is baked into connections and caches
+// when a component starts and only changes on restart.
+var reloadableSettings = map[string]bool{
+	"grace_period_in_heartbeats": true,
+
+	"stopped_app_grace_period_in_seconds": true,
+	"stopped_app_requires_two_syncs":      true,
+	"index_gap_policy":                    true,
+
+	"sender_polling_interval_in_heartbeats":   true,
+	"sender_timeout_in_heartbeats":            true,
+	"fetcher_polling_interval_in_heartbeats":  true,
+	"fetcher_timeout_in_heartbeats":           true,
+	"shredder_polling_interval_in_heartbeats": true,
+	"shredder_timeout_in_heartbeats":          true,
+	"analyzer_polling_interval_in_heartbeats": true,
+	"analyzer_timeout_in_heartbeats":          true,
+
+	"analyzer_min_polling_interval_in_heartbeats": true,
+	"analyzer_max_polling_interval_in_heartbeats": true,
+
+	"fetcher_schedule":  true,
+	"analyzer_schedule": true,
+	"sender_schedule":   true,
+	"shredder_schedule": true,
+
+	"daemon_jitter_in_milliseconds":                true,
+	"daemon_maximum_failure_backoff_in_heartbeats": true,
+	"daemon_max_consecutive_failures":              true,
+	"daemon_watchdog_multiple":                     true,
+	"daemon_watchdog_kills_process":                true,
+
+	"desired_state_batch_size":           true,
+	"fetcher_network_timeout_in_seconds": true,
+	"sender_message_limit":               true,
+	"sender_stops_per_dea_limit":         true,
+	"time_to_react_slo_in_seconds":       true,
+
+	"start_effectiveness_window_in_seconds": true,
+
+	"restart_report_threshold":         true,
+	"restart_report_window_in_seconds": true,
+
+	"app_history_max_events":     true,
+	"app_history_ttl_in_seconds": true,
+
+	"crash_compaction_window_in_seconds": true,
+	"crash_trend_ttl_in_seconds":         true,
+
+	"fetcher_request_retries":               true,
+	"fetcher_retry_delay_in_milliseconds":   true,
+	"fetcher_max_idle_connections_per_host": true,
+	"fetcher_host_timeouts_in_seconds":      true,
+	"fetcher_exclusions":                    true,
+
+	"maintenance_windows":                          true,
+	"maintenance_suppressed_starts_ttl_in_seconds": true,
+
+	"serve_event_bus_min_interval_in_milliseconds": true,
+
+	"number_of_crashes_before_backoff_begins": true,
+	"starting_backoff_delay_in_heartbeats":    true,
+	"maximum_backoff_delay_in_heartbeats":     true,
+
+	"components": true,
+}
+
+// redactedSettings hold credentials, which must not end up in logs.
+var redactedSettings = map[string]bool{
+	"cc_auth_password":          true,
+	"metrics_server_password":   true,
+	"api_server_password":       true,
+	"api_server_admin_password": true,
+	"store_encryption_keys":     true,
+	"sender_signing_secret":     true,
+	"nats":                      true,
+	"nats_clusters":             true,
+	"components":                true,
+	"webhooks":                  true,
+}
+
+// Change describes a setting whose value differs between two configs.
+type Change struct {
+	Setting  string
+	OldValue string
+	NewValue string
+}
+
+func (change Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", change.Setting, change.OldValue, change.NewValue)
+}
+
+// Diff lists the settings whose values differ in other.
+func (conf *Config) Diff(other *Config) []Change {
+	changes := []Change{}
+
+	current := reflect.ValueOf(conf).Elem()
+	updated := reflect.ValueOf(other).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		setting := settingName(current.Type().Field(i))
+		if setting == "" {
+			continue
+		}
+
+		if reflect.DeepEqual(current.Field(i).Interface(), updated.Field(i).Interface()) {
+			continue
+		}
+
+		change := Change{
+			Setting:  setting,
+			OldValue: fmt.Sprintf("%v", current.Field(i).Interface()),
+			NewValue: fmt.Sprintf("%v", updated.Field(i).Interface()),
+		}
+		if redactedSettings[setting] {
+			change.OldValue = "[REDACTED]"
+			change.NewValue = "[REDACTED]"
+		}
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// Reload re-reads the config at path, re-applies the component's section
+// and any overrides, and validates it.  Changes to reloadable settings are
+// applied to conf and returned as applied; changes to other settings are
+// returned as ignored.  An invalid file changes nothing.
+//
+// Reload is not safe to call while components might be reading conf.
+func (conf *Config) Reload(path string) (applied []Change, ignored []Change, err error) {
+	updated, err := FromFileInFormat(path, conf.format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if conf.component != "" {
+		updated, err = updated.ForComponent(conf.component)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(conf.overrides) > 0 {
+		err = updated.ApplyOverrides(conf.overrides)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = updated.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	applied = []Change{}
+	ignored = []Change{}
+	for _, change := range conf.Diff(updated) {
+		if reloadableSettings[change.Setting] {
+			applied = append(applied, change)
+		} else {
+			ignored = append(ignored, change)
+		}
+	}
+
+	current := reflect.ValueOf(conf).Elem()
+	source := reflect.ValueOf(updated).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		if reloadableSettings[settingName(current.Type().Field(i))] {
+			current.Field(i).Set(source.Field(i))
+		}
+	}
+
+	return applied, ignored, nil
+}
+
+func settingName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("json"), ",")[0]
+}
@@ -0,0 +1,94 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/cloudfoundry/hm9000/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reloading", func() {
+	var (
+		conf *Config
+		path string
+	)
+
+	writeConfig := func(JSON string) {
+		err := ioutil.WriteFile(path, []byte(JSON), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	required := `"cc_base_url": "http://127.0.0.1:6001", "nats": [{"host": "127.0.0.1", "port": 4222}], "desired_state_batch_size": 500`
+
+	BeforeEach(func() {
+		file, err := ioutil.TempFile("", "hm9000_reload_config")
+		Ω(err).ShouldNot(HaveOccurred())
+		file.Close()
+		path = file.Name()
+
+		writeConfig(`{` + required + `, "heartbeat_period_in_seconds": 10, "store_urls": ["http://127.0.0.1:4001"], "cc_auth_password": "secret"}`)
+		conf, err = FromFile(path)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Remove(path)
+	})
+
+	Describe("Diff", func() {
+		It("describes changed settings by their JSON names", func() {
+			other := *conf
+			other.AnalyzerPollingIntervalInHeartbeats = 5
+			Ω(conf.Diff(&other)).Should(Equal([]Change{
+				{Setting: "analyzer_polling_interval_in_heartbeats", OldValue: "1", NewValue: "5"},
+			}))
+		})
+
+		It("redacts credentials", func() {
+			other := *conf
+			other.CCAuthPassword = "new-secret"
+			Ω(conf.Diff(&other)).Should(Equal([]Change{
+				{Setting: "cc_auth_password", OldValue: "[REDACTED]", NewValue: "[REDACTED]"},
+			}))
+		})
+	})
+
+	Describe("Reload", func() {
+		It("applies changes to reloadable settings and reports the rest", func() {
+			writeConfig(`{` + required + `, "heartbeat_period_in_seconds": 10, "store_urls": ["http://127.0.0.1:4002"], "cc_auth_password": "secret", "analyzer_polling_interval_in_heartbeats": 3, "sender_message_limit": 20}`)
+
+			applied, ignored, err := conf.Reload(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(applied).Should(ConsistOf(
+				Change{Setting: "analyzer_polling_interval_in_heartbeats", OldValue: "1", NewValue: "3"},
+				Change{Setting: "sender_message_limit", OldValue: "60", NewValue: "20"},
+			))
+			Ω(ignored).Should(Equal([]Change{
+				{Setting: "store_urls", OldValue: "[http://127.0.0.1:4001]", NewValue: "[http://127.0.0.1:4002]"},
+			}))
+
+			Ω(conf.AnalyzerPollingIntervalInHeartbeats).Should(Equal(3))
+			Ω(conf.SenderMessageLimit).Should(Equal(20))
+			Ω(conf.StoreURLs).Should(Equal([]string{"http://127.0.0.1:4001"}))
+		})
+
+		It("changes nothing when the new config is invalid", func() {
+			writeConfig(`{` + required + `, "heartbeat_period_in_seconds": 10, "analyzer_polling_interval_in_heartbeats": 0, "sender_message_limit": 20}`)
+
+			_, _, err := conf.Reload(path)
+			Ω(err).Should(HaveOccurred())
+			Ω(conf.AnalyzerPollingIntervalInHeartbeats).Should(Equal(1))
+			Ω(conf.SenderMessageLimit).Should(Equal(60))
+		})
+
+		It("changes nothing when the file cannot be parsed", func() {
+			writeConfig(`{`)
+
+			_, _, err := conf.Reload(path)
+			Ω(err).Should(HaveOccurred())
+			Ω(conf.SenderMessageLimit).Should(Equal(60))
+		})
+	})
+})
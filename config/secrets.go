@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	FileSecretPrefix        = "file://"
+	EnvironmentSecretPrefix = "env://"
+)
+
+// secretFields maps each credential setting to the values it holds.  NATS
+// has a user and password per server, in every cluster, and each webhook
+// has its own credentials.
+func (conf *Config) secretFields() map[string][]*string {
+	secrets := map[string][]*string{
+		"cc_auth_user":            {&conf.CCAuthUser},
+		"cc_auth_password":        {&conf.CCAuthPassword},
+		"metrics_server_user":     {&conf.MetricsServerUser},
+		"metrics_server_password": {&conf.MetricsServerPassword},
+		"api_server_username":     {&conf.APIServerUsername},
+		"api_server_password":     {&conf.APIServerPassword},
+
+		"api_server_admin_username": {&conf.APIServerAdminUsername},
+		"api_server_admin_password": {&conf.APIServerAdminPassword},
+
+		"sender_signing_secret": {&conf.SenderSigningSecret},
+	}
+
+	for i := range conf.NATS {
+		secrets["nats"] = append(secrets["nats"], &conf.NATS[i].User, &conf.NATS[i].Password)
+	}
+	for i := range conf.Webhooks {
+		secrets["webhooks"] = append(secrets["webhooks"], &conf.Webhooks[i].AuthUser, &conf.Webhooks[i].AuthPassword, &conf.Webhooks[i].AuthToken)
+	}
+	for i := range conf.NATSClusters {
+		for j := range conf.NATSClusters[i].Servers {
+			server := &conf.NATSClusters[i].Servers[j]
+			secrets["nats_clusters"] = append(secrets["nats_clusters"], &server.User, &server.Password)
+		}
+	}
+
+	return secrets
+}
+
+// resolveSecrets replaces references in the named credential settings with
+// the secrets they refer to:
+//
+//	file:///var/vcap/secrets/cc_password  the contents of the file, less any trailing newline
+//	env://CC_PASSWORD                     the value of the environment variable
+//
+// Anything else is taken to be the credential itself.
+func (conf *Config) resolveSecrets(settings []string) error {
+	secrets := conf.secretFields()
+	sort.Strings(settings)
+
+	for _, setting := range settings {
+		for _, value := range secrets[setting] {
+			resolved, err := resolveSecret(*value)
+			if err != nil {
+				return fmt.Errorf("cannot resolve %s: %s", setting, err.Error())
+			}
+			*value = resolved
+		}
+	}
+
+	return nil
+}
+
+func (conf *Config) resolveAllSecrets() error {
+	settings := []string{}
+	for setting := range conf.secretFields() {
+		settings = append(settings, setting)
+	}
+	return conf.resolveSecrets(settings)
+}
+
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, FileSecretPrefix):
+		contents, err := ioutil.ReadFile(strings.TrimPrefix(value, FileSecretPrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	case strings.HasPrefix(value, EnvironmentSecretPrefix):
+		name := strings.TrimPrefix(value, EnvironmentSecretPrefix)
+		secret := os.Getenv(name)
+		if secret == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	default:
+		return value, nil
+	}
+}
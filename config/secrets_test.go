@@ -0,0 +1,73 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/cloudfoundry/hm9000/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Secret references", func() {
+	var secretFile string
+
+	BeforeEach(func() {
+		file, err := ioutil.TempFile("", "hm9000_secret")
+		Ω(err).ShouldNot(HaveOccurred())
+		file.Write([]byte("cc-secret\n"))
+		file.Close()
+		secretFile = file.Name()
+
+		os.Setenv("HM9000_TEST_NATS_PASSWORD", "nats-secret")
+	})
+
+	AfterEach(func() {
+		os.Remove(secretFile)
+		os.Unsetenv("HM9000_TEST_NATS_PASSWORD")
+	})
+
+	It("resolves file and environment references in credentials", func() {
+		conf, err := FromJSON([]byte(`{
+			"cc_auth_user": "magnet",
+			"cc_auth_password": "file://` + secretFile + `",
+			"api_server_password": "env://HM9000_TEST_NATS_PASSWORD",
+			"nats": [{"host": "127.0.0.1", "port": 4222, "user": "nats", "password": "env://HM9000_TEST_NATS_PASSWORD"}],
+			"nats_clusters": [{"name": "z1", "servers": [{"host": "127.0.0.1", "port": 4222, "password": "env://HM9000_TEST_NATS_PASSWORD"}]}]
+		}`))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(conf.CCAuthUser).Should(Equal("magnet"))
+		Ω(conf.CCAuthPassword).Should(Equal("cc-secret"))
+		Ω(conf.APIServerPassword).Should(Equal("nats-secret"))
+		Ω(conf.NATS[0].User).Should(Equal("nats"))
+		Ω(conf.NATS[0].Password).Should(Equal("nats-secret"))
+		Ω(conf.NATSClusters[0].Servers[0].Password).Should(Equal("nats-secret"))
+	})
+
+	It("leaves references in other settings alone", func() {
+		conf, err := FromJSON([]byte(`{"cc_base_url": "env://HM9000_TEST_NATS_PASSWORD"}`))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(conf.CCBaseURL).Should(Equal("env://HM9000_TEST_NATS_PASSWORD"))
+	})
+
+	It("fails when a file cannot be read", func() {
+		_, err := FromJSON([]byte(`{"metrics_server_password": "file:///no/such/secret"}`))
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("metrics_server_password"))
+	})
+
+	It("fails when an environment variable is not set", func() {
+		_, err := FromJSON([]byte(`{"cc_auth_password": "env://HM9000_TEST_NO_SUCH_VARIABLE"}`))
+		Ω(err).Should(MatchError("cannot resolve cc_auth_password: environment variable HM9000_TEST_NO_SUCH_VARIABLE is not set"))
+	})
+
+	It("resolves references given as overrides", func() {
+		conf, err := DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = conf.ApplyOverrides(map[string]string{"cc_auth_password": "file://" + secretFile})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(conf.CCAuthPassword).Should(Equal("cc-secret"))
+	})
+})
@@ -0,0 +1,461 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/gosteno"
+	"github.com/cloudfoundry/hm9000/helpers/cron"
+	"github.com/cloudfoundry/hm9000/helpers/webhooks"
+)
+
+// ValidationError lists everything wrong with a config.
+type ValidationError struct {
+	Problems []string
+}
+
+func (err ValidationError) Error() string {
+	return "invalid config: " + strings.Join(err.Problems, "; ")
+}
+
+// Validate checks that every required setting is present and that no two
+// settings contradict each other.  It returns a ValidationError describing
+// every problem it finds, or nil.
+func (conf *Config) Validate() error {
+	problems := []string{}
+	problem := func(description string) {
+		problems = append(problems, description)
+	}
+
+	if conf.HeartbeatPeriod.Duration < time.Second || conf.HeartbeatPeriod.Duration%time.Second != 0 {
+		problem("heartbeat_period_in_seconds must be a positive whole number of seconds")
+	}
+
+	if conf.StoreType != "etcd" && conf.StoreType != "zookeeper" {
+		problem("store_type must be etcd or zookeeper")
+	}
+	if conf.StoreMigrationType != "" && conf.StoreMigrationType != "etcd" && conf.StoreMigrationType != "zookeeper" {
+		problem("store_migration_type must be etcd or zookeeper")
+	}
+	if conf.StoreHedgedReadThreshold() > 0 && conf.StoreType != "etcd" {
+		problem("store_hedged_read_threshold_in_milliseconds is only supported by the etcd store")
+	}
+	if conf.DropsondePort <= 0 || conf.DropsondePort > 65535 {
+		problem("dropsonde_port must be a valid port")
+	}
+	if conf.StoreAppLayoutVersion != 1 && conf.StoreAppLayoutVersion != 2 {
+		problem("store_app_layout_version must be 1 or 2")
+	}
+	if len(conf.StoreURLs) == 0 {
+		problem("store_urls is required")
+	}
+	if len(conf.NATS) == 0 && len(conf.NATSClusters) == 0 {
+		problem("nats is required")
+	}
+	for _, nats := range conf.NATS {
+		if nats.Host == "" || nats.Port <= 0 {
+			problem("every nats entry needs a host and a port")
+			break
+		}
+	}
+	clusterNames := map[string]bool{}
+	for _, cluster := range conf.NATSClusters {
+		if cluster.Name == "" || clusterNames[cluster.Name] {
+			problem("every nats_clusters entry needs a unique name")
+		}
+		clusterNames[cluster.Name] = true
+
+		if len(cluster.Servers) == 0 {
+			problem("nats cluster " + cluster.Name + " has no servers")
+		}
+		for _, server := range cluster.Servers {
+			if server.Host == "" || server.Port <= 0 {
+				problem("every server in nats cluster " + cluster.Name + " needs a host and a port")
+				break
+			}
+		}
+	}
+	if (conf.NATSTLS.ClientCertFile == "") != (conf.NATSTLS.ClientKeyFile == "") {
+		problem("nats_tls needs both a client_cert_file and a client_key_file, or neither")
+	}
+	if !conf.NATSTLS.Enabled && (conf.NATSTLS.CACertFile != "" || conf.NATSTLS.ClientCertFile != "") {
+		problem("nats_tls has certificates but is not enabled")
+	}
+	if conf.EmbeddedNATS && conf.NATSTLS.Enabled {
+		problem("embedded_nats does not support nats_tls")
+	}
+	if conf.CCBaseURL == "" {
+		problem("cc_base_url is required")
+	}
+	if conf.ActualFreshnessKey == "" || conf.DesiredFreshnessKey == "" {
+		problem("actual_freshness_key and desired_freshness_key are required")
+	}
+
+	positiveSettings := map[string]int{
+		"sender_polling_interval_in_heartbeats":     conf.SenderPollingIntervalInHeartbeats,
+		"sender_timeout_in_heartbeats":              conf.SenderTimeoutInHeartbeats,
+		"fetcher_polling_interval_in_heartbeats":    conf.FetcherPollingIntervalInHeartbeats,
+		"fetcher_timeout_in_heartbeats":             conf.FetcherTimeoutInHeartbeats,
+		"shredder_polling_interval_in_heartbeats":   conf.ShredderPollingIntervalInHeartbeats,
+		"shredder_timeout_in_heartbeats":            conf.ShredderTimeoutInHeartbeats,
+		"analyzer_polling_interval_in_heartbeats":   conf.AnalyzerPollingIntervalInHeartbeats,
+		"analyzer_timeout_in_heartbeats":            conf.AnalyzerTimeoutInHeartbeats,
+		"aggregator_polling_interval_in_heartbeats": conf.AggregatorPollingIntervalInHeartbeats,
+		"aggregator_timeout_in_heartbeats":          conf.AggregatorTimeoutInHeartbeats,
+		"desired_state_batch_size":                  conf.DesiredStateBatchSize,
+		"sender_message_limit":                      conf.SenderMessageLimit,
+		"nats_failover_threshold":                   conf.NATSFailoverThreshold,
+	}
+	settings := []string{}
+	for setting := range positiveSettings {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+	for _, setting := range settings {
+		if positiveSettings[setting] <= 0 {
+			problem(setting + " must be positive")
+		}
+	}
+	if conf.NATSHealthCheckIntervalInSeconds.Duration <= 0 {
+		problem("nats_health_check_interval_in_seconds must be positive")
+	}
+	if conf.DeaShutdownScheduledSubject != "" && conf.DeaShutdownScheduledTTL() < time.Second {
+		problem("dea_shutdown_scheduled_ttl_in_seconds must be at least one second")
+	}
+	if conf.EvacuatorRetryBufferSize < 0 {
+		problem("evacuator_retry_buffer_size must not be negative")
+	}
+	if conf.EvacuatorRetries < 0 {
+		problem("evacuator_retries must not be negative")
+	}
+	if conf.EvacuatorRetryBufferSize > 0 && conf.EvacuatorRetryInterval() <= 0 {
+		problem("evacuator_retry_interval_in_milliseconds must be positive when evacuator_retry_buffer_size is set")
+	}
+	if conf.ShutdownTimeout() <= 0 {
+		problem("shutdown_timeout_in_seconds must be positive")
+	}
+	if conf.LeaderElectionTTL() < time.Second {
+		problem("leader_election_ttl_in_seconds must be at least one second")
+	}
+	if conf.DaemonMaximumFailureBackoffInHeartbeats < 0 {
+		problem("daemon_maximum_failure_backoff_in_heartbeats must not be negative")
+	}
+	if conf.DaemonWatchdogMultiple < 0 {
+		problem("daemon_watchdog_multiple must not be negative")
+	}
+	if conf.DaemonMaxConsecutiveFailures < 0 {
+		problem("daemon_max_consecutive_failures must not be negative")
+	}
+	if conf.FaultInjection.StoreLatencyInMilliseconds.Duration < 0 {
+		problem("fault_injection: store_latency_in_milliseconds must not be negative")
+	}
+	faultRates := map[string]float64{
+		"store_latency_rate": conf.FaultInjection.StoreLatencyRate,
+		"nats_drop_rate":     conf.FaultInjection.NATSDropRate,
+		"cc_failure_rate":    conf.FaultInjection.CCFailureRate,
+	}
+	for _, setting := range []string{"store_latency_rate", "nats_drop_rate", "cc_failure_rate"} {
+		if faultRates[setting] < 0 || faultRates[setting] > 1 {
+			problem("fault_injection: " + setting + " must be between 0 and 1")
+		}
+	}
+	if conf.SenderStopsPerDeaLimit < 0 {
+		problem("sender_stops_per_dea_limit must not be negative")
+	}
+	if conf.RestartReportThreshold < 0 {
+		problem("restart_report_threshold must not be negative")
+	}
+	if conf.RestartReportWindow() < time.Second {
+		problem("restart_report_window_in_seconds must be at least one second")
+	}
+	if conf.MetricsJob != "" && conf.MetricsOrigin == "" {
+		problem("metrics_origin must be set when metrics_job is set")
+	}
+	if conf.MetricsIndex < 0 {
+		problem("metrics_index must not be negative")
+	}
+	if conf.ListenerLoadSheddingThreshold < 0 {
+		problem("listener_load_shedding_threshold must not be negative")
+	}
+	if conf.ListenerHeartbeatSamplingCohorts < 0 {
+		problem("listener_heartbeat_sampling_cohorts must not be negative")
+	}
+	if conf.ListenerHeartbeatSamplingCohorts > 0 && conf.ListenerLoadSheddingThreshold > 0 {
+		problem("listener_heartbeat_sampling_cohorts and listener_load_shedding_threshold cannot both be set")
+	}
+	if conf.AppHistoryMaxEvents < 0 {
+		problem("app_history_max_events must not be negative")
+	}
+	if conf.AppHistoryEnabled() && conf.AppHistoryTTL() < time.Second {
+		problem("app_history_ttl_in_seconds must be at least one second")
+	}
+	if conf.CrashCompactionEnabled() && conf.AppHistoryTTL() >= time.Second && conf.CrashCompactionWindow() >= conf.AppHistoryTTL() {
+		problem("crash_compaction_window_in_seconds must be less than app_history_ttl_in_seconds, or crashes expire before they are compacted")
+	}
+	if conf.CrashCompactionEnabled() && conf.CrashTrendTTL() < 24*time.Hour {
+		problem("crash_trend_ttl_in_seconds must be at least a day")
+	}
+	if conf.StartupDependencyRetries < 0 {
+		problem("startup_dependency_retries must not be negative")
+	}
+	if conf.FetcherRequestRetries < 0 {
+		problem("fetcher_request_retries must not be negative")
+	}
+	if conf.FetcherAppCountTolerance < 0 || conf.FetcherAppCountTolerance >= 1 {
+		problem("fetcher_app_count_tolerance must be at least 0 and less than 1")
+	}
+	if conf.FetcherMaxIdleConnectionsPerHost < 0 {
+		problem("fetcher_max_idle_connections_per_host must not be negative")
+	}
+	for host, timeout := range conf.FetcherHostTimeouts() {
+		if timeout <= 0 {
+			problem("fetcher_host_timeouts_in_seconds for " + host + " must be positive")
+		}
+	}
+	if _, err := regexp.Compile(conf.FetcherExclusions.NameRegex); err != nil {
+		problem("fetcher_exclusions: name_regex must be a regular expression: " + err.Error())
+	}
+
+	if conf.AnalyzerMinPollingIntervalInHeartbeats < 0 || conf.AnalyzerMinPollingIntervalInHeartbeats > conf.AnalyzerPollingIntervalInHeartbeats {
+		problem("analyzer_min_polling_interval_in_heartbeats must be between 0 and analyzer_polling_interval_in_heartbeats")
+	}
+	if conf.AnalyzerMaxPollingIntervalInHeartbeats != 0 && conf.AnalyzerMaxPollingIntervalInHeartbeats < conf.AnalyzerPollingIntervalInHeartbeats {
+		problem("analyzer_max_polling_interval_in_heartbeats must be 0 or at least analyzer_polling_interval_in_heartbeats")
+	}
+
+	if conf.InstanceMissingGracePeriodInSeconds.Duration > 0 && conf.InstanceMissingGracePeriodInSeconds.Duration < conf.HeartbeatPeriod.Duration {
+		problem("instance_missing_grace_period_in_seconds must be 0 or at least heartbeat_period_in_seconds, or instances go missing between heartbeats")
+	}
+
+	if conf.HeartbeatPeriod.Duration > 0 {
+		if conf.ListenerHeartbeatSyncInterval() >= time.Duration(conf.ActualFreshnessTTL())*time.Second {
+			problem("listener_heartbeat_sync_interval_in_milliseconds must be shorter than the actual freshness TTL, or the actual state goes stale between syncs")
+		}
+		if conf.FetcherPollingIntervalInHeartbeats > 0 && uint64(conf.FetcherPollingInterval().Seconds()) >= conf.DesiredFreshnessTTL() {
+			problem("fetcher_polling_interval_in_heartbeats must be shorter than desired_freshness_ttl_in_heartbeats, or the desired state goes stale between fetches")
+		}
+	}
+
+	cronSettings := map[string]string{
+		"fetcher_schedule":  conf.FetcherSchedule,
+		"analyzer_schedule": conf.AnalyzerSchedule,
+		"sender_schedule":   conf.SenderSchedule,
+		"shredder_schedule": conf.ShredderSchedule,
+	}
+	settings = []string{}
+	for setting := range cronSettings {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+	for _, setting := range settings {
+		if cronSettings[setting] == "" {
+			continue
+		}
+		if _, err := cron.Parse(cronSettings[setting]); err != nil {
+			problem(setting + " must be a cron expression, e.g. \"0 3 * * *\": " + err.Error())
+		}
+	}
+	windowNames := map[string]bool{}
+	for _, window := range conf.MaintenanceWindows {
+		if window.Name == "" {
+			problem("maintenance_windows: every window must have a name")
+		} else if windowNames[window.Name] {
+			problem("maintenance_windows: " + window.Name + " is named more than once")
+		}
+		windowNames[window.Name] = true
+		if _, err := cron.Parse(window.Schedule); err != nil {
+			problem("maintenance_windows: " + window.Name + ": schedule must be a cron expression, e.g. \"0 3 * * *\": " + err.Error())
+		}
+		if window.DurationInSeconds.Duration <= 0 {
+			problem("maintenance_windows: " + window.Name + ": duration_in_seconds must be positive")
+		}
+		if len(window.OrganizationGuids) == 0 && len(window.AppGuids) == 0 {
+			problem("maintenance_windows: " + window.Name + ": organization_guids or app_guids must be set")
+		}
+	}
+	if len(conf.MaintenanceWindows) > 0 && conf.MaintenanceSuppressedStartsTTL() < time.Second {
+		problem("maintenance_suppressed_starts_ttl_in_seconds must be at least one second")
+	}
+	if schedule := conf.CronSchedule("fetcher"); schedule != nil && longestGap(schedule, 10) >= time.Duration(conf.DesiredFreshnessTTL())*time.Second {
+		problem("fetcher_schedule must run more often than desired_freshness_ttl_in_heartbeats, or the desired state goes stale between fetches")
+	}
+
+	for _, setting := range durationSettings() {
+		if conf.settingDuration(setting) < 0 {
+			problem(setting + " must not be negative")
+		}
+	}
+
+	if _, err := gosteno.GetLogLevel(strings.ToLower(conf.LogLevelString)); err != nil {
+		problem("log_level must be one of ERROR, WARN, INFO, DEBUG, DEBUG1 or DEBUG2")
+	}
+	if conf.LogFormat != "json" && conf.LogFormat != "legacy" {
+		problem("log_format must be json or legacy")
+	}
+	if conf.IndexGapPolicy != "strict" && conf.IndexGapPolicy != "tolerant" {
+		problem("index_gap_policy must be strict or tolerant")
+	}
+	if conf.LogSamplingBurst < 0 {
+		problem("log_sampling_burst must not be negative")
+	}
+	if conf.LogSamplingBurst > 0 && conf.LogSamplingInterval() <= 0 {
+		problem("log_sampling_interval_in_seconds must be positive when log_sampling_burst is set")
+	}
+	for i, sink := range conf.LogSinks {
+		sinkProblem := func(description string) {
+			problem(fmt.Sprintf("log_sinks[%d]: %s", i, description))
+		}
+		switch sink.Type {
+		case "stdout":
+		case "syslog":
+			if sink.Network != "" && sink.Network != "udp" && sink.Network != "tcp" {
+				sinkProblem("network must be udp or tcp")
+			}
+			if sink.Network != "" && sink.Address == "" {
+				sinkProblem("address is required when network is set")
+			}
+			if sink.Address != "" {
+				if _, _, err := net.SplitHostPort(sink.Address); err != nil {
+					sinkProblem("address must be a host:port, e.g. syslog.example.com:514")
+				}
+			}
+		case "file":
+			if sink.Path == "" {
+				sinkProblem("path is required")
+			}
+			if sink.MaxSizeInMegabytes < 0 || sink.MaxAgeInSeconds.Duration < 0 || sink.MaxBackups < 0 {
+				sinkProblem("max_size_in_megabytes, max_age_in_seconds and max_backups must not be negative")
+			}
+		default:
+			sinkProblem("type must be stdout, syslog or file")
+		}
+	}
+
+	if conf.DebugServerAddress != "" {
+		if _, _, err := net.SplitHostPort(conf.DebugServerAddress); err != nil {
+			problem("debug_server_address must be a host:port, e.g. 127.0.0.1:17017")
+		}
+	}
+
+	if conf.StartingBackoffDelayInHeartbeats > conf.MaximumBackoffDelayInHeartbeats {
+		problem("starting_backoff_delay_in_heartbeats must not exceed maximum_backoff_delay_in_heartbeats")
+	}
+
+	if conf.StoreEncryptionActiveKeyLabel != "" {
+		found := false
+		for _, key := range conf.StoreEncryptionKeys {
+			if key.Label == conf.StoreEncryptionActiveKeyLabel {
+				found = true
+			}
+		}
+		if !found {
+			problem("store_encryption_active_key_label must name one of the store_encryption_keys")
+		}
+	}
+
+	if conf.APIServerRateLimitPerSecond < 0 {
+		problem("api_server_rate_limit_per_second must not be negative")
+	}
+	if conf.APIServerRateLimitBurst < 0 {
+		problem("api_server_rate_limit_burst must not be negative")
+	}
+	if conf.APIServerRateLimitMaxRequesters < 0 {
+		problem("api_server_rate_limit_max_requesters must not be negative")
+	}
+	if _, err := conf.APIServerTrustedProxyNetworks(); err != nil {
+		problem(fmt.Sprintf("api_server_trusted_proxies: %s", err.Error()))
+	}
+	if conf.APIServerMaxRequestsInFlight < 0 {
+		problem("api_server_max_requests_in_flight must not be negative")
+	}
+	if conf.APIServerMaxRequestsInFlight > 0 && conf.APIServerRequestTimeout() == 0 {
+		problem("api_server_request_timeout_in_milliseconds must be positive when api_server_max_requests_in_flight is set")
+	}
+
+	if conf.AdminAPIEnabled() {
+		if conf.APIServerAdminPassword == "" {
+			problem("api_server_admin_password must be set when api_server_admin_username is")
+		}
+		if conf.APIServerAdminUsername == conf.APIServerUsername {
+			problem("api_server_admin_username must differ from api_server_username")
+		}
+		if conf.AdminNATSSubject == "" {
+			problem("admin_nats_subject must be set when api_server_admin_username is")
+		}
+	}
+
+	for i, webhook := range conf.Webhooks {
+		webhookProblem := func(description string) {
+			problem(fmt.Sprintf("webhooks[%d]: %s", i, description))
+		}
+		if parsed, err := url.Parse(webhook.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			webhookProblem("url must be an http or https URL")
+		}
+		for _, event := range webhook.Events {
+			if !isWebhookEvent(event) {
+				webhookProblem(event + " is not an event (expected one of " + strings.Join(webhooks.EventTypes, ", ") + ")")
+			}
+		}
+		if webhook.AuthUser != "" && webhook.AuthToken != "" {
+			webhookProblem("give auth_user and auth_password or auth_token, not both")
+		}
+		if webhook.Retries < 0 {
+			webhookProblem("retries must not be negative")
+		}
+		if webhook.TimeoutInSeconds.Duration < 0 || webhook.RetryDelayInMilliseconds.Duration < 0 {
+			webhookProblem("timeout_in_seconds and retry_delay_in_milliseconds must not be negative")
+		}
+	}
+
+	sections := []string{}
+	for component := range conf.Components {
+		sections = append(sections, component)
+	}
+	sort.Strings(sections)
+	for _, component := range sections {
+		if !isComponentName(component) {
+			problem("components." + component + " is not a component (expected one of " + strings.Join(ComponentNames, ", ") + ")")
+			continue
+		}
+		_, err := conf.ForComponent(component)
+		if err != nil {
+			problem(err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// longestGap is the longest time between two of the next runs of schedule.
+func longestGap(schedule *cron.Schedule, runs int) time.Duration {
+	longest := time.Duration(0)
+	run := schedule.Next(time.Now())
+	for i := 0; i < runs && !run.IsZero(); i++ {
+		next := schedule.Next(run)
+		if next.IsZero() {
+			break
+		}
+		if next.Sub(run) > longest {
+			longest = next.Sub(run)
+		}
+		run = next
+	}
+	return longest
+}
+
+func isWebhookEvent(event string) bool {
+	for _, eventType := range webhooks.EventTypes {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
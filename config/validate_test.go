@@ -0,0 +1,472 @@
+package config_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validate", func() {
+	var conf *Config
+
+	BeforeEach(func() {
+		var err error
+		conf, err = DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	problems := func() []string {
+		err := conf.Validate()
+		Ω(err).Should(HaveOccurred())
+		return err.(ValidationError).Problems
+	}
+
+	It("accepts the default config", func() {
+		Ω(conf.Validate()).Should(Succeed())
+	})
+
+	It("requires the store, NATS and CC endpoints", func() {
+		conf.StoreURLs = []string{}
+		conf.NATS = nil
+		conf.CCBaseURL = ""
+
+		Ω(problems()).Should(ConsistOf(
+			"store_urls is required",
+			"nats is required",
+			"cc_base_url is required",
+		))
+	})
+
+	It("rejects unknown store types", func() {
+		conf.StoreType = "consul"
+		Ω(problems()).Should(ConsistOf("store_type must be etcd or zookeeper"))
+	})
+
+	It("only hedges reads from etcd", func() {
+		conf.StoreHedgedReadThresholdInMilliseconds.Duration = 50 * time.Millisecond
+		Ω(conf.Validate()).Should(Succeed())
+
+		conf.StoreType = "zookeeper"
+		Ω(problems()).Should(ConsistOf("store_hedged_read_threshold_in_milliseconds is only supported by the etcd store"))
+	})
+
+	It("rejects unknown store migration types", func() {
+		conf.StoreMigrationType = "consul"
+		Ω(problems()).Should(ConsistOf("store_migration_type must be etcd or zookeeper"))
+	})
+
+	It("requires a TTL for scheduled DEA shutdowns when they are listened for", func() {
+		conf.DeaShutdownScheduledTTLInSeconds.Duration = 0
+		Ω(conf.Validate()).Should(Succeed())
+
+		conf.DeaShutdownScheduledSubject = "dea.shutdown_scheduled"
+		Ω(problems()).Should(ConsistOf("dea_shutdown_scheduled_ttl_in_seconds must be at least one second"))
+	})
+
+	It("rejects a negative evacuator retry buffer or retries", func() {
+		conf.EvacuatorRetryBufferSize = -1
+		conf.EvacuatorRetries = -1
+		Ω(problems()).Should(ConsistOf("evacuator_retry_buffer_size must not be negative", "evacuator_retries must not be negative"))
+	})
+
+	It("requires an evacuator retry interval when starts are buffered", func() {
+		conf.EvacuatorRetryIntervalInMilliseconds.Duration = 0
+		Ω(problems()).Should(ConsistOf("evacuator_retry_interval_in_milliseconds must be positive when evacuator_retry_buffer_size is set"))
+
+		conf.EvacuatorRetryBufferSize = 0
+		Ω(conf.Validate()).Should(Succeed())
+	})
+
+	It("rejects unknown store app layouts", func() {
+		conf.StoreAppLayoutVersion = 3
+		Ω(problems()).Should(ConsistOf("store_app_layout_version must be 1 or 2"))
+	})
+
+	It("rejects an invalid dropsonde port", func() {
+		conf.DropsondePort = 0
+		Ω(problems()).Should(ConsistOf("dropsonde_port must be a valid port"))
+	})
+
+	It("rejects intervals that must be positive", func() {
+		conf.AnalyzerPollingIntervalInHeartbeats = 0
+		conf.SenderMessageLimit = -1
+		conf.AggregatorTimeoutInHeartbeats = 0
+		Ω(problems()).Should(ConsistOf(
+			"analyzer_polling_interval_in_heartbeats must be positive",
+			"sender_message_limit must be positive",
+			"aggregator_timeout_in_heartbeats must be positive",
+		))
+	})
+
+	It("rejects a listener sync interval that outlasts the actual freshness TTL", func() {
+		conf.ListenerHeartbeatSyncIntervalInMilliseconds.Duration = time.Duration(conf.ActualFreshnessTTL()) * time.Second
+		Ω(problems()).Should(HaveLen(1))
+		Ω(problems()[0]).Should(ContainSubstring("listener_heartbeat_sync_interval_in_milliseconds"))
+	})
+
+	It("rejects a fetcher polling interval that outlasts the desired freshness TTL", func() {
+		conf.FetcherPollingIntervalInHeartbeats = int(conf.DesiredFreshnessTTLInHeartbeats)
+		Ω(problems()).Should(HaveLen(1))
+		Ω(problems()[0]).Should(ContainSubstring("fetcher_polling_interval_in_heartbeats"))
+	})
+
+	It("accepts nats_clusters in place of nats", func() {
+		conf.NATS = nil
+		conf.NATSClusters = []NATSCluster{{Name: "z1", Servers: []NATSServer{{Host: "10.0.1.1", Port: 4222}}}}
+		Ω(conf.Validate()).Should(Succeed())
+	})
+
+	It("rejects NATS clusters without unique names or servers", func() {
+		conf.NATSClusters = []NATSCluster{
+			{Name: "z1", Servers: []NATSServer{{Host: "10.0.1.1", Port: 4222}}},
+			{Name: "z1", Servers: []NATSServer{{Host: "10.0.2.1"}}},
+			{Name: "z3"},
+		}
+		Ω(problems()).Should(ConsistOf(
+			"every nats_clusters entry needs a unique name",
+			"every server in nats cluster z1 needs a host and a port",
+			"nats cluster z3 has no servers",
+		))
+	})
+
+	It("rejects half a NATS client certificate", func() {
+		conf.NATSTLS.Enabled = true
+		conf.NATSTLS.ClientCertFile = "/path/to/client.crt"
+		Ω(problems()).Should(ConsistOf("nats_tls needs both a client_cert_file and a client_key_file, or neither"))
+	})
+
+	It("rejects NATS certificates when TLS is not enabled", func() {
+		conf.NATSTLS.CACertFile = "/path/to/ca.crt"
+		Ω(problems()).Should(ConsistOf("nats_tls has certificates but is not enabled"))
+	})
+
+	It("rejects an embedded NATS server with TLS", func() {
+		conf.EmbeddedNATS = true
+		conf.NATSTLS.Enabled = true
+		Ω(problems()).Should(ConsistOf("embedded_nats does not support nats_tls"))
+	})
+
+	It("rejects a negative event bus interval", func() {
+		conf.ServeEventBusMinIntervalInMilliseconds.Duration = -time.Millisecond
+		Ω(problems()).Should(ConsistOf("serve_event_bus_min_interval_in_milliseconds must not be negative"))
+	})
+
+	It("rejects a leader election TTL shorter than a second", func() {
+		conf.LeaderElectionTTLInSeconds.Duration = 500 * time.Millisecond
+		Ω(problems()).Should(ConsistOf("leader_election_ttl_in_seconds must be at least one second"))
+	})
+
+	It("rejects an unknown log level", func() {
+		conf.LogLevelString = "LOUD"
+		Ω(problems()).Should(ConsistOf("log_level must be one of ERROR, WARN, INFO, DEBUG, DEBUG1 or DEBUG2"))
+	})
+
+	It("rejects an unknown log format", func() {
+		conf.LogFormat = "xml"
+		Ω(problems()).Should(ConsistOf("log_format must be json or legacy"))
+	})
+
+	It("rejects an unknown index gap policy", func() {
+		conf.IndexGapPolicy = "loose"
+		Ω(problems()).Should(ConsistOf("index_gap_policy must be strict or tolerant"))
+	})
+
+	It("rejects log sampling without an interval", func() {
+		conf.LogSamplingBurst = 10
+		conf.LogSamplingIntervalInSeconds.Duration = 0
+		Ω(problems()).Should(ConsistOf("log_sampling_interval_in_seconds must be positive when log_sampling_burst is set"))
+	})
+
+	It("accepts cron schedules", func() {
+		conf.ShredderSchedule = "0 3 * * *"
+		conf.FetcherSchedule = "* * * * *"
+		Ω(conf.Validate()).Should(Succeed())
+		Ω(conf.CronSchedule("shredder").String()).Should(Equal("0 3 * * *"))
+		Ω(conf.CronSchedule("analyzer")).Should(BeNil())
+	})
+
+	It("rejects invalid cron schedules", func() {
+		conf.SenderSchedule = "0 25 * * *"
+		Ω(problems()).Should(ConsistOf(HavePrefix(`sender_schedule must be a cron expression, e.g. "0 3 * * *": `)))
+	})
+
+	It("rejects incomplete maintenance windows", func() {
+		conf.MaintenanceWindows = []MaintenanceWindow{
+			{Schedule: "0 2 * * *", DurationInSeconds: DurationInSeconds{time.Hour}, AppGuids: []string{"app"}},
+			{Name: "patching", Schedule: "0 25 * * *", AppGuids: []string{"app"}},
+			{Name: "patching", Schedule: "0 2 * * *", DurationInSeconds: DurationInSeconds{time.Hour}},
+		}
+		Ω(problems()).Should(ConsistOf(
+			"maintenance_windows: every window must have a name",
+			HavePrefix(`maintenance_windows: patching: schedule must be a cron expression, e.g. "0 3 * * *": `),
+			"maintenance_windows: patching: duration_in_seconds must be positive",
+			"maintenance_windows: patching is named more than once",
+			"maintenance_windows: patching: organization_guids or app_guids must be set",
+		))
+	})
+
+	It("rejects keeping suppressed starts for less than a second while there are maintenance windows", func() {
+		conf.MaintenanceWindows = []MaintenanceWindow{
+			{Name: "patching", Schedule: "0 2 * * *", DurationInSeconds: DurationInSeconds{time.Hour}, AppGuids: []string{"app"}},
+		}
+		conf.MaintenanceSuppressedStartsTTLInSeconds.Duration = 0
+		Ω(problems()).Should(ConsistOf("maintenance_suppressed_starts_ttl_in_seconds must be at least one second"))
+	})
+
+	It("rejects a fetcher schedule that lets the desired state go stale", func() {
+		conf.FetcherSchedule = "@hourly"
+		Ω(problems()).Should(ConsistOf("fetcher_schedule must run more often than desired_freshness_ttl_in_heartbeats, or the desired state goes stale between fetches"))
+	})
+
+	It("accepts stdout, syslog and file log sinks", func() {
+		conf.LogSinks = []LogSink{
+			{Type: "stdout"},
+			{Type: "syslog"},
+			{Type: "syslog", Network: "tcp", Address: "syslog.example.com:514"},
+			{Type: "file", Path: "/var/vcap/sys/log/hm9000/hm9000.log", MaxSizeInMegabytes: 100, MaxBackups: 5},
+		}
+		Ω(conf.Validate()).Should(Succeed())
+	})
+
+	It("rejects unknown and incomplete log sinks", func() {
+		conf.LogSinks = []LogSink{
+			{Type: "kafka"},
+			{Type: "syslog", Network: "tcp"},
+			{Type: "syslog", Network: "sctp", Address: "syslog.example.com:514"},
+			{Type: "file", MaxBackups: -1},
+		}
+		Ω(problems()).Should(ConsistOf(
+			"log_sinks[0]: type must be stdout, syslog or file",
+			"log_sinks[1]: address is required when network is set",
+			"log_sinks[2]: network must be udp or tcp",
+			"log_sinks[3]: path is required",
+			"log_sinks[3]: max_size_in_megabytes, max_age_in_seconds and max_backups must not be negative",
+		))
+	})
+
+	It("rejects a debug server address without a port", func() {
+		conf.DebugServerAddress = "127.0.0.1"
+		Ω(problems()).Should(ConsistOf("debug_server_address must be a host:port, e.g. 127.0.0.1:17017"))
+	})
+
+	It("accepts a debug server address with a port", func() {
+		conf.DebugServerAddress = "127.0.0.1:17017"
+		Ω(conf.Validate()).Should(Succeed())
+	})
+
+	It("rejects a shutdown timeout of zero", func() {
+		conf.ShutdownTimeoutInSeconds.Duration = 0
+		Ω(problems()).Should(ConsistOf("shutdown_timeout_in_seconds must be positive"))
+	})
+
+	It("rejects negative daemon failure settings", func() {
+		conf.DaemonMaximumFailureBackoffInHeartbeats = -1
+		conf.DaemonMaxConsecutiveFailures = -1
+		conf.DaemonWatchdogMultiple = -1
+		Ω(problems()).Should(ConsistOf(
+			"daemon_maximum_failure_backoff_in_heartbeats must not be negative",
+			"daemon_watchdog_multiple must not be negative",
+			"daemon_max_consecutive_failures must not be negative",
+		))
+	})
+
+	It("rejects an instance missing grace period shorter than the heartbeat period", func() {
+		conf.InstanceMissingGracePeriodInSeconds.Duration = 5 * time.Second
+		Ω(problems()).Should(ConsistOf("instance_missing_grace_period_in_seconds must be 0 or at least heartbeat_period_in_seconds, or instances go missing between heartbeats"))
+
+		conf.InstanceMissingGracePeriodInSeconds.Duration = -time.Second
+		Ω(problems()).Should(ConsistOf("instance_missing_grace_period_in_seconds must not be negative"))
+
+		conf.InstanceMissingGracePeriodInSeconds.Duration = 10 * time.Second
+		Ω(conf.Validate()).Should(Succeed())
+	})
+
+	It("rejects a negative listener load shedding threshold", func() {
+		conf.ListenerLoadSheddingThreshold = -1
+		Ω(problems()).Should(ConsistOf("listener_load_shedding_threshold must not be negative"))
+	})
+
+	It("rejects a negative number of heartbeat sampling cohorts", func() {
+		conf.ListenerHeartbeatSamplingCohorts = -1
+		Ω(problems()).Should(ConsistOf("listener_heartbeat_sampling_cohorts must not be negative"))
+	})
+
+	It("rejects sampling heartbeats while shedding load", func() {
+		conf.ListenerHeartbeatSamplingCohorts = 4
+		conf.ListenerLoadSheddingThreshold = 1000
+		Ω(problems()).Should(ConsistOf("listener_heartbeat_sampling_cohorts and listener_load_shedding_threshold cannot both be set"))
+	})
+
+	It("rejects fault injection rates outside 0 to 1", func() {
+		conf.FaultInjection.Enabled = true
+		conf.FaultInjection.StoreLatencyInMilliseconds.Duration = -time.Second
+		conf.FaultInjection.StoreLatencyRate = 1.5
+		conf.FaultInjection.NATSDropRate = -0.1
+		conf.FaultInjection.CCFailureRate = 1
+		Ω(problems()).Should(ConsistOf(
+			"fault_injection: store_latency_in_milliseconds must not be negative",
+			"fault_injection: store_latency_rate must be between 0 and 1",
+			"fault_injection: nats_drop_rate must be between 0 and 1",
+		))
+	})
+
+	It("rejects a negative API rate limit, burst or cap on requesters", func() {
+		conf.APIServerRateLimitPerSecond = -1
+		conf.APIServerRateLimitBurst = -1
+		conf.APIServerRateLimitMaxRequesters = -1
+		Ω(problems()).Should(ConsistOf(
+			"api_server_rate_limit_per_second must not be negative",
+			"api_server_rate_limit_burst must not be negative",
+			"api_server_rate_limit_max_requesters must not be negative",
+		))
+	})
+
+	It("rejects trusted proxies that are neither addresses nor CIDR ranges", func() {
+		conf.APIServerTrustedProxies = []string{"10.0.0.1", "10.1.0.0/16", "::1", "router"}
+		Ω(problems()).Should(ConsistOf(`api_server_trusted_proxies: invalid address "router"`))
+
+		conf.APIServerTrustedProxies = []string{"10.1.0.0/33"}
+		Ω(problems()).Should(HaveLen(1))
+	})
+
+	It("rejects a negative cap on the API requests in flight", func() {
+		conf.APIServerRequestTimeoutInMilliseconds.Duration = time.Second
+		conf.APIServerMaxRequestsInFlight = -1
+		Ω(problems()).Should(ConsistOf("api_server_max_requests_in_flight must not be negative"))
+	})
+
+	It("rejects a cap on the API requests in flight without a request timeout", func() {
+		conf.APIServerMaxRequestsInFlight = 10
+		Ω(problems()).Should(ConsistOf("api_server_request_timeout_in_milliseconds must be positive when api_server_max_requests_in_flight is set"))
+	})
+
+	It("rejects an admin user without a password, or shared with the API", func() {
+		conf.APIServerAdminUsername = conf.APIServerUsername
+		conf.AdminNATSSubject = ""
+		Ω(problems()).Should(ConsistOf(
+			"api_server_admin_password must be set when api_server_admin_username is",
+			"api_server_admin_username must differ from api_server_username",
+			"admin_nats_subject must be set when api_server_admin_username is",
+		))
+	})
+
+	It("rejects adaptive analyzer polling bounds on the wrong side of the polling interval", func() {
+		conf.AnalyzerPollingIntervalInHeartbeats = 3
+		conf.AnalyzerMinPollingIntervalInHeartbeats = 4
+		conf.AnalyzerMaxPollingIntervalInHeartbeats = 2
+		Ω(problems()).Should(ConsistOf(
+			"analyzer_min_polling_interval_in_heartbeats must be between 0 and analyzer_polling_interval_in_heartbeats",
+			"analyzer_max_polling_interval_in_heartbeats must be 0 or at least analyzer_polling_interval_in_heartbeats",
+		))
+	})
+
+	It("rejects a negative per-DEA stop limit", func() {
+		conf.SenderStopsPerDeaLimit = -1
+		Ω(problems()).Should(ConsistOf("sender_stops_per_dea_limit must not be negative"))
+	})
+
+	It("rejects a negative restart report threshold or an empty window", func() {
+		conf.RestartReportThreshold = -1
+		conf.RestartReportWindowInSeconds.Duration = 0
+		Ω(problems()).Should(ConsistOf(
+			"restart_report_threshold must not be negative",
+			"restart_report_window_in_seconds must be at least one second",
+		))
+	})
+
+	It("rejects a metrics job without an origin", func() {
+		conf.MetricsJob = "hm9000_z1"
+		Ω(problems()).Should(ConsistOf("metrics_origin must be set when metrics_job is set"))
+	})
+
+	It("rejects a negative metrics index", func() {
+		conf.MetricsIndex = -1
+		Ω(problems()).Should(ConsistOf("metrics_index must not be negative"))
+	})
+
+	It("rejects a negative app history size", func() {
+		conf.AppHistoryMaxEvents = -1
+		Ω(problems()).Should(ConsistOf("app_history_max_events must not be negative"))
+	})
+
+	It("rejects an empty app history TTL when app history is enabled", func() {
+		conf.AppHistoryMaxEvents = 100
+		conf.AppHistoryTTLInSeconds.Duration = 0
+		Ω(problems()).Should(ConsistOf("app_history_ttl_in_seconds must be at least one second"))
+	})
+
+	It("rejects a crash compaction window that app history does not outlast", func() {
+		conf.AppHistoryMaxEvents = 100
+		conf.CrashCompactionWindowInSeconds.Duration = conf.AppHistoryTTL()
+		Ω(problems()).Should(ConsistOf("crash_compaction_window_in_seconds must be less than app_history_ttl_in_seconds, or crashes expire before they are compacted"))
+	})
+
+	It("rejects a crash trend TTL shorter than a day when crash compaction is enabled", func() {
+		conf.AppHistoryMaxEvents = 100
+		conf.CrashTrendTTLInSeconds.Duration = time.Hour
+		Ω(problems()).Should(ConsistOf("crash_trend_ttl_in_seconds must be at least a day"))
+
+		conf.CrashCompactionWindowInSeconds.Duration = 0
+		Ω(conf.Validate()).Should(Succeed())
+	})
+
+	It("rejects malformed webhooks", func() {
+		conf.Webhooks = []Webhook{
+			{URL: "https://example.com/hook", Events: []string{"start_sent", "app_flapping"}, AuthToken: "token"},
+			{URL: "ftp://example.com/hook", Events: []string{"exploded"}, AuthUser: "user", AuthToken: "token", Retries: -1},
+		}
+		Ω(problems()).Should(ConsistOf(
+			"webhooks[1]: url must be an http or https URL",
+			"webhooks[1]: exploded is not an event (expected one of start_sent, stop_sent, app_flapping, freshness_lost, freshness_restored)",
+			"webhooks[1]: give auth_user and auth_password or auth_token, not both",
+			"webhooks[1]: retries must not be negative",
+		))
+	})
+
+	It("rejects negative startup dependency retries", func() {
+		conf.StartupDependencyRetries = -1
+		Ω(problems()).Should(ConsistOf("startup_dependency_retries must not be negative"))
+	})
+
+	It("rejects negative fetcher request settings", func() {
+		conf.FetcherRequestRetries = -1
+		conf.FetcherMaxIdleConnectionsPerHost = -1
+		conf.FetcherHostTimeoutsInSeconds = map[string]DurationInSeconds{"cc.example.com": {0}}
+		Ω(problems()).Should(ConsistOf(
+			"fetcher_request_retries must not be negative",
+			"fetcher_max_idle_connections_per_host must not be negative",
+			"fetcher_host_timeouts_in_seconds for cc.example.com must be positive",
+		))
+	})
+
+	It("rejects an app count tolerance outside [0, 1)", func() {
+		conf.FetcherAppCountTolerance = 1
+		Ω(problems()).Should(ConsistOf("fetcher_app_count_tolerance must be at least 0 and less than 1"))
+
+		conf.FetcherAppCountTolerance = -0.1
+		Ω(problems()).Should(ConsistOf("fetcher_app_count_tolerance must be at least 0 and less than 1"))
+	})
+
+	It("rejects a fetcher exclusion name regex that does not compile", func() {
+		conf.FetcherExclusions.NameRegex = "^(system"
+		Ω(problems()).Should(ConsistOf(HavePrefix("fetcher_exclusions: name_regex must be a regular expression")))
+	})
+
+	It("rejects a starting backoff delay longer than the maximum", func() {
+		conf.StartingBackoffDelayInHeartbeats = conf.MaximumBackoffDelayInHeartbeats + 1
+		Ω(problems()).Should(ConsistOf("starting_backoff_delay_in_heartbeats must not exceed maximum_backoff_delay_in_heartbeats"))
+	})
+
+	It("rejects an active encryption key that is not configured", func() {
+		conf.StoreEncryptionActiveKeyLabel = "missing"
+		Ω(problems()).Should(ConsistOf("store_encryption_active_key_label must name one of the store_encryption_keys"))
+	})
+
+	It("describes every problem in its error message", func() {
+		conf.CCBaseURL = ""
+		conf.StoreType = "consul"
+		Ω(conf.Validate().Error()).Should(Equal("invalid config: store_type must be etcd or zookeeper; cc_base_url is required"))
+	})
+})
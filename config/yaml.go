@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FromYAML parses a YAML config.  Settings have the same names as in the
+// JSON config, and anchors, aliases and merge keys (<<) work as usual.
+//
+// A file may hold several documents separated by "---".  They are merged in
+// order, a setting in a later document replacing the same setting in an
+// earlier one; this lets a deployment keep its common settings in one
+// document and its per-environment settings in another.  Empty documents
+// are skipped.
+func FromYAML(YAML []byte) (*Config, error) {
+	merged := map[string]interface{}{}
+
+	for i, document := range yamlDocuments(string(YAML)) {
+		var parsed interface{}
+		err := yaml.Unmarshal([]byte(document), &parsed)
+		if err != nil {
+			return nil, fmt.Errorf("YAML document %d: %s", i+1, err.Error())
+		}
+		if parsed == nil {
+			continue
+		}
+
+		settings, ok := jsonCompatible(parsed).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("YAML document %d is not a map of settings", i+1)
+		}
+		for setting, value := range settings {
+			merged[setting] = value
+		}
+	}
+
+	JSON, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromJSON(JSON)
+}
+
+// yamlDocuments splits a YAML stream into its documents, each of which
+// starts at a "---" marker.  Directives (e.g. %YAML 1.1) stay with the
+// document they precede, and "..." end markers are dropped.
+func yamlDocuments(YAML string) []string {
+	documents := []string{}
+	current := []string{}
+	hasContent := false
+
+	for _, line := range strings.Split(YAML, "\n") {
+		trimmed := strings.TrimRight(line, " \t\r")
+		if trimmed == "..." {
+			continue
+		}
+
+		isMarker := trimmed == "---" || strings.HasPrefix(trimmed, "--- ") || strings.HasPrefix(trimmed, "---\t")
+		if isMarker && hasContent {
+			documents = append(documents, strings.Join(current, "\n"))
+			current = []string{}
+			hasContent = false
+		}
+
+		current = append(current, line)
+		if isMarker || !(trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "%")) {
+			hasContent = true
+		}
+	}
+
+	return append(documents, strings.Join(current, "\n"))
+}
+
+// jsonCompatible converts the maps the YAML parser produces, which may be
+// keyed by anything, into maps keyed by string so they can be marshalled
+// as JSON.
+func jsonCompatible(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for key, element := range value {
+			converted[fmt.Sprint(key)] = jsonCompatible(element)
+		}
+		return converted
+	case map[string]interface{}:
+		converted := map[string]interface{}{}
+		for key, element := range value {
+			converted[key] = jsonCompatible(element)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, element := range value {
+			converted[i] = jsonCompatible(element)
+		}
+		return converted
+	default:
+		return value
+	}
+}
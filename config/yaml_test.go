@@ -0,0 +1,172 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("YAML configs", func() {
+	Describe("FromYAML", func() {
+		It("reads settings by their JSON names", func() {
+			conf, err := FromYAML([]byte(`
+heartbeat_period_in_seconds: 11
+cc_base_url: http://127.0.0.1:6001
+skip_cert_verify: true
+store_urls:
+- http://127.0.0.1:4001
+- http://127.0.0.1:4002
+nats:
+- host: 127.0.0.1
+  port: 4222
+  user: nats
+  password: nats
+`))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(conf.HeartbeatPeriod.Duration).Should(Equal(11 * time.Second))
+			Ω(conf.CCBaseURL).Should(Equal("http://127.0.0.1:6001"))
+			Ω(conf.SkipSSLVerification).Should(BeTrue())
+			Ω(conf.StoreURLs).Should(Equal([]string{"http://127.0.0.1:4001", "http://127.0.0.1:4002"}))
+			Ω(conf.NATS).Should(HaveLen(1))
+			Ω(conf.NATS[0].Port).Should(Equal(4222))
+			Ω(conf.NATS[0].User).Should(Equal("nats"))
+		})
+
+		It("keeps the defaults for settings it does not mention", func() {
+			conf, err := FromYAML([]byte(`sender_message_limit: 20`))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			defaults, err := FromJSON([]byte(`{"sender_message_limit": 20}`))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(conf).Should(Equal(defaults))
+		})
+
+		It("resolves anchors, aliases and merge keys", func() {
+			conf, err := FromYAML([]byte(`
+nats_defaults: &nats_defaults
+  port: 4222
+  user: nats
+  password: secret
+etcd: &etcd http://10.0.0.1:4001
+store_urls:
+- *etcd
+nats:
+- <<: *nats_defaults
+  host: 10.0.0.2
+- <<: *nats_defaults
+  host: 10.0.0.3
+`))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(conf.StoreURLs).Should(Equal([]string{"http://10.0.0.1:4001"}))
+			Ω(conf.NATS).Should(HaveLen(2))
+			Ω(conf.NATS[1].Host).Should(Equal("10.0.0.3"))
+			Ω(conf.NATS[1].Port).Should(Equal(4222))
+			Ω(conf.NATS[1].Password).Should(Equal("secret"))
+		})
+
+		It("merges multiple documents, later documents winning", func() {
+			conf, err := FromYAML([]byte(`%YAML 1.1
+---
+sender_message_limit: 20
+log_level: DEBUG
+...
+---
+# the second document only overrides what it names
+sender_message_limit: 30
+--- {cc_base_url: "http://cc.example.com"}
+---
+`))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(conf.SenderMessageLimit).Should(Equal(30))
+			Ω(conf.LogLevelString).Should(Equal("DEBUG"))
+			Ω(conf.CCBaseURL).Should(Equal("http://cc.example.com"))
+		})
+
+		It("rejects documents that are not maps", func() {
+			_, err := FromYAML([]byte("sender_message_limit: 20\n---\n- a\n- b\n"))
+			Ω(err).Should(MatchError("YAML document 2 is not a map of settings"))
+		})
+
+		It("rejects malformed YAML", func() {
+			_, err := FromYAML([]byte("nats: [unclosed"))
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects settings of the wrong type", func() {
+			_, err := FromYAML([]byte("sender_message_limit: lots"))
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("FromFileInFormat", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "hm9000_yaml_config")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		writeConfig := func(name string, contents string) string {
+			path := filepath.Join(dir, name)
+			err := ioutil.WriteFile(path, []byte(contents), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+			return path
+		}
+
+		It("detects YAML files by their extension", func() {
+			for _, name := range []string{"hm9000.yml", "hm9000.YAML"} {
+				conf, err := FromFile(writeConfig(name, "sender_message_limit: 20\n"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(conf.SenderMessageLimit).Should(Equal(20))
+			}
+		})
+
+		It("treats any other file as JSON", func() {
+			Ω(FormatForPath("hm9000.json")).Should(Equal(JSONFormat))
+			Ω(FormatForPath("hm9000.conf")).Should(Equal(JSONFormat))
+
+			_, err := FromFile(writeConfig("hm9000.conf", "sender_message_limit: 20\n"))
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("parses the file in the format it is given, whatever the extension", func() {
+			conf, err := FromFileInFormat(writeConfig("hm9000.conf", "sender_message_limit: 20\n"), YAMLFormat)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(conf.SenderMessageLimit).Should(Equal(20))
+
+			conf, err = FromFileInFormat(writeConfig("hm9000.yml", `{"sender_message_limit": 30}`), JSONFormat)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(conf.SenderMessageLimit).Should(Equal(30))
+		})
+
+		It("rejects unknown formats", func() {
+			_, err := FromFileInFormat(writeConfig("hm9000.json", "{}"), "toml")
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("reloads the file in the format it was first given", func() {
+			required := "cc_base_url: http://cc\nstore_urls: [http://127.0.0.1:4001]\nnats: [{host: 127.0.0.1, port: 4222}]\ndesired_state_batch_size: 500\n"
+			path := writeConfig("hm9000.conf", required+"sender_message_limit: 20\n")
+			conf, err := FromFileInFormat(path, YAMLFormat)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			writeConfig("hm9000.conf", required+"sender_message_limit: 30\n")
+			applied, _, err := conf.Reload(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(applied).Should(Equal([]Change{{Setting: "sender_message_limit", OldValue: "20", NewValue: "30"}}))
+		})
+	})
+})
@@ -1,9 +1,11 @@
 package desiredstatefetcher
 
 import (
+	"errors"
 	"fmt"
 	"github.com/cloudfoundry/gunk/timeprovider"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
 	"github.com/cloudfoundry/hm9000/helpers/httpclient"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
 	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
@@ -25,6 +27,10 @@ type DesiredStateFetcherResult struct {
 
 const initialBulkToken = "{}"
 
+// ErrAppCountMismatch is the error of a fetch whose bulk pages held fewer
+// apps than the CC counts.
+var ErrAppCountMismatch = errors.New("received fewer apps than the CC counts")
+
 type DesiredStateFetcher struct {
 	config            *config.Config
 	httpClient        httpclient.HttpClient
@@ -32,7 +38,34 @@ type DesiredStateFetcher struct {
 	metricsAccountant metricsaccountant.MetricsAccountant
 	timeProvider      timeprovider.TimeProvider
 	cache             map[string]models.DesiredAppState
+	exclusions        exclusions
 	logger            logger.Logger
+
+	pageCache    *PageCache
+	fetchedPages map[string]cachedPage
+	pageHits     int
+	pageMisses   int
+
+	// freshness keeps the desired state that was fresh when a fetch began
+	// fresh until the fetch is done, however long it takes.
+	freshness *store.FreshnessLease
+}
+
+// PageCache holds the bulk pages the CC last sent with an ETag, by URL, so
+// that pages it says are unchanged need not be downloaded again.  A fetch
+// replaces them once it succeeds.  Share one between fetchers to keep it
+// from one fetch to the next.
+type PageCache struct {
+	pages map[string]cachedPage
+}
+
+type cachedPage struct {
+	etag     string
+	response DesiredStateServerResponse
+}
+
+func NewPageCache() *PageCache {
+	return &PageCache{pages: map[string]cachedPage{}}
 }
 
 func New(config *config.Config,
@@ -50,11 +83,29 @@ func New(config *config.Config,
 		timeProvider:      timeProvider,
 		cache:             map[string]models.DesiredAppState{},
 		logger:            logger,
+		pageCache:         NewPageCache(),
 	}
 }
 
+// UsePageCache has the fetcher make conditional requests for the pages in
+// pageCache, and keep the pages of its fetches there.
+func (fetcher *DesiredStateFetcher) UsePageCache(pageCache *PageCache) {
+	fetcher.pageCache = pageCache
+}
+
 func (fetcher *DesiredStateFetcher) Fetch(resultChan chan DesiredStateFetcherResult) {
 	fetcher.cache = map[string]models.DesiredAppState{}
+	fetcher.exclusions = newExclusions(fetcher.config.FetcherExclusions)
+	fetcher.fetchedPages = map[string]cachedPage{}
+	fetcher.pageHits = 0
+	fetcher.pageMisses = 0
+
+	fetcher.freshness = nil
+	fresh, err := fetcher.store.IsDesiredStateFresh()
+	if err == nil && fresh {
+		fetcher.freshness = fetcher.store.NewDesiredFreshnessLease(fetcher.timeProvider)
+		fetcher.freshness.Start()
+	}
 
 	authInfo := models.BasicAuthInfo{
 		User:     fetcher.config.CCAuthUser,
@@ -65,62 +116,156 @@ func (fetcher *DesiredStateFetcher) Fetch(resultChan chan DesiredStateFetcherRes
 }
 
 func (fetcher *DesiredStateFetcher) fetchBatch(authorization string, token string, numResults int, resultChan chan DesiredStateFetcherResult) {
-	req, err := http.NewRequest("GET", fetcher.bulkURL(fetcher.config.DesiredStateBatchSize, token), nil)
+	url := fetcher.bulkURL(fetcher.config.DesiredStateBatchSize, token)
+	req, err := http.NewRequest("GET", url, nil)
 
 	if err != nil {
-		resultChan <- DesiredStateFetcherResult{Message: "Failed to generate URL request", Error: err}
+		fetcher.report(resultChan, DesiredStateFetcherResult{Message: "Failed to generate URL request", Error: err})
 		return
 	}
 
 	req.Header.Add("Authorization", authorization)
 
+	cached, isCached := fetcher.pageCache.pages[url]
+	if isCached {
+		req.Header.Add("If-None-Match", cached.etag)
+	}
+
 	fetcher.httpClient.Do(req, func(resp *http.Response, err error) {
 		if err != nil {
-			resultChan <- DesiredStateFetcherResult{Message: "HTTP request failed with error", Error: err}
+			fetcher.report(resultChan, DesiredStateFetcherResult{Message: "HTTP request failed with error", Error: errorcategory.New(errorcategory.CCError, err)})
 			return
 		}
 
 		defer resp.Body.Close()
 
 		if resp.StatusCode == http.StatusUnauthorized {
-			resultChan <- DesiredStateFetcherResult{Message: "HTTP request received unauthorized response code", Error: fmt.Errorf("Unauthorized")}
+			fetcher.report(resultChan, DesiredStateFetcherResult{Message: "HTTP request received unauthorized response code", Error: errorcategory.New(errorcategory.CCError, fmt.Errorf("Unauthorized"))})
 			return
 		}
 
-		if resp.StatusCode != http.StatusOK {
-			resultChan <- DesiredStateFetcherResult{Message: fmt.Sprintf("HTTP request received non-200 response (%d)", resp.StatusCode), Error: fmt.Errorf("Invalid response code")}
+		var response DesiredStateServerResponse
+		if resp.StatusCode == http.StatusNotModified && isCached {
+			response = cached.response
+			fetcher.fetchedPages[url] = cached
+			fetcher.pageHits++
+		} else {
+			if resp.StatusCode != http.StatusOK {
+				fetcher.report(resultChan, DesiredStateFetcherResult{Message: fmt.Sprintf("HTTP request received non-200 response (%d)", resp.StatusCode), Error: errorcategory.New(errorcategory.CCError, fmt.Errorf("Invalid response code"))})
+				return
+			}
+
+			body, err := ioutil.ReadAll(resp.Body)
+
+			if err != nil {
+				fetcher.report(resultChan, DesiredStateFetcherResult{Message: "Failed to read HTTP response body", Error: errorcategory.New(errorcategory.CCError, err)})
+				return
+			}
+
+			response, err = NewDesiredStateServerResponse(body)
+			if err != nil {
+				fetcher.report(resultChan, DesiredStateFetcherResult{Message: "Failed to parse HTTP response body JSON", Error: errorcategory.New(errorcategory.DecodeError, err)})
+				return
+			}
+
+			fetcher.pageMisses++
+			if etag := resp.Header.Get("ETag"); etag != "" {
+				fetcher.fetchedPages[url] = cachedPage{etag: etag, response: response}
+			}
+		}
+
+		if len(response.Results) == 0 {
+			if fetcher.config.FetcherVerifyAppCount {
+				fetcher.verifyAppCount(authorization, numResults, resultChan)
+			} else {
+				fetcher.finishFetch(numResults, resultChan)
+			}
 			return
 		}
 
-		body, err := ioutil.ReadAll(resp.Body)
+		fetcher.cacheResponse(response)
+		fetcher.fetchBatch(authorization, response.BulkTokenRepresentation(), numResults+len(response.Results), resultChan)
+	})
+}
+
+// finishFetch syncs the fetched desired state to the store and bumps its
+// freshness.
+func (fetcher *DesiredStateFetcher) finishFetch(numResults int, resultChan chan DesiredStateFetcherResult) {
+	tSync := time.Now()
+	err := fetcher.syncStore()
+	fetcher.metricsAccountant.TrackDesiredStateSyncTime(time.Since(tSync))
+	if err != nil {
+		fetcher.report(resultChan, DesiredStateFetcherResult{Message: "Failed to sync desired state to the store", Error: err})
+		return
+	}
+
+	fetcher.pageCache.pages = fetcher.fetchedPages
+	fetcher.metricsAccountant.TrackDesiredStatePageCache(fetcher.pageHits, fetcher.pageMisses)
+
+	fetcher.store.BumpDesiredFreshness(fetcher.timeProvider.Time())
+	fetcher.report(resultChan, DesiredStateFetcherResult{Success: true, NumResults: numResults})
+}
+
+// report stops the freshness lease, leaving a failed fetch's desired state
+// to expire, and sends result down resultChan.
+func (fetcher *DesiredStateFetcher) report(resultChan chan DesiredStateFetcherResult, result DesiredStateFetcherResult) {
+	if fetcher.freshness != nil {
+		fetcher.freshness.Stop()
+	}
+	resultChan <- result
+}
+
+// verifyAppCount asks the CC how many apps it has, and finishes the fetch
+// only if the bulk pages held that many, give or take the app count
+// tolerance.  Fewer apps than that means the pages were cut short, and
+// syncing them would take the missing apps for deleted ones, so the sync is
+// aborted and the desired state left to go stale.  More apps than that were
+// created during the fetch, which is harmless.
+func (fetcher *DesiredStateFetcher) verifyAppCount(authorization string, numResults int, resultChan chan DesiredStateFetcherResult) {
+	req, err := http.NewRequest("GET", fetcher.config.CCBaseURL+"/bulk/counts?model=app", nil)
+	if err != nil {
+		fetcher.report(resultChan, DesiredStateFetcherResult{Message: "Failed to generate URL request", Error: err})
+		return
+	}
+	req.Header.Add("Authorization", authorization)
 
+	fetcher.httpClient.Do(req, func(resp *http.Response, err error) {
 		if err != nil {
-			resultChan <- DesiredStateFetcherResult{Message: "Failed to read HTTP response body", Error: err}
+			fetcher.report(resultChan, DesiredStateFetcherResult{Message: "App count request failed with error", Error: errorcategory.New(errorcategory.CCError, err)})
 			return
 		}
 
-		response, err := NewDesiredStateServerResponse(body)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			fetcher.report(resultChan, DesiredStateFetcherResult{Message: fmt.Sprintf("App count request received non-200 response (%d)", resp.StatusCode), Error: errorcategory.New(errorcategory.CCError, fmt.Errorf("Invalid response code"))})
+			return
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			resultChan <- DesiredStateFetcherResult{Message: "Failed to parse HTTP response body JSON", Error: err}
+			fetcher.report(resultChan, DesiredStateFetcherResult{Message: "Failed to read app count response body", Error: errorcategory.New(errorcategory.CCError, err)})
 			return
 		}
 
-		if len(response.Results) == 0 {
-			tSync := time.Now()
-			err = fetcher.syncStore()
-			fetcher.metricsAccountant.TrackDesiredStateSyncTime(time.Since(tSync))
-			if err != nil {
-				resultChan <- DesiredStateFetcherResult{Message: "Failed to sync desired state to the store", Error: err}
-				return
-			}
+		counts, err := NewAppCountResponse(body)
+		if err != nil {
+			fetcher.report(resultChan, DesiredStateFetcherResult{Message: "Failed to parse app count response body JSON", Error: errorcategory.New(errorcategory.DecodeError, err)})
+			return
+		}
 
-			fetcher.store.BumpDesiredFreshness(fetcher.timeProvider.Time())
-			resultChan <- DesiredStateFetcherResult{Success: true, NumResults: numResults}
+		minimum := float64(counts.Apps()) * (1 - fetcher.config.FetcherAppCountTolerance)
+		if float64(numResults) < minimum {
+			fetcher.logger.Error("Aborting the desired state sync: the CC sent fewer apps than it counts", ErrAppCountMismatch, map[string]string{
+				"Received Apps": strconv.Itoa(numResults),
+				"Counted Apps":  strconv.Itoa(counts.Apps()),
+			})
+			fetcher.metricsAccountant.IncrementAbortedDesiredStateSyncs()
+			fetcher.report(resultChan, DesiredStateFetcherResult{Message: "The CC sent fewer apps than it counts", Error: errorcategory.New(errorcategory.CCError, ErrAppCountMismatch), NumResults: numResults})
 			return
 		}
 
-		fetcher.cacheResponse(response)
-		fetcher.fetchBatch(authorization, response.BulkTokenRepresentation(), numResults+len(response.Results), resultChan)
+		fetcher.finishFetch(numResults, resultChan)
 	})
 }
 
@@ -138,6 +283,10 @@ func (fetcher *DesiredStateFetcher) guids(desiredStates []models.DesiredAppState
 	return strings.Join(result, ",")
 }
 
+// syncStore writes the desired state behind a sync-in-progress marker, so
+// that the analyzer does not stop instances of apps it has yet to write.  A
+// sync that fails leaves the marker to expire, as the desired state may be
+// half written.
 func (fetcher *DesiredStateFetcher) syncStore() error {
 	desiredStates := make([]models.DesiredAppState, len(fetcher.cache))
 	i := 0
@@ -145,7 +294,15 @@ func (fetcher *DesiredStateFetcher) syncStore() error {
 		desiredStates[i] = desiredState
 		i++
 	}
-	err := fetcher.store.SyncDesiredState(desiredStates...)
+
+	syncBegan := fetcher.timeProvider.Time()
+	err := fetcher.store.BeginDesiredStateSync(syncBegan)
+	if err != nil {
+		fetcher.logger.Error("Failed to mark the desired state sync in progress", err)
+		return err
+	}
+
+	err = fetcher.store.SyncDesiredState(desiredStates...)
 	if err != nil {
 		fetcher.logger.Error("Failed to Sync Desired State", err, map[string]string{
 			"Number of Entries": strconv.Itoa(len(desiredStates)),
@@ -154,12 +311,20 @@ func (fetcher *DesiredStateFetcher) syncStore() error {
 		return err
 	}
 
+	err = fetcher.store.EndDesiredStateSync(syncBegan)
+	if err != nil {
+		fetcher.logger.Error("Failed to clear the desired state sync marker", err)
+	}
+
 	return nil
 }
 
+// cacheResponse keeps the started apps of a page, marking those the
+// fetcher_exclusions match unmanaged.
 func (fetcher *DesiredStateFetcher) cacheResponse(response DesiredStateServerResponse) {
 	for _, desiredState := range response.Results {
 		if desiredState.State == models.AppStateStarted && (desiredState.PackageState == models.AppPackageStateStaged || desiredState.PackageState == models.AppPackageStatePending) {
+			desiredState.Unmanaged = fetcher.exclusions.excludes(desiredState)
 			fetcher.cache[desiredState.StoreKey()] = desiredState
 		}
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/cloudfoundry/hm9000/config"
 	. "github.com/cloudfoundry/hm9000/desiredstatefetcher"
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
 	"github.com/cloudfoundry/hm9000/models"
 	storepackage "github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
@@ -231,6 +232,12 @@ var _ = Describe("DesiredStateFetcher", func() {
 					close(done)
 				}, 0.1)
 
+				It("should clear the sync in progress marker", func() {
+					syncing, err := store.IsDesiredStateSyncInProgress()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(syncing).Should(BeFalse())
+				})
+
 				Context("and it fails to write to the store", func() {
 					BeforeEach(func() {
 						storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("desired", errors.New("oops!"))
@@ -239,6 +246,38 @@ var _ = Describe("DesiredStateFetcher", func() {
 					assertFailure("Failed to sync desired state to the store", 2)
 				})
 
+				Context("and it fails part way through writing the desired state", func() {
+					BeforeEach(func() {
+						storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("apps/desired", errors.New("oops!"))
+					})
+
+					assertFailure("Failed to sync desired state to the store", 2)
+
+					It("should leave the sync in progress marker to expire", func() {
+						syncing, err := store.IsDesiredStateSyncInProgress()
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(syncing).Should(BeTrue())
+
+						node, err := storeAdapter.Get("/hm/v1/desired-sync")
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(node.TTL).Should(Equal(conf.DesiredFreshnessTTL()))
+					})
+				})
+
+				Context("and it fails to mark the sync in progress", func() {
+					BeforeEach(func() {
+						storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("desired-sync", errors.New("oops!"))
+					})
+
+					assertFailure("Failed to sync desired state to the store", 2)
+
+					It("should leave the desired state as it was", func() {
+						desired, _ := store.GetDesiredState()
+						Ω(desired).Should(HaveLen(1))
+						Ω(desired).Should(ContainElement(EqualDesiredState(deletedApp.DesiredState(1))))
+					})
+				})
+
 				Context("and it fails to read from the store", func() {
 					BeforeEach(func() {
 						storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("apps", errors.New("oops!"))
@@ -246,6 +285,77 @@ var _ = Describe("DesiredStateFetcher", func() {
 
 					assertFailure("Failed to sync desired state to the store", 2)
 				})
+
+				Context("and the app count is verified", func() {
+					BeforeEach(func() {
+						conf.FetcherVerifyAppCount = true
+						conf.FetcherAppCountTolerance = 0.2
+					})
+
+					It("should ask the CC how many apps it has", func() {
+						Ω(httpClient.Requests).Should(HaveLen(3))
+						request := httpClient.LastRequest()
+						Ω(request.URL.Path).Should(HaveSuffix("/bulk/counts"))
+						Ω(request.URL.Query().Get("model")).Should(Equal("app"))
+						Ω(request.Header.Get("Authorization")).Should(Equal(httpClient.Requests[0].Header.Get("Authorization")))
+					})
+
+					It("should not sync until it knows", func() {
+						fresh, _ := store.IsDesiredStateFresh()
+						Ω(fresh).Should(BeFalse())
+						Ω(resultChan).Should(HaveLen(0))
+					})
+
+					Context("when the CC counts the apps the pages held, give or take the tolerance", func() {
+						JustBeforeEach(func() {
+							httpClient.LastRequest().Succeed([]byte(`{"counts":{"app":6}}`))
+						})
+
+						It("should sync the desired state", func() {
+							result := <-resultChan
+							Ω(result.Success).Should(BeTrue())
+
+							fresh, _ := store.IsDesiredStateFresh()
+							Ω(fresh).Should(BeTrue())
+							desired, _ := store.GetDesiredState()
+							Ω(desired).Should(HaveLen(3))
+						})
+					})
+
+					Context("when the CC counts more apps than the pages held", func() {
+						JustBeforeEach(func() {
+							httpClient.LastRequest().Succeed([]byte(`{"counts":{"app":7}}`))
+						})
+
+						assertFailure("The CC sent fewer apps than it counts", 3)
+
+						It("should leave the desired state as it was", func() {
+							desired, _ := store.GetDesiredState()
+							Ω(desired).Should(HaveLen(1))
+							Ω(desired).Should(ContainElement(EqualDesiredState(deletedApp.DesiredState(1))))
+						})
+
+						It("should count the aborted sync", func() {
+							Ω(metricsAccountant.AbortedDesiredStateSyncs).Should(Equal(1))
+						})
+					})
+
+					Context("when the CC does not count the apps", func() {
+						JustBeforeEach(func() {
+							httpClient.LastRequest().Succeed([]byte(`{"counts":{"user":17}}`))
+						})
+
+						assertFailure("Failed to parse app count response body JSON", 3)
+					})
+
+					Context("when the app count request fails", func() {
+						JustBeforeEach(func() {
+							httpClient.LastRequest().RespondWithStatus(http.StatusNotFound)
+						})
+
+						assertFailure("App count request received non-200 response (404)", 3)
+					})
+				})
 			})
 		})
 
@@ -255,6 +365,12 @@ var _ = Describe("DesiredStateFetcher", func() {
 			})
 
 			assertFailure("HTTP request received unauthorized response code", 1)
+
+			It("should tag the error as a CC error", func(done Done) {
+				result := <-resultChan
+				Ω(errorcategory.Of(result.Error)).Should(Equal(errorcategory.CCError))
+				close(done)
+			}, 1.0)
 		})
 
 		Context("when the HTTP request returns a non-200 response", func() {
@@ -295,6 +411,246 @@ var _ = Describe("DesiredStateFetcher", func() {
 			})
 
 			assertFailure("Failed to parse HTTP response body JSON", 1)
+
+			It("should tag the error as a decode error", func(done Done) {
+				result := <-resultChan
+				Ω(errorcategory.Of(result.Error)).Should(Equal(errorcategory.DecodeError))
+				close(done)
+			}, 1.0)
+		})
+	})
+
+	Describe("Keeping the desired state fresh while fetching", func() {
+		freshnessKeyExists := func() bool {
+			_, err := storeAdapter.Get("/hm/v1" + conf.DesiredFreshnessKey)
+			return err == nil
+		}
+
+		leaseTicks := func() bool {
+			ticker := timeProvider.TickerChannelFor(storepackage.DesiredFreshnessLeaseTimer)
+			for i := 0; i < 2; i++ {
+				select {
+				case ticker <- time.Now():
+				case <-time.After(100 * time.Millisecond):
+					return false
+				}
+			}
+			return true
+		}
+
+		emptyResponse := DesiredStateServerResponse{
+			Results:   map[string]models.DesiredAppState{},
+			BulkToken: BulkToken{Id: 17},
+		}
+
+		Context("when the desired state is fresh as the fetch begins", func() {
+			BeforeEach(func() {
+				timeProvider.ProvideFakeChannels = true
+				store.BumpDesiredFreshness(timeProvider.Time())
+
+				fetcher = New(conf, store, metricsAccountant, httpClient, timeProvider, fakelogger.NewFakeLogger())
+				fetcher.Fetch(resultChan)
+			})
+
+			It("keeps it fresh until the fetch is done", func() {
+				storeAdapter.Delete("/hm/v1" + conf.DesiredFreshnessKey)
+				Ω(leaseTicks()).Should(BeTrue())
+				Ω(freshnessKeyExists()).Should(BeTrue())
+			})
+
+			It("stops keeping it fresh once the fetch succeeds", func() {
+				httpClient.LastRequest().Succeed(emptyResponse.ToJSON())
+				Ω((<-resultChan).Success).Should(BeTrue())
+				Ω(leaseTicks()).Should(BeFalse())
+			})
+
+			It("stops keeping it fresh once the fetch fails", func() {
+				httpClient.LastRequest().RespondWithStatus(http.StatusNotFound)
+				Ω((<-resultChan).Success).Should(BeFalse())
+				Ω(leaseTicks()).Should(BeFalse())
+			})
+		})
+
+		Context("when the desired state is not fresh as the fetch begins", func() {
+			BeforeEach(func() {
+				timeProvider.ProvideFakeChannels = true
+
+				fetcher = New(conf, store, metricsAccountant, httpClient, timeProvider, fakelogger.NewFakeLogger())
+				fetcher.Fetch(resultChan)
+			})
+
+			It("does not make it fresh before the fetch is done", func() {
+				Ω(freshnessKeyExists()).Should(BeFalse())
+				Ω(timeProvider.TickerChannelFor(storepackage.DesiredFreshnessLeaseTimer)).Should(BeNil())
+			})
+		})
+	})
+
+	Describe("Exclusions", func() {
+		var managed, inOrg, inSpace, byGuid, byName models.DesiredAppState
+
+		BeforeEach(func() {
+			managed = appfixture.NewAppFixture().DesiredState(1)
+			managed.Name = "dora"
+			inOrg = appfixture.NewAppFixture().DesiredState(1)
+			inOrg.OrganizationGuid = "system-org"
+			inSpace = appfixture.NewAppFixture().DesiredState(1)
+			inSpace.SpaceGuid = "system-space"
+			byGuid = appfixture.NewAppFixture().DesiredState(1)
+			byName = appfixture.NewAppFixture().DesiredState(1)
+			byName.Name = "system-router"
+
+			conf.FetcherExclusions = config.FetcherExclusions{
+				OrganizationGuids: []string{"system-org"},
+				SpaceGuids:        []string{"system-space"},
+				AppGuids:          []string{byGuid.AppGuid},
+				NameRegex:         "^system-",
+			}
+			fetcher.Fetch(resultChan)
+
+			page := DesiredStateServerResponse{
+				Results: map[string]models.DesiredAppState{
+					managed.AppGuid: managed,
+					inOrg.AppGuid:   inOrg,
+					inSpace.AppGuid: inSpace,
+					byGuid.AppGuid:  byGuid,
+					byName.AppGuid:  byName,
+				},
+				BulkToken: BulkToken{Id: 5},
+			}
+			httpClient.LastRequest().Succeed(page.ToJSON())
+			httpClient.LastRequest().Succeed(DesiredStateServerResponse{BulkToken: BulkToken{Id: 6}}.ToJSON())
+		})
+
+		It("should store the excluded apps marked unmanaged", func() {
+			desired, err := store.GetDesiredState()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(desired).Should(HaveLen(5))
+
+			Ω(desired[managed.StoreKey()].Unmanaged).Should(BeFalse())
+			for _, excluded := range []models.DesiredAppState{inOrg, inSpace, byGuid, byName} {
+				Ω(desired[excluded.StoreKey()].Unmanaged).Should(BeTrue())
+			}
+		})
+	})
+
+	Describe("Conditional requests", func() {
+		var (
+			pageCache *PageCache
+			app       appfixture.AppFixture
+			page      DesiredStateServerResponse
+			lastPage  DesiredStateServerResponse
+		)
+
+		withETag := func(etag string) http.Header {
+			return http.Header{"Etag": []string{etag}}
+		}
+
+		fetch := func() {
+			httpClient.Reset()
+			fetcher = New(conf, store, metricsAccountant, httpClient, timeProvider, fakelogger.NewFakeLogger())
+			fetcher.UsePageCache(pageCache)
+			fetcher.Fetch(resultChan)
+		}
+
+		BeforeEach(func() {
+			pageCache = NewPageCache()
+			app = appfixture.NewAppFixture()
+			page = DesiredStateServerResponse{
+				Results:   map[string]models.DesiredAppState{app.AppGuid: app.DesiredState(1)},
+				BulkToken: BulkToken{Id: 5},
+			}
+			lastPage = DesiredStateServerResponse{
+				Results:   map[string]models.DesiredAppState{},
+				BulkToken: BulkToken{Id: 6},
+			}
+
+			fetch()
+			httpClient.LastRequest().RespondWithHeader(http.StatusOK, withETag(`"page-1"`), page.ToJSON(), nil)
+			httpClient.LastRequest().RespondWithHeader(http.StatusOK, withETag(`"page-2"`), lastPage.ToJSON(), nil)
+			Ω((<-resultChan).Success).Should(BeTrue())
+		})
+
+		It("should not ask for pages it has not seen", func() {
+			Ω(httpClient.Requests[0].Header.Get("If-None-Match")).Should(BeEmpty())
+			Ω(metricsAccountant.DesiredStatePageCacheMisses).Should(Equal(2))
+		})
+
+		Context("on the next fetch", func() {
+			BeforeEach(func() {
+				store.SyncDesiredState()
+				fetch()
+			})
+
+			It("should only ask for the pages that have changed", func() {
+				Ω(httpClient.LastRequest().Header.Get("If-None-Match")).Should(Equal(`"page-1"`))
+			})
+
+			Context("when the CC says they have not", func() {
+				BeforeEach(func() {
+					httpClient.LastRequest().RespondWithStatus(http.StatusNotModified)
+					Ω(httpClient.LastRequest().Header.Get("If-None-Match")).Should(Equal(`"page-2"`))
+					httpClient.LastRequest().RespondWithStatus(http.StatusNotModified)
+				})
+
+				It("should use the pages it already has", func() {
+					Ω((<-resultChan).Success).Should(BeTrue())
+					desired, _ := store.GetDesiredState()
+					Ω(desired).Should(HaveLen(1))
+					Ω(desired[app.DesiredState(1).StoreKey()]).Should(EqualDesiredState(app.DesiredState(1)))
+				})
+
+				It("should count the hits", func() {
+					Ω(metricsAccountant.DesiredStatePageCacheHits).Should(Equal(2))
+					Ω(metricsAccountant.DesiredStatePageCacheMisses).Should(Equal(2))
+				})
+			})
+
+			Context("when a page has changed", func() {
+				var otherApp appfixture.AppFixture
+
+				BeforeEach(func() {
+					otherApp = appfixture.NewAppFixture()
+					page.Results = map[string]models.DesiredAppState{otherApp.AppGuid: otherApp.DesiredState(1)}
+					httpClient.LastRequest().RespondWithHeader(http.StatusOK, withETag(`"page-1b"`), page.ToJSON(), nil)
+					httpClient.LastRequest().RespondWithStatus(http.StatusNotModified)
+					Ω((<-resultChan).Success).Should(BeTrue())
+				})
+
+				It("should use the new page", func() {
+					desired, _ := store.GetDesiredState()
+					Ω(desired).Should(HaveLen(1))
+					Ω(desired[otherApp.DesiredState(1).StoreKey()]).Should(EqualDesiredState(otherApp.DesiredState(1)))
+				})
+
+				It("should ask for it by its new ETag next time", func() {
+					fetch()
+					Ω(httpClient.LastRequest().Header.Get("If-None-Match")).Should(Equal(`"page-1b"`))
+				})
+			})
+		})
+
+		Context("when the CC does not send ETags", func() {
+			BeforeEach(func() {
+				pageCache = NewPageCache()
+				fetch()
+				httpClient.LastRequest().Succeed(page.ToJSON())
+				httpClient.LastRequest().Succeed(lastPage.ToJSON())
+				Ω((<-resultChan).Success).Should(BeTrue())
+
+				fetch()
+			})
+
+			It("should make plain requests", func() {
+				Ω(httpClient.LastRequest().Header.Get("If-None-Match")).Should(BeEmpty())
+			})
+
+			It("should not accept a Not Modified response", func() {
+				httpClient.LastRequest().RespondWithStatus(http.StatusNotModified)
+				result := <-resultChan
+				Ω(result.Success).Should(BeFalse())
+				Ω(result.Message).Should(Equal("HTTP request received non-200 response (304)"))
+			})
 		})
 	})
 })
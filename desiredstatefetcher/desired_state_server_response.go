@@ -2,6 +2,7 @@ package desiredstatefetcher
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/cloudfoundry/hm9000/models"
 )
 
@@ -29,3 +30,26 @@ func (response DesiredStateServerResponse) ToJSON() []byte {
 	encoded, _ := json.Marshal(response)
 	return encoded
 }
+
+// AppCountResponse is the CC's answer to /bulk/counts?model=app.
+type AppCountResponse struct {
+	Counts map[string]int `json:"counts"`
+}
+
+// NewAppCountResponse decodes an AppCountResponse, which must have counted
+// the apps.
+func NewAppCountResponse(jsonMessage []byte) (AppCountResponse, error) {
+	response := AppCountResponse{}
+	err := json.Unmarshal(jsonMessage, &response)
+	if err != nil {
+		return response, err
+	}
+	if _, counted := response.Counts["app"]; !counted {
+		return response, errors.New("the response has no app count")
+	}
+	return response, nil
+}
+
+func (response AppCountResponse) Apps() int {
+	return response.Counts["app"]
+}
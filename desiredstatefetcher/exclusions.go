@@ -0,0 +1,52 @@
+package desiredstatefetcher
+
+import (
+	"regexp"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// exclusions match the apps of the fetcher_exclusions, which are stored
+// unmanaged.
+type exclusions struct {
+	organizationGuids map[string]bool
+	spaceGuids        map[string]bool
+	appGuids          map[string]bool
+	name              *regexp.Regexp
+}
+
+// newExclusions compiles the fetcher_exclusions.  A name regex that does
+// not compile, which validation rejects, excludes nothing.
+func newExclusions(conf config.FetcherExclusions) exclusions {
+	e := exclusions{
+		organizationGuids: set(conf.OrganizationGuids),
+		spaceGuids:        set(conf.SpaceGuids),
+		appGuids:          set(conf.AppGuids),
+	}
+	if conf.NameRegex != "" {
+		e.name, _ = regexp.Compile(conf.NameRegex)
+	}
+	return e
+}
+
+func set(values []string) map[string]bool {
+	members := map[string]bool{}
+	for _, value := range values {
+		members[value] = true
+	}
+	return members
+}
+
+func (e exclusions) excludes(desiredState models.DesiredAppState) bool {
+	if e.appGuids[desiredState.AppGuid] {
+		return true
+	}
+	if desiredState.OrganizationGuid != "" && e.organizationGuids[desiredState.OrganizationGuid] {
+		return true
+	}
+	if desiredState.SpaceGuid != "" && e.spaceGuids[desiredState.SpaceGuid] {
+		return true
+	}
+	return e.name != nil && desiredState.Name != "" && e.name.MatchString(desiredState.Name)
+}
@@ -0,0 +1,263 @@
+package doctor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/desiredstatefetcher"
+	"github.com/cloudfoundry/hm9000/helpers/httpclient"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// KeyRoot is where the store check writes its key.  The key expires on its
+// own if the check dies before deleting it.
+const KeyRoot = "/hm/doctor"
+
+const keyTTL = 60
+
+const discoverSubject = "vcap.component.discover"
+
+// NATSRoundTrip connects, subscribes to a subject of its own and checks
+// that a message published to it comes back within wait.
+func NATSRoundTrip(name string, connect func() (messagebus.MessageBus, error), wait time.Duration) Check {
+	return Check{
+		Name: name,
+		Run: func() (string, error) {
+			messageBus, err := connect()
+			if err != nil {
+				return "", fmt.Errorf("failed to connect: %s", err.Error())
+			}
+			defer messageBus.Close()
+
+			subject := "hm9000.doctor." + models.Guid()
+			received := make(chan []byte, 1)
+			subscription, err := messageBus.Subscribe(subject, func(message *nats.Msg) {
+				select {
+				case received <- message.Data:
+				default:
+				}
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to subscribe: %s", err.Error())
+			}
+			defer messageBus.Unsubscribe(subscription)
+
+			payload := []byte(models.Guid())
+			err = messageBus.Publish(subject, payload)
+			if err != nil {
+				return "", fmt.Errorf("failed to publish: %s", err.Error())
+			}
+
+			select {
+			case data := <-received:
+				if !bytes.Equal(data, payload) {
+					return "", fmt.Errorf("received %q, but published %q", data, payload)
+				}
+				return "published a message and received it back", nil
+			case <-time.After(wait):
+				return "", fmt.Errorf("published a message but did not receive it back within %s", wait)
+			}
+		},
+	}
+}
+
+// StoreReadWriteTTL connects, writes a key with a TTL under KeyRoot, reads
+// it back and deletes it.
+func StoreReadWriteTTL(name string, connect func() (storeadapter.StoreAdapter, error)) Check {
+	return Check{
+		Name: name,
+		Run: func() (string, error) {
+			adapter, err := connect()
+			if err != nil {
+				return "", fmt.Errorf("failed to connect: %s", err.Error())
+			}
+			defer adapter.Disconnect()
+
+			node := storeadapter.StoreNode{
+				Key:   KeyRoot + "/" + models.Guid(),
+				Value: []byte(models.Guid()),
+				TTL:   keyTTL,
+			}
+
+			err = adapter.SetMulti([]storeadapter.StoreNode{node})
+			if err != nil {
+				return "", fmt.Errorf("failed to write %s: %s", node.Key, err.Error())
+			}
+
+			read, err := adapter.Get(node.Key)
+			if err != nil {
+				return "", fmt.Errorf("failed to read back %s: %s", node.Key, err.Error())
+			}
+			if !bytes.Equal(read.Value, node.Value) {
+				return "", fmt.Errorf("read back %q from %s, but wrote %q", read.Value, node.Key, node.Value)
+			}
+			if read.TTL == 0 || read.TTL > node.TTL {
+				return "", fmt.Errorf("wrote %s with a TTL of %ds, but read it back with a TTL of %ds", node.Key, node.TTL, read.TTL)
+			}
+
+			err = adapter.Delete(node.Key)
+			if err != nil {
+				return "", fmt.Errorf("failed to delete %s: %s", node.Key, err.Error())
+			}
+
+			return fmt.Sprintf("wrote a key with a %ds TTL, read it back and deleted it", node.TTL), nil
+		},
+	}
+}
+
+// CCBulkFetch fetches the first, one app long, batch of desired state from
+// the Cloud Controller's bulk API with the configured credentials.
+func CCBulkFetch(conf *config.Config, httpClient httpclient.HttpClient) Check {
+	return Check{
+		Name: "Cloud Controller",
+		Run: func() (string, error) {
+			req, err := http.NewRequest("GET", fmt.Sprintf("%s/bulk/apps?batch_size=1&bulk_token={}", conf.CCBaseURL), nil)
+			if err != nil {
+				return "", fmt.Errorf("failed to build the request: %s", err.Error())
+			}
+			authInfo := models.BasicAuthInfo{
+				User:     conf.CCAuthUser,
+				Password: conf.CCAuthPassword,
+			}
+			req.Header.Add("Authorization", authInfo.Encode())
+
+			status, body, err := do(httpClient, req)
+			if err != nil {
+				return "", err
+			}
+			if status == http.StatusUnauthorized {
+				return "", fmt.Errorf("unauthorized: check cc_auth_user and cc_auth_password")
+			}
+			if status != http.StatusOK {
+				return "", fmt.Errorf("received a %d response", status)
+			}
+
+			response, err := desiredstatefetcher.NewDesiredStateServerResponse(body)
+			if err != nil {
+				return "", fmt.Errorf("failed to parse the response: %s", err.Error())
+			}
+
+			return fmt.Sprintf("authenticated and fetched a batch of %d apps", len(response.Results)), nil
+		},
+	}
+}
+
+type componentAnnouncement struct {
+	Type        string   `json:"type"`
+	Host        string   `json:"host"`
+	Credentials []string `json:"credentials"`
+}
+
+type varz struct {
+	Contexts []struct {
+		Name string `json:"name"`
+	} `json:"contexts"`
+}
+
+// MetricsServer asks the components on the bus to announce themselves, as
+// the collector does, and fetches /varz from the first HM9000 to answer
+// within wait.
+func MetricsServer(connect func() (messagebus.MessageBus, error), httpClient httpclient.HttpClient, wait time.Duration) Check {
+	return Check{
+		Name: "metrics server",
+		Run: func() (string, error) {
+			messageBus, err := connect()
+			if err != nil {
+				return "", fmt.Errorf("failed to connect to NATS: %s", err.Error())
+			}
+			defer messageBus.Close()
+
+			replies := make(chan componentAnnouncement, 16)
+			replySubject := models.Guid()
+			subscription, err := messageBus.Subscribe(replySubject, func(message *nats.Msg) {
+				announcement := componentAnnouncement{}
+				if json.Unmarshal(message.Data, &announcement) != nil || announcement.Type != "HM9000" {
+					return
+				}
+				select {
+				case replies <- announcement:
+				default:
+				}
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to subscribe: %s", err.Error())
+			}
+			defer messageBus.Unsubscribe(subscription)
+
+			err = messageBus.PublishRequest(discoverSubject, replySubject, []byte(""))
+			if err != nil {
+				return "", fmt.Errorf("failed to publish %s: %s", discoverSubject, err.Error())
+			}
+
+			var announcement componentAnnouncement
+			select {
+			case announcement = <-replies:
+			case <-time.After(wait):
+				return "", fmt.Errorf("no metrics server answered %s within %s", discoverSubject, wait)
+			}
+
+			req, err := http.NewRequest("GET", "http://"+announcement.Host+"/varz", nil)
+			if err != nil {
+				return "", fmt.Errorf("failed to build the request: %s", err.Error())
+			}
+			if len(announcement.Credentials) == 2 {
+				req.SetBasicAuth(announcement.Credentials[0], announcement.Credentials[1])
+			}
+
+			status, body, err := do(httpClient, req)
+			if err != nil {
+				return "", err
+			}
+			if status != http.StatusOK {
+				return "", fmt.Errorf("%s/varz returned a %d response", announcement.Host, status)
+			}
+
+			metrics := varz{}
+			err = json.Unmarshal(body, &metrics)
+			if err != nil {
+				return "", fmt.Errorf("failed to parse %s/varz: %s", announcement.Host, err.Error())
+			}
+			for _, context := range metrics.Contexts {
+				if context.Name == "HM9000" {
+					return fmt.Sprintf("%s is registered with the collector and serves HM9000 metrics", announcement.Host), nil
+				}
+			}
+			return "", fmt.Errorf("%s/varz has no HM9000 metrics", announcement.Host)
+		},
+	}
+}
+
+func do(httpClient httpclient.HttpClient, req *http.Request) (int, []byte, error) {
+	type response struct {
+		status int
+		body   []byte
+		err    error
+	}
+
+	responses := make(chan response, 1)
+	httpClient.Do(req, func(resp *http.Response, err error) {
+		if err != nil {
+			responses <- response{err: fmt.Errorf("request to %s failed: %s", req.URL.Host, err.Error())}
+			return
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			responses <- response{err: fmt.Errorf("failed to read the response from %s: %s", req.URL.Host, err.Error())}
+			return
+		}
+		responses <- response{status: resp.StatusCode, body: body}
+	})
+
+	result := <-responses
+	return result.status, result.body, result.err
+}
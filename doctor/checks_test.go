@@ -0,0 +1,312 @@
+package doctor_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/hm9000/config"
+	. "github.com/cloudfoundry/hm9000/doctor"
+	"github.com/cloudfoundry/hm9000/helpers/httpclient"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type recordingStoreAdapter struct {
+	*fakestoreadapter.FakeStoreAdapter
+	written []storeadapter.StoreNode
+}
+
+func (adapter *recordingStoreAdapter) SetMulti(nodes []storeadapter.StoreNode) error {
+	adapter.written = append(adapter.written, nodes...)
+	return adapter.FakeStoreAdapter.SetMulti(nodes)
+}
+
+var _ = Describe("Checks", func() {
+	var messageBus *fakeyagnats.FakeNATSConn
+
+	connected := func() (messagebus.MessageBus, error) {
+		return messageBus, nil
+	}
+
+	unreachable := func() (messagebus.MessageBus, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	BeforeEach(func() {
+		messageBus = fakeyagnats.Connect()
+	})
+
+	Describe("the NATS round trip", func() {
+		It("passes when the published message comes back", func() {
+			detail, err := NATSRoundTrip("NATS", connected, time.Second).Run()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(detail).Should(ContainSubstring("received it back"))
+		})
+
+		It("fails when it cannot connect", func() {
+			_, err := NATSRoundTrip("NATS", unreachable, time.Second).Run()
+			Ω(err).Should(MatchError("failed to connect: connection refused"))
+		})
+
+		It("fails when publishing fails", func() {
+			check := NATSRoundTrip("NATS", func() (messagebus.MessageBus, error) {
+				return &failingPublisher{FakeNATSConn: messageBus}, nil
+			}, time.Second)
+
+			_, err := check.Run()
+			Ω(err).Should(MatchError("failed to publish: connection closed"))
+		})
+
+		It("fails when the message does not come back in time", func() {
+			check := NATSRoundTrip("NATS", func() (messagebus.MessageBus, error) {
+				return &deafSubscriber{FakeNATSConn: messageBus}, nil
+			}, 10*time.Millisecond)
+
+			_, err := check.Run()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("did not receive it back within 10ms"))
+		})
+	})
+
+	Describe("the store read, write and TTL check", func() {
+		var adapter *recordingStoreAdapter
+
+		BeforeEach(func() {
+			adapter = &recordingStoreAdapter{FakeStoreAdapter: fakestoreadapter.New()}
+		})
+
+		check := func() Check {
+			return StoreReadWriteTTL("store", func() (storeadapter.StoreAdapter, error) {
+				return adapter, nil
+			})
+		}
+
+		It("writes a key with a TTL under the doctor's root, then deletes it", func() {
+			detail, err := check().Run()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(detail).Should(ContainSubstring("60s TTL"))
+
+			Ω(adapter.written).Should(HaveLen(1))
+			Ω(adapter.written[0].Key).Should(HavePrefix(KeyRoot + "/"))
+			Ω(adapter.written[0].TTL).Should(BeNumerically(">", 0))
+
+			_, err = adapter.Get(adapter.written[0].Key)
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			Ω(adapter.DidDisconnect).Should(BeTrue())
+		})
+
+		It("fails when it cannot connect", func() {
+			_, err := StoreReadWriteTTL("store", func() (storeadapter.StoreAdapter, error) {
+				return adapter, errors.New("no etcd")
+			}).Run()
+			Ω(err).Should(MatchError("failed to connect: no etcd"))
+		})
+
+		It("fails when it cannot write", func() {
+			adapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("doctor", errors.New("read only"))
+
+			_, err := check().Run()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("failed to write"))
+			Ω(err.Error()).Should(ContainSubstring("read only"))
+		})
+
+		It("fails when it cannot read back", func() {
+			adapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("doctor", errors.New("timeout"))
+
+			_, err := check().Run()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("failed to read back"))
+		})
+
+		It("fails when it cannot delete", func() {
+			adapter.DeleteErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("doctor", errors.New("forbidden"))
+
+			_, err := check().Run()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("failed to delete"))
+		})
+	})
+
+	Describe("the Cloud Controller bulk fetch", func() {
+		var (
+			server   *httptest.Server
+			conf     *config.Config
+			status   int
+			body     string
+			requests []*http.Request
+		)
+
+		BeforeEach(func() {
+			status = http.StatusOK
+			body = `{"results":{"app-guid":{"droplet":"app-guid"}},"bulk_token":{"id":1}}`
+			requests = []*http.Request{}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r)
+				w.WriteHeader(status)
+				fmt.Fprint(w, body)
+			}))
+
+			var err error
+			conf, err = config.DefaultConfig()
+			Ω(err).ShouldNot(HaveOccurred())
+			conf.CCBaseURL = server.URL
+			conf.CCAuthUser = "mcat"
+			conf.CCAuthPassword = "testing"
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		run := func() (string, error) {
+			return CCBulkFetch(conf, httpclient.NewHttpClient(false, time.Second)).Run()
+		}
+
+		It("fetches one batch of apps with the configured credentials", func() {
+			detail, err := run()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(detail).Should(Equal("authenticated and fetched a batch of 1 apps"))
+
+			Ω(requests).Should(HaveLen(1))
+			Ω(requests[0].URL.Path).Should(Equal("/bulk/apps"))
+			Ω(requests[0].URL.Query().Get("batch_size")).Should(Equal("1"))
+			user, password, ok := requests[0].BasicAuth()
+			Ω(ok).Should(BeTrue())
+			Ω(user).Should(Equal("mcat"))
+			Ω(password).Should(Equal("testing"))
+		})
+
+		It("fails with a hint when the credentials are wrong", func() {
+			status = http.StatusUnauthorized
+
+			_, err := run()
+			Ω(err).Should(MatchError("unauthorized: check cc_auth_user and cc_auth_password"))
+		})
+
+		It("fails on any other unsuccessful response", func() {
+			status = http.StatusInternalServerError
+
+			_, err := run()
+			Ω(err).Should(MatchError("received a 500 response"))
+		})
+
+		It("fails when the response is not bulk API JSON", func() {
+			body = "<html>"
+
+			_, err := run()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("failed to parse the response"))
+		})
+
+		It("fails when the Cloud Controller cannot be reached", func() {
+			server.Close()
+
+			_, err := run()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("request to"))
+		})
+	})
+
+	Describe("the metrics server check", func() {
+		var (
+			server *httptest.Server
+			varz   string
+		)
+
+		announce := func(componentType string, host string) {
+			messageBus.Subscribe("vcap.component.discover", func(message *nats.Msg) {
+				messageBus.Publish(message.Reply, []byte(fmt.Sprintf(`{"type":%q,"host":%q,"credentials":["bob","password"]}`, componentType, host)))
+			})
+		}
+
+		BeforeEach(func() {
+			varz = `{"name":"HM9000","contexts":[{"name":"HM9000","metrics":[]}]}`
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, password, ok := r.BasicAuth()
+				if !ok || user != "bob" || password != "password" || r.URL.Path != "/varz" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(w, varz)
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		run := func() (string, error) {
+			return MetricsServer(connected, httpclient.NewHttpClient(false, time.Second), 50*time.Millisecond).Run()
+		}
+
+		host := func() string {
+			return strings.TrimPrefix(server.URL, "http://")
+		}
+
+		It("discovers the metrics server and fetches its varz", func() {
+			announce("HM9000", host())
+
+			detail, err := run()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(detail).Should(ContainSubstring(host()))
+		})
+
+		It("ignores other components", func() {
+			announce("Router", "10.0.0.1:1234")
+			announce("HM9000", host())
+
+			_, err := run()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("fails when no metrics server answers", func() {
+			announce("Router", "10.0.0.1:1234")
+
+			_, err := run()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("no metrics server answered vcap.component.discover"))
+		})
+
+		It("fails when varz does not come back", func() {
+			announce("HM9000", "127.0.0.1:1")
+
+			_, err := run()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("fails when varz has no HM9000 metrics", func() {
+			varz = `{"contexts":[]}`
+			announce("HM9000", host())
+
+			_, err := run()
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("has no HM9000 metrics"))
+		})
+	})
+})
+
+type failingPublisher struct {
+	*fakeyagnats.FakeNATSConn
+}
+
+func (conn *failingPublisher) Publish(subject string, data []byte) error {
+	return errors.New("connection closed")
+}
+
+type deafSubscriber struct {
+	*fakeyagnats.FakeNATSConn
+}
+
+func (conn *deafSubscriber) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	return conn.FakeNATSConn.Subscribe(subject, func(*nats.Msg) {})
+}
@@ -0,0 +1,77 @@
+package doctor
+
+import (
+	"fmt"
+	"time"
+)
+
+// A Check exercises one external dependency.  Run returns a short
+// description of what it saw, or an error saying what went wrong.
+type Check struct {
+	Name string
+	Run  func() (string, error)
+}
+
+type Result struct {
+	Name    string        `json:"name"`
+	Passed  bool          `json:"passed"`
+	Latency time.Duration `json:"latency"`
+	Detail  string        `json:"detail,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+func (report Report) Passed() bool {
+	for _, result := range report.Results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Run runs the checks one after another, so that their latencies are not
+// inflated by each other.  A check that takes longer than timeout fails; it
+// is left running in the background.
+func Run(checks []Check, timeout time.Duration) Report {
+	report := Report{Results: []Result{}}
+	for _, check := range checks {
+		report.Results = append(report.Results, run(check, timeout))
+	}
+	return report
+}
+
+type outcome struct {
+	detail string
+	err    error
+}
+
+func run(check Check, timeout time.Duration) Result {
+	outcomes := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		detail, err := check.Run()
+		outcomes <- outcome{detail: detail, err: err}
+	}()
+
+	var ran outcome
+	select {
+	case ran = <-outcomes:
+	case <-time.After(timeout):
+		ran.err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	result := Result{
+		Name:    check.Name,
+		Passed:  ran.err == nil,
+		Latency: time.Since(start),
+		Detail:  ran.detail,
+	}
+	if ran.err != nil {
+		result.Error = ran.err.Error()
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package doctor_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/doctor"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Running checks", func() {
+	passing := Check{Name: "passing", Run: func() (string, error) { return "all good", nil }}
+	failing := Check{Name: "failing", Run: func() (string, error) { return "", errors.New("all bad") }}
+	hanging := Check{Name: "hanging", Run: func() (string, error) {
+		time.Sleep(time.Second)
+		return "too late", nil
+	}}
+
+	It("reports every check in order", func() {
+		report := Run([]Check{passing, failing}, time.Second)
+
+		Ω(report.Results).Should(HaveLen(2))
+		Ω(report.Results[0].Name).Should(Equal("passing"))
+		Ω(report.Results[0].Passed).Should(BeTrue())
+		Ω(report.Results[0].Detail).Should(Equal("all good"))
+		Ω(report.Results[0].Error).Should(BeEmpty())
+		Ω(report.Results[1].Name).Should(Equal("failing"))
+		Ω(report.Results[1].Passed).Should(BeFalse())
+		Ω(report.Results[1].Error).Should(Equal("all bad"))
+	})
+
+	It("passes only if every check passed", func() {
+		Ω(Run([]Check{passing}, time.Second).Passed()).Should(BeTrue())
+		Ω(Run([]Check{passing, failing}, time.Second).Passed()).Should(BeFalse())
+	})
+
+	It("measures how long each check took", func() {
+		slow := Check{Name: "slow", Run: func() (string, error) {
+			time.Sleep(20 * time.Millisecond)
+			return "", nil
+		}}
+
+		report := Run([]Check{slow}, time.Second)
+		Ω(report.Results[0].Latency).Should(BeNumerically(">=", 20*time.Millisecond))
+	})
+
+	It("fails a check that takes longer than the timeout", func() {
+		report := Run([]Check{hanging, passing}, 10*time.Millisecond)
+
+		Ω(report.Results[0].Passed).Should(BeFalse())
+		Ω(report.Results[0].Error).Should(ContainSubstring("timed out"))
+		Ω(report.Results[1].Passed).Should(BeTrue())
+	})
+})
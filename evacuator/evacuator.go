@@ -1,47 +1,203 @@
 package evacuator
 
 import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/apcera/nats"
 	"github.com/cloudfoundry/gunk/timeprovider"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/eventbus"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
 	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/hm9000/store"
-	"github.com/cloudfoundry/yagnats"
 )
 
+const SubscriptionMonitorTimer = "SubscriptionMonitorTimer"
+const RetryTimer = "RetryTimer"
+
 type Evacuator struct {
-	messageBus   yagnats.NATSConn
-	store        store.Store
-	timeProvider timeprovider.TimeProvider
-	config       *config.Config
-	logger       logger.Logger
+	messageBus        messagebus.MessageBus
+	store             store.Store
+	metricsAccountant metricsaccountant.MetricsAccountant
+	timeProvider      timeprovider.TimeProvider
+	config            *config.Config
+	logger            logger.Logger
+
+	subscription         *nats.Subscription
+	shutdownSubscription *nats.Subscription
+	subscriptionMonitor  *messagebus.SubscriptionMonitor
+	stopMonitoring       chan bool
+
+	queueGroupMessages      int
+	queueGroupMessagesMutex sync.Mutex
+
+	events       *eventbus.EventBus
+	retryBuffer  []bufferedStart
+	retryMutex   sync.Mutex
+	stopRetrying chan bool
 }
 
-func New(messageBus yagnats.NATSConn, store store.Store, timeProvider timeprovider.TimeProvider, config *config.Config, logger logger.Logger) *Evacuator {
+// A bufferedStart is a start the evacuator failed to enqueue, and how many
+// times it has retried it.
+type bufferedStart struct {
+	message models.PendingStartMessage
+	retries int
+}
+
+func New(messageBus messagebus.MessageBus, store store.Store, metricsAccountant metricsaccountant.MetricsAccountant, timeProvider timeprovider.TimeProvider, config *config.Config, logger logger.Logger) *Evacuator {
 	return &Evacuator{
-		messageBus:   messageBus,
-		store:        store,
-		timeProvider: timeProvider,
-		config:       config,
-		logger:       logger,
+		messageBus:        messageBus,
+		store:             store,
+		metricsAccountant: metricsAccountant,
+		timeProvider:      timeProvider,
+		config:            config,
+		logger:            logger,
 	}
 }
 
+// PublishEventsTo has the evacuator publish EvacuationMissed to events
+// whenever it gives up on enqueuing a start.
+func (e *Evacuator) PublishEventsTo(events *eventbus.EventBus) {
+	e.events = events
+}
+
 func (e *Evacuator) Listen() {
-	e.messageBus.Subscribe("droplet.exited", func(message *nats.Msg) {
+	e.subscription, _ = e.messageBus.QueueSubscribe("droplet.exited", e.config.NATSQueueGroup, func(message *nats.Msg) {
+		e.trackQueueGroupMessage()
+
 		dropletExited, err := models.NewDropletExitedFromJSON([]byte(message.Data))
 		if err != nil {
 			e.logger.Error("Failed to parse droplet exited message", err)
+			e.metricsAccountant.IncrementErrors("Evacuator", err)
 			return
 		}
 
 		e.handleExited(dropletExited)
 	})
+
+	if e.config.DeaShutdownScheduledSubject != "" {
+		e.shutdownSubscription, _ = e.messageBus.QueueSubscribe(e.config.DeaShutdownScheduledSubject, e.config.NATSQueueGroup, func(message *nats.Msg) {
+			scheduled, err := models.NewDeaShutdownsScheduledFromJSON([]byte(message.Data))
+			if err != nil {
+				e.logger.Error("Failed to parse DEA shutdowns scheduled message", err)
+				e.metricsAccountant.IncrementErrors("Evacuator", err)
+				return
+			}
+
+			e.handleShutdownsScheduled(scheduled)
+		})
+	}
+
+	if e.subscription != nil {
+		e.subscriptionMonitor = messagebus.NewSubscriptionMonitor(e.logger)
+		e.subscriptionMonitor.Add("droplet.exited", e.subscription)
+		if e.shutdownSubscription != nil {
+			e.subscriptionMonitor.Add(e.config.DeaShutdownScheduledSubject, e.shutdownSubscription)
+		}
+		e.stopMonitoring = make(chan bool)
+		ticker := e.timeProvider.NewTickerChannel(SubscriptionMonitorTimer, e.config.HeartbeatPeriod.Duration)
+		go e.monitorSubscription(e.subscriptionMonitor, ticker, e.stopMonitoring)
+	}
+
+	if e.config.EvacuatorRetryBufferSize > 0 && e.config.EvacuatorRetries > 0 {
+		e.stopRetrying = make(chan bool)
+		ticker := e.timeProvider.NewTickerChannel(RetryTimer, e.config.EvacuatorRetryInterval())
+		go e.retryPeriodically(ticker, e.stopRetrying)
+	}
+}
+
+// monitorSubscription tracks, every heartbeat period until stopped, how far
+// behind the NATS client the droplet.exited handler is, and logs any
+// messages dropped because it fell too far.
+func (e *Evacuator) monitorSubscription(monitor *messagebus.SubscriptionMonitor, ticker <-chan time.Time, stop chan bool) {
+	for {
+		select {
+		case <-ticker:
+			err := e.metricsAccountant.TrackNATSSubscriptions("Evacuator", monitor.Check())
+			if err != nil {
+				e.logger.Error("Failed to track the evacuator's NATS subscription", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// trackQueueGroupMessage counts a droplet.exited message towards this
+// evacuator's share of the queue group's messages.
+func (e *Evacuator) trackQueueGroupMessage() {
+	if e.config.NATSQueueGroup == "" {
+		return
+	}
+
+	e.queueGroupMessagesMutex.Lock()
+	e.queueGroupMessages++
+	messages := e.queueGroupMessages
+	e.queueGroupMessagesMutex.Unlock()
+
+	err := e.metricsAccountant.TrackQueueGroupMessages("Evacuator", e.config.InstanceName(), messages)
+	if err != nil {
+		e.logger.Error("Failed to track the evacuator's share of the queue group's messages", err)
+	}
+}
+
+// Stop unsubscribes from droplet.exited, and the DEA shutdowns scheduled
+// subject, and stops monitoring the subscriptions and retrying starts.
+// Starts still buffered are missed.
+func (e *Evacuator) Stop() {
+	if e.stopMonitoring != nil {
+		close(e.stopMonitoring)
+		e.stopMonitoring = nil
+	}
+
+	if e.subscription != nil {
+		e.messageBus.Unsubscribe(e.subscription)
+		e.subscription = nil
+	}
+
+	if e.shutdownSubscription != nil {
+		e.messageBus.Unsubscribe(e.shutdownSubscription)
+		e.shutdownSubscription = nil
+	}
+
+	if e.stopRetrying != nil {
+		close(e.stopRetrying)
+		e.missBufferedStarts()
+	}
+}
+
+// handleShutdownsScheduled records the DEAs deployment tooling is about to
+// shut down, so that the analyzer can start replacements for the apps with
+// one instance on them before they go.
+func (e *Evacuator) handleShutdownsScheduled(scheduled models.DeaShutdownsScheduled) {
+	if len(scheduled.DeaGuids) == 0 {
+		return
+	}
+
+	details := map[string]string{"DEAs": strings.Join(scheduled.DeaGuids, ",")}
+	err := e.store.ScheduleDeaShutdowns(e.timeProvider.Time(), scheduled.DeaGuids...)
+	if err != nil {
+		e.logger.Error("Failed to record the DEA shutdowns scheduled", err, details)
+		e.metricsAccountant.IncrementErrors("Evacuator", err)
+		return
+	}
+	e.logger.Info("Recorded the DEA shutdowns scheduled", details)
 }
 
 func (e *Evacuator) handleExited(exited models.DropletExited) {
 	switch exited.Reason {
+	case models.DropletExitedReasonCrashed:
+		reason := models.NewCrashReason(exited, e.timeProvider.Time())
+		err := e.store.SaveCrashReasons(reason)
+		if err != nil {
+			e.logger.Error("Failed to record why the instance crashed", err, reason.LogDescription())
+			e.metricsAccountant.IncrementErrors("Evacuator", err)
+		}
 	case models.DropletExitedReasonDEAShutdown, models.DropletExitedReasonDEAEvacuation:
 		startMessage := models.NewPendingStartMessage(
 			e.timeProvider.Time(),
@@ -54,9 +210,108 @@ func (e *Evacuator) handleExited(exited models.DropletExited) {
 			models.PendingStartMessageReasonEvacuating,
 		)
 		startMessage.SkipVerification = true
+		startMessage.Origin = models.OriginEvacuator
 
 		e.logger.Info("Scheduling start message for droplet.exited message", startMessage.LogDescription(), exited.LogDescription())
 
-		e.store.SavePendingStartMessages(startMessage)
+		err := e.enqueue(startMessage)
+		if err != nil {
+			e.logger.Error("Failed to enqueue start message for droplet.exited message", err, startMessage.LogDescription())
+			e.metricsAccountant.IncrementErrors("Evacuator", err)
+			e.bufferForRetry(startMessage, err)
+		}
+	}
+}
+
+func (e *Evacuator) enqueue(startMessage models.PendingStartMessage) error {
+	deduplicated, err := e.store.EnqueuePendingStartMessages(startMessage)
+	if err != nil {
+		return err
+	}
+
+	if len(deduplicated) > 0 {
+		e.logger.Info("Start message for droplet.exited message is already enqueued", startMessage.LogDescription())
+		e.metricsAccountant.IncrementDeduplicatedMessageMetrics(deduplicated, []models.PendingStopMessage{})
+	}
+	return nil
+}
+
+// StartsPendingRetry is how many starts the evacuator has buffered to retry.
+func (e *Evacuator) StartsPendingRetry() int {
+	e.retryMutex.Lock()
+	defer e.retryMutex.Unlock()
+	return len(e.retryBuffer)
+}
+
+func (e *Evacuator) bufferForRetry(startMessage models.PendingStartMessage, err error) {
+	e.retryMutex.Lock()
+	defer e.retryMutex.Unlock()
+
+	if e.stopRetrying == nil {
+		e.miss(startMessage, err)
+		return
+	}
+	if len(e.retryBuffer) >= e.config.EvacuatorRetryBufferSize {
+		e.miss(startMessage, errors.New("the retry buffer is full"))
+		return
+	}
+	e.retryBuffer = append(e.retryBuffer, bufferedStart{message: startMessage})
+}
+
+func (e *Evacuator) retryPeriodically(ticker <-chan time.Time, stop chan bool) {
+	for {
+		select {
+		case <-ticker:
+			e.retryBufferedStarts()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// retryBufferedStarts tries to enqueue each buffered start again, and
+// misses those that have used up evacuator_retries.
+func (e *Evacuator) retryBufferedStarts() {
+	e.retryMutex.Lock()
+	defer e.retryMutex.Unlock()
+
+	remaining := []bufferedStart{}
+	for _, buffered := range e.retryBuffer {
+		err := e.enqueue(buffered.message)
+		if err == nil {
+			e.logger.Info("Enqueued start message for droplet.exited message on retry", buffered.message.LogDescription())
+			continue
+		}
+
+		buffered.retries++
+		if buffered.retries >= e.config.EvacuatorRetries {
+			e.miss(buffered.message, err)
+			continue
+		}
+		remaining = append(remaining, buffered)
+	}
+	e.retryBuffer = remaining
+}
+
+func (e *Evacuator) missBufferedStarts() {
+	e.retryMutex.Lock()
+	defer e.retryMutex.Unlock()
+
+	for _, buffered := range e.retryBuffer {
+		e.miss(buffered.message, errors.New("the evacuator stopped"))
+	}
+	e.retryBuffer = nil
+	e.stopRetrying = nil
+}
+
+// miss gives up on a start, and has the analyzer run at once, under hm9000
+// serve, so that it starts the evacuated instance from the actual state
+// once the store takes writes again.
+func (e *Evacuator) miss(startMessage models.PendingStartMessage, err error) {
+	e.logger.Error("Evacuation missed: gave up on enqueuing its start message", err, startMessage.LogDescription())
+	err = e.metricsAccountant.IncrementEvacuationsMissed()
+	if err != nil {
+		e.logger.Error("Failed to count the evacuation missed", err)
 	}
+	e.events.Publish(eventbus.EvacuationMissed)
 }
@@ -3,14 +3,19 @@ package evacuator_test
 import (
 	"time"
 
+	"errors"
+
 	"github.com/apcera/nats"
 	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
+	"github.com/cloudfoundry/hm9000/helpers/eventbus"
 	"github.com/cloudfoundry/hm9000/models"
 	storepackage "github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
 	. "github.com/cloudfoundry/hm9000/testhelpers/custommatchers"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakemetricsaccountant"
 	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
 	"github.com/cloudfoundry/yagnats/fakeyagnats"
 
@@ -25,6 +30,7 @@ var _ = Describe("Evacuator", func() {
 		messageBus   *fakeyagnats.FakeNATSConn
 		storeAdapter *fakestoreadapter.FakeStoreAdapter
 		timeProvider *faketimeprovider.FakeTimeProvider
+		accountant   *fakemetricsaccountant.FakeMetricsAccountant
 
 		store storepackage.Store
 		app   appfixture.AppFixture
@@ -42,7 +48,9 @@ var _ = Describe("Evacuator", func() {
 
 		app = appfixture.NewAppFixture()
 
-		evacuator = New(messageBus, store, timeProvider, conf, fakelogger.NewFakeLogger())
+		accountant = fakemetricsaccountant.New()
+
+		evacuator = New(messageBus, store, accountant, timeProvider, conf, fakelogger.NewFakeLogger())
 		evacuator.Listen()
 	})
 
@@ -50,6 +58,93 @@ var _ = Describe("Evacuator", func() {
 		Ω(messageBus.SubjectCallbacks("droplet.exited")).ShouldNot(BeNil())
 	})
 
+	It("should stop listening when stopped", func() {
+		evacuator.Stop()
+		Ω(messageBus.Subscriptions("droplet.exited")).Should(BeEmpty())
+	})
+
+	It("should track its NATS subscription every heartbeat period", func() {
+		evacuator.Stop()
+
+		timeProvider.ProvideFakeChannels = true
+		evacuator = New(messageBus, store, accountant, timeProvider, conf, fakelogger.NewFakeLogger())
+		evacuator.Listen()
+
+		ticker := timeProvider.TickerChannelFor(SubscriptionMonitorTimer)
+		Ω(ticker).ShouldNot(BeNil())
+		Ω(timeProvider.TickerDurationFor(SubscriptionMonitorTimer)).Should(Equal(conf.HeartbeatPeriod.Duration))
+
+		ticker <- time.Now()
+		ticker <- time.Now()
+		Ω(accountant.TrackedNATSSubscriptions).Should(HaveKey("Evacuator"))
+	})
+
+	Context("with a NATS queue group", func() {
+		BeforeEach(func() {
+			evacuator.Stop()
+
+			queueConf := *conf
+			queueConf.NATSQueueGroup = "hm9000"
+			queueConf.LeaderElectionCandidate = "evacuator-0"
+			evacuator = New(messageBus, store, accountant, timeProvider, &queueConf, fakelogger.NewFakeLogger())
+			evacuator.Listen()
+		})
+
+		It("should listen in the queue group", func() {
+			Ω(messageBus.Subscriptions("droplet.exited")).Should(HaveLen(1))
+			Ω(messageBus.Subscriptions("droplet.exited")[0].Queue).Should(Equal("hm9000"))
+		})
+
+		It("should track its share of the queue group's messages", func() {
+			messageBus.SubjectCallbacks("droplet.exited")[0](&nats.Msg{Data: []byte("ß")})
+			messageBus.SubjectCallbacks("droplet.exited")[0](&nats.Msg{Data: []byte("ß")})
+
+			Ω(accountant.QueueGroupMessages["Evacuator"]).Should(Equal(map[string]int{"evacuator-0": 2}))
+		})
+	})
+
+	It("should not track queue group messages without a queue group", func() {
+		messageBus.SubjectCallbacks("droplet.exited")[0](&nats.Msg{Data: []byte("ß")})
+		Ω(accountant.QueueGroupMessages).Should(BeEmpty())
+	})
+
+	It("should not listen for scheduled DEA shutdowns unless a subject is set", func() {
+		Ω(messageBus.Subscriptions("dea.shutdown_scheduled")).Should(BeEmpty())
+	})
+
+	Context("when listening for scheduled DEA shutdowns", func() {
+		BeforeEach(func() {
+			evacuator.Stop()
+
+			shutdownConf := *conf
+			shutdownConf.DeaShutdownScheduledSubject = "dea.shutdown_scheduled"
+			evacuator = New(messageBus, store, accountant, timeProvider, &shutdownConf, fakelogger.NewFakeLogger())
+			evacuator.Listen()
+		})
+
+		It("should record the DEAs announced", func() {
+			messageBus.SubjectCallbacks("dea.shutdown_scheduled")[0](&nats.Msg{Data: []byte(`{"deas": ["dea-1", "dea-2"]}`)})
+
+			shutdowns, err := store.GetScheduledDeaShutdowns()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(shutdowns).Should(HaveLen(2))
+			Ω(shutdowns["dea-1"]).Should(Equal(models.NewScheduledDeaShutdown("dea-1", timeProvider.Time())))
+		})
+
+		It("should ignore malformed messages", func() {
+			messageBus.SubjectCallbacks("dea.shutdown_scheduled")[0](&nats.Msg{Data: []byte("ß")})
+
+			shutdowns, err := store.GetScheduledDeaShutdowns()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(shutdowns).Should(BeEmpty())
+		})
+
+		It("should stop listening when stopped", func() {
+			evacuator.Stop()
+			Ω(messageBus.Subscriptions("dea.shutdown_scheduled")).Should(BeEmpty())
+		})
+	})
+
 	Context("when droplet.exited is received", func() {
 		Context("when the message is malformed", func() {
 			It("does nothing", func() {
@@ -61,6 +156,15 @@ var _ = Describe("Evacuator", func() {
 				Ω(err).ShouldNot(HaveOccurred())
 				Ω(pendingStarts).Should(BeEmpty())
 			})
+
+			It("counts a decode error", func() {
+				messageBus.SubjectCallbacks("droplet.exited")[0](&nats.Msg{
+					Data: []byte("ß"),
+				})
+
+				Ω(accountant.Errors["Evacuator"]).Should(HaveLen(1))
+				Ω(errorcategory.Of(accountant.Errors["Evacuator"][0])).Should(Equal(errorcategory.DecodeError))
+			})
 		})
 
 		Context("when the reason is DEA_EVACUATION", func() {
@@ -79,6 +183,126 @@ var _ = Describe("Evacuator", func() {
 
 				Ω(pendingStarts).Should(ContainElement(EqualPendingStartMessage(expectedStartMessage)))
 			})
+
+			It("should record that the evacuator decided to start it", func() {
+				pendingStarts, err := store.GetPendingStartMessages()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(pendingStarts).Should(HaveLen(1))
+				for _, message := range pendingStarts {
+					Ω(message.Origin).Should(Equal(models.OriginEvacuator))
+				}
+			})
+		})
+
+		Context("when the same instance is reported as evacuating twice", func() {
+			var firstStartMessage models.PendingStartMessage
+
+			BeforeEach(func() {
+				exited := app.InstanceAtIndex(1).DropletExited(models.DropletExitedReasonDEAEvacuation).ToJSON()
+				messageBus.SubjectCallbacks("droplet.exited")[0](&nats.Msg{Data: exited})
+				pendingStarts, _ := store.GetPendingStartMessages()
+				for _, message := range pendingStarts {
+					firstStartMessage = message
+				}
+
+				timeProvider.TimeToProvide = time.Unix(110, 0)
+				messageBus.SubjectCallbacks("droplet.exited")[0](&nats.Msg{Data: exited})
+			})
+
+			It("should keep the start message that was already pending", func() {
+				pendingStarts, err := store.GetPendingStartMessages()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(pendingStarts).Should(HaveLen(1))
+				Ω(pendingStarts).Should(ContainElement(firstStartMessage))
+			})
+
+			It("should count the deduplicated message", func() {
+				Ω(accountant.DeduplicatedStarts).Should(HaveLen(1))
+			})
+		})
+
+		Context("when the start cannot be enqueued", func() {
+			var (
+				missed <-chan struct{}
+				ticker chan time.Time
+			)
+
+			evacuate := func(index int) {
+				messageBus.SubjectCallbacks("droplet.exited")[0](&nats.Msg{
+					Data: app.InstanceAtIndex(index).DropletExited(models.DropletExitedReasonDEAEvacuation).ToJSON(),
+				})
+			}
+
+			pendingStarts := func() int {
+				starts, _ := store.GetPendingStartMessages()
+				return len(starts)
+			}
+
+			BeforeEach(func() {
+				evacuator.Stop()
+
+				timeProvider.ProvideFakeChannels = true
+				events := eventbus.New()
+				missed = events.Subscribe(eventbus.EvacuationMissed)
+				evacuator = New(messageBus, store, accountant, timeProvider, conf, fakelogger.NewFakeLogger())
+				evacuator.PublishEventsTo(events)
+				evacuator.Listen()
+				ticker = timeProvider.TickerChannelFor(RetryTimer)
+
+				storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("start", errors.New("oops"))
+				storeAdapter.CreateErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("start", errors.New("oops"))
+			})
+
+			AfterEach(func() {
+				conf.EvacuatorRetryBufferSize = 100
+			})
+
+			It("should retry every evacuator_retry_interval_in_milliseconds", func() {
+				Ω(timeProvider.TickerDurationFor(RetryTimer)).Should(Equal(conf.EvacuatorRetryInterval()))
+			})
+
+			It("should buffer the start, and enqueue it once the store takes writes again", func() {
+				evacuate(1)
+				Ω(evacuator.StartsPendingRetry()).Should(Equal(1))
+				Ω(pendingStarts()).Should(BeZero())
+
+				storeAdapter.SetErrInjector = nil
+				storeAdapter.CreateErrInjector = nil
+				ticker <- time.Now()
+
+				Eventually(pendingStarts).Should(Equal(1))
+				Eventually(evacuator.StartsPendingRetry).Should(BeZero())
+				Ω(missed).ShouldNot(Receive())
+			})
+
+			It("should miss the evacuation once it has retried evacuator_retries times", func() {
+				evacuate(1)
+				for i := 0; i < conf.EvacuatorRetries; i++ {
+					ticker <- time.Now()
+				}
+
+				Eventually(missed).Should(Receive())
+				Eventually(evacuator.StartsPendingRetry).Should(BeZero())
+				Ω(accountant.EvacuationsMissed).Should(Equal(1))
+			})
+
+			It("should miss the evacuation when the retry buffer is full", func() {
+				conf.EvacuatorRetryBufferSize = 1
+				evacuate(1)
+				Ω(missed).ShouldNot(Receive())
+
+				evacuate(2)
+				Ω(missed).Should(Receive())
+				Ω(evacuator.StartsPendingRetry()).Should(Equal(1))
+			})
+
+			It("should miss the evacuations still buffered when stopped", func() {
+				evacuate(1)
+				evacuator.Stop()
+
+				Ω(missed).Should(Receive())
+				Ω(evacuator.StartsPendingRetry()).Should(BeZero())
+			})
 		})
 
 		Context("when the reason is DEA_SHUTDOWN", func() {
@@ -114,17 +338,41 @@ var _ = Describe("Evacuator", func() {
 		})
 
 		Context("when the reason is CRASHED", func() {
+			var exited models.DropletExited
+
 			BeforeEach(func() {
+				exited = app.InstanceAtIndex(1).DropletExited(models.DropletExitedReasonCrashed)
+				exited.ExitStatusCode = 137
+				exited.ExitDescription = "out of memory"
 				messageBus.SubjectCallbacks("droplet.exited")[0](&nats.Msg{
-					Data: app.InstanceAtIndex(1).DropletExited(models.DropletExitedReasonCrashed).ToJSON(),
+					Data: exited.ToJSON(),
 				})
 			})
 
-			It("should do nothing", func() {
+			It("should not start it", func() {
 				pendingStarts, err := store.GetPendingStartMessages()
 				Ω(err).ShouldNot(HaveOccurred())
 				Ω(pendingStarts).Should(BeEmpty())
 			})
+
+			It("should record why it crashed", func() {
+				reasons, err := store.GetCrashReasonsForApp(app.AppGuid, app.AppVersion)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(reasons).Should(Equal([]models.CrashReason{models.NewCrashReason(exited, timeProvider.Time())}))
+			})
+
+			Context("when the crash cannot be recorded", func() {
+				BeforeEach(func() {
+					storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("crash-reasons", errors.New("oops"))
+					messageBus.SubjectCallbacks("droplet.exited")[0](&nats.Msg{
+						Data: exited.ToJSON(),
+					})
+				})
+
+				It("should count the error", func() {
+					Ω(accountant.Errors["Evacuator"]).Should(HaveLen(1))
+				})
+			})
 		})
 	})
 })
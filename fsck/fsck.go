@@ -0,0 +1,432 @@
+package fsck
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+type ProblemKind string
+
+const (
+	ProblemKindUndecodable ProblemKind = "UNDECODABLE"
+	ProblemKindOrphaned    ProblemKind = "ORPHANED"
+	ProblemKindBadTTL      ProblemKind = "BAD_TTL"
+	ProblemKindUnknownKey  ProblemKind = "UNKNOWN_KEY"
+)
+
+type Problem struct {
+	Key         string      `json:"key"`
+	Kind        ProblemKind `json:"kind"`
+	Description string      `json:"description"`
+	Repairable  bool        `json:"repairable"`
+}
+
+type Report struct {
+	KeysChecked int       `json:"keys_checked"`
+	Problems    []Problem `json:"problems"`
+}
+
+func (report Report) IsClean() bool {
+	return len(report.Problems) == 0
+}
+
+func (report Report) RepairableKeys() []string {
+	keys := []string{}
+	for _, problem := range report.Problems {
+		if problem.Repairable {
+			keys = append(keys, problem.Key)
+		}
+	}
+	return keys
+}
+
+type Checker struct {
+	adapter    storeadapter.StoreAdapter
+	conf       *config.Config
+	logger     logger.Logger
+	schemaRoot string
+}
+
+func New(adapter storeadapter.StoreAdapter, conf *config.Config, logger logger.Logger) *Checker {
+	return &Checker{
+		adapter:    adapter,
+		conf:       conf,
+		logger:     logger,
+		schemaRoot: storepackage.NewStore(conf, adapter, logger).SchemaRoot(),
+	}
+}
+
+type referencingNode struct {
+	node         storeadapter.StoreNode
+	appKey       string
+	instanceGuid string
+}
+
+// Check walks every key under the current schema version.  Values are first
+// decoded individually; references between keys (pending messages and crash
+// counts pointing at apps) are verified once the whole tree has been read.
+func (checker *Checker) Check() (Report, error) {
+	report := Report{Problems: []Problem{}}
+
+	root, err := checker.adapter.ListRecursively(checker.schemaRoot)
+	if err == storeadapter.ErrorKeyNotFound {
+		return report, nil
+	} else if err != nil {
+		return report, err
+	}
+
+	desiredApps := map[string]bool{}
+	actualApps := map[string]bool{}
+	instances := map[string]bool{}
+	crashNodes := []referencingNode{}
+	startNodes := []referencingNode{}
+	stopNodes := []referencingNode{}
+
+	checker.walk(root, func(node storeadapter.StoreNode) {
+		report.KeysChecked++
+		relativeKey := strings.TrimPrefix(node.Key, checker.schemaRoot)
+		components := strings.Split(strings.Trim(relativeKey, "/"), "/")
+		if len(components) > 3 && components[0] == "apps" && (components[1] == "desired" || components[1] == "actual") && storepackage.IsAppBucket(components[2]) {
+			// the bucketed app layout: check the app as if it were flat
+			components = append(components[:2:2], components[3:]...)
+		}
+
+		undecodable := func(err error) {
+			report.Problems = append(report.Problems, Problem{
+				Key:         node.Key,
+				Kind:        ProblemKindUndecodable,
+				Description: err.Error(),
+				Repairable:  true,
+			})
+		}
+
+		switch {
+		case relativeKey == checker.conf.ActualFreshnessKey:
+			checker.checkFreshness(node, checker.conf.ActualFreshnessTTL(), &report)
+		case relativeKey == checker.conf.DesiredFreshnessKey:
+			checker.checkFreshness(node, checker.conf.DesiredFreshnessTTL(), &report)
+		case len(components) == 1 && components[0] == "desired-sync":
+			checker.checkFreshness(node, checker.conf.DesiredFreshnessTTL(), &report)
+		case len(components) == 1 && components[0] == "app-summaries-fresh":
+			checker.checkFreshness(node, checker.conf.AppSummariesFreshnessTTL(), &report)
+		case len(components) == 2 && components[0] == "last-fresh":
+			err := json.Unmarshal(node.Value, &models.FreshnessTimestamp{})
+			if err != nil {
+				undecodable(err)
+			}
+
+		case len(components) == 3 && components[0] == "apps" && components[1] == "desired":
+			guid, version, ok := splitAppKey(components[2])
+			if !ok {
+				undecodable(fmt.Errorf("Malformed app key %s", components[2]))
+				return
+			}
+			_, err := models.NewDesiredAppStateFromCSV(guid, version, node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			desiredApps[components[2]] = true
+
+		case len(components) == 4 && components[0] == "apps" && components[1] == "actual":
+			guid, version, ok := splitAppKey(components[2])
+			if !ok {
+				undecodable(fmt.Errorf("Malformed app key %s", components[2]))
+				return
+			}
+			_, err := models.NewInstanceHeartbeatFromCSV(guid, version, components[3], node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			actualApps[components[2]] = true
+			instances[components[3]] = true
+
+		case len(components) == 3 && components[0] == "apps" && components[1] == "crash-history":
+			err := json.Unmarshal(node.Value, &[]models.CrashCount{})
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, uint64(checker.conf.MaximumBackoffDelay().Seconds())*2, &report)
+			crashNodes = append(crashNodes, referencingNode{node: node, appKey: components[2]})
+
+		case len(components) == 3 && components[0] == "apps" && components[1] == "undesired":
+			_, err := strconv.Atoi(string(node.Value))
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, 2*checker.conf.DesiredFreshnessTTL(), &report)
+
+		case len(components) == 3 && components[0] == "apps" && components[1] == "shed":
+			_, err := models.NewShedAppFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, checker.conf.InstanceMissingGracePeriod(), &report)
+
+		case len(components) == 3 && components[0] == "apps" && components[1] == "freshness":
+			_, err := models.NewAppFreshnessFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, checker.conf.HeartbeatTTL(), &report)
+
+		case len(components) == 3 && components[0] == "apps" && components[1] == "summaries":
+			_, err := models.NewAppSummaryFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+			}
+
+		case len(components) == 4 && components[0] == "apps" && components[1] == "crashes":
+			_, err := models.NewCrashCountFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, uint64(checker.conf.MaximumBackoffDelay().Seconds())*2, &report)
+			crashNodes = append(crashNodes, referencingNode{node: node, appKey: components[2]})
+
+		case len(components) == 2 && components[0] == "start":
+			message, err := models.NewPendingStartMessageFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			startNodes = append(startNodes, referencingNode{node: node, appKey: message.AppGuid + "," + message.AppVersion})
+
+		case len(components) == 2 && components[0] == "stop":
+			message, err := models.NewPendingStopMessageFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			stopNodes = append(stopNodes, referencingNode{node: node, appKey: message.AppGuid + "," + message.AppVersion, instanceGuid: message.InstanceGuid})
+
+		case len(components) == 2 && components[0] == "dea-presence":
+			checker.checkTTL(node, checker.conf.InstanceMissingGracePeriod(), &report)
+
+		case len(components) == 2 && components[0] == "component-runs":
+			_, err := models.NewComponentRunFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+			}
+
+		case len(components) == 2 && components[0] == "restarts":
+			_, err := models.NewRestartHistoryFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+			}
+
+		case len(components) == 2 && components[0] == "reports" && components[1] == "restarts":
+			_, err := models.NewRestartReportFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+			}
+
+		case len(components) == 2 && components[0] == "reports" && components[1] == "analysis":
+			_, err := models.NewAnalysisReportFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+			}
+
+		case len(components) == 2 && components[0] == "app-history":
+			_, err := models.NewAppHistoryFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, uint64(checker.conf.AppHistoryTTL().Seconds()), &report)
+
+		case len(components) == 2 && components[0] == "crash-trends":
+			_, err := models.NewCrashTrendFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, uint64(checker.conf.CrashTrendTTL().Seconds()), &report)
+
+		case len(components) == 2 && components[0] == "dea-zones":
+			_, err := models.NewDeaZoneFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, uint64(checker.conf.StaleZoneTimeout().Seconds()), &report)
+
+		case len(components) == 2 && components[0] == "dea-summaries":
+			_, err := models.NewDeaSummaryFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, checker.conf.InstanceMissingGracePeriod(), &report)
+
+		case len(components) == 3 && components[0] == "crash-reasons":
+			_, err := models.NewCrashReasonFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, uint64(checker.conf.MaximumBackoffDelay().Seconds())*2, &report)
+
+		case len(components) == 2 && components[0] == "suppressed-starts":
+			_, err := models.NewSuppressedStartFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, uint64(checker.conf.MaintenanceSuppressedStartsTTL().Seconds()), &report)
+
+		case len(components) == 3 && components[0] == "starts" && components[1] == "awaited":
+			_, err := models.NewAwaitedStartFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, uint64(checker.conf.StartEffectivenessWindow().Seconds())*2, &report)
+
+		case len(components) == 2 && components[0] == "dea-shutdowns":
+			_, err := models.NewScheduledDeaShutdownFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, uint64(checker.conf.DeaShutdownScheduledTTL().Seconds()), &report)
+
+		case len(components) == 2 && components[0] == "component-controls":
+			_, err := models.NewComponentControlFromJSON(node.Value)
+			if err != nil {
+				undecodable(err)
+			}
+
+		case len(components) == 2 && components[0] == "metrics":
+			_, err := strconv.ParseFloat(string(node.Value), 64)
+			if err != nil {
+				undecodable(err)
+			}
+
+		case len(components) == 3 && components[0] == "instance-metrics":
+			_, err := strconv.ParseFloat(string(node.Value), 64)
+			if err != nil {
+				undecodable(err)
+				return
+			}
+			checker.checkTTL(node, checker.conf.ActualFreshnessTTL(), &report)
+
+		default:
+			report.Problems = append(report.Problems, Problem{
+				Key:         node.Key,
+				Kind:        ProblemKindUnknownKey,
+				Description: "Key does not belong to the store layout",
+			})
+		}
+	})
+
+	for _, crash := range crashNodes {
+		if !desiredApps[crash.appKey] && !actualApps[crash.appKey] {
+			report.Problems = append(report.Problems, orphaned(crash.node, "Crash count for app "+crash.appKey+" which is neither desired nor running"))
+		}
+	}
+
+	for _, start := range startNodes {
+		if !desiredApps[start.appKey] {
+			report.Problems = append(report.Problems, orphaned(start.node, "Pending start for app "+start.appKey+" which is not desired"))
+		}
+	}
+
+	for _, stop := range stopNodes {
+		if !instances[stop.instanceGuid] {
+			report.Problems = append(report.Problems, orphaned(stop.node, "Pending stop for instance "+stop.instanceGuid+" which is not running"))
+		}
+	}
+
+	return report, nil
+}
+
+// Repair deletes every key the report marked as repairable.  Freshness keys,
+// keys with suspicious TTLs and keys outside the known layout are left for
+// an operator to look at.
+func (checker *Checker) Repair(report Report) error {
+	keys := report.RepairableKeys()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	for _, key := range keys {
+		checker.logger.Info("Repairing Key", map[string]string{"Key": key})
+	}
+
+	err := checker.adapter.Delete(keys...)
+	if err == storeadapter.ErrorKeyNotFound {
+		return nil
+	}
+	return err
+}
+
+func (checker *Checker) checkFreshness(node storeadapter.StoreNode, maximumTTL uint64, report *Report) {
+	err := json.Unmarshal(node.Value, &models.FreshnessTimestamp{})
+	if err != nil {
+		report.Problems = append(report.Problems, Problem{
+			Key:         node.Key,
+			Kind:        ProblemKindUndecodable,
+			Description: err.Error(),
+		})
+		return
+	}
+	checker.checkTTL(node, maximumTTL, report)
+}
+
+func (checker *Checker) checkTTL(node storeadapter.StoreNode, maximumTTL uint64, report *Report) {
+	if node.TTL == 0 {
+		report.Problems = append(report.Problems, Problem{
+			Key:         node.Key,
+			Kind:        ProblemKindBadTTL,
+			Description: "Key should expire but has no TTL",
+		})
+	} else if node.TTL > maximumTTL {
+		report.Problems = append(report.Problems, Problem{
+			Key:         node.Key,
+			Kind:        ProblemKindBadTTL,
+			Description: fmt.Sprintf("TTL of %ds exceeds the expected maximum of %ds", node.TTL, maximumTTL),
+		})
+	}
+}
+
+func (checker *Checker) walk(node storeadapter.StoreNode, callback func(storeadapter.StoreNode)) {
+	for _, child := range node.ChildNodes {
+		if child.Dir {
+			checker.walk(child, callback)
+		} else {
+			callback(child)
+		}
+	}
+}
+
+func orphaned(node storeadapter.StoreNode, description string) Problem {
+	return Problem{
+		Key:         node.Key,
+		Kind:        ProblemKindOrphaned,
+		Description: description,
+		Repairable:  true,
+	}
+}
+
+func splitAppKey(appKey string) (appGuid string, appVersion string, ok bool) {
+	guidVersion := strings.Split(appKey, ",")
+	if len(guidVersion) != 2 {
+		return "", "", false
+	}
+	return guidVersion[0], guidVersion[1], true
+}
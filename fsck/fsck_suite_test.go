@@ -0,0 +1,13 @@
+package fsck_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFsck(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fsck Suite")
+}
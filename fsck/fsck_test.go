@@ -0,0 +1,235 @@
+package fsck_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	. "github.com/cloudfoundry/hm9000/fsck"
+	"github.com/cloudfoundry/hm9000/models"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fsck", func() {
+	var (
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		store        storepackage.Store
+		checker      *Checker
+		app          appfixture.AppFixture
+		now          time.Time
+	)
+
+	problemsFor := func(report Report, key string) []Problem {
+		problems := []Problem{}
+		for _, problem := range report.Problems {
+			if problem.Key == key {
+				problems = append(problems, problem)
+			}
+		}
+		return problems
+	}
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		checker = New(storeAdapter, conf, fakelogger.NewFakeLogger())
+		now = time.Unix(1000, 0)
+
+		app = appfixture.NewAppFixture()
+		store.BumpActualFreshness(now)
+		store.BumpDesiredFreshness(now)
+		store.BeginDesiredStateSync(now)
+		store.SyncDesiredState(app.DesiredState(1))
+		store.SyncHeartbeats(app.Heartbeat(1))
+		store.SaveCrashCounts(models.CrashCount{AppGuid: app.AppGuid, AppVersion: app.AppVersion, InstanceIndex: 0, CrashCount: 1})
+		store.SavePendingStartMessages(models.NewPendingStartMessage(now, 0, 0, app.AppGuid, app.AppVersion, 1, 1.0, models.PendingStartMessageReasonMissing))
+		store.SavePendingStopMessages(models.NewPendingStopMessage(now, 0, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonExtra))
+		store.SaveMetric("ReceivedHeartbeats", 3)
+		store.SaveComponentRun(models.ComponentRun{Component: "Analyzer", StartedAt: now.Unix()})
+	})
+
+	Context("when the store is consistent", func() {
+		It("reports no problems", func() {
+			report, err := checker.Check()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Problems).Should(BeEmpty())
+			Ω(report.IsClean()).Should(BeTrue())
+			Ω(report.KeysChecked).Should(Equal(13))
+		})
+
+		It("reports no problems with the starts the sender awaits", func() {
+			start := models.NewPendingStartMessage(now, 0, 0, app.AppGuid, app.AppVersion, 1, 1.0, models.PendingStartMessageReasonMissing)
+			store.SaveAwaitedStarts(models.NewAwaitedStart(start, nil, now))
+
+			report, err := checker.Check()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Problems).Should(BeEmpty())
+			Ω(report.KeysChecked).Should(Equal(14))
+		})
+	})
+
+	Context("when the apps are in the bucketed layout", func() {
+		It("reports no problems", func() {
+			conf, _ := config.DefaultConfig()
+			conf.StoreAppLayoutVersion = storepackage.AppLayoutVersionBucketed
+			storeAdapter.Reset()
+			store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+			checker = New(storeAdapter, conf, fakelogger.NewFakeLogger())
+
+			store.BumpActualFreshness(now)
+			store.SyncDesiredState(app.DesiredState(1))
+			store.SyncHeartbeats(app.Heartbeat(1))
+			store.SaveCrashCounts(models.CrashCount{AppGuid: app.AppGuid, AppVersion: app.AppVersion, InstanceIndex: 0, CrashCount: 1})
+
+			report, err := checker.Check()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Problems).Should(BeEmpty())
+			Ω(report.KeysChecked).Should(Equal(6))
+		})
+	})
+
+	Context("when the store is empty", func() {
+		It("reports no problems", func() {
+			storeAdapter.Reset()
+			report, err := checker.Check()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.IsClean()).Should(BeTrue())
+			Ω(report.KeysChecked).Should(BeZero())
+		})
+	})
+
+	Context("when the store cannot be read", func() {
+		It("returns the error", func() {
+			storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("v1", storeadapter.ErrorTimeout)
+			_, err := checker.Check()
+			Ω(err).Should(Equal(storeadapter.ErrorTimeout))
+		})
+	})
+
+	Describe("decodability", func() {
+		It("flags values that do not decode as repairable", func() {
+			storeAdapter.SetMulti([]storeadapter.StoreNode{
+				{Key: "/hm/v1/apps/desired/abc,def", Value: []byte("LOL,STARTED")},
+				{Key: "/hm/v1/apps/actual/abc,def/ghi", Value: []byte("oops")},
+				{Key: "/hm/v1/start/abc", Value: []byte("{")},
+				{Key: "/hm/v1/metrics/Foo", Value: []byte("bar")},
+				{Key: "/hm/v1/component-runs/Analyzer", Value: []byte("{")},
+				{Key: "/hm/v1/component-controls/sender", Value: []byte("{")},
+				{Key: "/hm/v1/dea-zones/dea", Value: []byte("{")},
+				{Key: "/hm/v1/app-history/abc", Value: []byte("{")},
+				{Key: "/hm/v1/crash-trends/abc", Value: []byte("{")},
+				{Key: "/hm/v1/instance-metrics/Foo/listener-0", Value: []byte("bar")},
+				{Key: "/hm/v1/apps/shed/abc,def,dea", Value: []byte("{")},
+				{Key: "/hm/v1/apps/freshness/abc,def", Value: []byte("{")},
+				{Key: "/hm/v1/dea-summaries/dea", Value: []byte("{")},
+				{Key: "/hm/v1/suppressed-starts/abc,def,0", Value: []byte("{")},
+				{Key: "/hm/v1/starts/awaited/abc,def,0", Value: []byte("{")},
+				{Key: "/hm/v1/crash-reasons/abc,def/0", Value: []byte("{")},
+				{Key: "/hm/v1/apps/undesired/abc,def", Value: []byte("x")},
+				{Key: "/hm/v1/apps/summaries/abc,def", Value: []byte("{")},
+				{Key: "/hm/v1/dea-shutdowns/dea", Value: []byte("{")},
+				{Key: "/hm/v1/last-fresh/actual", Value: []byte("{")},
+			})
+
+			report, err := checker.Check()
+			Ω(err).ShouldNot(HaveOccurred())
+			for _, key := range []string{"/hm/v1/apps/desired/abc,def", "/hm/v1/apps/actual/abc,def/ghi", "/hm/v1/start/abc", "/hm/v1/metrics/Foo", "/hm/v1/component-runs/Analyzer", "/hm/v1/component-controls/sender", "/hm/v1/dea-zones/dea", "/hm/v1/app-history/abc", "/hm/v1/crash-trends/abc", "/hm/v1/instance-metrics/Foo/listener-0", "/hm/v1/apps/shed/abc,def,dea", "/hm/v1/apps/freshness/abc,def", "/hm/v1/dea-summaries/dea", "/hm/v1/suppressed-starts/abc,def,0", "/hm/v1/starts/awaited/abc,def,0", "/hm/v1/crash-reasons/abc,def/0", "/hm/v1/apps/undesired/abc,def", "/hm/v1/apps/summaries/abc,def", "/hm/v1/dea-shutdowns/dea", "/hm/v1/last-fresh/actual"} {
+				problems := problemsFor(report, key)
+				Ω(problems).Should(HaveLen(1))
+				Ω(problems[0].Kind).Should(Equal(ProblemKindUndecodable))
+				Ω(problems[0].Repairable).Should(BeTrue())
+			}
+		})
+
+		It("does not offer to repair an undecodable freshness key", func() {
+			storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/actual-fresh", Value: []byte("{"), TTL: 10}})
+
+			report, _ := checker.Check()
+			problems := problemsFor(report, "/hm/v1/actual-fresh")
+			Ω(problems).Should(HaveLen(1))
+			Ω(problems[0].Kind).Should(Equal(ProblemKindUndecodable))
+			Ω(problems[0].Repairable).Should(BeFalse())
+		})
+	})
+
+	Describe("referential consistency", func() {
+		var orphan appfixture.AppFixture
+
+		BeforeEach(func() {
+			orphan = appfixture.NewAppFixture()
+			store.SaveCrashCounts(models.CrashCount{AppGuid: orphan.AppGuid, AppVersion: orphan.AppVersion, InstanceIndex: 0, CrashCount: 1})
+			store.SavePendingStartMessages(models.NewPendingStartMessage(now, 0, 0, orphan.AppGuid, orphan.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing))
+			store.SavePendingStopMessages(models.NewPendingStopMessage(now, 0, 0, orphan.AppGuid, orphan.AppVersion, "gone", models.PendingStopMessageReasonExtra))
+		})
+
+		It("flags crash counts and pending messages for apps that do not exist", func() {
+			report, err := checker.Check()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Problems).Should(HaveLen(3))
+
+			for _, key := range []string{
+				"/hm/v1/apps/crash-history/" + orphan.AppGuid + "," + orphan.AppVersion,
+				"/hm/v1/start/" + orphan.AppGuid + "-" + orphan.AppVersion + "-0",
+				"/hm/v1/stop/gone",
+			} {
+				problems := problemsFor(report, key)
+				Ω(problems).Should(HaveLen(1))
+				Ω(problems[0].Kind).Should(Equal(ProblemKindOrphaned))
+				Ω(problems[0].Repairable).Should(BeTrue())
+			}
+		})
+
+		It("deletes repairable keys when repairing", func() {
+			report, _ := checker.Check()
+			err := checker.Repair(report)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			report, _ = checker.Check()
+			Ω(report.IsClean()).Should(BeTrue())
+
+			starts, _ := store.GetPendingStartMessages()
+			Ω(starts).Should(HaveLen(1))
+		})
+	})
+
+	Describe("TTL sanity", func() {
+		It("flags expiring keys with no TTL or an excessive TTL", func() {
+			storeAdapter.SetMulti([]storeadapter.StoreNode{
+				{Key: "/hm/v1/dea-presence/abc", Value: []byte("abc")},
+				{Key: "/hm/v1/desired-fresh", Value: []byte(`{"timestamp":10}`), TTL: 100000},
+				{Key: "/hm/v1/desired-sync", Value: []byte(`{"timestamp":10}`)},
+				{Key: "/hm/v1/app-summaries-fresh", Value: []byte(`{"timestamp":10}`)},
+				{Key: "/hm/v1/starts/awaited/abc,def,0", Value: []byte(`{"droplet":"abc","version":"def","index":0}`), TTL: 100000},
+			})
+
+			report, _ := checker.Check()
+			for _, key := range []string{"/hm/v1/dea-presence/abc", "/hm/v1/desired-fresh", "/hm/v1/desired-sync", "/hm/v1/app-summaries-fresh", "/hm/v1/starts/awaited/abc,def,0"} {
+				problems := problemsFor(report, key)
+				Ω(problems).Should(HaveLen(1))
+				Ω(problems[0].Kind).Should(Equal(ProblemKindBadTTL))
+				Ω(problems[0].Repairable).Should(BeFalse())
+			}
+		})
+	})
+
+	Describe("unknown keys", func() {
+		It("flags them without offering to repair them", func() {
+			storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/pokemon/geodude", Value: []byte("rock")}})
+
+			report, _ := checker.Check()
+			problems := problemsFor(report, "/hm/v1/pokemon/geodude")
+			Ω(problems).Should(HaveLen(1))
+			Ω(problems[0].Kind).Should(Equal(ProblemKindUnknownKey))
+
+			checker.Repair(report)
+			_, err := storeAdapter.Get("/hm/v1/pokemon/geodude")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
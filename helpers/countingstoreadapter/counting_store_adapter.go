@@ -0,0 +1,114 @@
+package countingstoreadapter
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// Counts are the requests made through a CountingStoreAdapter since they
+// were last collected.  A request counts once however many keys it reads
+// or writes.
+type Counts struct {
+	Reads  int
+	Writes int
+}
+
+// CountingStoreAdapter counts the reads and writes made through it, whether
+// or not they succeed.  Connecting, watching and maintaining nodes are not
+// counted.
+type CountingStoreAdapter struct {
+	storeadapter.StoreAdapter
+
+	counts Counts
+	lock   *sync.Mutex
+}
+
+func New(adapter storeadapter.StoreAdapter) *CountingStoreAdapter {
+	return &CountingStoreAdapter{
+		StoreAdapter: adapter,
+		lock:         &sync.Mutex{},
+	}
+}
+
+// Collect returns the counts since the last call and resets them.
+func (adapter *CountingStoreAdapter) Collect() Counts {
+	adapter.lock.Lock()
+	defer adapter.lock.Unlock()
+
+	counts := adapter.counts
+	adapter.counts = Counts{}
+	return counts
+}
+
+func (adapter *CountingStoreAdapter) Create(node storeadapter.StoreNode) error {
+	adapter.write()
+	return adapter.StoreAdapter.Create(node)
+}
+
+func (adapter *CountingStoreAdapter) Update(node storeadapter.StoreNode) error {
+	adapter.write()
+	return adapter.StoreAdapter.Update(node)
+}
+
+func (adapter *CountingStoreAdapter) CompareAndSwap(oldNode storeadapter.StoreNode, newNode storeadapter.StoreNode) error {
+	adapter.write()
+	return adapter.StoreAdapter.CompareAndSwap(oldNode, newNode)
+}
+
+func (adapter *CountingStoreAdapter) CompareAndSwapByIndex(prevIndex uint64, newNode storeadapter.StoreNode) error {
+	adapter.write()
+	return adapter.StoreAdapter.CompareAndSwapByIndex(prevIndex, newNode)
+}
+
+func (adapter *CountingStoreAdapter) SetMulti(nodes []storeadapter.StoreNode) error {
+	adapter.write()
+	return adapter.StoreAdapter.SetMulti(nodes)
+}
+
+func (adapter *CountingStoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	adapter.read()
+	return adapter.StoreAdapter.Get(key)
+}
+
+func (adapter *CountingStoreAdapter) ListRecursively(key string) (storeadapter.StoreNode, error) {
+	adapter.read()
+	return adapter.StoreAdapter.ListRecursively(key)
+}
+
+func (adapter *CountingStoreAdapter) Delete(keys ...string) error {
+	adapter.write()
+	return adapter.StoreAdapter.Delete(keys...)
+}
+
+func (adapter *CountingStoreAdapter) DeleteLeaves(keys ...string) error {
+	adapter.write()
+	return adapter.StoreAdapter.DeleteLeaves(keys...)
+}
+
+func (adapter *CountingStoreAdapter) CompareAndDelete(nodes ...storeadapter.StoreNode) error {
+	adapter.write()
+	return adapter.StoreAdapter.CompareAndDelete(nodes...)
+}
+
+func (adapter *CountingStoreAdapter) CompareAndDeleteByIndex(nodes ...storeadapter.StoreNode) error {
+	adapter.write()
+	return adapter.StoreAdapter.CompareAndDeleteByIndex(nodes...)
+}
+
+func (adapter *CountingStoreAdapter) UpdateDirTTL(key string, ttl uint64) error {
+	adapter.write()
+	return adapter.StoreAdapter.UpdateDirTTL(key, ttl)
+}
+
+func (adapter *CountingStoreAdapter) read() {
+	adapter.lock.Lock()
+	adapter.counts.Reads++
+	adapter.lock.Unlock()
+}
+
+func (adapter *CountingStoreAdapter) write() {
+	adapter.lock.Lock()
+	adapter.counts.Writes++
+	adapter.lock.Unlock()
+}
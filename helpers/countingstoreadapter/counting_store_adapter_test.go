@@ -0,0 +1,55 @@
+package countingstoreadapter_test
+
+import (
+	"errors"
+
+	. "github.com/cloudfoundry/hm9000/helpers/countingstoreadapter"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CountingStoreAdapter", func() {
+	var (
+		fakeAdapter *fakestoreadapter.FakeStoreAdapter
+		adapter     *CountingStoreAdapter
+	)
+
+	BeforeEach(func() {
+		fakeAdapter = fakestoreadapter.New()
+		adapter = New(fakeAdapter)
+	})
+
+	It("counts reads and writes, once a request", func() {
+		adapter.SetMulti([]storeadapter.StoreNode{{Key: "/a", Value: []byte("1")}, {Key: "/b", Value: []byte("2")}})
+		adapter.Get("/a")
+		adapter.ListRecursively("/")
+		adapter.Delete("/a", "/b")
+
+		Ω(adapter.Collect()).Should(Equal(Counts{Reads: 2, Writes: 2}))
+	})
+
+	It("counts failed requests", func() {
+		fakeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("a", errors.New("oops"))
+		_, err := adapter.Get("/a")
+		Ω(err).Should(HaveOccurred())
+
+		Ω(adapter.Collect()).Should(Equal(Counts{Reads: 1}))
+	})
+
+	It("passes requests through", func() {
+		adapter.SetMulti([]storeadapter.StoreNode{{Key: "/a", Value: []byte("1")}})
+
+		node, err := fakeAdapter.Get("/a")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.Value).Should(Equal([]byte("1")))
+	})
+
+	It("resets the counts once collected", func() {
+		adapter.Get("/a")
+		adapter.Collect()
+
+		Ω(adapter.Collect()).Should(Equal(Counts{}))
+	})
+})
@@ -0,0 +1,13 @@
+package countingstoreadapter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCountingStoreAdapter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Counting Store Adapter Suite")
+}
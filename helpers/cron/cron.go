@@ -0,0 +1,197 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Schedule is a parsed cron expression: five fields, minute (0-59), hour
+// (0-23), day of the month (1-31), month (1-12 or jan-dec) and day of the
+// week (0-7 or sun-sat, where 0 and 7 are both Sunday).  A field is a comma
+// separated list of values, ranges ("1-5") and steps ("*/15", "0-30/10"), or
+// "*" for every value.  As in Vixie cron, when both days are restricted a
+// time matches if either does.
+//
+// The macros @yearly (or @annually), @monthly, @weekly, @daily (or
+// @midnight) and @hourly stand for the usual expressions.
+//
+// Times are matched in the location of the time given to Next, which for
+// time.Now is the local time of the machine.
+type Schedule struct {
+	spec string
+
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+
+	// anyDayOfMonth and anyDayOfWeek are set for a day field of "*"
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Parse parses a cron expression, e.g. "0 3 * * *" for 03:00 every day.
+func Parse(spec string) (*Schedule, error) {
+	expression := strings.TrimSpace(spec)
+	if macro, ok := macros[strings.ToLower(expression)]; ok {
+		expression = macro
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields: minute, hour, day of month, month and day of week", spec)
+	}
+
+	schedule := &Schedule{spec: spec}
+	var err error
+
+	schedule.minute, err = parseField(fields[0], 0, 59, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cron expression %q: minute: %s", spec, err.Error())
+	}
+	schedule.hour, err = parseField(fields[1], 0, 23, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cron expression %q: hour: %s", spec, err.Error())
+	}
+	schedule.dayOfMonth, err = parseField(fields[2], 1, 31, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cron expression %q: day of month: %s", spec, err.Error())
+	}
+	schedule.month, err = parseField(fields[3], 1, 12, monthNames)
+	if err != nil {
+		return nil, fmt.Errorf("cron expression %q: month: %s", spec, err.Error())
+	}
+	schedule.dayOfWeek, err = parseField(fields[4], 0, 7, dayNames)
+	if err != nil {
+		return nil, fmt.Errorf("cron expression %q: day of week: %s", spec, err.Error())
+	}
+	if schedule.dayOfWeek&(1<<7) != 0 {
+		schedule.dayOfWeek |= 1
+	}
+
+	schedule.anyDayOfMonth = fields[2] == "*"
+	schedule.anyDayOfWeek = fields[4] == "*"
+
+	return schedule, nil
+}
+
+// parseField parses one field into a set of the values in [min, max].
+func parseField(field string, min int, max int, names map[string]int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		values, step := part, 1
+		if slash := strings.Index(part, "/"); slash >= 0 {
+			values = part[:slash]
+			var err error
+			step, err = strconv.Atoi(part[slash+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		low, high := min, max
+		if values != "*" {
+			var err error
+			bounds := strings.SplitN(values, "-", 2)
+			low, err = parseValue(bounds[0], names)
+			if err != nil {
+				return 0, err
+			}
+			high = low
+			if len(bounds) == 2 {
+				high, err = parseValue(bounds[1], names)
+				if err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for value := low; value <= high; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+func parseValue(value string, names map[string]int) (int, error) {
+	if number, ok := names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return number, nil
+}
+
+func (schedule *Schedule) String() string {
+	return schedule.spec
+}
+
+// Next is the first time after t that matches the schedule, to the minute,
+// or the zero time if none does within five years (e.g. "0 0 30 2 *").
+func (schedule *Schedule) Next(t time.Time) time.Time {
+	location := t.Location()
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for next.Before(limit) {
+		year, month, day := next.Date()
+
+		if !has(schedule.month, int(month)) {
+			next = time.Date(year, month+1, 1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !schedule.matchesDay(next) {
+			next = time.Date(year, month, day+1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !has(schedule.hour, next.Hour()) {
+			next = time.Date(year, month, day, next.Hour()+1, 0, 0, 0, location)
+			continue
+		}
+		if !has(schedule.minute, next.Minute()) {
+			next = next.Add(time.Minute)
+			continue
+		}
+		return next
+	}
+
+	return time.Time{}
+}
+
+func (schedule *Schedule) matchesDay(t time.Time) bool {
+	dayOfMonth := has(schedule.dayOfMonth, t.Day())
+	dayOfWeek := has(schedule.dayOfWeek, int(t.Weekday()))
+	if schedule.anyDayOfMonth || schedule.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+func has(set uint64, value int) bool {
+	return set&(1<<uint(value)) != 0
+}
@@ -0,0 +1,74 @@
+package cron_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/helpers/cron"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cron", func() {
+	// a Wednesday
+	from := time.Date(2014, time.May, 14, 10, 17, 30, 0, time.UTC)
+
+	next := func(spec string) time.Time {
+		schedule, err := Parse(spec)
+		Ω(err).ShouldNot(HaveOccurred())
+		return schedule.Next(from)
+	}
+
+	It("finds the next matching minute", func() {
+		Ω(next("* * * * *")).Should(Equal(time.Date(2014, time.May, 14, 10, 18, 0, 0, time.UTC)))
+		Ω(next("*/15 * * * *")).Should(Equal(time.Date(2014, time.May, 14, 10, 30, 0, 0, time.UTC)))
+		Ω(next("0 3 * * *")).Should(Equal(time.Date(2014, time.May, 15, 3, 0, 0, 0, time.UTC)))
+		Ω(next("30 9-17/4 * * *")).Should(Equal(time.Date(2014, time.May, 14, 13, 30, 0, 0, time.UTC)))
+		Ω(next("0 0 1 jan *")).Should(Equal(time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("is always after the time given", func() {
+		Ω(next("17 10 * * *")).Should(Equal(time.Date(2014, time.May, 15, 10, 17, 0, 0, time.UTC)))
+	})
+
+	It("matches days of the week, with 0 and 7 both Sunday", func() {
+		Ω(next("0 0 * * sun")).Should(Equal(time.Date(2014, time.May, 18, 0, 0, 0, 0, time.UTC)))
+		Ω(next("0 0 * * 7")).Should(Equal(time.Date(2014, time.May, 18, 0, 0, 0, 0, time.UTC)))
+		Ω(next("0 0 * * mon-fri")).Should(Equal(time.Date(2014, time.May, 15, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("matches either day when both are restricted", func() {
+		Ω(next("0 0 20 * fri")).Should(Equal(time.Date(2014, time.May, 16, 0, 0, 0, 0, time.UTC)))
+		Ω(next("0 0 15 * sun")).Should(Equal(time.Date(2014, time.May, 15, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("understands the macros", func() {
+		Ω(next("@hourly")).Should(Equal(time.Date(2014, time.May, 14, 11, 0, 0, 0, time.UTC)))
+		Ω(next("@daily")).Should(Equal(time.Date(2014, time.May, 15, 0, 0, 0, 0, time.UTC)))
+		Ω(next("@weekly")).Should(Equal(time.Date(2014, time.May, 18, 0, 0, 0, 0, time.UTC)))
+		Ω(next("@monthly")).Should(Equal(time.Date(2014, time.June, 1, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("matches in the location of the time given", func() {
+		location := time.FixedZone("UTC+2", 2*60*60)
+		schedule, err := Parse("0 3 * * *")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(schedule.Next(from.In(location))).Should(Equal(time.Date(2014, time.May, 15, 3, 0, 0, 0, location)))
+	})
+
+	It("returns the zero time when nothing ever matches", func() {
+		Ω(next("0 0 30 feb *").IsZero()).Should(BeTrue())
+	})
+
+	It("remembers its expression", func() {
+		schedule, err := Parse("0 3 * * *")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(schedule.String()).Should(Equal("0 3 * * *"))
+	})
+
+	It("rejects invalid expressions", func() {
+		for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+			_, err := Parse(spec)
+			Ω(err).Should(HaveOccurred(), spec)
+		}
+	})
+})
@@ -0,0 +1,223 @@
+package debugserver
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+}
+
+// Summary is what /debug/summary returns: the process's goroutines, grouped
+// by the function each is in, its heap and garbage collection, and the depth
+// of each queue the process has registered.
+type Summary struct {
+	Goroutines           int            `json:"goroutines"`
+	GoroutinesByFunction map[string]int `json:"goroutines_by_function"`
+
+	HeapAllocBytes uint64         `json:"heap_alloc_bytes"`
+	HeapObjects    uint64         `json:"heap_objects"`
+	GCRuns         uint32         `json:"gc_runs"`
+	GCPauseTotal   time.Duration  `json:"gc_pause_total"`
+	LastGCPause    time.Duration  `json:"last_gc_pause"`
+	SinceLastGC    time.Duration  `json:"since_last_gc"`
+	QueueDepths    map[string]int `json:"queue_depths"`
+}
+
+// Server serves, for profiling a running process, net/http/pprof under
+// /debug/pprof/, expvar's variables (including memstats) under /debug/vars
+// and a Summary under /debug/summary.  It also serves the log level of each
+// component under /log_level, which a PUT changes.  It has no
+// authentication, so it should listen on a loopback address.
+type Server struct {
+	address  string
+	logger   logger.Logger
+	listener net.Listener
+
+	queues map[string]func() int
+	lock   *sync.Mutex
+}
+
+func New(address string, logger logger.Logger) *Server {
+	return &Server{
+		address: address,
+		logger:  logger,
+		queues:  map[string]func() int{},
+		lock:    &sync.Mutex{},
+	}
+}
+
+// AddQueue has /debug/summary report depth() as the depth of the named
+// queue.  It does nothing on a nil Server, which is what a process with the
+// debug server turned off has.
+func (server *Server) AddQueue(name string, depth func() int) {
+	if server == nil {
+		return
+	}
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.queues[name] = depth
+}
+
+// Start listens on the server's address and serves in the background.
+func (server *Server) Start() error {
+	listener, err := net.Listen("tcp", server.address)
+	if err != nil {
+		return err
+	}
+	server.listener = listener
+
+	go http.Serve(listener, server.Handler())
+
+	server.logger.Info("Serving debug endpoints", map[string]string{"Address": server.Address()})
+	return nil
+}
+
+// Address is the address the server listens on, once started.
+func (server *Server) Address() string {
+	if server.listener == nil {
+		return server.address
+	}
+	return server.listener.Addr().String()
+}
+
+func (server *Server) Stop() {
+	if server.listener != nil {
+		server.listener.Close()
+	}
+}
+
+func (server *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/vars", serveVars)
+	mux.HandleFunc("/debug/summary", server.serveSummary)
+	mux.HandleFunc("/log_level", server.serveLogLevel)
+	return mux
+}
+
+// serveVars is expvar's own handler, which only serves from
+// http.DefaultServeMux.
+func serveVars(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !first {
+			fmt.Fprintf(w, ",\n")
+		}
+		first = false
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "\n}\n")
+}
+
+func (server *Server) serveSummary(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(server.Summary())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// serveLogLevel serves the level of every component on a GET.  A PUT with
+// level (and, optionally, component) changes it; a DELETE puts every
+// component back to its configured level.
+func (server *Server) serveLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		err := logger.SetLevel(r.FormValue("component"), r.FormValue("level"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, err.Error())
+			return
+		}
+		server.logger.Info("Changed log level", map[string]string{
+			"Component": r.FormValue("component"),
+			"Level":     r.FormValue("level"),
+		})
+	case "DELETE":
+		logger.ResetLevels()
+		server.logger.Info("Reset log levels")
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, _ := json.Marshal(logger.Levels())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func (server *Server) Summary() Summary {
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+
+	summary := Summary{
+		Goroutines:           runtime.NumGoroutine(),
+		GoroutinesByFunction: goroutinesByFunction(),
+		HeapAllocBytes:       memStats.HeapAlloc,
+		HeapObjects:          memStats.HeapObjects,
+		GCRuns:               memStats.NumGC,
+		GCPauseTotal:         time.Duration(memStats.PauseTotalNs),
+		QueueDepths:          map[string]int{},
+	}
+	if memStats.NumGC > 0 {
+		summary.LastGCPause = time.Duration(memStats.PauseNs[(memStats.NumGC+255)%256])
+		summary.SinceLastGC = time.Since(time.Unix(0, int64(memStats.LastGC)))
+	}
+
+	server.lock.Lock()
+	for name, depth := range server.queues {
+		summary.QueueDepths[name] = depth()
+	}
+	server.lock.Unlock()
+
+	return summary
+}
+
+var goroutineArguments = regexp.MustCompile(`\(.*\)$`)
+
+// goroutinesByFunction counts the goroutines in each function, going by the
+// top frame of their stacks.
+func goroutinesByFunction() map[string]int {
+	buffer := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buffer, true)
+		if n < len(buffer) {
+			buffer = buffer[:n]
+			break
+		}
+		buffer = make([]byte, 2*len(buffer))
+	}
+
+	counts := map[string]int{}
+	for _, goroutine := range strings.Split(string(buffer), "\n\n") {
+		lines := strings.Split(strings.TrimSpace(goroutine), "\n")
+		if len(lines) < 2 {
+			continue
+		}
+		counts[goroutineArguments.ReplaceAllString(lines[1], "")]++
+	}
+	return counts
+}
@@ -0,0 +1,146 @@
+package debugserver_test
+
+import (
+	"encoding/json"
+
+	"github.com/cloudfoundry/gosteno"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	. "github.com/cloudfoundry/hm9000/helpers/debugserver"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Debug Server", func() {
+	var server *Server
+
+	get := func(path string) (int, []byte) {
+		resp, err := http.Get("http://" + server.Address() + path)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Ω(err).ShouldNot(HaveOccurred())
+		return resp.StatusCode, body
+	}
+
+	BeforeEach(func() {
+		server = New("127.0.0.1:0", fakelogger.NewFakeLogger())
+		err := server.Start()
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Stop()
+	})
+
+	It("serves pprof", func() {
+		status, body := get("/debug/pprof/")
+		Ω(status).Should(Equal(http.StatusOK))
+		Ω(string(body)).Should(ContainSubstring("goroutine"))
+
+		status, body = get("/debug/pprof/goroutine?debug=1")
+		Ω(status).Should(Equal(http.StatusOK))
+		Ω(string(body)).Should(ContainSubstring("goroutine profile"))
+	})
+
+	It("serves expvar's variables, with the number of goroutines", func() {
+		status, body := get("/debug/vars")
+		Ω(status).Should(Equal(http.StatusOK))
+
+		vars := map[string]interface{}{}
+		Ω(json.Unmarshal(body, &vars)).Should(Succeed())
+		Ω(vars).Should(HaveKey("memstats"))
+		Ω(vars["goroutines"]).Should(BeNumerically(">", 0))
+	})
+
+	It("serves a summary of goroutines and queue depths", func() {
+		depth := 7
+		server.AddQueue("heartbeats", func() int { return depth })
+
+		status, body := get("/debug/summary")
+		Ω(status).Should(Equal(http.StatusOK))
+
+		summary := Summary{}
+		Ω(json.Unmarshal(body, &summary)).Should(Succeed())
+		Ω(summary.Goroutines).Should(BeNumerically(">", 0))
+		Ω(summary.GoroutinesByFunction).ShouldNot(BeEmpty())
+		Ω(summary.HeapAllocBytes).Should(BeNumerically(">", 0))
+		Ω(summary.QueueDepths).Should(Equal(map[string]int{"heartbeats": 7}))
+
+		depth = 3
+		Ω(server.Summary().QueueDepths["heartbeats"]).Should(Equal(3))
+	})
+
+	It("groups goroutines by the function they are in", func() {
+		total := 0
+		for _, count := range server.Summary().GoroutinesByFunction {
+			total += count
+		}
+		Ω(total).Should(BeNumerically(">", 0))
+	})
+
+	Describe("log levels", func() {
+		request := func(method string, query url.Values) (int, []byte) {
+			req, err := http.NewRequest(method, "http://"+server.Address()+"/log_level?"+query.Encode(), nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			resp, err := http.DefaultClient.Do(req)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			Ω(err).ShouldNot(HaveOccurred())
+			return resp.StatusCode, body
+		}
+
+		levels := func(body []byte) map[string]string {
+			decoded := map[string]string{}
+			Ω(json.Unmarshal(body, &decoded)).Should(Succeed())
+			return decoded
+		}
+
+		BeforeEach(func() {
+			logger.New("debugserver-test", gosteno.LOG_INFO, logger.FormatJSON)
+		})
+
+		AfterEach(func() {
+			logger.ResetLevels()
+		})
+
+		It("serves the level of each component", func() {
+			status, body := get("/log_level")
+			Ω(status).Should(Equal(http.StatusOK))
+			Ω(levels(body)).Should(HaveKeyWithValue("debugserver-test", "info"))
+		})
+
+		It("changes the level of a component on a PUT and resets it on a DELETE", func() {
+			status, body := request("PUT", url.Values{"component": {"debugserver-test"}, "level": {"DEBUG"}})
+			Ω(status).Should(Equal(http.StatusOK))
+			Ω(levels(body)).Should(HaveKeyWithValue("debugserver-test", "debug"))
+
+			status, body = request("DELETE", url.Values{})
+			Ω(status).Should(Equal(http.StatusOK))
+			Ω(levels(body)).Should(HaveKeyWithValue("debugserver-test", "info"))
+		})
+
+		It("rejects an unknown level or component", func() {
+			status, _ := request("PUT", url.Values{"level": {"LOUD"}})
+			Ω(status).Should(Equal(http.StatusBadRequest))
+
+			status, _ = request("PUT", url.Values{"component": {"nobody"}, "level": {"debug"}})
+			Ω(status).Should(Equal(http.StatusBadRequest))
+		})
+	})
+
+	It("ignores queues added to a nil server", func() {
+		var disabled *Server
+		Ω(func() { disabled.AddQueue("heartbeats", func() int { return 1 }) }).ShouldNot(Panic())
+	})
+
+	It("refuses to start on an address that is in use", func() {
+		other := New(server.Address(), fakelogger.NewFakeLogger())
+		Ω(other.Start()).ShouldNot(Succeed())
+	})
+})
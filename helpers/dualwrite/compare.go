@@ -0,0 +1,87 @@
+package dualwrite
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// Comparison is how far the target store is from the source, under one
+// root.  Missing keys are in the source alone, Extra keys in the target
+// alone, and Different keys hold different values in each.  TTLs are not
+// compared: the two stores count them down separately.
+type Comparison struct {
+	KeysCompared int      `json:"keys_compared"`
+	Missing      []string `json:"missing"`
+	Extra        []string `json:"extra"`
+	Different    []string `json:"different"`
+}
+
+func (comparison Comparison) IsConsistent() bool {
+	return len(comparison.Missing) == 0 && len(comparison.Extra) == 0 && len(comparison.Different) == 0
+}
+
+// Compare lists every key under root in both stores and compares them.  Keys
+// with a TTL, such as heartbeats, may well differ while hm9000 is writing
+// them; compare again and consider only the keys that stay inconsistent.
+func Compare(source storeadapter.StoreAdapter, target storeadapter.StoreAdapter, root string) (Comparison, error) {
+	sourceLeaves, err := leaves(source, root)
+	if err != nil {
+		return Comparison{}, err
+	}
+	targetLeaves, err := leaves(target, root)
+	if err != nil {
+		return Comparison{}, err
+	}
+
+	comparison := Comparison{
+		Missing:   []string{},
+		Extra:     []string{},
+		Different: []string{},
+	}
+	for key, value := range sourceLeaves {
+		comparison.KeysCompared++
+		targetValue, found := targetLeaves[key]
+		if !found {
+			comparison.Missing = append(comparison.Missing, key)
+		} else if !bytes.Equal(value, targetValue) {
+			comparison.Different = append(comparison.Different, key)
+		}
+	}
+	for key := range targetLeaves {
+		if _, found := sourceLeaves[key]; !found {
+			comparison.KeysCompared++
+			comparison.Extra = append(comparison.Extra, key)
+		}
+	}
+
+	sort.Strings(comparison.Missing)
+	sort.Strings(comparison.Extra)
+	sort.Strings(comparison.Different)
+	return comparison, nil
+}
+
+func leaves(adapter storeadapter.StoreAdapter, root string) (map[string][]byte, error) {
+	result := map[string][]byte{}
+
+	node, err := adapter.ListRecursively(root)
+	if err == storeadapter.ErrorKeyNotFound {
+		return result, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var collect func(node storeadapter.StoreNode)
+	collect = func(node storeadapter.StoreNode) {
+		if !node.Dir {
+			result[node.Key] = node.Value
+			return
+		}
+		for _, child := range node.ChildNodes {
+			collect(child)
+		}
+	}
+	collect(node)
+	return result, nil
+}
@@ -0,0 +1,183 @@
+package dualwrite
+
+import (
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// DualWriteStoreAdapter migrates hm9000 from one store to another while it
+// runs.  Every request is made to the source store, and every write that
+// succeeds there is then made to the target store too.  Reads, watches and
+// locks only ever go to the source, so the target can be empty, or behind,
+// without anything noticing.
+//
+// A write that fails on the target is logged and otherwise ignored, and the
+// source's result is returned: the target is not yet relied on, and Compare
+// finds what it is missing.
+//
+// The target's indices have nothing to do with the source's, so the
+// compare-and-* writes are made to the target as plain writes and deletes of
+// what the source ended up with.
+type DualWriteStoreAdapter struct {
+	source storeadapter.StoreAdapter
+	target storeadapter.StoreAdapter
+	logger logger.Logger
+}
+
+func New(source storeadapter.StoreAdapter, target storeadapter.StoreAdapter, logger logger.Logger) *DualWriteStoreAdapter {
+	return &DualWriteStoreAdapter{
+		source: source,
+		target: target,
+		logger: logger,
+	}
+}
+
+// Connect fails if either store cannot be reached: a migration that quietly
+// stopped writing to its target would have to start over.
+func (adapter *DualWriteStoreAdapter) Connect() error {
+	err := adapter.source.Connect()
+	if err != nil {
+		return err
+	}
+	return adapter.target.Connect()
+}
+
+func (adapter *DualWriteStoreAdapter) Disconnect() error {
+	adapter.target.Disconnect()
+	return adapter.source.Disconnect()
+}
+
+func (adapter *DualWriteStoreAdapter) Create(node storeadapter.StoreNode) error {
+	err := adapter.source.Create(node)
+	if err == nil {
+		adapter.mirror("Create", adapter.target.SetMulti([]storeadapter.StoreNode{node}))
+	}
+	return err
+}
+
+func (adapter *DualWriteStoreAdapter) Update(node storeadapter.StoreNode) error {
+	err := adapter.source.Update(node)
+	if err == nil {
+		adapter.mirror("Update", adapter.target.SetMulti([]storeadapter.StoreNode{node}))
+	}
+	return err
+}
+
+func (adapter *DualWriteStoreAdapter) CompareAndSwap(oldNode storeadapter.StoreNode, newNode storeadapter.StoreNode) error {
+	err := adapter.source.CompareAndSwap(oldNode, newNode)
+	if err == nil {
+		adapter.mirror("CompareAndSwap", adapter.target.SetMulti([]storeadapter.StoreNode{newNode}))
+	}
+	return err
+}
+
+func (adapter *DualWriteStoreAdapter) CompareAndSwapByIndex(prevIndex uint64, newNode storeadapter.StoreNode) error {
+	err := adapter.source.CompareAndSwapByIndex(prevIndex, newNode)
+	if err == nil {
+		adapter.mirror("CompareAndSwapByIndex", adapter.target.SetMulti([]storeadapter.StoreNode{newNode}))
+	}
+	return err
+}
+
+func (adapter *DualWriteStoreAdapter) SetMulti(nodes []storeadapter.StoreNode) error {
+	err := adapter.source.SetMulti(nodes)
+	if err == nil {
+		adapter.mirror("SetMulti", adapter.target.SetMulti(nodes))
+	}
+	return err
+}
+
+func (adapter *DualWriteStoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	return adapter.source.Get(key)
+}
+
+func (adapter *DualWriteStoreAdapter) ListRecursively(key string) (storeadapter.StoreNode, error) {
+	return adapter.source.ListRecursively(key)
+}
+
+func (adapter *DualWriteStoreAdapter) Delete(keys ...string) error {
+	err := adapter.source.Delete(keys...)
+	if err == nil {
+		adapter.mirror("Delete", adapter.deleteFromTarget(keys))
+	}
+	return err
+}
+
+func (adapter *DualWriteStoreAdapter) DeleteLeaves(keys ...string) error {
+	err := adapter.source.DeleteLeaves(keys...)
+	if err == nil {
+		adapter.mirror("DeleteLeaves", adapter.target.DeleteLeaves(keys...))
+	}
+	return err
+}
+
+func (adapter *DualWriteStoreAdapter) CompareAndDelete(nodes ...storeadapter.StoreNode) error {
+	err := adapter.source.CompareAndDelete(nodes...)
+	if err == nil {
+		adapter.mirror("CompareAndDelete", adapter.deleteFromTarget(keysOf(nodes)))
+	}
+	return err
+}
+
+func (adapter *DualWriteStoreAdapter) CompareAndDeleteByIndex(nodes ...storeadapter.StoreNode) error {
+	err := adapter.source.CompareAndDeleteByIndex(nodes...)
+	if err == nil {
+		adapter.mirror("CompareAndDeleteByIndex", adapter.deleteFromTarget(keysOf(nodes)))
+	}
+	return err
+}
+
+func (adapter *DualWriteStoreAdapter) UpdateDirTTL(key string, ttl uint64) error {
+	err := adapter.source.UpdateDirTTL(key, ttl)
+	if err == nil {
+		adapter.mirror("UpdateDirTTL", adapter.target.UpdateDirTTL(key, ttl))
+	}
+	return err
+}
+
+func (adapter *DualWriteStoreAdapter) Watch(key string) (<-chan storeadapter.WatchEvent, chan<- bool, <-chan error) {
+	return adapter.source.Watch(key)
+}
+
+// MaintainNode is not mirrored: locks are only ever held in the source, until
+// the components are pointed at the target.
+func (adapter *DualWriteStoreAdapter) MaintainNode(storeNode storeadapter.StoreNode) (<-chan bool, chan chan bool, error) {
+	return adapter.source.MaintainNode(storeNode)
+}
+
+// mirror logs a failed write to the target.  Deleting a key the target never
+// had is not a failure: it leaves the target as the source.
+func (adapter *DualWriteStoreAdapter) mirror(request string, err error) {
+	if err == nil || err == storeadapter.ErrorKeyNotFound {
+		return
+	}
+	adapter.logger.Error("Failed to write to the migration target store", err, map[string]string{
+		"Request": request,
+	})
+}
+
+// deleteFromTarget deletes keys from the target, one at a time if it is
+// missing some of them, so that one key it never had does not keep it from
+// deleting the rest.
+func (adapter *DualWriteStoreAdapter) deleteFromTarget(keys []string) error {
+	err := adapter.target.Delete(keys...)
+	if err != storeadapter.ErrorKeyNotFound || len(keys) < 2 {
+		return err
+	}
+
+	for _, key := range keys {
+		err = adapter.target.Delete(key)
+		if err != nil && err != storeadapter.ErrorKeyNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func keysOf(nodes []storeadapter.StoreNode) []string {
+	keys := make([]string, len(nodes))
+	for i, node := range nodes {
+		keys[i] = node.Key
+	}
+	return keys
+}
@@ -0,0 +1,162 @@
+package dualwrite_test
+
+import (
+	"errors"
+
+	. "github.com/cloudfoundry/hm9000/helpers/dualwrite"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DualWriteStoreAdapter", func() {
+	var (
+		source  *fakestoreadapter.FakeStoreAdapter
+		target  *fakestoreadapter.FakeStoreAdapter
+		logger  *fakelogger.FakeLogger
+		adapter *DualWriteStoreAdapter
+	)
+
+	BeforeEach(func() {
+		source = fakestoreadapter.New()
+		target = fakestoreadapter.New()
+		logger = fakelogger.NewFakeLogger()
+		adapter = New(source, target, logger)
+	})
+
+	value := func(store storeadapter.StoreAdapter, key string) string {
+		node, err := store.Get(key)
+		if err != nil {
+			return err.Error()
+		}
+		return string(node.Value)
+	}
+
+	It("connects to both stores", func() {
+		Ω(adapter.Connect()).Should(Succeed())
+		Ω(source.DidConnect).Should(BeTrue())
+		Ω(target.DidConnect).Should(BeTrue())
+	})
+
+	It("fails to connect if the target cannot be reached", func() {
+		target.ConnectErr = errors.New("connection refused")
+		Ω(adapter.Connect()).Should(Equal(target.ConnectErr))
+	})
+
+	It("writes to both stores", func() {
+		Ω(adapter.SetMulti([]storeadapter.StoreNode{{Key: "/a", Value: []byte("1")}})).Should(Succeed())
+		Ω(adapter.Create(storeadapter.StoreNode{Key: "/b", Value: []byte("2")})).Should(Succeed())
+		Ω(adapter.Update(storeadapter.StoreNode{Key: "/b", Value: []byte("3")})).Should(Succeed())
+
+		Ω(value(source, "/a")).Should(Equal("1"))
+		Ω(value(target, "/a")).Should(Equal("1"))
+		Ω(value(source, "/b")).Should(Equal("3"))
+		Ω(value(target, "/b")).Should(Equal("3"))
+	})
+
+	It("reads from the source alone", func() {
+		source.SetMulti([]storeadapter.StoreNode{{Key: "/where", Value: []byte("source")}})
+		target.SetMulti([]storeadapter.StoreNode{{Key: "/where", Value: []byte("target")}})
+
+		Ω(value(adapter, "/where")).Should(Equal("source"))
+		node, err := adapter.ListRecursively("/")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.ChildNodes[0].Value).Should(Equal([]byte("source")))
+	})
+
+	It("makes compare and swaps plain writes on the target, whatever its index", func() {
+		source.SetMulti([]storeadapter.StoreNode{{Key: "/a", Value: []byte("1")}})
+		node, _ := source.Get("/a")
+
+		Ω(adapter.CompareAndSwapByIndex(node.Index, storeadapter.StoreNode{Key: "/a", Value: []byte("2")})).Should(Succeed())
+		Ω(value(target, "/a")).Should(Equal("2"))
+	})
+
+	It("deletes from both stores, even keys the target is missing", func() {
+		adapter.SetMulti([]storeadapter.StoreNode{{Key: "/a", Value: []byte("1")}, {Key: "/c", Value: []byte("3")}})
+		source.SetMulti([]storeadapter.StoreNode{{Key: "/b", Value: []byte("2")}})
+
+		Ω(adapter.Delete("/a", "/b", "/c")).Should(Succeed())
+		Ω(value(target, "/a")).Should(Equal(storeadapter.ErrorKeyNotFound.Error()))
+		Ω(value(target, "/c")).Should(Equal(storeadapter.ErrorKeyNotFound.Error()))
+		Ω(logger.LoggedErrors).Should(BeEmpty())
+	})
+
+	It("does not write to the target what failed on the source", func() {
+		source.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("a", errors.New("boom"))
+		Ω(adapter.SetMulti([]storeadapter.StoreNode{{Key: "/a", Value: []byte("1")}})).ShouldNot(Succeed())
+		Ω(value(target, "/a")).Should(Equal(storeadapter.ErrorKeyNotFound.Error()))
+	})
+
+	It("logs, and otherwise ignores, writes that fail on the target", func() {
+		failure := errors.New("boom")
+		target.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("a", failure)
+
+		Ω(adapter.SetMulti([]storeadapter.StoreNode{{Key: "/a", Value: []byte("1")}})).Should(Succeed())
+		Ω(value(source, "/a")).Should(Equal("1"))
+		Ω(logger.LoggedErrors).Should(Equal([]error{failure}))
+		Ω(logger.LoggedSubjects).Should(ContainElement("Failed to write to the migration target store"))
+	})
+
+	It("holds locks in the source alone", func() {
+		_, _, err := adapter.MaintainNode(storeadapter.StoreNode{Key: "/hm/locks/analyzer"})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(source.GetMaintainedNodeName()).Should(Equal("/hm/locks/analyzer"))
+		Ω(target.GetMaintainedNodeName()).Should(BeEmpty())
+	})
+})
+
+var _ = Describe("Compare", func() {
+	var source, target *fakestoreadapter.FakeStoreAdapter
+
+	BeforeEach(func() {
+		source = fakestoreadapter.New()
+		target = fakestoreadapter.New()
+	})
+
+	It("reports the keys missing from, extra in, and different in the target", func() {
+		source.SetMulti([]storeadapter.StoreNode{
+			{Key: "/hm/v1/same", Value: []byte("1")},
+			{Key: "/hm/v1/dir/missing", Value: []byte("2")},
+			{Key: "/hm/v1/different", Value: []byte("3")},
+			{Key: "/hm/locks/analyzer", Value: []byte("ignored")},
+		})
+		target.SetMulti([]storeadapter.StoreNode{
+			{Key: "/hm/v1/same", Value: []byte("1"), TTL: 10},
+			{Key: "/hm/v1/different", Value: []byte("4")},
+			{Key: "/hm/v1/extra", Value: []byte("5")},
+		})
+
+		comparison, err := Compare(source, target, "/hm/v1")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(comparison).Should(Equal(Comparison{
+			KeysCompared: 4,
+			Missing:      []string{"/hm/v1/dir/missing"},
+			Extra:        []string{"/hm/v1/extra"},
+			Different:    []string{"/hm/v1/different"},
+		}))
+		Ω(comparison.IsConsistent()).Should(BeFalse())
+	})
+
+	It("takes an empty target to be missing everything", func() {
+		source.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/a", Value: []byte("1")}})
+
+		comparison, err := Compare(source, target, "/hm/v1")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(comparison.Missing).Should(Equal([]string{"/hm/v1/a"}))
+	})
+
+	It("is consistent when both stores agree", func() {
+		comparison, err := Compare(source, target, "/hm/v1")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(comparison.IsConsistent()).Should(BeTrue())
+	})
+
+	It("fails when a store cannot be listed", func() {
+		target.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector(".*", errors.New("boom"))
+		_, err := Compare(source, target, "/hm/v1")
+		Ω(err).Should(HaveOccurred())
+	})
+})
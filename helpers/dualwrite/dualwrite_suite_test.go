@@ -0,0 +1,13 @@
+package dualwrite_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDualWrite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Dual Write Suite")
+}
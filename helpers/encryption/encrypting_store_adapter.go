@@ -0,0 +1,243 @@
+package encryption
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// EncryptingStoreAdapter transparently encrypts values written under the
+// sensitive prefixes and decrypts them again on read.  All other keys are
+// passed through untouched.
+type EncryptingStoreAdapter struct {
+	storeadapter.StoreAdapter
+
+	encryptor         *Encryptor
+	sensitivePrefixes []string
+}
+
+func NewEncryptingStoreAdapter(adapter storeadapter.StoreAdapter, encryptor *Encryptor, sensitivePrefixes []string) *EncryptingStoreAdapter {
+	return &EncryptingStoreAdapter{
+		StoreAdapter:      adapter,
+		encryptor:         encryptor,
+		sensitivePrefixes: sensitivePrefixes,
+	}
+}
+
+func (adapter *EncryptingStoreAdapter) Create(node storeadapter.StoreNode) error {
+	node, err := adapter.encrypt(node)
+	if err != nil {
+		return err
+	}
+	return adapter.StoreAdapter.Create(node)
+}
+
+func (adapter *EncryptingStoreAdapter) Update(node storeadapter.StoreNode) error {
+	node, err := adapter.encrypt(node)
+	if err != nil {
+		return err
+	}
+	return adapter.StoreAdapter.Update(node)
+}
+
+func (adapter *EncryptingStoreAdapter) CompareAndSwapByIndex(prevIndex uint64, node storeadapter.StoreNode) error {
+	node, err := adapter.encrypt(node)
+	if err != nil {
+		return err
+	}
+	return adapter.StoreAdapter.CompareAndSwapByIndex(prevIndex, node)
+}
+
+func (adapter *EncryptingStoreAdapter) SetMulti(nodes []storeadapter.StoreNode) error {
+	encryptedNodes := make([]storeadapter.StoreNode, len(nodes))
+	for i, node := range nodes {
+		encryptedNode, err := adapter.encrypt(node)
+		if err != nil {
+			return err
+		}
+		encryptedNodes[i] = encryptedNode
+	}
+	return adapter.StoreAdapter.SetMulti(encryptedNodes)
+}
+
+// CompareAndSwap compares oldNode's plaintext against the stored value,
+// decrypted, and swaps in newNode encrypted.
+func (adapter *EncryptingStoreAdapter) CompareAndSwap(oldNode storeadapter.StoreNode, newNode storeadapter.StoreNode) error {
+	oldNode, err := adapter.storedNodeMatching(oldNode)
+	if err != nil {
+		return err
+	}
+	newNode, err = adapter.encrypt(newNode)
+	if err != nil {
+		return err
+	}
+	return adapter.StoreAdapter.CompareAndSwap(oldNode, newNode)
+}
+
+// CompareAndDelete compares each node's plaintext against the stored value,
+// decrypted, and deletes them all only if every one matches.
+func (adapter *EncryptingStoreAdapter) CompareAndDelete(nodes ...storeadapter.StoreNode) error {
+	storedNodes := make([]storeadapter.StoreNode, len(nodes))
+	for i, node := range nodes {
+		storedNode, err := adapter.storedNodeMatching(node)
+		if err != nil {
+			return err
+		}
+		storedNodes[i] = storedNode
+	}
+	return adapter.StoreAdapter.CompareAndDelete(storedNodes...)
+}
+
+// storedNodeMatching returns the node to compare against the store with:
+// for a sensitive key, the stored ciphertext, if it decrypts to node's value.
+// Encryption is not deterministic, so node cannot simply be encrypted again.
+func (adapter *EncryptingStoreAdapter) storedNodeMatching(node storeadapter.StoreNode) (storeadapter.StoreNode, error) {
+	if node.Dir || !adapter.isSensitive(node.Key) {
+		return node, nil
+	}
+
+	stored, err := adapter.StoreAdapter.Get(node.Key)
+	if err != nil {
+		return storeadapter.StoreNode{}, err
+	}
+	value, err := adapter.encryptor.Decrypt(stored.Value)
+	if err != nil {
+		return storeadapter.StoreNode{}, err
+	}
+	if !bytes.Equal(value, node.Value) {
+		return storeadapter.StoreNode{}, storeadapter.ErrorKeyComparisonFailed
+	}
+
+	node.Value = stored.Value
+	return node, nil
+}
+
+func (adapter *EncryptingStoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	node, err := adapter.StoreAdapter.Get(key)
+	if err != nil {
+		return node, err
+	}
+	return adapter.decrypt(node)
+}
+
+func (adapter *EncryptingStoreAdapter) ListRecursively(key string) (storeadapter.StoreNode, error) {
+	node, err := adapter.StoreAdapter.ListRecursively(key)
+	if err != nil {
+		return node, err
+	}
+	return adapter.decrypt(node)
+}
+
+// Rotate re-encrypts every plaintext value, and every value sealed with a
+// retired key, under the active key.  It returns the number of values that
+// were rewritten.
+func (adapter *EncryptingStoreAdapter) Rotate() (int, error) {
+	rotated := 0
+	for _, prefix := range adapter.sensitivePrefixes {
+		node, err := adapter.StoreAdapter.ListRecursively(prefix)
+		if err == storeadapter.ErrorKeyNotFound {
+			continue
+		}
+		if err == storeadapter.ErrorNodeIsNotDirectory {
+			node, err = adapter.StoreAdapter.Get(prefix)
+		}
+		if err != nil {
+			return rotated, err
+		}
+
+		nodesToRotate := []storeadapter.StoreNode{}
+		err = adapter.collectNodesToRotate(node, &nodesToRotate)
+		if err != nil {
+			return rotated, err
+		}
+
+		if len(nodesToRotate) == 0 {
+			continue
+		}
+
+		err = adapter.SetMulti(nodesToRotate)
+		if err != nil {
+			return rotated, err
+		}
+		rotated += len(nodesToRotate)
+	}
+
+	return rotated, nil
+}
+
+func (adapter *EncryptingStoreAdapter) collectNodesToRotate(node storeadapter.StoreNode, nodesToRotate *[]storeadapter.StoreNode) error {
+	if node.Dir {
+		for _, childNode := range node.ChildNodes {
+			err := adapter.collectNodesToRotate(childNode, nodesToRotate)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !adapter.encryptor.NeedsRotation(node.Value) {
+		return nil
+	}
+
+	value, err := adapter.encryptor.Decrypt(node.Value)
+	if err != nil {
+		return err
+	}
+
+	*nodesToRotate = append(*nodesToRotate, storeadapter.StoreNode{
+		Key:   node.Key,
+		Value: value,
+		TTL:   node.TTL,
+	})
+	return nil
+}
+
+func (adapter *EncryptingStoreAdapter) encrypt(node storeadapter.StoreNode) (storeadapter.StoreNode, error) {
+	if node.Dir || !adapter.isSensitive(node.Key) {
+		return node, nil
+	}
+
+	value, err := adapter.encryptor.Encrypt(node.Value)
+	if err != nil {
+		return node, err
+	}
+	node.Value = value
+	return node, nil
+}
+
+func (adapter *EncryptingStoreAdapter) decrypt(node storeadapter.StoreNode) (storeadapter.StoreNode, error) {
+	if node.Dir {
+		childNodes := make([]storeadapter.StoreNode, len(node.ChildNodes))
+		for i, childNode := range node.ChildNodes {
+			decryptedNode, err := adapter.decrypt(childNode)
+			if err != nil {
+				return storeadapter.StoreNode{}, err
+			}
+			childNodes[i] = decryptedNode
+		}
+		node.ChildNodes = childNodes
+		return node, nil
+	}
+
+	if !adapter.isSensitive(node.Key) {
+		return node, nil
+	}
+
+	value, err := adapter.encryptor.Decrypt(node.Value)
+	if err != nil {
+		return storeadapter.StoreNode{}, err
+	}
+	node.Value = value
+	return node, nil
+}
+
+func (adapter *EncryptingStoreAdapter) isSensitive(key string) bool {
+	for _, prefix := range adapter.sensitivePrefixes {
+		if key == prefix || strings.HasPrefix(key, strings.TrimRight(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
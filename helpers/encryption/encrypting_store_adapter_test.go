@@ -0,0 +1,230 @@
+package encryption_test
+
+import (
+	"bytes"
+
+	. "github.com/cloudfoundry/hm9000/helpers/encryption"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EncryptingStoreAdapter", func() {
+	var (
+		fakeAdapter *fakestoreadapter.FakeStoreAdapter
+		oldKey      Key
+		newKey      Key
+		encryptor   *Encryptor
+		adapter     *EncryptingStoreAdapter
+	)
+
+	BeforeEach(func() {
+		fakeAdapter = fakestoreadapter.New()
+		oldKey = Key{Label: "old", Secret: bytes.Repeat([]byte("a"), 32)}
+		newKey = Key{Label: "new", Secret: bytes.Repeat([]byte("b"), 32)}
+		encryptor, _ = NewEncryptor([]Key{oldKey, newKey}, "new")
+		adapter = NewEncryptingStoreAdapter(fakeAdapter, encryptor, []string{"/hm/v1/apps/desired"})
+	})
+
+	Describe("writing", func() {
+		It("encrypts values under the sensitive prefixes", func() {
+			err := adapter.SetMulti([]storeadapter.StoreNode{
+				{Key: "/hm/v1/apps/desired/abc,123", Value: []byte("1,STARTED,STAGED"), TTL: 10},
+				{Key: "/hm/v1/apps/actual/abc,123/xyz", Value: []byte("0,RUNNING,1,dea")},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			raw, _ := fakeAdapter.Get("/hm/v1/apps/desired/abc,123")
+			Ω(string(raw.Value)).Should(HavePrefix("enc:new:"))
+			Ω(raw.TTL).Should(BeNumerically("==", 10))
+
+			raw, _ = fakeAdapter.Get("/hm/v1/apps/actual/abc,123/xyz")
+			Ω(raw.Value).Should(Equal([]byte("0,RUNNING,1,dea")))
+		})
+
+		It("does not treat siblings that share a prefix as sensitive", func() {
+			adapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/apps/desired-archive/abc", Value: []byte("plain")}})
+
+			raw, _ := fakeAdapter.Get("/hm/v1/apps/desired-archive/abc")
+			Ω(raw.Value).Should(Equal([]byte("plain")))
+		})
+	})
+
+	Describe("reading", func() {
+		BeforeEach(func() {
+			adapter.SetMulti([]storeadapter.StoreNode{
+				{Key: "/hm/v1/apps/desired/abc,123", Value: []byte("1,STARTED,STAGED")},
+				{Key: "/hm/v1/apps/actual/abc,123/xyz", Value: []byte("0,RUNNING,1,dea")},
+			})
+		})
+
+		It("decrypts gets", func() {
+			node, err := adapter.Get("/hm/v1/apps/desired/abc,123")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.Value).Should(Equal([]byte("1,STARTED,STAGED")))
+		})
+
+		It("decrypts recursive listings", func() {
+			node, err := adapter.ListRecursively("/hm/v1/apps")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			values := map[string]string{}
+			var collect func(storeadapter.StoreNode)
+			collect = func(node storeadapter.StoreNode) {
+				for _, child := range node.ChildNodes {
+					if child.Dir {
+						collect(child)
+					} else {
+						values[child.Key] = string(child.Value)
+					}
+				}
+			}
+			collect(node)
+
+			Ω(values).Should(Equal(map[string]string{
+				"/hm/v1/apps/desired/abc,123":    "1,STARTED,STAGED",
+				"/hm/v1/apps/actual/abc,123/xyz": "0,RUNNING,1,dea",
+			}))
+		})
+
+		It("reads plaintext values written before encryption was enabled", func() {
+			fakeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/apps/desired/def,456", Value: []byte("2,STARTED,STAGED")}})
+
+			node, err := adapter.Get("/hm/v1/apps/desired/def,456")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.Value).Should(Equal([]byte("2,STARTED,STAGED")))
+		})
+
+		It("errors when a value cannot be decrypted", func() {
+			strangerEncryptor, _ := NewEncryptor([]Key{{Label: "stranger", Secret: bytes.Repeat([]byte("c"), 32)}}, "stranger")
+			sealed, _ := strangerEncryptor.Encrypt([]byte("1,STARTED,STAGED"))
+			fakeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/apps/desired/abc,123", Value: sealed}})
+
+			_, err := adapter.ListRecursively("/hm/v1/apps/desired")
+			Ω(err).Should(Equal(UnknownKeyError))
+		})
+	})
+
+	Describe("comparing", func() {
+		BeforeEach(func() {
+			adapter.SetMulti([]storeadapter.StoreNode{
+				{Key: "/hm/v1/apps/desired/abc,123", Value: []byte("1,STARTED,STAGED")},
+				{Key: "/hm/v1/apps/actual/abc,123/xyz", Value: []byte("0,RUNNING,1,dea")},
+			})
+		})
+
+		Describe("CompareAndSwap", func() {
+			It("compares against the decrypted value and writes the new one encrypted", func() {
+				err := adapter.CompareAndSwap(
+					storeadapter.StoreNode{Key: "/hm/v1/apps/desired/abc,123", Value: []byte("1,STARTED,STAGED")},
+					storeadapter.StoreNode{Key: "/hm/v1/apps/desired/abc,123", Value: []byte("2,STARTED,STAGED")},
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				raw, _ := fakeAdapter.Get("/hm/v1/apps/desired/abc,123")
+				Ω(string(raw.Value)).Should(HavePrefix("enc:new:"))
+
+				node, _ := adapter.Get("/hm/v1/apps/desired/abc,123")
+				Ω(node.Value).Should(Equal([]byte("2,STARTED,STAGED")))
+			})
+
+			It("fails, leaving the value alone, when the value has changed", func() {
+				err := adapter.CompareAndSwap(
+					storeadapter.StoreNode{Key: "/hm/v1/apps/desired/abc,123", Value: []byte("3,STARTED,STAGED")},
+					storeadapter.StoreNode{Key: "/hm/v1/apps/desired/abc,123", Value: []byte("2,STARTED,STAGED")},
+				)
+				Ω(err).Should(Equal(storeadapter.ErrorKeyComparisonFailed))
+
+				node, _ := adapter.Get("/hm/v1/apps/desired/abc,123")
+				Ω(node.Value).Should(Equal([]byte("1,STARTED,STAGED")))
+			})
+
+			It("passes other keys through", func() {
+				err := adapter.CompareAndSwap(
+					storeadapter.StoreNode{Key: "/hm/v1/apps/actual/abc,123/xyz", Value: []byte("0,RUNNING,1,dea")},
+					storeadapter.StoreNode{Key: "/hm/v1/apps/actual/abc,123/xyz", Value: []byte("0,CRASHED,1,dea")},
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				raw, _ := fakeAdapter.Get("/hm/v1/apps/actual/abc,123/xyz")
+				Ω(raw.Value).Should(Equal([]byte("0,CRASHED,1,dea")))
+			})
+		})
+
+		Describe("CompareAndDelete", func() {
+			It("compares against the decrypted values and deletes them", func() {
+				err := adapter.CompareAndDelete(
+					storeadapter.StoreNode{Key: "/hm/v1/apps/desired/abc,123", Value: []byte("1,STARTED,STAGED")},
+					storeadapter.StoreNode{Key: "/hm/v1/apps/actual/abc,123/xyz", Value: []byte("0,RUNNING,1,dea")},
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = fakeAdapter.Get("/hm/v1/apps/desired/abc,123")
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+				_, err = fakeAdapter.Get("/hm/v1/apps/actual/abc,123/xyz")
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			})
+
+			It("fails, deleting nothing, when a value has changed", func() {
+				err := adapter.CompareAndDelete(
+					storeadapter.StoreNode{Key: "/hm/v1/apps/actual/abc,123/xyz", Value: []byte("0,RUNNING,1,dea")},
+					storeadapter.StoreNode{Key: "/hm/v1/apps/desired/abc,123", Value: []byte("3,STARTED,STAGED")},
+				)
+				Ω(err).Should(Equal(storeadapter.ErrorKeyComparisonFailed))
+
+				_, err = fakeAdapter.Get("/hm/v1/apps/desired/abc,123")
+				Ω(err).ShouldNot(HaveOccurred())
+				_, err = fakeAdapter.Get("/hm/v1/apps/actual/abc,123/xyz")
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Rotate", func() {
+		BeforeEach(func() {
+			oldEncryptor, _ := NewEncryptor([]Key{oldKey}, "old")
+			NewEncryptingStoreAdapter(fakeAdapter, oldEncryptor, []string{"/hm/v1/apps/desired"}).SetMulti([]storeadapter.StoreNode{
+				{Key: "/hm/v1/apps/desired/abc,123", Value: []byte("1,STARTED,STAGED"), TTL: 20},
+			})
+			fakeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/apps/desired/def,456", Value: []byte("2,STARTED,STAGED")}})
+			adapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/apps/desired/ghi,789", Value: []byte("3,STARTED,STAGED")}})
+		})
+
+		It("re-encrypts plaintext and retired values with the active key", func() {
+			untouched, _ := fakeAdapter.Get("/hm/v1/apps/desired/ghi,789")
+
+			rotated, err := adapter.Rotate()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rotated).Should(Equal(2))
+
+			for _, key := range []string{"/hm/v1/apps/desired/abc,123", "/hm/v1/apps/desired/def,456", "/hm/v1/apps/desired/ghi,789"} {
+				raw, _ := fakeAdapter.Get(key)
+				Ω(string(raw.Value)).Should(HavePrefix("enc:new:"))
+			}
+
+			raw, _ := fakeAdapter.Get("/hm/v1/apps/desired/abc,123")
+			Ω(raw.TTL).Should(BeNumerically("==", 20))
+
+			raw, _ = fakeAdapter.Get("/hm/v1/apps/desired/ghi,789")
+			Ω(raw.Value).Should(Equal(untouched.Value))
+
+			node, _ := adapter.Get("/hm/v1/apps/desired/abc,123")
+			Ω(node.Value).Should(Equal([]byte("1,STARTED,STAGED")))
+		})
+
+		It("is a no-op once everything has been rotated", func() {
+			adapter.Rotate()
+			rotated, err := adapter.Rotate()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rotated).Should(BeZero())
+		})
+
+		It("succeeds when there is nothing to rotate", func() {
+			fakeAdapter.Reset()
+			rotated, err := adapter.Rotate()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rotated).Should(BeZero())
+		})
+	})
+})
@@ -0,0 +1,128 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var UnknownKeyError = errors.New("Value was encrypted with an unknown key")
+var MalformedValueError = errors.New("Encrypted value is malformed")
+
+var encryptedPrefix = []byte("enc:")
+
+type Key struct {
+	Label  string
+	Secret []byte
+}
+
+// Encryptor seals values with AES-GCM using the active key and opens values
+// sealed with any of the keys it knows about.  Sealed values carry the label
+// of the key that produced them:
+//
+//	enc:<label>:<base64(nonce + ciphertext)>
+type Encryptor struct {
+	activeLabel string
+	ciphers     map[string]cipher.AEAD
+}
+
+func NewEncryptor(keys []Key, activeLabel string) (*Encryptor, error) {
+	encryptor := &Encryptor{
+		activeLabel: activeLabel,
+		ciphers:     map[string]cipher.AEAD{},
+	}
+
+	for _, key := range keys {
+		if key.Label == "" || bytes.IndexByte([]byte(key.Label), ':') != -1 {
+			return nil, fmt.Errorf("Invalid encryption key label %q", key.Label)
+		}
+
+		block, err := aes.NewCipher(key.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid encryption key %s: %s", key.Label, err.Error())
+		}
+
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		encryptor.ciphers[key.Label] = gcm
+	}
+
+	if _, ok := encryptor.ciphers[activeLabel]; !ok {
+		return nil, fmt.Errorf("Active encryption key %q is not configured", activeLabel)
+	}
+
+	return encryptor, nil
+}
+
+func (encryptor *Encryptor) ActiveLabel() string {
+	return encryptor.activeLabel
+}
+
+func (encryptor *Encryptor) Encrypt(plaintext []byte) ([]byte, error) {
+	gcm := encryptor.ciphers[encryptor.activeLabel]
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(encryptor.activeLabel))
+
+	value := append([]byte{}, encryptedPrefix...)
+	value = append(value, []byte(encryptor.activeLabel+":")...)
+	value = append(value, []byte(base64.StdEncoding.EncodeToString(sealed))...)
+
+	return value, nil
+}
+
+// Decrypt returns values that were not sealed by an Encryptor unchanged so
+// that data written before encryption was enabled remains readable.
+func (encryptor *Encryptor) Decrypt(value []byte) ([]byte, error) {
+	label, encoded, encrypted := encryptor.parse(value)
+	if !encrypted {
+		return value, nil
+	}
+
+	gcm, ok := encryptor.ciphers[label]
+	if !ok {
+		return nil, UnknownKeyError
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return nil, MalformedValueError
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, []byte(label))
+}
+
+// NeedsRotation reports whether value is plaintext or was sealed with a key
+// other than the active key.
+func (encryptor *Encryptor) NeedsRotation(value []byte) bool {
+	label, _, encrypted := encryptor.parse(value)
+	return !encrypted || label != encryptor.activeLabel
+}
+
+func (encryptor *Encryptor) parse(value []byte) (label string, encoded string, encrypted bool) {
+	if !bytes.HasPrefix(value, encryptedPrefix) {
+		return "", "", false
+	}
+
+	rest := value[len(encryptedPrefix):]
+	separator := bytes.IndexByte(rest, ':')
+	if separator == -1 {
+		return "", "", false
+	}
+
+	return string(rest[:separator]), string(rest[separator+1:]), true
+}
@@ -0,0 +1,118 @@
+package encryption_test
+
+import (
+	"bytes"
+
+	. "github.com/cloudfoundry/hm9000/helpers/encryption"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encryptor", func() {
+	var (
+		oldKey Key
+		newKey Key
+	)
+
+	BeforeEach(func() {
+		oldKey = Key{Label: "old", Secret: bytes.Repeat([]byte("a"), 32)}
+		newKey = Key{Label: "new", Secret: bytes.Repeat([]byte("b"), 32)}
+	})
+
+	Describe("building an encryptor", func() {
+		It("requires the active key to be configured", func() {
+			_, err := NewEncryptor([]Key{oldKey}, "new")
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects keys of the wrong length", func() {
+			_, err := NewEncryptor([]Key{{Label: "short", Secret: []byte("abc")}}, "short")
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects labels containing a colon", func() {
+			_, err := NewEncryptor([]Key{{Label: "a:b", Secret: oldKey.Secret}}, "a:b")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("round tripping a value", func() {
+		It("encrypts with the active key and decrypts back to the plaintext", func() {
+			encryptor, err := NewEncryptor([]Key{oldKey, newKey}, "new")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			encrypted, err := encryptor.Encrypt([]byte("secret"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(encrypted)).Should(HavePrefix("enc:new:"))
+			Ω(string(encrypted)).ShouldNot(ContainSubstring("secret"))
+
+			decrypted, err := encryptor.Decrypt(encrypted)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decrypted).Should(Equal([]byte("secret")))
+		})
+
+		It("uses a fresh nonce for every value", func() {
+			encryptor, _ := NewEncryptor([]Key{newKey}, "new")
+			first, _ := encryptor.Encrypt([]byte("secret"))
+			second, _ := encryptor.Encrypt([]byte("secret"))
+			Ω(first).ShouldNot(Equal(second))
+		})
+	})
+
+	Describe("decrypting", func() {
+		It("passes plaintext values through", func() {
+			encryptor, _ := NewEncryptor([]Key{newKey}, "new")
+			decrypted, err := encryptor.Decrypt([]byte("1,STARTED,STAGED"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decrypted).Should(Equal([]byte("1,STARTED,STAGED")))
+		})
+
+		It("decrypts values sealed with a retired key", func() {
+			oldEncryptor, _ := NewEncryptor([]Key{oldKey}, "old")
+			encrypted, _ := oldEncryptor.Encrypt([]byte("secret"))
+
+			encryptor, _ := NewEncryptor([]Key{oldKey, newKey}, "new")
+			decrypted, err := encryptor.Decrypt(encrypted)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decrypted).Should(Equal([]byte("secret")))
+		})
+
+		It("errors when the key is unknown", func() {
+			oldEncryptor, _ := NewEncryptor([]Key{oldKey}, "old")
+			encrypted, _ := oldEncryptor.Encrypt([]byte("secret"))
+
+			encryptor, _ := NewEncryptor([]Key{newKey}, "new")
+			_, err := encryptor.Decrypt(encrypted)
+			Ω(err).Should(Equal(UnknownKeyError))
+		})
+
+		It("errors when the value has been tampered with", func() {
+			encryptor, _ := NewEncryptor([]Key{newKey}, "new")
+			encrypted, _ := encryptor.Encrypt([]byte("secret"))
+			encrypted[len(encrypted)-2] ^= 1
+
+			_, err := encryptor.Decrypt(encrypted)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("errors when the value is not valid base64", func() {
+			encryptor, _ := NewEncryptor([]Key{newKey}, "new")
+			_, err := encryptor.Decrypt([]byte("enc:new:!!!"))
+			Ω(err).Should(Equal(MalformedValueError))
+		})
+	})
+
+	Describe("NeedsRotation", func() {
+		It("is true for plaintext and values sealed with a retired key", func() {
+			oldEncryptor, _ := NewEncryptor([]Key{oldKey}, "old")
+			sealedWithOld, _ := oldEncryptor.Encrypt([]byte("secret"))
+
+			encryptor, _ := NewEncryptor([]Key{oldKey, newKey}, "new")
+			sealedWithNew, _ := encryptor.Encrypt([]byte("secret"))
+
+			Ω(encryptor.NeedsRotation([]byte("secret"))).Should(BeTrue())
+			Ω(encryptor.NeedsRotation(sealedWithOld)).Should(BeTrue())
+			Ω(encryptor.NeedsRotation(sealedWithNew)).Should(BeFalse())
+		})
+	})
+})
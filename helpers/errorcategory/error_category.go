@@ -0,0 +1,66 @@
+package errorcategory
+
+import (
+	"encoding/json"
+
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// Category is the kind of failure behind an error, so that failures can be
+// counted, and alerted on, by kind: a rise in store timeouts says something
+// different from a rise in CC errors.  Its value names the metrics the
+// errors are counted in (AnalyzerStoreTimeoutErrors, FetcherCCErrors, ...).
+type Category string
+
+const (
+	StoreUnavailable Category = "StoreUnavailable"
+	StoreTimeout     Category = "StoreTimeout"
+	DecodeError      Category = "Decode"
+	MessageBusError  Category = "MessageBus"
+	CCError          Category = "CC"
+	Other            Category = "Other"
+)
+
+// Categories lists every category, Other included.
+var Categories = []Category{StoreUnavailable, StoreTimeout, DecodeError, MessageBusError, CCError, Other}
+
+// Error is an error tagged with its category.  Its message is the
+// underlying error's.
+type Error struct {
+	Category Category
+	Err      error
+}
+
+func (e Error) Error() string {
+	return e.Err.Error()
+}
+
+// New tags err with category.  A nil err stays nil.
+func New(category Category, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, tagged := err.(Error); tagged {
+		return err
+	}
+	return Error{Category: category, Err: err}
+}
+
+// Of returns the category of err.  Errors tagged by New have their own;
+// store timeouts and JSON decoding errors, which the store adapters and
+// models return as they are, are recognized; anything else is Other.
+func Of(err error) Category {
+	switch err := err.(type) {
+	case nil:
+		return ""
+	case Error:
+		return err.Category
+	case *json.SyntaxError, *json.UnmarshalTypeError, *json.InvalidUnmarshalError:
+		return DecodeError
+	}
+
+	if err == storeadapter.ErrorTimeout {
+		return StoreTimeout
+	}
+	return Other
+}
@@ -0,0 +1,43 @@
+package errorcategory_test
+
+import (
+	"encoding/json"
+	"errors"
+
+	. "github.com/cloudfoundry/hm9000/helpers/errorcategory"
+	"github.com/cloudfoundry/storeadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Error categories", func() {
+	It("tags errors with their category, keeping their message", func() {
+		err := New(CCError, errors.New("Unauthorized"))
+		Ω(Of(err)).Should(Equal(CCError))
+		Ω(err.Error()).Should(Equal("Unauthorized"))
+	})
+
+	It("keeps the first category an error was tagged with", func() {
+		err := New(MessageBusError, New(StoreUnavailable, errors.New("boom")))
+		Ω(Of(err)).Should(Equal(StoreUnavailable))
+	})
+
+	It("leaves nil errors nil", func() {
+		Ω(New(CCError, nil)).Should(BeNil())
+		Ω(Of(nil)).Should(BeEmpty())
+	})
+
+	It("recognizes store timeouts", func() {
+		Ω(Of(storeadapter.ErrorTimeout)).Should(Equal(StoreTimeout))
+	})
+
+	It("recognizes JSON decoding errors", func() {
+		var decoded map[string]string
+		Ω(Of(json.Unmarshal([]byte("{"), &decoded))).Should(Equal(DecodeError))
+		Ω(Of(json.Unmarshal([]byte("[]"), &decoded))).Should(Equal(DecodeError))
+	})
+
+	It("makes anything else Other", func() {
+		Ω(Of(errors.New("boom"))).Should(Equal(Other))
+	})
+})
@@ -0,0 +1,13 @@
+package errorcategory_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestErrorCategory(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Error Category Suite")
+}
@@ -0,0 +1,81 @@
+package eventbus
+
+import "sync"
+
+// An Event says that something the components of one process hand off to
+// each other has been written to the store.  Events carry nothing: the
+// store stays the record, and a component woken by an event reads it as it
+// would on any other run.
+type Event string
+
+const (
+	// ActualStateSynced is published by the listener after it saves
+	// heartbeats.
+	ActualStateSynced Event = "actual_state_synced"
+
+	// DesiredStateSynced is published after the fetcher syncs the desired
+	// state.
+	DesiredStateSynced Event = "desired_state_synced"
+
+	// PendingMessagesEnqueued is published after the analyzer enqueues
+	// start or stop messages.
+	PendingMessagesEnqueued Event = "pending_messages_enqueued"
+
+	// EvacuationMissed is published by the evacuator when it gives up on
+	// enqueuing the start for an evacuated instance.  Unlike the others it
+	// follows a write that failed, and has the analyzer start the instance
+	// from the actual state instead.
+	EvacuationMissed Event = "evacuation_missed"
+)
+
+// EventBus hands events between the components hm9000 serve runs, so that
+// a component need not wait for its next poll to pick up what another has
+// just written.  Publishing never blocks: each subscription holds at most
+// one event, and events published while it is full are folded into that
+// one.  A nil EventBus drops everything published to it, so that
+// components run on their own need not have one.
+type EventBus struct {
+	lock        *sync.Mutex
+	subscribers map[Event][]chan struct{}
+}
+
+func New() *EventBus {
+	return &EventBus{
+		lock:        &sync.Mutex{},
+		subscribers: map[Event][]chan struct{}{},
+	}
+}
+
+// Subscribe returns a channel that receives after any of events is
+// published.  A nil EventBus returns a nil channel, which never receives.
+func (bus *EventBus) Subscribe(events ...Event) <-chan struct{} {
+	if bus == nil {
+		return nil
+	}
+
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	subscription := make(chan struct{}, 1)
+	for _, event := range events {
+		bus.subscribers[event] = append(bus.subscribers[event], subscription)
+	}
+	return subscription
+}
+
+// Publish tells the subscribers to event that it happened.
+func (bus *EventBus) Publish(event Event) {
+	if bus == nil {
+		return
+	}
+
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	for _, subscription := range bus.subscribers[event] {
+		select {
+		case subscription <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package eventbus_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/helpers/eventbus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EventBus", func() {
+	var bus *EventBus
+
+	BeforeEach(func() {
+		bus = New()
+	})
+
+	It("tells the subscribers to an event when it is published", func() {
+		analyzer := bus.Subscribe(ActualStateSynced, DesiredStateSynced)
+		sender := bus.Subscribe(PendingMessagesEnqueued)
+
+		bus.Publish(DesiredStateSynced)
+		Ω(analyzer).Should(Receive())
+		Ω(sender).ShouldNot(Receive())
+
+		bus.Publish(PendingMessagesEnqueued)
+		Ω(sender).Should(Receive())
+		Ω(analyzer).ShouldNot(Receive())
+	})
+
+	It("folds the events published before the subscriber receives into one, without blocking", func() {
+		analyzer := bus.Subscribe(ActualStateSynced, DesiredStateSynced)
+
+		bus.Publish(ActualStateSynced)
+		bus.Publish(ActualStateSynced)
+		bus.Publish(DesiredStateSynced)
+
+		Ω(analyzer).Should(Receive())
+		Ω(analyzer).ShouldNot(Receive())
+	})
+
+	It("drops events nobody subscribed to", func() {
+		bus.Publish(ActualStateSynced)
+		Ω(bus.Subscribe(ActualStateSynced)).ShouldNot(Receive())
+	})
+
+	Context("when nil", func() {
+		It("drops everything, and its subscriptions never receive", func() {
+			bus = nil
+			subscription := bus.Subscribe(ActualStateSynced)
+			bus.Publish(ActualStateSynced)
+			Ω(subscription).Should(BeNil())
+		})
+	})
+})
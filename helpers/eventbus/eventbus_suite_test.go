@@ -0,0 +1,13 @@
+package eventbus_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestEventBus(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Event Bus Suite")
+}
@@ -0,0 +1,217 @@
+package failover
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// FailoverStoreAdapter sends every request to the primary store until the
+// primary fails failureThreshold times in a row, at which point it switches
+// to the secondary store for good.  Errors that describe the data (missing
+// keys, failed comparisons, ...) are not failures of the store and do not
+// count towards the threshold.
+//
+// onFailover is invoked once, after the switch, with the secondary adapter.
+type FailoverStoreAdapter struct {
+	primary          storeadapter.StoreAdapter
+	secondary        storeadapter.StoreAdapter
+	failureThreshold int
+	onFailover       func(secondary storeadapter.StoreAdapter)
+	logger           logger.Logger
+
+	active              storeadapter.StoreAdapter
+	consecutiveFailures int
+	failedOver          bool
+	lock                *sync.Mutex
+}
+
+var dataErrors = map[error]bool{
+	storeadapter.ErrorKeyNotFound:         true,
+	storeadapter.ErrorNodeIsDirectory:     true,
+	storeadapter.ErrorNodeIsNotDirectory:  true,
+	storeadapter.ErrorKeyExists:           true,
+	storeadapter.ErrorKeyComparisonFailed: true,
+	storeadapter.ErrorInvalidFormat:       true,
+	storeadapter.ErrorInvalidTTL:          true,
+}
+
+func New(primary storeadapter.StoreAdapter, secondary storeadapter.StoreAdapter, failureThreshold int, onFailover func(storeadapter.StoreAdapter), logger logger.Logger) *FailoverStoreAdapter {
+	return &FailoverStoreAdapter{
+		primary:          primary,
+		secondary:        secondary,
+		failureThreshold: failureThreshold,
+		onFailover:       onFailover,
+		logger:           logger,
+		active:           primary,
+		lock:             &sync.Mutex{},
+	}
+}
+
+func (adapter *FailoverStoreAdapter) HasFailedOver() bool {
+	adapter.lock.Lock()
+	defer adapter.lock.Unlock()
+	return adapter.failedOver
+}
+
+// Connect falls back to the secondary straight away if the primary cannot be
+// reached: there is no point waiting for further failures on startup.
+func (adapter *FailoverStoreAdapter) Connect() error {
+	primaryErr := adapter.primary.Connect()
+	if primaryErr == nil {
+		return nil
+	}
+
+	adapter.logger.Error("Failed to connect to the primary store", primaryErr)
+	err := adapter.secondary.Connect()
+	if err != nil {
+		return err
+	}
+
+	adapter.failover(primaryErr)
+	return nil
+}
+
+func (adapter *FailoverStoreAdapter) Disconnect() error {
+	primaryErr := adapter.primary.Disconnect()
+	secondaryErr := adapter.secondary.Disconnect()
+	if adapter.HasFailedOver() {
+		return secondaryErr
+	}
+	return primaryErr
+}
+
+func (adapter *FailoverStoreAdapter) Create(node storeadapter.StoreNode) error {
+	active := adapter.activeAdapter()
+	return adapter.track(active, active.Create(node))
+}
+
+func (adapter *FailoverStoreAdapter) Update(node storeadapter.StoreNode) error {
+	active := adapter.activeAdapter()
+	return adapter.track(active, active.Update(node))
+}
+
+func (adapter *FailoverStoreAdapter) CompareAndSwap(oldNode storeadapter.StoreNode, newNode storeadapter.StoreNode) error {
+	active := adapter.activeAdapter()
+	return adapter.track(active, active.CompareAndSwap(oldNode, newNode))
+}
+
+func (adapter *FailoverStoreAdapter) CompareAndSwapByIndex(prevIndex uint64, newNode storeadapter.StoreNode) error {
+	active := adapter.activeAdapter()
+	return adapter.track(active, active.CompareAndSwapByIndex(prevIndex, newNode))
+}
+
+func (adapter *FailoverStoreAdapter) SetMulti(nodes []storeadapter.StoreNode) error {
+	active := adapter.activeAdapter()
+	return adapter.track(active, active.SetMulti(nodes))
+}
+
+func (adapter *FailoverStoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	active := adapter.activeAdapter()
+	node, err := active.Get(key)
+	return node, adapter.track(active, err)
+}
+
+func (adapter *FailoverStoreAdapter) ListRecursively(key string) (storeadapter.StoreNode, error) {
+	active := adapter.activeAdapter()
+	node, err := active.ListRecursively(key)
+	return node, adapter.track(active, err)
+}
+
+func (adapter *FailoverStoreAdapter) Delete(keys ...string) error {
+	active := adapter.activeAdapter()
+	return adapter.track(active, active.Delete(keys...))
+}
+
+func (adapter *FailoverStoreAdapter) DeleteLeaves(keys ...string) error {
+	active := adapter.activeAdapter()
+	return adapter.track(active, active.DeleteLeaves(keys...))
+}
+
+func (adapter *FailoverStoreAdapter) CompareAndDelete(nodes ...storeadapter.StoreNode) error {
+	active := adapter.activeAdapter()
+	return adapter.track(active, active.CompareAndDelete(nodes...))
+}
+
+func (adapter *FailoverStoreAdapter) CompareAndDeleteByIndex(nodes ...storeadapter.StoreNode) error {
+	active := adapter.activeAdapter()
+	return adapter.track(active, active.CompareAndDeleteByIndex(nodes...))
+}
+
+func (adapter *FailoverStoreAdapter) UpdateDirTTL(key string, ttl uint64) error {
+	active := adapter.activeAdapter()
+	return adapter.track(active, active.UpdateDirTTL(key, ttl))
+}
+
+func (adapter *FailoverStoreAdapter) Watch(key string) (<-chan storeadapter.WatchEvent, chan<- bool, <-chan error) {
+	return adapter.activeAdapter().Watch(key)
+}
+
+// MaintainNode is not failed over: if the primary goes away the lock is lost
+// and the component exits.  It picks up the secondary when it restarts.
+func (adapter *FailoverStoreAdapter) MaintainNode(storeNode storeadapter.StoreNode) (<-chan bool, chan chan bool, error) {
+	active := adapter.activeAdapter()
+	status, release, err := active.MaintainNode(storeNode)
+	return status, release, adapter.track(active, err)
+}
+
+func (adapter *FailoverStoreAdapter) activeAdapter() storeadapter.StoreAdapter {
+	adapter.lock.Lock()
+	defer adapter.lock.Unlock()
+	return adapter.active
+}
+
+func (adapter *FailoverStoreAdapter) track(active storeadapter.StoreAdapter, err error) error {
+	if active != adapter.primary {
+		return err
+	}
+
+	adapter.lock.Lock()
+	if err == nil || dataErrors[err] {
+		adapter.consecutiveFailures = 0
+		adapter.lock.Unlock()
+		return err
+	}
+
+	adapter.consecutiveFailures++
+	failures := adapter.consecutiveFailures
+	adapter.lock.Unlock()
+
+	adapter.logger.Error("Primary store request failed", err, map[string]string{
+		"Consecutive Failures": strconv.Itoa(failures),
+		"Failure Threshold":    strconv.Itoa(adapter.failureThreshold),
+	})
+
+	if failures >= adapter.failureThreshold && !adapter.HasFailedOver() {
+		connectErr := adapter.secondary.Connect()
+		if connectErr != nil {
+			adapter.logger.Error("Failed to connect to the secondary store", connectErr)
+			return err
+		}
+		adapter.failover(err)
+	}
+
+	return err
+}
+
+func (adapter *FailoverStoreAdapter) failover(cause error) {
+	adapter.lock.Lock()
+	if adapter.failedOver {
+		adapter.lock.Unlock()
+		return
+	}
+	adapter.failedOver = true
+	adapter.active = adapter.secondary
+	adapter.lock.Unlock()
+
+	adapter.logger.Info("Failed over to the secondary store", map[string]string{
+		"Cause": fmt.Sprintf("%s", cause),
+	})
+
+	if adapter.onFailover != nil {
+		adapter.onFailover(adapter.secondary)
+	}
+}
@@ -0,0 +1,151 @@
+package failover_test
+
+import (
+	"errors"
+
+	. "github.com/cloudfoundry/hm9000/helpers/failover"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FailoverStoreAdapter", func() {
+	var (
+		primary         *fakestoreadapter.FakeStoreAdapter
+		secondary       *fakestoreadapter.FakeStoreAdapter
+		logger          *fakelogger.FakeLogger
+		adapter         *FailoverStoreAdapter
+		failedOverTo    []storeadapter.StoreAdapter
+		primaryFailure  error
+		primaryInjector *fakestoreadapter.FakeStoreAdapterErrorInjector
+	)
+
+	BeforeEach(func() {
+		primary = fakestoreadapter.New()
+		secondary = fakestoreadapter.New()
+		logger = fakelogger.NewFakeLogger()
+		failedOverTo = []storeadapter.StoreAdapter{}
+		primaryFailure = errors.New("connection refused")
+		primaryInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector(".*", primaryFailure)
+
+		adapter = New(primary, secondary, 3, func(s storeadapter.StoreAdapter) {
+			failedOverTo = append(failedOverTo, s)
+		}, logger)
+
+		primary.SetMulti([]storeadapter.StoreNode{{Key: "/where", Value: []byte("primary")}})
+		secondary.SetMulti([]storeadapter.StoreNode{{Key: "/where", Value: []byte("secondary")}})
+	})
+
+	where := func() string {
+		node, err := adapter.Get("/where")
+		if err != nil {
+			return err.Error()
+		}
+		return string(node.Value)
+	}
+
+	Context("when the primary is healthy", func() {
+		It("talks to the primary", func() {
+			Ω(adapter.Connect()).Should(Succeed())
+			Ω(primary.DidConnect).Should(BeTrue())
+			Ω(secondary.DidConnect).Should(BeFalse())
+			Ω(where()).Should(Equal("primary"))
+
+			adapter.SetMulti([]storeadapter.StoreNode{{Key: "/new", Value: []byte("value")}})
+			_, err := primary.Get("/new")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("does not count data errors as failures", func() {
+			for i := 0; i < 5; i++ {
+				_, err := adapter.Get("/missing")
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			}
+			Ω(adapter.HasFailedOver()).Should(BeFalse())
+		})
+	})
+
+	Context("when the primary cannot be reached on connect", func() {
+		BeforeEach(func() {
+			primary.ConnectErr = primaryFailure
+		})
+
+		It("fails over immediately", func() {
+			Ω(adapter.Connect()).Should(Succeed())
+			Ω(secondary.DidConnect).Should(BeTrue())
+			Ω(adapter.HasFailedOver()).Should(BeTrue())
+			Ω(failedOverTo).Should(Equal([]storeadapter.StoreAdapter{secondary}))
+			Ω(where()).Should(Equal("secondary"))
+		})
+
+		Context("and neither can the secondary", func() {
+			It("returns the secondary's error", func() {
+				secondary.ConnectErr = errors.New("also down")
+				Ω(adapter.Connect()).Should(Equal(errors.New("also down")))
+				Ω(failedOverTo).Should(BeEmpty())
+			})
+		})
+	})
+
+	Context("when the primary fails repeatedly", func() {
+		BeforeEach(func() {
+			adapter.Connect()
+			primary.GetErrInjector = primaryInjector
+		})
+
+		It("keeps using the primary until the threshold is reached", func() {
+			Ω(where()).Should(Equal("connection refused"))
+			Ω(where()).Should(Equal("connection refused"))
+			Ω(adapter.HasFailedOver()).Should(BeFalse())
+			Ω(where()).Should(Equal("connection refused"))
+
+			Ω(adapter.HasFailedOver()).Should(BeTrue())
+			Ω(failedOverTo).Should(HaveLen(1))
+			Ω(where()).Should(Equal("secondary"))
+			Ω(logger.LoggedSubjects).Should(ContainElement("Failed over to the secondary store"))
+		})
+
+		It("resets the count after a success", func() {
+			where()
+			where()
+			primary.GetErrInjector = nil
+			Ω(where()).Should(Equal("primary"))
+			primary.GetErrInjector = primaryInjector
+			where()
+			where()
+			Ω(adapter.HasFailedOver()).Should(BeFalse())
+		})
+
+		It("does not fail back once the primary recovers", func() {
+			where()
+			where()
+			where()
+			primary.GetErrInjector = nil
+			Ω(where()).Should(Equal("secondary"))
+		})
+
+		It("only fails over once", func() {
+			for i := 0; i < 3; i++ {
+				where()
+			}
+			secondary.GetErrInjector = primaryInjector
+			for i := 0; i < 5; i++ {
+				where()
+			}
+			Ω(failedOverTo).Should(HaveLen(1))
+		})
+
+		Context("when the secondary cannot be reached either", func() {
+			It("stays on the primary", func() {
+				secondary.ConnectErr = errors.New("also down")
+				for i := 0; i < 4; i++ {
+					where()
+				}
+				Ω(adapter.HasFailedOver()).Should(BeFalse())
+				Ω(failedOverTo).Should(BeEmpty())
+			})
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package faultinjection_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFaultinjection(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Faultinjection Suite")
+}
@@ -0,0 +1,136 @@
+package faultinjection_test
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/apcera/nats"
+	. "github.com/cloudfoundry/hm9000/helpers/faultinjection"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakehttpclient"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Injector", func() {
+	It("should never roll a rate of 0 and always roll a rate of 1", func() {
+		injector := NewInjector(1)
+		for i := 0; i < 100; i++ {
+			Ω(injector.Roll(0)).Should(BeFalse())
+			Ω(injector.Roll(1)).Should(BeTrue())
+		}
+	})
+
+	It("should roll roughly the given fraction of the time", func() {
+		injector := NewInjector(1)
+		rolled := 0
+		for i := 0; i < 1000; i++ {
+			if injector.Roll(0.25) {
+				rolled++
+			}
+		}
+		Ω(rolled).Should(BeNumerically("~", 250, 50))
+	})
+
+	It("should make the same decisions for the same seed", func() {
+		first, second := NewInjector(42), NewInjector(42)
+		for i := 0; i < 100; i++ {
+			Ω(first.Roll(0.5)).Should(Equal(second.Roll(0.5)))
+		}
+	})
+})
+
+var _ = Describe("StoreAdapter", func() {
+	var fakeStoreAdapter *fakestoreadapter.FakeStoreAdapter
+
+	BeforeEach(func() {
+		fakeStoreAdapter = fakestoreadapter.New()
+	})
+
+	It("should delay requests that are rolled", func() {
+		adapter := NewStoreAdapter(fakeStoreAdapter, NewInjector(1), 50*time.Millisecond, 1)
+
+		start := time.Now()
+		err := adapter.SetMulti([]storeadapter.StoreNode{{Key: "/foo", Value: []byte("bar")}})
+		Ω(err).ShouldNot(HaveOccurred())
+		node, err := adapter.Get("/foo")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.Value).Should(Equal([]byte("bar")))
+		Ω(time.Since(start)).Should(BeNumerically(">=", 100*time.Millisecond))
+	})
+
+	It("should pass other requests straight through", func() {
+		adapter := NewStoreAdapter(fakeStoreAdapter, NewInjector(1), time.Second, 0)
+
+		start := time.Now()
+		err := adapter.SetMulti([]storeadapter.StoreNode{{Key: "/foo", Value: []byte("bar")}})
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = adapter.Get("/foo")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(time.Since(start)).Should(BeNumerically("<", 100*time.Millisecond))
+	})
+})
+
+var _ = Describe("NATSConn", func() {
+	var fakeNATSConn *fakeyagnats.FakeNATSConn
+
+	BeforeEach(func() {
+		fakeNATSConn = fakeyagnats.Connect()
+	})
+
+	It("should drop published messages that are rolled, without failing", func() {
+		conn := NewNATSConn(fakeNATSConn, NewInjector(1), 1)
+		Ω(conn.Publish("dea.heartbeat", []byte("hi"))).Should(Succeed())
+		Ω(conn.PublishRequest("dea.heartbeat", "reply", []byte("hi"))).Should(Succeed())
+		Ω(fakeNATSConn.PublishedMessages("dea.heartbeat")).Should(BeEmpty())
+	})
+
+	It("should drop delivered messages that are rolled", func() {
+		conn := NewNATSConn(fakeNATSConn, NewInjector(1), 1)
+		delivered := 0
+		conn.Subscribe("dea.heartbeat", func(*nats.Msg) { delivered++ })
+
+		fakeNATSConn.SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{})
+		Ω(delivered).Should(Equal(0))
+	})
+
+	It("should pass other messages straight through", func() {
+		conn := NewNATSConn(fakeNATSConn, NewInjector(1), 0)
+		delivered := 0
+		conn.QueueSubscribe("dea.heartbeat", "hm9000", func(*nats.Msg) { delivered++ })
+
+		Ω(conn.Publish("dea.heartbeat", []byte("hi"))).Should(Succeed())
+		Ω(fakeNATSConn.PublishedMessages("dea.heartbeat")).Should(HaveLen(1))
+		Ω(delivered).Should(Equal(1))
+	})
+})
+
+var _ = Describe("HttpClient", func() {
+	var fakeHttpClient *fakehttpclient.FakeHttpClient
+
+	BeforeEach(func() {
+		fakeHttpClient = fakehttpclient.NewFakeHttpClient()
+	})
+
+	It("should fail requests that are rolled without sending them", func() {
+		client := NewHttpClient(fakeHttpClient, NewInjector(1), 1)
+		request, _ := http.NewRequest("GET", "http://cc.example.com/bulk/apps", nil)
+
+		var receivedErr error
+		client.Do(request, func(response *http.Response, err error) {
+			receivedErr = err
+		})
+		Ω(receivedErr).Should(Equal(ErrInjectedFailure))
+		Ω(fakeHttpClient.Requests).Should(BeEmpty())
+	})
+
+	It("should send other requests", func() {
+		client := NewHttpClient(fakeHttpClient, NewInjector(1), 0)
+		request, _ := http.NewRequest("GET", "http://cc.example.com/bulk/apps", nil)
+
+		client.Do(request, func(*http.Response, error) {})
+		Ω(fakeHttpClient.Requests).Should(HaveLen(1))
+	})
+})
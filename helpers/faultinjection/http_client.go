@@ -0,0 +1,31 @@
+package faultinjection
+
+import (
+	"net/http"
+
+	"github.com/cloudfoundry/hm9000/helpers/httpclient"
+)
+
+// HttpClient fails a fraction of the requests made through it with
+// ErrInjectedFailure, without sending them.
+type HttpClient struct {
+	client   httpclient.HttpClient
+	injector *Injector
+	rate     float64
+}
+
+func NewHttpClient(client httpclient.HttpClient, injector *Injector, rate float64) *HttpClient {
+	return &HttpClient{
+		client:   client,
+		injector: injector,
+		rate:     rate,
+	}
+}
+
+func (client *HttpClient) Do(req *http.Request, callback func(*http.Response, error)) {
+	if client.injector.Roll(client.rate) {
+		callback(nil, ErrInjectedFailure)
+		return
+	}
+	client.client.Do(req, callback)
+}
@@ -0,0 +1,41 @@
+// Package faultinjection wraps the store adapter, the message bus and the
+// CC http client with layers that slow down, drop or fail a fraction of
+// their requests.  It exists to exercise hm9000's resilience (failover,
+// retries, freshness) in CI and staging, and must never be enabled in
+// production.
+package faultinjection
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+)
+
+var ErrInjectedFailure = errors.New("injected failure")
+
+// Injector decides which requests to interfere with.  Every layer may share
+// one: decisions are random, but repeatable for a given seed and sequence
+// of requests.
+type Injector struct {
+	rand *rand.Rand
+	lock *sync.Mutex
+}
+
+func NewInjector(seed int64) *Injector {
+	return &Injector{
+		rand: rand.New(rand.NewSource(seed)),
+		lock: &sync.Mutex{},
+	}
+}
+
+// Roll is true for a fraction rate of calls.  A rate of 0 is never true
+// and a rate of 1 always.
+func (injector *Injector) Roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	return injector.rand.Float64() < rate
+}
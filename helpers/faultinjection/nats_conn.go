@@ -0,0 +1,55 @@
+package faultinjection
+
+import (
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+)
+
+// NATSConn drops a fraction of the messages published through it, and of
+// the messages delivered to its subscribers.  Dropped publishes still
+// succeed, as they would if the message were lost on the way.
+type NATSConn struct {
+	messagebus.MessageBus
+
+	injector *Injector
+	rate     float64
+}
+
+func NewNATSConn(conn messagebus.MessageBus, injector *Injector, rate float64) *NATSConn {
+	return &NATSConn{
+		MessageBus: conn,
+		injector:   injector,
+		rate:       rate,
+	}
+}
+
+func (conn *NATSConn) Publish(subject string, data []byte) error {
+	if conn.injector.Roll(conn.rate) {
+		return nil
+	}
+	return conn.MessageBus.Publish(subject, data)
+}
+
+func (conn *NATSConn) PublishRequest(subject, reply string, data []byte) error {
+	if conn.injector.Roll(conn.rate) {
+		return nil
+	}
+	return conn.MessageBus.PublishRequest(subject, reply, data)
+}
+
+func (conn *NATSConn) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	return conn.MessageBus.Subscribe(subject, conn.dropping(handler))
+}
+
+func (conn *NATSConn) QueueSubscribe(subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	return conn.MessageBus.QueueSubscribe(subject, queue, conn.dropping(handler))
+}
+
+func (conn *NATSConn) dropping(handler nats.MsgHandler) nats.MsgHandler {
+	return func(message *nats.Msg) {
+		if conn.injector.Roll(conn.rate) {
+			return
+		}
+		handler(message)
+	}
+}
@@ -0,0 +1,92 @@
+package faultinjection
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// StoreAdapter delays a fraction of the requests made through it.
+// Connecting, watching and maintaining nodes are left alone.
+type StoreAdapter struct {
+	storeadapter.StoreAdapter
+
+	injector *Injector
+	latency  time.Duration
+	rate     float64
+}
+
+func NewStoreAdapter(adapter storeadapter.StoreAdapter, injector *Injector, latency time.Duration, rate float64) *StoreAdapter {
+	return &StoreAdapter{
+		StoreAdapter: adapter,
+		injector:     injector,
+		latency:      latency,
+		rate:         rate,
+	}
+}
+
+func (adapter *StoreAdapter) Create(node storeadapter.StoreNode) error {
+	adapter.delay()
+	return adapter.StoreAdapter.Create(node)
+}
+
+func (adapter *StoreAdapter) Update(node storeadapter.StoreNode) error {
+	adapter.delay()
+	return adapter.StoreAdapter.Update(node)
+}
+
+func (adapter *StoreAdapter) CompareAndSwap(oldNode storeadapter.StoreNode, newNode storeadapter.StoreNode) error {
+	adapter.delay()
+	return adapter.StoreAdapter.CompareAndSwap(oldNode, newNode)
+}
+
+func (adapter *StoreAdapter) CompareAndSwapByIndex(prevIndex uint64, newNode storeadapter.StoreNode) error {
+	adapter.delay()
+	return adapter.StoreAdapter.CompareAndSwapByIndex(prevIndex, newNode)
+}
+
+func (adapter *StoreAdapter) SetMulti(nodes []storeadapter.StoreNode) error {
+	adapter.delay()
+	return adapter.StoreAdapter.SetMulti(nodes)
+}
+
+func (adapter *StoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	adapter.delay()
+	return adapter.StoreAdapter.Get(key)
+}
+
+func (adapter *StoreAdapter) ListRecursively(key string) (storeadapter.StoreNode, error) {
+	adapter.delay()
+	return adapter.StoreAdapter.ListRecursively(key)
+}
+
+func (adapter *StoreAdapter) Delete(keys ...string) error {
+	adapter.delay()
+	return adapter.StoreAdapter.Delete(keys...)
+}
+
+func (adapter *StoreAdapter) DeleteLeaves(keys ...string) error {
+	adapter.delay()
+	return adapter.StoreAdapter.DeleteLeaves(keys...)
+}
+
+func (adapter *StoreAdapter) CompareAndDelete(nodes ...storeadapter.StoreNode) error {
+	adapter.delay()
+	return adapter.StoreAdapter.CompareAndDelete(nodes...)
+}
+
+func (adapter *StoreAdapter) CompareAndDeleteByIndex(nodes ...storeadapter.StoreNode) error {
+	adapter.delay()
+	return adapter.StoreAdapter.CompareAndDeleteByIndex(nodes...)
+}
+
+func (adapter *StoreAdapter) UpdateDirTTL(key string, ttl uint64) error {
+	adapter.delay()
+	return adapter.StoreAdapter.UpdateDirTTL(key, ttl)
+}
+
+func (adapter *StoreAdapter) delay() {
+	if adapter.injector.Roll(adapter.rate) {
+		time.Sleep(adapter.latency)
+	}
+}
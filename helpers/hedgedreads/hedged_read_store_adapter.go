@@ -0,0 +1,181 @@
+package hedgedreads
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// Stats counts the reads a HedgedReadStoreAdapter has hedged since the
+// stats were last collected, and how many of them the hedge answered first.
+type Stats struct {
+	Hedged int
+	Won    int
+}
+
+// HedgedReadStoreAdapter sends every request to the primary adapter.  A read
+// (Get or ListRecursively) the primary has not answered within threshold is
+// sent again to the next of the hedges, in turn, and the first answer is
+// used, unless it failed and the other one does not.  The slower request is
+// abandoned, not cancelled.
+//
+// The hedges are meant to talk to the same store as the primary through
+// other nodes.  Hedges that cannot be connected to are left out.
+type HedgedReadStoreAdapter struct {
+	storeadapter.StoreAdapter
+
+	hedges    []storeadapter.StoreAdapter
+	threshold time.Duration
+	logger    logger.Logger
+
+	connected []storeadapter.StoreAdapter
+	next      int
+	stats     Stats
+	lock      *sync.Mutex
+}
+
+var dataErrors = map[error]bool{
+	storeadapter.ErrorKeyNotFound:         true,
+	storeadapter.ErrorNodeIsDirectory:     true,
+	storeadapter.ErrorNodeIsNotDirectory:  true,
+	storeadapter.ErrorKeyExists:           true,
+	storeadapter.ErrorKeyComparisonFailed: true,
+	storeadapter.ErrorInvalidFormat:       true,
+	storeadapter.ErrorInvalidTTL:          true,
+}
+
+func New(primary storeadapter.StoreAdapter, hedges []storeadapter.StoreAdapter, threshold time.Duration, logger logger.Logger) *HedgedReadStoreAdapter {
+	return &HedgedReadStoreAdapter{
+		StoreAdapter: primary,
+		hedges:       hedges,
+		threshold:    threshold,
+		logger:       logger,
+		connected:    []storeadapter.StoreAdapter{},
+		lock:         &sync.Mutex{},
+	}
+}
+
+// CollectStats returns the stats gathered since the last call and resets
+// them.
+func (adapter *HedgedReadStoreAdapter) CollectStats() Stats {
+	adapter.lock.Lock()
+	defer adapter.lock.Unlock()
+
+	stats := adapter.stats
+	adapter.stats = Stats{}
+	return stats
+}
+
+func (adapter *HedgedReadStoreAdapter) Connect() error {
+	err := adapter.StoreAdapter.Connect()
+	if err != nil {
+		return err
+	}
+
+	connected := []storeadapter.StoreAdapter{}
+	for _, hedge := range adapter.hedges {
+		err := hedge.Connect()
+		if err != nil {
+			adapter.logger.Error("Failed to connect to a store node to hedge reads with", err)
+			continue
+		}
+		connected = append(connected, hedge)
+	}
+
+	adapter.lock.Lock()
+	adapter.connected = connected
+	adapter.lock.Unlock()
+	return nil
+}
+
+func (adapter *HedgedReadStoreAdapter) Disconnect() error {
+	adapter.lock.Lock()
+	connected := adapter.connected
+	adapter.connected = []storeadapter.StoreAdapter{}
+	adapter.lock.Unlock()
+
+	for _, hedge := range connected {
+		hedge.Disconnect()
+	}
+	return adapter.StoreAdapter.Disconnect()
+}
+
+func (adapter *HedgedReadStoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	return adapter.hedged(func(reader storeadapter.StoreAdapter) (storeadapter.StoreNode, error) {
+		return reader.Get(key)
+	})
+}
+
+func (adapter *HedgedReadStoreAdapter) ListRecursively(key string) (storeadapter.StoreNode, error) {
+	return adapter.hedged(func(reader storeadapter.StoreAdapter) (storeadapter.StoreNode, error) {
+		return reader.ListRecursively(key)
+	})
+}
+
+type readRequest func(reader storeadapter.StoreAdapter) (storeadapter.StoreNode, error)
+
+type readResponse struct {
+	node  storeadapter.StoreNode
+	err   error
+	hedge bool
+}
+
+func (response readResponse) failed() bool {
+	return response.err != nil && !dataErrors[response.err]
+}
+
+func (adapter *HedgedReadStoreAdapter) hedged(request readRequest) (storeadapter.StoreNode, error) {
+	responses := make(chan readResponse, 2)
+	go func() {
+		node, err := request(adapter.StoreAdapter)
+		responses <- readResponse{node, err, false}
+	}()
+
+	select {
+	case response := <-responses:
+		return response.node, response.err
+	case <-time.After(adapter.threshold):
+	}
+
+	hedge := adapter.nextHedge()
+	if hedge == nil {
+		response := <-responses
+		return response.node, response.err
+	}
+
+	go func() {
+		node, err := request(hedge)
+		responses <- readResponse{node, err, true}
+	}()
+
+	response := <-responses
+	if response.failed() {
+		other := <-responses
+		if !other.failed() {
+			response = other
+		}
+	}
+
+	adapter.lock.Lock()
+	adapter.stats.Hedged++
+	if response.hedge {
+		adapter.stats.Won++
+	}
+	adapter.lock.Unlock()
+
+	return response.node, response.err
+}
+
+func (adapter *HedgedReadStoreAdapter) nextHedge() storeadapter.StoreAdapter {
+	adapter.lock.Lock()
+	defer adapter.lock.Unlock()
+
+	if len(adapter.connected) == 0 {
+		return nil
+	}
+	hedge := adapter.connected[adapter.next%len(adapter.connected)]
+	adapter.next++
+	return hedge
+}
@@ -0,0 +1,128 @@
+package hedgedreads_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/helpers/hedgedreads"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type slowStoreAdapter struct {
+	*fakestoreadapter.FakeStoreAdapter
+	delay time.Duration
+}
+
+func (adapter *slowStoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	time.Sleep(adapter.delay)
+	return adapter.FakeStoreAdapter.Get(key)
+}
+
+func (adapter *slowStoreAdapter) ListRecursively(key string) (storeadapter.StoreNode, error) {
+	time.Sleep(adapter.delay)
+	return adapter.FakeStoreAdapter.ListRecursively(key)
+}
+
+var _ = Describe("HedgedReadStoreAdapter", func() {
+	var (
+		primary *slowStoreAdapter
+		hedge   *slowStoreAdapter
+		adapter *HedgedReadStoreAdapter
+	)
+
+	newNode := func(value string) *slowStoreAdapter {
+		node := &slowStoreAdapter{FakeStoreAdapter: fakestoreadapter.New()}
+		node.SetMulti([]storeadapter.StoreNode{{Key: "/dir/where", Value: []byte(value)}})
+		return node
+	}
+
+	where := func() string {
+		node, err := adapter.Get("/dir/where")
+		Ω(err).ShouldNot(HaveOccurred())
+		return string(node.Value)
+	}
+
+	BeforeEach(func() {
+		primary = newNode("primary")
+		hedge = newNode("hedge")
+		adapter = New(primary, []storeadapter.StoreAdapter{hedge}, 20*time.Millisecond, fakelogger.NewFakeLogger())
+		Ω(adapter.Connect()).Should(Succeed())
+	})
+
+	It("connects to the primary and the hedges", func() {
+		Ω(primary.DidConnect).Should(BeTrue())
+		Ω(hedge.DidConnect).Should(BeTrue())
+	})
+
+	It("does not hedge reads the primary answers in time", func() {
+		Ω(where()).Should(Equal("primary"))
+		Ω(adapter.CollectStats()).Should(Equal(Stats{}))
+	})
+
+	Context("when the primary is slow", func() {
+		BeforeEach(func() {
+			primary.delay = 200 * time.Millisecond
+		})
+
+		It("uses the hedge's answer, and counts it", func() {
+			Ω(where()).Should(Equal("hedge"))
+
+			node, err := adapter.ListRecursively("/dir")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.ChildNodes[0].Value).Should(Equal([]byte("hedge")))
+
+			Ω(adapter.CollectStats()).Should(Equal(Stats{Hedged: 2, Won: 2}))
+			Ω(adapter.CollectStats()).Should(Equal(Stats{}))
+		})
+
+		It("uses the primary's answer when it still comes first", func() {
+			hedge.delay = time.Second
+			Ω(where()).Should(Equal("primary"))
+			Ω(adapter.CollectStats()).Should(Equal(Stats{Hedged: 1, Won: 0}))
+		})
+
+		It("uses the primary's answer when the hedge fails", func() {
+			hedge.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector(".*", errors.New("connection refused"))
+			Ω(where()).Should(Equal("primary"))
+		})
+
+		It("does not wait for the primary when the hedge says the key is missing", func() {
+			hedge.Delete("/dir/where")
+			_, err := adapter.Get("/dir/where")
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			Ω(adapter.CollectStats()).Should(Equal(Stats{Hedged: 1, Won: 1}))
+		})
+	})
+
+	It("never hedges writes", func() {
+		err := adapter.SetMulti([]storeadapter.StoreNode{{Key: "/new", Value: []byte("value")}})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = primary.Get("/new")
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = hedge.Get("/new")
+		Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+	})
+
+	Context("when a hedge cannot be connected to", func() {
+		BeforeEach(func() {
+			hedge.ConnectErr = errors.New("connection refused")
+			primary.delay = 50 * time.Millisecond
+			Ω(adapter.Connect()).Should(Succeed())
+		})
+
+		It("waits for the primary", func() {
+			Ω(where()).Should(Equal("primary"))
+			Ω(adapter.CollectStats()).Should(Equal(Stats{}))
+		})
+	})
+
+	It("fails to connect when the primary cannot be reached", func() {
+		primary.ConnectErr = errors.New("connection refused")
+		Ω(adapter.Connect()).ShouldNot(Succeed())
+	})
+})
@@ -0,0 +1,13 @@
+package hedgedreads_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestHedgedReads(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HedgedReads Suite")
+}
@@ -4,38 +4,159 @@ import (
 	"crypto/tls"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
+// Options configure a RealHttpClient.
+//
+// Timeout bounds connecting and every read and write on a connection (0
+// means never), which also closes pooled connections left idle for longer;
+// HostTimeouts override it for particular hosts, given as "host" or
+// "host:port".  MaxRetries is how many times an idempotent request (GET,
+// HEAD, OPTIONS, PUT or DELETE, without a body) is retried after a
+// network error or a 5xx response, waiting RetryDelay before the first
+// retry and doubling the wait each time.  MaxIdleConnectionsPerHost limits
+// the keep-alive connections pooled per host (0 keeps net/http's default).
+// Observe, if set, is called once for every request, after its last
+// attempt.
+type Options struct {
+	SkipSSLVerification       bool
+	Timeout                   time.Duration
+	HostTimeouts              map[string]time.Duration
+	MaxRetries                int
+	RetryDelay                time.Duration
+	MaxIdleConnectionsPerHost int
+	Observe                   func(Observation)
+}
+
+// Observation describes a request made through a RealHttpClient.  Err and
+// StatusCode are those of the last attempt, and Latency covers every
+// attempt and the waits between them.
+type Observation struct {
+	Method     string
+	Host       string
+	StatusCode int
+	Err        error
+	Retries    int
+	Latency    time.Duration
+}
+
+// Failed is true when the request got no response or a 5xx response.
+func (observation Observation) Failed() bool {
+	return observation.Err != nil || observation.StatusCode >= 500
+}
+
+var idempotentMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"PUT":     true,
+	"DELETE":  true,
+}
+
 func NewHttpClient(skipSSLVerification bool, timeout time.Duration) HttpClient {
+	return NewHttpClientWithOptions(Options{
+		SkipSSLVerification: skipSSLVerification,
+		Timeout:             timeout,
+	})
+}
+
+func NewHttpClientWithOptions(options Options) *RealHttpClient {
 	dialFunc := func(network, addr string) (net.Conn, error) {
+		timeout := options.timeoutFor(addr)
 		conn, err := net.DialTimeout(network, addr, timeout)
 		if err != nil {
 			return nil, err
 		}
-		conn.SetDeadline(time.Now().Add(timeout))
-		return conn, err
+		if timeout == 0 {
+			return conn, nil
+		}
+		return &deadlineConn{Conn: conn, timeout: timeout}, nil
 	}
 
 	transport := &http.Transport{
 		Dial: dialFunc,
 		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: skipSSLVerification,
+			InsecureSkipVerify: options.SkipSSLVerification,
 		},
+		MaxIdleConnsPerHost: options.MaxIdleConnectionsPerHost,
 	}
 
 	return &RealHttpClient{
 		client: &http.Client{
 			Transport: transport,
 		},
+		options: options,
 	}
 }
 
 type RealHttpClient struct {
-	client *http.Client
+	client  *http.Client
+	options Options
 }
 
 func (client *RealHttpClient) Do(req *http.Request, callback func(*http.Response, error)) {
+	startTime := time.Now()
+	retryable := idempotentMethods[req.Method] && req.Body == nil
+
 	response, err := client.client.Do(req)
+	retries := 0
+	delay := client.options.RetryDelay
+	for retryable && retries < client.options.MaxRetries && (err != nil || response.StatusCode >= 500) {
+		if err == nil {
+			response.Body.Close()
+		}
+		time.Sleep(delay)
+		delay *= 2
+		retries++
+		response, err = client.client.Do(req)
+	}
+
+	if client.options.Observe != nil {
+		observation := Observation{
+			Method:  req.Method,
+			Host:    req.URL.Host,
+			Err:     err,
+			Retries: retries,
+			Latency: time.Since(startTime),
+		}
+		if err == nil {
+			observation.StatusCode = response.StatusCode
+		}
+		client.options.Observe(observation)
+	}
+
 	callback(response, err)
 }
+
+func (options Options) timeoutFor(addr string) time.Duration {
+	if timeout, ok := options.HostTimeouts[addr]; ok {
+		return timeout
+	}
+	host := addr
+	if i := strings.LastIndex(addr, ":"); i != -1 {
+		host = addr[:i]
+	}
+	if timeout, ok := options.HostTimeouts[host]; ok {
+		return timeout
+	}
+	return options.Timeout
+}
+
+// deadlineConn gives every read and write the full timeout, rather than
+// the connection as a whole, so that pooled connections can be reused.
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (conn *deadlineConn) Read(b []byte) (int, error) {
+	conn.Conn.SetDeadline(time.Now().Add(conn.timeout))
+	return conn.Conn.Read(b)
+}
+
+func (conn *deadlineConn) Write(b []byte) (int, error) {
+	conn.Conn.SetDeadline(time.Now().Add(conn.timeout))
+	return conn.Conn.Write(b)
+}
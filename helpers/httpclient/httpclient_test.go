@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	. "github.com/cloudfoundry/hm9000/helpers/httpclient"
@@ -17,9 +18,34 @@ import (
 //There appears to be a bug in go where a TLS server launched within the same process as the client that makes the connection
 //refuses all connections from the client.
 
+var attempts = map[string]int{}
+var attemptsLock = &sync.Mutex{}
+
+func attempt(key string) int {
+	attemptsLock.Lock()
+	defer attemptsLock.Unlock()
+	attempts[key]++
+	return attempts[key]
+}
+
+func attemptsFor(key string) int {
+	attemptsLock.Lock()
+	defer attemptsLock.Unlock()
+	return attempts[key]
+}
+
 func init() {
 	net.Listen("tcp", ":8887")
 
+	http.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		failures, _ := strconv.Atoi(r.URL.Query().Get("failures"))
+		if attempt(r.URL.Query().Get("key")) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "I'm awake!")
+	})
+
 	http.HandleFunc("/sleep", func(w http.ResponseWriter, r *http.Request) {
 		sleepTimeInSeconds, _ := strconv.ParseFloat(r.URL.Query().Get("time"), 64)
 		time.Sleep(time.Duration(sleepTimeInSeconds * float64(time.Second)))
@@ -66,4 +92,134 @@ var _ = Describe("Httpclient", func() {
 			})
 		})
 	})
+
+	Describe("retrying requests", func() {
+		var observations []Observation
+
+		BeforeEach(func() {
+			observations = []Observation{}
+			client = NewHttpClientWithOptions(Options{
+				Timeout:    time.Second,
+				MaxRetries: 2,
+				RetryDelay: time.Millisecond,
+				Observe: func(observation Observation) {
+					observations = append(observations, observation)
+				},
+			})
+		})
+
+		It("should retry idempotent requests that fail with a 5xx", func() {
+			request, _ := http.NewRequest("GET", "http://127.0.0.1:8889/flaky?key=get&failures=2", nil)
+			client.Do(request, func(response *http.Response, err error) {
+				Ω(err).ShouldNot(HaveOccurred())
+				defer response.Body.Close()
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			})
+			Ω(attemptsFor("get")).Should(Equal(3))
+		})
+
+		It("should give up after the configured number of retries", func() {
+			request, _ := http.NewRequest("GET", "http://127.0.0.1:8889/flaky?key=give-up&failures=5", nil)
+			client.Do(request, func(response *http.Response, err error) {
+				Ω(err).ShouldNot(HaveOccurred())
+				defer response.Body.Close()
+				Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+			})
+			Ω(attemptsFor("give-up")).Should(Equal(3))
+		})
+
+		It("should not retry requests that are not idempotent", func() {
+			request, _ := http.NewRequest("POST", "http://127.0.0.1:8889/flaky?key=post&failures=1", nil)
+			client.Do(request, func(response *http.Response, err error) {
+				Ω(err).ShouldNot(HaveOccurred())
+				defer response.Body.Close()
+				Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+			})
+			Ω(attemptsFor("post")).Should(Equal(1))
+		})
+
+		It("should retry network errors", func() {
+			request, _ := http.NewRequest("GET", "http://127.0.0.1:8886/", nil)
+			client.Do(request, func(response *http.Response, err error) {
+				Ω(err).Should(HaveOccurred())
+			})
+			Ω(observations).Should(HaveLen(1))
+			Ω(observations[0].Retries).Should(Equal(2))
+			Ω(observations[0].Failed()).Should(BeTrue())
+		})
+
+		It("should observe every request once, after its last attempt", func() {
+			request, _ := http.NewRequest("GET", "http://127.0.0.1:8889/flaky?key=observed&failures=1", nil)
+			client.Do(request, func(response *http.Response, err error) {
+				response.Body.Close()
+			})
+
+			Ω(observations).Should(HaveLen(1))
+			Ω(observations[0].Method).Should(Equal("GET"))
+			Ω(observations[0].Host).Should(Equal("127.0.0.1:8889"))
+			Ω(observations[0].StatusCode).Should(Equal(http.StatusOK))
+			Ω(observations[0].Err).ShouldNot(HaveOccurred())
+			Ω(observations[0].Retries).Should(Equal(1))
+			Ω(observations[0].Failed()).Should(BeFalse())
+			Ω(observations[0].Latency).Should(BeNumerically(">", 0))
+		})
+	})
+
+	Describe("per-host timeouts", func() {
+		It("should use the host's timeout instead of the default", func() {
+			client = NewHttpClientWithOptions(Options{
+				Timeout:      10 * time.Millisecond,
+				HostTimeouts: map[string]time.Duration{"127.0.0.1:8889": time.Second},
+			})
+			request, _ := http.NewRequest("GET", "http://127.0.0.1:8889/sleep?time=0.1", nil)
+			client.Do(request, func(response *http.Response, err error) {
+				Ω(err).ShouldNot(HaveOccurred())
+				response.Body.Close()
+			})
+		})
+
+		It("should match hosts without their port", func() {
+			client = NewHttpClientWithOptions(Options{
+				Timeout:      time.Second,
+				HostTimeouts: map[string]time.Duration{"127.0.0.1": 10 * time.Millisecond},
+			})
+			request, _ := http.NewRequest("GET", "http://127.0.0.1:8889/sleep?time=1", nil)
+			client.Do(request, func(response *http.Response, err error) {
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("reusing connections", func() {
+		It("should serve several requests over a pooled connection", func() {
+			client = NewHttpClientWithOptions(Options{
+				Timeout:                   50 * time.Millisecond,
+				MaxIdleConnectionsPerHost: 1,
+			})
+			for i := 0; i < 3; i++ {
+				request, _ := http.NewRequest("GET", "http://127.0.0.1:8889/sleep?time=0.02", nil)
+				client.Do(request, func(response *http.Response, err error) {
+					Ω(err).ShouldNot(HaveOccurred())
+					defer response.Body.Close()
+					_, err = ioutil.ReadAll(response.Body)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+			}
+		})
+	})
+})
+
+var _ = Describe("StatsCollector", func() {
+	It("should count requests, errors and retries until the stats are collected", func() {
+		collector := NewStatsCollector()
+		collector.Observe(Observation{StatusCode: 200, Latency: 10 * time.Millisecond})
+		collector.Observe(Observation{StatusCode: 503, Retries: 2, Latency: 30 * time.Millisecond})
+		collector.Observe(Observation{Err: fmt.Errorf("boom"), Retries: 1, Latency: 20 * time.Millisecond})
+
+		stats := collector.CollectStats()
+		Ω(stats).Should(Equal(Stats{Requests: 3, Errors: 2, Retries: 3, TotalLatency: 60 * time.Millisecond}))
+		Ω(stats.MeanLatency()).Should(Equal(20 * time.Millisecond))
+
+		Ω(collector.CollectStats()).Should(Equal(Stats{}))
+	})
 })
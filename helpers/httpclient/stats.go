@@ -0,0 +1,59 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats summarizes the requests observed by a StatsCollector since the
+// stats were last collected.  Requests that got no response or a 5xx
+// response are errors.
+type Stats struct {
+	Requests     int
+	Errors       int
+	Retries      int
+	TotalLatency time.Duration
+}
+
+func (stats Stats) MeanLatency() time.Duration {
+	if stats.Requests == 0 {
+		return 0
+	}
+	return stats.TotalLatency / time.Duration(stats.Requests)
+}
+
+// StatsCollector keeps Stats for the clients whose Options.Observe is its
+// Observe.
+type StatsCollector struct {
+	stats Stats
+	lock  *sync.Mutex
+}
+
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{
+		lock: &sync.Mutex{},
+	}
+}
+
+func (collector *StatsCollector) Observe(observation Observation) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+
+	collector.stats.Requests++
+	if observation.Failed() {
+		collector.stats.Errors++
+	}
+	collector.stats.Retries += observation.Retries
+	collector.stats.TotalLatency += observation.Latency
+}
+
+// CollectStats returns the stats gathered since the last call and resets
+// them.
+func (collector *StatsCollector) CollectStats() Stats {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+
+	stats := collector.stats
+	collector.stats = Stats{}
+	return stats
+}
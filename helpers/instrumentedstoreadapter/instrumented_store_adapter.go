@@ -0,0 +1,238 @@
+package instrumentedstoreadapter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// Stats summarizes the requests made through an InstrumentedStoreAdapter
+// since the stats were last collected.  Requests that fail because of the
+// data (missing keys, failed comparisons, ...) are not errors.
+type Stats struct {
+	Requests     int
+	Errors       int
+	Retries      int
+	TotalLatency time.Duration
+}
+
+func (stats Stats) MeanLatency() time.Duration {
+	if stats.Requests == 0 {
+		return 0
+	}
+	return stats.TotalLatency / time.Duration(stats.Requests)
+}
+
+// InstrumentedStoreAdapter bounds every request by a timeout, retries
+// idempotent requests that fail, and keeps Stats.
+//
+// A request that times out is abandoned, not cancelled: the underlying
+// adapter may still complete it in the background.  For that reason
+// Create, the compare-and-* requests and MaintainNode are never retried,
+// and the other writes are not retried once they have timed out: the
+// abandoned write could otherwise land after the retry, or after a later
+// write.
+//
+// Requests that time out fail with storeadapter.ErrorTimeout.  Other
+// failures, bar those of the data, are tagged errorcategory.StoreUnavailable.
+type InstrumentedStoreAdapter struct {
+	storeadapter.StoreAdapter
+
+	timeout    time.Duration
+	retries    int
+	retryDelay time.Duration
+
+	stats Stats
+	lock  *sync.Mutex
+}
+
+var dataErrors = map[error]bool{
+	storeadapter.ErrorKeyNotFound:         true,
+	storeadapter.ErrorNodeIsDirectory:     true,
+	storeadapter.ErrorNodeIsNotDirectory:  true,
+	storeadapter.ErrorKeyExists:           true,
+	storeadapter.ErrorKeyComparisonFailed: true,
+	storeadapter.ErrorInvalidFormat:       true,
+	storeadapter.ErrorInvalidTTL:          true,
+}
+
+// New returns an adapter that gives up on requests after timeout (0 means
+// never) and retries idempotent requests up to retries times, waiting
+// retryDelay before the first retry and doubling the wait each time.
+func New(adapter storeadapter.StoreAdapter, timeout time.Duration, retries int, retryDelay time.Duration) *InstrumentedStoreAdapter {
+	return &InstrumentedStoreAdapter{
+		StoreAdapter: adapter,
+		timeout:      timeout,
+		retries:      retries,
+		retryDelay:   retryDelay,
+		lock:         &sync.Mutex{},
+	}
+}
+
+// CollectStats returns the stats gathered since the last call and resets
+// them.
+func (adapter *InstrumentedStoreAdapter) CollectStats() Stats {
+	adapter.lock.Lock()
+	defer adapter.lock.Unlock()
+
+	stats := adapter.stats
+	adapter.stats = Stats{}
+	return stats
+}
+
+func (adapter *InstrumentedStoreAdapter) Create(node storeadapter.StoreNode) error {
+	return adapter.once(func() (storeadapter.StoreNode, error) {
+		return storeadapter.StoreNode{}, adapter.StoreAdapter.Create(node)
+	}).err
+}
+
+func (adapter *InstrumentedStoreAdapter) Update(node storeadapter.StoreNode) error {
+	return adapter.writeWithRetries(func() (storeadapter.StoreNode, error) {
+		return storeadapter.StoreNode{}, adapter.StoreAdapter.Update(node)
+	}).err
+}
+
+func (adapter *InstrumentedStoreAdapter) CompareAndSwap(oldNode storeadapter.StoreNode, newNode storeadapter.StoreNode) error {
+	return adapter.once(func() (storeadapter.StoreNode, error) {
+		return storeadapter.StoreNode{}, adapter.StoreAdapter.CompareAndSwap(oldNode, newNode)
+	}).err
+}
+
+func (adapter *InstrumentedStoreAdapter) CompareAndSwapByIndex(prevIndex uint64, newNode storeadapter.StoreNode) error {
+	return adapter.once(func() (storeadapter.StoreNode, error) {
+		return storeadapter.StoreNode{}, adapter.StoreAdapter.CompareAndSwapByIndex(prevIndex, newNode)
+	}).err
+}
+
+func (adapter *InstrumentedStoreAdapter) SetMulti(nodes []storeadapter.StoreNode) error {
+	return adapter.writeWithRetries(func() (storeadapter.StoreNode, error) {
+		return storeadapter.StoreNode{}, adapter.StoreAdapter.SetMulti(nodes)
+	}).err
+}
+
+func (adapter *InstrumentedStoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	response := adapter.withRetries(func() (storeadapter.StoreNode, error) {
+		return adapter.StoreAdapter.Get(key)
+	})
+	return response.node, response.err
+}
+
+func (adapter *InstrumentedStoreAdapter) ListRecursively(key string) (storeadapter.StoreNode, error) {
+	response := adapter.withRetries(func() (storeadapter.StoreNode, error) {
+		return adapter.StoreAdapter.ListRecursively(key)
+	})
+	return response.node, response.err
+}
+
+func (adapter *InstrumentedStoreAdapter) Delete(keys ...string) error {
+	return adapter.writeWithRetries(func() (storeadapter.StoreNode, error) {
+		return storeadapter.StoreNode{}, adapter.StoreAdapter.Delete(keys...)
+	}).err
+}
+
+func (adapter *InstrumentedStoreAdapter) DeleteLeaves(keys ...string) error {
+	return adapter.writeWithRetries(func() (storeadapter.StoreNode, error) {
+		return storeadapter.StoreNode{}, adapter.StoreAdapter.DeleteLeaves(keys...)
+	}).err
+}
+
+func (adapter *InstrumentedStoreAdapter) CompareAndDelete(nodes ...storeadapter.StoreNode) error {
+	return adapter.once(func() (storeadapter.StoreNode, error) {
+		return storeadapter.StoreNode{}, adapter.StoreAdapter.CompareAndDelete(nodes...)
+	}).err
+}
+
+func (adapter *InstrumentedStoreAdapter) CompareAndDeleteByIndex(nodes ...storeadapter.StoreNode) error {
+	return adapter.once(func() (storeadapter.StoreNode, error) {
+		return storeadapter.StoreNode{}, adapter.StoreAdapter.CompareAndDeleteByIndex(nodes...)
+	}).err
+}
+
+func (adapter *InstrumentedStoreAdapter) UpdateDirTTL(key string, ttl uint64) error {
+	return adapter.writeWithRetries(func() (storeadapter.StoreNode, error) {
+		return storeadapter.StoreNode{}, adapter.StoreAdapter.UpdateDirTTL(key, ttl)
+	}).err
+}
+
+type storeRequest func() (storeadapter.StoreNode, error)
+
+type storeResponse struct {
+	node storeadapter.StoreNode
+	err  error
+}
+
+func (adapter *InstrumentedStoreAdapter) once(request storeRequest) storeResponse {
+	start := time.Now()
+	response := adapter.withTimeout(request)
+	adapter.record(time.Since(start), 0, response.err)
+	return categorized(response)
+}
+
+func (adapter *InstrumentedStoreAdapter) withRetries(request storeRequest) storeResponse {
+	return adapter.retried(request, true)
+}
+
+func (adapter *InstrumentedStoreAdapter) writeWithRetries(request storeRequest) storeResponse {
+	return adapter.retried(request, false)
+}
+
+func (adapter *InstrumentedStoreAdapter) retried(request storeRequest, retryTimeouts bool) storeResponse {
+	start := time.Now()
+	delay := adapter.retryDelay
+
+	response := adapter.withTimeout(request)
+	retries := 0
+	for retries < adapter.retries && response.err != nil && !dataErrors[response.err] {
+		if response.err == storeadapter.ErrorTimeout && !retryTimeouts {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+		retries++
+		response = adapter.withTimeout(request)
+	}
+
+	adapter.record(time.Since(start), retries, response.err)
+	return categorized(response)
+}
+
+func categorized(response storeResponse) storeResponse {
+	if response.err != nil && response.err != storeadapter.ErrorTimeout && !dataErrors[response.err] {
+		response.err = errorcategory.New(errorcategory.StoreUnavailable, response.err)
+	}
+	return response
+}
+
+func (adapter *InstrumentedStoreAdapter) withTimeout(request storeRequest) storeResponse {
+	if adapter.timeout <= 0 {
+		node, err := request()
+		return storeResponse{node, err}
+	}
+
+	result := make(chan storeResponse, 1)
+	go func() {
+		node, err := request()
+		result <- storeResponse{node, err}
+	}()
+
+	select {
+	case response := <-result:
+		return response
+	case <-time.After(adapter.timeout):
+		return storeResponse{err: storeadapter.ErrorTimeout}
+	}
+}
+
+func (adapter *InstrumentedStoreAdapter) record(latency time.Duration, retries int, err error) {
+	adapter.lock.Lock()
+	defer adapter.lock.Unlock()
+
+	adapter.stats.Requests++
+	adapter.stats.Retries += retries
+	adapter.stats.TotalLatency += latency
+	if err != nil && !dataErrors[err] {
+		adapter.stats.Errors++
+	}
+}
@@ -0,0 +1,144 @@
+package instrumentedstoreadapter_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
+	. "github.com/cloudfoundry/hm9000/helpers/instrumentedstoreadapter"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type slowStoreAdapter struct {
+	*fakestoreadapter.FakeStoreAdapter
+	delay time.Duration
+}
+
+func (adapter *slowStoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	time.Sleep(adapter.delay)
+	return adapter.FakeStoreAdapter.Get(key)
+}
+
+func (adapter *slowStoreAdapter) Delete(keys ...string) error {
+	time.Sleep(adapter.delay)
+	return adapter.FakeStoreAdapter.Delete(keys...)
+}
+
+var _ = Describe("InstrumentedStoreAdapter", func() {
+	var (
+		fakeAdapter *fakestoreadapter.FakeStoreAdapter
+		adapter     *InstrumentedStoreAdapter
+		failure     error
+	)
+
+	BeforeEach(func() {
+		fakeAdapter = fakestoreadapter.New()
+		fakeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/foo", Value: []byte("bar")}})
+		failure = errors.New("connection refused")
+		adapter = New(fakeAdapter, time.Second, 2, time.Millisecond)
+	})
+
+	It("passes requests through and counts them", func() {
+		node, err := adapter.Get("/foo")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.Value).Should(Equal([]byte("bar")))
+
+		err = adapter.SetMulti([]storeadapter.StoreNode{{Key: "/baz", Value: []byte("qux")}})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		stats := adapter.CollectStats()
+		Ω(stats.Requests).Should(Equal(2))
+		Ω(stats.Errors).Should(BeZero())
+		Ω(stats.Retries).Should(BeZero())
+		Ω(stats.TotalLatency).Should(BeNumerically(">", 0))
+	})
+
+	It("resets the stats once they are collected", func() {
+		adapter.Get("/foo")
+		adapter.CollectStats()
+		Ω(adapter.CollectStats()).Should(Equal(Stats{}))
+	})
+
+	It("neither retries nor counts errors that describe the data", func() {
+		_, err := adapter.Get("/missing")
+		Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+
+		stats := adapter.CollectStats()
+		Ω(stats.Requests).Should(Equal(1))
+		Ω(stats.Errors).Should(BeZero())
+		Ω(stats.Retries).Should(BeZero())
+	})
+
+	Context("when idempotent requests fail", func() {
+		BeforeEach(func() {
+			fakeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("foo", failure)
+		})
+
+		It("retries them and reports the last error", func() {
+			_, err := adapter.Get("/foo")
+			Ω(err).Should(Equal(errorcategory.New(errorcategory.StoreUnavailable, failure)))
+
+			stats := adapter.CollectStats()
+			Ω(stats.Requests).Should(Equal(1))
+			Ω(stats.Errors).Should(Equal(1))
+			Ω(stats.Retries).Should(Equal(2))
+		})
+	})
+
+	Context("when non-idempotent requests fail", func() {
+		BeforeEach(func() {
+			fakeAdapter.CreateErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("new", failure)
+		})
+
+		It("does not retry them", func() {
+			err := adapter.Create(storeadapter.StoreNode{Key: "/new", Value: []byte("value")})
+			Ω(err).Should(Equal(errorcategory.New(errorcategory.StoreUnavailable, failure)))
+
+			stats := adapter.CollectStats()
+			Ω(stats.Errors).Should(Equal(1))
+			Ω(stats.Retries).Should(BeZero())
+		})
+	})
+
+	Context("when a request takes longer than the timeout", func() {
+		BeforeEach(func() {
+			slowAdapter := &slowStoreAdapter{FakeStoreAdapter: fakeAdapter, delay: 50 * time.Millisecond}
+			adapter = New(slowAdapter, 10*time.Millisecond, 0, time.Millisecond)
+		})
+
+		It("gives up on it", func() {
+			_, err := adapter.Get("/foo")
+			Ω(err).Should(Equal(storeadapter.ErrorTimeout))
+			Ω(adapter.CollectStats().Errors).Should(Equal(1))
+		})
+
+		Context("with retries", func() {
+			BeforeEach(func() {
+				slowAdapter := &slowStoreAdapter{FakeStoreAdapter: fakeAdapter, delay: 50 * time.Millisecond}
+				adapter = New(slowAdapter, 10*time.Millisecond, 2, time.Millisecond)
+			})
+
+			It("retries reads", func() {
+				_, err := adapter.Get("/foo")
+				Ω(err).Should(Equal(storeadapter.ErrorTimeout))
+				Ω(adapter.CollectStats().Retries).Should(Equal(2))
+			})
+
+			It("does not retry writes, which may yet land", func() {
+				err := adapter.Delete("/foo")
+				Ω(err).Should(Equal(storeadapter.ErrorTimeout))
+				Ω(adapter.CollectStats().Retries).Should(BeZero())
+			})
+		})
+	})
+
+	Describe("Stats", func() {
+		It("computes the mean latency", func() {
+			Ω(Stats{Requests: 4, TotalLatency: time.Second}.MeanLatency()).Should(Equal(250 * time.Millisecond))
+			Ω(Stats{}.MeanLatency()).Should(BeZero())
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package instrumentedstoreadapter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestInstrumentedStoreAdapter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "InstrumentedStoreAdapter Suite")
+}
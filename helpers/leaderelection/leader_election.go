@@ -0,0 +1,202 @@
+package leaderelection
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+const LeaderElectionTimer = "LeaderElection"
+
+// LockKey is the key of a component's lock, which is also the lease the
+// component's leader holds.
+func LockKey(component string) string {
+	return "/hm/locks/" + component
+}
+
+// Election campaigns for leadership of a component among every process that
+// runs it.  The leader holds a lease: a key, with a TTL, whose value is the
+// leader's candidate name.  The leader refreshes the lease every third of
+// the TTL; everyone else tries to take the key on the same schedule, so a
+// leader that dies (or cannot reach the store) is replaced within one TTL
+// of its last refresh.
+//
+// A leader that fails to refresh its lease steps down at once rather than
+// wait for the key to expire, so two processes never both believe they
+// lead.  onElected, if given, is called each time this process becomes the
+// leader.
+type Election struct {
+	adapter      storeadapter.StoreAdapter
+	key          string
+	candidate    string
+	ttl          uint64
+	timeProvider timeprovider.TimeProvider
+	logger       logger.Logger
+	onElected    func()
+
+	leader bool
+	stop   chan bool
+	lock   *sync.Mutex
+}
+
+func New(adapter storeadapter.StoreAdapter, key string, candidate string, ttl time.Duration, timeProvider timeprovider.TimeProvider, logger logger.Logger, onElected func()) *Election {
+	ttlInSeconds := uint64(ttl.Seconds())
+	if ttlInSeconds < 1 {
+		ttlInSeconds = 1
+	}
+
+	return &Election{
+		adapter:      adapter,
+		key:          key,
+		candidate:    candidate,
+		ttl:          ttlInSeconds,
+		timeProvider: timeProvider,
+		logger:       logger,
+		onElected:    onElected,
+		lock:         &sync.Mutex{},
+	}
+}
+
+// Leader returns the candidate name of whoever holds the lease at key, or
+// storeadapter.ErrorKeyNotFound if nobody does.
+func Leader(adapter storeadapter.StoreAdapter, key string) (string, error) {
+	node, err := adapter.Get(key)
+	if err != nil {
+		return "", err
+	}
+	return string(node.Value), nil
+}
+
+// RefreshInterval is how often a started election campaigns.
+func (election *Election) RefreshInterval() time.Duration {
+	interval := time.Duration(election.ttl) * time.Second / 3
+	if interval < time.Second {
+		return time.Second
+	}
+	return interval
+}
+
+// Start campaigns straight away and then keeps campaigning in the
+// background.  Starting a running election does nothing.
+func (election *Election) Start() {
+	election.lock.Lock()
+	if election.stop != nil {
+		election.lock.Unlock()
+		return
+	}
+	stop := make(chan bool)
+	election.stop = stop
+	election.lock.Unlock()
+
+	ticker := election.timeProvider.NewTickerChannel(LeaderElectionTimer, election.RefreshInterval())
+	election.Campaign()
+
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker:
+				election.Campaign()
+			}
+		}
+	}()
+}
+
+// Stop stops campaigning and, if this process is the leader, gives up the
+// lease so that another candidate can take over without waiting for it to
+// expire.
+func (election *Election) Stop() {
+	election.lock.Lock()
+	if election.stop != nil {
+		close(election.stop)
+		election.stop = nil
+	}
+	wasLeader := election.leader
+	election.leader = false
+	election.lock.Unlock()
+
+	if wasLeader {
+		err := election.adapter.CompareAndDelete(election.lease())
+		if err != nil {
+			election.logger.Error("Failed to give up leadership", err, election.details())
+			return
+		}
+		election.logger.Info("Gave up leadership", election.details())
+	}
+}
+
+func (election *Election) IsLeader() bool {
+	election.lock.Lock()
+	defer election.lock.Unlock()
+	return election.leader
+}
+
+// Campaign refreshes the lease if this process holds it and tries to take it
+// otherwise.
+func (election *Election) Campaign() {
+	if election.IsLeader() {
+		err := election.adapter.CompareAndSwap(election.lease(), election.lease())
+		if err != nil {
+			election.setLeader(false)
+			election.logger.Error("Lost leadership: failed to refresh the lease", err, election.details())
+		}
+		return
+	}
+
+	err := election.adapter.Create(election.lease())
+	if err == storeadapter.ErrorKeyExists {
+		err = election.reclaim()
+		if err == storeadapter.ErrorKeyComparisonFailed {
+			return
+		}
+	}
+	if err != nil {
+		election.logger.Error("Failed to campaign for leadership", err, election.details())
+		return
+	}
+
+	election.setLeader(true)
+	election.logger.Info("Became the leader", election.details())
+	if election.onElected != nil {
+		election.onElected()
+	}
+}
+
+// reclaim takes back a lease that still names this candidate, e.g. after a
+// refresh failed on a store hiccup that did not keep the lease from being
+// written.
+func (election *Election) reclaim() error {
+	current, err := Leader(election.adapter, election.key)
+	if err != nil {
+		return err
+	}
+	if current != election.candidate {
+		return storeadapter.ErrorKeyComparisonFailed
+	}
+	return election.adapter.CompareAndSwap(election.lease(), election.lease())
+}
+
+func (election *Election) setLeader(leader bool) {
+	election.lock.Lock()
+	defer election.lock.Unlock()
+	election.leader = leader
+}
+
+func (election *Election) lease() storeadapter.StoreNode {
+	return storeadapter.StoreNode{
+		Key:   election.key,
+		Value: []byte(election.candidate),
+		TTL:   election.ttl,
+	}
+}
+
+func (election *Election) details() map[string]string {
+	return map[string]string{
+		"Key":       election.key,
+		"Candidate": election.candidate,
+	}
+}
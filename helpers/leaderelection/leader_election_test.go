@@ -0,0 +1,143 @@
+package leaderelection_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	. "github.com/cloudfoundry/hm9000/helpers/leaderelection"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Election", func() {
+	const key = "/hm/locks/Analyzer"
+
+	var (
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		timeProvider *faketimeprovider.FakeTimeProvider
+		election     *Election
+		elections    int
+	)
+
+	newElection := func(candidate string) *Election {
+		return New(storeAdapter, key, candidate, 9*time.Second, timeProvider, fakelogger.NewFakeLogger(), func() {
+			elections++
+		})
+	}
+
+	BeforeEach(func() {
+		storeAdapter = fakestoreadapter.New()
+		timeProvider = faketimeprovider.New(time.Unix(100, 0))
+		timeProvider.ProvideFakeChannels = true
+		elections = 0
+
+		election = newElection("node-a")
+	})
+
+	AfterEach(func() {
+		election.Stop()
+	})
+
+	It("campaigns every third of the TTL", func() {
+		Ω(election.RefreshInterval()).Should(Equal(3 * time.Second))
+
+		election.Start()
+		Ω(timeProvider.TickerDurationFor(LeaderElectionTimer)).Should(Equal(3 * time.Second))
+	})
+
+	Context("when nobody holds the lease", func() {
+		It("takes it", func() {
+			election.Campaign()
+
+			Ω(election.IsLeader()).Should(BeTrue())
+			Ω(elections).Should(Equal(1))
+
+			node, err := storeAdapter.Get(key)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(node.Value)).Should(Equal("node-a"))
+			Ω(node.TTL).Should(BeNumerically("==", 9))
+
+			Ω(Leader(storeAdapter, key)).Should(Equal("node-a"))
+		})
+	})
+
+	Context("when another candidate holds the lease", func() {
+		BeforeEach(func() {
+			newElection("node-b").Campaign()
+		})
+
+		It("follows", func() {
+			election.Campaign()
+			Ω(election.IsLeader()).Should(BeFalse())
+			Ω(Leader(storeAdapter, key)).Should(Equal("node-b"))
+		})
+
+		It("takes over once the lease expires", func() {
+			election.Campaign()
+			Ω(election.IsLeader()).Should(BeFalse())
+
+			storeAdapter.Delete(key)
+			election.Campaign()
+			Ω(election.IsLeader()).Should(BeTrue())
+			Ω(Leader(storeAdapter, key)).Should(Equal("node-a"))
+		})
+	})
+
+	Context("when it is the leader", func() {
+		BeforeEach(func() {
+			election.Campaign()
+			Ω(election.IsLeader()).Should(BeTrue())
+		})
+
+		It("stays the leader while it can refresh the lease", func() {
+			election.Campaign()
+			election.Campaign()
+			Ω(election.IsLeader()).Should(BeTrue())
+			Ω(elections).Should(Equal(1))
+		})
+
+		It("steps down when somebody else has taken the lease", func() {
+			storeAdapter.Delete(key)
+			newElection("node-b").Campaign()
+
+			election.Campaign()
+			Ω(election.IsLeader()).Should(BeFalse())
+		})
+
+		It("reclaims a lease that still names it", func() {
+			storeAdapter.Delete(key)
+			election.Campaign()
+			Ω(election.IsLeader()).Should(BeFalse())
+
+			storeAdapter.Create(storeadapter.StoreNode{Key: key, Value: []byte("node-a"), TTL: 9})
+			election.Campaign()
+			Ω(election.IsLeader()).Should(BeTrue())
+		})
+
+		It("gives up the lease when stopped", func() {
+			election.Stop()
+			Ω(election.IsLeader()).Should(BeFalse())
+
+			_, err := storeAdapter.Get(key)
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+	})
+
+	It("campaigns when it starts, and again on every tick", func() {
+		other := newElection("node-b")
+		other.Campaign()
+
+		election.Start()
+		Ω(election.IsLeader()).Should(BeFalse())
+
+		other.Stop()
+		ticker := timeProvider.TickerChannelFor(LeaderElectionTimer)
+		ticker <- time.Now()
+		// the second tick is only received once the first campaign is done
+		ticker <- time.Now()
+		Ω(election.IsLeader()).Should(BeTrue())
+	})
+})
@@ -0,0 +1,141 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/gosteno"
+	"github.com/cloudfoundry/gunk/timeprovider"
+)
+
+// RotatingFileSink appends records, one per line, to a file, and rotates
+// the file when it would grow past maxSize bytes or has been written for
+// longer than maxAge.  The rotated files are path.1 (the newest) to
+// path.<maxBackups>; older ones are deleted.  A maxSize or maxAge of 0 is no
+// limit.
+//
+// Each record is written straight to the file, so nothing is lost if the
+// process dies.
+type RotatingFileSink struct {
+	path         string
+	maxSize      int64
+	maxAge       time.Duration
+	maxBackups   int
+	timeProvider timeprovider.TimeProvider
+
+	file   *os.File
+	size   int64
+	opened time.Time
+	codec  gosteno.Codec
+
+	sync.Mutex
+}
+
+// NewRotatingFileSink opens path for appending, creating it if need be.
+func NewRotatingFileSink(path string, maxSize int64, maxAge time.Duration, maxBackups int, timeProvider timeprovider.TimeProvider) (*RotatingFileSink, error) {
+	sink := &RotatingFileSink{
+		path:         path,
+		maxSize:      maxSize,
+		maxAge:       maxAge,
+		maxBackups:   maxBackups,
+		timeProvider: timeProvider,
+	}
+
+	err := sink.open()
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (s *RotatingFileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+	s.opened = s.timeProvider.Time()
+	return nil
+}
+
+func (s *RotatingFileSink) AddRecord(record *gosteno.Record) {
+	bytes, _ := s.codec.EncodeRecord(record)
+	line := append(bytes, '\n')
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.file == nil || s.needsRotation(int64(len(line))) {
+		if s.rotate() != nil {
+			return
+		}
+	}
+
+	n, _ := s.file.Write(line)
+	s.size += int64(n)
+}
+
+func (s *RotatingFileSink) needsRotation(length int64) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.maxSize > 0 && s.size+length > s.maxSize {
+		return true
+	}
+	if s.maxAge > 0 && s.timeProvider.Time().Sub(s.opened) >= s.maxAge {
+		return true
+	}
+	return false
+}
+
+// rotate moves the file to path.1, shifting the older backups along, and
+// opens a new one.
+func (s *RotatingFileSink) rotate() error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+
+	if s.maxBackups <= 0 {
+		os.Remove(s.path)
+	} else {
+		os.Remove(s.backup(s.maxBackups))
+		for i := s.maxBackups - 1; i >= 1; i-- {
+			os.Rename(s.backup(i), s.backup(i+1))
+		}
+		os.Rename(s.path, s.backup(1))
+	}
+
+	return s.open()
+}
+
+func (s *RotatingFileSink) backup(i int) string {
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
+
+func (s *RotatingFileSink) Flush() {
+}
+
+func (s *RotatingFileSink) SetCodec(codec gosteno.Codec) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.codec = codec
+}
+
+func (s *RotatingFileSink) GetCodec() gosteno.Codec {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.codec
+}
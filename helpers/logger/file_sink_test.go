@@ -0,0 +1,107 @@
+package logger_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/gosteno"
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	. "github.com/cloudfoundry/hm9000/helpers/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RotatingFileSink", func() {
+	var (
+		dir          string
+		path         string
+		timeProvider *faketimeprovider.FakeTimeProvider
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "file_sink")
+		Ω(err).ShouldNot(HaveOccurred())
+		path = filepath.Join(dir, "hm9000.log")
+		timeProvider = &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	newSink := func(maxSize int64, maxAge time.Duration, maxBackups int) *RotatingFileSink {
+		sink, err := NewRotatingFileSink(path, maxSize, maxAge, maxBackups, timeProvider)
+		Ω(err).ShouldNot(HaveOccurred())
+		sink.SetCodec(gosteno.NewJsonCodec())
+		return sink
+	}
+
+	log := func(sink *RotatingFileSink, message string) {
+		sink.AddRecord(&gosteno.Record{Level: gosteno.LOG_INFO, Message: message})
+	}
+
+	lines := func(path string) []string {
+		contents, err := ioutil.ReadFile(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		return strings.Split(strings.TrimSpace(string(contents)), "\n")
+	}
+
+	It("appends a line for each record", func() {
+		Ω(ioutil.WriteFile(path, []byte("earlier\n"), 0644)).Should(Succeed())
+
+		sink := newSink(0, 0, 0)
+		log(sink, "one")
+		log(sink, "two")
+
+		written := lines(path)
+		Ω(written).Should(HaveLen(3))
+		Ω(written[0]).Should(Equal("earlier"))
+		Ω(written[2]).Should(ContainSubstring(`"message":"two"`))
+	})
+
+	It("rotates the file before it grows past the maximum size, keeping max backups", func() {
+		sink := newSink(150, 0, 2)
+		for _, message := range []string{"one", "two", "three", "four"} {
+			log(sink, message)
+		}
+
+		Ω(lines(path)).Should(HaveLen(1))
+		Ω(lines(path)[0]).Should(ContainSubstring(`"message":"four"`))
+		Ω(lines(path + ".1")[0]).Should(ContainSubstring(`"message":"three"`))
+		Ω(lines(path + ".2")[0]).Should(ContainSubstring(`"message":"two"`))
+		_, err := os.Stat(path + ".3")
+		Ω(os.IsNotExist(err)).Should(BeTrue())
+	})
+
+	It("rotates the file once it is older than the maximum age", func() {
+		sink := newSink(0, time.Hour, 1)
+		log(sink, "one")
+		timeProvider.IncrementBySeconds(1800)
+		log(sink, "two")
+		timeProvider.IncrementBySeconds(1800)
+		log(sink, "three")
+
+		Ω(lines(path)).Should(HaveLen(1))
+		Ω(lines(path + ".1")).Should(HaveLen(2))
+	})
+
+	It("keeps no backups when max backups is 0", func() {
+		sink := newSink(150, 0, 0)
+		log(sink, "one")
+		log(sink, "two")
+
+		Ω(lines(path)).Should(HaveLen(1))
+		entries, err := ioutil.ReadDir(dir)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(entries).Should(HaveLen(1))
+	})
+
+	It("fails when the file cannot be opened", func() {
+		_, err := NewRotatingFileSink(filepath.Join(dir, "missing", "hm9000.log"), 0, 0, 0, timeProvider)
+		Ω(err).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry/gosteno"
+)
+
+type level struct {
+	configured gosteno.LogLevel
+	current    gosteno.LogLevel
+	lock       *sync.Mutex
+}
+
+func (l *level) get() gosteno.LogLevel {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.current
+}
+
+func (l *level) set(current gosteno.LogLevel) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.current = current
+}
+
+func (l *level) reset() {
+	l.set(l.configured)
+}
+
+var levels = map[string]*level{}
+var levelsLock = &sync.Mutex{}
+
+// registerLevel returns the level of component, configuring it.  Loggers of
+// the same component share their level.
+func registerLevel(component string, configured gosteno.LogLevel) *level {
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+
+	l, ok := levels[component]
+	if !ok {
+		l = &level{lock: &sync.Mutex{}}
+		levels[component] = l
+	}
+	l.configured = configured
+	l.set(configured)
+	return l
+}
+
+// ParseLevel parses the name of a gosteno level, in any case: for example
+// "info", "DEBUG" or "debug2".
+func ParseLevel(name string) (gosteno.LogLevel, error) {
+	return gosteno.GetLogLevel(strings.ToLower(name))
+}
+
+// Levels are the current levels of every component in the process.
+func Levels() map[string]string {
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+
+	current := map[string]string{}
+	for component, l := range levels {
+		current[component] = l.get().Name
+	}
+	return current
+}
+
+// SetLevel changes the level of component, or of every component if
+// component is empty, until ResetLevels is called or the process restarts.
+func SetLevel(component string, name string) error {
+	newLevel, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+
+	if component == "" {
+		for _, l := range levels {
+			l.set(newLevel)
+		}
+		return nil
+	}
+
+	l, ok := levels[component]
+	if !ok {
+		return fmt.Errorf("No component %q is logging in this process", component)
+	}
+	l.set(newLevel)
+	return nil
+}
+
+// ResetLevels puts every component back to its configured level.
+func ResetLevels() {
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+
+	for _, l := range levels {
+		l.reset()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/cloudfoundry/gosteno"
+	"github.com/nu7hatch/gouuid"
 )
 
 type Logger interface {
@@ -12,26 +13,107 @@ type Logger interface {
 	Error(subject string, err error, messages ...map[string]string)
 }
 
+// The formats of a log line.  Both are gosteno records, with the time, pid,
+// source and level.  In the JSON format the record's message is the subject
+// and everything else (the details, the error, the component and the
+// session) is a field of its data, which is what log indexers want.  The
+// legacy format appends the error and the details, as JSON, to the message.
+const (
+	FormatJSON   = "json"
+	FormatLegacy = "legacy"
+)
+
+// Session identifies this run of the process in every line it logs, so that
+// the lines of one run can be told from those of a restart.
+var Session = newSession()
+
+func newSession() string {
+	u, err := uuid.NewV4()
+	if err != nil {
+		return "unknown"
+	}
+	return u.String()
+}
+
 type RealLogger struct {
-	steno *gosteno.Logger
+	steno     *gosteno.Logger
+	component string
+	format    string
+}
+
+// New logs for component as vcap.hm9000.<component>, to the sinks gosteno
+// was initialized with, at level.  The level is registered under the
+// component, so that it can be changed while the process runs (see
+// SetLevel); gosteno should be initialized with LOG_ALL and leave the
+// filtering to this.
+func New(component string, level gosteno.LogLevel, format string) *RealLogger {
+	return newRealLogger(component, level, format, gosteno.NewLogger("vcap.hm9000."+component).L)
 }
 
-func NewRealLogger(steno *gosteno.Logger) *RealLogger {
+// NewWithSinks is New, but logs to sinks rather than to the ones gosteno was
+// initialized with, so components in one process can log to different
+// places.  Sinks without a codec are given gosteno's JSON codec.
+func NewWithSinks(component string, level gosteno.LogLevel, format string, sinks []gosteno.Sink) *RealLogger {
+	for _, sink := range sinks {
+		if sink.GetCodec() == nil {
+			sink.SetCodec(gosteno.NewJsonCodec())
+		}
+	}
+	return newRealLogger(component, level, format, &sinkL{name: "vcap.hm9000." + component, sinks: sinks})
+}
+
+func newRealLogger(component string, level gosteno.LogLevel, format string, base gosteno.L) *RealLogger {
 	return &RealLogger{
-		steno: steno,
+		steno:     &gosteno.Logger{L: &levelledL{L: base, level: registerLevel(component, level)}},
+		component: component,
+		format:    format,
 	}
 }
 
+// Steno is the gosteno logger underneath, for libraries that want one.  It
+// logs at the component's level.
+func (logger *RealLogger) Steno() *gosteno.Logger {
+	return logger.steno
+}
+
 func (logger *RealLogger) Debug(subject string, messages ...map[string]string) {
-	logger.steno.Debug(subject + logger.parseMessages(messages))
+	logger.log(gosteno.LOG_DEBUG, subject, nil, messages)
 }
 
 func (logger *RealLogger) Info(subject string, messages ...map[string]string) {
-	logger.steno.Info(subject + logger.parseMessages(messages))
+	logger.log(gosteno.LOG_INFO, subject, nil, messages)
 }
 
 func (logger *RealLogger) Error(subject string, err error, messages ...map[string]string) {
-	logger.steno.Error(subject + " - Error:" + err.Error() + logger.parseMessages(messages))
+	logger.log(gosteno.LOG_ERROR, subject, err, messages)
+}
+
+func (logger *RealLogger) log(level gosteno.LogLevel, subject string, err error, messages []map[string]string) {
+	if logger.steno.Level().Priority < level.Priority {
+		return
+	}
+
+	if logger.format == FormatLegacy {
+		if err != nil {
+			subject += " - Error:" + err.Error()
+		}
+		logger.steno.Log(level, subject+logger.parseMessages(messages), nil)
+		return
+	}
+
+	data := map[string]interface{}{}
+	for _, message := range messages {
+		for key, value := range message {
+			data[key] = value
+		}
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	data["component"] = logger.component
+	data["session"] = Session
+
+	logger.steno.Log(level, subject, data)
 }
 
 func (logger *RealLogger) parseMessages(messages []map[string]string) string {
@@ -43,3 +125,38 @@ func (logger *RealLogger) parseMessages(messages []map[string]string) string {
 
 	return messageString
 }
+
+// levelledL filters a gosteno logger by a level that may change.
+type levelledL struct {
+	gosteno.L
+	level *level
+}
+
+func (l *levelledL) Level() gosteno.LogLevel {
+	return l.level.get()
+}
+
+func (l *levelledL) Log(x gosteno.LogLevel, m string, d map[string]interface{}) {
+	if l.Level().Priority < x.Priority {
+		return
+	}
+	l.L.Log(x, m, d)
+}
+
+// sinkL writes records straight to its sinks, as gosteno's own loggers do.
+type sinkL struct {
+	name  string
+	sinks []gosteno.Sink
+}
+
+func (l *sinkL) Level() gosteno.LogLevel {
+	return gosteno.LOG_ALL
+}
+
+func (l *sinkL) Log(x gosteno.LogLevel, m string, d map[string]interface{}) {
+	record := gosteno.NewRecord(l.name, x, m, d)
+	for _, sink := range l.sinks {
+		sink.AddRecord(record)
+		sink.Flush()
+	}
+}
@@ -0,0 +1,98 @@
+package logger_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/gosteno"
+	. "github.com/cloudfoundry/hm9000/helpers/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logger", func() {
+	var sink *gosteno.TestingSink
+
+	BeforeEach(func() {
+		gosteno.EnterTestMode(gosteno.LOG_ALL)
+		sink = gosteno.GetMeTheGlobalTestSink()
+	})
+
+	AfterEach(func() {
+		ResetLevels()
+	})
+
+	Describe("the JSON format", func() {
+		It("logs the subject as the message and the details, error, component and session as data", func() {
+			logger := New("analyzer", gosteno.LOG_INFO, FormatJSON)
+			logger.Error("Failed to save", errors.New("timeout"), map[string]string{"App Guid": "abc"}, map[string]string{"Index": "2"})
+
+			Ω(sink.Records()).Should(HaveLen(1))
+			record := sink.Records()[0]
+			Ω(record.Source).Should(Equal("vcap.hm9000.analyzer"))
+			Ω(record.Level).Should(Equal(gosteno.LOG_ERROR))
+			Ω(record.Message).Should(Equal("Failed to save"))
+			Ω(record.Data).Should(Equal(map[string]interface{}{
+				"App Guid":  "abc",
+				"Index":     "2",
+				"error":     "timeout",
+				"component": "analyzer",
+				"session":   Session,
+			}))
+		})
+	})
+
+	Describe("the legacy format", func() {
+		It("appends the error and details to the message", func() {
+			logger := New("analyzer", gosteno.LOG_INFO, FormatLegacy)
+			logger.Error("Failed to save", errors.New("timeout"), map[string]string{"App Guid": "abc"})
+
+			Ω(sink.Records()).Should(HaveLen(1))
+			Ω(sink.Records()[0].Message).Should(Equal(`Failed to save - Error:timeout - {"App Guid":"abc"}`))
+			Ω(sink.Records()[0].Data).Should(BeNil())
+		})
+	})
+
+	Describe("levels", func() {
+		It("drops lines below the component's level", func() {
+			logger := New("sender", gosteno.LOG_INFO, FormatJSON)
+			logger.Debug("hidden")
+			logger.Info("shown")
+
+			Ω(sink.Records()).Should(HaveLen(1))
+			Ω(sink.Records()[0].Message).Should(Equal("shown"))
+		})
+
+		It("applies the level to the gosteno logger underneath", func() {
+			logger := New("sender", gosteno.LOG_INFO, FormatJSON)
+			logger.Steno().Debug("hidden")
+			logger.Steno().Info("shown")
+
+			Ω(sink.Records()).Should(HaveLen(1))
+		})
+
+		It("can be changed for one component, or all, and reset", func() {
+			analyzer := New("analyzer", gosteno.LOG_INFO, FormatJSON)
+			New("sender", gosteno.LOG_ERROR, FormatJSON)
+
+			Ω(SetLevel("analyzer", "DEBUG")).Should(Succeed())
+			Ω(Levels()).Should(HaveKeyWithValue("analyzer", "debug"))
+			Ω(Levels()).Should(HaveKeyWithValue("sender", "error"))
+			analyzer.Debug("shown")
+			Ω(sink.Records()).Should(HaveLen(1))
+
+			Ω(SetLevel("", "warn")).Should(Succeed())
+			Ω(Levels()).Should(HaveKeyWithValue("analyzer", "warn"))
+			Ω(Levels()).Should(HaveKeyWithValue("sender", "warn"))
+
+			ResetLevels()
+			Ω(Levels()).Should(HaveKeyWithValue("analyzer", "info"))
+			Ω(Levels()).Should(HaveKeyWithValue("sender", "error"))
+		})
+
+		It("rejects unknown levels and components", func() {
+			New("analyzer", gosteno.LOG_INFO, FormatJSON)
+			Ω(SetLevel("analyzer", "LOUD")).ShouldNot(Succeed())
+			Ω(SetLevel("nobody", "debug")).ShouldNot(Succeed())
+		})
+	})
+})
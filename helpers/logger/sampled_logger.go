@@ -0,0 +1,121 @@
+package logger
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+)
+
+// SampledLogger keeps storms of identical lines (a "Received a heartbeat"
+// for every DEA, or the same store error from every request during an
+// outage) from burying everything else.  It passes on the first burst lines
+// with each level and subject in every interval, and drops the rest.  The
+// number dropped is reported, as "Dropped", on the next line with that
+// level and subject that is passed on, or else by Flush.
+type SampledLogger struct {
+	logger       Logger
+	burst        int
+	interval     time.Duration
+	timeProvider timeprovider.TimeProvider
+
+	windows map[sampleKey]*sampleWindow
+	lock    *sync.Mutex
+}
+
+type sampleKey struct {
+	level   string
+	subject string
+}
+
+type sampleWindow struct {
+	start   time.Time
+	passed  int
+	dropped int
+}
+
+func NewSampledLogger(logger Logger, burst int, interval time.Duration, timeProvider timeprovider.TimeProvider) *SampledLogger {
+	return &SampledLogger{
+		logger:       logger,
+		burst:        burst,
+		interval:     interval,
+		timeProvider: timeProvider,
+		windows:      map[sampleKey]*sampleWindow{},
+		lock:         &sync.Mutex{},
+	}
+}
+
+func (logger *SampledLogger) Debug(subject string, messages ...map[string]string) {
+	if messages, ok := logger.sample("debug", subject, messages); ok {
+		logger.logger.Debug(subject, messages...)
+	}
+}
+
+func (logger *SampledLogger) Info(subject string, messages ...map[string]string) {
+	if messages, ok := logger.sample("info", subject, messages); ok {
+		logger.logger.Info(subject, messages...)
+	}
+}
+
+func (logger *SampledLogger) Error(subject string, err error, messages ...map[string]string) {
+	if messages, ok := logger.sample("error", subject, messages); ok {
+		logger.logger.Error(subject, err, messages...)
+	}
+}
+
+// sample tells whether to pass the line on and, if so, adds the number of
+// its repeats dropped since the last one passed on.
+func (logger *SampledLogger) sample(level string, subject string, messages []map[string]string) ([]map[string]string, bool) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+
+	now := logger.timeProvider.Time()
+	key := sampleKey{level: level, subject: subject}
+	window, ok := logger.windows[key]
+	if !ok {
+		window = &sampleWindow{start: now}
+		logger.windows[key] = window
+	} else if now.Sub(window.start) >= logger.interval {
+		window.start = now
+		window.passed = 0
+	}
+
+	if window.passed >= logger.burst {
+		window.dropped++
+		return messages, false
+	}
+
+	window.passed++
+	if window.dropped > 0 {
+		messages = append(messages, map[string]string{"Dropped": strconv.Itoa(window.dropped)})
+		window.dropped = 0
+	}
+	return messages, true
+}
+
+// Flush reports the lines dropped since they were last reported, one line
+// per level and subject, and forgets the intervals that are over.
+func (logger *SampledLogger) Flush() {
+	logger.lock.Lock()
+	dropped := map[sampleKey]int{}
+	now := logger.timeProvider.Time()
+	for key, window := range logger.windows {
+		if window.dropped > 0 {
+			dropped[key] = window.dropped
+			window.dropped = 0
+		}
+		if now.Sub(window.start) >= logger.interval {
+			delete(logger.windows, key)
+		}
+	}
+	logger.lock.Unlock()
+
+	for key, count := range dropped {
+		logger.logger.Info("Dropped repeated log lines", map[string]string{
+			"Level":   key.level,
+			"Subject": key.subject,
+			"Dropped": strconv.Itoa(count),
+		})
+	}
+}
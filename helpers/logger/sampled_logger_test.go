@@ -0,0 +1,76 @@
+package logger_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	. "github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SampledLogger", func() {
+	var (
+		inner        *fakelogger.FakeLogger
+		timeProvider *faketimeprovider.FakeTimeProvider
+		sampled      *SampledLogger
+	)
+
+	BeforeEach(func() {
+		inner = fakelogger.NewFakeLogger()
+		timeProvider = &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}
+		sampled = NewSampledLogger(inner, 2, time.Second, timeProvider)
+	})
+
+	It("passes on the first burst lines with a subject in each interval", func() {
+		for i := 0; i < 5; i++ {
+			sampled.Info("Received a heartbeat", map[string]string{"DEA": "a"})
+		}
+		sampled.Info("Something else")
+
+		Ω(inner.LoggedSubjects).Should(Equal([]string{"Received a heartbeat", "Received a heartbeat", "Something else"}))
+	})
+
+	It("reports the number dropped on the next line passed on", func() {
+		for i := 0; i < 5; i++ {
+			sampled.Error("Failed to save", errors.New("timeout"))
+		}
+
+		timeProvider.IncrementBySeconds(1)
+		sampled.Error("Failed to save", errors.New("timeout"), map[string]string{"Key": "/hm"})
+
+		Ω(inner.LoggedSubjects).Should(HaveLen(3))
+		Ω(inner.LoggedMessages[2]).Should(Equal(` - {"Key":"/hm"} - {"Dropped":"3"}`))
+	})
+
+	It("samples each level separately", func() {
+		for i := 0; i < 3; i++ {
+			sampled.Debug("Saving")
+			sampled.Info("Saving")
+		}
+
+		Ω(inner.LoggedSubjects).Should(HaveLen(4))
+	})
+
+	It("reports what was dropped on Flush", func() {
+		for i := 0; i < 4; i++ {
+			sampled.Info("Received a heartbeat")
+		}
+
+		sampled.Flush()
+		Ω(inner.LoggedSubjects).Should(HaveLen(3))
+		Ω(inner.LoggedSubjects[2]).Should(Equal("Dropped repeated log lines"))
+		Ω(inner.LoggedMessages[2]).Should(ContainSubstring(`"Dropped":"2"`))
+		Ω(inner.LoggedMessages[2]).Should(ContainSubstring(`"Subject":"Received a heartbeat"`))
+
+		sampled.Flush()
+		Ω(inner.LoggedSubjects).Should(HaveLen(3), "each drop is reported once")
+
+		timeProvider.IncrementBySeconds(1)
+		sampled.Info("Received a heartbeat")
+		Ω(inner.LoggedSubjects).Should(HaveLen(4))
+		Ω(inner.LoggedMessages[3]).ShouldNot(ContainSubstring("Dropped"))
+	})
+})
@@ -0,0 +1,212 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/gosteno"
+)
+
+// structuredDataID names the SD-ELEMENT that carries a record's data.  SD-IDs
+// of our own must end in @ and an IANA private enterprise number; 47450 is
+// Cloud Foundry's.
+const structuredDataID = "data@47450"
+
+// SyslogSink sends records to a remote syslog server as RFC5424 messages:
+// the record's message is the MSG and its data is a structured data element,
+// so that syslog servers can index it without parsing JSON.  Over TCP the
+// messages are framed by octet counting (RFC6587); over UDP each is a
+// datagram.
+//
+// The server is dialled when the first record is logged, and redialled when
+// a write fails.  Records that still cannot be sent are dropped: there is
+// nowhere left to report it.
+type SyslogSink struct {
+	network  string
+	address  string
+	appName  string
+	hostname string
+
+	conn  net.Conn
+	codec gosteno.Codec
+
+	sync.Mutex
+}
+
+// NewSyslogSink sends to the server at address ("host:port") over network,
+// "udp" or "tcp", with appName (e.g. vcap.hm9000.analyzer) as the APP-NAME.
+func NewSyslogSink(network string, address string, appName string) *SyslogSink {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &SyslogSink{
+		network:  network,
+		address:  address,
+		appName:  appName,
+		hostname: hostname,
+	}
+}
+
+func (s *SyslogSink) AddRecord(record *gosteno.Record) {
+	message := FormatRFC5424(record, s.hostname, s.appName)
+	if s.network == "tcp" {
+		message = fmt.Sprintf("%d %s", len(message), message)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			conn, err := net.Dial(s.network, s.address)
+			if err != nil {
+				return
+			}
+			s.conn = conn
+		}
+
+		_, err := s.conn.Write([]byte(message))
+		if err == nil {
+			return
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *SyslogSink) Flush() {
+}
+
+// SetCodec is part of gosteno.Sink.  The codec is not used: the record is
+// sent as RFC5424 fields rather than as an encoded blob.
+func (s *SyslogSink) SetCodec(codec gosteno.Codec) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.codec = codec
+}
+
+func (s *SyslogSink) GetCodec() gosteno.Codec {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.codec
+}
+
+// FormatRFC5424 formats record as an RFC5424 syslog message from hostname
+// and appName, with the user facility.  Messages longer than gosteno's
+// syslog limit are truncated.
+func FormatRFC5424(record *gosteno.Record, hostname string, appName string) string {
+	seconds := float64(record.Timestamp)
+	timestamp := time.Unix(0, int64(seconds*float64(time.Second))).UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+
+	message := record.Message
+	if len(message) > gosteno.MaxMessageSize {
+		message = message[:gosteno.MaxMessageSize-len(gosteno.TruncatePostfix)] + gosteno.TruncatePostfix
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d - %s %s",
+		8+syslogSeverity(record.Level),
+		timestamp,
+		syslogHeaderField(hostname, 255),
+		syslogHeaderField(appName, 48),
+		record.Pid,
+		structuredData(record.Data),
+		message,
+	)
+}
+
+func syslogSeverity(level gosteno.LogLevel) int {
+	switch level {
+	case gosteno.LOG_FATAL:
+		return 2
+	case gosteno.LOG_ERROR:
+		return 3
+	case gosteno.LOG_WARN:
+		return 4
+	case gosteno.LOG_INFO:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// syslogHeaderField is value as a header field: printable ASCII, without
+// spaces, at most max long, or "-" if there is nothing left.
+func syslogHeaderField(value string, max int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if len(field) > max {
+		field = field[:max]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+// structuredData is data as a single SD-ELEMENT, in key order, or "-" if
+// there is none.  Keys lose the characters SD-NAMEs cannot have (spaces
+// become underscores, as "App Guid" becomes "App_Guid"), and values are
+// escaped.
+func structuredData(data map[string]interface{}) string {
+	if len(data) == 0 {
+		return "-"
+	}
+
+	keys := []string{}
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	element := "[" + structuredDataID
+	for _, key := range keys {
+		name := strings.Map(func(r rune) rune {
+			if r == ' ' {
+				return '_'
+			}
+			if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+				return -1
+			}
+			return r
+		}, key)
+		if len(name) > 32 {
+			name = name[:32]
+		}
+		if name == "" {
+			continue
+		}
+
+		element += fmt.Sprintf(` %s="%s"`, name, escapeParamValue(paramValue(data[key])))
+	}
+
+	return element + "]"
+}
+
+func paramValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+func escapeParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
@@ -0,0 +1,81 @@
+package logger_test
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/gosteno"
+	. "github.com/cloudfoundry/hm9000/helpers/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SyslogSink", func() {
+	var record *gosteno.Record
+
+	BeforeEach(func() {
+		record = &gosteno.Record{
+			Timestamp: 1400000000.5,
+			Pid:       42,
+			Source:    "vcap.hm9000.analyzer",
+			Level:     gosteno.LOG_ERROR,
+			Message:   "Failed to analyze",
+			Data:      map[string]interface{}{"App Guid": "abc", "error": `said "no"]`, "batch": 3},
+		}
+	})
+
+	It("formats records as RFC5424 messages with their data as structured data", func() {
+		Ω(FormatRFC5424(record, "hm-0", "vcap.hm9000.analyzer")).Should(Equal(
+			`<11>1 2014-05-13T16:53:20.500000Z hm-0 vcap.hm9000.analyzer 42 - [data@47450 App_Guid="abc" batch="3" error="said \"no\"\]"] Failed to analyze`,
+		))
+	})
+
+	It("leaves out the structured data of records without data", func() {
+		record.Level = gosteno.LOG_INFO
+		record.Data = nil
+		Ω(FormatRFC5424(record, "", "vcap.hm9000.analyzer")).Should(Equal(
+			`<14>1 2014-05-13T16:53:20.500000Z - vcap.hm9000.analyzer 42 - - Failed to analyze`,
+		))
+	})
+
+	It("sends each record as a datagram over UDP", func() {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+
+		sink := NewSyslogSink("udp", conn.LocalAddr().String(), "vcap.hm9000.analyzer")
+		sink.AddRecord(record)
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buffer := make([]byte, 4096)
+		n, _, err := conn.ReadFrom(buffer)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(buffer[:n])).Should(HavePrefix("<11>1 "))
+		Ω(string(buffer[:n])).Should(HaveSuffix(" Failed to analyze"))
+	})
+
+	It("frames records by octet counting over TCP", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer listener.Close()
+
+		sink := NewSyslogSink("tcp", listener.Addr().String(), "vcap.hm9000.analyzer")
+		go sink.AddRecord(record)
+
+		conn, err := listener.Accept()
+		Ω(err).ShouldNot(HaveOccurred())
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+
+		length, err := bufio.NewReader(conn).ReadString(' ')
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(strings.TrimSpace(length)).Should(MatchRegexp(`^\d+$`))
+	})
+
+	It("drops records when there is no server", func() {
+		sink := NewSyslogSink("tcp", "127.0.0.1:1", "vcap.hm9000.analyzer")
+		sink.AddRecord(record)
+	})
+})
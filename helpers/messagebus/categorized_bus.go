@@ -0,0 +1,38 @@
+package messagebus
+
+import (
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
+)
+
+// CategorizedBus tags the errors of the message bus it wraps
+// errorcategory.MessageBusError, so that components can count them.
+type CategorizedBus struct {
+	MessageBus
+}
+
+func NewCategorizedBus(bus MessageBus) *CategorizedBus {
+	return &CategorizedBus{MessageBus: bus}
+}
+
+func (bus *CategorizedBus) Publish(subject string, data []byte) error {
+	return errorcategory.New(errorcategory.MessageBusError, bus.MessageBus.Publish(subject, data))
+}
+
+func (bus *CategorizedBus) PublishRequest(subject, reply string, data []byte) error {
+	return errorcategory.New(errorcategory.MessageBusError, bus.MessageBus.PublishRequest(subject, reply, data))
+}
+
+func (bus *CategorizedBus) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	subscription, err := bus.MessageBus.Subscribe(subject, handler)
+	return subscription, errorcategory.New(errorcategory.MessageBusError, err)
+}
+
+func (bus *CategorizedBus) QueueSubscribe(subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	subscription, err := bus.MessageBus.QueueSubscribe(subject, queue, handler)
+	return subscription, errorcategory.New(errorcategory.MessageBusError, err)
+}
+
+func (bus *CategorizedBus) Unsubscribe(subscription *nats.Subscription) error {
+	return errorcategory.New(errorcategory.MessageBusError, bus.MessageBus.Unsubscribe(subscription))
+}
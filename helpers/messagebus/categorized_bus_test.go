@@ -0,0 +1,39 @@
+package messagebus_test
+
+import (
+	"errors"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
+	. "github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CategorizedBus", func() {
+	var (
+		fakeBus *fakeyagnats.FakeNATSConn
+		bus     *CategorizedBus
+	)
+
+	BeforeEach(func() {
+		fakeBus = fakeyagnats.Connect()
+		bus = NewCategorizedBus(fakeBus)
+	})
+
+	It("passes messages through", func() {
+		Ω(bus.Publish("subject", []byte("data"))).Should(Succeed())
+		Ω(fakeBus.PublishedMessages("subject")).Should(HaveLen(1))
+	})
+
+	It("tags the errors of publishing as message bus errors", func() {
+		fakeBus.WhenPublishing("subject", func(*nats.Msg) error {
+			return errors.New("connection closed")
+		})
+
+		err := bus.Publish("subject", []byte("data"))
+		Ω(err).Should(MatchError("connection closed"))
+		Ω(errorcategory.Of(err)).Should(Equal(errorcategory.MessageBusError))
+	})
+})
@@ -0,0 +1,84 @@
+package messagebus
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/apcera/gnatsd/server"
+	"github.com/cloudfoundry/yagnats"
+)
+
+// EmbeddedServerStartTimeout is how long StartEmbeddedServer waits for the
+// server to accept connections.
+const EmbeddedServerStartTimeout = 5 * time.Second
+
+var EmbeddedServerDidNotStartError = errors.New("Embedded NATS server did not start")
+
+// EmbeddedServer is a gnatsd server running in this process, so that tests
+// and single-box demos need no NATS of their own.  It has no auth and keeps
+// nothing on disk.
+type EmbeddedServer struct {
+	server *server.Server
+	host   string
+	port   int
+}
+
+// StartEmbeddedServer starts a NATS server listening on host and port and
+// waits until it accepts connections.  It returns an error if the port is
+// already taken.
+func StartEmbeddedServer(host string, port int) (*EmbeddedServer, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	listener.Close()
+
+	embedded := &EmbeddedServer{
+		server: server.New(&server.Options{
+			Host:   host,
+			Port:   port,
+			NoLog:  true,
+			NoSigs: true,
+		}),
+		host: host,
+		port: port,
+	}
+
+	go embedded.server.Start()
+
+	deadline := time.Now().Add(EmbeddedServerStartTimeout)
+	for {
+		conn, err := net.DialTimeout("tcp", embedded.Address(), 100*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return embedded, nil
+		}
+		if time.Now().After(deadline) {
+			embedded.server.Shutdown()
+			return nil, EmbeddedServerDidNotStartError
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Address is the host:port the server listens on.
+func (embedded *EmbeddedServer) Address() string {
+	return net.JoinHostPort(embedded.host, strconv.Itoa(embedded.port))
+}
+
+func (embedded *EmbeddedServer) URL() string {
+	return fmt.Sprintf("nats://%s", embedded.Address())
+}
+
+// Connect returns a new connection to the server.
+func (embedded *EmbeddedServer) Connect() (MessageBus, error) {
+	return yagnats.Connect([]string{embedded.URL()})
+}
+
+// Shutdown stops the server and drops its connections.
+func (embedded *EmbeddedServer) Shutdown() {
+	embedded.server.Shutdown()
+}
@@ -0,0 +1,67 @@
+package messagebus_test
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/helpers/faultinjection"
+	. "github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/helpers/natsconnection"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/config"
+	. "github.com/onsi/gomega"
+)
+
+var _ MessageBus = fakeyagnats.Connect()
+var _ MessageBus = &natsconnection.FailoverConn{}
+var _ MessageBus = &faultinjection.NATSConn{}
+
+var _ = Describe("EmbeddedServer", func() {
+	var (
+		port   int
+		server *EmbeddedServer
+	)
+
+	BeforeEach(func() {
+		port = 4323 + config.GinkgoConfig.ParallelNode
+
+		var err error
+		server, err = StartEmbeddedServer("127.0.0.1", port)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Shutdown()
+	})
+
+	It("accepts connections as soon as it has started", func() {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+		Ω(err).ShouldNot(HaveOccurred())
+		conn.Close()
+	})
+
+	It("reports its address and URL", func() {
+		Ω(server.Address()).Should(Equal(fmt.Sprintf("127.0.0.1:%d", port)))
+		Ω(server.URL()).Should(Equal(fmt.Sprintf("nats://127.0.0.1:%d", port)))
+	})
+
+	It("stops accepting connections once shut down", func() {
+		server.Shutdown()
+		Eventually(func() error {
+			conn, err := net.DialTimeout("tcp", server.Address(), 100*time.Millisecond)
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		}, 5, 0.1).Should(HaveOccurred())
+	})
+
+	Context("when the port is taken", func() {
+		It("returns an error", func() {
+			_, err := StartEmbeddedServer("127.0.0.1", port)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
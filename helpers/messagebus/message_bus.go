@@ -0,0 +1,21 @@
+package messagebus
+
+import (
+	"github.com/apcera/nats"
+)
+
+// MessageBus is the part of NATS hm9000's components use: publishing,
+// subscribing (alone or in a queue group) and checking the connection.  A
+// yagnats connection is one, as are the failover and fault-injecting
+// connections in natsconnection and faultinjection, and fakeyagnats in
+// tests.  EmbeddedServer runs a NATS server in-process to connect one to.
+type MessageBus interface {
+	Publish(subject string, data []byte) error
+	PublishRequest(subject, reply string, data []byte) error
+	Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error)
+	QueueSubscribe(subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error)
+	Unsubscribe(subscription *nats.Subscription) error
+	Ping() bool
+	AddReconnectedCB(func(*nats.Conn))
+	Close()
+}
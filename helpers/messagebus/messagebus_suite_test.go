@@ -0,0 +1,13 @@
+package messagebus_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestMessageBus(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "MessageBus Suite")
+}
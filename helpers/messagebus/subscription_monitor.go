@@ -0,0 +1,117 @@
+package messagebus
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+var ErrSlowConsumer = errors.New("slow consumer")
+
+// PendingCounter is what a SubscriptionMonitor reads of a subscription: the
+// messages and bytes the NATS client has received but not yet handed to the
+// subscription's handler, and the messages it dropped because too many were
+// pending.  A *nats.Subscription is one.
+type PendingCounter interface {
+	Pending() (int, int, error)
+	Dropped() (int, error)
+}
+
+// SubscriptionStats are a subscription's pending messages and bytes, and
+// the messages the NATS client has dropped for it: in all (Dropped) and
+// since the previous check (NewlyDropped).
+type SubscriptionStats struct {
+	Subject         string
+	PendingMessages int
+	PendingBytes    int
+	Dropped         int
+	NewlyDropped    int
+}
+
+// SlowConsumer is true when the NATS client has dropped messages for the
+// subscription since the previous check, because its handler could not keep
+// up with them.
+func (stats SubscriptionStats) SlowConsumer() bool {
+	return stats.NewlyDropped > 0
+}
+
+type monitoredSubscription struct {
+	subject      string
+	subscription PendingCounter
+	dropped      int
+}
+
+// SubscriptionMonitor watches a component's subscriptions for messages
+// piling up, and for the messages the NATS client drops when they do, which
+// would otherwise go unnoticed.
+type SubscriptionMonitor struct {
+	logger        logger.Logger
+	subscriptions []*monitoredSubscription
+	lock          *sync.Mutex
+}
+
+func NewSubscriptionMonitor(logger logger.Logger) *SubscriptionMonitor {
+	return &SubscriptionMonitor{
+		logger: logger,
+		lock:   &sync.Mutex{},
+	}
+}
+
+// Add watches subscription, which is to subject.
+func (monitor *SubscriptionMonitor) Add(subject string, subscription PendingCounter) {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+
+	monitor.subscriptions = append(monitor.subscriptions, &monitoredSubscription{
+		subject:      subject,
+		subscription: subscription,
+	})
+}
+
+// Check returns the stats of each subscription, in the order they were
+// added, and logs an error for each slow consumer.  Subscriptions whose
+// stats cannot be read, such as those that have been unsubscribed, are left
+// out.
+func (monitor *SubscriptionMonitor) Check() []SubscriptionStats {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+
+	allStats := []SubscriptionStats{}
+	for _, monitored := range monitor.subscriptions {
+		pendingMessages, pendingBytes, err := monitored.subscription.Pending()
+		if err != nil {
+			continue
+		}
+		dropped, err := monitored.subscription.Dropped()
+		if err != nil {
+			continue
+		}
+
+		stats := SubscriptionStats{
+			Subject:         monitored.subject,
+			PendingMessages: pendingMessages,
+			PendingBytes:    pendingBytes,
+			Dropped:         dropped,
+			NewlyDropped:    dropped - monitored.dropped,
+		}
+		if stats.NewlyDropped < 0 {
+			// the subscription was made anew and its count started over
+			stats.NewlyDropped = dropped
+		}
+		monitored.dropped = dropped
+
+		if stats.SlowConsumer() {
+			monitor.logger.Error("Slow consumer: the NATS client dropped messages", ErrSlowConsumer, map[string]string{
+				"Subject":          stats.Subject,
+				"Dropped Messages": strconv.Itoa(stats.NewlyDropped),
+				"Pending Messages": strconv.Itoa(stats.PendingMessages),
+				"Pending Bytes":    strconv.Itoa(stats.PendingBytes),
+			})
+		}
+
+		allStats = append(allStats, stats)
+	}
+	return allStats
+}
@@ -0,0 +1,96 @@
+package messagebus_test
+
+import (
+	"errors"
+
+	"github.com/apcera/nats"
+	. "github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeSubscription struct {
+	pendingMessages int
+	pendingBytes    int
+	dropped         int
+	err             error
+}
+
+func (subscription *fakeSubscription) Pending() (int, int, error) {
+	return subscription.pendingMessages, subscription.pendingBytes, subscription.err
+}
+
+func (subscription *fakeSubscription) Dropped() (int, error) {
+	return subscription.dropped, subscription.err
+}
+
+var _ PendingCounter = &nats.Subscription{}
+
+var _ = Describe("SubscriptionMonitor", func() {
+	var (
+		logger     *fakelogger.FakeLogger
+		monitor    *SubscriptionMonitor
+		heartbeats *fakeSubscription
+		advertise  *fakeSubscription
+	)
+
+	BeforeEach(func() {
+		logger = fakelogger.NewFakeLogger()
+		monitor = NewSubscriptionMonitor(logger)
+
+		heartbeats = &fakeSubscription{pendingMessages: 12, pendingBytes: 3400}
+		advertise = &fakeSubscription{}
+		monitor.Add("dea.heartbeat", heartbeats)
+		monitor.Add("dea.advertise", advertise)
+	})
+
+	It("returns the pending messages and bytes of each subscription", func() {
+		Ω(monitor.Check()).Should(Equal([]SubscriptionStats{
+			{Subject: "dea.heartbeat", PendingMessages: 12, PendingBytes: 3400},
+			{Subject: "dea.advertise"},
+		}))
+		Ω(logger.LoggedSubjects).Should(BeEmpty())
+	})
+
+	Context("when the NATS client drops messages", func() {
+		BeforeEach(func() {
+			heartbeats.dropped = 5
+		})
+
+		It("counts the drops since the previous check", func() {
+			stats := monitor.Check()
+			Ω(stats[0].Dropped).Should(Equal(5))
+			Ω(stats[0].NewlyDropped).Should(Equal(5))
+			Ω(stats[0].SlowConsumer()).Should(BeTrue())
+
+			heartbeats.dropped = 7
+			stats = monitor.Check()
+			Ω(stats[0].Dropped).Should(Equal(7))
+			Ω(stats[0].NewlyDropped).Should(Equal(2))
+
+			stats = monitor.Check()
+			Ω(stats[0].NewlyDropped).Should(BeZero())
+			Ω(stats[0].SlowConsumer()).Should(BeFalse())
+		})
+
+		It("logs the slow consumer", func() {
+			monitor.Check()
+			Ω(logger.LoggedSubjects).Should(Equal([]string{"Slow consumer: the NATS client dropped messages"}))
+			Ω(logger.LoggedErrors).Should(Equal([]error{ErrSlowConsumer}))
+
+			monitor.Check()
+			Ω(logger.LoggedSubjects).Should(HaveLen(1))
+		})
+	})
+
+	Context("when a subscription's stats cannot be read", func() {
+		BeforeEach(func() {
+			heartbeats.err = errors.New("invalid subscription")
+		})
+
+		It("leaves it out", func() {
+			Ω(monitor.Check()).Should(Equal([]SubscriptionStats{{Subject: "dea.advertise"}}))
+		})
+	})
+})
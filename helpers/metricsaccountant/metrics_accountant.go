@@ -1,8 +1,12 @@
 package metricsaccountant
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
+	"github.com/cloudfoundry/hm9000/helpers/httpclient"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/storeadapter"
@@ -17,20 +21,101 @@ var startMetrics = map[models.PendingStartMessageReason]string{
 	models.PendingStartMessageReasonCrashed:    "StartCrashed",
 	models.PendingStartMessageReasonMissing:    "StartMissing",
 	models.PendingStartMessageReasonEvacuating: "StartEvacuating",
+	models.PendingStartMessageReasonOperator:   "StartOperator",
+	models.PendingStartMessageReasonPreemptive: "StartPreemptive",
 }
 
 var stopMetrics = map[models.PendingStopMessageReason]string{
 	models.PendingStopMessageReasonDuplicate:          "StopDuplicate",
 	models.PendingStopMessageReasonExtra:              "StopExtra",
 	models.PendingStopMessageReasonEvacuationComplete: "StopEvacuationComplete",
+	models.PendingStopMessageReasonOperator:           "StopOperator",
+}
+
+var stopCategoryMetrics = map[models.StopCategory]string{
+	models.StopCategoryScaleDown:         "StopCategoryScaleDown",
+	models.StopCategoryAppStopped:        "StopCategoryAppStopped",
+	models.StopCategoryMismatchedVersion: "StopCategoryMismatchedVersion",
+	models.StopCategoryDuplicate:         "StopCategoryDuplicate",
+	models.StopCategoryEvacuation:        "StopCategoryEvacuation",
+	models.StopCategoryOperator:          "StopCategoryOperator",
+}
+
+var stopInitiatorMetrics = map[models.StopInitiator]string{
+	models.StopInitiatorCC:       "StopsInitiatedByCC",
+	models.StopInitiatorHM:       "StopsInitiatedByHM",
+	models.StopInitiatorOperator: "StopsInitiatedByOperator",
+}
+
+var startOutcomeMetrics = map[models.StartOutcome]string{
+	models.StartOutcomeSucceeded: "StartsSucceeded",
+	models.StartOutcomeCrashed:   "StartsCrashedAgain",
+	models.StartOutcomeTimedOut:  "StartsTimedOut",
+}
+
+// timeToReactBuckets are the upper bounds, in seconds, of the time to react
+// histogram's buckets.  Each bucket counts every time to react within its
+// bound, so they are cumulative.
+var timeToReactBuckets = []int{10, 30, 60, 120, 300}
+
+func timeToReactBucket(bound int) string {
+	return fmt.Sprintf("TimeToReactWithin%dSeconds", bound)
+}
+
+// queueGroupComponents are the components whose instances can share their
+// NATS subscriptions in nats_queue_group.
+var queueGroupComponents = []string{"Listener", "Evacuator"}
+
+func queueGroupMessagesMetric(component string) string {
+	return component + "QueueGroupMessages"
+}
+
+// natsSubscriptionComponents are the components whose NATS subscriptions are
+// watched for slow consumption.
+var natsSubscriptionComponents = []string{"Listener", "Evacuator"}
+
+// natsSubscriptionMetrics are the metrics kept for each of a component's
+// subscriptions, by subject.
+var natsSubscriptionMetrics = []string{"NATSPendingMessages", "NATSPendingBytes", "NATSDroppedMessages"}
+
+// errorComponents are the components whose errors are counted by category.
+var errorComponents = []string{"Fetcher", "Analyzer", "Sender", "Shredder", "Aggregator", "Listener", "Evacuator"}
+
+func errorsMetric(component string, category errorcategory.Category) string {
+	return component + string(category) + "Errors"
 }
 
 type MetricsAccountant interface {
 	TrackReceivedHeartbeats(metric int) error
 	TrackSavedHeartbeats(metric int) error
+	TrackShedInstanceHeartbeats(metric int) error
 	IncrementSentMessageMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error
+	IncrementStopCategoryMetrics(categories []models.StopCategory) error
+	IncrementDeduplicatedMessageMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error
+	TrackPendingMessageEnqueue(result store.EnqueueResult) error
 	TrackDesiredStateSyncTime(dt time.Duration) error
+	TrackDesiredStatePageCache(hits int, misses int) error
 	TrackActualStateListenerStoreUsageFraction(usage float64) error
+	IncrementStoreFailovers() error
+	IncrementAbortedDesiredStateSyncs() error
+	TrackNATSCluster(index int) error
+	IncrementNATSFailovers() error
+	IncrementEvacuationsMissed() error
+	IncrementLeaderElections(component string) error
+	IncrementDaemonPanics(component string) error
+	IncrementWatchdogTrips(component string) error
+	IncrementErrors(component string, err error) error
+	TrackCCRequestStats(stats httpclient.Stats) error
+	TrackTimesToReact(timesToReact []time.Duration, slo time.Duration) error
+	TrackStartOutcomes(outcomes []models.StartOutcome) error
+	TrackRestartReport(report models.RestartReport) error
+	TrackAnalysisReport(report models.AnalysisReport) error
+	TrackCrashCompaction(stats store.CrashCompactionStats) error
+	TrackQueueGroupMessages(component string, instance string, messages int) error
+	TrackDeaClockSkews(skews map[string]time.Duration) error
+	TrackAPIRateLimiting(rejections map[string]int) error
+	TrackAPIRequestDeadlines(timedOut int, abandoned int, inFlight int) error
+	TrackNATSSubscriptions(component string, stats []messagebus.SubscriptionStats) error
 	GetMetrics() (map[string]float64, error)
 }
 
@@ -44,6 +129,21 @@ func New(store store.Store) *RealMetricsAccountant {
 	}
 }
 
+// NewDisabled returns an accountant that reads the metrics in the store, as
+// New's does, but saves none, for a component with metrics_disabled set.
+func NewDisabled(store store.Store) *RealMetricsAccountant {
+	return New(discardingStore{store})
+}
+
+// discardingStore drops every metric saved to it.
+type discardingStore struct {
+	store.Store
+}
+
+func (s discardingStore) SaveMetric(metric string, value float64) error {
+	return nil
+}
+
 func (m *RealMetricsAccountant) TrackReceivedHeartbeats(metric int) error {
 	return m.store.SaveMetric("ReceivedHeartbeats", float64(metric))
 }
@@ -52,14 +152,419 @@ func (m *RealMetricsAccountant) TrackSavedHeartbeats(metric int) error {
 	return m.store.SaveMetric("SavedHeartbeats", float64(metric))
 }
 
+// TrackShedInstanceHeartbeats records how many instance heartbeats the
+// listener has counted but not saved while shedding load.
+func (m *RealMetricsAccountant) TrackShedInstanceHeartbeats(metric int) error {
+	return m.store.SaveMetric("ShedInstanceHeartbeats", float64(metric))
+}
+
 func (m *RealMetricsAccountant) TrackDesiredStateSyncTime(dt time.Duration) error {
 	return m.store.SaveMetric("DesiredStateSyncTimeInMilliseconds", float64(dt)/float64(time.Millisecond))
 }
 
+// TrackDesiredStatePageCache adds to the number of bulk pages the CC said
+// were unchanged since the fetcher last downloaded them (hits) and the
+// number it downloaded (misses).
+func (m *RealMetricsAccountant) TrackDesiredStatePageCache(hits int, misses int) error {
+	counters := map[string]int{
+		"DesiredStatePageCacheHits":   hits,
+		"DesiredStatePageCacheMisses": misses,
+	}
+
+	for key, increment := range counters {
+		value, err := m.store.GetMetric(key)
+		if err == storeadapter.ErrorKeyNotFound {
+			value = 0
+		} else if err != nil {
+			return err
+		}
+
+		err = m.store.SaveMetric(key, value+float64(increment))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (m *RealMetricsAccountant) TrackActualStateListenerStoreUsageFraction(usage float64) error {
 	return m.store.SaveMetric("ActualStateListenerStoreUsagePercentage", usage*100.0)
 }
 
+func (m *RealMetricsAccountant) IncrementStoreFailovers() error {
+	failovers, err := m.store.GetMetric("StoreFailovers")
+	if err == storeadapter.ErrorKeyNotFound {
+		failovers = 0
+	} else if err != nil {
+		return err
+	}
+
+	return m.store.SaveMetric("StoreFailovers", failovers+1)
+}
+
+// IncrementEvacuationsMissed counts the evacuations whose start the
+// evacuator gave up on enqueuing.
+func (m *RealMetricsAccountant) IncrementEvacuationsMissed() error {
+	missed, err := m.store.GetMetric("EvacuationsMissed")
+	if err == storeadapter.ErrorKeyNotFound {
+		missed = 0
+	} else if err != nil {
+		return err
+	}
+
+	return m.store.SaveMetric("EvacuationsMissed", missed+1)
+}
+
+// IncrementAbortedDesiredStateSyncs counts the desired state syncs the
+// fetcher aborted because the CC sent fewer apps than it counts.
+func (m *RealMetricsAccountant) IncrementAbortedDesiredStateSyncs() error {
+	aborted, err := m.store.GetMetric("AbortedDesiredStateSyncs")
+	if err == storeadapter.ErrorKeyNotFound {
+		aborted = 0
+	} else if err != nil {
+		return err
+	}
+
+	return m.store.SaveMetric("AbortedDesiredStateSyncs", aborted+1)
+}
+
+// TrackNATSCluster records the position, in nats_clusters, of the NATS
+// cluster that a component has just connected to.
+func (m *RealMetricsAccountant) TrackNATSCluster(index int) error {
+	return m.store.SaveMetric("NATSClusterIndex", float64(index))
+}
+
+func (m *RealMetricsAccountant) IncrementNATSFailovers() error {
+	failovers, err := m.store.GetMetric("NATSFailovers")
+	if err == storeadapter.ErrorKeyNotFound {
+		failovers = 0
+	} else if err != nil {
+		return err
+	}
+
+	return m.store.SaveMetric("NATSFailovers", failovers+1)
+}
+
+// IncrementLeaderElections counts the times a process has become the leader
+// of a component (the analyzer or the sender).
+func (m *RealMetricsAccountant) IncrementLeaderElections(component string) error {
+	key := component + "LeaderElections"
+	elections, err := m.store.GetMetric(key)
+	if err == storeadapter.ErrorKeyNotFound {
+		elections = 0
+	} else if err != nil {
+		return err
+	}
+
+	return m.store.SaveMetric(key, elections+1)
+}
+
+// IncrementDaemonPanics counts the runs of a component's daemon that
+// panicked.
+func (m *RealMetricsAccountant) IncrementDaemonPanics(component string) error {
+	key := component + "DaemonPanics"
+	panics, err := m.store.GetMetric(key)
+	if err == storeadapter.ErrorKeyNotFound {
+		panics = 0
+	} else if err != nil {
+		return err
+	}
+
+	return m.store.SaveMetric(key, panics+1)
+}
+
+// IncrementWatchdogTrips counts the times a component's daemon was found
+// wedged by its watchdog.
+func (m *RealMetricsAccountant) IncrementWatchdogTrips(component string) error {
+	key := component + "WatchdogTrips"
+	trips, err := m.store.GetMetric(key)
+	if err == storeadapter.ErrorKeyNotFound {
+		trips = 0
+	} else if err != nil {
+		return err
+	}
+
+	return m.store.SaveMetric(key, trips+1)
+}
+
+// IncrementErrors counts an error a component has run into under its
+// category (see errorcategory), as <Component><Category>Errors.
+func (m *RealMetricsAccountant) IncrementErrors(component string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	key := errorsMetric(component, errorcategory.Of(err))
+	errors, getErr := m.store.GetMetric(key)
+	if getErr == storeadapter.ErrorKeyNotFound {
+		errors = 0
+	} else if getErr != nil {
+		return getErr
+	}
+
+	return m.store.SaveMetric(key, errors+1)
+}
+
+// TrackCCRequestStats does the same for the requests made to the CC.
+func (m *RealMetricsAccountant) TrackCCRequestStats(stats httpclient.Stats) error {
+	return m.trackRequestStats("CC", stats.Requests, stats.Errors, stats.Retries, stats.MeanLatency())
+}
+
+func (m *RealMetricsAccountant) trackRequestStats(prefix string, requests int, errors int, retries int, meanLatency time.Duration) error {
+	counters := map[string]int{
+		prefix + "Requests":       requests,
+		prefix + "RequestErrors":  errors,
+		prefix + "RequestRetries": retries,
+	}
+
+	for key, increment := range counters {
+		value, err := m.store.GetMetric(key)
+		if err == storeadapter.ErrorKeyNotFound {
+			value = 0
+		} else if err != nil {
+			return err
+		}
+
+		err = m.store.SaveMetric(key, value+float64(increment))
+		if err != nil {
+			return err
+		}
+	}
+
+	errorPercentage := 0.0
+	if requests > 0 {
+		errorPercentage = float64(errors) / float64(requests) * 100.0
+	}
+
+	err := m.store.SaveMetric(prefix+"RequestErrorPercentage", errorPercentage)
+	if err != nil {
+		return err
+	}
+
+	return m.store.SaveMetric(prefix+"RequestLatencyInMilliseconds", float64(meanLatency)/float64(time.Millisecond))
+}
+
+// TrackTimesToReact records how long hm9000 took to send a start for each
+// crashed instance, from when it saw the instance crash, in the time to
+// react histogram.  Times longer than slo (unless it is 0) count as SLO
+// violations.
+func (m *RealMetricsAccountant) TrackTimesToReact(timesToReact []time.Duration, slo time.Duration) error {
+	if len(timesToReact) == 0 {
+		return nil
+	}
+
+	increments := map[string]float64{
+		"TimeToReactSamples": float64(len(timesToReact)),
+	}
+	for _, timeToReact := range timesToReact {
+		increments["TimeToReactTotalInMilliseconds"] += float64(timeToReact / time.Millisecond)
+		for _, bound := range timeToReactBuckets {
+			if timeToReact <= time.Duration(bound)*time.Second {
+				increments[timeToReactBucket(bound)] += 1
+			}
+		}
+		if slo > 0 && timeToReact > slo {
+			increments["TimeToReactSLOViolations"] += 1
+		}
+	}
+
+	for key, increment := range increments {
+		value, err := m.store.GetMetric(key)
+		if err == storeadapter.ErrorKeyNotFound {
+			value = 0
+		} else if err != nil {
+			return err
+		}
+
+		err = m.store.SaveMetric(key, value+increment)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TrackStartOutcomes counts what came of the starts the sender sent, by
+// outcome.
+func (m *RealMetricsAccountant) TrackStartOutcomes(outcomes []models.StartOutcome) error {
+	increments := map[string]float64{}
+	for _, outcome := range outcomes {
+		increments[startOutcomeMetrics[outcome]] += 1
+	}
+
+	for key, increment := range increments {
+		value, err := m.store.GetMetric(key)
+		if err == storeadapter.ErrorKeyNotFound {
+			value = 0
+		} else if err != nil {
+			return err
+		}
+
+		err = m.store.SaveMetric(key, value+increment)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TrackRestartReport records how many apps the latest restart report lists
+// as restarted too often.
+func (m *RealMetricsAccountant) TrackRestartReport(report models.RestartReport) error {
+	return m.store.SaveMetric("AppsRestartedTooOften", float64(len(report.Apps)))
+}
+
+// TrackAnalysisReport records what the analyzer's latest run cost.
+func (m *RealMetricsAccountant) TrackAnalysisReport(report models.AnalysisReport) error {
+	metrics := map[string]float64{
+		"AnalysisStoreReads":             float64(report.StoreReads),
+		"AnalysisStoreWrites":            float64(report.StoreWrites),
+		"AnalysisAppsScanned":            float64(report.AppsScanned),
+		"AnalysisDurationInMilliseconds": float64(report.DurationInMilliseconds),
+		"AnalysisAllocations":            float64(report.Allocations),
+		"AnalysisAllocatedBytes":         float64(report.AllocatedBytes),
+	}
+
+	for key, value := range metrics {
+		err := m.store.SaveMetric(key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TrackCrashCompaction records how many apps and crashes the latest crash
+// compaction compacted and how long it took, and adds its crashes to the
+// total ever compacted.
+func (m *RealMetricsAccountant) TrackCrashCompaction(stats store.CrashCompactionStats) error {
+	compacted, err := m.store.GetMetric("CompactedCrashes")
+	if err == storeadapter.ErrorKeyNotFound {
+		compacted = 0
+	} else if err != nil {
+		return err
+	}
+
+	metrics := map[string]float64{
+		"CrashCompactionApps":                   float64(stats.Apps),
+		"CrashCompactionCrashes":                float64(stats.Crashes),
+		"CrashCompactionDurationInMilliseconds": float64(stats.Duration) / float64(time.Millisecond),
+		"CompactedCrashes":                      compacted + float64(stats.Crashes),
+	}
+
+	for key, value := range metrics {
+		err := m.store.SaveMetric(key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TrackQueueGroupMessages records how many messages an instance of a
+// component has received in the NATS queue group since it started.
+func (m *RealMetricsAccountant) TrackQueueGroupMessages(component string, instance string, messages int) error {
+	return m.store.SaveInstanceMetric(queueGroupMessagesMetric(component), instance, float64(messages))
+}
+
+// TrackDeaClockSkews records how far ahead of the listener's clock each DEA
+// whose clock is skewed is, by DEA guid.
+func (m *RealMetricsAccountant) TrackDeaClockSkews(skews map[string]time.Duration) error {
+	for deaGuid, skew := range skews {
+		err := m.store.SaveInstanceMetric("DeaClockSkewInSeconds", deaGuid, skew.Seconds())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TrackNATSSubscriptions records the pending messages and bytes of each of a
+// component's NATS subscriptions, and the messages the NATS client has
+// dropped for it, by subject, and counts the component's slow consumers.
+func (m *RealMetricsAccountant) TrackNATSSubscriptions(component string, stats []messagebus.SubscriptionStats) error {
+	slowConsumers := 0
+	for _, subscription := range stats {
+		values := map[string]int{
+			"NATSPendingMessages": subscription.PendingMessages,
+			"NATSPendingBytes":    subscription.PendingBytes,
+			"NATSDroppedMessages": subscription.Dropped,
+		}
+		for metric, value := range values {
+			err := m.store.SaveInstanceMetric(component+metric, subscription.Subject, float64(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		if subscription.SlowConsumer() {
+			slowConsumers++
+		}
+	}
+
+	if slowConsumers == 0 {
+		return nil
+	}
+
+	key := component + "NATSSlowConsumerEvents"
+	events, err := m.store.GetMetric(key)
+	if err == storeadapter.ErrorKeyNotFound {
+		events = 0
+	} else if err != nil {
+		return err
+	}
+	return m.store.SaveMetric(key, events+float64(slowConsumers))
+}
+
+// TrackAPIRateLimiting adds the requests the API server has turned away,
+// by requester, since it last tracked them to APIRateLimitedRequests, and
+// records how many requesters were turned away as APIRateLimitedRequesters.
+func (m *RealMetricsAccountant) TrackAPIRateLimiting(rejections map[string]int) error {
+	rejected, err := m.store.GetMetric("APIRateLimitedRequests")
+	if err == storeadapter.ErrorKeyNotFound {
+		rejected = 0
+	} else if err != nil {
+		return err
+	}
+
+	for _, requests := range rejections {
+		rejected += float64(requests)
+	}
+
+	err = m.store.SaveMetric("APIRateLimitedRequests", rejected)
+	if err != nil {
+		return err
+	}
+	return m.store.SaveMetric("APIRateLimitedRequesters", float64(len(rejections)))
+}
+
+// TrackAPIRequestDeadlines adds the requests the API server has answered
+// with a 503 since it last tracked them, because they timed out or waited
+// for their turn past their deadline, to APIRequestTimeouts and
+// APIRequestsAbandoned, and records how many requests are running as
+// APIRequestsInFlight.
+func (m *RealMetricsAccountant) TrackAPIRequestDeadlines(timedOut int, abandoned int, inFlight int) error {
+	for key, increment := range map[string]int{"APIRequestTimeouts": timedOut, "APIRequestsAbandoned": abandoned} {
+		value, err := m.store.GetMetric(key)
+		if err == storeadapter.ErrorKeyNotFound {
+			value = 0
+		} else if err != nil {
+			return err
+		}
+
+		err = m.store.SaveMetric(key, value+float64(increment))
+		if err != nil {
+			return err
+		}
+	}
+	return m.store.SaveMetric("APIRequestsInFlight", float64(inFlight))
+}
+
 func (m *RealMetricsAccountant) IncrementSentMessageMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error {
 	metrics, err := m.GetMetrics()
 	if err != nil {
@@ -84,6 +589,81 @@ func (m *RealMetricsAccountant) IncrementSentMessageMetrics(starts []models.Pend
 	return nil
 }
 
+// IncrementStopCategoryMetrics counts the stops sent, by the category the
+// sender sent them as, and by who initiated them.
+func (m *RealMetricsAccountant) IncrementStopCategoryMetrics(categories []models.StopCategory) error {
+	counters := map[string]int{}
+	for _, category := range categories {
+		metric, known := stopCategoryMetrics[category]
+		if !known {
+			continue
+		}
+		counters[metric]++
+		counters[stopInitiatorMetrics[category.Initiator()]]++
+	}
+
+	for key, increment := range counters {
+		value, err := m.store.GetMetric(key)
+		if err == storeadapter.ErrorKeyNotFound {
+			value = 0
+		} else if err != nil {
+			return err
+		}
+
+		err = m.store.SaveMetric(key, value+float64(increment))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *RealMetricsAccountant) IncrementDeduplicatedMessageMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error {
+	counters := map[string]int{
+		"DeduplicatedStartMessages": len(starts),
+		"DeduplicatedStopMessages":  len(stops),
+	}
+
+	for key, increment := range counters {
+		if increment == 0 {
+			continue
+		}
+
+		value, err := m.store.GetMetric(key)
+		if err == storeadapter.ErrorKeyNotFound {
+			value = 0
+		} else if err != nil {
+			return err
+		}
+
+		err = m.store.SaveMetric(key, value+float64(increment))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TrackPendingMessageEnqueue records how long the latest enqueue of pending
+// messages took, and adds the writes it found another writer had beaten it
+// to to the total ever found.
+func (m *RealMetricsAccountant) TrackPendingMessageEnqueue(result store.EnqueueResult) error {
+	conflicts, err := m.store.GetMetric("PendingMessageEnqueueConflicts")
+	if err == storeadapter.ErrorKeyNotFound {
+		conflicts = 0
+	} else if err != nil {
+		return err
+	}
+
+	err = m.store.SaveMetric("PendingMessageEnqueueConflicts", conflicts+float64(result.Conflicts))
+	if err != nil {
+		return err
+	}
+	return m.store.SaveMetric("PendingMessageEnqueueTimeInMilliseconds", float64(result.Duration)/float64(time.Millisecond))
+}
+
 func (m *RealMetricsAccountant) GetMetrics() (map[string]float64, error) {
 	metrics := map[string]float64{}
 	for _, key := range startMetrics {
@@ -92,11 +672,79 @@ func (m *RealMetricsAccountant) GetMetrics() (map[string]float64, error) {
 	for _, key := range stopMetrics {
 		metrics[key] = 0
 	}
+	for _, key := range stopCategoryMetrics {
+		metrics[key] = 0
+	}
+	for _, key := range stopInitiatorMetrics {
+		metrics[key] = 0
+	}
 
 	metrics["DesiredStateSyncTimeInMilliseconds"] = 0
+	metrics["DesiredStatePageCacheHits"] = 0
+	metrics["DesiredStatePageCacheMisses"] = 0
 	metrics["ActualStateListenerStoreUsagePercentage"] = 0
 	metrics["SavedHeartbeats"] = 0
 	metrics["ReceivedHeartbeats"] = 0
+	metrics["ShedInstanceHeartbeats"] = 0
+	metrics["StoreFailovers"] = 0
+	metrics["EvacuationsMissed"] = 0
+	metrics["AbortedDesiredStateSyncs"] = 0
+	metrics["CCRequests"] = 0
+	metrics["CCRequestErrors"] = 0
+	metrics["CCRequestRetries"] = 0
+	metrics["CCRequestErrorPercentage"] = 0
+	metrics["CCRequestLatencyInMilliseconds"] = 0
+	metrics["TimeToReactSamples"] = 0
+	metrics["TimeToReactTotalInMilliseconds"] = 0
+	metrics["TimeToReactSLOViolations"] = 0
+	for _, bound := range timeToReactBuckets {
+		metrics[timeToReactBucket(bound)] = 0
+	}
+	for _, metric := range startOutcomeMetrics {
+		metrics[metric] = 0
+	}
+	metrics["AppsRestartedTooOften"] = 0
+	metrics["AnalysisStoreReads"] = 0
+	metrics["AnalysisStoreWrites"] = 0
+	metrics["AnalysisAppsScanned"] = 0
+	metrics["AnalysisDurationInMilliseconds"] = 0
+	metrics["AnalysisAllocations"] = 0
+	metrics["AnalysisAllocatedBytes"] = 0
+	metrics["CrashCompactionApps"] = 0
+	metrics["CrashCompactionCrashes"] = 0
+	metrics["CrashCompactionDurationInMilliseconds"] = 0
+	metrics["CompactedCrashes"] = 0
+	metrics["DeduplicatedStartMessages"] = 0
+	metrics["DeduplicatedStopMessages"] = 0
+	metrics["PendingMessageEnqueueConflicts"] = 0
+	metrics["PendingMessageEnqueueTimeInMilliseconds"] = 0
+	metrics["NATSClusterIndex"] = 0
+	metrics["NATSFailovers"] = 0
+	metrics["AnalyzerLeaderElections"] = 0
+	metrics["SenderLeaderElections"] = 0
+	metrics["FetcherDaemonPanics"] = 0
+	metrics["AnalyzerDaemonPanics"] = 0
+	metrics["SenderDaemonPanics"] = 0
+	metrics["ShredderDaemonPanics"] = 0
+	metrics["AggregatorDaemonPanics"] = 0
+	metrics["FetcherWatchdogTrips"] = 0
+	metrics["AnalyzerWatchdogTrips"] = 0
+	metrics["SenderWatchdogTrips"] = 0
+	metrics["ShredderWatchdogTrips"] = 0
+	metrics["AggregatorWatchdogTrips"] = 0
+	metrics["APIRateLimitedRequests"] = 0
+	metrics["APIRateLimitedRequesters"] = 0
+	metrics["APIRequestTimeouts"] = 0
+	metrics["APIRequestsAbandoned"] = 0
+	metrics["APIRequestsInFlight"] = 0
+	for _, component := range natsSubscriptionComponents {
+		metrics[component+"NATSSlowConsumerEvents"] = 0
+	}
+	for _, component := range errorComponents {
+		for _, category := range errorcategory.Categories {
+			metrics[errorsMetric(component, category)] = 0
+		}
+	}
 
 	for key := range metrics {
 		value, err := m.store.GetMetric(key)
@@ -108,5 +756,59 @@ func (m *RealMetricsAccountant) GetMetrics() (map[string]float64, error) {
 		metrics[key] = value
 	}
 
+	skews, err := m.store.GetInstanceMetrics("DeaClockSkewInSeconds")
+	if err != nil {
+		return map[string]float64{}, err
+	}
+	for deaGuid, skew := range skews {
+		metrics["DeaClockSkewInSeconds."+deaGuid] = skew
+	}
+	metrics["SkewedDeas"] = float64(len(skews))
+
+	for _, component := range natsSubscriptionComponents {
+		for _, metric := range natsSubscriptionMetrics {
+			values, err := m.store.GetInstanceMetrics(component + metric)
+			if err != nil {
+				return map[string]float64{}, err
+			}
+			for subject, value := range values {
+				metrics[component+metric+"."+subject] = value
+			}
+		}
+	}
+
+	for _, component := range queueGroupComponents {
+		err := m.addQueueGroupShares(metrics, component)
+		if err != nil {
+			return map[string]float64{}, err
+		}
+	}
+
 	return metrics, nil
 }
+
+// addQueueGroupShares adds, for each instance of component that has tracked
+// its queue group messages recently, its message count and its percentage
+// of all of their messages.
+func (m *RealMetricsAccountant) addQueueGroupShares(metrics map[string]float64, component string) error {
+	metric := queueGroupMessagesMetric(component)
+	values, err := m.store.GetInstanceMetrics(metric)
+	if err != nil {
+		return err
+	}
+
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+
+	for instance, value := range values {
+		metrics[metric+"."+instance] = value
+		share := 0.0
+		if total > 0 {
+			share = 100 * value / total
+		}
+		metrics[component+"QueueGroupSharePercentage."+instance] = share
+	}
+	return nil
+}
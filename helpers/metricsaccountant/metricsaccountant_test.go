@@ -3,10 +3,14 @@ package metricsaccountant_test
 import (
 	"errors"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
+	"github.com/cloudfoundry/hm9000/helpers/httpclient"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 	. "github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
 	"github.com/cloudfoundry/hm9000/models"
 	storepackage "github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
 	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -29,9 +33,7 @@ var _ = Describe("Metrics Accountant", func() {
 	Describe("Getting Metrics", func() {
 		Context("when the store is empty", func() {
 			It("should return a map of 0s", func() {
-				metrics, err := accountant.GetMetrics()
-				Ω(err).ShouldNot(HaveOccurred())
-				Ω(metrics).Should(Equal(map[string]float64{
+				expected := map[string]float64{
 					"StartCrashed":                            0,
 					"StartMissing":                            0,
 					"StartEvacuating":                         0,
@@ -42,7 +44,87 @@ var _ = Describe("Metrics Accountant", func() {
 					"ActualStateListenerStoreUsagePercentage": 0,
 					"ReceivedHeartbeats":                      0,
 					"SavedHeartbeats":                         0,
-				}))
+					"ShedInstanceHeartbeats":                  0,
+					"StoreFailovers":                          0,
+					"AbortedDesiredStateSyncs":                0,
+					"CCRequests":                              0,
+					"CCRequestErrors":                         0,
+					"CCRequestRetries":                        0,
+					"CCRequestErrorPercentage":                0,
+					"CCRequestLatencyInMilliseconds":          0,
+					"TimeToReactSamples":                      0,
+					"TimeToReactTotalInMilliseconds":          0,
+					"TimeToReactSLOViolations":                0,
+					"TimeToReactWithin10Seconds":              0,
+					"TimeToReactWithin30Seconds":              0,
+					"TimeToReactWithin60Seconds":              0,
+					"TimeToReactWithin120Seconds":             0,
+					"TimeToReactWithin300Seconds":             0,
+					"StartsSucceeded":                         0,
+					"StartsCrashedAgain":                      0,
+					"StartsTimedOut":                          0,
+					"AppsRestartedTooOften":                   0,
+					"EvacuationsMissed":                       0,
+					"AnalysisStoreReads":                      0,
+					"AnalysisStoreWrites":                     0,
+					"AnalysisAppsScanned":                     0,
+					"AnalysisDurationInMilliseconds":          0,
+					"AnalysisAllocations":                     0,
+					"AnalysisAllocatedBytes":                  0,
+					"CrashCompactionApps":                     0,
+					"CrashCompactionCrashes":                  0,
+					"CrashCompactionDurationInMilliseconds":   0,
+					"CompactedCrashes":                        0,
+					"SkewedDeas":                              0,
+					"DesiredStatePageCacheHits":               0,
+					"DesiredStatePageCacheMisses":             0,
+					"DeduplicatedStartMessages":               0,
+					"DeduplicatedStopMessages":                0,
+					"PendingMessageEnqueueConflicts":          0,
+					"PendingMessageEnqueueTimeInMilliseconds": 0,
+					"NATSClusterIndex":                        0,
+					"NATSFailovers":                           0,
+					"AnalyzerLeaderElections":                 0,
+					"SenderLeaderElections":                   0,
+					"FetcherDaemonPanics":                     0,
+					"AnalyzerDaemonPanics":                    0,
+					"SenderDaemonPanics":                      0,
+					"ShredderDaemonPanics":                    0,
+					"AggregatorDaemonPanics":                  0,
+					"FetcherWatchdogTrips":                    0,
+					"AnalyzerWatchdogTrips":                   0,
+					"SenderWatchdogTrips":                     0,
+					"ShredderWatchdogTrips":                   0,
+					"AggregatorWatchdogTrips":                 0,
+					"APIRateLimitedRequests":                  0,
+					"APIRateLimitedRequesters":                0,
+					"APIRequestTimeouts":                      0,
+					"APIRequestsAbandoned":                    0,
+					"APIRequestsInFlight":                     0,
+					"ListenerNATSSlowConsumerEvents":          0,
+					"EvacuatorNATSSlowConsumerEvents":         0,
+					"StartOperator":                           0,
+					"StartPreemptive":                         0,
+					"StopOperator":                            0,
+					"StopCategoryScaleDown":                   0,
+					"StopCategoryAppStopped":                  0,
+					"StopCategoryMismatchedVersion":           0,
+					"StopCategoryDuplicate":                   0,
+					"StopCategoryEvacuation":                  0,
+					"StopCategoryOperator":                    0,
+					"StopsInitiatedByCC":                      0,
+					"StopsInitiatedByHM":                      0,
+					"StopsInitiatedByOperator":                0,
+				}
+				for _, component := range []string{"Fetcher", "Analyzer", "Sender", "Shredder", "Aggregator", "Listener", "Evacuator"} {
+					for _, category := range errorcategory.Categories {
+						expected[component+string(category)+"Errors"] = 0
+					}
+				}
+
+				metrics, err := accountant.GetMetrics()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(metrics).Should(Equal(expected))
 			})
 		})
 
@@ -69,6 +151,352 @@ var _ = Describe("Metrics Accountant", func() {
 		})
 	})
 
+	Describe("TrackShedInstanceHeartbeats", func() {
+		It("should record the number of shed instance heartbeats", func() {
+			err := accountant.TrackShedInstanceHeartbeats(12)
+			Ω(err).ShouldNot(HaveOccurred())
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["ShedInstanceHeartbeats"]).Should(BeNumerically("==", 12))
+		})
+	})
+
+	Describe("IncrementAbortedDesiredStateSyncs", func() {
+		It("should count the aborted syncs", func() {
+			err := accountant.IncrementAbortedDesiredStateSyncs()
+			Ω(err).ShouldNot(HaveOccurred())
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["AbortedDesiredStateSyncs"]).Should(BeNumerically("==", 1))
+		})
+	})
+
+	Describe("IncrementStoreFailovers", func() {
+		It("should count the failovers", func() {
+			err := accountant.IncrementStoreFailovers()
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementStoreFailovers()
+			Ω(err).ShouldNot(HaveOccurred())
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["StoreFailovers"]).Should(BeNumerically("==", 2))
+		})
+	})
+
+	Describe("IncrementEvacuationsMissed", func() {
+		It("should count the evacuations missed", func() {
+			err := accountant.IncrementEvacuationsMissed()
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementEvacuationsMissed()
+			Ω(err).ShouldNot(HaveOccurred())
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["EvacuationsMissed"]).Should(BeNumerically("==", 2))
+		})
+	})
+
+	Describe("TrackNATSCluster", func() {
+		It("should record the latest cluster", func() {
+			err := accountant.TrackNATSCluster(2)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackNATSCluster(1)
+			Ω(err).ShouldNot(HaveOccurred())
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["NATSClusterIndex"]).Should(BeNumerically("==", 1))
+		})
+	})
+
+	Describe("IncrementNATSFailovers", func() {
+		It("should count the failovers", func() {
+			err := accountant.IncrementNATSFailovers()
+			Ω(err).ShouldNot(HaveOccurred())
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["NATSFailovers"]).Should(BeNumerically("==", 1))
+		})
+	})
+
+	Describe("IncrementLeaderElections", func() {
+		It("should count the elections for each component", func() {
+			err := accountant.IncrementLeaderElections("Analyzer")
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementLeaderElections("Analyzer")
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementLeaderElections("Sender")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["AnalyzerLeaderElections"]).Should(BeNumerically("==", 2))
+			Ω(metrics["SenderLeaderElections"]).Should(BeNumerically("==", 1))
+		})
+	})
+
+	Describe("IncrementDaemonPanics", func() {
+		It("should count the panics for each component", func() {
+			err := accountant.IncrementDaemonPanics("Fetcher")
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementDaemonPanics("Fetcher")
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementDaemonPanics("Shredder")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["FetcherDaemonPanics"]).Should(BeNumerically("==", 2))
+			Ω(metrics["ShredderDaemonPanics"]).Should(BeNumerically("==", 1))
+			Ω(metrics["SenderDaemonPanics"]).Should(BeNumerically("==", 0))
+		})
+	})
+
+	Describe("IncrementWatchdogTrips", func() {
+		It("should count the trips for each component", func() {
+			err := accountant.IncrementWatchdogTrips("Analyzer")
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementWatchdogTrips("Analyzer")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["AnalyzerWatchdogTrips"]).Should(BeNumerically("==", 2))
+			Ω(metrics["SenderWatchdogTrips"]).Should(BeNumerically("==", 0))
+		})
+	})
+
+	Describe("IncrementErrors", func() {
+		It("should count the errors for each component by category", func() {
+			err := accountant.IncrementErrors("Analyzer", storeadapter.ErrorTimeout)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementErrors("Analyzer", storeadapter.ErrorTimeout)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementErrors("Fetcher", errorcategory.New(errorcategory.CCError, errors.New("Unauthorized")))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementErrors("Sender", errors.New("oops"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["AnalyzerStoreTimeoutErrors"]).Should(BeNumerically("==", 2))
+			Ω(metrics["FetcherCCErrors"]).Should(BeNumerically("==", 1))
+			Ω(metrics["SenderOtherErrors"]).Should(BeNumerically("==", 1))
+			Ω(metrics["AnalyzerStoreUnavailableErrors"]).Should(BeNumerically("==", 0))
+		})
+
+		It("should not count nil errors", func() {
+			Ω(accountant.IncrementErrors("Analyzer", nil)).Should(Succeed())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["AnalyzerOtherErrors"]).Should(BeNumerically("==", 0))
+		})
+	})
+
+	Describe("TrackCCRequestStats", func() {
+		It("should accumulate counts and record the latest error percentage and latency", func() {
+			err := accountant.TrackCCRequestStats(httpclient.Stats{Requests: 5, Errors: 1, Retries: 3, TotalLatency: 100 * time.Millisecond})
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackCCRequestStats(httpclient.Stats{Requests: 2, Errors: 0, Retries: 0, TotalLatency: 30 * time.Millisecond})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["CCRequests"]).Should(BeNumerically("==", 7))
+			Ω(metrics["CCRequestErrors"]).Should(BeNumerically("==", 1))
+			Ω(metrics["CCRequestRetries"]).Should(BeNumerically("==", 3))
+			Ω(metrics["CCRequestErrorPercentage"]).Should(BeNumerically("==", 0))
+			Ω(metrics["CCRequestLatencyInMilliseconds"]).Should(BeNumerically("==", 15))
+		})
+	})
+
+	Describe("TrackTimesToReact", func() {
+		It("should add the times to the histogram and count SLO violations", func() {
+			err := accountant.TrackTimesToReact([]time.Duration{5 * time.Second, 45 * time.Second}, time.Minute)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackTimesToReact([]time.Duration{90 * time.Second, 10 * time.Minute}, time.Minute)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["TimeToReactSamples"]).Should(BeNumerically("==", 4))
+			Ω(metrics["TimeToReactTotalInMilliseconds"]).Should(BeNumerically("==", 740000))
+			Ω(metrics["TimeToReactSLOViolations"]).Should(BeNumerically("==", 2))
+			Ω(metrics["TimeToReactWithin10Seconds"]).Should(BeNumerically("==", 1))
+			Ω(metrics["TimeToReactWithin30Seconds"]).Should(BeNumerically("==", 1))
+			Ω(metrics["TimeToReactWithin60Seconds"]).Should(BeNumerically("==", 2))
+			Ω(metrics["TimeToReactWithin120Seconds"]).Should(BeNumerically("==", 3))
+			Ω(metrics["TimeToReactWithin300Seconds"]).Should(BeNumerically("==", 3))
+		})
+
+		It("should not count violations when there is no SLO", func() {
+			err := accountant.TrackTimesToReact([]time.Duration{10 * time.Minute}, 0)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["TimeToReactSamples"]).Should(BeNumerically("==", 1))
+			Ω(metrics["TimeToReactSLOViolations"]).Should(BeNumerically("==", 0))
+		})
+	})
+
+	Describe("TrackDesiredStatePageCache", func() {
+		It("should add to the page cache hits and misses", func() {
+			accountant.TrackDesiredStatePageCache(3, 1)
+			err := accountant.TrackDesiredStatePageCache(2, 2)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["DesiredStatePageCacheHits"]).Should(BeNumerically("==", 5))
+			Ω(metrics["DesiredStatePageCacheMisses"]).Should(BeNumerically("==", 3))
+		})
+	})
+
+	Describe("TrackRestartReport", func() {
+		It("should record how many apps were restarted too often", func() {
+			err := accountant.TrackRestartReport(models.RestartReport{Apps: []models.RestartedApp{{AppGuid: "a"}, {AppGuid: "b"}}})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["AppsRestartedTooOften"]).Should(BeNumerically("==", 2))
+		})
+	})
+
+	Describe("TrackStartOutcomes", func() {
+		It("should count the outcomes", func() {
+			err := accountant.TrackStartOutcomes([]models.StartOutcome{models.StartOutcomeSucceeded, models.StartOutcomeSucceeded, models.StartOutcomeCrashed})
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackStartOutcomes([]models.StartOutcome{models.StartOutcomeSucceeded, models.StartOutcomeTimedOut})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["StartsSucceeded"]).Should(BeNumerically("==", 3))
+			Ω(metrics["StartsCrashedAgain"]).Should(BeNumerically("==", 1))
+			Ω(metrics["StartsTimedOut"]).Should(BeNumerically("==", 1))
+		})
+	})
+
+	Describe("TrackAnalysisReport", func() {
+		It("should record the latest run's costs", func() {
+			err := accountant.TrackAnalysisReport(models.AnalysisReport{StoreReads: 10, StoreWrites: 4, AppsScanned: 100, DurationInMilliseconds: 300, Allocations: 5000, AllocatedBytes: 1 << 20})
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackAnalysisReport(models.AnalysisReport{StoreReads: 12, StoreWrites: 3, AppsScanned: 101, DurationInMilliseconds: 350, Allocations: 5200, AllocatedBytes: 2 << 20})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["AnalysisStoreReads"]).Should(BeNumerically("==", 12))
+			Ω(metrics["AnalysisStoreWrites"]).Should(BeNumerically("==", 3))
+			Ω(metrics["AnalysisAppsScanned"]).Should(BeNumerically("==", 101))
+			Ω(metrics["AnalysisDurationInMilliseconds"]).Should(BeNumerically("==", 350))
+			Ω(metrics["AnalysisAllocations"]).Should(BeNumerically("==", 5200))
+			Ω(metrics["AnalysisAllocatedBytes"]).Should(BeNumerically("==", 2<<20))
+		})
+	})
+
+	Describe("TrackCrashCompaction", func() {
+		It("should record the latest compaction and add up the crashes compacted", func() {
+			err := accountant.TrackCrashCompaction(storepackage.CrashCompactionStats{Apps: 2, Crashes: 5, Duration: 30 * time.Millisecond})
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackCrashCompaction(storepackage.CrashCompactionStats{Apps: 1, Crashes: 1, Duration: 10 * time.Millisecond})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["CrashCompactionApps"]).Should(BeNumerically("==", 1))
+			Ω(metrics["CrashCompactionCrashes"]).Should(BeNumerically("==", 1))
+			Ω(metrics["CrashCompactionDurationInMilliseconds"]).Should(BeNumerically("==", 10))
+			Ω(metrics["CompactedCrashes"]).Should(BeNumerically("==", 6))
+		})
+	})
+
+	Describe("TrackQueueGroupMessages", func() {
+		It("should record each instance's messages and share of the messages", func() {
+			err := accountant.TrackQueueGroupMessages("Listener", "listener-0", 30)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackQueueGroupMessages("Listener", "listener-1", 10)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackQueueGroupMessages("Evacuator", "evacuator-0", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["ListenerQueueGroupMessages.listener-0"]).Should(BeNumerically("==", 30))
+			Ω(metrics["ListenerQueueGroupMessages.listener-1"]).Should(BeNumerically("==", 10))
+			Ω(metrics["ListenerQueueGroupSharePercentage.listener-0"]).Should(BeNumerically("==", 75))
+			Ω(metrics["ListenerQueueGroupSharePercentage.listener-1"]).Should(BeNumerically("==", 25))
+			Ω(metrics).Should(HaveKeyWithValue("EvacuatorQueueGroupMessages.evacuator-0", 0.0))
+			Ω(metrics).Should(HaveKeyWithValue("EvacuatorQueueGroupSharePercentage.evacuator-0", 0.0))
+		})
+	})
+
+	Describe("TrackDeaClockSkews", func() {
+		It("should record the skew of each skewed DEA", func() {
+			err := accountant.TrackDeaClockSkews(map[string]time.Duration{"dea-a": 90 * time.Second, "dea-b": 1500 * time.Millisecond})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["DeaClockSkewInSeconds.dea-a"]).Should(BeNumerically("==", 90))
+			Ω(metrics["DeaClockSkewInSeconds.dea-b"]).Should(BeNumerically("==", 1.5))
+			Ω(metrics["SkewedDeas"]).Should(BeNumerically("==", 2))
+		})
+	})
+
+	Describe("TrackNATSSubscriptions", func() {
+		It("should record the stats of each subscription and count the slow consumers", func() {
+			err := accountant.TrackNATSSubscriptions("Listener", []messagebus.SubscriptionStats{
+				{Subject: "dea.heartbeat", PendingMessages: 12, PendingBytes: 3400, Dropped: 7, NewlyDropped: 2},
+				{Subject: "dea.advertise", PendingMessages: 1, PendingBytes: 80},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackNATSSubscriptions("Listener", []messagebus.SubscriptionStats{
+				{Subject: "dea.heartbeat", PendingMessages: 2, PendingBytes: 400, Dropped: 8, NewlyDropped: 1},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["ListenerNATSPendingMessages.dea.heartbeat"]).Should(BeNumerically("==", 2))
+			Ω(metrics["ListenerNATSPendingBytes.dea.heartbeat"]).Should(BeNumerically("==", 400))
+			Ω(metrics["ListenerNATSDroppedMessages.dea.heartbeat"]).Should(BeNumerically("==", 8))
+			Ω(metrics["ListenerNATSPendingMessages.dea.advertise"]).Should(BeNumerically("==", 1))
+			Ω(metrics["ListenerNATSSlowConsumerEvents"]).Should(BeNumerically("==", 2))
+			Ω(metrics["EvacuatorNATSSlowConsumerEvents"]).Should(BeZero())
+		})
+	})
+
+	Describe("TrackAPIRateLimiting", func() {
+		It("should add to the rejected requests and record the requesters turned away", func() {
+			err := accountant.TrackAPIRateLimiting(map[string]int{"10.0.0.1": 3, "10.0.0.2": 1})
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackAPIRateLimiting(map[string]int{"10.0.0.1": 2})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["APIRateLimitedRequests"]).Should(BeNumerically("==", 6))
+			Ω(metrics["APIRateLimitedRequesters"]).Should(BeNumerically("==", 1))
+		})
+	})
+
+	Describe("TrackAPIRequestDeadlines", func() {
+		It("should add to the requests timed out and abandoned, and record the requests in flight", func() {
+			err := accountant.TrackAPIRequestDeadlines(2, 1, 5)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackAPIRequestDeadlines(1, 0, 3)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["APIRequestTimeouts"]).Should(BeNumerically("==", 3))
+			Ω(metrics["APIRequestsAbandoned"]).Should(BeNumerically("==", 1))
+			Ω(metrics["APIRequestsInFlight"]).Should(BeNumerically("==", 3))
+		})
+	})
+
 	Describe("TrackSavedHeartbeats", func() {
 		It("should record the number of received heartbeats appropriately", func() {
 			err := accountant.TrackSavedHeartbeats(91)
@@ -202,4 +630,98 @@ var _ = Describe("Metrics Accountant", func() {
 			})
 		})
 	})
+
+	Describe("IncrementStopCategoryMetrics", func() {
+		It("should count the stops sent by category and by initiator", func() {
+			categories := []models.StopCategory{
+				models.StopCategoryScaleDown,
+				models.StopCategoryAppStopped,
+				models.StopCategoryDuplicate,
+				models.StopCategoryDuplicate,
+				models.StopCategoryMismatchedVersion,
+				models.StopCategoryOperator,
+			}
+
+			err := accountant.IncrementStopCategoryMetrics(categories)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementStopCategoryMetrics([]models.StopCategory{models.StopCategoryEvacuation, models.StopCategoryInvalid})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["StopCategoryScaleDown"]).Should(BeNumerically("==", 1))
+			Ω(metrics["StopCategoryAppStopped"]).Should(BeNumerically("==", 1))
+			Ω(metrics["StopCategoryDuplicate"]).Should(BeNumerically("==", 2))
+			Ω(metrics["StopCategoryMismatchedVersion"]).Should(BeNumerically("==", 1))
+			Ω(metrics["StopCategoryEvacuation"]).Should(BeNumerically("==", 1))
+			Ω(metrics["StopCategoryOperator"]).Should(BeNumerically("==", 1))
+			Ω(metrics["StopsInitiatedByCC"]).Should(BeNumerically("==", 2))
+			Ω(metrics["StopsInitiatedByHM"]).Should(BeNumerically("==", 4))
+			Ω(metrics["StopsInitiatedByOperator"]).Should(BeNumerically("==", 1))
+		})
+
+		It("should return the error when the store fails", func() {
+			fakeStoreAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("metrics", errors.New("oops"))
+			err := accountant.IncrementStopCategoryMetrics([]models.StopCategory{models.StopCategoryDuplicate})
+			Ω(err).Should(Equal(errors.New("oops")))
+		})
+	})
+
+	Describe("IncrementDeduplicatedMessageMetrics", func() {
+		It("should count the deduplicated messages", func() {
+			starts := []models.PendingStartMessage{{}, {}}
+			stops := []models.PendingStopMessage{{}}
+
+			err := accountant.IncrementDeduplicatedMessageMetrics(starts, stops)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementDeduplicatedMessageMetrics(starts, []models.PendingStopMessage{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["DeduplicatedStartMessages"]).Should(BeNumerically("==", 4))
+			Ω(metrics["DeduplicatedStopMessages"]).Should(BeNumerically("==", 1))
+		})
+	})
+
+	Describe("TrackPendingMessageEnqueue", func() {
+		It("should record the latest enqueue's duration and count the conflicts", func() {
+			err := accountant.TrackPendingMessageEnqueue(storepackage.EnqueueResult{Conflicts: 2, Duration: 30 * time.Millisecond})
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.TrackPendingMessageEnqueue(storepackage.EnqueueResult{Conflicts: 1, Duration: 10 * time.Millisecond})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["PendingMessageEnqueueConflicts"]).Should(BeNumerically("==", 3))
+			Ω(metrics["PendingMessageEnqueueTimeInMilliseconds"]).Should(BeNumerically("==", 10))
+		})
+	})
+
+	Describe("a disabled accountant", func() {
+		BeforeEach(func() {
+			accountant = NewDisabled(store)
+		})
+
+		It("saves no metrics", func() {
+			err := accountant.TrackReceivedHeartbeats(127)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = accountant.IncrementStoreFailovers()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["ReceivedHeartbeats"]).Should(BeNumerically("==", 0))
+			Ω(metrics["StoreFailovers"]).Should(BeNumerically("==", 0))
+		})
+
+		It("still reads the metrics other components save", func() {
+			err := New(store).TrackReceivedHeartbeats(127)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			metrics, err := accountant.GetMetrics()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metrics["ReceivedHeartbeats"]).Should(BeNumerically("==", 127))
+		})
+	})
 })
@@ -0,0 +1,270 @@
+package natsconnection
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+)
+
+// Cluster is a set of NATS servers that share their subscriptions.  A
+// connection to a cluster may be to any of its servers.
+type Cluster struct {
+	Name    string
+	Servers []string
+}
+
+// FailoverConn is connected to one of an ordered list of NATS clusters at a
+// time: the first that accepts a connection.  CheckHealth pings the active
+// cluster; once it has failed to answer failureThreshold pings in a row the
+// connection moves to the first other cluster, in list order, that accepts a
+// connection.  Subscriptions and reconnection callbacks are carried over.
+//
+// onConnect is invoked whenever a cluster becomes active, with its position
+// in the list and whether it replaced a failed one.
+type FailoverConn struct {
+	clusters         []Cluster
+	dial             func(Cluster) (messagebus.MessageBus, error)
+	failureThreshold int
+	onConnect        func(index int, failedOver bool)
+	logger           logger.Logger
+
+	active              messagebus.MessageBus
+	activeIndex         int
+	consecutiveFailures int
+	subscriptions       map[*nats.Subscription]*subscription
+	reconnectedCBs      []func(*nats.Conn)
+	lock                *sync.Mutex
+}
+
+type subscription struct {
+	subject string
+	queue   string
+	handler nats.MsgHandler
+	current *nats.Subscription
+}
+
+func NewFailoverConn(clusters []Cluster, dial func(Cluster) (messagebus.MessageBus, error), failureThreshold int, onConnect func(index int, failedOver bool), logger logger.Logger) (*FailoverConn, error) {
+	conn := &FailoverConn{
+		clusters:         clusters,
+		dial:             dial,
+		failureThreshold: failureThreshold,
+		onConnect:        onConnect,
+		logger:           logger,
+		activeIndex:      -1,
+		subscriptions:    map[*nats.Subscription]*subscription{},
+		lock:             &sync.Mutex{},
+	}
+
+	err := conn.connect()
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ActiveCluster returns the position in the list, and the details, of the
+// cluster currently in use.
+func (conn *FailoverConn) ActiveCluster() (int, Cluster) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	return conn.activeIndex, conn.clusters[conn.activeIndex]
+}
+
+// MonitorHealth calls CheckHealth every interval, for ever.
+func (conn *FailoverConn) MonitorHealth(timeProvider timeprovider.TimeProvider, interval time.Duration) {
+	ticker := timeProvider.NewTickerChannel("nats-health-check", interval)
+	for _ = range ticker {
+		conn.CheckHealth()
+	}
+}
+
+// CheckHealth pings the active cluster and fails over if it has stopped
+// answering.  If no other cluster accepts a connection the active one is
+// kept and the next failed ping tries again.
+func (conn *FailoverConn) CheckHealth() {
+	conn.lock.Lock()
+	active := conn.active
+	conn.lock.Unlock()
+
+	if active.Ping() {
+		conn.lock.Lock()
+		conn.consecutiveFailures = 0
+		conn.lock.Unlock()
+		return
+	}
+
+	conn.lock.Lock()
+	conn.consecutiveFailures++
+	failures := conn.consecutiveFailures
+	cluster := conn.clusters[conn.activeIndex]
+	conn.lock.Unlock()
+
+	conn.logger.Error("NATS cluster failed a health check", errors.New("ping timed out"), map[string]string{
+		"Cluster":              cluster.Name,
+		"Consecutive Failures": strconv.Itoa(failures),
+		"Failure Threshold":    strconv.Itoa(conn.failureThreshold),
+	})
+
+	if failures >= conn.failureThreshold {
+		err := conn.connect()
+		if err != nil {
+			conn.logger.Error("Failed to fail over to another NATS cluster", err)
+		}
+	}
+}
+
+// connect makes the first cluster, other than the active one, that accepts a
+// connection active.
+func (conn *FailoverConn) connect() error {
+	conn.lock.Lock()
+	previousIndex := conn.activeIndex
+	conn.lock.Unlock()
+
+	failures := []string{}
+	for index, cluster := range conn.clusters {
+		if index == previousIndex {
+			continue
+		}
+
+		natsConn, err := conn.dial(cluster)
+		if err != nil {
+			conn.logger.Error("Failed to connect to NATS cluster", err, map[string]string{
+				"Cluster": cluster.Name,
+				"Servers": strings.Join(cluster.Servers, ","),
+			})
+			failures = append(failures, cluster.Name+": "+err.Error())
+			continue
+		}
+
+		conn.switchTo(index, natsConn)
+		return nil
+	}
+
+	if len(failures) == 0 {
+		return errors.New("no other NATS cluster is configured")
+	}
+	return errors.New("no NATS cluster accepted a connection (" + strings.Join(failures, "; ") + ")")
+}
+
+func (conn *FailoverConn) switchTo(index int, natsConn messagebus.MessageBus) {
+	conn.lock.Lock()
+	previous := conn.active
+	failedOver := previous != nil
+
+	for _, sub := range conn.subscriptions {
+		current, err := subscribe(natsConn, sub.subject, sub.queue, sub.handler)
+		if err != nil {
+			conn.logger.Error("Failed to carry a subscription over to the new NATS cluster", err, map[string]string{
+				"Subject": sub.subject,
+			})
+			continue
+		}
+		sub.current = current
+	}
+	for _, handler := range conn.reconnectedCBs {
+		natsConn.AddReconnectedCB(handler)
+	}
+
+	conn.active = natsConn
+	conn.activeIndex = index
+	conn.consecutiveFailures = 0
+	conn.lock.Unlock()
+
+	if failedOver {
+		previous.Close()
+		conn.logger.Info("Failed over to another NATS cluster", map[string]string{
+			"Cluster": conn.clusters[index].Name,
+			"Servers": strings.Join(conn.clusters[index].Servers, ","),
+		})
+	} else {
+		conn.logger.Info("Connected to NATS cluster", map[string]string{
+			"Cluster": conn.clusters[index].Name,
+			"Servers": strings.Join(conn.clusters[index].Servers, ","),
+		})
+	}
+
+	if conn.onConnect != nil {
+		conn.onConnect(index, failedOver)
+	}
+}
+
+func (conn *FailoverConn) activeConn() messagebus.MessageBus {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	return conn.active
+}
+
+func (conn *FailoverConn) Close() {
+	conn.activeConn().Close()
+}
+
+func (conn *FailoverConn) Publish(subject string, data []byte) error {
+	return conn.activeConn().Publish(subject, data)
+}
+
+func (conn *FailoverConn) PublishRequest(subject, reply string, data []byte) error {
+	return conn.activeConn().PublishRequest(subject, reply, data)
+}
+
+func (conn *FailoverConn) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	return conn.QueueSubscribe(subject, "", handler)
+}
+
+// QueueSubscribe returns the subscription made on the cluster active at the
+// time.  It remains the handle for Unsubscribe after a failover.
+func (conn *FailoverConn) QueueSubscribe(subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+
+	current, err := subscribe(conn.active, subject, queue, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.subscriptions[current] = &subscription{
+		subject: subject,
+		queue:   queue,
+		handler: handler,
+		current: current,
+	}
+	return current, nil
+}
+
+func (conn *FailoverConn) Unsubscribe(handle *nats.Subscription) error {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+
+	sub, ok := conn.subscriptions[handle]
+	if !ok {
+		return conn.active.Unsubscribe(handle)
+	}
+
+	delete(conn.subscriptions, handle)
+	return conn.active.Unsubscribe(sub.current)
+}
+
+func (conn *FailoverConn) Ping() bool {
+	return conn.activeConn().Ping()
+}
+
+func (conn *FailoverConn) AddReconnectedCB(handler func(*nats.Conn)) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+
+	conn.reconnectedCBs = append(conn.reconnectedCBs, handler)
+	conn.active.AddReconnectedCB(handler)
+}
+
+func subscribe(natsConn messagebus.MessageBus, subject string, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	if queue == "" {
+		return natsConn.Subscribe(subject, handler)
+	}
+	return natsConn.QueueSubscribe(subject, queue, handler)
+}
@@ -0,0 +1,201 @@
+package natsconnection_test
+
+import (
+	"errors"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	. "github.com/cloudfoundry/hm9000/helpers/natsconnection"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type pingableConn struct {
+	*fakeyagnats.FakeNATSConn
+	healthy bool
+	closed  bool
+}
+
+func (conn *pingableConn) Ping() bool {
+	return conn.healthy
+}
+
+func (conn *pingableConn) Close() {
+	conn.closed = true
+}
+
+var _ = Describe("FailoverConn", func() {
+	var (
+		clusters    []Cluster
+		conns       map[string]*pingableConn
+		unreachable map[string]bool
+		connects    [][]interface{}
+		conn        *FailoverConn
+	)
+
+	dial := func(cluster Cluster) (messagebus.MessageBus, error) {
+		if unreachable[cluster.Name] {
+			return nil, errors.New("connection refused")
+		}
+		conns[cluster.Name] = &pingableConn{FakeNATSConn: fakeyagnats.Connect(), healthy: true}
+		return conns[cluster.Name], nil
+	}
+
+	connect := func() {
+		var err error
+		conn, err = NewFailoverConn(clusters, dial, 2, func(index int, failedOver bool) {
+			connects = append(connects, []interface{}{index, failedOver})
+		}, fakelogger.NewFakeLogger())
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		clusters = []Cluster{
+			{Name: "z1", Servers: []string{"nats://10.0.1.1:4222"}},
+			{Name: "z2", Servers: []string{"nats://10.0.2.1:4222"}},
+			{Name: "z3", Servers: []string{"nats://10.0.3.1:4222"}},
+		}
+		conns = map[string]*pingableConn{}
+		unreachable = map[string]bool{}
+		connects = [][]interface{}{}
+	})
+
+	Describe("connecting", func() {
+		It("connects to the first cluster", func() {
+			connect()
+			index, cluster := conn.ActiveCluster()
+			Ω(index).Should(Equal(0))
+			Ω(cluster.Name).Should(Equal("z1"))
+			Ω(connects).Should(Equal([][]interface{}{{0, false}}))
+		})
+
+		It("skips clusters that cannot be reached", func() {
+			unreachable["z1"] = true
+			connect()
+			index, _ := conn.ActiveCluster()
+			Ω(index).Should(Equal(1))
+		})
+
+		It("fails when no cluster can be reached", func() {
+			unreachable["z1"], unreachable["z2"], unreachable["z3"] = true, true, true
+			_, err := NewFailoverConn(clusters, dial, 2, nil, fakelogger.NewFakeLogger())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("health checks", func() {
+		BeforeEach(func() {
+			connect()
+		})
+
+		It("stays put while the active cluster answers", func() {
+			conn.CheckHealth()
+			conn.CheckHealth()
+			index, _ := conn.ActiveCluster()
+			Ω(index).Should(Equal(0))
+		})
+
+		It("fails over to the next cluster once the threshold is reached", func() {
+			conns["z1"].healthy = false
+
+			conn.CheckHealth()
+			index, _ := conn.ActiveCluster()
+			Ω(index).Should(Equal(0))
+
+			conn.CheckHealth()
+			index, _ = conn.ActiveCluster()
+			Ω(index).Should(Equal(1))
+			Ω(conns["z1"].closed).Should(BeTrue())
+			Ω(connects).Should(Equal([][]interface{}{{0, false}, {1, true}}))
+		})
+
+		It("only counts consecutive failures", func() {
+			conns["z1"].healthy = false
+			conn.CheckHealth()
+			conns["z1"].healthy = true
+			conn.CheckHealth()
+			conns["z1"].healthy = false
+			conn.CheckHealth()
+
+			index, _ := conn.ActiveCluster()
+			Ω(index).Should(Equal(0))
+		})
+
+		It("prefers clusters earlier in the list when failing over", func() {
+			conns["z1"].healthy = false
+			conn.CheckHealth()
+			conn.CheckHealth()
+
+			conns["z2"].healthy = false
+			conn.CheckHealth()
+			conn.CheckHealth()
+
+			index, _ := conn.ActiveCluster()
+			Ω(index).Should(Equal(0))
+		})
+
+		It("keeps the active cluster when no other can be reached", func() {
+			unreachable["z2"], unreachable["z3"] = true, true
+			conns["z1"].healthy = false
+			conn.CheckHealth()
+			conn.CheckHealth()
+
+			index, _ := conn.ActiveCluster()
+			Ω(index).Should(Equal(0))
+			Ω(conns["z1"].closed).Should(BeFalse())
+		})
+	})
+
+	Describe("failing over", func() {
+		var received []string
+
+		BeforeEach(func() {
+			connect()
+			received = []string{}
+		})
+
+		failOver := func() {
+			conns["z1"].healthy = false
+			conn.CheckHealth()
+			conn.CheckHealth()
+		}
+
+		It("carries subscriptions over", func() {
+			_, err := conn.Subscribe("dea.heartbeat", func(*nats.Msg) { received = append(received, "heartbeat") })
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = conn.QueueSubscribe("dea.advertise", "hm9000", func(*nats.Msg) { received = append(received, "advertise") })
+			Ω(err).ShouldNot(HaveOccurred())
+
+			failOver()
+
+			Ω(conns["z2"].Subscriptions("dea.heartbeat")).Should(HaveLen(1))
+			Ω(conns["z2"].Subscriptions("dea.advertise")).Should(HaveLen(1))
+			Ω(conns["z2"].Subscriptions("dea.advertise")[0].Queue).Should(Equal("hm9000"))
+
+			conns["z2"].SubjectCallbacks("dea.heartbeat")[0](&nats.Msg{})
+			Ω(received).Should(Equal([]string{"heartbeat"}))
+		})
+
+		It("unsubscribes from the active cluster using the original handle", func() {
+			subscription, err := conn.Subscribe("dea.heartbeat", func(*nats.Msg) {})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			failOver()
+
+			err = conn.Unsubscribe(subscription)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(conns["z2"].Subscriptions("dea.heartbeat")).Should(BeEmpty())
+		})
+
+		It("publishes to the active cluster", func() {
+			failOver()
+
+			err := conn.Publish("hm9000.start", []byte("start"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(conns["z1"].PublishedMessages("hm9000.start")).Should(BeEmpty())
+			Ω(conns["z2"].PublishedMessages("hm9000.start")).Should(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,97 @@
+package natsconnection
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"time"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+)
+
+const pingTimeout = 500 * time.Millisecond
+
+// DefaultOptions are the options yagnats.Connect uses: keep reconnecting,
+// twice a second, for ever.
+func DefaultOptions(servers []string) nats.Options {
+	options := nats.DefaultOptions
+	options.Servers = servers
+	options.ReconnectWait = 500 * time.Millisecond
+	options.MaxReconnect = -1
+	return options
+}
+
+// AddReconnectJitter lengthens the wait between reconnection attempts by a
+// random amount of up to jitter, so that every component does not hammer a
+// restarted NATS server at the same moment.
+func AddReconnectJitter(options *nats.Options, jitter time.Duration) {
+	if jitter > 0 {
+		random := rand.New(rand.NewSource(time.Now().UnixNano()))
+		options.ReconnectWait += time.Duration(random.Int63n(int64(jitter)))
+	}
+}
+
+// Connect is yagnats.Connect with control over the connection options (for
+// instance TLS, which yagnats.Connect cannot be asked for).
+func Connect(options nats.Options) (messagebus.MessageBus, error) {
+	natsConn, err := options.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return &conn{natsConn}, nil
+}
+
+// TLSConfig builds the TLS configuration for connecting to NATS.  An empty
+// caCertFile trusts the system's roots.  certFile and keyFile present a
+// client certificate and must be given together.
+func TLSConfig(caCertFile string, certFile string, keyFile string, skipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: skipVerify,
+	}
+
+	if caCertFile != "" {
+		caCert, err := ioutil.ReadFile(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("%s contains no PEM encoded certificates", caCertFile)
+		}
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("a client certificate needs both a certificate and a key")
+	}
+
+	if certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+type conn struct {
+	*nats.Conn
+}
+
+func (c *conn) Unsubscribe(subscription *nats.Subscription) error {
+	return subscription.Unsubscribe()
+}
+
+func (c *conn) Ping() bool {
+	return c.FlushTimeout(pingTimeout) == nil
+}
+
+func (c *conn) AddReconnectedCB(handler func(*nats.Conn)) {
+	c.Conn.Opts.ReconnectedCB = handler
+}
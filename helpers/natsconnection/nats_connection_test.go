@@ -0,0 +1,108 @@
+package natsconnection_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/helpers/natsconnection"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NATS connections", func() {
+	Describe("DefaultOptions", func() {
+		It("reconnects for ever", func() {
+			options := DefaultOptions([]string{"nats://127.0.0.1:4222"})
+			Ω(options.Servers).Should(Equal([]string{"nats://127.0.0.1:4222"}))
+			Ω(options.MaxReconnect).Should(Equal(-1))
+			Ω(options.ReconnectWait).Should(Equal(500 * time.Millisecond))
+		})
+	})
+
+	Describe("TLSConfig", func() {
+		var (
+			dir      string
+			certFile string
+			keyFile  string
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "hm9000_nats_tls")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			key, err := rsa.GenerateKey(rand.Reader, 1024)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			template := &x509.Certificate{
+				SerialNumber:          big.NewInt(1),
+				Subject:               pkix.Name{CommonName: "nats"},
+				NotBefore:             time.Now().Add(-time.Hour),
+				NotAfter:              time.Now().Add(time.Hour),
+				IsCA:                  true,
+				BasicConstraintsValid: true,
+				KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			}
+			certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			certFile = filepath.Join(dir, "nats.crt")
+			keyFile = filepath.Join(dir, "nats.key")
+			err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0600)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("trusts the system's roots by default", func() {
+			tlsConfig, err := TLSConfig("", "", "", false)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(tlsConfig.RootCAs).Should(BeNil())
+			Ω(tlsConfig.Certificates).Should(BeEmpty())
+			Ω(tlsConfig.InsecureSkipVerify).Should(BeFalse())
+		})
+
+		It("trusts the given CA", func() {
+			tlsConfig, err := TLSConfig(certFile, "", "", false)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(tlsConfig.RootCAs).ShouldNot(BeNil())
+		})
+
+		It("presents the given client certificate", func() {
+			tlsConfig, err := TLSConfig("", certFile, keyFile, true)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(tlsConfig.Certificates).Should(HaveLen(1))
+			Ω(tlsConfig.InsecureSkipVerify).Should(BeTrue())
+		})
+
+		It("rejects a CA file without certificates", func() {
+			_, err := TLSConfig(keyFile, "", "", false)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects files that do not exist", func() {
+			_, err := TLSConfig(filepath.Join(dir, "missing.crt"), "", "", false)
+			Ω(err).Should(HaveOccurred())
+
+			_, err = TLSConfig("", filepath.Join(dir, "missing.crt"), keyFile, false)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects a certificate without a key", func() {
+			_, err := TLSConfig("", certFile, "", false)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package natsconnection_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNatsconnection(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Natsconnection Suite")
+}
@@ -0,0 +1,129 @@
+package pidfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// A PID file holds the pid of the process that created it, and is locked
+// (with flock) for as long as that process runs.  The lock is what keeps a
+// second copy of the process from starting: the kernel releases it when the
+// process dies, however it dies, so a PID file left behind by a crash is
+// stale rather than an obstacle.
+type PIDFile struct {
+	Path string
+	PID  int
+
+	// StalePID is the pid in the stale PID file this one replaced, or 0.
+	StalePID int
+
+	file *os.File
+}
+
+// ErrAlreadyRunning is returned by Create when another process holds the
+// PID file.  PID is the pid it holds, or 0 if that could not be read.
+type ErrAlreadyRunning struct {
+	Path string
+	PID  int
+}
+
+func (err ErrAlreadyRunning) Error() string {
+	if err.PID == 0 {
+		return fmt.Sprintf("%s is held by another process", err.Path)
+	}
+	return fmt.Sprintf("%s is held by process %d, which is still running", err.Path, err.PID)
+}
+
+// Create creates and locks the PID file at path, writing this process's pid
+// into it.  A PID file that exists but is not locked is stale, and is
+// replaced.
+func Create(path string) (*PIDFile, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == syscall.EWOULDBLOCK {
+			pid, _ := readPID(file)
+			file.Close()
+			return nil, ErrAlreadyRunning{Path: path, PID: pid}
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		// The process that held the lock may have removed the file between
+		// our opening and locking it, leaving us holding the lock on a file
+		// that no longer has a path.
+		if !isAt(file, path) {
+			file.Close()
+			continue
+		}
+
+		pidFile := &PIDFile{Path: path, PID: os.Getpid(), file: file}
+		pidFile.StalePID, _ = readPID(file)
+
+		err = pidFile.write()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return pidFile, nil
+	}
+
+	return nil, fmt.Errorf("%s was removed each time it was locked", path)
+}
+
+// Remove removes the PID file, unless it has been replaced, and releases
+// its lock.
+func (pidFile *PIDFile) Remove() error {
+	var err error
+	if isAt(pidFile.file, pidFile.Path) {
+		err = os.Remove(pidFile.Path)
+	}
+	pidFile.file.Close()
+	return err
+}
+
+func (pidFile *PIDFile) write() error {
+	err := pidFile.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = pidFile.file.WriteAt([]byte(strconv.Itoa(pidFile.PID)+"\n"), 0)
+	if err != nil {
+		return err
+	}
+	return pidFile.file.Sync()
+}
+
+func readPID(file *os.File) (int, error) {
+	_, err := file.Seek(0, 0)
+	if err != nil {
+		return 0, err
+	}
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(contents)))
+}
+
+func isAt(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	atPath, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, atPath)
+}
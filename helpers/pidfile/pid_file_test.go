@@ -0,0 +1,112 @@
+package pidfile_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/cloudfoundry/hm9000/helpers/pidfile"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PID files", func() {
+	var (
+		dir  string
+		path string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "pidfile")
+		Ω(err).ShouldNot(HaveOccurred())
+		path = filepath.Join(dir, "sender.pid")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	contents := func() string {
+		written, err := ioutil.ReadFile(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		return string(written)
+	}
+
+	It("writes the pid of the process", func() {
+		pidFile, err := Create(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer pidFile.Remove()
+
+		Ω(pidFile.PID).Should(Equal(os.Getpid()))
+		Ω(pidFile.StalePID).Should(BeZero())
+		Ω(contents()).Should(Equal(strconv.Itoa(os.Getpid()) + "\n"))
+	})
+
+	It("refuses to create a PID file that is held", func() {
+		pidFile, err := Create(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer pidFile.Remove()
+
+		_, err = Create(path)
+		Ω(err).Should(Equal(ErrAlreadyRunning{Path: path, PID: os.Getpid()}))
+		Ω(err.Error()).Should(ContainSubstring("still running"))
+		Ω(contents()).Should(Equal(strconv.Itoa(os.Getpid()) + "\n"))
+	})
+
+	It("replaces a stale PID file", func() {
+		err := ioutil.WriteFile(path, []byte("4194304000\n"), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		pidFile, err := Create(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer pidFile.Remove()
+
+		Ω(pidFile.StalePID).Should(Equal(4194304000))
+		Ω(contents()).Should(Equal(strconv.Itoa(os.Getpid()) + "\n"))
+	})
+
+	It("replaces a PID file it cannot read", func() {
+		err := ioutil.WriteFile(path, []byte("a much longer line of garbage than a pid"), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		pidFile, err := Create(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer pidFile.Remove()
+
+		Ω(pidFile.StalePID).Should(BeZero())
+		Ω(contents()).Should(Equal(strconv.Itoa(os.Getpid()) + "\n"))
+	})
+
+	It("fails when the PID file cannot be created", func() {
+		_, err := Create(filepath.Join(dir, "missing", "sender.pid"))
+		Ω(err).Should(HaveOccurred())
+	})
+
+	Describe("removing", func() {
+		It("removes the PID file and releases it", func() {
+			pidFile, err := Create(path)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(pidFile.Remove()).Should(Succeed())
+			_, err = os.Stat(path)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+
+			pidFile, err = Create(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			pidFile.Remove()
+		})
+
+		It("leaves a PID file that has replaced it", func() {
+			pidFile, err := Create(path)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(os.Remove(path)).Should(Succeed())
+			Ω(ioutil.WriteFile(path, []byte("12\n"), 0644)).Should(Succeed())
+
+			Ω(pidFile.Remove()).Should(Succeed())
+			Ω(contents()).Should(Equal("12\n"))
+		})
+	})
+})
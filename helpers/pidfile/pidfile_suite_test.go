@@ -0,0 +1,13 @@
+package pidfile_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPIDFile(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "PID File Suite")
+}
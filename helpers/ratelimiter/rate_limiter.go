@@ -0,0 +1,129 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+)
+
+// OverflowRequester is the requester the requests of those beyond
+// maxRequesters are counted against.
+const OverflowRequester = "overflow"
+
+// RateLimiter keeps a token bucket per requester.  Each bucket holds up to
+// burst tokens and refills at ratePerSecond tokens a second; a request takes
+// a token, and is rejected when its requester's bucket is empty.  With
+// maxRequesters set, no more than that many buckets are kept: once they are
+// all in use, the new requesters share OverflowRequester's.
+type RateLimiter struct {
+	timeProvider  timeprovider.TimeProvider
+	ratePerSecond float64
+	burst         float64
+	maxRequesters int
+
+	buckets   map[string]*bucket
+	rejected  map[string]int
+	lastSweep time.Time
+	lock      *sync.Mutex
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+func New(timeProvider timeprovider.TimeProvider, ratePerSecond int, burst int, maxRequesters int) *RateLimiter {
+	return &RateLimiter{
+		timeProvider:  timeProvider,
+		ratePerSecond: float64(ratePerSecond),
+		burst:         float64(burst),
+		maxRequesters: maxRequesters,
+		buckets:       map[string]*bucket{},
+		rejected:      map[string]int{},
+		lock:          &sync.Mutex{},
+	}
+}
+
+// Allow takes a token from requester's bucket, and returns false, counting
+// the rejection, when there is none left.
+func (limiter *RateLimiter) Allow(requester string) bool {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	now := limiter.timeProvider.Time()
+	b, found := limiter.buckets[requester]
+	if !found && limiter.isFull(now) {
+		requester = OverflowRequester
+		b, found = limiter.buckets[requester]
+	}
+	if !found {
+		b = &bucket{tokens: limiter.burst, updatedAt: now}
+		limiter.buckets[requester] = b
+	}
+	limiter.refill(b, now)
+
+	if b.tokens < 1 {
+		limiter.rejected[requester]++
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RetryAfter is how long a rejected requester has to wait for its next
+// token.
+func (limiter *RateLimiter) RetryAfter() time.Duration {
+	return time.Duration(float64(time.Second) / limiter.ratePerSecond)
+}
+
+// Rejections returns how many requests each requester has had rejected since
+// the last call, and forgets the requesters whose buckets have filled back
+// up, so that the limiter does not grow with every requester it has seen.
+func (limiter *RateLimiter) Rejections() map[string]int {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	limiter.forgetFullBuckets(limiter.timeProvider.Time())
+
+	rejected := limiter.rejected
+	limiter.rejected = map[string]int{}
+	return rejected
+}
+
+// isFull is true when maxRequesters buckets are in use, once those that
+// have filled back up are forgotten.  It looks for them no more than once a
+// second, so that a flood of new requesters does not sweep the buckets on
+// every request.
+func (limiter *RateLimiter) isFull(now time.Time) bool {
+	if limiter.maxRequesters <= 0 || len(limiter.buckets) < limiter.maxRequesters {
+		return false
+	}
+	if now.Sub(limiter.lastSweep) >= time.Second {
+		limiter.forgetFullBuckets(now)
+	}
+	return len(limiter.buckets) >= limiter.maxRequesters
+}
+
+func (limiter *RateLimiter) forgetFullBuckets(now time.Time) {
+	limiter.lastSweep = now
+	for requester, b := range limiter.buckets {
+		limiter.refill(b, now)
+		if b.tokens >= limiter.burst {
+			delete(limiter.buckets, requester)
+		}
+	}
+}
+
+func (limiter *RateLimiter) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.updatedAt)
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens += elapsed.Seconds() * limiter.ratePerSecond
+	if b.tokens > limiter.burst {
+		b.tokens = limiter.burst
+	}
+	b.updatedAt = now
+}
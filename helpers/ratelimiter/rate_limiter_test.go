@@ -0,0 +1,98 @@
+package ratelimiter_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	. "github.com/cloudfoundry/hm9000/helpers/ratelimiter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimiter", func() {
+	var (
+		timeProvider *faketimeprovider.FakeTimeProvider
+		limiter      *RateLimiter
+	)
+
+	BeforeEach(func() {
+		timeProvider = &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}
+		limiter = New(timeProvider, 2, 3, 0)
+	})
+
+	allowed := func(requester string, requests int) int {
+		count := 0
+		for i := 0; i < requests; i++ {
+			if limiter.Allow(requester) {
+				count++
+			}
+		}
+		return count
+	}
+
+	It("allows a burst, then rejects requests until the bucket refills", func() {
+		Ω(allowed("cc", 5)).Should(Equal(3))
+
+		timeProvider.IncrementBySeconds(1)
+		Ω(allowed("cc", 5)).Should(Equal(2))
+	})
+
+	It("never refills past the burst", func() {
+		timeProvider.IncrementBySeconds(60)
+		Ω(allowed("cc", 5)).Should(Equal(3))
+	})
+
+	It("limits each requester separately", func() {
+		Ω(allowed("cc", 5)).Should(Equal(3))
+		Ω(allowed("script", 1)).Should(Equal(1))
+	})
+
+	It("retries after the time a token takes", func() {
+		Ω(limiter.RetryAfter()).Should(Equal(500 * time.Millisecond))
+	})
+
+	Describe("with a cap on the requesters", func() {
+		BeforeEach(func() {
+			limiter = New(timeProvider, 2, 3, 2)
+		})
+
+		It("makes the requesters beyond the cap share one bucket", func() {
+			allowed("cc", 1)
+			allowed("script", 1)
+
+			Ω(allowed("flood-1", 2)).Should(Equal(2))
+			Ω(allowed("flood-2", 2)).Should(Equal(1))
+			Ω(allowed("cc", 1)).Should(Equal(1))
+			Ω(limiter.Rejections()).Should(Equal(map[string]int{OverflowRequester: 1}))
+		})
+
+		It("makes room once the buckets in use have filled back up", func() {
+			allowed("cc", 1)
+			allowed("script", 1)
+			timeProvider.IncrementBySeconds(1)
+
+			Ω(allowed("newcomer", 3)).Should(Equal(3))
+			Ω(allowed("newcomer", 1)).Should(BeZero())
+			Ω(limiter.Rejections()).Should(Equal(map[string]int{"newcomer": 1}))
+		})
+	})
+
+	Describe("Rejections", func() {
+		It("counts the rejected requests of each requester since it was last called", func() {
+			allowed("cc", 5)
+			allowed("script", 4)
+			allowed("quiet", 1)
+
+			Ω(limiter.Rejections()).Should(Equal(map[string]int{"cc": 2, "script": 1}))
+			Ω(limiter.Rejections()).Should(BeEmpty())
+		})
+
+		It("forgets the requesters whose buckets are full again", func() {
+			allowed("cc", 5)
+			timeProvider.IncrementBySeconds(2)
+			limiter.Rejections()
+
+			Ω(allowed("cc", 5)).Should(Equal(3))
+		})
+	})
+})
@@ -0,0 +1,107 @@
+package readiness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A Notifier tells whatever started the process when it is ready, in the
+// two ways orchestration looks for: a state message on the notify socket,
+// the same datagram that systemd's sd_notify sends, and a ready file that
+// exists only while the process is ready.  Either may be turned off by
+// leaving it empty.
+type Notifier struct {
+	socket string
+	file   string
+}
+
+// New notifies over socket, usually the NOTIFY_SOCKET that systemd sets,
+// and writes file.  A socket starting with @ is in the abstract namespace.
+func New(socket string, file string) *Notifier {
+	return &Notifier{
+		socket: socket,
+		file:   file,
+	}
+}
+
+// Ready sends READY=1 and writes the ready file, which holds the pid of the
+// process.
+func (notifier *Notifier) Ready() error {
+	err := notifier.notify(fmt.Sprintf("READY=1\nMAINPID=%d\n", os.Getpid()))
+	if err != nil {
+		return err
+	}
+	return notifier.writeFile()
+}
+
+// Stopping sends STOPPING=1 and removes the ready file.
+func (notifier *Notifier) Stopping() error {
+	err := notifier.notify("STOPPING=1\n")
+	if err != nil {
+		return err
+	}
+	return Clear(notifier.file)
+}
+
+// Clear removes a ready file left behind by an earlier process, so that it
+// does not pass for this one's.
+func Clear(file string) error {
+	if file == "" {
+		return nil
+	}
+	err := os.Remove(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (notifier *Notifier) notify(state string) error {
+	if notifier.socket == "" {
+		return nil
+	}
+
+	name := notifier.socket
+	if strings.HasPrefix(name, "@") {
+		name = "\x00" + name[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// writeFile writes the ready file by renaming a temporary file into place,
+// so that whoever is waiting for it never reads it half written.
+func (notifier *Notifier) writeFile() error {
+	if notifier.file == "" {
+		return nil
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(notifier.file), filepath.Base(notifier.file))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(temp, "%d\n", os.Getpid())
+	closeErr := temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), notifier.file)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package readiness_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/helpers/readiness"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Readiness", func() {
+	var (
+		dir       string
+		readyFile string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "readiness")
+		Ω(err).ShouldNot(HaveOccurred())
+		readyFile = filepath.Join(dir, "listener.ready")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("the notify socket", func() {
+		var socket *net.UnixConn
+
+		BeforeEach(func() {
+			var err error
+			socket, err = net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "notify"), Net: "unixgram"})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			socket.Close()
+		})
+
+		received := func() string {
+			socket.SetReadDeadline(time.Now().Add(time.Second))
+			buffer := make([]byte, 1024)
+			n, err := socket.Read(buffer)
+			Ω(err).ShouldNot(HaveOccurred())
+			return string(buffer[:n])
+		}
+
+		It("is sent READY=1 and the pid when the process is ready", func() {
+			Ω(New(filepath.Join(dir, "notify"), "").Ready()).Should(Succeed())
+			Ω(received()).Should(Equal(fmt.Sprintf("READY=1\nMAINPID=%d\n", os.Getpid())))
+		})
+
+		It("is sent STOPPING=1 when the process stops", func() {
+			Ω(New(filepath.Join(dir, "notify"), "").Stopping()).Should(Succeed())
+			Ω(received()).Should(Equal("STOPPING=1\n"))
+		})
+
+		It("fails when nothing is listening", func() {
+			Ω(New(filepath.Join(dir, "nobody"), "").Ready()).ShouldNot(Succeed())
+		})
+	})
+
+	Describe("the ready file", func() {
+		It("is written, with the pid, when the process is ready", func() {
+			Ω(New("", readyFile).Ready()).Should(Succeed())
+
+			contents, err := ioutil.ReadFile(readyFile)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(contents)).Should(Equal(fmt.Sprintf("%d\n", os.Getpid())))
+
+			entries, err := ioutil.ReadDir(dir)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(HaveLen(1), "the temporary file is renamed into place")
+		})
+
+		It("is removed when the process stops", func() {
+			notifier := New("", readyFile)
+			Ω(notifier.Ready()).Should(Succeed())
+			Ω(notifier.Stopping()).Should(Succeed())
+
+			_, err := os.Stat(readyFile)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+		})
+
+		It("can be cleared whether or not it exists", func() {
+			Ω(ioutil.WriteFile(readyFile, []byte("12\n"), 0644)).Should(Succeed())
+			Ω(Clear(readyFile)).Should(Succeed())
+			_, err := os.Stat(readyFile)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+
+			Ω(Clear(readyFile)).Should(Succeed())
+			Ω(Clear("")).Should(Succeed())
+		})
+
+		It("fails when its directory does not exist", func() {
+			Ω(New("", filepath.Join(dir, "missing", "listener.ready")).Ready()).ShouldNot(Succeed())
+		})
+	})
+
+	It("does nothing with neither a socket nor a file", func() {
+		notifier := New("", "")
+		Ω(notifier.Ready()).Should(Succeed())
+		Ω(notifier.Stopping()).Should(Succeed())
+	})
+})
@@ -0,0 +1,213 @@
+package readthroughcache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// ReadThroughCache wraps a StoreAdapter and serves repeated Get and
+// ListRecursively calls for a configured set of key prefixes out of memory.
+// Entries expire after ttl and the cache never holds more than maxEntries.
+// Writes made through the cache invalidate any affected entries; writes made
+// by other processes are only observed once the entry expires.
+type ReadThroughCache struct {
+	storeadapter.StoreAdapter
+
+	timeProvider      timeprovider.TimeProvider
+	ttl               time.Duration
+	maxEntries        int
+	cacheablePrefixes []string
+
+	entries map[string]*list.Element
+	lru     *list.List
+	lock    *sync.Mutex
+}
+
+type entry struct {
+	cacheKey  string
+	key       string
+	node      storeadapter.StoreNode
+	err       error
+	expiresAt time.Time
+}
+
+const (
+	getOperation  = "get:"
+	listOperation = "list:"
+)
+
+func New(adapter storeadapter.StoreAdapter, timeProvider timeprovider.TimeProvider, ttl time.Duration, maxEntries int, cacheablePrefixes []string) *ReadThroughCache {
+	return &ReadThroughCache{
+		StoreAdapter:      adapter,
+		timeProvider:      timeProvider,
+		ttl:               ttl,
+		maxEntries:        maxEntries,
+		cacheablePrefixes: cacheablePrefixes,
+		entries:           map[string]*list.Element{},
+		lru:               list.New(),
+		lock:              &sync.Mutex{},
+	}
+}
+
+func (cache *ReadThroughCache) Get(key string) (storeadapter.StoreNode, error) {
+	return cache.readThrough(getOperation, key, cache.StoreAdapter.Get)
+}
+
+func (cache *ReadThroughCache) ListRecursively(key string) (storeadapter.StoreNode, error) {
+	return cache.readThrough(listOperation, key, cache.StoreAdapter.ListRecursively)
+}
+
+func (cache *ReadThroughCache) Len() int {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return cache.lru.Len()
+}
+
+func (cache *ReadThroughCache) Create(node storeadapter.StoreNode) error {
+	defer cache.invalidate(node.Key)
+	return cache.StoreAdapter.Create(node)
+}
+
+func (cache *ReadThroughCache) Update(node storeadapter.StoreNode) error {
+	defer cache.invalidate(node.Key)
+	return cache.StoreAdapter.Update(node)
+}
+
+func (cache *ReadThroughCache) CompareAndSwap(oldNode storeadapter.StoreNode, newNode storeadapter.StoreNode) error {
+	defer cache.invalidate(newNode.Key)
+	return cache.StoreAdapter.CompareAndSwap(oldNode, newNode)
+}
+
+func (cache *ReadThroughCache) CompareAndSwapByIndex(prevIndex uint64, newNode storeadapter.StoreNode) error {
+	defer cache.invalidate(newNode.Key)
+	return cache.StoreAdapter.CompareAndSwapByIndex(prevIndex, newNode)
+}
+
+func (cache *ReadThroughCache) SetMulti(nodes []storeadapter.StoreNode) error {
+	defer cache.invalidate(keysForNodes(nodes)...)
+	return cache.StoreAdapter.SetMulti(nodes)
+}
+
+func (cache *ReadThroughCache) Delete(keys ...string) error {
+	defer cache.invalidate(keys...)
+	return cache.StoreAdapter.Delete(keys...)
+}
+
+func (cache *ReadThroughCache) DeleteLeaves(keys ...string) error {
+	defer cache.invalidate(keys...)
+	return cache.StoreAdapter.DeleteLeaves(keys...)
+}
+
+func (cache *ReadThroughCache) CompareAndDelete(nodes ...storeadapter.StoreNode) error {
+	defer cache.invalidate(keysForNodes(nodes)...)
+	return cache.StoreAdapter.CompareAndDelete(nodes...)
+}
+
+func (cache *ReadThroughCache) CompareAndDeleteByIndex(nodes ...storeadapter.StoreNode) error {
+	defer cache.invalidate(keysForNodes(nodes)...)
+	return cache.StoreAdapter.CompareAndDeleteByIndex(nodes...)
+}
+
+func (cache *ReadThroughCache) UpdateDirTTL(key string, ttl uint64) error {
+	defer cache.invalidate(key)
+	return cache.StoreAdapter.UpdateDirTTL(key, ttl)
+}
+
+func (cache *ReadThroughCache) readThrough(operation string, key string, fetch func(string) (storeadapter.StoreNode, error)) (storeadapter.StoreNode, error) {
+	if !cache.isCacheable(key) {
+		return fetch(key)
+	}
+
+	cacheKey := operation + key
+	now := cache.timeProvider.Time()
+
+	cache.lock.Lock()
+	element, found := cache.entries[cacheKey]
+	if found {
+		cached := element.Value.(*entry)
+		if now.Before(cached.expiresAt) {
+			cache.lru.MoveToFront(element)
+			cache.lock.Unlock()
+			return cached.node, cached.err
+		}
+		cache.remove(element)
+	}
+	cache.lock.Unlock()
+
+	node, err := fetch(key)
+	if err != nil && err != storeadapter.ErrorKeyNotFound {
+		return node, err
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if existing, found := cache.entries[cacheKey]; found {
+		cache.remove(existing)
+	}
+	cache.entries[cacheKey] = cache.lru.PushFront(&entry{
+		cacheKey:  cacheKey,
+		key:       key,
+		node:      node,
+		err:       err,
+		expiresAt: now.Add(cache.ttl),
+	})
+	for cache.lru.Len() > cache.maxEntries {
+		cache.remove(cache.lru.Back())
+	}
+
+	return node, err
+}
+
+func (cache *ReadThroughCache) isCacheable(key string) bool {
+	if cache.ttl <= 0 || cache.maxEntries <= 0 {
+		return false
+	}
+	for _, prefix := range cache.cacheablePrefixes {
+		if isUnder(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidate drops every entry that could observe a write to one of keys:
+// the key itself, any directory listing above it and anything below it.
+func (cache *ReadThroughCache) invalidate(keys ...string) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	for _, element := range cache.entries {
+		cached := element.Value.(*entry)
+		for _, key := range keys {
+			if isUnder(key, cached.key) || isUnder(cached.key, key) {
+				cache.remove(element)
+				break
+			}
+		}
+	}
+}
+
+func (cache *ReadThroughCache) remove(element *list.Element) {
+	cache.lru.Remove(element)
+	delete(cache.entries, element.Value.(*entry).cacheKey)
+}
+
+func isUnder(key string, dir string) bool {
+	key = "/" + strings.Trim(key, "/")
+	dir = "/" + strings.Trim(dir, "/")
+	return dir == "/" || key == dir || strings.HasPrefix(key, dir+"/")
+}
+
+func keysForNodes(nodes []storeadapter.StoreNode) []string {
+	keys := make([]string, len(nodes))
+	for i, node := range nodes {
+		keys[i] = node.Key
+	}
+	return keys
+}
@@ -0,0 +1,171 @@
+package readthroughcache_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	. "github.com/cloudfoundry/hm9000/helpers/readthroughcache"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReadThroughCache", func() {
+	var (
+		adapter      *fakestoreadapter.FakeStoreAdapter
+		timeProvider *faketimeprovider.FakeTimeProvider
+		cache        *ReadThroughCache
+	)
+
+	BeforeEach(func() {
+		adapter = fakestoreadapter.New()
+		timeProvider = &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}
+		cache = New(adapter, timeProvider, 5*time.Second, 2, []string{"/hm/v1/desired-fresh", "/hm/v1/apps/desired"})
+
+		adapter.SetMulti([]storeadapter.StoreNode{
+			{Key: "/hm/v1/desired-fresh", Value: []byte("1")},
+			{Key: "/hm/v1/apps/desired/abc,123", Value: []byte("a")},
+			{Key: "/hm/v1/apps/actual/abc,123/xyz", Value: []byte("b")},
+		})
+	})
+
+	overwrite := func(key string, value string) {
+		adapter.SetMulti([]storeadapter.StoreNode{{Key: key, Value: []byte(value)}})
+	}
+
+	Describe("reading a cacheable key", func() {
+		It("serves repeated reads from memory until the ttl elapses", func() {
+			node, err := cache.Get("/hm/v1/desired-fresh")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.Value).Should(Equal([]byte("1")))
+
+			overwrite("/hm/v1/desired-fresh", "2")
+
+			node, err = cache.Get("/hm/v1/desired-fresh")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.Value).Should(Equal([]byte("1")))
+
+			timeProvider.IncrementBySeconds(5)
+
+			node, err = cache.Get("/hm/v1/desired-fresh")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.Value).Should(Equal([]byte("2")))
+		})
+
+		It("caches directory listings", func() {
+			node, err := cache.ListRecursively("/hm/v1/apps/desired")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.ChildNodes).Should(HaveLen(1))
+
+			overwrite("/hm/v1/apps/desired/def,456", "b")
+
+			node, err = cache.ListRecursively("/hm/v1/apps/desired")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.ChildNodes).Should(HaveLen(1))
+		})
+
+		It("caches missing keys", func() {
+			cache = New(adapter, timeProvider, 5*time.Second, 2, []string{"/hm/v1/actual-fresh"})
+
+			_, err := cache.Get("/hm/v1/actual-fresh")
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+
+			overwrite("/hm/v1/actual-fresh", "1")
+
+			_, err = cache.Get("/hm/v1/actual-fresh")
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+
+		It("does not cache other errors", func() {
+			adapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("desired-fresh", errors.New("oops"))
+
+			_, err := cache.Get("/hm/v1/desired-fresh")
+			Ω(err).Should(Equal(errors.New("oops")))
+
+			adapter.GetErrInjector = nil
+
+			node, err := cache.Get("/hm/v1/desired-fresh")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.Value).Should(Equal([]byte("1")))
+		})
+	})
+
+	Describe("reading a key that is not cacheable", func() {
+		It("always reads from the store", func() {
+			cache.Get("/hm/v1/apps/actual/abc,123/xyz")
+			overwrite("/hm/v1/apps/actual/abc,123/xyz", "c")
+
+			node, err := cache.Get("/hm/v1/apps/actual/abc,123/xyz")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.Value).Should(Equal([]byte("c")))
+			Ω(cache.Len()).Should(BeZero())
+		})
+	})
+
+	Context("when the cache is disabled", func() {
+		BeforeEach(func() {
+			cache = New(adapter, timeProvider, 0, 2, []string{"/hm/v1/desired-fresh"})
+		})
+
+		It("always reads from the store", func() {
+			cache.Get("/hm/v1/desired-fresh")
+			overwrite("/hm/v1/desired-fresh", "2")
+
+			node, _ := cache.Get("/hm/v1/desired-fresh")
+			Ω(node.Value).Should(Equal([]byte("2")))
+		})
+	})
+
+	Describe("the size bound", func() {
+		It("evicts the least recently used entry", func() {
+			cache.Get("/hm/v1/desired-fresh")
+			cache.ListRecursively("/hm/v1/apps/desired")
+			cache.Get("/hm/v1/desired-fresh")
+			cache.Get("/hm/v1/apps/desired/abc,123")
+			Ω(cache.Len()).Should(Equal(2))
+
+			overwrite("/hm/v1/apps/desired/def,456", "b")
+			overwrite("/hm/v1/desired-fresh", "2")
+
+			node, _ := cache.Get("/hm/v1/desired-fresh")
+			Ω(node.Value).Should(Equal([]byte("1")))
+
+			node, _ = cache.ListRecursively("/hm/v1/apps/desired")
+			Ω(node.ChildNodes).Should(HaveLen(2))
+		})
+	})
+
+	Describe("writing through the cache", func() {
+		BeforeEach(func() {
+			cache.Get("/hm/v1/desired-fresh")
+			cache.ListRecursively("/hm/v1/apps/desired")
+		})
+
+		It("invalidates the written key", func() {
+			err := cache.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/desired-fresh", Value: []byte("2")}})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			node, _ := cache.Get("/hm/v1/desired-fresh")
+			Ω(node.Value).Should(Equal([]byte("2")))
+		})
+
+		It("invalidates listings of the directories above the written key", func() {
+			err := cache.Delete("/hm/v1/apps/desired/abc,123")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = cache.ListRecursively("/hm/v1/apps/desired")
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+
+		It("invalidates entries below a deleted directory", func() {
+			cache.Get("/hm/v1/apps/desired/abc,123")
+
+			err := cache.Delete("/hm/v1")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(cache.Len()).Should(BeZero())
+		})
+	})
+})
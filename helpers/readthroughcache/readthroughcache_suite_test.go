@@ -0,0 +1,13 @@
+package readthroughcache_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestReadThroughCache(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Read Through Cache Suite")
+}
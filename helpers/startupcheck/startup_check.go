@@ -0,0 +1,41 @@
+package startupcheck
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+// A Dependency is something a command cannot start without, such as the
+// store or NATS.  Check returns nil once the dependency is reachable.
+type Dependency struct {
+	Name  string
+	Check func() error
+
+	// ExitCode is what the command exits with when the dependency cannot
+	// be reached, so that a restart loop says which one is missing.
+	ExitCode int
+}
+
+// Wait checks the dependency until it is reachable, retrying up to retries
+// times after a failed check.  The delay before the first retry is delay,
+// and it doubles with each subsequent retry.  It returns the number of
+// checks made, and the last check's error if none succeeded.
+func Wait(dependency Dependency, retries int, delay time.Duration, l logger.Logger) (attempts int, err error) {
+	for attempts = 1; ; attempts++ {
+		err = dependency.Check()
+		if err == nil || attempts > retries {
+			return attempts, err
+		}
+
+		l.Info("Startup dependency is not reachable yet, retrying", map[string]string{
+			"Dependency": dependency.Name,
+			"Attempt":    strconv.Itoa(attempts),
+			"Error":      err.Error(),
+			"Retry In":   delay.String(),
+		})
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
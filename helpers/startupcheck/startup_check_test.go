@@ -0,0 +1,71 @@
+package startupcheck_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/helpers/startupcheck"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wait", func() {
+	var (
+		logger   *fakelogger.FakeLogger
+		failures int
+		checks   []time.Time
+		store    Dependency
+	)
+
+	BeforeEach(func() {
+		logger = fakelogger.NewFakeLogger()
+		failures = 0
+		checks = []time.Time{}
+		store = Dependency{
+			Name:     "store",
+			ExitCode: 194,
+			Check: func() error {
+				checks = append(checks, time.Now())
+				if len(checks) <= failures {
+					return errors.New("connection refused")
+				}
+				return nil
+			},
+		}
+	})
+
+	It("checks once when the dependency is reachable", func() {
+		attempts, err := Wait(store, 3, time.Millisecond, logger)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(attempts).Should(Equal(1))
+		Ω(logger.LoggedSubjects).Should(BeEmpty())
+	})
+
+	It("retries, doubling the delay, until the dependency is reachable", func() {
+		failures = 2
+		attempts, err := Wait(store, 3, 5*time.Millisecond, logger)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(attempts).Should(Equal(3))
+		Ω(checks[1].Sub(checks[0])).Should(BeNumerically(">=", 5*time.Millisecond))
+		Ω(checks[2].Sub(checks[1])).Should(BeNumerically(">=", 10*time.Millisecond))
+		Ω(logger.LoggedSubjects).Should(Equal([]string{
+			"Startup dependency is not reachable yet, retrying",
+			"Startup dependency is not reachable yet, retrying",
+		}))
+	})
+
+	It("gives up with the last error once the retries run out", func() {
+		failures = 10
+		attempts, err := Wait(store, 2, time.Millisecond, logger)
+		Ω(err).Should(MatchError("connection refused"))
+		Ω(attempts).Should(Equal(3))
+	})
+
+	It("does not retry when told not to", func() {
+		failures = 10
+		attempts, err := Wait(store, 0, time.Millisecond, logger)
+		Ω(err).Should(HaveOccurred())
+		Ω(attempts).Should(Equal(1))
+	})
+})
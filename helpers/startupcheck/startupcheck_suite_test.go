@@ -0,0 +1,13 @@
+package startupcheck_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestStartupCheck(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Startup Check Suite")
+}
@@ -0,0 +1,93 @@
+package storeadapterstats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/helpers/hedgedreads"
+	"github.com/cloudfoundry/hm9000/helpers/instrumentedstoreadapter"
+)
+
+// MetricSender is how the reporter emits its metrics.  Dropsonde's metric
+// sender is one.
+type MetricSender interface {
+	SendValue(name string, value float64, unit string) error
+	AddToCounter(name string, delta uint64) error
+}
+
+// Reporter emits the stats of every store adapter a process opens as the
+// process's own metrics.  Counters are added to, so the values from many
+// processes sum; the error percentage and latency describe this process's
+// requests since its last report.
+type Reporter struct {
+	sender   MetricSender
+	adapters []*instrumentedstoreadapter.InstrumentedStoreAdapter
+	lock     *sync.Mutex
+}
+
+func New(sender MetricSender) *Reporter {
+	return &Reporter{
+		sender:   sender,
+		adapters: []*instrumentedstoreadapter.InstrumentedStoreAdapter{},
+		lock:     &sync.Mutex{},
+	}
+}
+
+// Add includes adapter in every later report.
+func (reporter *Reporter) Add(adapters ...*instrumentedstoreadapter.InstrumentedStoreAdapter) {
+	reporter.lock.Lock()
+	defer reporter.lock.Unlock()
+
+	reporter.adapters = append(reporter.adapters, adapters...)
+}
+
+// Report collects the stats of every adapter added and emits their sum.
+func (reporter *Reporter) Report() error {
+	reporter.lock.Lock()
+	adapters := reporter.adapters
+	reporter.lock.Unlock()
+
+	stats := instrumentedstoreadapter.Stats{}
+	hedgedStats := hedgedreads.Stats{}
+	for _, adapter := range adapters {
+		collected := adapter.CollectStats()
+		stats.Requests += collected.Requests
+		stats.Errors += collected.Errors
+		stats.Retries += collected.Retries
+		stats.TotalLatency += collected.TotalLatency
+
+		if hedged, ok := adapter.StoreAdapter.(*hedgedreads.HedgedReadStoreAdapter); ok {
+			collected := hedged.CollectStats()
+			hedgedStats.Hedged += collected.Hedged
+			hedgedStats.Won += collected.Won
+		}
+	}
+
+	counters := []struct {
+		name  string
+		delta int
+	}{
+		{"StoreRequests", stats.Requests},
+		{"StoreRequestErrors", stats.Errors},
+		{"StoreRequestRetries", stats.Retries},
+		{"StoreHedgedReads", hedgedStats.Hedged},
+		{"StoreHedgedReadWins", hedgedStats.Won},
+	}
+	for _, counter := range counters {
+		err := reporter.sender.AddToCounter(counter.name, uint64(counter.delta))
+		if err != nil {
+			return err
+		}
+	}
+
+	errorPercentage := 0.0
+	if stats.Requests > 0 {
+		errorPercentage = float64(stats.Errors) / float64(stats.Requests) * 100.0
+	}
+	err := reporter.sender.SendValue("StoreRequestErrorPercentage", errorPercentage, "Percent")
+	if err != nil {
+		return err
+	}
+
+	return reporter.sender.SendValue("StoreRequestLatency", float64(stats.MeanLatency())/float64(time.Millisecond), "ms")
+}
@@ -0,0 +1,75 @@
+package storeadapterstats_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/helpers/instrumentedstoreadapter"
+	"github.com/cloudfoundry/hm9000/helpers/storeadapterstats"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeMetricSender struct {
+	values   map[string]float64
+	counters map[string]uint64
+	err      error
+}
+
+func (sender *fakeMetricSender) SendValue(name string, value float64, unit string) error {
+	sender.values[name] = value
+	return sender.err
+}
+
+func (sender *fakeMetricSender) AddToCounter(name string, delta uint64) error {
+	sender.counters[name] += delta
+	return sender.err
+}
+
+var _ = Describe("Reporter", func() {
+	var (
+		sender   *fakeMetricSender
+		reporter *storeadapterstats.Reporter
+		adapterA *instrumentedstoreadapter.InstrumentedStoreAdapter
+		adapterB *instrumentedstoreadapter.InstrumentedStoreAdapter
+	)
+
+	BeforeEach(func() {
+		sender = &fakeMetricSender{values: map[string]float64{}, counters: map[string]uint64{}}
+		reporter = storeadapterstats.New(sender)
+
+		adapterA = instrumentedstoreadapter.New(fakestoreadapter.New(), time.Second, 0, 0)
+		failing := fakestoreadapter.New()
+		failing.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("foo", errors.New("oops"))
+		adapterB = instrumentedstoreadapter.New(failing, time.Second, 0, 0)
+		reporter.Add(adapterA, adapterB)
+	})
+
+	It("should emit the sum of every adapter's stats", func() {
+		adapterA.Get("/missing")
+		adapterA.Get("/missing")
+		adapterA.Get("/missing")
+		adapterB.Get("/foo")
+
+		Ω(reporter.Report()).Should(Succeed())
+		Ω(sender.counters["StoreRequests"]).Should(BeNumerically("==", 4))
+		Ω(sender.counters["StoreRequestErrors"]).Should(BeNumerically("==", 1))
+		Ω(sender.counters["StoreRequestRetries"]).Should(BeNumerically("==", 0))
+		Ω(sender.values["StoreRequestErrorPercentage"]).Should(BeNumerically("==", 25))
+		Ω(sender.values).Should(HaveKey("StoreRequestLatency"))
+	})
+
+	It("should only emit what happened since the last report", func() {
+		adapterA.Get("/missing")
+		Ω(reporter.Report()).Should(Succeed())
+		Ω(reporter.Report()).Should(Succeed())
+		Ω(sender.counters["StoreRequests"]).Should(BeNumerically("==", 1))
+		Ω(sender.values["StoreRequestErrorPercentage"]).Should(BeNumerically("==", 0))
+	})
+
+	It("should return the error when the metrics cannot be sent", func() {
+		sender.err = errors.New("no metron")
+		Ω(reporter.Report()).Should(Equal(errors.New("no metron")))
+	})
+})
@@ -0,0 +1,13 @@
+package storeadapterstats_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestStoreAdapterStats(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "StoreAdapterStats Suite")
+}
@@ -0,0 +1,125 @@
+package watchdog
+
+import (
+	"errors"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+const WatchdogTimer = "Watchdog"
+
+// CheckInterval is how often a started watchdog checks on its loop.
+const CheckInterval = time.Second
+
+var WedgedError = errors.New("Component is wedged")
+
+// Watchdog catches a loop that has stopped going round: deadlocked, or stuck
+// on a call that never returns.  The loop calls Expect each time it makes
+// progress, with the interval it expects to make progress again within.  If
+// multiple times that interval passes without another Expect the watchdog
+// trips: it logs a dump of every goroutine and calls onTrip, once, until the
+// loop makes progress again.  A multiple of 0 turns the watchdog off.
+type Watchdog struct {
+	component    string
+	multiple     func() int
+	timeProvider timeprovider.TimeProvider
+	logger       logger.Logger
+	onTrip       func()
+
+	progressed time.Time
+	interval   time.Duration
+	tripped    bool
+	stop       chan bool
+	lock       *sync.Mutex
+}
+
+func New(component string, multiple func() int, timeProvider timeprovider.TimeProvider, logger logger.Logger, onTrip func()) *Watchdog {
+	return &Watchdog{
+		component:    component,
+		multiple:     multiple,
+		timeProvider: timeProvider,
+		logger:       logger,
+		onTrip:       onTrip,
+		lock:         &sync.Mutex{},
+	}
+}
+
+// Start checks on the loop every CheckInterval in the background.  Starting
+// a running watchdog does nothing.
+func (watchdog *Watchdog) Start() {
+	watchdog.lock.Lock()
+	if watchdog.stop != nil {
+		watchdog.lock.Unlock()
+		return
+	}
+	stop := make(chan bool)
+	watchdog.stop = stop
+	watchdog.lock.Unlock()
+
+	ticker := watchdog.timeProvider.NewTickerChannel(WatchdogTimer, CheckInterval)
+
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker:
+				watchdog.Check()
+			}
+		}
+	}()
+}
+
+// Stop stops checking on the loop.
+func (watchdog *Watchdog) Stop() {
+	watchdog.lock.Lock()
+	defer watchdog.lock.Unlock()
+	if watchdog.stop != nil {
+		close(watchdog.stop)
+		watchdog.stop = nil
+	}
+}
+
+// Expect records that the loop has made progress, and should again within
+// interval.
+func (watchdog *Watchdog) Expect(interval time.Duration) {
+	watchdog.lock.Lock()
+	defer watchdog.lock.Unlock()
+	watchdog.progressed = watchdog.timeProvider.Time()
+	watchdog.interval = interval
+	watchdog.tripped = false
+}
+
+// Check trips the watchdog if the loop is overdue, and tells whether it did.
+func (watchdog *Watchdog) Check() bool {
+	watchdog.lock.Lock()
+	multiple := watchdog.multiple()
+	since := watchdog.timeProvider.Time().Sub(watchdog.progressed)
+	if multiple <= 0 || watchdog.progressed.IsZero() || watchdog.tripped || since < time.Duration(multiple)*watchdog.interval {
+		watchdog.lock.Unlock()
+		return false
+	}
+	watchdog.tripped = true
+	watchdog.lock.Unlock()
+
+	watchdog.logger.Error("Watchdog tripped: the component has stopped making progress", WedgedError, map[string]string{
+		"Component":              watchdog.component,
+		"Seconds Since Progress": strconv.Itoa(int(since.Seconds())),
+		"Goroutines":             goroutineDump(),
+	})
+	if watchdog.onTrip != nil {
+		watchdog.onTrip()
+	}
+	return true
+}
+
+func goroutineDump() string {
+	buffer := make([]byte, 1<<20)
+	n := runtime.Stack(buffer, true)
+	return string(buffer[:n])
+}
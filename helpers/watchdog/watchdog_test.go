@@ -0,0 +1,117 @@
+package watchdog_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	. "github.com/cloudfoundry/hm9000/helpers/watchdog"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Watchdog", func() {
+	var (
+		watchdog     *Watchdog
+		timeProvider *faketimeprovider.FakeTimeProvider
+		logger       *fakelogger.FakeLogger
+		multiple     int
+		trips        int
+	)
+
+	BeforeEach(func() {
+		timeProvider = faketimeprovider.New(time.Unix(100, 0))
+		logger = fakelogger.NewFakeLogger()
+		multiple = 3
+		trips = 0
+		watchdog = New("Analyzer", func() int { return multiple }, timeProvider, logger, func() { trips++ })
+	})
+
+	It("should not trip before the loop has made any progress", func() {
+		timeProvider.IncrementBySeconds(1000)
+		Ω(watchdog.Check()).Should(BeFalse())
+	})
+
+	Context("when the loop has made progress", func() {
+		BeforeEach(func() {
+			watchdog.Expect(10 * time.Second)
+		})
+
+		It("should not trip within the multiple of the interval", func() {
+			timeProvider.IncrementBySeconds(29)
+			Ω(watchdog.Check()).Should(BeFalse())
+			Ω(trips).Should(Equal(0))
+		})
+
+		It("should not trip while the loop keeps making progress", func() {
+			for i := 0; i < 10; i++ {
+				timeProvider.IncrementBySeconds(20)
+				watchdog.Expect(10 * time.Second)
+				Ω(watchdog.Check()).Should(BeFalse())
+			}
+		})
+
+		Context("when the loop stops making progress", func() {
+			BeforeEach(func() {
+				timeProvider.IncrementBySeconds(30)
+			})
+
+			It("should trip", func() {
+				Ω(watchdog.Check()).Should(BeTrue())
+				Ω(trips).Should(Equal(1))
+			})
+
+			It("should log a dump of every goroutine", func() {
+				watchdog.Check()
+				Ω(logger.LoggedSubjects).Should(ContainElement("Watchdog tripped: the component has stopped making progress"))
+				Ω(logger.LoggedErrors).Should(ContainElement(WedgedError))
+				Ω(logger.LoggedMessages).Should(ContainElement(ContainSubstring("goroutine")))
+				Ω(logger.LoggedMessages).Should(ContainElement(ContainSubstring("Analyzer")))
+			})
+
+			It("should trip only once until the loop makes progress again", func() {
+				Ω(watchdog.Check()).Should(BeTrue())
+				timeProvider.IncrementBySeconds(30)
+				Ω(watchdog.Check()).Should(BeFalse())
+				Ω(trips).Should(Equal(1))
+
+				watchdog.Expect(10 * time.Second)
+				timeProvider.IncrementBySeconds(30)
+				Ω(watchdog.Check()).Should(BeTrue())
+				Ω(trips).Should(Equal(2))
+			})
+		})
+
+		Context("when the multiple is 0", func() {
+			It("should never trip", func() {
+				multiple = 0
+				timeProvider.IncrementBySeconds(1000)
+				Ω(watchdog.Check()).Should(BeFalse())
+			})
+		})
+	})
+
+	Describe("running in the background", func() {
+		BeforeEach(func() {
+			timeProvider.ProvideFakeChannels = true
+			watchdog.Start()
+		})
+
+		AfterEach(func() {
+			watchdog.Stop()
+		})
+
+		It("should check every CheckInterval", func() {
+			Ω(timeProvider.TickerDurationFor(WatchdogTimer)).Should(Equal(CheckInterval))
+
+			watchdog.Expect(10 * time.Second)
+			timeProvider.IncrementBySeconds(30)
+			ticker := timeProvider.TickerChannelFor(WatchdogTimer)
+			ticker <- time.Now()
+			// the second tick is only received once the first check is done
+			ticker <- time.Now()
+
+			Ω(trips).Should(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,206 @@
+// Package webhooks sends JSON notifications of what hm9000 does (starts and
+// stops sent, apps that start flapping, the store losing freshness) to
+// operator-configured URLs, for alerting and chat integrations.
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/httpclient"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+const (
+	EventStartSent         = "start_sent"
+	EventStopSent          = "stop_sent"
+	EventAppFlapping       = "app_flapping"
+	EventFreshnessLost     = "freshness_lost"
+	EventFreshnessRestored = "freshness_restored"
+)
+
+// EventTypes lists every event a hook can subscribe to.
+var EventTypes = []string{EventStartSent, EventStopSent, EventAppFlapping, EventFreshnessLost, EventFreshnessRestored}
+
+// Event is one notification.  Timestamp is a unix time in seconds, filled
+// in when the event is sent if it is 0.
+type Event struct {
+	Type       string            `json:"type"`
+	Timestamp  int64             `json:"timestamp"`
+	AppGuid    string            `json:"droplet,omitempty"`
+	AppVersion string            `json:"version,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+}
+
+// Hook is a URL that receives notifications of the given event types (all
+// of them, if Events is empty).  The request carries basic auth credentials
+// if User is set, or a bearer Token.  A request that fails, or gets a
+// response other than a 2xx or 4xx, is retried up to Retries times, waiting
+// RetryDelay before the first retry and doubling the wait each time.
+type Hook struct {
+	URL        string
+	Events     []string
+	User       string
+	Password   string
+	Token      string
+	Timeout    time.Duration
+	Retries    int
+	RetryDelay time.Duration
+}
+
+func (hook Hook) wants(eventType string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, wanted := range hook.Events {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type Notifier interface {
+	// Notify sends the events to every hook that wants them, and returns
+	// once each hook has them or has failed for good.
+	Notify(events ...Event)
+
+	// ReportFreshness tells the notifier whether the store was found fresh
+	// (err is nil) or not.  It sends freshness_lost and freshness_restored
+	// when that changes, rather than on every report.
+	ReportFreshness(err error)
+}
+
+type RealNotifier struct {
+	hooks        []Hook
+	clients      []httpclient.HttpClient
+	timeProvider timeprovider.TimeProvider
+	logger       logger.Logger
+
+	stale bool
+	lock  *sync.Mutex
+}
+
+func New(hooks []Hook, timeProvider timeprovider.TimeProvider, logger logger.Logger) *RealNotifier {
+	clients := make([]httpclient.HttpClient, len(hooks))
+	for i, hook := range hooks {
+		clients[i] = httpclient.NewHttpClient(false, hook.Timeout)
+	}
+
+	return &RealNotifier{
+		hooks:        hooks,
+		clients:      clients,
+		timeProvider: timeProvider,
+		logger:       logger,
+		lock:         &sync.Mutex{},
+	}
+}
+
+func (notifier *RealNotifier) Notify(events ...Event) {
+	if len(events) == 0 || len(notifier.hooks) == 0 {
+		return
+	}
+
+	now := notifier.timeProvider.Time().Unix()
+	for i := range events {
+		if events[i].Timestamp == 0 {
+			events[i].Timestamp = now
+		}
+	}
+
+	waitGroup := &sync.WaitGroup{}
+	for i, hook := range notifier.hooks {
+		wanted := []Event{}
+		for _, event := range events {
+			if hook.wants(event.Type) {
+				wanted = append(wanted, event)
+			}
+		}
+		if len(wanted) == 0 {
+			continue
+		}
+
+		waitGroup.Add(1)
+		go func(hook Hook, client httpclient.HttpClient, wanted []Event) {
+			defer waitGroup.Done()
+			err := deliver(hook, client, wanted)
+			if err != nil {
+				notifier.logger.Error("Failed to deliver webhook", err, map[string]string{
+					"URL":    hook.URL,
+					"Events": fmt.Sprintf("%d", len(wanted)),
+				})
+			}
+		}(hook, notifier.clients[i], wanted)
+	}
+	waitGroup.Wait()
+}
+
+func (notifier *RealNotifier) ReportFreshness(err error) {
+	notifier.lock.Lock()
+	changed := notifier.stale != (err != nil)
+	notifier.stale = err != nil
+	notifier.lock.Unlock()
+
+	if !changed {
+		return
+	}
+	if err != nil {
+		notifier.Notify(Event{Type: EventFreshnessLost, Details: map[string]string{"error": err.Error()}})
+	} else {
+		notifier.Notify(Event{Type: EventFreshnessRestored})
+	}
+}
+
+type payload struct {
+	Events []Event `json:"events"`
+}
+
+func deliver(hook Hook, client httpclient.HttpClient, events []Event) error {
+	body, err := json.Marshal(payload{Events: events})
+	if err != nil {
+		return err
+	}
+
+	delay := hook.RetryDelay
+	for attempt := 0; ; attempt++ {
+		retryable, err := post(hook, client, body)
+		if err == nil || !retryable || attempt >= hook.Retries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post sends the body to the hook once.  Failures other than 4xx responses
+// are retryable.
+func post(hook Hook, client httpclient.HttpClient, body []byte) (retryable bool, err error) {
+	request, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if hook.User != "" {
+		request.SetBasicAuth(hook.User, hook.Password)
+	} else if hook.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+hook.Token)
+	}
+
+	client.Do(request, func(response *http.Response, responseErr error) {
+		if responseErr != nil {
+			retryable, err = true, responseErr
+			return
+		}
+		defer response.Body.Close()
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			retryable = response.StatusCode < 400 || response.StatusCode > 499
+			err = fmt.Errorf("webhook responded with %d", response.StatusCode)
+		}
+	})
+	return retryable, err
+}
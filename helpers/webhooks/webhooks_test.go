@@ -0,0 +1,224 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+
+	. "github.com/cloudfoundry/hm9000/helpers/webhooks"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type receivedRequest struct {
+	request *http.Request
+	events  []Event
+}
+
+type receiver struct {
+	url      string
+	statuses []int
+	requests []receivedRequest
+	lock     *sync.Mutex
+	listener net.Listener
+}
+
+func newReceiver(statuses ...int) *receiver {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Ω(err).ShouldNot(HaveOccurred())
+
+	r := &receiver{
+		url:      "http://" + listener.Addr().String() + "/hook",
+		statuses: statuses,
+		lock:     &sync.Mutex{},
+		listener: listener,
+	}
+	go http.Serve(listener, r)
+	return r
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	body, _ := ioutil.ReadAll(request.Body)
+	decoded := struct {
+		Events []Event `json:"events"`
+	}{}
+	json.Unmarshal(body, &decoded)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.requests = append(r.requests, receivedRequest{request: request, events: decoded.Events})
+	if len(r.statuses) > 0 {
+		w.WriteHeader(r.statuses[0])
+		r.statuses = r.statuses[1:]
+	}
+}
+
+func (r *receiver) received() []receivedRequest {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]receivedRequest{}, r.requests...)
+}
+
+var _ = Describe("Webhooks", func() {
+	var (
+		timeProvider *faketimeprovider.FakeTimeProvider
+		logger       *fakelogger.FakeLogger
+		hookReceiver *receiver
+		hook         Hook
+		notifier     *RealNotifier
+	)
+
+	BeforeEach(func() {
+		timeProvider = &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}
+		logger = fakelogger.NewFakeLogger()
+		hookReceiver = newReceiver()
+		hook = Hook{URL: hookReceiver.url, Timeout: time.Second}
+	})
+
+	AfterEach(func() {
+		hookReceiver.listener.Close()
+	})
+
+	JustBeforeEach(func() {
+		notifier = New([]Hook{hook}, timeProvider, logger)
+	})
+
+	Describe("Notify", func() {
+		It("should POST the events as JSON, stamped with the current time", func() {
+			notifier.Notify(Event{Type: EventStartSent, AppGuid: "app", AppVersion: "version", Details: map[string]string{"index": "1"}},
+				Event{Type: EventStopSent, Timestamp: 90})
+
+			requests := hookReceiver.received()
+			Ω(requests).Should(HaveLen(1))
+			Ω(requests[0].request.Method).Should(Equal("POST"))
+			Ω(requests[0].request.Header.Get("Content-Type")).Should(Equal("application/json"))
+			Ω(requests[0].events).Should(Equal([]Event{
+				{Type: EventStartSent, Timestamp: 100, AppGuid: "app", AppVersion: "version", Details: map[string]string{"index": "1"}},
+				{Type: EventStopSent, Timestamp: 90},
+			}))
+		})
+
+		It("should not send anything when there are no events", func() {
+			notifier.Notify()
+			Ω(hookReceiver.received()).Should(BeEmpty())
+		})
+
+		Context("when the hook only wants some events", func() {
+			BeforeEach(func() {
+				hook.Events = []string{EventStopSent}
+			})
+
+			It("should only send those", func() {
+				notifier.Notify(Event{Type: EventStartSent}, Event{Type: EventStopSent})
+
+				requests := hookReceiver.received()
+				Ω(requests).Should(HaveLen(1))
+				Ω(requests[0].events).Should(HaveLen(1))
+				Ω(requests[0].events[0].Type).Should(Equal(EventStopSent))
+			})
+
+			It("should not send anything when none of the events are wanted", func() {
+				notifier.Notify(Event{Type: EventStartSent})
+				Ω(hookReceiver.received()).Should(BeEmpty())
+			})
+		})
+
+		Context("with basic auth credentials", func() {
+			BeforeEach(func() {
+				hook.User = "user"
+				hook.Password = "secret"
+			})
+
+			It("should authenticate with them", func() {
+				notifier.Notify(Event{Type: EventStartSent})
+
+				request := hookReceiver.received()[0].request
+				user, password, ok := request.BasicAuth()
+				Ω(ok).Should(BeTrue())
+				Ω(user).Should(Equal("user"))
+				Ω(password).Should(Equal("secret"))
+			})
+		})
+
+		Context("with a token", func() {
+			BeforeEach(func() {
+				hook.Token = "token"
+			})
+
+			It("should send it as a bearer token", func() {
+				notifier.Notify(Event{Type: EventStartSent})
+				Ω(hookReceiver.received()[0].request.Header.Get("Authorization")).Should(Equal("Bearer token"))
+			})
+		})
+
+		Context("when the hook fails", func() {
+			BeforeEach(func() {
+				hook.Retries = 2
+				hook.RetryDelay = time.Millisecond
+			})
+
+			Context("with a 5xx", func() {
+				BeforeEach(func() {
+					hookReceiver.statuses = []int{http.StatusServiceUnavailable, http.StatusInternalServerError}
+				})
+
+				It("should retry", func() {
+					notifier.Notify(Event{Type: EventStartSent})
+					Ω(hookReceiver.received()).Should(HaveLen(3))
+					Ω(logger.LoggedSubjects).Should(BeEmpty())
+				})
+			})
+
+			Context("with a 5xx every time", func() {
+				BeforeEach(func() {
+					hookReceiver.statuses = []int{503, 503, 503}
+				})
+
+				It("should give up after the retries and log the failure", func() {
+					notifier.Notify(Event{Type: EventStartSent})
+					Ω(hookReceiver.received()).Should(HaveLen(3))
+					Ω(logger.LoggedSubjects).Should(ContainElement("Failed to deliver webhook"))
+				})
+			})
+
+			Context("with a 4xx", func() {
+				BeforeEach(func() {
+					hookReceiver.statuses = []int{http.StatusUnauthorized}
+				})
+
+				It("should not retry", func() {
+					notifier.Notify(Event{Type: EventStartSent})
+					Ω(hookReceiver.received()).Should(HaveLen(1))
+					Ω(logger.LoggedSubjects).Should(ContainElement("Failed to deliver webhook"))
+				})
+			})
+		})
+	})
+
+	Describe("ReportFreshness", func() {
+		It("should only notify when freshness changes", func() {
+			notifier.ReportFreshness(nil)
+			Ω(hookReceiver.received()).Should(BeEmpty())
+
+			notifier.ReportFreshness(errors.New("stale"))
+			notifier.ReportFreshness(errors.New("still stale"))
+			requests := hookReceiver.received()
+			Ω(requests).Should(HaveLen(1))
+			Ω(requests[0].events[0].Type).Should(Equal(EventFreshnessLost))
+			Ω(requests[0].events[0].Details["error"]).Should(Equal("stale"))
+
+			notifier.ReportFreshness(nil)
+			notifier.ReportFreshness(nil)
+			requests = hookReceiver.received()
+			Ω(requests).Should(HaveLen(2))
+			Ω(requests[1].events[0].Type).Should(Equal(EventFreshnessRestored))
+		})
+	})
+})
@@ -0,0 +1,511 @@
+package zookeeperstoreadapter
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// ZookeeperStoreAdapter implements storeadapter.StoreAdapter on top of
+// ZooKeeper.
+//
+// ZooKeeper has no notion of a TTL, so leaves carry their TTL in a small
+// header in front of the value:
+//
+//	<ttl>,<value>
+//
+// A leaf has expired once its modification time plus its TTL lies in the
+// past; expired leaves are treated as missing and deleted lazily when they
+// are read.  Directories are nodes with no data.  Maintained nodes (locks)
+// are ephemeral and therefore live exactly as long as our session.
+type ZookeeperStoreAdapter struct {
+	urls           []string
+	sessionTimeout time.Duration
+	timeProvider   timeprovider.TimeProvider
+
+	client *zk.Conn
+}
+
+var acl = zk.WorldACL(zk.PermAll)
+
+var WatchNotSupportedError = errors.New("Watch is not supported by the ZooKeeper store adapter")
+
+func NewZookeeperStoreAdapter(urls []string, timeProvider timeprovider.TimeProvider, sessionTimeout time.Duration) *ZookeeperStoreAdapter {
+	return &ZookeeperStoreAdapter{
+		urls:           urls,
+		sessionTimeout: sessionTimeout,
+		timeProvider:   timeProvider,
+	}
+}
+
+func (adapter *ZookeeperStoreAdapter) Connect() error {
+	client, events, err := zk.Connect(adapter.urls, adapter.sessionTimeout)
+	if err != nil {
+		return err
+	}
+
+	adapter.client = client
+
+	go func() {
+		for _ = range events {
+		}
+	}()
+
+	return nil
+}
+
+func (adapter *ZookeeperStoreAdapter) Disconnect() error {
+	if adapter.client != nil {
+		adapter.client.Close()
+	}
+	return nil
+}
+
+func (adapter *ZookeeperStoreAdapter) SetMulti(nodes []storeadapter.StoreNode) error {
+	for _, node := range nodes {
+		err := adapter.set(node)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (adapter *ZookeeperStoreAdapter) Create(node storeadapter.StoreNode) error {
+	exists, err := adapter.exists(node.Key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return storeadapter.ErrorKeyExists
+	}
+
+	err = adapter.createParents(node.Key)
+	if err != nil {
+		return err
+	}
+
+	_, err = adapter.client.Create(node.Key, adapter.encode(node), 0, acl)
+	if err == zk.ErrNodeExists {
+		return storeadapter.ErrorKeyExists
+	}
+	return adapter.translateError(err)
+}
+
+func (adapter *ZookeeperStoreAdapter) Update(node storeadapter.StoreNode) error {
+	_, stat, err := adapter.getLeaf(node.Key)
+	if err != nil {
+		return err
+	}
+
+	_, err = adapter.client.Set(node.Key, adapter.encode(node), stat.Version)
+	return adapter.translateError(err)
+}
+
+func (adapter *ZookeeperStoreAdapter) CompareAndSwap(oldNode storeadapter.StoreNode, newNode storeadapter.StoreNode) error {
+	current, stat, err := adapter.getLeaf(oldNode.Key)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(current.Value, oldNode.Value) {
+		return storeadapter.ErrorKeyComparisonFailed
+	}
+
+	_, err = adapter.client.Set(newNode.Key, adapter.encode(newNode), stat.Version)
+	return adapter.translateError(err)
+}
+
+func (adapter *ZookeeperStoreAdapter) CompareAndSwapByIndex(prevIndex uint64, newNode storeadapter.StoreNode) error {
+	current, stat, err := adapter.getLeaf(newNode.Key)
+	if err != nil {
+		return err
+	}
+
+	if current.Index != prevIndex {
+		return storeadapter.ErrorKeyComparisonFailed
+	}
+
+	_, err = adapter.client.Set(newNode.Key, adapter.encode(newNode), stat.Version)
+	return adapter.translateError(err)
+}
+
+func (adapter *ZookeeperStoreAdapter) Get(key string) (storeadapter.StoreNode, error) {
+	node, _, err := adapter.getLeaf(key)
+	return node, err
+}
+
+func (adapter *ZookeeperStoreAdapter) ListRecursively(key string) (storeadapter.StoreNode, error) {
+	data, stat, err := adapter.client.Get(key)
+	if err != nil {
+		return storeadapter.StoreNode{}, adapter.translateError(err)
+	}
+
+	if !isDir(data, stat) {
+		return storeadapter.StoreNode{}, storeadapter.ErrorNodeIsNotDirectory
+	}
+
+	return adapter.listDir(key)
+}
+
+func (adapter *ZookeeperStoreAdapter) Delete(keys ...string) error {
+	for _, key := range keys {
+		err := adapter.deleteRecursively(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (adapter *ZookeeperStoreAdapter) DeleteLeaves(keys ...string) error {
+	for _, key := range keys {
+		_, stat, err := adapter.getLeaf(key)
+		if err != nil {
+			return err
+		}
+
+		err = adapter.client.Delete(key, stat.Version)
+		if err != nil {
+			return adapter.translateError(err)
+		}
+	}
+	return nil
+}
+
+func (adapter *ZookeeperStoreAdapter) CompareAndDelete(nodes ...storeadapter.StoreNode) error {
+	for _, node := range nodes {
+		current, stat, err := adapter.getLeaf(node.Key)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(current.Value, node.Value) {
+			return storeadapter.ErrorKeyComparisonFailed
+		}
+
+		err = adapter.client.Delete(node.Key, stat.Version)
+		if err != nil {
+			return adapter.translateError(err)
+		}
+	}
+	return nil
+}
+
+func (adapter *ZookeeperStoreAdapter) CompareAndDeleteByIndex(nodes ...storeadapter.StoreNode) error {
+	for _, node := range nodes {
+		current, stat, err := adapter.getLeaf(node.Key)
+		if err != nil {
+			return err
+		}
+
+		if current.Index != node.Index {
+			return storeadapter.ErrorKeyComparisonFailed
+		}
+
+		err = adapter.client.Delete(node.Key, stat.Version)
+		if err != nil {
+			return adapter.translateError(err)
+		}
+	}
+	return nil
+}
+
+// UpdateDirTTL only checks that the directory exists: directories never
+// expire in ZooKeeper, their leaves do.
+func (adapter *ZookeeperStoreAdapter) UpdateDirTTL(key string, ttl uint64) error {
+	data, stat, err := adapter.client.Get(key)
+	if err != nil {
+		return adapter.translateError(err)
+	}
+
+	if !isDir(data, stat) {
+		return storeadapter.ErrorNodeIsNotDirectory
+	}
+
+	return nil
+}
+
+// Watch is not supported: the error channel yields WatchNotSupportedError.
+func (adapter *ZookeeperStoreAdapter) Watch(key string) (<-chan storeadapter.WatchEvent, chan<- bool, <-chan error) {
+	events := make(chan storeadapter.WatchEvent)
+	stop := make(chan bool, 1)
+	errs := make(chan error, 1)
+	errs <- WatchNotSupportedError
+	close(events)
+	return events, stop, errs
+}
+
+// MaintainNode creates the node as an ephemeral node, so that it disappears
+// when the session does.  Until it manages to create the node it retries
+// every storeNode.TTL seconds; once it holds the node it checks every
+// storeNode.TTL seconds that it still does.
+func (adapter *ZookeeperStoreAdapter) MaintainNode(storeNode storeadapter.StoreNode) (<-chan bool, chan chan bool, error) {
+	if storeNode.TTL == 0 {
+		return nil, nil, storeadapter.ErrorInvalidTTL
+	}
+
+	err := adapter.createParents(storeNode.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	status := make(chan bool)
+	releaseNode := make(chan chan bool)
+	ticker := adapter.timeProvider.NewTickerChannel("zookeeper-maintain-node", time.Duration(storeNode.TTL)*time.Second)
+
+	// the session, not the header, decides how long an ephemeral node lives
+	data := adapter.encode(storeadapter.StoreNode{Value: storeNode.Value})
+
+	go func() {
+		owned := false
+		for {
+			if !owned {
+				_, err := adapter.client.Create(storeNode.Key, data, zk.FlagEphemeral, acl)
+				if err == nil {
+					owned = true
+					status <- true
+				}
+			} else {
+				exists, _ := adapter.exists(storeNode.Key)
+				if !exists {
+					owned = false
+					status <- false
+				}
+			}
+
+			select {
+			case released := <-releaseNode:
+				if owned {
+					adapter.client.Delete(storeNode.Key, -1)
+				}
+				close(status)
+				if released != nil {
+					close(released)
+				}
+				return
+			case <-ticker:
+			}
+		}
+	}()
+
+	return status, releaseNode, nil
+}
+
+func (adapter *ZookeeperStoreAdapter) set(node storeadapter.StoreNode) error {
+	data, stat, err := adapter.client.Get(node.Key)
+	if err == zk.ErrNoNode {
+		err = adapter.createParents(node.Key)
+		if err != nil {
+			return err
+		}
+		_, err = adapter.client.Create(node.Key, adapter.encode(node), 0, acl)
+		if err != zk.ErrNodeExists {
+			return adapter.translateError(err)
+		}
+		return adapter.set(node)
+	}
+	if err != nil {
+		return adapter.translateError(err)
+	}
+
+	if isDir(data, stat) {
+		return storeadapter.ErrorNodeIsDirectory
+	}
+
+	_, err = adapter.client.Set(node.Key, adapter.encode(node), -1)
+	return adapter.translateError(err)
+}
+
+func (adapter *ZookeeperStoreAdapter) createParents(key string) error {
+	parent := path.Dir(key)
+	if parent == "/" || parent == "." {
+		return nil
+	}
+
+	data, stat, err := adapter.client.Get(parent)
+	if err == nil {
+		if !isDir(data, stat) {
+			return storeadapter.ErrorNodeIsNotDirectory
+		}
+		return nil
+	}
+	if err != zk.ErrNoNode {
+		return adapter.translateError(err)
+	}
+
+	err = adapter.createParents(parent)
+	if err != nil {
+		return err
+	}
+
+	_, err = adapter.client.Create(parent, []byte{}, 0, acl)
+	if err == zk.ErrNodeExists {
+		return nil
+	}
+	return adapter.translateError(err)
+}
+
+func (adapter *ZookeeperStoreAdapter) getLeaf(key string) (storeadapter.StoreNode, *zk.Stat, error) {
+	data, stat, err := adapter.client.Get(key)
+	if err != nil {
+		return storeadapter.StoreNode{}, nil, adapter.translateError(err)
+	}
+
+	if isDir(data, stat) {
+		return storeadapter.StoreNode{}, nil, storeadapter.ErrorNodeIsDirectory
+	}
+
+	node, expired, err := adapter.decode(key, data, stat)
+	if err != nil {
+		return storeadapter.StoreNode{}, nil, err
+	}
+
+	if expired {
+		adapter.client.Delete(key, stat.Version)
+		return storeadapter.StoreNode{}, nil, storeadapter.ErrorKeyNotFound
+	}
+
+	return node, stat, nil
+}
+
+func (adapter *ZookeeperStoreAdapter) listDir(key string) (storeadapter.StoreNode, error) {
+	children, _, err := adapter.client.Children(key)
+	if err != nil {
+		return storeadapter.StoreNode{}, adapter.translateError(err)
+	}
+
+	dir := storeadapter.StoreNode{
+		Key:        key,
+		Dir:        true,
+		ChildNodes: []storeadapter.StoreNode{},
+	}
+
+	for _, child := range children {
+		childKey := path.Join(key, child)
+		if childKey == "/zookeeper" {
+			continue
+		}
+
+		data, stat, err := adapter.client.Get(childKey)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return storeadapter.StoreNode{}, adapter.translateError(err)
+		}
+
+		if isDir(data, stat) {
+			childDir, err := adapter.listDir(childKey)
+			if err == storeadapter.ErrorKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return storeadapter.StoreNode{}, err
+			}
+			dir.ChildNodes = append(dir.ChildNodes, childDir)
+			continue
+		}
+
+		node, expired, err := adapter.decode(childKey, data, stat)
+		if err != nil {
+			return storeadapter.StoreNode{}, err
+		}
+		if expired {
+			adapter.client.Delete(childKey, stat.Version)
+			continue
+		}
+		dir.ChildNodes = append(dir.ChildNodes, node)
+	}
+
+	return dir, nil
+}
+
+func (adapter *ZookeeperStoreAdapter) deleteRecursively(key string) error {
+	children, _, err := adapter.client.Children(key)
+	if err != nil {
+		return adapter.translateError(err)
+	}
+
+	for _, child := range children {
+		err = adapter.deleteRecursively(path.Join(key, child))
+		if err != nil && err != storeadapter.ErrorKeyNotFound {
+			return err
+		}
+	}
+
+	return adapter.translateError(adapter.client.Delete(key, -1))
+}
+
+func (adapter *ZookeeperStoreAdapter) exists(key string) (bool, error) {
+	_, err := adapter.Get(key)
+	if err == storeadapter.ErrorKeyNotFound {
+		return false, nil
+	}
+	if err == storeadapter.ErrorNodeIsDirectory {
+		return true, nil
+	}
+	return err == nil, err
+}
+
+func (adapter *ZookeeperStoreAdapter) encode(node storeadapter.StoreNode) []byte {
+	data := []byte(strconv.FormatUint(node.TTL, 10) + ",")
+	return append(data, node.Value...)
+}
+
+func (adapter *ZookeeperStoreAdapter) decode(key string, data []byte, stat *zk.Stat) (node storeadapter.StoreNode, expired bool, err error) {
+	separator := bytes.IndexByte(data, ',')
+	if separator == -1 {
+		return storeadapter.StoreNode{}, false, storeadapter.ErrorInvalidFormat
+	}
+
+	ttl, err := strconv.ParseUint(string(data[:separator]), 10, 64)
+	if err != nil {
+		return storeadapter.StoreNode{}, false, storeadapter.ErrorInvalidFormat
+	}
+
+	node = storeadapter.StoreNode{
+		Key:   key,
+		Value: data[separator+1:],
+		Index: uint64(stat.Mzxid),
+	}
+
+	if ttl == 0 {
+		return node, false, nil
+	}
+
+	modifiedAt := time.Unix(0, stat.Mtime*int64(time.Millisecond))
+	remaining := modifiedAt.Add(time.Duration(ttl) * time.Second).Sub(adapter.timeProvider.Time())
+	if remaining <= 0 {
+		return storeadapter.StoreNode{}, true, nil
+	}
+
+	node.TTL = uint64((remaining + time.Second - 1) / time.Second)
+	return node, false, nil
+}
+
+func (adapter *ZookeeperStoreAdapter) translateError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case zk.ErrNoNode:
+		return storeadapter.ErrorKeyNotFound
+	case zk.ErrNodeExists:
+		return storeadapter.ErrorKeyExists
+	case zk.ErrBadVersion:
+		return storeadapter.ErrorKeyComparisonFailed
+	case zk.ErrNotEmpty:
+		return storeadapter.ErrorNodeIsDirectory
+	}
+	return err
+}
+
+func isDir(data []byte, stat *zk.Stat) bool {
+	return len(data) == 0 || stat.NumChildren > 0
+}
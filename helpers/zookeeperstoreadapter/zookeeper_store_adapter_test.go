@@ -0,0 +1,83 @@
+package zookeeperstoreadapter_test
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	. "github.com/cloudfoundry/hm9000/helpers/zookeeperstoreadapter"
+	"github.com/cloudfoundry/hm9000/testhelpers/storeadapterconformance"
+	"github.com/cloudfoundry/storeadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// These specs need a ZooKeeper server: point HM9000_ZOOKEEPER_URLS at one
+// (comma separated host:port pairs) to run them.
+var _ = Describe("ZookeeperStoreAdapter", func() {
+	urls := os.Getenv("HM9000_ZOOKEEPER_URLS")
+
+	var adapter *ZookeeperStoreAdapter
+
+	BeforeEach(func() {
+		if urls == "" {
+			Skip("HM9000_ZOOKEEPER_URLS is not set")
+		}
+	})
+
+	AfterEach(func() {
+		if adapter != nil {
+			adapter.Disconnect()
+		}
+	})
+
+	newAdapter := func() storeadapter.StoreAdapter {
+		adapter = NewZookeeperStoreAdapter(strings.Split(urls, ","), timeprovider.NewTimeProvider(), 10*time.Second)
+		Ω(adapter.Connect()).Should(Succeed())
+		return adapter
+	}
+
+	storeadapterconformance.ItBehavesLikeAStoreAdapter(newAdapter)
+
+	Describe("TTL emulation", func() {
+		It("stops returning keys once their TTL has passed", func() {
+			newAdapter()
+			err := adapter.SetMulti([]storeadapter.StoreNode{{Key: "/conformance/short-lived", Value: []byte("gone soon"), TTL: 1}})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(func() error {
+				_, err := adapter.Get("/conformance/short-lived")
+				return err
+			}, 3).Should(Equal(storeadapter.ErrorKeyNotFound))
+
+			dir, err := adapter.ListRecursively("/conformance")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(dir.ChildNodes).Should(BeEmpty())
+
+			adapter.Delete("/conformance")
+		})
+	})
+
+	Describe("maintaining a node", func() {
+		It("holds the node until it is released", func() {
+			newAdapter()
+			status, release, err := adapter.MaintainNode(storeadapter.StoreNode{Key: "/conformance/lock", Value: []byte("me"), TTL: 1})
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(status).Should(Receive(BeTrue()))
+
+			node, err := adapter.Get("/conformance/lock")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.Value).Should(Equal([]byte("me")))
+
+			released := make(chan bool)
+			release <- released
+			Eventually(released).Should(BeClosed())
+
+			_, err = adapter.Get("/conformance/lock")
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+
+			adapter.Delete("/conformance")
+		})
+	})
+})
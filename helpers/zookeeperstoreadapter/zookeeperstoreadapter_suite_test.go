@@ -0,0 +1,13 @@
+package zookeeperstoreadapter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestZookeeperStoreAdapter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ZookeeperStoreAdapter Suite")
+}
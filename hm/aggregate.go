@@ -0,0 +1,44 @@
+package hm
+
+import (
+	"github.com/cloudfoundry/hm9000/aggregator"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+func Aggregate(l logger.Logger, conf *config.Config, configPath string, poll bool) {
+	stop := shutdownOnSignal(l, conf)
+	store := connectToStore(l, conf)
+
+	if poll {
+		l.Info("Starting Aggregator Daemon...")
+		holdPIDFile(l, conf)
+		startDebugServer(l, conf)
+		reportStoreAdapterStats(l, conf)
+
+		adapter := connectToStoreAdapter(l, conf, nil)
+
+		err := Daemonize(stop, "Aggregator", reloadConfigOnSIGHUP(l, conf, configPath, pausingRuns(l, store, "Aggregator", recordingRuns(l, conf, store, "Aggregator", func() error {
+			return aggregate(l, conf, store)
+		}))), daemonSchedule(l, conf, "Aggregator", store, conf.AggregatorPollingInterval, conf.AggregatorTimeout, func() { notifyReady(l) }), l, adapter)
+		if err != nil {
+			l.Error("Aggregator Errored", err)
+			exit(l, 1)
+		}
+		l.Info("Aggregator Daemon is Down")
+		exit(l, CleanShutdownExitCode)
+	} else {
+		err := aggregate(l, conf, store)
+		if err != nil {
+			exit(l, 1)
+		} else {
+			exit(l, 0)
+		}
+	}
+}
+
+func aggregate(l logger.Logger, conf *config.Config, store store.Store) error {
+	l.Info("Aggregating app summaries")
+	return aggregator.New(store, buildTimeProvider(l), l, conf).Aggregate()
+}
@@ -3,48 +3,66 @@ package hm
 import (
 	"github.com/cloudfoundry/hm9000/analyzer"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/countingstoreadapter"
+	"github.com/cloudfoundry/hm9000/helpers/eventbus"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/webhooks"
 	"github.com/cloudfoundry/hm9000/store"
-
-	"os"
 )
 
-func Analyze(l logger.Logger, conf *config.Config, poll bool) {
-	store := connectToStore(l, conf)
+func Analyze(l logger.Logger, conf *config.Config, configPath string, poll bool) {
+	stop := shutdownOnSignal(l, conf)
+	storeRequests := countingstoreadapter.New(connectToStoreAdapter(l, conf, nil))
+	store := store.NewStore(conf, storeRequests, l)
+	notifier := buildNotifier(l, conf)
+	polling := analyzer.NewAdaptivePolling(conf, l)
 
 	if poll {
 		l.Info("Starting Analyze Daemon...")
+		holdPIDFile(l, conf)
+		startDebugServer(l, conf)
+		reportStoreAdapterStats(l, conf)
 
 		adapter := connectToStoreAdapter(l, conf, nil)
-		err := Daemonize("Analyzer", func() error {
-			return analyze(l, conf, store)
-		}, conf.AnalyzerPollingInterval(), conf.AnalyzerTimeout(), l, adapter)
+		err := DaemonizeAsLeader(stop, "Analyzer", newLeaderElection(l, conf, "Analyzer", adapter), reloadConfigOnSIGHUP(l, conf, configPath, pausingRuns(l, store, "Analyzer", recordingRuns(l, conf, store, "Analyzer", func() error {
+			return analyze(l, conf, store, storeRequests, notifier, polling, nil)
+		}))), daemonSchedule(l, conf, "Analyzer", store, polling.Interval, conf.AnalyzerTimeout, func() { notifyReady(l) }), l)
 
 		if err != nil {
 			l.Error("Analyze Daemon Errored", err)
+			exit(l, 1)
 		}
 		l.Info("Analyze Daemon is Down")
-		os.Exit(1)
+		exit(l, CleanShutdownExitCode)
 	} else {
-		err := analyze(l, conf, store)
+		err := analyze(l, conf, store, storeRequests, notifier, polling, nil)
 		if err != nil {
-			os.Exit(1)
+			exit(l, 1)
 		} else {
-			os.Exit(0)
+			exit(l, 0)
 		}
 	}
 }
 
-func analyze(l logger.Logger, conf *config.Config, store store.Store) error {
+// analyze runs the analyzer once, and publishes PendingMessagesEnqueued to
+// events if it found messages to enqueue.  storeRequests, the adapter under
+// store, counts the run's store requests for the analysis report.
+func analyze(l logger.Logger, conf *config.Config, store store.Store, storeRequests *countingstoreadapter.CountingStoreAdapter, notifier webhooks.Notifier, polling *analyzer.AdaptivePolling, events *eventbus.EventBus) error {
 	l.Info("Analyzing...")
 
-	analyzer := analyzer.New(store, buildTimeProvider(l), l, conf)
+	analyzer := analyzer.New(store, newMetricsAccountant(conf, store), notifier, buildTimeProvider(l), l, conf)
+	analyzer.CountStoreRequests(storeRequests)
 	err := analyzer.Analyze()
 
 	if err != nil {
 		l.Error("Analyzer failed with error", err)
 		return err
 	} else {
+		activity := analyzer.Activity()
+		polling.Record(activity)
+		if activity.StartMessages > 0 || activity.StopMessages > 0 {
+			events.Publish(eventbus.PendingMessagesEnqueued)
+		}
 		l.Info("Analyzer completed succesfully")
 		return nil
 	}
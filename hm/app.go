@@ -0,0 +1,115 @@
+package hm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/status"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+// App prints everything HM9000 knows about an app: its desired state, its
+// instances, its pending messages and what the analyzer would do for it.
+// format is "table" or "json"; --output=json implies json.
+func App(l logger.Logger, conf *config.Config, appGuid string, appVersion string, format string) {
+	shutdownOnSignal(l, conf)
+
+	if appGuid == "" {
+		failUsage(l, "--guid is required")
+	}
+	if format != "table" && format != "json" {
+		failUsage(l, fmt.Sprintf("Unknown format %q: use table or json", format))
+	}
+	if jsonOutput() {
+		format = "json"
+	}
+
+	timeProvider := buildTimeProvider(l)
+	collector := status.New(connectToStore(l, conf), timeProvider, conf)
+
+	reports, err := collector.InspectApp(appGuid, appVersion)
+	if err == store.AppNotFoundError {
+		failUsage(l, fmt.Sprintf("App %s is neither desired nor heartbeating", appGuid))
+	}
+	if err != nil {
+		fail(l, "Failed to read the app", err)
+	}
+
+	if format == "json" {
+		printJSON(l, reports)
+	} else {
+		for _, report := range reports {
+			printAppReport(report, timeProvider.Time())
+		}
+	}
+
+	exit(l, 0)
+}
+
+func printAppReport(report status.AppReport, now time.Time) {
+	fmt.Printf("Guid: %s | Version: %s\n", report.AppGuid, report.AppVersion)
+	if report.Desired == nil {
+		fmt.Printf("Desired: NO\n")
+	} else {
+		fmt.Printf("Desired: %d instances (%s, %s)\n", report.Desired.NumberOfInstances, report.Desired.State, report.Desired.PackageState)
+	}
+
+	fmt.Printf("\nInstances\n")
+	if len(report.Instances) == 0 {
+		fmt.Printf("  none heartbeating\n")
+	} else {
+		table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(table, "  INDEX\tSTATE\tINSTANCE\tDEA\tUPTIME\tCRASHES\n")
+		for _, instance := range report.Instances {
+			fmt.Fprintf(table, "  %d\t%s\t%s\t%s\t%s\t%d\n", instance.Index, instance.State, instance.InstanceGuid, instance.DeaGuid, instance.Uptime, instance.CrashCount)
+		}
+		table.Flush()
+	}
+
+	if len(report.CrashReasons) > 0 {
+		fmt.Printf("\nLast crashes\n")
+		table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(table, "  INDEX\tINSTANCE\tEXIT STATUS\tDESCRIPTION\tAGO\n")
+		for _, reason := range report.CrashReasons {
+			fmt.Fprintf(table, "  %d\t%s\t%d\t%s\t%s\n", reason.InstanceIndex, reason.InstanceGuid, reason.ExitStatusCode, reason.ExitDescription, now.Sub(time.Unix(reason.CrashedAt, 0)))
+		}
+		table.Flush()
+	}
+
+	fmt.Printf("\nPending messages\n")
+	if len(report.PendingStarts) == 0 && len(report.PendingStops) == 0 {
+		fmt.Printf("  none\n")
+	} else {
+		table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(table, "  KIND\tTARGET\tREASON\tSEND\n")
+		for _, start := range report.PendingStarts {
+			fmt.Fprintf(table, "  start\tindex %d\t%s\t%s\n", start.IndexToStart, start.StartReason, sendDescription(start.SendOn, start.SentOn, start.KeepAlive, now))
+		}
+		for _, stop := range report.PendingStops {
+			fmt.Fprintf(table, "  stop\t%s\t%s\t%s\n", stop.InstanceGuid, stop.StopReason, sendDescription(stop.SendOn, stop.SentOn, stop.KeepAlive, now))
+		}
+		table.Flush()
+	}
+
+	fmt.Printf("\nAnalyzer\n")
+	if !report.Fresh {
+		fmt.Printf("  The store is not fresh, so the analyzer would do nothing.  Were it fresh:\n")
+	}
+	for _, step := range report.Explanation.Steps {
+		fmt.Printf("  - %s\n", step)
+	}
+	fmt.Printf("  => %d starts and %d stops to enqueue\n", len(report.Explanation.StartMessages), len(report.Explanation.StopMessages))
+	fmt.Printf("\n%s\n", strings.Repeat("=", 20))
+}
+
+func sendDescription(sendOn int64, sentOn int64, keepAlive int, now time.Time) string {
+	if sentOn != 0 {
+		return fmt.Sprintf("sent, deleted in %s", time.Unix(sentOn+int64(keepAlive), 0).Sub(now))
+	}
+	return fmt.Sprintf("in %s", time.Unix(sendOn, 0).Sub(now))
+}
@@ -0,0 +1,67 @@
+package hm
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry/gunk/workpool"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/dualwrite"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// keysToPrint is how many of each kind of inconsistent key
+// check_store_migration lists before it just counts them.
+const keysToPrint = 10
+
+// CheckStoreMigration compares the store with the store_migration_urls store
+// it is being migrated to, and exits 1 if they differ.
+func CheckStoreMigration(l logger.Logger, conf *config.Config) {
+	shutdownOnSignal(l, conf)
+	if len(conf.StoreMigrationURLs) == 0 {
+		fail(l, "Failed to check the store migration", fmt.Errorf("store_migration_urls is not set"))
+	}
+
+	source := connectToMigrationStore(l, conf, "store", conf.StoreType, conf.StoreURLs)
+	target := connectToMigrationStore(l, conf, "migration target store", conf.StoreMigrationStoreType(), conf.StoreMigrationURLs)
+
+	comparison, err := dualwrite.Compare(source, target, store.NewStore(conf, source, l).SchemaRoot())
+	if err != nil {
+		fail(l, "Failed to compare the stores", err)
+	}
+
+	if jsonOutput() {
+		printJSON(l, comparison)
+	} else {
+		fmt.Printf("Compared %d keys: %d missing from the target, %d extra in the target, %d different\n", comparison.KeysCompared, len(comparison.Missing), len(comparison.Extra), len(comparison.Different))
+		printMigrationKeys("missing", comparison.Missing)
+		printMigrationKeys("extra", comparison.Extra)
+		printMigrationKeys("different", comparison.Different)
+	}
+
+	if !comparison.IsConsistent() {
+		exit(l, 1)
+	}
+	exit(l, 0)
+}
+
+func connectToMigrationStore(l logger.Logger, conf *config.Config, name string, storeType string, urls []string) storeadapter.StoreAdapter {
+	adapter := newStoreAdapter(l, conf, storeType, urls, workpool.DefaultAround)
+	err := adapter.Connect()
+	if err != nil {
+		fail(l, "Failed to connect to the "+name, err)
+	}
+	onShutdown("disconnect from the "+name, func() { adapter.Disconnect() })
+	return adapter
+}
+
+func printMigrationKeys(kind string, keys []string) {
+	for i, key := range keys {
+		if i == keysToPrint {
+			fmt.Printf("  [%s] ... and %d more\n", kind, len(keys)-keysToPrint)
+			return
+		}
+		fmt.Printf("  [%s] %s\n", kind, key)
+	}
+}
@@ -1,21 +1,37 @@
 package hm
 
 import (
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudfoundry/gunk/timeprovider"
 	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
 	"github.com/cloudfoundry/gunk/workpool"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/dualwrite"
+	"github.com/cloudfoundry/hm9000/helpers/encryption"
+	"github.com/cloudfoundry/hm9000/helpers/failover"
+	"github.com/cloudfoundry/hm9000/helpers/faultinjection"
+	"github.com/cloudfoundry/hm9000/helpers/hedgedreads"
+	"github.com/cloudfoundry/hm9000/helpers/httpclient"
+	"github.com/cloudfoundry/hm9000/helpers/instrumentedstoreadapter"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
+	"github.com/cloudfoundry/hm9000/helpers/natsconnection"
+	"github.com/cloudfoundry/hm9000/helpers/readthroughcache"
+	"github.com/cloudfoundry/hm9000/helpers/webhooks"
+	"github.com/cloudfoundry/hm9000/helpers/zookeeperstoreadapter"
 	"github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/storeadapter"
 	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
-	"github.com/cloudfoundry/yagnats"
 
 	"os"
 )
@@ -35,59 +51,143 @@ func buildTimeProvider(l logger.Logger) timeprovider.TimeProvider {
 	}
 }
 
-func connectToMessageBus(l logger.Logger, conf *config.Config) yagnats.NATSConn {
-	members := make([]string, len(conf.NATS))
+func connectToMessageBus(l logger.Logger, conf *config.Config) messagebus.MessageBus {
+	clusters := natsClusters(conf)
+	dial, err := natsDialer(conf)
+	if err != nil {
+		l.Error("Failed to load the message bus TLS configuration", err)
+		os.Exit(1)
+	}
 
-	for _, natsConf := range conf.NATS {
-		uri := url.URL{
-			Scheme: "nats",
-			User:   url.UserPassword(natsConf.User, natsConf.Password),
-			Host:   fmt.Sprintf("%s:%d", natsConf.Host, natsConf.Port),
-		}
-		members = append(members, uri.String())
+	if len(clusters) == 1 {
+		var natsClient messagebus.MessageBus
+		requireNATS(l, conf, func() (err error) {
+			natsClient, err = dial(clusters[0])
+			return err
+		})
+		onShutdown("close the message bus", func() { closeMessageBus(natsClient) })
+		return messagebus.NewCategorizedBus(injectNATSFaults(l, conf, natsClient))
 	}
 
-	natsClient, err := yagnats.Connect(members)
+	var metricsAccountant metricsaccountant.MetricsAccountant
+	var natsClient *natsconnection.FailoverConn
+	requireNATS(l, conf, func() (err error) {
+		natsClient, err = natsconnection.NewFailoverConn(clusters, dial, conf.NATSFailoverThreshold, func(index int, failedOver bool) {
+			if metricsAccountant == nil {
+				metricsAccountant = newMetricsAccountant(conf, connectToStore(l, conf))
+			}
+			onNATSClusterConnect(l, metricsAccountant, index, failedOver)
+		}, l)
+		return err
+	})
+
+	go natsClient.MonitorHealth(buildTimeProvider(l), conf.NATSHealthCheckInterval())
+
+	onShutdown("close the message bus", func() { closeMessageBus(natsClient) })
+	return messagebus.NewCategorizedBus(injectNATSFaults(l, conf, natsClient))
+}
+
+// startEmbeddedNATS starts the embedded NATS server when embedded_nats is
+// set, so that connectToMessageBus has something to connect to.  The server
+// is shut down after the message bus is closed.
+func startEmbeddedNATS(l logger.Logger, conf *config.Config) {
+	if !conf.EmbeddedNATS {
+		return
+	}
+
+	address := conf.EmbeddedNATSServer()
+	server, err := messagebus.StartEmbeddedServer(address.Host, address.Port)
 	if err != nil {
-		l.Error("Failed to connect to the message bus", err)
+		l.Error("Failed to start the embedded NATS server", err)
 		os.Exit(1)
 	}
+	l.Info("Started the embedded NATS server", map[string]string{"Address": server.Address()})
+	onShutdown("stop the embedded NATS server", server.Shutdown)
+}
 
+func injectNATSFaults(l logger.Logger, conf *config.Config, natsClient messagebus.MessageBus) messagebus.MessageBus {
+	if injector := buildFaultInjector(l, conf); injector != nil {
+		return faultinjection.NewNATSConn(natsClient, injector, conf.FaultInjection.NATSDropRate)
+	}
 	return natsClient
 }
 
-func acquireLock(l logger.Logger, conf *config.Config, lockName string) {
-	adapter := connectToStoreAdapter(l, conf, nil)
-	l.Info("Acquiring lock for " + lockName)
+func natsClusters(conf *config.Config) []natsconnection.Cluster {
+	clusters := []natsconnection.Cluster{}
+	for _, clusterConf := range conf.NATSClusterList() {
+		cluster := natsconnection.Cluster{Name: clusterConf.Name}
+		for _, natsConf := range clusterConf.Servers {
+			uri := url.URL{
+				Scheme: "nats",
+				User:   url.UserPassword(natsConf.User, natsConf.Password),
+				Host:   fmt.Sprintf("%s:%d", natsConf.Host, natsConf.Port),
+			}
+			cluster.Servers = append(cluster.Servers, uri.String())
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// natsDialer returns a function that connects to one NATS cluster with the
+// configured reconnect jitter and TLS settings.
+func natsDialer(conf *config.Config) (func(natsconnection.Cluster) (messagebus.MessageBus, error), error) {
+	var tlsConfig *tls.Config
+	if conf.NATSTLS.Enabled {
+		var err error
+		tlsConfig, err = natsconnection.TLSConfig(conf.NATSTLS.CACertFile, conf.NATSTLS.ClientCertFile, conf.NATSTLS.ClientKeyFile, conf.NATSTLS.SkipVerify)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(cluster natsconnection.Cluster) (messagebus.MessageBus, error) {
+		options := natsconnection.DefaultOptions(cluster.Servers)
+		natsconnection.AddReconnectJitter(&options, conf.NATSReconnectJitter())
+		if tlsConfig != nil {
+			options.Secure = true
+			options.TLSConfig = tlsConfig
+		}
+		return natsconnection.Connect(options)
+	}, nil
+}
 
-	lock := storeadapter.StoreNode{
-		Key: "/hm/locks/" + lockName,
-		TTL: 10,
+// closeMessageBus waits for a ping to come back, which flushes the messages
+// published so far, before closing the connection.
+func closeMessageBus(messageBus messagebus.MessageBus) {
+	messageBus.Ping()
+	messageBus.Close()
+}
+
+func onNATSClusterConnect(l logger.Logger, metricsAccountant metricsaccountant.MetricsAccountant, index int, failedOver bool) {
+	err := metricsAccountant.TrackNATSCluster(index)
+	if err != nil {
+		l.Error("Failed to track the active NATS cluster", err)
 	}
 
-	status, _, err := adapter.MaintainNode(lock)
+	if failedOver {
+		err = metricsAccountant.IncrementNATSFailovers()
+		if err != nil {
+			l.Error("Failed to track NATS failover", err)
+		}
+	}
+}
+
+// acquireLock blocks until the lock is held, and releases it when the process
+// shuts down.  It exits the process if the lock cannot be taken or is lost,
+// and exits cleanly if the process is asked to shut down while waiting.
+func acquireLock(l logger.Logger, conf *config.Config, lockName string) {
+	release, err := holdLock(l, connectToStoreAdapter(l, conf, nil), "/hm/locks/"+lockName, shutdownOnSignal(l, conf))
 	if err != nil {
 		l.Error("Failed to talk to lock store", err)
 		os.Exit(1)
 	}
+	if release == nil {
+		l.Info("Shut down while waiting for the lock for " + lockName)
+		exit(l, CleanShutdownExitCode)
+	}
 
-	lockAcquired := make(chan bool)
-
-	go func() {
-		for {
-			if <-status {
-				if lockAcquired != nil {
-					close(lockAcquired)
-					lockAcquired = nil
-				}
-			} else {
-				l.Info("Lost the lock")
-				os.Exit(197)
-			}
-		}
-	}()
-
-	<-lockAcquired
+	onShutdown("release the lock for "+lockName, release)
 	l.Info("Acquired lock for " + lockName)
 }
 
@@ -97,15 +197,193 @@ func connectToStoreAdapter(l logger.Logger, conf *config.Config, usage *usageTra
 	if usage != nil {
 		around = usage
 	}
-	workPool := workpool.New(conf.StoreMaxConcurrentRequests, 0, around)
-	adapter = etcdstoreadapter.NewETCDStoreAdapter(conf.StoreURLs, workPool)
-	err := adapter.Connect()
+	primary := newStoreAdapter(l, conf, conf.StoreType, conf.StoreURLs, around)
+	instrumented := []*instrumentedstoreadapter.InstrumentedStoreAdapter{primary}
+	adapter = primary
+
+	if len(conf.SecondaryStoreURLs) > 0 {
+		secondary := newStoreAdapter(l, conf, conf.StoreType, conf.SecondaryStoreURLs, around)
+		instrumented = append(instrumented, secondary)
+		adapter = failover.New(adapter, secondary, conf.StoreFailoverThreshold, func(secondary storeadapter.StoreAdapter) {
+			onStoreFailover(l, conf, secondary)
+		}, l)
+	}
+
+	if len(conf.StoreMigrationURLs) > 0 {
+		target := newStoreAdapter(l, conf, conf.StoreMigrationStoreType(), conf.StoreMigrationURLs, around)
+		instrumented = append(instrumented, target)
+		adapter = dualwrite.New(adapter, target, l)
+	}
+
+	if injector := buildFaultInjector(l, conf); injector != nil {
+		adapter = faultinjection.NewStoreAdapter(adapter, injector, conf.FaultInjection.StoreLatencyInMilliseconds.Duration, conf.FaultInjection.StoreLatencyRate)
+	}
+
+	requireStore(l, conf, adapter)
+
+	if len(conf.StoreEncryptionKeys) > 0 {
+		schemaRoot := store.NewStore(conf, adapter, l).SchemaRoot()
+		adapter = encryption.NewEncryptingStoreAdapter(adapter, buildEncryptor(l, conf), []string{
+			schemaRoot + "/apps/desired",
+		})
+	}
+
+	onShutdown("disconnect from the store", func() { adapter.Disconnect() })
+	storeAdapterStatsReporter.Add(instrumented...)
+
+	return adapter
+}
+
+func newStoreAdapter(l logger.Logger, conf *config.Config, storeType string, urls []string, around workpool.AroundWork) *instrumentedstoreadapter.InstrumentedStoreAdapter {
+	var adapter storeadapter.StoreAdapter
+
+	switch storeType {
+	case "etcd":
+		workPool := workpool.New(conf.StoreMaxConcurrentRequests, 0, around)
+		adapter = etcdstoreadapter.NewETCDStoreAdapter(urls, workPool)
+		if conf.StoreHedgedReadThreshold() > 0 && len(urls) > 1 {
+			// The primary sends its requests to the first of the urls, so a
+			// hedge is sent only to one of the others.
+			hedges := []storeadapter.StoreAdapter{}
+			for _, url := range urls[1:] {
+				hedges = append(hedges, etcdstoreadapter.NewETCDStoreAdapter([]string{url}, workPool))
+			}
+			adapter = hedgedreads.New(adapter, hedges, conf.StoreHedgedReadThreshold(), l)
+		}
+	case "zookeeper":
+		adapter = zookeeperstoreadapter.NewZookeeperStoreAdapter(urls, timeprovider.NewTimeProvider(), time.Duration(conf.HeartbeatTTL())*time.Second)
+	default:
+		l.Error("Unknown store type", fmt.Errorf("store_type must be etcd or zookeeper, got %q", storeType))
+		os.Exit(1)
+	}
+
+	return instrumentedstoreadapter.New(adapter, conf.StoreRequestTimeout(), conf.StoreRequestRetries, conf.StoreRetryDelay())
+}
+
+// buildNotifier returns a notifier for the configured webhooks.  Build one
+// per process: it remembers whether it last reported the store fresh.
+func buildNotifier(l logger.Logger, conf *config.Config) webhooks.Notifier {
+	hooks := []webhooks.Hook{}
+	for _, webhook := range conf.Webhooks {
+		hooks = append(hooks, webhooks.Hook{
+			URL:        webhook.URL,
+			Events:     webhook.Events,
+			User:       webhook.AuthUser,
+			Password:   webhook.AuthPassword,
+			Token:      webhook.AuthToken,
+			Timeout:    webhook.Timeout(),
+			Retries:    webhook.Retries,
+			RetryDelay: webhook.RetryDelay(),
+		})
+	}
+	return webhooks.New(hooks, buildTimeProvider(l), l)
+}
+
+// newCCHttpClient returns the client used to talk to the CC, which
+// reports each request it makes to observe, if set.
+func newCCHttpClient(l logger.Logger, conf *config.Config, observe func(httpclient.Observation)) httpclient.HttpClient {
+	var client httpclient.HttpClient = httpclient.NewHttpClientWithOptions(httpclient.Options{
+		SkipSSLVerification:       conf.SkipSSLVerification,
+		Timeout:                   conf.FetcherNetworkTimeout(),
+		HostTimeouts:              conf.FetcherHostTimeouts(),
+		MaxRetries:                conf.FetcherRequestRetries,
+		RetryDelay:                conf.FetcherRetryDelay(),
+		MaxIdleConnectionsPerHost: conf.FetcherMaxIdleConnectionsPerHost,
+		Observe:                   observe,
+	})
+
+	if injector := buildFaultInjector(l, conf); injector != nil {
+		client = faultinjection.NewHttpClient(client, injector, conf.FaultInjection.CCFailureRate)
+	}
+	return client
+}
+
+var faultInjectorOnce sync.Once
+var faultInjector *faultinjection.Injector
+
+// buildFaultInjector returns the injector shared by the process's fault
+// injection layers, or nil if fault injection is disabled.
+func buildFaultInjector(l logger.Logger, conf *config.Config) *faultinjection.Injector {
+	if !conf.FaultInjection.Enabled {
+		return nil
+	}
+
+	faultInjectorOnce.Do(func() {
+		seed := conf.FaultInjection.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		l.Info("Fault injection is enabled", map[string]string{
+			"Seed":               strconv.FormatInt(seed, 10),
+			"Store Latency":      conf.FaultInjection.StoreLatencyInMilliseconds.String(),
+			"Store Latency Rate": strconv.FormatFloat(conf.FaultInjection.StoreLatencyRate, 'f', -1, 64),
+			"NATS Drop Rate":     strconv.FormatFloat(conf.FaultInjection.NATSDropRate, 'f', -1, 64),
+			"CC Failure Rate":    strconv.FormatFloat(conf.FaultInjection.CCFailureRate, 'f', -1, 64),
+		})
+		faultInjector = faultinjection.NewInjector(seed)
+	})
+	return faultInjector
+}
+
+// onStoreFailover revokes freshness on the secondary store so that nothing
+// acts on its contents until the fetcher and listener have re-populated it.
+func onStoreFailover(l logger.Logger, conf *config.Config, secondary storeadapter.StoreAdapter) {
+	secondaryStore := store.NewStore(conf, secondary, l)
+
+	err := secondaryStore.RevokeActualFreshness()
+	if err != nil && err != storeadapter.ErrorKeyNotFound {
+		l.Error("Failed to revoke actual freshness after store failover", err)
+	}
+
+	err = secondaryStore.RevokeDesiredFreshness()
+	if err != nil && err != storeadapter.ErrorKeyNotFound {
+		l.Error("Failed to revoke desired freshness after store failover", err)
+	}
+
+	err = newMetricsAccountant(conf, secondaryStore).IncrementStoreFailovers()
 	if err != nil {
-		l.Error("Failed to connect to the store", err)
+		l.Error("Failed to track store failover", err)
+	}
+}
+
+// newMetricsAccountant saves metrics in store, unless metrics_disabled is
+// set for the component.
+func newMetricsAccountant(conf *config.Config, store store.Store) *metricsaccountant.RealMetricsAccountant {
+	if conf.MetricsDisabled {
+		return metricsaccountant.NewDisabled(store)
+	}
+	return metricsaccountant.New(store)
+}
+
+func buildEncryptor(l logger.Logger, conf *config.Config) *encryption.Encryptor {
+	keys := []encryption.Key{}
+	for _, keyConf := range conf.StoreEncryptionKeys {
+		encodedKey := keyConf.Key
+		if keyConf.KeyFile != "" {
+			contents, err := ioutil.ReadFile(keyConf.KeyFile)
+			if err != nil {
+				l.Error("Failed to read encryption key file", err, map[string]string{"Label": keyConf.Label})
+				os.Exit(1)
+			}
+			encodedKey = strings.TrimSpace(string(contents))
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			l.Error("Failed to decode encryption key", err, map[string]string{"Label": keyConf.Label})
+			os.Exit(1)
+		}
+
+		keys = append(keys, encryption.Key{Label: keyConf.Label, Secret: secret})
+	}
+
+	encryptor, err := encryption.NewEncryptor(keys, conf.StoreEncryptionActiveKeyLabel)
+	if err != nil {
+		l.Error("Failed to build encryptor", err)
 		os.Exit(1)
 	}
 
-	return adapter
+	return encryptor
 }
 
 func connectToStore(l logger.Logger, conf *config.Config) store.Store {
@@ -113,8 +391,24 @@ func connectToStore(l logger.Logger, conf *config.Config) store.Store {
 	return store.NewStore(conf, adapter, l)
 }
 
+func connectToCachingStore(l logger.Logger, conf *config.Config) store.Store {
+	return newCachingStore(l, conf, connectToStoreAdapter(l, conf, nil))
+}
+
+func newCachingStore(l logger.Logger, conf *config.Config, adapter storeadapter.StoreAdapter) store.Store {
+	schemaRoot := store.NewStore(conf, adapter, l).SchemaRoot()
+
+	cache := readthroughcache.New(adapter, timeprovider.NewTimeProvider(), conf.StoreReadCacheTTL(), conf.StoreReadCacheMaxEntries, []string{
+		schemaRoot + conf.ActualFreshnessKey,
+		schemaRoot + conf.DesiredFreshnessKey,
+		schemaRoot + "/apps/desired",
+	})
+	return store.NewStore(conf, cache, l)
+}
+
 func connectToStoreAndTrack(l logger.Logger, conf *config.Config) (store.Store, metricsaccountant.UsageTracker) {
 	tracker := newUsageTracker(conf.StoreMaxConcurrentRequests)
+	startDebugServer(l, conf).AddQueue("store_requests_in_flight", tracker.InFlight)
 	adapter := connectToStoreAdapter(l, conf, tracker)
 	return store.NewStore(conf, adapter, l), tracker
 }
@@ -0,0 +1,32 @@
+package hm
+
+import (
+	"strings"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+// pausingRuns wraps a polling component's callback so that its runs are
+// skipped while an operator has paused it through the admin API.  If the
+// controls cannot be read the run goes ahead: the store is most likely down,
+// and the run will find that out for itself.
+func pausingRuns(l logger.Logger, store store.Store, component string, callback func() error) func() error {
+	controlled := strings.ToLower(component)
+
+	return func() error {
+		controls, err := store.GetComponentControls()
+		if err != nil {
+			l.Error("Failed to read component controls", err, map[string]string{"Component": component})
+		} else if control := controls[controlled]; control.Paused {
+			l.Info("Paused, skipping this run", map[string]string{
+				"Component": component,
+				"Paused By": control.ChangedBy,
+				"Reason":    control.Reason,
+			})
+			return nil
+		}
+
+		return callback()
+	}
+}
@@ -0,0 +1,44 @@
+package hm
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+// recordingRuns wraps a polling component's callback so that each run is
+// saved to the store, where hm9000 status reports it, and the error of each
+// failed run is counted by category.
+func recordingRuns(l logger.Logger, conf *config.Config, store store.Store, component string, callback func() error) func() error {
+	timeProvider := buildTimeProvider(l)
+	accountant := newMetricsAccountant(conf, store)
+
+	return func() error {
+		startedAt := timeProvider.Time()
+		t := time.Now()
+		err := callback()
+
+		run := models.ComponentRun{
+			Component:              component,
+			StartedAt:              startedAt.Unix(),
+			DurationInMilliseconds: int64(time.Since(t) / time.Millisecond),
+		}
+		if err != nil {
+			run.Error = err.Error()
+			countErr := accountant.IncrementErrors(component, err)
+			if countErr != nil {
+				l.Error("Failed to count component error", countErr, map[string]string{"Component": component})
+			}
+		}
+
+		saveErr := store.SaveComponentRun(run)
+		if saveErr != nil {
+			l.Error("Failed to record component run", saveErr, map[string]string{"Component": component})
+		}
+
+		return err
+	}
+}
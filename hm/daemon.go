@@ -3,66 +3,267 @@ package hm
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/cloudfoundry/hm9000/helpers/leaderelection"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/watchdog"
 	"github.com/cloudfoundry/storeadapter"
 )
 
+// Schedule says when a daemon runs and what it does about failed runs.  Its
+// functions are called afresh for every run, so that a reloaded config takes
+// effect straight away.  Only Period and Timeout are required.
+type Schedule struct {
+	// Period is the time from the start of one run to the start of the next.
+	// A run that takes longer than Period is followed straight away by the
+	// next.
+	Period func() time.Duration
+
+	// Next, if set, times the runs instead of Period: each run starts at the
+	// time Next returns for the start of the one before, or straight away if
+	// that has passed.  Failed runs are not backed off.  Where Next returns
+	// the zero time, Period is used.
+	Next func(started time.Time) time.Time
+
+	// Timeout is how long a run may take before the daemon gives up.
+	Timeout func() time.Duration
+
+	// Jitter is the most that is added, at random, to each period, so that
+	// daemons started together do not hit the store together.
+	Jitter func() time.Duration
+
+	// MaximumFailureBackoff is the longest the period may grow to while runs
+	// fail: each failed run in a row doubles it, up to this limit.  A limit
+	// no longer than Period turns backoff off.
+	MaximumFailureBackoff func() time.Duration
+
+	// MaxConsecutiveFailures is the number of failed runs in a row after
+	// which the daemon gives up.  Zero means never.
+	MaxConsecutiveFailures func() int
+
+	// OnPanic is called when a run panics.  The panic is recovered and the
+	// run counts as failed.
+	OnPanic func()
+
+	// OnSuccess is called after each run that succeeds.
+	OnSuccess func()
+
+	// Wake, if set, starts the next run early when it receives, as soon as
+	// MinimumWakeInterval has passed since the last run started.  Runs that
+	// follow a failure are not woken, so that failures are still backed
+	// off.
+	Wake                <-chan struct{}
+	MinimumWakeInterval func() time.Duration
+
+	// Watchdog, if set, is told as each run starts to expect it to finish
+	// within the period, and as each wait starts to expect the next run
+	// within the wait, so that it trips if the daemon wedges.
+	Watchdog *watchdog.Watchdog
+}
+
+var jitterSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+var jitterLock = &sync.Mutex{}
+
+// wait is the time from the start of a run, at started, to the start of the
+// next, after the given number of failed runs in a row.
+func (schedule Schedule) wait(started time.Time, failures int) time.Duration {
+	wait := schedule.Period()
+
+	next := schedule.next(started)
+	if !next.IsZero() {
+		wait = next.Sub(started)
+	} else if failures > 0 && schedule.MaximumFailureBackoff != nil {
+		maximum := schedule.MaximumFailureBackoff()
+		for i := 0; i < failures && wait < maximum; i++ {
+			wait *= 2
+		}
+		if wait > maximum && maximum > schedule.Period() {
+			wait = maximum
+		}
+	}
+
+	if schedule.Jitter != nil && schedule.Jitter() > 0 {
+		jitterLock.Lock()
+		wait += time.Duration(jitterSource.Int63n(int64(schedule.Jitter())))
+		jitterLock.Unlock()
+	}
+
+	return wait
+}
+
+func (schedule Schedule) next(started time.Time) time.Time {
+	if schedule.Next == nil {
+		return time.Time{}
+	}
+	return schedule.Next(started)
+}
+
+func (schedule Schedule) expect(interval time.Duration) {
+	if schedule.Watchdog != nil {
+		schedule.Watchdog.Expect(interval)
+	}
+}
+
+// wake is the channel that may start the run after the given number of
+// failed runs in a row early, and the earliest it may start it.
+func (schedule Schedule) wake(started time.Time, failures int) (<-chan struct{}, time.Time) {
+	if failures > 0 {
+		return nil, started
+	}
+	if schedule.MinimumWakeInterval == nil {
+		return schedule.Wake, started
+	}
+	return schedule.Wake, started.Add(schedule.MinimumWakeInterval())
+}
+
+func (schedule Schedule) maxConsecutiveFailures() int {
+	if schedule.MaxConsecutiveFailures == nil {
+		return 0
+	}
+	return schedule.MaxConsecutiveFailures()
+}
+
+// Daemonize takes the component's lock and then runs callback on schedule
+// until stop is closed, a run times out or too many runs fail in a row.
+// Closing stop lets a run in progress finish (or time out), releases the lock
+// and returns nil.  A nil stop is never closed.
 func Daemonize(
+	stop <-chan struct{},
 	component string,
 	callback func() error,
-	period time.Duration,
-	timeout time.Duration,
+	schedule Schedule,
 	logger logger.Logger,
 	adapter storeadapter.StoreAdapter,
 ) error {
-	logger.Info("Acquiring lock for " + component)
+	release, err := holdLock(logger, adapter, leaderelection.LockKey(component), stop)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to acquire lock: %s", err))
+		return err
+	}
+	if release == nil {
+		return nil
+	}
+
+	logger.Info("Acquired lock for " + component)
+
+	return runDaemon(stop, component, callback, schedule, logger, release)
+}
+
+// holdLock blocks until it holds the lock at key, and then keeps holding it
+// until release is called.  The process exits with 197 if the lock is lost.
+// If stop is closed first, holdLock gives up waiting and returns a nil
+// release.
+func holdLock(logger logger.Logger, adapter storeadapter.StoreAdapter, key string, stop <-chan struct{}) (release func(), err error) {
+	logger.Info("Acquiring lock", map[string]string{"Lock": key})
 
 	lock := storeadapter.StoreNode{
-		Key: "/hm/locks/" + component,
+		Key: key,
 		TTL: 10,
 	}
 
 	status, releaseLockChannel, err := adapter.MaintainNode(lock)
 	if err != nil {
-		logger.Info(fmt.Sprintf("Failed to acquire lock: %s", err))
-		return err
+		return nil, err
 	}
 
 	lockAcquired := make(chan bool)
+	releasing := make(chan bool)
 
 	go func() {
 		l := lockAcquired
 		for {
-			if <-status {
-				if l != nil {
-					close(l)
-					l = nil
+			select {
+			case held := <-status:
+				if held {
+					if l != nil {
+						close(l)
+						l = nil
+					}
+				} else {
+					logger.Info("Lost the lock", map[string]string{"Lock": key})
+					os.Exit(197)
 				}
-			} else {
-				logger.Info("Lost the lock")
-				os.Exit(197)
+			case <-releasing:
+				return
 			}
 		}
 	}()
 
-	<-lockAcquired
+	release = func() {
+		close(releasing)
+		released := make(chan bool)
+		releaseLockChannel <- released
+		<-released
+	}
 
-	logger.Info("Acquired lock for " + component)
+	select {
+	case <-lockAcquired:
+		return release, nil
+	case <-stop:
+		release()
+		return nil, nil
+	}
+}
 
-	logger.Info(fmt.Sprintf("Running Daemon every %d seconds with a timeout of %d", int(period.Seconds()), int(timeout.Seconds())))
+// DaemonizeAsLeader is Daemonize for components that may run in several
+// processes at once: each process polls, but callback only runs in the one
+// that leads election.  A process stops leading when it stops or gives up.
+func DaemonizeAsLeader(
+	stop <-chan struct{},
+	component string,
+	election *leaderelection.Election,
+	callback func() error,
+	schedule Schedule,
+	logger logger.Logger,
+) error {
+	election.Start()
 
-	for {
-		afterChan := time.After(period)
-		timeoutChan := time.After(timeout)
-		errorChan := make(chan error, 1)
+	return runDaemon(stop, component, func() error {
+		if !election.IsLeader() {
+			logger.Debug("Not the leader, skipping this run", map[string]string{"Component": component})
+			return nil
+		}
+		return callback()
+	}, schedule, logger, election.Stop)
+}
+
+// runDaemon runs callback on schedule until stop is closed, a run times out
+// or too many runs fail in a row, and then calls release.
+func runDaemon(
+	stop <-chan struct{},
+	component string,
+	callback func() error,
+	schedule Schedule,
+	logger logger.Logger,
+	release func(),
+) error {
+	if next := schedule.next(time.Now()); !next.IsZero() {
+		logger.Info(fmt.Sprintf("Running Daemon on a schedule, next after this run at %s, with a timeout of %d", next.Format(time.RFC3339), int(schedule.Timeout().Seconds())))
+	} else {
+		logger.Info(fmt.Sprintf("Running Daemon every %d seconds with a timeout of %d", int(schedule.Period().Seconds()), int(schedule.Timeout().Seconds())))
+	}
+
+	if schedule.Watchdog != nil {
+		schedule.Watchdog.Start()
+		defer schedule.Watchdog.Stop()
+	}
 
+	failures := 0
+	interval := schedule.Period()
+	for {
 		t := time.Now()
+		schedule.expect(interval)
+		timeoutChan := time.After(schedule.Timeout())
+		errorChan := make(chan error, 1)
 
 		go func() {
-			errorChan <- callback()
+			errorChan <- runRecovering(component, callback, schedule.OnPanic, logger)
 		}()
 
 		select {
@@ -71,19 +272,84 @@ func Daemonize(
 				"Component": component,
 				"Duration":  fmt.Sprintf("%.4f", time.Since(t).Seconds()),
 			})
-			if err != nil {
-				logger.Error("Daemon returned an error. Continuining...", err)
+			if err == nil {
+				failures = 0
+				if schedule.OnSuccess != nil {
+					schedule.OnSuccess()
+				}
+				break
 			}
-		case <-timeoutChan:
-			released := make(chan bool)
-			releaseLockChannel <- released
-			<-released
 
+			failures++
+			logger.Error("Daemon returned an error. Continuining...", err, map[string]string{
+				"Component":            component,
+				"Consecutive Failures": strconv.Itoa(failures),
+			})
+			if max := schedule.maxConsecutiveFailures(); max > 0 && failures >= max {
+				release()
+				return fmt.Errorf("Daemon failed %d times in a row. Aborting!", failures)
+			}
+		case <-timeoutChan:
+			release()
 			return errors.New("Daemon timed out. Aborting!")
 		}
 
-		<-afterChan
+		interval = schedule.wait(t, failures)
+		schedule.expect(interval)
+		wake, earliestWake := schedule.wake(t, failures)
+		if stoppedBefore(t.Add(interval), stop, wake, earliestWake) {
+			release()
+			logger.Info("Daemon stopped", map[string]string{"Component": component})
+			return nil
+		}
+	}
+}
+
+// stoppedBefore waits until next, or until wake receives and earliestWake
+// has passed, and tells whether stop was closed first.  A stop that came
+// during a run wins over a next run that is already due.
+func stoppedBefore(next time.Time, stop <-chan struct{}, wake <-chan struct{}, earliestWake time.Time) bool {
+	select {
+	case <-stop:
+		return true
+	default:
 	}
 
-	return nil
+	select {
+	case <-time.After(next.Sub(time.Now())):
+		return false
+	case <-stop:
+		return true
+	case <-wake:
+	}
+
+	if !earliestWake.After(next) {
+		next = earliestWake
+	}
+	select {
+	case <-time.After(next.Sub(time.Now())):
+		return false
+	case <-stop:
+		return true
+	}
+}
+
+func runRecovering(component string, callback func() error, onPanic func(), logger logger.Logger) (err error) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+
+		err = fmt.Errorf("panic: %v", recovered)
+		logger.Error("Daemon panicked", err, map[string]string{
+			"Component": component,
+			"Stack":     string(debug.Stack()),
+		})
+		if onPanic != nil {
+			onPanic()
+		}
+	}()
+
+	return callback()
 }
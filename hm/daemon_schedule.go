@@ -0,0 +1,71 @@
+package hm
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
+	"github.com/cloudfoundry/hm9000/helpers/watchdog"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+// daemonSchedule polls the component with the given period and timeout, or
+// on its cron schedule if it has one (fetcher_schedule, ...), and takes
+// jitter and failure handling from the config.  Every setting is read at
+// each run, so reloading the config changes them.  ready is called after
+// every successful run.
+func daemonSchedule(l logger.Logger, conf *config.Config, component string, store store.Store, period func() time.Duration, timeout func() time.Duration, ready func()) Schedule {
+	accountant := newMetricsAccountant(conf, store)
+
+	return Schedule{
+		Period: period,
+		Next: func(started time.Time) time.Time {
+			schedule := conf.CronSchedule(strings.ToLower(component))
+			if schedule == nil {
+				return time.Time{}
+			}
+			return schedule.Next(started)
+		},
+		Timeout:               timeout,
+		Jitter:                conf.DaemonJitter,
+		MaximumFailureBackoff: conf.DaemonMaximumFailureBackoff,
+		MaxConsecutiveFailures: func() int {
+			return conf.DaemonMaxConsecutiveFailures
+		},
+		OnPanic: func() {
+			err := accountant.IncrementDaemonPanics(component)
+			if err != nil {
+				l.Error("Failed to track daemon panic", err)
+			}
+		},
+		OnSuccess: ready,
+		Watchdog:  daemonWatchdog(l, conf, component, accountant),
+	}
+}
+
+// daemonWatchdog trips when the component's daemon has not made progress
+// for daemon_watchdog_multiple times its interval.  It counts the trip and,
+// with daemon_watchdog_kills_process set, exits at once, without the
+// shutdown steps (which may be what is wedged), so that monit restarts the
+// process.
+func daemonWatchdog(l logger.Logger, conf *config.Config, component string, accountant metricsaccountant.MetricsAccountant) *watchdog.Watchdog {
+	return watchdog.New(component, func() int {
+		return conf.DaemonWatchdogMultiple
+	}, buildTimeProvider(l), l, func() {
+		err := accountant.IncrementWatchdogTrips(component)
+		if err != nil {
+			l.Error("Failed to track watchdog trip", err)
+		}
+		if conf.DaemonWatchdogKillsProcess {
+			l.Info("Watchdog: killing the process so that it is restarted", map[string]string{
+				"Component": component,
+				"Exit Code": strconv.Itoa(WatchdogExitCode),
+			})
+			os.Exit(WatchdogExitCode)
+		}
+	})
+}
@@ -4,8 +4,12 @@ import (
 	"errors"
 	"time"
 
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/leaderelection"
+	"github.com/cloudfoundry/hm9000/helpers/watchdog"
 	. "github.com/cloudfoundry/hm9000/hm"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
 	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -29,7 +33,7 @@ var _ = Describe("Daemon", func() {
 		callTimes := make(chan float64, 4)
 		i := 0
 		var startTime time.Time
-		err := Daemonize("Daemon Test", func() error {
+		err := Daemonize(nil, "Daemon Test", func() error {
 			if i == 0 {
 				startTime = time.Now()
 			}
@@ -38,7 +42,7 @@ var _ = Describe("Daemon", func() {
 			i += 1
 			time.Sleep(time.Duration(i*10) * time.Millisecond)
 			return nil
-		}, 20*time.Millisecond, 35*time.Millisecond, fakelogger.NewFakeLogger(), adapter)
+		}, schedule(20*time.Millisecond, 35*time.Millisecond), fakelogger.NewFakeLogger(), adapter)
 
 		Ω(err).Should(Equal(errors.New("Daemon timed out. Aborting!")), "..causes a timeout")
 
@@ -52,10 +56,10 @@ var _ = Describe("Daemon", func() {
 
 	It("acquires the lock once", func() {
 		go Daemonize(
+			nil,
 			"ComponentName",
 			func() error { return nil },
-			20*time.Millisecond,
-			35*time.Millisecond,
+			schedule(20*time.Millisecond, 35*time.Millisecond),
 			fakelogger.NewFakeLogger(),
 			adapter,
 		)
@@ -63,6 +67,322 @@ var _ = Describe("Daemon", func() {
 		Eventually(adapter.GetMaintainedNodeName).Should(Equal("/hm/locks/ComponentName"))
 	})
 
+	It("reads the period and timeout afresh for every run", func() {
+		adapter.OnReleaseNodeChannel = func(releaseNodeChannel chan chan bool) {
+			released := <-releaseNodeChannel
+			released <- true
+		}
+
+		adapter.MaintainNodeStatus <- true
+
+		calls := 0
+		periodReads := 0
+		timeoutReads := 0
+		Daemonize(nil, "Daemon Test", func() error {
+			calls++
+			if calls == 3 {
+				time.Sleep(100 * time.Millisecond)
+			}
+			return nil
+		}, Schedule{
+			Period: func() time.Duration {
+				periodReads++
+				return 5 * time.Millisecond
+			},
+			Timeout: func() time.Duration {
+				timeoutReads++
+				return 35 * time.Millisecond
+			},
+		}, fakelogger.NewFakeLogger(), adapter)
+
+		Ω(calls).Should(Equal(3))
+		Ω(periodReads).Should(BeNumerically(">=", 3))
+		Ω(timeoutReads).Should(BeNumerically(">=", 3))
+	})
+
+	Describe("scheduling", func() {
+		var didRelease chan bool
+
+		BeforeEach(func() {
+			didRelease = make(chan bool, 1)
+			adapter.OnReleaseNodeChannel = func(releaseNodeChannel chan chan bool) {
+				released := <-releaseNodeChannel
+				released <- true
+				didRelease <- true
+			}
+
+			adapter.MaintainNodeStatus <- true
+		})
+
+		It("adds up to Jitter to each period", func() {
+			stop := make(chan struct{})
+			callTimes := []time.Time{}
+			err := Daemonize(stop, "Daemon Test", func() error {
+				callTimes = append(callTimes, time.Now())
+				if len(callTimes) == 6 {
+					close(stop)
+				}
+				return nil
+			}, Schedule{
+				Period:  durationFunc(10 * time.Millisecond),
+				Timeout: durationFunc(35 * time.Millisecond),
+				Jitter:  durationFunc(20 * time.Millisecond),
+			}, fakelogger.NewFakeLogger(), adapter)
+
+			Ω(err).ShouldNot(HaveOccurred())
+			for i := 1; i < len(callTimes); i++ {
+				gap := callTimes[i].Sub(callTimes[i-1])
+				Ω(gap).Should(BeNumerically(">=", 10*time.Millisecond))
+				Ω(gap).Should(BeNumerically("<", 40*time.Millisecond))
+			}
+		})
+
+		It("doubles the period after each failure in a row, up to MaximumFailureBackoff, and gives up after MaxConsecutiveFailures", func() {
+			callTimes := make(chan float64, 4)
+			var startTime time.Time
+			err := Daemonize(nil, "Daemon Test", func() error {
+				if startTime.IsZero() {
+					startTime = time.Now()
+				}
+				callTimes <- time.Since(startTime).Seconds()
+				return errors.New("oops")
+			}, Schedule{
+				Period:                 durationFunc(10 * time.Millisecond),
+				Timeout:                durationFunc(35 * time.Millisecond),
+				MaximumFailureBackoff:  durationFunc(40 * time.Millisecond),
+				MaxConsecutiveFailures: func() int { return 4 },
+			}, fakelogger.NewFakeLogger(), adapter)
+
+			Ω(err).Should(Equal(errors.New("Daemon failed 4 times in a row. Aborting!")))
+			Ω(didRelease).Should(Receive())
+
+			Ω(callTimes).Should(HaveLen(4))
+			Ω(<-callTimes).Should(BeNumerically("~", 0.0, 0.01))
+			Ω(<-callTimes).Should(BeNumerically("~", 0.02, 0.01), "the first failure doubles the period")
+			Ω(<-callTimes).Should(BeNumerically("~", 0.06, 0.01), "the second doubles it again, to the maximum")
+			Ω(<-callTimes).Should(BeNumerically("~", 0.10, 0.01), "the third stays at the maximum")
+		})
+
+		It("runs at the times Next gives, without backing off failures, and falls back to Period where it gives none", func() {
+			callTimes := make(chan float64, 4)
+			var startTime time.Time
+			err := Daemonize(nil, "Daemon Test", func() error {
+				if startTime.IsZero() {
+					startTime = time.Now()
+				}
+				callTimes <- time.Since(startTime).Seconds()
+				return errors.New("oops")
+			}, Schedule{
+				Period: durationFunc(10 * time.Millisecond),
+				Next: func(started time.Time) time.Time {
+					if len(callTimes) == 3 {
+						return time.Time{}
+					}
+					return started.Add(30 * time.Millisecond)
+				},
+				Timeout:                durationFunc(35 * time.Millisecond),
+				MaximumFailureBackoff:  durationFunc(40 * time.Millisecond),
+				MaxConsecutiveFailures: func() int { return 4 },
+			}, fakelogger.NewFakeLogger(), adapter)
+
+			Ω(err).Should(Equal(errors.New("Daemon failed 4 times in a row. Aborting!")))
+			Ω(didRelease).Should(Receive())
+
+			Ω(callTimes).Should(HaveLen(4))
+			Ω(<-callTimes).Should(BeNumerically("~", 0.0, 0.01))
+			Ω(<-callTimes).Should(BeNumerically("~", 0.03, 0.01))
+			Ω(<-callTimes).Should(BeNumerically("~", 0.06, 0.01), "the failures are not backed off")
+			Ω(<-callTimes).Should(BeNumerically("~", 0.10, 0.01), "the period, backed off, where Next gives no time")
+		})
+
+		It("only counts failures in a row", func() {
+			stop := make(chan struct{})
+			calls := 0
+			err := Daemonize(stop, "Daemon Test", func() error {
+				calls++
+				if calls == 6 {
+					close(stop)
+				}
+				if calls%2 == 1 {
+					return errors.New("oops")
+				}
+				return nil
+			}, Schedule{
+				Period:                 durationFunc(5 * time.Millisecond),
+				Timeout:                durationFunc(35 * time.Millisecond),
+				MaxConsecutiveFailures: func() int { return 2 },
+			}, fakelogger.NewFakeLogger(), adapter)
+
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(calls).Should(Equal(6))
+		})
+
+		It("recovers from a panic, counts it as a failure and keeps going", func() {
+			stop := make(chan struct{})
+			calls := 0
+			panics := 0
+			err := Daemonize(stop, "Daemon Test", func() error {
+				calls++
+				if calls == 1 {
+					panic("boom")
+				}
+				close(stop)
+				return nil
+			}, Schedule{
+				Period:                durationFunc(5 * time.Millisecond),
+				Timeout:               durationFunc(35 * time.Millisecond),
+				MaximumFailureBackoff: durationFunc(40 * time.Millisecond),
+				OnPanic:               func() { panics++ },
+			}, fakelogger.NewFakeLogger(), adapter)
+
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(calls).Should(Equal(2))
+			Ω(panics).Should(Equal(1))
+		})
+
+		It("calls OnSuccess after each run that succeeds", func() {
+			stop := make(chan struct{})
+			calls := 0
+			successes := 0
+			err := Daemonize(stop, "Daemon Test", func() error {
+				calls++
+				if calls == 3 {
+					close(stop)
+				}
+				if calls == 1 {
+					return errors.New("oops")
+				}
+				return nil
+			}, Schedule{
+				Period:    durationFunc(5 * time.Millisecond),
+				Timeout:   durationFunc(35 * time.Millisecond),
+				OnSuccess: func() { successes++ },
+			}, fakelogger.NewFakeLogger(), adapter)
+
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(calls).Should(Equal(3))
+			Ω(successes).Should(Equal(2))
+		})
+
+		It("starts the next run early when woken, but no sooner than MinimumWakeInterval after the last started", func() {
+			stop := make(chan struct{})
+			wake := make(chan struct{}, 1)
+			callTimes := []time.Time{}
+			err := Daemonize(stop, "Daemon Test", func() error {
+				callTimes = append(callTimes, time.Now())
+				if len(callTimes) == 3 {
+					close(stop)
+				} else {
+					wake <- struct{}{}
+				}
+				return nil
+			}, Schedule{
+				Period:              durationFunc(time.Hour),
+				Timeout:             durationFunc(35 * time.Millisecond),
+				Wake:                wake,
+				MinimumWakeInterval: durationFunc(20 * time.Millisecond),
+			}, fakelogger.NewFakeLogger(), adapter)
+
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(callTimes).Should(HaveLen(3))
+			for i := 1; i < len(callTimes); i++ {
+				gap := callTimes[i].Sub(callTimes[i-1])
+				Ω(gap).Should(BeNumerically(">=", 20*time.Millisecond))
+				Ω(gap).Should(BeNumerically("<", time.Second))
+			}
+		})
+
+		It("is not woken after a failed run, so that failures are still backed off", func() {
+			stop := make(chan struct{})
+			wake := make(chan struct{}, 1)
+			calls := 0
+			go func() {
+				Daemonize(stop, "Daemon Test", func() error {
+					calls++
+					wake <- struct{}{}
+					return errors.New("oops")
+				}, Schedule{
+					Period:  durationFunc(time.Hour),
+					Timeout: durationFunc(35 * time.Millisecond),
+					Wake:    wake,
+				}, fakelogger.NewFakeLogger(), adapter)
+			}()
+
+			Eventually(func() int { return len(wake) }).Should(Equal(1))
+			Consistently(func() int { return len(wake) }, 50*time.Millisecond).Should(Equal(1))
+			close(stop)
+			Eventually(didRelease).Should(Receive())
+			Ω(calls).Should(Equal(1))
+		})
+
+		It("tells the Watchdog as each run starts, so that a wedged run trips it", func() {
+			timeProvider := faketimeprovider.New(time.Unix(100, 0))
+			timeProvider.ProvideFakeChannels = true
+			trips := make(chan bool, 2)
+			dog := watchdog.New("Daemon Test", func() int { return 2 }, timeProvider, fakelogger.NewFakeLogger(), func() { trips <- true })
+
+			stop := make(chan struct{})
+			checks := []bool{}
+			err := Daemonize(stop, "Daemon Test", func() error {
+				checks = append(checks, dog.Check())
+				timeProvider.IncrementBySeconds(1)
+				checks = append(checks, dog.Check())
+				if len(checks) == 4 {
+					close(stop)
+				}
+				return nil
+			}, Schedule{
+				Period:   durationFunc(5 * time.Millisecond),
+				Timeout:  durationFunc(35 * time.Millisecond),
+				Watchdog: dog,
+			}, fakelogger.NewFakeLogger(), adapter)
+
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(checks).Should(Equal([]bool{false, true, false, true}))
+			Ω(trips).Should(HaveLen(2))
+		})
+
+		It("lets the run in progress finish when stopped, then releases the lock and returns", func() {
+			stop := make(chan struct{})
+			calls := 0
+			finished := false
+			err := Daemonize(stop, "Daemon Test", func() error {
+				calls++
+				close(stop)
+				time.Sleep(10 * time.Millisecond)
+				finished = true
+				return nil
+			}, schedule(5*time.Millisecond, 35*time.Millisecond), fakelogger.NewFakeLogger(), adapter)
+
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(calls).Should(Equal(1))
+			Ω(finished).Should(BeTrue())
+			Ω(didRelease).Should(Receive())
+		})
+	})
+
+	Context("when stopped before the lock is acquired", func() {
+		It("releases the lock and returns without running", func() {
+			didRelease := make(chan bool, 1)
+			adapter.OnReleaseNodeChannel = func(releaseNodeChannel chan chan bool) {
+				released := <-releaseNodeChannel
+				released <- true
+				didRelease <- true
+			}
+
+			stop := make(chan struct{})
+			close(stop)
+
+			err := Daemonize(stop, "Daemon Test", func() error {
+				Fail("NOPE")
+				return nil
+			}, schedule(5*time.Millisecond, 35*time.Millisecond), fakelogger.NewFakeLogger(), adapter)
+
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(didRelease).Should(Receive())
+		})
+	})
+
 	Context("when the locker fails", func() {
 		disaster := errors.New("oh no!")
 
@@ -72,10 +392,10 @@ var _ = Describe("Daemon", func() {
 
 		It("returns the error", func() {
 			err := Daemonize(
+				nil,
 				"Daemon Test",
 				func() error { Fail("NOPE"); return nil },
-				20*time.Millisecond,
-				35*time.Millisecond,
+				schedule(20*time.Millisecond, 35*time.Millisecond),
 				fakelogger.NewFakeLogger(),
 				adapter,
 			)
@@ -97,10 +417,10 @@ var _ = Describe("Daemon", func() {
 			adapter.MaintainNodeStatus <- true
 
 			Daemonize(
+				nil,
 				"Daemon Test",
 				func() error { time.Sleep(1 * time.Second); return nil },
-				20*time.Millisecond,
-				35*time.Millisecond,
+				schedule(20*time.Millisecond, 35*time.Millisecond),
 				fakelogger.NewFakeLogger(),
 				adapter,
 			)
@@ -109,3 +429,81 @@ var _ = Describe("Daemon", func() {
 		})
 	})
 })
+
+var _ = Describe("DaemonizeAsLeader", func() {
+	var (
+		adapter      *fakestoreadapter.FakeStoreAdapter
+		timeProvider *faketimeprovider.FakeTimeProvider
+	)
+
+	BeforeEach(func() {
+		adapter = fakestoreadapter.New()
+		timeProvider = faketimeprovider.New(time.Unix(100, 0))
+		timeProvider.ProvideFakeChannels = true
+	})
+
+	newElection := func(candidate string) *leaderelection.Election {
+		return leaderelection.New(adapter, "/hm/locks/Analyzer", candidate, 10*time.Second, timeProvider, fakelogger.NewFakeLogger(), nil)
+	}
+
+	It("only runs the callback while leading", func() {
+		other := newElection("node-b")
+		other.Campaign()
+
+		calls := make(chan bool, 10)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- DaemonizeAsLeader(nil, "Analyzer", newElection("node-a"), func() error {
+				calls <- true
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			}, schedule(5*time.Millisecond, 35*time.Millisecond), fakelogger.NewFakeLogger())
+		}()
+
+		Consistently(calls, 50*time.Millisecond).ShouldNot(Receive())
+
+		other.Stop()
+		timeProvider.TickerChannelFor(leaderelection.LeaderElectionTimer) <- time.Now()
+
+		Eventually(calls).Should(Receive())
+		Eventually(errs).Should(Receive(Equal(errors.New("Daemon timed out. Aborting!"))))
+	})
+
+	It("runs the callback as the leader and steps down on timeout", func() {
+		calls := 0
+		err := DaemonizeAsLeader(nil, "Analyzer", newElection("node-a"), func() error {
+			calls++
+			if calls == 2 {
+				time.Sleep(100 * time.Millisecond)
+			}
+			return nil
+		}, schedule(5*time.Millisecond, 35*time.Millisecond), fakelogger.NewFakeLogger())
+
+		Ω(err).Should(Equal(errors.New("Daemon timed out. Aborting!")))
+		Ω(calls).Should(Equal(2))
+
+		_, err = adapter.Get("/hm/locks/Analyzer")
+		Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+	})
+
+	It("gives up the lease when stopped", func() {
+		stop := make(chan struct{})
+		err := DaemonizeAsLeader(stop, "Analyzer", newElection("node-a"), func() error {
+			close(stop)
+			return nil
+		}, schedule(5*time.Millisecond, 35*time.Millisecond), fakelogger.NewFakeLogger())
+
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = adapter.Get("/hm/locks/Analyzer")
+		Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+	})
+})
+
+func schedule(period time.Duration, timeout time.Duration) Schedule {
+	return Schedule{Period: durationFunc(period), Timeout: durationFunc(timeout)}
+}
+
+func durationFunc(duration time.Duration) func() time.Duration {
+	return func() time.Duration { return duration }
+}
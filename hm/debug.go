@@ -0,0 +1,36 @@
+package hm
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/debugserver"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+var debugServerOnce sync.Once
+var processDebugServer *debugserver.Server
+
+// startDebugServer starts the process's debug server, if debug_server_address
+// is set, and returns it.  A process has at most one, whichever component
+// asks first; later calls return the same server.  It returns nil if the
+// debug server is turned off or failed to start, which does not stop the
+// component.
+func startDebugServer(l logger.Logger, conf *config.Config) *debugserver.Server {
+	debugServerOnce.Do(func() {
+		if conf.DebugServerAddress == "" {
+			return
+		}
+
+		server := debugserver.New(conf.DebugServerAddress, l)
+		err := server.Start()
+		if err != nil {
+			l.Error("Failed to start the debug server", err, map[string]string{"Address": conf.DebugServerAddress})
+			return
+		}
+
+		onShutdown("stop the debug server", server.Stop)
+		processDebugServer = server
+	})
+	return processDebugServer
+}
@@ -0,0 +1,106 @@
+package hm
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloudfoundry/gunk/workpool"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/doctor"
+	"github.com/cloudfoundry/hm9000/helpers/httpclient"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/helpers/natsconnection"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// Doctor exercises every external dependency in conf: a publish and
+// subscribe round trip on each NATS cluster, a write, read and delete of a
+// key with a TTL in each store, a fetch from the Cloud Controller's bulk API
+// and a fetch of the metrics server's /varz.  It prints a pass or fail for
+// each, with its latency, and exits with 1 if any failed.
+func Doctor(l logger.Logger, conf *config.Config, timeout time.Duration) {
+	shutdownOnSignal(l, conf)
+
+	report := doctor.Run(doctorChecks(l, conf, timeout/2), timeout)
+	if jsonOutput() {
+		printJSON(l, DoctorOutput{Passed: report.Passed(), Report: report})
+		if !report.Passed() {
+			exit(l, 1)
+		}
+		exit(l, 0)
+	}
+
+	fmt.Printf("HM9000 doctor\n\n")
+	table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	failed := 0
+	for _, result := range report.Results {
+		outcome, description := "PASS", result.Detail
+		if !result.Passed {
+			outcome, description = "FAIL", result.Error
+			failed++
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%dms\t%s\n", outcome, result.Name, result.Latency.Nanoseconds()/int64(time.Millisecond), description)
+	}
+	table.Flush()
+
+	if failed > 0 {
+		fmt.Printf("\n%d of %d checks failed\n", failed, len(report.Results))
+		exit(l, 1)
+	}
+	fmt.Printf("\nAll %d checks passed\n", len(report.Results))
+	exit(l, 0)
+}
+
+// DoctorOutput is what doctor prints with JSON output.  Latencies are in
+// nanoseconds.
+type DoctorOutput struct {
+	Passed bool `json:"passed"`
+	doctor.Report
+}
+
+func doctorChecks(l logger.Logger, conf *config.Config, wait time.Duration) []doctor.Check {
+	checks := []doctor.Check{}
+
+	dial, dialErr := natsDialer(conf)
+	clusters := natsClusters(conf)
+	connectTo := func(cluster natsconnection.Cluster) func() (messagebus.MessageBus, error) {
+		return func() (messagebus.MessageBus, error) {
+			if dialErr != nil {
+				return nil, dialErr
+			}
+			return dial(cluster)
+		}
+	}
+	for _, cluster := range clusters {
+		name := "NATS"
+		if len(clusters) > 1 {
+			name = "NATS cluster " + cluster.Name
+		}
+		checks = append(checks, doctor.NATSRoundTrip(name, connectTo(cluster), wait))
+	}
+
+	connectToStore := func(storeType string, urls []string) func() (storeadapter.StoreAdapter, error) {
+		return func() (storeadapter.StoreAdapter, error) {
+			adapter := newStoreAdapter(l, conf, storeType, urls, workpool.DefaultAround)
+			return adapter, adapter.Connect()
+		}
+	}
+	checks = append(checks, doctor.StoreReadWriteTTL("store", connectToStore(conf.StoreType, conf.StoreURLs)))
+	if len(conf.SecondaryStoreURLs) > 0 {
+		checks = append(checks, doctor.StoreReadWriteTTL("secondary store", connectToStore(conf.StoreType, conf.SecondaryStoreURLs)))
+	}
+	if len(conf.StoreMigrationURLs) > 0 {
+		checks = append(checks, doctor.StoreReadWriteTTL("migration target store", connectToStore(conf.StoreMigrationStoreType(), conf.StoreMigrationURLs)))
+	}
+
+	checks = append(checks, doctor.CCBulkFetch(conf, newCCHttpClient(l, conf, nil)))
+
+	if len(clusters) > 0 {
+		checks = append(checks, doctor.MetricsServer(connectTo(clusters[0]), httpclient.NewHttpClient(conf.SkipSSLVerification, wait), wait))
+	}
+
+	return checks
+}
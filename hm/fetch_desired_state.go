@@ -1,60 +1,77 @@
 package hm
 
 import (
-	"os"
 	"strconv"
 
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/desiredstatefetcher"
+	"github.com/cloudfoundry/hm9000/helpers/eventbus"
 	"github.com/cloudfoundry/hm9000/helpers/httpclient"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
-	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
 	"github.com/cloudfoundry/hm9000/store"
 )
 
-func FetchDesiredState(l logger.Logger, conf *config.Config, poll bool) {
+func FetchDesiredState(l logger.Logger, conf *config.Config, configPath string, poll bool) {
+	stop := shutdownOnSignal(l, conf)
 	store := connectToStore(l, conf)
+	requireCC(l, conf)
 
 	if poll {
 		l.Info("Starting Desired State Daemon...")
+		holdPIDFile(l, conf)
+		startDebugServer(l, conf)
+		reportStoreAdapterStats(l, conf)
 
 		adapter := connectToStoreAdapter(l, conf, nil)
+		pageCache := desiredstatefetcher.NewPageCache()
 
-		err := Daemonize("Fetcher", func() error {
-			return fetchDesiredState(l, conf, store)
-		}, conf.FetcherPollingInterval(), conf.FetcherTimeout(), l, adapter)
+		err := Daemonize(stop, "Fetcher", reloadConfigOnSIGHUP(l, conf, configPath, pausingRuns(l, store, "Fetcher", recordingRuns(l, conf, store, "Fetcher", func() error {
+			return fetchDesiredState(l, conf, store, pageCache, nil)
+		}))), daemonSchedule(l, conf, "Fetcher", store, conf.FetcherPollingInterval, conf.FetcherTimeout, func() { notifyReady(l) }), l, adapter)
 		if err != nil {
 			l.Error("Desired State Daemon Errored", err)
+			exit(l, 1)
 		}
 		l.Info("Desired State Daemon is Down")
-		os.Exit(1)
+		exit(l, CleanShutdownExitCode)
 	} else {
-		err := fetchDesiredState(l, conf, store)
+		err := fetchDesiredState(l, conf, store, desiredstatefetcher.NewPageCache(), nil)
 		if err != nil {
-			os.Exit(1)
+			exit(l, 1)
 		} else {
-			os.Exit(0)
+			exit(l, 0)
 		}
 	}
 }
 
-func fetchDesiredState(l logger.Logger, conf *config.Config, store store.Store) error {
+// fetchDesiredState fetches and syncs the desired state once, and publishes
+// DesiredStateSynced to events if it succeeds.
+func fetchDesiredState(l logger.Logger, conf *config.Config, store store.Store, pageCache *desiredstatefetcher.PageCache, events *eventbus.EventBus) error {
 	l.Info("Fetching Desired State")
+	accountant := newMetricsAccountant(conf, store)
+	requestStats := httpclient.NewStatsCollector()
 	fetcher := desiredstatefetcher.New(conf,
 		store,
-		metricsaccountant.New(store),
-		httpclient.NewHttpClient(conf.SkipSSLVerification, conf.FetcherNetworkTimeout()),
+		accountant,
+		newCCHttpClient(l, conf, requestStats.Observe),
 		buildTimeProvider(l),
 		l,
 	)
+	fetcher.UsePageCache(pageCache)
 
 	resultChan := make(chan desiredstatefetcher.DesiredStateFetcherResult, 1)
 	fetcher.Fetch(resultChan)
 
 	result := <-resultChan
 
+	err := accountant.TrackCCRequestStats(requestStats.CollectStats())
+	if err != nil {
+		l.Error("Failed to track CC request stats", err)
+	}
+
 	if result.Success {
 		l.Info("Success", map[string]string{"Number of Desired Apps Fetched": strconv.Itoa(result.NumResults)})
+		events.Publish(eventbus.DesiredStateSynced)
 		return nil
 	} else {
 		l.Error(result.Message, result.Error)
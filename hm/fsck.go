@@ -0,0 +1,62 @@
+package hm
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/fsck"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+func Fsck(l logger.Logger, conf *config.Config, repair bool) {
+	shutdownOnSignal(l, conf)
+	checker := fsck.New(connectToStoreAdapter(l, conf, nil), conf, l)
+
+	report, err := checker.Check()
+	if err != nil {
+		fail(l, "Failed to check the store", err)
+	}
+
+	output := FsckOutput{Report: report}
+	if !jsonOutput() {
+		printFsckReport(report)
+	}
+
+	if !report.IsClean() && repair {
+		err = checker.Repair(report)
+		if err != nil {
+			fail(l, "Failed to repair the store", err)
+		}
+		output.Repaired = len(report.RepairableKeys())
+		if !jsonOutput() {
+			fmt.Printf("Repaired %d of %d problems\n", output.Repaired, len(report.Problems))
+		}
+	}
+
+	if jsonOutput() {
+		printJSON(l, output)
+	}
+
+	if output.Repaired < len(report.Problems) {
+		exit(l, 1)
+	}
+	exit(l, 0)
+}
+
+// FsckOutput is what fsck prints with JSON output.  Repaired is the number
+// of problems repaired, which is 0 without --repair.
+type FsckOutput struct {
+	fsck.Report
+	Repaired int `json:"repaired"`
+}
+
+func printFsckReport(report fsck.Report) {
+	fmt.Printf("Checked %d keys, found %d problems\n", report.KeysChecked, len(report.Problems))
+	for _, problem := range report.Problems {
+		repairable := ""
+		if problem.Repairable {
+			repairable = " (repairable)"
+		}
+		fmt.Printf("  [%s] %s: %s%s\n", problem.Kind, problem.Key, problem.Description, repairable)
+	}
+}
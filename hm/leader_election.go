@@ -0,0 +1,22 @@
+package hm
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/leaderelection"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// newLeaderElection campaigns on the component's lock, so that leaders
+// exclude processes that still take the lock with Daemonize and vice versa.
+func newLeaderElection(l logger.Logger, conf *config.Config, component string, adapter storeadapter.StoreAdapter) *leaderelection.Election {
+	accountant := newMetricsAccountant(conf, store.NewStore(conf, adapter, l))
+
+	return leaderelection.New(adapter, leaderelection.LockKey(component), conf.InstanceName(), conf.LeaderElectionTTL(), buildTimeProvider(l), l, func() {
+		err := accountant.IncrementLeaderElections(component)
+		if err != nil {
+			l.Error("Failed to track leader election", err)
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package hm
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+// ChangeLogLevelsOnSignal turns every component in the process up to DEBUG
+// on SIGUSR1 and back to its configured level on SIGUSR2.
+func ChangeLogLevelsOnSignal(l logger.Logger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for received := range signals {
+			if received == syscall.SIGUSR1 {
+				logger.SetLevel("", "debug")
+			} else {
+				logger.ResetLevels()
+			}
+			l.Info("Changed log levels", map[string]string{"Signal": received.String()}, logger.Levels())
+		}
+	}()
+}
@@ -0,0 +1,28 @@
+package hm
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+// SampleLogs samples l's repeated lines if log_sampling_burst is set (see
+// logger.SampledLogger).  The dropped lines are reported every
+// log_sampling_interval_in_seconds, and when the process shuts down.
+func SampleLogs(l logger.Logger, conf *config.Config) logger.Logger {
+	if conf.LogSamplingBurst <= 0 {
+		return l
+	}
+
+	sampled := logger.NewSampledLogger(l, conf.LogSamplingBurst, conf.LogSamplingInterval(), timeprovider.NewTimeProvider())
+	go func() {
+		for _ = range time.Tick(conf.LogSamplingInterval()) {
+			sampled.Flush()
+		}
+	}()
+	onShutdown("report the dropped log lines", sampled.Flush)
+
+	return sampled
+}
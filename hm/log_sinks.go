@@ -0,0 +1,98 @@
+package hm
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cloudfoundry/gosteno"
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+// defaultLogSinks are where the logs go without log_sinks, as they always
+// have.
+var defaultLogSinks = []config.LogSink{{Type: "stdout"}, {Type: "syslog"}}
+
+// logSinks are the sinks made so far, by their settings.  Components in one
+// process that configure the same sink share it, so that two of them
+// writing to one file do not rotate it out from under each other.
+var logSinks = map[string]gosteno.Sink{}
+var logSinksLock = &sync.Mutex{}
+
+// LogSinks are the sinks in component's log_sinks.  stdout is LogOutput, so
+// it is stderr when a command prints JSON.
+func LogSinks(component string, conf *config.Config) ([]gosteno.Sink, error) {
+	settings := conf.LogSinks
+	if len(settings) == 0 {
+		settings = defaultLogSinks
+	}
+
+	sinks := []gosteno.Sink{}
+	for _, setting := range settings {
+		sink, err := logSink(component, setting)
+		if err != nil {
+			return nil, fmt.Errorf("%s log sink: %s", setting.Type, err.Error())
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func logSink(component string, setting config.LogSink) (gosteno.Sink, error) {
+	key := fmt.Sprintf("%#v", setting)
+	if setting.Type == "syslog" {
+		// syslog lines are tagged with the component
+		key += component
+	}
+
+	logSinksLock.Lock()
+	defer logSinksLock.Unlock()
+
+	if sink, ok := logSinks[key]; ok {
+		return sink, nil
+	}
+
+	var sink gosteno.Sink
+	switch setting.Type {
+	case "stdout":
+		sink = gosteno.NewIOSink(LogOutput())
+	case "syslog":
+		if setting.Address == "" {
+			localSink, err := localSyslogSink("vcap.hm9000." + component)
+			if err != nil {
+				return nil, err
+			}
+			sink = localSink
+		} else {
+			network := setting.Network
+			if network == "" {
+				network = "udp"
+			}
+			sink = logger.NewSyslogSink(network, setting.Address, "vcap.hm9000."+component)
+		}
+	case "file":
+		fileSink, err := logger.NewRotatingFileSink(setting.Path, int64(setting.MaxSizeInMegabytes)*1024*1024, setting.MaxAgeInSeconds.Duration, setting.MaxBackups, timeprovider.NewTimeProvider())
+		if err != nil {
+			return nil, err
+		}
+		sink = fileSink
+	default:
+		return nil, fmt.Errorf("unknown log sink type %q", setting.Type)
+	}
+
+	sink.SetCodec(gosteno.NewJsonCodec())
+	logSinks[key] = sink
+	return sink, nil
+}
+
+// localSyslogSink is gosteno's syslog sink, which panics if there is no
+// local syslog to connect to.
+func localSyslogSink(namespace string) (sink gosteno.Sink, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return gosteno.NewSyslogSink(namespace), nil
+}
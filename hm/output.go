@@ -0,0 +1,80 @@
+package hm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+// The formats of what the reporting commands print on stdout: text for
+// people, or one JSON document for scripts.  With JSON output the logs go to
+// stderr, so that stdout holds nothing else.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+var outputFormat = OutputText
+
+// SetOutput chooses the output format of the commands.
+func SetOutput(format string) error {
+	switch format {
+	case "", OutputText:
+		outputFormat = OutputText
+	case OutputJSON:
+		outputFormat = OutputJSON
+	default:
+		return fmt.Errorf("Unknown output %q: use text or json", format)
+	}
+	return nil
+}
+
+func jsonOutput() bool {
+	return outputFormat == OutputJSON
+}
+
+// LogOutput is where the logs of the commands go.
+func LogOutput() *os.File {
+	if jsonOutput() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printJSON prints value as an indented JSON document.
+func printJSON(l logger.Logger, value interface{}) {
+	output, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		l.Error("Failed to encode the output as JSON", err)
+		exit(l, 1)
+	}
+	fmt.Println(string(output))
+}
+
+// CommandError is what a command prints, with JSON output, when it fails.
+type CommandError struct {
+	Error string `json:"error"`
+}
+
+// fail logs err and exits with 1.  With JSON output it also prints err as a
+// CommandError, so that stdout is never empty.
+func fail(l logger.Logger, message string, err error, details ...map[string]string) {
+	l.Error(message, err, details...)
+	if jsonOutput() {
+		printJSON(l, CommandError{Error: fmt.Sprintf("%s: %s", message, err.Error())})
+	}
+	exit(l, 1)
+}
+
+// failUsage prints message, about how the command was called, and exits
+// with 1.
+func failUsage(l logger.Logger, message string) {
+	if jsonOutput() {
+		printJSON(l, CommandError{Error: message})
+	} else {
+		fmt.Println(message)
+	}
+	exit(l, 1)
+}
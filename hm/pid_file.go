@@ -0,0 +1,33 @@
+package hm
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/pidfile"
+)
+
+// holdPIDFile creates the PID file at pid_file, if it is set, and removes
+// it when the process shuts down.  It exits the process if another process
+// holds the PID file: that is a second copy of this component on this box.
+func holdPIDFile(l logger.Logger, conf *config.Config) {
+	if conf.PIDFile == "" {
+		return
+	}
+
+	pidFile, err := pidfile.Create(conf.PIDFile)
+	if err != nil {
+		l.Error("Refusing to start: failed to take the PID file", err, map[string]string{"PID File": conf.PIDFile})
+		os.Exit(1)
+	}
+	if pidFile.StalePID != 0 {
+		l.Info("Replaced a stale PID file", map[string]string{
+			"PID File":  conf.PIDFile,
+			"Stale PID": strconv.Itoa(pidFile.StalePID),
+		})
+	}
+
+	onShutdown("remove the PID file", func() { pidFile.Remove() })
+}
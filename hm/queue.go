@@ -0,0 +1,153 @@
+package hm
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+// QueueStart enqueues a start message for an index of an app, with the
+// OPERATOR reason, for the sender to send.  Unless skipVerification is set
+// the sender still checks that the index is desired and not running.
+// Nothing is enqueued without confirm.
+func QueueStart(l logger.Logger, conf *config.Config, appGuid string, appVersion string, index int, delay int, skipVerification bool, note string, confirm bool) {
+	shutdownOnSignal(l, conf)
+	store := connectToStore(l, conf)
+	timeProvider := buildTimeProvider(l)
+
+	app := findAppToQueueFor(l, store, appGuid, appVersion)
+	if index < 0 {
+		failUsage(l, "--index must not be negative")
+	}
+
+	message := models.NewPendingStartMessage(timeProvider.Time(), delay, conf.GracePeriod(), app.AppGuid, app.AppVersion, index, 1.0, models.PendingStartMessageReasonOperator)
+	message.SkipVerification = skipVerification
+	message.Origin = models.OriginOperator
+
+	output := QueueStartOutput{Start: message}
+	if !jsonOutput() {
+		fmt.Printf("Start index %d of app %s (version %s) in %ds", index, app.AppGuid, app.AppVersion, delay)
+		if skipVerification {
+			fmt.Printf(", without verification")
+		}
+		fmt.Printf("\n")
+	}
+	if !confirm {
+		output.NotEnqueuedBecause = notConfirmed
+		printQueueOutcome(l, output, output.NotEnqueuedBecause)
+		exit(l, 1)
+	}
+
+	deduplicated, err := store.EnqueuePendingStartMessages(message)
+	if err != nil {
+		fail(l, "Failed to enqueue start message", err, message.LogDescription())
+	}
+	if len(deduplicated) > 0 {
+		output.NotEnqueuedBecause = alreadyPending
+		printQueueOutcome(l, output, output.NotEnqueuedBecause)
+		exit(l, 1)
+	}
+
+	l.Info("Audit: operator enqueued start message", message.LogDescription(), auditDetails(note))
+	output.Enqueued = true
+	printQueueOutcome(l, output, "Enqueued start message "+message.MessageId)
+	exit(l, 0)
+}
+
+// QueueStop enqueues a stop message for an instance of an app, with the
+// OPERATOR reason.  The sender sends it as long as the instance is still
+// heartbeating, even if it is the only instance at a desired index, in which
+// case the analyzer will start a new instance in its place.  Nothing is
+// enqueued without confirm.
+func QueueStop(l logger.Logger, conf *config.Config, appGuid string, appVersion string, instanceGuid string, delay int, note string, confirm bool) {
+	shutdownOnSignal(l, conf)
+	store := connectToStore(l, conf)
+	timeProvider := buildTimeProvider(l)
+
+	app := findAppToQueueFor(l, store, appGuid, appVersion)
+	instance := app.InstanceWithGuid(instanceGuid)
+	if instanceGuid == "" || instance.InstanceGuid == "" {
+		failUsage(l, fmt.Sprintf("Instance %q of app %s (version %s) is not heartbeating", instanceGuid, app.AppGuid, app.AppVersion))
+	}
+
+	message := models.NewPendingStopMessage(timeProvider.Time(), delay, conf.GracePeriod(), app.AppGuid, app.AppVersion, instanceGuid, models.PendingStopMessageReasonOperator)
+	message.Origin = models.OriginOperator
+
+	output := QueueStopOutput{Stop: message}
+	if !jsonOutput() {
+		fmt.Printf("Stop instance %s (index %d, %s on %s) of app %s (version %s) in %ds\n", instanceGuid, instance.InstanceIndex, instance.State, instance.DeaGuid, app.AppGuid, app.AppVersion, delay)
+	}
+	if !confirm {
+		output.NotEnqueuedBecause = notConfirmed
+		printQueueOutcome(l, output, output.NotEnqueuedBecause)
+		exit(l, 1)
+	}
+
+	deduplicated, err := store.EnqueuePendingStopMessages(message)
+	if err != nil {
+		fail(l, "Failed to enqueue stop message", err, message.LogDescription())
+	}
+	if len(deduplicated) > 0 {
+		output.NotEnqueuedBecause = alreadyPending
+		printQueueOutcome(l, output, output.NotEnqueuedBecause)
+		exit(l, 1)
+	}
+
+	l.Info("Audit: operator enqueued stop message", message.LogDescription(), auditDetails(note))
+	output.Enqueued = true
+	printQueueOutcome(l, output, "Enqueued stop message "+message.MessageId)
+	exit(l, 0)
+}
+
+const (
+	notConfirmed   = "Not enqueued: pass --confirm to enqueue it"
+	alreadyPending = "Not enqueued: an equivalent message is already pending"
+)
+
+// QueueStartOutput is what queue_start prints with JSON output.
+type QueueStartOutput struct {
+	Start              models.PendingStartMessage `json:"start"`
+	Enqueued           bool                       `json:"enqueued"`
+	NotEnqueuedBecause string                     `json:"not_enqueued_because,omitempty"`
+}
+
+// QueueStopOutput is what queue_stop prints with JSON output.
+type QueueStopOutput struct {
+	Stop               models.PendingStopMessage `json:"stop"`
+	Enqueued           bool                      `json:"enqueued"`
+	NotEnqueuedBecause string                    `json:"not_enqueued_because,omitempty"`
+}
+
+func printQueueOutcome(l logger.Logger, output interface{}, outcome string) {
+	if jsonOutput() {
+		printJSON(l, output)
+	} else {
+		fmt.Println(outcome)
+	}
+}
+
+func findAppToQueueFor(l logger.Logger, store store.Store, appGuid string, appVersion string) *models.App {
+	if appGuid == "" || appVersion == "" {
+		failUsage(l, "--guid and --version are required")
+	}
+
+	app, err := store.GetApp(appGuid, appVersion)
+	if err != nil {
+		failUsage(l, fmt.Sprintf("Failed to find app %s (version %s): %s", appGuid, appVersion, err.Error()))
+	}
+
+	return app
+}
+
+func auditDetails(note string) map[string]string {
+	return map[string]string{
+		"Operator": os.Getenv("USER"),
+		"Pid":      strconv.Itoa(os.Getpid()),
+		"Note":     note,
+	}
+}
@@ -0,0 +1,79 @@
+package hm
+
+import (
+	"os"
+	"sync"
+
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/readiness"
+)
+
+var readyFile string
+var readyOnce sync.Once
+
+// SetReadyFile has the long-running commands write a file at path once they
+// are ready, and removes any ready file an earlier process left behind.
+func SetReadyFile(path string) error {
+	readyFile = path
+	return readiness.Clear(path)
+}
+
+// notifyReady tells the init system that the process is ready: it has
+// connected to NATS and the store and its component has finished its first
+// cycle.  It sends READY=1 to NOTIFY_SOCKET, if set, and writes the ready
+// file, if one was given.  Only the first call does anything.  Shutting down
+// sends STOPPING=1 and removes the ready file.
+func notifyReady(l logger.Logger) {
+	readyOnce.Do(func() {
+		notifier := readiness.New(os.Getenv("NOTIFY_SOCKET"), readyFile)
+		err := notifier.Ready()
+		if err != nil {
+			l.Error("Failed to signal readiness", err)
+		} else {
+			l.Info("Ready")
+		}
+
+		onShutdown("withdraw readiness", func() { notifier.Stopping() })
+	})
+}
+
+// readyGroup signals the process ready once every one of its members has
+// reported ready.
+type readyGroup struct {
+	l       logger.Logger
+	pending map[string]bool
+	lock    *sync.Mutex
+}
+
+func newReadyGroup(l logger.Logger, members []string) *readyGroup {
+	pending := map[string]bool{}
+	for _, member := range members {
+		pending[member] = true
+	}
+	return &readyGroup{
+		l:       l,
+		pending: pending,
+		lock:    &sync.Mutex{},
+	}
+}
+
+// readyFunc reports member ready when called.
+func (group *readyGroup) readyFunc(member string) func() {
+	return func() { group.ready(member) }
+}
+
+func (group *readyGroup) ready(member string) {
+	group.lock.Lock()
+	if !group.pending[member] {
+		group.lock.Unlock()
+		return
+	}
+	delete(group.pending, member)
+	remaining := len(group.pending)
+	group.lock.Unlock()
+
+	group.l.Info("Component is ready", map[string]string{"Component": member})
+	if remaining == 0 {
+		notifyReady(group.l)
+	}
+}
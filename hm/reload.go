@@ -0,0 +1,59 @@
+package hm
+
+import (
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+// reloadConfigOnSIGHUP wraps a daemon's callback so that, after the process
+// receives a SIGHUP, the next run starts by re-reading the config file.
+// Reloading between runs means a run never sees the config change under it.
+func reloadConfigOnSIGHUP(l logger.Logger, conf *config.Config, configPath string, callback func() error) func() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	return func() error {
+		select {
+		case <-signals:
+			reloadConfig(l, conf, configPath)
+		default:
+		}
+		return callback()
+	}
+}
+
+func reloadConfig(l logger.Logger, conf *config.Config, configPath string) {
+	l.Info("Reloading config", map[string]string{"Path": configPath})
+
+	applied, ignored, err := conf.Reload(configPath)
+	if err != nil {
+		l.Error("Failed to reload config, keeping the current config", err)
+		return
+	}
+
+	for _, change := range applied {
+		l.Info("Applied config change", map[string]string{
+			"Setting":   change.Setting,
+			"Old Value": change.OldValue,
+			"New Value": change.NewValue,
+		})
+	}
+
+	for _, change := range ignored {
+		l.Info("Ignoring config change that requires a restart", map[string]string{
+			"Setting":   change.Setting,
+			"Old Value": change.OldValue,
+			"New Value": change.NewValue,
+		})
+	}
+
+	l.Info("Reloaded config", map[string]string{
+		"Applied Changes": strconv.Itoa(len(applied)),
+		"Ignored Changes": strconv.Itoa(len(ignored)),
+	})
+}
@@ -0,0 +1,104 @@
+package hm
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/replay"
+)
+
+// Replay publishes the capture at capturePath, speedFlag times faster than
+// it was captured, to a listener and an evacuator that save what they hear
+// in the store the config names.  They are connected to a NATS server of
+// their own, in this process, so that nothing replayed reaches the DEAs or
+// anything else on the real NATS.  Run the analyzer against the same store
+// to see what it makes of the replayed state.
+func Replay(l logger.Logger, conf *config.Config, capturePath string, speedFlag string) {
+	stop := shutdownOnSignal(l, conf)
+
+	speed, err := strconv.ParseFloat(speedFlag, 64)
+	if err != nil || speed < 0 {
+		failUsage(l, "--speed must be a non-negative number")
+	}
+
+	capture, err := os.Open(capturePath)
+	if err != nil {
+		fail(l, "Failed to open the capture", err)
+	}
+	defer capture.Close()
+
+	server := startReplayNATS(l)
+	store, usageTracker := connectToStoreAndTrack(l, conf)
+
+	listenerBus := connectToReplayNATS(l, server)
+	listener := startListener(l, conf, listenerBus, store, usageTracker, nil)
+	evacuator := startEvacuator(l, conf, listenerBus, store, nil)
+
+	publisherBus := connectToReplayNATS(l, server)
+	l.Info("Replaying the capture", map[string]string{
+		"Capture": capturePath,
+		"Speed":   fmt.Sprintf("%g", speed),
+	})
+	stats, err := replay.New(publisherBus, buildTimeProvider(l), speed, l).Replay(replay.NewReader(capture), stop)
+
+	publisherBus.Ping()
+	listenerBus.Ping()
+	evacuator.Stop()
+	listener.Stop()
+
+	if err != nil {
+		fail(l, "Failed to replay the capture", err)
+	}
+
+	if jsonOutput() {
+		printJSON(l, stats)
+	} else {
+		printReplayStats(stats)
+	}
+	exit(l, 0)
+}
+
+// startReplayNATS starts an embedded NATS server on a free local port.
+func startReplayNATS(l logger.Logger) *messagebus.EmbeddedServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fail(l, "Failed to find a port for the replay NATS server", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	server, err := messagebus.StartEmbeddedServer("127.0.0.1", port)
+	if err != nil {
+		fail(l, "Failed to start the replay NATS server", err)
+	}
+	onShutdown("stop the replay NATS server", server.Shutdown)
+	return server
+}
+
+func connectToReplayNATS(l logger.Logger, server *messagebus.EmbeddedServer) messagebus.MessageBus {
+	bus, err := server.Connect()
+	if err != nil {
+		fail(l, "Failed to connect to the replay NATS server", err)
+	}
+	onShutdown("close a replay NATS connection", func() { closeMessageBus(bus) })
+	return messagebus.NewCategorizedBus(bus)
+}
+
+func printReplayStats(stats replay.Stats) {
+	fmt.Printf("Replayed %d messages in %s (at worst %s behind the capture's pace)\n", stats.Messages, stats.Duration, stats.Lag)
+
+	subjects := []string{}
+	for subject := range stats.BySubject {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	for _, subject := range subjects {
+		fmt.Printf("  %s: %d\n", subject, stats.BySubject[subject])
+	}
+}
@@ -0,0 +1,66 @@
+package hm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/hm9000/apiserver/handlers"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+// ResetCrashCounts forgets the crash counts, and so the restart backoff, of
+// the listed indices of an app (a comma-separated list, or every index if
+// empty), and brings forward the starts that the backoff had delayed.
+func ResetCrashCounts(l logger.Logger, conf *config.Config, appGuid string, appVersion string, indexList string, note string) {
+	shutdownOnSignal(l, conf)
+
+	if appGuid == "" || appVersion == "" {
+		failUsage(l, "--guid and --version are required")
+	}
+
+	indices := []int{}
+	for _, value := range strings.Split(indexList, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		index, err := strconv.Atoi(value)
+		if err != nil || index < 0 {
+			failUsage(l, fmt.Sprintf("Invalid index %q: --indices must be a comma-separated list of non-negative integers", value))
+		}
+		indices = append(indices, index)
+	}
+
+	store := connectToStore(l, conf)
+	reset, rescheduled, err := store.ResetCrashCounts(appGuid, appVersion, indices, buildTimeProvider(l).Time())
+	if err != nil {
+		fail(l, "Failed to reset crash counts", err)
+	}
+
+	details := auditDetails(note)
+	details["AppGuid"] = appGuid
+	details["AppVersion"] = appVersion
+	details["Indices"] = indexList
+	details["Reset"] = strconv.Itoa(len(reset))
+	details["Rescheduled"] = strconv.Itoa(len(rescheduled))
+	l.Info("Audit: crash counts reset", details)
+
+	if jsonOutput() {
+		// The same as the API returns for DELETE /crash_counts
+		printJSON(l, handlers.ResetCrashCountsResponse{Reset: reset, Rescheduled: rescheduled})
+		exit(l, 0)
+	}
+
+	if len(reset) == 0 {
+		fmt.Printf("No crash counts to reset for app %s (version %s)\n", appGuid, appVersion)
+	}
+	for _, crashCount := range reset {
+		fmt.Printf("Reset index %d: had crashed %d times\n", crashCount.InstanceIndex, crashCount.CrashCount)
+	}
+	for _, start := range rescheduled {
+		fmt.Printf("Start for index %d will now be sent straight away\n", start.IndexToStart)
+	}
+	exit(l, 0)
+}
@@ -0,0 +1,31 @@
+package hm
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/encryption"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+func RotateEncryptionKey(l logger.Logger, conf *config.Config) {
+	shutdownOnSignal(l, conf)
+	adapter, ok := connectToStoreAdapter(l, conf, nil).(*encryption.EncryptingStoreAdapter)
+	if !ok {
+		l.Error("Failed to rotate encryption key", errors.New("store encryption is not configured"))
+		exit(l, 1)
+	}
+
+	rotated, err := adapter.Rotate()
+	if err != nil {
+		l.Error("Failed to rotate encryption key", err, map[string]string{"Rotated": strconv.Itoa(rotated)})
+		exit(l, 1)
+	}
+
+	l.Info("Rotated encryption key", map[string]string{
+		"Active Key": conf.StoreEncryptionActiveKeyLabel,
+		"Rotated":    strconv.Itoa(rotated),
+	})
+	exit(l, 0)
+}
@@ -3,45 +3,49 @@ package hm
 import (
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
-	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/helpers/webhooks"
 	"github.com/cloudfoundry/hm9000/sender"
 	"github.com/cloudfoundry/hm9000/store"
-	"github.com/cloudfoundry/yagnats"
-
-	"os"
 )
 
-func Send(l logger.Logger, conf *config.Config, poll bool) {
+func Send(l logger.Logger, conf *config.Config, configPath string, poll bool) {
+	stop := shutdownOnSignal(l, conf)
 	messageBus := connectToMessageBus(l, conf)
 	store := connectToStore(l, conf)
+	notifier := buildNotifier(l, conf)
 
 	if poll {
 		l.Info("Starting Sender Daemon...")
+		holdPIDFile(l, conf)
+		startDebugServer(l, conf)
+		reportStoreAdapterStats(l, conf)
 
 		adapter := connectToStoreAdapter(l, conf, nil)
 
-		err := Daemonize("Sender", func() error {
-			return send(l, conf, messageBus, store)
-		}, conf.SenderPollingInterval(), conf.SenderTimeout(), l, adapter)
+		err := DaemonizeAsLeader(stop, "Sender", newLeaderElection(l, conf, "Sender", adapter), reloadConfigOnSIGHUP(l, conf, configPath, pausingRuns(l, store, "Sender", recordingRuns(l, conf, store, "Sender", func() error {
+			return send(l, conf, messageBus, store, notifier)
+		}))), daemonSchedule(l, conf, "Sender", store, conf.SenderPollingInterval, conf.SenderTimeout, func() { notifyReady(l) }), l)
 		if err != nil {
 			l.Error("Sender Daemon Errored", err)
+			exit(l, 1)
 		}
 		l.Info("Sender Daemon is Down")
-		os.Exit(1)
+		exit(l, CleanShutdownExitCode)
 	} else {
-		err := send(l, conf, messageBus, store)
+		err := send(l, conf, messageBus, store, notifier)
 		if err != nil {
-			os.Exit(1)
+			exit(l, 1)
 		} else {
-			os.Exit(0)
+			exit(l, 0)
 		}
 	}
 }
 
-func send(l logger.Logger, conf *config.Config, messageBus yagnats.NATSConn, store store.Store) error {
+func send(l logger.Logger, conf *config.Config, messageBus messagebus.MessageBus, store store.Store, notifier webhooks.Notifier) error {
 	l.Info("Sending...")
 
-	sender := sender.New(store, metricsaccountant.New(store), conf, messageBus, l)
+	sender := sender.New(store, newMetricsAccountant(conf, store), notifier, conf, messageBus, l)
 	err := sender.Send(buildTimeProvider(l))
 
 	if err != nil {
@@ -0,0 +1,227 @@
+package hm
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/analyzer"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/desiredstatefetcher"
+	"github.com/cloudfoundry/hm9000/helpers/countingstoreadapter"
+	"github.com/cloudfoundry/hm9000/helpers/eventbus"
+	"github.com/cloudfoundry/hm9000/helpers/leaderelection"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/grouper"
+	"github.com/tedsuo/ifrit/sigmon"
+)
+
+// ServedComponents are the components hm9000 serve runs, in the order they
+// are started.  They are stopped in the reverse order.
+var ServedComponents = []string{
+	"listener",
+	"fetcher",
+	"analyzer",
+	"sender",
+	"evacuator",
+	"metrics_server",
+	"apiserver",
+}
+
+// Serve runs every long-running component in this process, sharing one
+// store connection and one NATS connection between them.  Each component
+// uses its own config from confs, so sections of "components" still apply.
+// The components take the same locks as when run separately, so several
+// serve processes (or a mix of serve and single components) can run at once.
+//
+// On SIGINT or SIGTERM the components are stopped in reverse order: the API
+// and metrics servers stop serving, the polling daemons finish the run they
+// are in, and the NATS connection is closed last.  With embedded_nats, serve
+// also runs the NATS server the components talk to, and with
+// serve_event_bus the components wake each other as they hand off through
+// the store instead of waiting to poll.
+func Serve(l logger.Logger, conf *config.Config, confs map[string]*config.Config, configPath string) {
+	shutdownOnSignal(l, conf)
+	holdPIDFile(l, conf)
+	debugServer := startDebugServer(l, conf)
+	reportStoreAdapterStats(l, conf)
+	startEmbeddedNATS(l, conf)
+	messageBus := connectToMessageBus(l, conf)
+	tracker := newUsageTracker(conf.StoreMaxConcurrentRequests)
+	debugServer.AddQueue("store_requests_in_flight", tracker.InFlight)
+	adapter := connectToStoreAdapter(l, conf, tracker)
+	requireCC(l, conf)
+
+	var events *eventbus.EventBus
+	if conf.ServeEventBus {
+		events = eventbus.New()
+		l.Info("Handing off between components over the event bus")
+	}
+
+	readiness := newReadyGroup(l, ServedComponents)
+	members := grouper.Members{}
+	for _, component := range ServedComponents {
+		ready := readiness.readyFunc(component)
+		componentConf := confs[component]
+		sinks, err := LogSinks(component, componentConf)
+		if err != nil {
+			l.Error("Failed to set up logging", err, map[string]string{"Component": component})
+			exit(l, 1)
+		}
+		realLogger := logger.NewWithSinks(component, componentConf.LogLevel(), componentConf.LogFormat, sinks)
+		componentLogger := SampleLogs(realLogger, componentConf)
+		componentStore := store.NewStore(componentConf, adapter, componentLogger)
+
+		var runner ifrit.Runner
+		switch component {
+		case "listener":
+			runner = lockedRunner(componentLogger, adapter, "listener", func() func() {
+				return startListener(componentLogger, componentConf, messageBus, componentStore, tracker, events).Stop
+			}, ready)
+		case "fetcher":
+			pageCache := desiredstatefetcher.NewPageCache()
+			runner = pollingRunner("Fetcher", componentLogger, componentConf, configPath, adapter, componentStore, nil, func() error {
+				return fetchDesiredState(componentLogger, componentConf, componentStore, pageCache, events)
+			}, componentConf.FetcherPollingInterval, componentConf.FetcherTimeout, nil, ready)
+		case "analyzer":
+			election := newLeaderElection(componentLogger, componentConf, "Analyzer", adapter)
+			notifier := buildNotifier(componentLogger, componentConf)
+			polling := analyzer.NewAdaptivePolling(componentConf, componentLogger)
+			storeRequests := countingstoreadapter.New(adapter)
+			analyzerStore := store.NewStore(componentConf, storeRequests, componentLogger)
+			runner = pollingRunner("Analyzer", componentLogger, componentConf, configPath, adapter, componentStore, election, func() error {
+				return analyze(componentLogger, componentConf, analyzerStore, storeRequests, notifier, polling, events)
+			}, polling.Interval, componentConf.AnalyzerTimeout, events.Subscribe(eventbus.ActualStateSynced, eventbus.DesiredStateSynced, eventbus.EvacuationMissed), ready)
+		case "sender":
+			election := newLeaderElection(componentLogger, componentConf, "Sender", adapter)
+			notifier := buildNotifier(componentLogger, componentConf)
+			runner = pollingRunner("Sender", componentLogger, componentConf, configPath, adapter, componentStore, election, func() error {
+				return send(componentLogger, componentConf, messageBus, componentStore, notifier)
+			}, componentConf.SenderPollingInterval, componentConf.SenderTimeout, events.Subscribe(eventbus.PendingMessagesEnqueued), ready)
+		case "evacuator":
+			runner = lockedRunner(componentLogger, adapter, "evacuator", func() func() {
+				return startEvacuator(componentLogger, componentConf, messageBus, componentStore, events).Stop
+			}, ready)
+		case "metrics_server":
+			cachingStore := newCachingStore(componentLogger, componentConf, adapter)
+			runner = lockedRunner(componentLogger, adapter, "metrics-server", func() func() {
+				startMetricsServer(realLogger.Steno(), componentLogger, componentConf, cachingStore, messageBus)
+				return func() {}
+			}, ready)
+		case "apiserver":
+			cachingStore := newCachingStore(componentLogger, componentConf, adapter)
+			runner = grouper.NewOrdered(os.Interrupt, apiServerMembers(componentLogger, componentConf, cachingStore, messageBus))
+		}
+
+		members = append(members, grouper.Member{Name: component, Runner: runner})
+	}
+
+	group := grouper.NewOrdered(os.Interrupt, members)
+	monitor := ifrit.Invoke(sigmon.New(group, syscall.SIGINT, syscall.SIGTERM))
+	readiness.ready("apiserver")
+
+	l.Info("Serving all components")
+
+	err := <-monitor.Wait()
+	if err != nil {
+		l.Error("A component exited with an error", err)
+		exit(l, 1)
+	}
+
+	l.Info("Stopped all components")
+	exit(l, CleanShutdownExitCode)
+}
+
+// lockedRunner runs start once the lock is held, and then calls onReady.
+// Waiting for the lock does not hold up the components started after this
+// one.  When signalled it calls the stop function start returned and then
+// releases the lock.
+func lockedRunner(l logger.Logger, adapter storeadapter.StoreAdapter, lockName string, start func() func(), onReady func()) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		stop := make(chan struct{})
+		locked := make(chan func(), 1)
+		errs := make(chan error, 1)
+		go func() {
+			release, err := holdLock(l, adapter, "/hm/locks/"+lockName, stop)
+			if err != nil {
+				errs <- err
+				return
+			}
+			locked <- release
+		}()
+
+		close(ready)
+
+		select {
+		case release := <-locked:
+			if release == nil {
+				return nil
+			}
+			l.Info("Acquired lock for " + lockName)
+			stopComponent := start()
+			onReady()
+			<-signals
+			stopComponent()
+			release()
+			return nil
+		case err := <-errs:
+			l.Error("Failed to talk to lock store", err)
+			return err
+		case <-signals:
+			close(stop)
+			select {
+			case release := <-locked:
+				if release != nil {
+					release()
+				}
+			case <-errs:
+			}
+			return nil
+		}
+	})
+}
+
+// pollingRunner runs callback as a daemon, like the -poll flag of the
+// polling commands: as the leader of election if one is given, otherwise
+// under the component's lock.  When signalled it lets a run in progress
+// finish, starts no more and gives up the lock or the lease.  A receive on
+// wake, which may be nil, starts the next run early.  onReady is called
+// after every successful run.
+func pollingRunner(name string, l logger.Logger, conf *config.Config, configPath string, adapter storeadapter.StoreAdapter, componentStore store.Store, election *leaderelection.Election, callback func() error, period func() time.Duration, timeout func() time.Duration, wake <-chan struct{}, onReady func()) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		run := reloadConfigOnSIGHUP(l, conf, configPath, pausingRuns(l, componentStore, name, recordingRuns(l, conf, componentStore, name, callback)))
+		schedule := daemonSchedule(l, conf, name, componentStore, period, timeout, onReady)
+		schedule.Wake = wake
+		schedule.MinimumWakeInterval = conf.ServeEventBusMinInterval
+
+		stop := make(chan struct{})
+		errs := make(chan error, 1)
+		go func() {
+			if election != nil {
+				errs <- DaemonizeAsLeader(stop, name, election, run, schedule, l)
+			} else {
+				errs <- Daemonize(stop, name, run, schedule, l, adapter)
+			}
+		}()
+
+		close(ready)
+
+		select {
+		case <-signals:
+			close(stop)
+			err := <-errs
+			if err != nil {
+				l.Error(name+" Daemon Errored", err)
+				return err
+			}
+			l.Info(name + " Daemon is Down")
+			return nil
+		case err := <-errs:
+			l.Error(name+" Daemon Errored", err)
+			return err
+		}
+	})
+}
@@ -2,14 +2,21 @@ package hm
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cloudfoundry-incubator/natbeat"
+	"github.com/cloudfoundry/hm9000/admin"
 	"github.com/cloudfoundry/hm9000/apiserver/handlers"
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/helpers/ratelimiter"
+	"github.com/cloudfoundry/hm9000/store"
 
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/grouper"
@@ -18,49 +25,222 @@ import (
 )
 
 func ServeAPI(l logger.Logger, conf *config.Config) {
-	store := connectToStore(l, conf)
+	shutdownOnSignal(l, conf)
+	holdPIDFile(l, conf)
+	startDebugServer(l, conf)
+	reportStoreAdapterStats(l, conf)
+	store := connectToCachingStore(l, conf)
 
-	apiHandler, err := handlers.New(l, store, buildTimeProvider(l))
+	var messageBus messagebus.MessageBus
+	if conf.AdminAPIEnabled() || conf.CellReportsEnabled() {
+		messageBus = connectToMessageBus(l, conf)
+	}
+
+	group := grouper.NewOrdered(os.Interrupt, apiServerMembers(l, conf, store, messageBus))
+
+	monitor := ifrit.Invoke(sigmon.New(group))
+
+	l.Info("started")
+	notifyReady(l)
+
+	err := <-monitor.Wait()
+	if err != nil {
+		l.Error("exited", err)
+		exit(l, 1)
+	}
+
+	l.Info("exited")
+	exit(l, CleanShutdownExitCode)
+}
+
+// apiServerMembers are the HTTP server and its router registration
+// heartbeat, and, when the admin API is enabled, its NATS responder on
+// messageBus.  Cell reports posted to the HTTP server are published on
+// messageBus too.
+func apiServerMembers(l logger.Logger, conf *config.Config, store store.Store, messageBus messagebus.MessageBus) grouper.Members {
+	pendingMessages := handlers.NewPendingMessageScanner(l, store, buildTimeProvider(l))
+	apiHandler, err := handlers.New(l, store, buildTimeProvider(l), conf, pendingMessages)
 	if err != nil {
 		l.Error("initialize-handler.failed", err)
 		panic(err)
 	}
 	handler := handlers.BasicAuthWrap(apiHandler, conf.APIServerUsername, conf.APIServerPassword)
 
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+
+	var controller *admin.Controller
+	if conf.AdminAPIEnabled() {
+		controller = admin.New(store, buildTimeProvider(l), l)
+		adminHandler, err := handlers.NewAdmin(l, controller)
+		if err != nil {
+			l.Error("initialize-admin-handler.failed", err)
+			panic(err)
+		}
+
+		mux.Handle("/admin/", handlers.BasicAuthWrap(adminHandler, conf.APIServerAdminUsername, conf.APIServerAdminPassword))
+		handler = mux
+	}
+
+	if conf.APIServerDashboard {
+		dashboardHandler, err := handlers.NewDashboard(l, store, buildTimeProvider(l), conf)
+		if err != nil {
+			l.Error("initialize-dashboard-handler.failed", err)
+			panic(err)
+		}
+
+		dashboardHandler = handlers.BasicAuthWrap(dashboardHandler, conf.APIServerUsername, conf.APIServerPassword)
+		mux.Handle("/dashboard", dashboardHandler)
+		mux.Handle("/dashboard/", dashboardHandler)
+		handler = mux
+	}
+
+	if conf.CellReportsEnabled() {
+		cellReportsHandler := handlers.NewCellReportsHandler(l, messageBus, conf.CellReportsNATSSubject)
+		mux.Handle("/cell_reports", handlers.BasicAuthWrap(cellReportsHandler, conf.APIServerUsername, conf.APIServerPassword))
+		handler = mux
+	}
+
+	var deadlines *handlers.RequestDeadlines
+	if conf.APIServerRequestTimeout() > 0 {
+		deadlines = handlers.NewRequestDeadlines(conf.APIServerRequestTimeout(), conf.APIServerMaxRequestsInFlight)
+		handler = handlers.DeadlineWrap(handler, deadlines)
+	}
+
+	var limiter *ratelimiter.RateLimiter
+	if conf.APIServerRateLimitEnabled() {
+		trustedProxies, err := conf.APIServerTrustedProxyNetworks()
+		if err != nil {
+			l.Error("Failed to parse the API server's trusted proxies", err)
+			os.Exit(1)
+		}
+		limiter = ratelimiter.New(buildTimeProvider(l), conf.APIServerRateLimitPerSecond, conf.APIServerRateLimitBurstSize(), conf.APIServerRateLimitMaxRequesters)
+		handler = handlers.RateLimitWrap(handler, limiter, trustedProxies)
+	}
+
 	listenAddr := fmt.Sprintf("%s:%d", conf.APIServerAddress, conf.APIServerPort)
+	l.Info(listenAddr)
 
 	members := grouper.Members{
 		{"api", http_server.New(listenAddr, handler)},
+		{"pending_message_scan", heartbeatRunner(conf, func() { pendingMessages.Scan() })},
+	}
+
+	if limiter != nil {
+		members = append(members, grouper.Member{
+			Name:   "api_rate_limit_metrics",
+			Runner: heartbeatRunner(conf, rateLimitMetricsTracker(l, conf, store, limiter)),
+		})
+	}
+
+	if deadlines != nil {
+		members = append(members, grouper.Member{
+			Name:   "api_request_deadline_metrics",
+			Runner: heartbeatRunner(conf, requestDeadlineMetricsTracker(l, conf, store, deadlines)),
+		})
+	}
+
+	if controller != nil {
+		responder := admin.NewNATSResponder(messageBus, conf.AdminNATSSubject, conf.NATSQueueGroup, conf.APIServerAdminUsername, conf.APIServerAdminPassword, controller, l)
+		members = append(members, grouper.Member{
+			Name:   "admin_nats",
+			Runner: natsResponderRunner(l, responder),
+		})
 	}
 
 	natsAddresses := []string{}
 
-	for _, natsAddress := range conf.NATS {
+	// The heartbeat does not fail over: it uses the preferred NATS cluster.
+	natsServers := conf.NATSClusterList()[0].Servers
+	for _, natsAddress := range natsServers {
 		natsAddresses = append(natsAddresses, fmt.Sprintf("%s:%d", natsAddress.Host, natsAddress.Port))
 	}
 
 	registration := initializeServerRegistration(l, conf)
 
-	members = append(members, grouper.Member{
+	return append(members, grouper.Member{
 		Name:   "background_heartbeat",
-		Runner: natbeat.NewBackgroundHeartbeat(strings.Join(natsAddresses, ","), conf.NATS[0].User, conf.NATS[0].Password, &LagerAdapter{l}, registration),
+		Runner: natbeat.NewBackgroundHeartbeat(strings.Join(natsAddresses, ","), natsServers[0].User, natsServers[0].Password, &LagerAdapter{l}, registration),
 	})
+}
 
-	group := grouper.NewOrdered(os.Interrupt, members)
+// natsResponderRunner answers admin requests over NATS until signalled.
+func natsResponderRunner(l logger.Logger, responder *admin.NATSResponder) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		err := responder.Start()
+		if err != nil {
+			l.Error("Failed to subscribe to admin requests", err)
+			return err
+		}
+		close(ready)
 
-	monitor := ifrit.Invoke(sigmon.New(group))
+		<-signals
+		responder.Stop()
+		return nil
+	})
+}
 
-	l.Info("started")
-	l.Info(listenAddr)
+// heartbeatRunner calls f straight away, and then once a heartbeat until
+// signalled.
+func heartbeatRunner(conf *config.Config, f func()) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		ticker := time.NewTicker(conf.HeartbeatPeriod.Duration)
+		defer ticker.Stop()
+		close(ready)
 
-	err = <-monitor.Wait()
-	if err != nil {
-		l.Error("exited", err)
-		os.Exit(1)
+		f()
+		for {
+			select {
+			case <-ticker.C:
+				f()
+			case <-signals:
+				return nil
+			}
+		}
+	})
+}
+
+// rateLimitMetricsTracker tracks the requests limiter has turned away, and
+// logs the requesters it turned away.
+func rateLimitMetricsTracker(l logger.Logger, conf *config.Config, store store.Store, limiter *ratelimiter.RateLimiter) func() {
+	accountant := newMetricsAccountant(conf, store)
+
+	return func() {
+		rejections := limiter.Rejections()
+		for requester, requests := range rejections {
+			l.Info("Rate limited API requests", map[string]string{
+				"Requester": requester,
+				"Requests":  strconv.Itoa(requests),
+			})
+		}
+
+		err := accountant.TrackAPIRateLimiting(rejections)
+		if err != nil {
+			l.Error("Could not track the rate limited API requests", err)
+		}
 	}
+}
 
-	l.Info("exited")
-	os.Exit(0)
+// requestDeadlineMetricsTracker tracks the requests the API server gave up
+// on, and logs how many it did.
+func requestDeadlineMetricsTracker(l logger.Logger, conf *config.Config, store store.Store, deadlines *handlers.RequestDeadlines) func() {
+	accountant := newMetricsAccountant(conf, store)
+
+	return func() {
+		timedOut, abandoned, inFlight := deadlines.Counts()
+		if timedOut > 0 || abandoned > 0 {
+			l.Info("Gave up on API requests", map[string]string{
+				"Timed Out": strconv.Itoa(timedOut),
+				"Abandoned": strconv.Itoa(abandoned),
+				"In Flight": strconv.Itoa(inFlight),
+			})
+		}
+
+		err := accountant.TrackAPIRequestDeadlines(timedOut, abandoned, inFlight)
+		if err != nil {
+			l.Error("Could not track the API requests given up on", err)
+		}
+	}
 }
 
 func initializeServerRegistration(l logger.Logger, conf *config.Config) (registration natbeat.RegistryMessage) {
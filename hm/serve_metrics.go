@@ -4,23 +4,35 @@ import (
 	"github.com/cloudfoundry/gosteno"
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
-	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 	"github.com/cloudfoundry/hm9000/metricsserver"
+	"github.com/cloudfoundry/hm9000/store"
 	collectorregistrar "github.com/cloudfoundry/loggregatorlib/cfcomponent/registrars/legacycollectorregistrar"
 )
 
 func ServeMetrics(steno *gosteno.Logger, l logger.Logger, conf *config.Config) {
-	store := connectToStore(l, conf)
+	stop := shutdownOnSignal(l, conf)
+	holdPIDFile(l, conf)
+	startDebugServer(l, conf)
+	reportStoreAdapterStats(l, conf)
+	store := connectToCachingStore(l, conf)
 	messageBus := connectToMessageBus(l, conf)
 
 	acquireLock(l, conf, "metrics-server")
 
+	startMetricsServer(steno, l, conf, store, messageBus)
+	notifyReady(l)
+	<-stop
+	exit(l, CleanShutdownExitCode)
+}
+
+func startMetricsServer(steno *gosteno.Logger, l logger.Logger, conf *config.Config, store store.Store, messageBus messagebus.MessageBus) {
 	collectorRegistrar := collectorregistrar.NewCollectorRegistrar(messageBus, steno)
 
 	metricsServer := metricsserver.New(
 		collectorRegistrar,
 		steno,
-		metricsaccountant.New(store),
+		newMetricsAccountant(conf, store),
 		l,
 		store,
 		buildTimeProvider(l),
@@ -32,5 +44,4 @@ func ServeMetrics(steno *gosteno.Logger, l logger.Logger, conf *config.Config) {
 		l.Error("Failed to serve metrics", err)
 	}
 	l.Info("Serving Metrics")
-	select {}
 }
@@ -0,0 +1,27 @@
+package hm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry/hm9000/config"
+)
+
+// ShowConfig prints the settings conf holds, defaults and overrides included,
+// as JSON with credentials redacted.
+func ShowConfig(conf *config.Config) {
+	settings, err := conf.Effective()
+	if err != nil {
+		fmt.Printf("Failed to show config: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	output, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		fmt.Printf("Failed to show config: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Println(string(output))
+}
@@ -1,42 +1,45 @@
 package hm
 
 import (
-	"os"
-
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
 	"github.com/cloudfoundry/hm9000/shredder"
 	"github.com/cloudfoundry/hm9000/store"
 )
 
-func Shred(l logger.Logger, conf *config.Config, poll bool) {
+func Shred(l logger.Logger, conf *config.Config, configPath string, poll bool) {
+	stop := shutdownOnSignal(l, conf)
 	store := connectToStore(l, conf)
 
 	if poll {
 		l.Info("Starting Shredder Daemon...")
+		holdPIDFile(l, conf)
+		startDebugServer(l, conf)
+		reportStoreAdapterStats(l, conf)
 
 		adapter := connectToStoreAdapter(l, conf, nil)
 
-		err := Daemonize("Shredder", func() error {
-			return shred(l, store)
-		}, conf.ShredderPollingInterval(), conf.ShredderTimeout(), l, adapter)
+		err := Daemonize(stop, "Shredder", reloadConfigOnSIGHUP(l, conf, configPath, pausingRuns(l, store, "Shredder", recordingRuns(l, conf, store, "Shredder", func() error {
+			return shred(l, conf, store)
+		}))), daemonSchedule(l, conf, "Shredder", store, conf.ShredderPollingInterval, conf.ShredderTimeout, func() { notifyReady(l) }), l, adapter)
 		if err != nil {
 			l.Error("Shredder Errored", err)
+			exit(l, 1)
 		}
 		l.Info("Shredder Daemon is Down")
-		os.Exit(1)
+		exit(l, CleanShutdownExitCode)
 	} else {
-		err := shred(l, store)
+		err := shred(l, conf, store)
 		if err != nil {
-			os.Exit(1)
+			exit(l, 1)
 		} else {
-			os.Exit(0)
+			exit(l, 0)
 		}
 	}
 }
 
-func shred(l logger.Logger, store store.Store) error {
+func shred(l logger.Logger, conf *config.Config, store store.Store) error {
 	l.Info("Shredding Store")
-	theShredder := shredder.New(store)
+	theShredder := shredder.New(store, newMetricsAccountant(conf, store), conf.InstanceName(), conf.ShredderTimeout(), buildTimeProvider(l), l)
 	return theShredder.Shred()
 }
@@ -0,0 +1,100 @@
+package hm
+
+import (
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+// The exit codes of a command that was asked to shut down by SIGINT or
+// SIGTERM.  A clean shutdown finished its work in progress and released its
+// locks and connections.  A forced shutdown gave up on that, because the work
+// took longer than shutdown_timeout_in_seconds or a second signal arrived.
+// (A component that loses its lock exits with 197, and one whose watchdog
+// trips with daemon_watchdog_kills_process set exits with 199.  One that
+// cannot reach a dependency at start-up exits with 194, 195 or 196: see
+// startup_checks.go.)
+const (
+	CleanShutdownExitCode  = 0
+	ForcedShutdownExitCode = 198
+	WatchdogExitCode       = 199
+)
+
+type shutdownStep struct {
+	name string
+	run  func()
+}
+
+var shutdownLock = &sync.Mutex{}
+var shutdownSteps = []shutdownStep{}
+var shutdownRequested chan struct{}
+
+// onShutdown registers a step for exit to run, such as closing a connection
+// or flushing metrics.  Steps run in the reverse order of registration, so a
+// step never needs something that an earlier step has torn down.
+func onShutdown(name string, run func()) {
+	shutdownLock.Lock()
+	defer shutdownLock.Unlock()
+	shutdownSteps = append(shutdownSteps, shutdownStep{name: name, run: run})
+}
+
+// shutdownOnSignal returns a channel that is closed when the process receives
+// SIGINT or SIGTERM.  The command should then finish its work in progress and
+// call exit.  If it has not exited within the shutdown timeout, or another
+// signal arrives, the process exits at once with ForcedShutdownExitCode.
+// Every call returns the same channel.
+func shutdownOnSignal(l logger.Logger, conf *config.Config) <-chan struct{} {
+	shutdownLock.Lock()
+	defer shutdownLock.Unlock()
+
+	if shutdownRequested != nil {
+		return shutdownRequested
+	}
+
+	requested := make(chan struct{})
+	shutdownRequested = requested
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		received := <-signals
+		l.Info("Shutting down", map[string]string{
+			"Signal":  received.String(),
+			"Timeout": conf.ShutdownTimeout().String(),
+		})
+		close(requested)
+
+		select {
+		case received = <-signals:
+			l.Info("Forcing shutdown", map[string]string{"Signal": received.String()})
+		case <-time.After(conf.ShutdownTimeout()):
+			l.Info("Forcing shutdown: timed out waiting for work in progress")
+		}
+		os.Exit(ForcedShutdownExitCode)
+	}()
+
+	return requested
+}
+
+// exit runs the shutdown steps and exits with code.
+func exit(l logger.Logger, code int) {
+	shutdownLock.Lock()
+	steps := shutdownSteps
+	shutdownSteps = []shutdownStep{}
+	shutdownLock.Unlock()
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		l.Info("Shutdown: "+steps[i].name, map[string]string{"Step": strconv.Itoa(len(steps) - i)})
+		steps[i].run()
+	}
+
+	l.Info("Exiting", map[string]string{"Exit Code": strconv.Itoa(code)})
+	os.Exit(code)
+}
@@ -3,18 +3,35 @@ package hm
 import (
 	"github.com/cloudfoundry/hm9000/config"
 	evacuatorpackage "github.com/cloudfoundry/hm9000/evacuator"
+	"github.com/cloudfoundry/hm9000/helpers/eventbus"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/store"
 )
 
 func StartEvacuator(l logger.Logger, conf *config.Config) {
+	stop := shutdownOnSignal(l, conf)
+	holdPIDFile(l, conf)
+	startDebugServer(l, conf)
+	reportStoreAdapterStats(l, conf)
 	messageBus := connectToMessageBus(l, conf)
 	store := connectToStore(l, conf)
 
 	acquireLock(l, conf, "evacuator")
 
-	evacuator := evacuatorpackage.New(messageBus, store, buildTimeProvider(l), conf, l)
+	evacuator := startEvacuator(l, conf, messageBus, store, nil)
+	notifyReady(l)
+	<-stop
+	evacuator.Stop()
+	exit(l, CleanShutdownExitCode)
+}
+
+func startEvacuator(l logger.Logger, conf *config.Config, messageBus messagebus.MessageBus, store store.Store, events *eventbus.EventBus) *evacuatorpackage.Evacuator {
+	evacuator := evacuatorpackage.New(messageBus, store, newMetricsAccountant(conf, store), buildTimeProvider(l), conf, l)
 
+	evacuator.PublishEventsTo(events)
 	evacuator.Listen()
+	startDebugServer(l, conf).AddQueue("evacuator_starts_pending_retry", evacuator.StartsPendingRetry)
 	l.Info("Listening for DEA Evacuations")
-	select {}
+	return evacuator
 }
@@ -3,26 +3,43 @@ package hm
 import (
 	"github.com/cloudfoundry/hm9000/actualstatelistener"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/eventbus"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
+	"github.com/cloudfoundry/hm9000/store"
 )
 
 func StartListeningForActual(l logger.Logger, conf *config.Config) {
+	stop := shutdownOnSignal(l, conf)
+	holdPIDFile(l, conf)
+	startDebugServer(l, conf)
+	reportStoreAdapterStats(l, conf)
 	messageBus := connectToMessageBus(l, conf)
 	store, usageTracker := connectToStoreAndTrack(l, conf)
 
 	acquireLock(l, conf, "listener")
 
+	listener := startListener(l, conf, messageBus, store, usageTracker, nil)
+	notifyReady(l)
+	<-stop
+	listener.Stop()
+	exit(l, CleanShutdownExitCode)
+}
+
+func startListener(l logger.Logger, conf *config.Config, messageBus messagebus.MessageBus, store store.Store, usageTracker metricsaccountant.UsageTracker, events *eventbus.EventBus) *actualstatelistener.ActualStateListener {
 	listener := actualstatelistener.New(conf,
 		messageBus,
 		store,
 		usageTracker,
-		metricsaccountant.New(store),
+		newMetricsAccountant(conf, store),
 		buildTimeProvider(l),
 		l,
 	)
 
+	listener.PublishEventsTo(events)
 	listener.Start()
+	startDebugServer(l, conf).AddQueue("listener_heartbeats_pending_save", listener.HeartbeatsPendingSave)
 	l.Info("Listening for Actual State")
-	select {}
+	return listener
 }
@@ -0,0 +1,117 @@
+package hm
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/startupcheck"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// The exit codes of a command that gave up on reaching a dependency when it
+// started, one per dependency, so that a monit or BOSH restart loop says
+// which one is missing.
+const (
+	StoreUnreachableExitCode = 194
+	NATSUnreachableExitCode  = 195
+	CCUnreachableExitCode    = 196
+)
+
+// startupCheckKey is read to check that the store answers.  It is never
+// written: not finding it is an answer.
+const startupCheckKey = "/hm/startup-check"
+
+// requireDependency waits for dependency as startup_dependency_retries
+// allows, and exits with its exit code if it cannot be reached.  targets,
+// the addresses tried, go into the log for whoever is diagnosing the
+// failure.
+func requireDependency(l logger.Logger, conf *config.Config, dependency startupcheck.Dependency, targets []string) {
+	attempts, err := startupcheck.Wait(dependency, conf.StartupDependencyRetries, conf.StartupDependencyRetryDelay(), l)
+	if err == nil {
+		return
+	}
+
+	l.Error("Startup dependency check failed", err, map[string]string{
+		"Dependency": dependency.Name,
+		"Targets":    strings.Join(targets, ","),
+		"Attempts":   strconv.Itoa(attempts),
+		"Exit Code":  strconv.Itoa(dependency.ExitCode),
+	})
+	exit(l, dependency.ExitCode)
+}
+
+// requireStore connects adapter and checks that the store answers a read.
+func requireStore(l logger.Logger, conf *config.Config, adapter storeadapter.StoreAdapter) {
+	connected := false
+	requireDependency(l, conf, startupcheck.Dependency{
+		Name:     "store",
+		ExitCode: StoreUnreachableExitCode,
+		Check: func() error {
+			if !connected {
+				err := adapter.Connect()
+				if err != nil {
+					return err
+				}
+				connected = true
+			}
+
+			_, err := adapter.Get(startupCheckKey)
+			if err == storeadapter.ErrorKeyNotFound {
+				return nil
+			}
+			return err
+		},
+	}, conf.StoreURLs)
+}
+
+// requireNATS runs connect, which connects to NATS, until it succeeds.  The
+// targets logged leave out the credentials.
+func requireNATS(l logger.Logger, conf *config.Config, connect func() error) {
+	targets := []string{}
+	for _, cluster := range conf.NATSClusterList() {
+		for _, server := range cluster.Servers {
+			targets = append(targets, fmt.Sprintf("%s:%d", server.Host, server.Port))
+		}
+	}
+
+	requireDependency(l, conf, startupcheck.Dependency{
+		Name:     "NATS",
+		ExitCode: NATSUnreachableExitCode,
+		Check:    connect,
+	}, targets)
+}
+
+// requireCC checks that the CC answers at cc_base_url.  Any answer short of
+// a server error will do: bad credentials are the fetcher's to report.
+func requireCC(l logger.Logger, conf *config.Config) {
+	httpClient := newCCHttpClient(l, conf, nil)
+	requireDependency(l, conf, startupcheck.Dependency{
+		Name:     "CC",
+		ExitCode: CCUnreachableExitCode,
+		Check: func() error {
+			req, err := http.NewRequest("GET", conf.CCBaseURL+"/bulk/counts?model=app", nil)
+			if err != nil {
+				return err
+			}
+
+			errs := make(chan error, 1)
+			httpClient.Do(req, func(resp *http.Response, err error) {
+				if err != nil {
+					errs <- err
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode >= http.StatusInternalServerError {
+					errs <- fmt.Errorf("the CC answered %d", resp.StatusCode)
+					return
+				}
+				errs <- nil
+			})
+			return <-errs
+		},
+	}, []string{conf.CCBaseURL})
+}
@@ -0,0 +1,116 @@
+package hm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/status"
+)
+
+// Status prints a dashboard of the store: freshness, pending messages, the
+// polling components' last runs, app totals and any alarms.  It exits with 1
+// if there are alarms.
+func Status(l logger.Logger, conf *config.Config) {
+	shutdownOnSignal(l, conf)
+	timeProvider := buildTimeProvider(l)
+	collector := status.New(connectToStore(l, conf), timeProvider, conf)
+
+	report, err := collector.Collect()
+	if err != nil {
+		fail(l, "Failed to read the store", err)
+	}
+
+	if jsonOutput() {
+		printJSON(l, StatusOutput{Time: timeProvider.Time().UTC(), Healthy: report.IsHealthy(), Report: report})
+	} else {
+		printStatusReport(report, timeProvider.Time())
+	}
+
+	if !report.IsHealthy() {
+		exit(l, 1)
+	}
+	exit(l, 0)
+}
+
+// StatusOutput is what status prints with JSON output: the time of the
+// report and whether it raised any alarms, followed by the report itself.
+type StatusOutput struct {
+	Time    time.Time `json:"time"`
+	Healthy bool      `json:"healthy"`
+	status.Report
+}
+
+func printStatusReport(report status.Report, now time.Time) {
+	fmt.Printf("HM9000 status at %s\n", now.UTC().Format(time.RFC3339))
+
+	fmt.Printf("\nFreshness\n")
+	printFreshness("Desired", report.DesiredFreshness)
+	printFreshness("Actual", report.ActualFreshness)
+
+	fmt.Printf("\nPending messages\n")
+	fmt.Printf("  Starts: %d (%d ready to send)\n", report.PendingStarts, report.PendingStartsReady)
+	fmt.Printf("  Stops:  %d (%d ready to send)\n", report.PendingStops, report.PendingStopsReady)
+
+	fmt.Printf("\nComponents\n")
+	for _, component := range report.Components {
+		printComponent(component)
+	}
+
+	fmt.Printf("\nApps\n")
+	fmt.Printf("  Desired apps:      %d\n", report.DesiredApps)
+	fmt.Printf("  Desired instances: %d\n", report.DesiredInstances)
+	fmt.Printf("  Running instances: %d\n", report.RunningInstances)
+	fmt.Printf("  Crashed instances: %d\n", report.CrashedInstances)
+
+	fmt.Printf("\nAlarms\n")
+	if report.IsHealthy() {
+		fmt.Printf("  none\n")
+	}
+	for _, alarm := range report.Alarms {
+		fmt.Printf("  ! %s\n", alarm)
+	}
+}
+
+func printFreshness(name string, freshness status.Freshness) {
+	if !freshness.Present {
+		fmt.Printf("  %-8s NOT FRESH (no freshness key)\n", name+":")
+		return
+	}
+
+	state := "fresh"
+	if !freshness.Fresh {
+		state = "NOT FRESH"
+	}
+	fmt.Printf("  %-8s %s for %s (expires in %s)\n", name+":", state, freshness.Age, freshness.TTL)
+}
+
+func printComponent(component status.Component) {
+	lastRun := "never run"
+	if component.LastRun != nil {
+		outcome := "ok"
+		if !component.LastRun.Succeeded() {
+			outcome = "FAILED: " + component.LastRun.Error
+		}
+		lastRun = fmt.Sprintf("last ran %s ago for %dms, %s", component.SinceLastRun, component.LastRun.DurationInMilliseconds, outcome)
+	}
+
+	leader := ""
+	if component.Electing {
+		leader = " | leader: none"
+		if component.Leader != "" {
+			leader = " | leader: " + component.Leader
+		}
+	}
+
+	control := ""
+	if component.Control != nil && component.Control.Paused {
+		control = " | PAUSED by " + component.Control.ChangedBy
+	}
+	if component.Control != nil && component.Control.MessageLimit > 0 {
+		control += fmt.Sprintf(" | message limit: %d", component.Control.MessageLimit)
+	}
+
+	fmt.Printf("  %-9s %s%s%s\n", component.Name+":", lastRun, leader, control)
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"os"
 	"sort"
 	"strings"
 	"time"
@@ -17,6 +16,7 @@ import (
 )
 
 func Dump(l logger.Logger, conf *config.Config, raw bool) {
+	shutdownOnSignal(l, conf)
 	if raw {
 		dumpRaw(l, conf)
 	} else {
@@ -24,34 +24,63 @@ func Dump(l logger.Logger, conf *config.Config, raw bool) {
 	}
 }
 
+// DumpOutput is what dump prints with JSON output.
+type DumpOutput struct {
+	Timestamp      int64       `json:"timestamp"`
+	Fresh          bool        `json:"fresh"`
+	FreshnessError string      `json:"freshness_error,omitempty"`
+	Apps           []DumpedApp `json:"apps"`
+}
+
+// DumpedApp is an app in DumpOutput.  Desired is null for an app that is
+// not desired.
+type DumpedApp struct {
+	AppGuid            string                       `json:"app_guid"`
+	AppVersion         string                       `json:"app_version"`
+	Desired            *models.DesiredAppState      `json:"desired"`
+	InstanceHeartbeats []models.InstanceHeartbeat   `json:"instance_heartbeats"`
+	CrashCounts        []models.CrashCount          `json:"crash_counts"`
+	PendingStarts      []models.PendingStartMessage `json:"pending_starts"`
+	PendingStops       []models.PendingStopMessage  `json:"pending_stops"`
+}
+
+// RawDumpOutput is what dump --raw prints with JSON output.  A node's TTL
+// is 0 if it never expires.
+type RawDumpOutput struct {
+	Timestamp int64        `json:"timestamp"`
+	Nodes     []DumpedNode `json:"nodes"`
+}
+
+type DumpedNode struct {
+	Key   string `json:"key"`
+	TTL   uint64 `json:"ttl"`
+	Value string `json:"value"`
+}
+
 func dumpStructured(l logger.Logger, conf *config.Config) {
 	timeProvider := buildTimeProvider(l)
 	store := connectToStore(l, conf)
-	fmt.Printf("Dump - Current timestamp %d\n", timeProvider.Time().Unix())
+	output := DumpOutput{Timestamp: timeProvider.Time().Unix(), Apps: []DumpedApp{}}
+
 	err := store.VerifyFreshness(timeProvider.Time())
-	if err == nil {
-		fmt.Printf("Store is fresh\n")
-	} else {
-		fmt.Printf("STORE IS NOT FRESH: %s\n", err.Error())
+	output.Fresh = err == nil
+	if err != nil {
+		output.FreshnessError = err.Error()
 	}
-	fmt.Printf("====================\n")
 
 	apps, err := store.GetApps()
 	if err != nil {
-		fmt.Printf("Failed to fetch apps: %s\n", err.Error())
-		os.Exit(1)
+		fail(l, "Failed to fetch apps", err)
 	}
 
 	starts, err := store.GetPendingStartMessages()
 	if err != nil {
-		fmt.Printf("Failed to fetch starts: %s\n", err.Error())
-		os.Exit(1)
+		fail(l, "Failed to fetch starts", err)
 	}
 
 	stops, err := store.GetPendingStopMessages()
 	if err != nil {
-		fmt.Printf("Failed to fetch stops: %s\n", err.Error())
-		os.Exit(1)
+		fail(l, "Failed to fetch stops", err)
 	}
 
 	appKeys := sort.StringSlice{}
@@ -60,14 +89,73 @@ func dumpStructured(l logger.Logger, conf *config.Config) {
 	}
 	sort.Sort(appKeys)
 	for _, appKey := range appKeys {
-		dumpApp(apps[appKey], starts, stops, timeProvider)
+		output.Apps = append(output.Apps, dumpedApp(apps[appKey], starts, stops))
+	}
+
+	if jsonOutput() {
+		printJSON(l, output)
+		return
+	}
+
+	fmt.Printf("Dump - Current timestamp %d\n", output.Timestamp)
+	if output.Fresh {
+		fmt.Printf("Store is fresh\n")
+	} else {
+		fmt.Printf("STORE IS NOT FRESH: %s\n", output.FreshnessError)
+	}
+	fmt.Printf("====================\n")
+
+	for _, app := range output.Apps {
+		dumpApp(app, timeProvider)
+	}
+}
+
+func dumpedApp(app *models.App, starts map[string]models.PendingStartMessage, stops map[string]models.PendingStopMessage) DumpedApp {
+	dumped := DumpedApp{
+		AppGuid:            app.AppGuid,
+		AppVersion:         app.AppVersion,
+		InstanceHeartbeats: app.InstanceHeartbeats,
+		CrashCounts:        []models.CrashCount{},
+		PendingStarts:      []models.PendingStartMessage{},
+		PendingStops:       []models.PendingStopMessage{},
+	}
+	if dumped.InstanceHeartbeats == nil {
+		dumped.InstanceHeartbeats = []models.InstanceHeartbeat{}
+	}
+
+	if app.IsDesired() {
+		desired := app.Desired
+		dumped.Desired = &desired
+	}
+
+	indices := []int{}
+	for index := range app.CrashCounts {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		dumped.CrashCounts = append(dumped.CrashCounts, app.CrashCounts[index])
 	}
+
+	for _, start := range starts {
+		if start.AppGuid == app.AppGuid && start.AppVersion == app.AppVersion {
+			dumped.PendingStarts = append(dumped.PendingStarts, start)
+		}
+	}
+
+	for _, stop := range stops {
+		if stop.AppGuid == app.AppGuid && stop.AppVersion == app.AppVersion {
+			dumped.PendingStops = append(dumped.PendingStops, stop)
+		}
+	}
+
+	return dumped
 }
 
-func dumpApp(app *models.App, starts map[string]models.PendingStartMessage, stops map[string]models.PendingStopMessage, timeProvider timeprovider.TimeProvider) {
+func dumpApp(app DumpedApp, timeProvider timeprovider.TimeProvider) {
 	fmt.Printf("\n")
 	fmt.Printf("Guid: %s | Version: %s\n", app.AppGuid, app.AppVersion)
-	if app.IsDesired() {
+	if app.Desired != nil {
 		fmt.Printf("  Desired: [%d] instances, (%s, %s)\n", app.Desired.NumberOfInstances, app.Desired.State, app.Desired.PackageState)
 	} else {
 		fmt.Printf("  Desired: NO\n")
@@ -90,24 +178,9 @@ func dumpApp(app *models.App, starts map[string]models.PendingStartMessage, stop
 		fmt.Printf("\n")
 	}
 
-	appStarts := []models.PendingStartMessage{}
-	appStops := []models.PendingStopMessage{}
-
-	for _, start := range starts {
-		if start.AppGuid == app.AppGuid && start.AppVersion == app.AppVersion {
-			appStarts = append(appStarts, start)
-		}
-	}
-
-	for _, stop := range stops {
-		if stop.AppGuid == app.AppGuid && stop.AppVersion == app.AppVersion {
-			appStops = append(appStops, stop)
-		}
-	}
-
-	if len(appStarts) > 0 {
+	if len(app.PendingStarts) > 0 {
 		fmt.Printf("  Pending Starts:\n")
-		for _, start := range appStarts {
+		for _, start := range app.PendingStarts {
 			message := []string{}
 			message = append(message, fmt.Sprintf("[%d]", start.IndexToStart))
 			message = append(message, fmt.Sprintf("priority:%.2f", start.Priority))
@@ -125,9 +198,9 @@ func dumpApp(app *models.App, starts map[string]models.PendingStartMessage, stop
 		}
 	}
 
-	if len(appStops) > 0 {
+	if len(app.PendingStops) > 0 {
 		fmt.Printf("  Pending Stops:\n")
-		for _, stop := range appStops {
+		for _, stop := range app.PendingStops {
 			message := []string{}
 			message = append(message, stop.InstanceGuid)
 			if stop.SentOn != 0 {
@@ -144,34 +217,44 @@ func dumpApp(app *models.App, starts map[string]models.PendingStartMessage, stop
 
 func dumpRaw(l logger.Logger, conf *config.Config) {
 	storeAdapter := connectToStoreAdapter(l, conf, nil)
-	fmt.Printf("Raw Dump - Current timestamp %d\n", time.Now().Unix())
-
-	entries := sort.StringSlice{}
+	output := RawDumpOutput{Timestamp: time.Now().Unix(), Nodes: []DumpedNode{}}
 
 	node, err := storeAdapter.ListRecursively("/hm")
 	if err != nil {
-		panic(err)
+		fail(l, "Failed to list the store", err)
 	}
 	walk(node, func(node storeadapter.StoreNode) {
+		output.Nodes = append(output.Nodes, DumpedNode{Key: node.Key, TTL: node.TTL, Value: string(node.Value)})
+	})
+	sort.Sort(nodesByKey(output.Nodes))
+
+	if jsonOutput() {
+		printJSON(l, output)
+		return
+	}
+
+	fmt.Printf("Raw Dump - Current timestamp %d\n", output.Timestamp)
+	for _, node := range output.Nodes {
 		ttl := fmt.Sprintf("[TTL:%ds]", node.TTL)
 		if node.TTL == 0 {
 			ttl = "[TTL: ∞]"
 		}
 		buf := &bytes.Buffer{}
-		err := json.Indent(buf, node.Value, "    ", "  ")
+		err := json.Indent(buf, []byte(node.Value), "    ", "  ")
 		value := buf.String()
 		if err != nil {
-			value = string(node.Value)
+			value = node.Value
 		}
-		entries = append(entries, fmt.Sprintf("%s %s:\n    %s", node.Key, ttl, value))
-	})
-
-	sort.Sort(entries)
-	for _, entry := range entries {
-		fmt.Printf(entry + "\n")
+		fmt.Printf("%s %s:\n    %s\n", node.Key, ttl, value)
 	}
 }
 
+type nodesByKey []DumpedNode
+
+func (nodes nodesByKey) Len() int           { return len(nodes) }
+func (nodes nodesByKey) Swap(i, j int)      { nodes[i], nodes[j] = nodes[j], nodes[i] }
+func (nodes nodesByKey) Less(i, j int) bool { return nodes[i].Key < nodes[j].Key }
+
 func walk(node storeadapter.StoreNode, callback func(storeadapter.StoreNode)) {
 	for _, node := range node.ChildNodes {
 		if node.Dir {
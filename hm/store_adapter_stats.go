@@ -0,0 +1,59 @@
+package hm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/dropsonde"
+	"github.com/cloudfoundry/dropsonde/metrics"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/storeadapterstats"
+)
+
+// storeAdapterStatsReporter holds every store adapter the process opens.
+// Only long-running processes report their stats.
+var storeAdapterStatsReporter = storeadapterstats.New(dropsondeMetricSender{})
+var storeAdapterStatsOnce sync.Once
+
+// reportStoreAdapterStats emits the process's store adapter stats to metron,
+// on dropsonde_port, once per heartbeat and once more on shutdown.  Each
+// process reports its own, however many adapters and components it has, so
+// nothing is shared through the store.  Later calls do nothing.
+func reportStoreAdapterStats(l logger.Logger, conf *config.Config) {
+	storeAdapterStatsOnce.Do(func() {
+		if conf.MetricsDisabled {
+			return
+		}
+
+		err := dropsonde.Initialize(fmt.Sprintf("localhost:%d", conf.DropsondePort), "HM9000")
+		if err != nil {
+			l.Error("Failed to initialize dropsonde", err)
+			return
+		}
+
+		report := func() {
+			err := storeAdapterStatsReporter.Report()
+			if err != nil {
+				l.Error("Failed to report store adapter stats", err)
+			}
+		}
+		onShutdown("report the store adapter stats", report)
+		go func() {
+			for _ = range time.Tick(conf.HeartbeatPeriod.Duration) {
+				report()
+			}
+		}()
+	})
+}
+
+type dropsondeMetricSender struct{}
+
+func (dropsondeMetricSender) SendValue(name string, value float64, unit string) error {
+	return metrics.SendValue(name, value, unit)
+}
+
+func (dropsondeMetricSender) AddToCounter(name string, delta uint64) error {
+	return metrics.AddToCounter(name, delta)
+}
@@ -0,0 +1,59 @@
+package hm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/tail"
+)
+
+// Tail prints what HM9000 sees and does, one line per event, until it is
+// interrupted: an operator's strace for hm9000.  It polls the store every
+// heartbeat.  Colors are only used on a terminal, and with --output=json
+// each event is printed as a JSON object on its own line.
+func Tail(l logger.Logger, conf *config.Config, appGuid string, color bool) {
+	stop := shutdownOnSignal(l, conf)
+	messageBus := connectToMessageBus(l, conf)
+	store := connectToStore(l, conf)
+
+	color = color && !jsonOutput() && isTerminal(os.Stdout)
+	tailer := tail.New(messageBus, store, buildTimeProvider(l), conf, appGuid, func(event tail.Event) {
+		if jsonOutput() {
+			encoded, _ := json.Marshal(event)
+			fmt.Println(string(encoded))
+		} else {
+			fmt.Println(tail.Format(event, color))
+		}
+	})
+
+	err := tailer.Subscribe()
+	if err != nil {
+		fail(l, "Failed to subscribe to NATS", err)
+	}
+
+	ticker := time.NewTicker(conf.HeartbeatPeriod.Duration)
+	defer ticker.Stop()
+	for {
+		err := tailer.Poll()
+		if err != nil {
+			l.Error("Failed to poll the store", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			tailer.Unsubscribe()
+			exit(l, 0)
+			return
+		}
+	}
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -7,6 +7,7 @@ import (
 
 type usageTracker struct {
 	workerCount      int
+	inFlight         int
 	lock             sync.Mutex
 	startTime        time.Time
 	timeSpentWorking time.Duration
@@ -20,15 +21,27 @@ func newUsageTracker(workerCount int) *usageTracker {
 }
 
 func (u *usageTracker) Around(work func()) {
+	u.lock.Lock()
+	u.inFlight++
+	u.lock.Unlock()
+
 	start := time.Now()
 	work()
 	workTime := time.Since(start)
 
 	u.lock.Lock()
+	u.inFlight--
 	u.timeSpentWorking += workTime
 	u.lock.Unlock()
 }
 
+// InFlight is the number of store requests being worked on.
+func (u *usageTracker) InFlight() int {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return u.inFlight
+}
+
 func (u *usageTracker) StartTrackingUsage() {
 	u.resetUsageMetrics()
 }
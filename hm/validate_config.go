@@ -0,0 +1,117 @@
+package hm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+)
+
+const endpointCheckTimeout = 3 * time.Second
+
+// ValidateConfig prints every problem with conf and, unless skipEndpoints
+// is set, every endpoint it names that cannot be reached.  It exits non-zero
+// if it finds anything.
+func ValidateConfig(conf *config.Config, skipEndpoints bool) {
+	problems := []string{}
+
+	err := conf.Validate()
+	if validationErr, ok := err.(config.ValidationError); ok {
+		problems = append(problems, validationErr.Problems...)
+	} else if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if !skipEndpoints {
+		problems = append(problems, unreachableEndpoints(conf)...)
+	}
+
+	if jsonOutput() {
+		output, _ := json.MarshalIndent(ValidateConfigOutput{Valid: len(problems) == 0, Problems: problems}, "", "  ")
+		fmt.Println(string(output))
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("Config is valid")
+		os.Exit(0)
+	}
+
+	fmt.Printf("Found %d problems with the config\n", len(problems))
+	for _, problem := range problems {
+		fmt.Printf("  %s\n", problem)
+	}
+	os.Exit(1)
+}
+
+// ValidateConfigOutput is what validate_config prints with JSON output.
+type ValidateConfigOutput struct {
+	Valid    bool     `json:"valid"`
+	Problems []string `json:"problems"`
+}
+
+func unreachableEndpoints(conf *config.Config) []string {
+	endpoints := map[string]string{}
+	for _, storeURL := range conf.StoreURLs {
+		endpoints["store "+storeURL] = hostPort(storeURL, "4001")
+	}
+	for _, storeURL := range conf.SecondaryStoreURLs {
+		endpoints["secondary store "+storeURL] = hostPort(storeURL, "4001")
+	}
+	for _, storeURL := range conf.StoreMigrationURLs {
+		endpoints["migration target store "+storeURL] = hostPort(storeURL, "4001")
+	}
+	for _, cluster := range conf.NATSClusterList() {
+		for _, nats := range cluster.Servers {
+			address := net.JoinHostPort(nats.Host, strconv.Itoa(nats.Port))
+			endpoints["nats "+address] = address
+		}
+	}
+	if conf.CCBaseURL != "" {
+		endpoints["cc "+conf.CCBaseURL] = hostPort(conf.CCBaseURL, "80")
+	}
+
+	names := []string{}
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := []string{}
+	for _, name := range names {
+		connection, err := net.DialTimeout("tcp", endpoints[name], endpointCheckTimeout)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s is unreachable: %s", name, err.Error()))
+			continue
+		}
+		connection.Close()
+	}
+	return problems
+}
+
+// hostPort turns a URL (or a bare host:port, as ZooKeeper addresses are
+// given) into something that can be dialled.
+func hostPort(address string, defaultPort string) string {
+	parsed, err := url.Parse(address)
+	if err != nil || parsed.Host == "" {
+		return address
+	}
+
+	if _, _, err := net.SplitHostPort(parsed.Host); err == nil {
+		return parsed.Host
+	}
+
+	if parsed.Scheme == "https" {
+		defaultPort = "443"
+	}
+	return net.JoinHostPort(parsed.Host, defaultPort)
+}
@@ -0,0 +1,23 @@
+package hm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudfoundry/hm9000/version"
+)
+
+// PrintVersion prints the build of hm9000.  It needs no config.
+func PrintVersion() {
+	info := version.Get()
+	if jsonOutput() {
+		output, _ := json.MarshalIndent(info, "", "  ")
+		fmt.Println(string(output))
+		return
+	}
+
+	fmt.Printf("hm9000 %s\n", info.Version)
+	fmt.Printf("  Git SHA:    %s\n", info.GitSHA)
+	fmt.Printf("  Build Date: %s\n", info.BuildDate)
+	fmt.Printf("  Go Version: %s\n", info.GoVersion)
+}
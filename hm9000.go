@@ -8,16 +8,21 @@ import (
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
 	"github.com/cloudfoundry/hm9000/hm"
+	"github.com/cloudfoundry/hm9000/version"
 	"github.com/codegangsta/cli"
 
 	"os"
+	"time"
 )
 
 func main() {
 	app := cli.NewApp()
 	app.Name = "HM9000"
 	app.Usage = "Start the various HM9000 components"
-	app.Version = "0.0.9000"
+	app.Version = version.Version
+	app.Flags = []cli.Flag{
+		cli.StringFlag{"output", "text", "Output of the reporting commands: text or json (put it before the command)"},
+	}
 	app.Commands = []cli.Command{
 		{
 			Name:        "fetch_desired",
@@ -25,11 +30,14 @@ func main() {
 			Usage:       "hm fetch_desired --config=/path/to/config --poll",
 			Flags: []cli.Flag{
 				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				readyFileFlag(),
 				cli.BoolFlag{"poll", "If true, poll repeatedly with an interval defined in config"},
 			},
 			Action: func(c *cli.Context) {
 				logger, _, conf := loadLoggerAndConfig(c, "fetcher")
-				hm.FetchDesiredState(logger, conf, c.Bool("poll"))
+				hm.FetchDesiredState(logger, conf, c.String("config"), c.Bool("poll"))
 			},
 		},
 		{
@@ -38,6 +46,9 @@ func main() {
 			Usage:       "hm listen --config=/path/to/config",
 			Flags: []cli.Flag{
 				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				readyFileFlag(),
 			},
 			Action: func(c *cli.Context) {
 				logger, _, conf := loadLoggerAndConfig(c, "listener")
@@ -50,11 +61,14 @@ func main() {
 			Usage:       "hm analyze --config=/path/to/config --poll",
 			Flags: []cli.Flag{
 				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				readyFileFlag(),
 				cli.BoolFlag{"poll", "If true, poll repeatedly with an interval defined in config"},
 			},
 			Action: func(c *cli.Context) {
 				logger, _, conf := loadLoggerAndConfig(c, "analyzer")
-				hm.Analyze(logger, conf, c.Bool("poll"))
+				hm.Analyze(logger, conf, c.String("config"), c.Bool("poll"))
 			},
 		},
 		{
@@ -63,11 +77,14 @@ func main() {
 			Usage:       "hm send --config=/path/to/config --poll",
 			Flags: []cli.Flag{
 				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				readyFileFlag(),
 				cli.BoolFlag{"poll", "If true, poll repeatedly with an interval defined in config"},
 			},
 			Action: func(c *cli.Context) {
 				logger, _, conf := loadLoggerAndConfig(c, "sender")
-				hm.Send(logger, conf, c.Bool("poll"))
+				hm.Send(logger, conf, c.String("config"), c.Bool("poll"))
 			},
 		},
 		{
@@ -76,6 +93,9 @@ func main() {
 			Usage:       "hm evacuator --config=/path/to/config",
 			Flags: []cli.Flag{
 				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				readyFileFlag(),
 			},
 			Action: func(c *cli.Context) {
 				logger, _, conf := loadLoggerAndConfig(c, "evacuator")
@@ -88,6 +108,9 @@ func main() {
 			Usage:       "hm serve_metrics --config=/path/to/config",
 			Flags: []cli.Flag{
 				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				readyFileFlag(),
 			},
 			Action: func(c *cli.Context) {
 				logger, steno, conf := loadLoggerAndConfig(c, "metrics_server")
@@ -100,23 +123,259 @@ func main() {
 			Usage:       "hm serve_api --config=/path/to/config",
 			Flags: []cli.Flag{
 				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				readyFileFlag(),
 			},
 			Action: func(c *cli.Context) {
 				logger, _, conf := loadLoggerAndConfig(c, "apiserver")
 				hm.ServeAPI(logger, conf)
 			},
 		},
+		{
+			Name:        "serve",
+			Description: "Runs the listener, fetcher, analyzer, sender, evacuator, metrics server and API server in one process",
+			Usage:       "hm serve --config=/path/to/config",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				readyFileFlag(),
+			},
+			Action: func(c *cli.Context) {
+				conf := loadConfig(c, "")
+				logger, _ := initializeLogger("serve", conf)
+				checkConfig(logger, conf)
+
+				confs := map[string]*config.Config{}
+				for _, component := range hm.ServedComponents {
+					confs[component] = loadConfig(c, component)
+				}
+				hm.Serve(logger, conf, confs, c.String("config"))
+			},
+		},
 		{
 			Name:        "shred",
 			Description: "Deletes empty directories from the store",
 			Usage:       "hm shred --config=/path/to/config --poll",
 			Flags: []cli.Flag{
 				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				readyFileFlag(),
 				cli.BoolFlag{"poll", "If true, poll repeatedly with an interval defined in config"},
 			},
 			Action: func(c *cli.Context) {
 				logger, _, conf := loadLoggerAndConfig(c, "shredder")
-				hm.Shred(logger, conf, c.Bool("poll"))
+				hm.Shred(logger, conf, c.String("config"), c.Bool("poll"))
+			},
+		},
+		{
+			Name:        "aggregate",
+			Description: "Summarizes the health of each app in the store",
+			Usage:       "hm aggregate --config=/path/to/config --poll",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				readyFileFlag(),
+				cli.BoolFlag{"poll", "If true, poll repeatedly with an interval defined in config"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "aggregator")
+				hm.Aggregate(logger, conf, c.String("config"), c.Bool("poll"))
+			},
+		},
+		{
+			Name:        "rotate_encryption_key",
+			Description: "Re-encrypts sensitive store values with the active encryption key",
+			Usage:       "hm rotate_encryption_key --config=/path/to/config",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "key_rotator")
+				hm.RotateEncryptionKey(logger, conf)
+			},
+		},
+		{
+			Name:        "fsck",
+			Description: "Checks the integrity of the data store",
+			Usage:       "hm fsck --config=/path/to/config --repair",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				cli.BoolFlag{"repair", "If set, delete orphaned and undecodable keys"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "fsck")
+				hm.Fsck(logger, conf, c.Bool("repair"))
+			},
+		},
+		{
+			Name:        "check_store_migration",
+			Description: "Compares the data store with the store it is being migrated to",
+			Usage:       "hm check_store_migration --config=/path/to/config",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "fsck")
+				hm.CheckStoreMigration(logger, conf)
+			},
+		},
+		{
+			Name:        "status",
+			Description: "Prints freshness, pending messages, component runs, app totals and alarms",
+			Usage:       "hm status --config=/path/to/config",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "status")
+				hm.Status(logger, conf)
+			},
+		},
+		{
+			Name:        "app",
+			Description: "Prints an app's desired state, instances, pending messages and what the analyzer would do for it",
+			Usage:       "hm app --config=/path/to/config --guid=APP_GUID --format=table",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				cli.StringFlag{"guid", "", "Guid of the app"},
+				cli.StringFlag{"version", "", "If set, show only this version of the app"},
+				cli.StringFlag{"format", "table", "Output format: table or json"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "status")
+				hm.App(logger, conf, c.String("guid"), c.String("version"), c.String("format"))
+			},
+		},
+		{
+			Name:        "tail",
+			Description: "Streams what HM9000 sees and does as it happens: freshness changes, the analyzer's decisions and the messages sent",
+			Usage:       "hm tail --config=/path/to/config --guid=APP_GUID",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				cli.StringFlag{"guid", "", "If set, show only this app, and its instances' state changes"},
+				cli.BoolFlag{"no-color", "If true, do not color the output, even on a terminal"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "status")
+				hm.Tail(logger, conf, c.String("guid"), !c.Bool("no-color"))
+			},
+		},
+		{
+			Name:        "queue_start",
+			Description: "Enqueues a start message for an index of an app, recording an OPERATOR reason",
+			Usage:       "hm queue_start --config=/path/to/config --guid=APP_GUID --version=APP_VERSION --index=0 --confirm",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				cli.StringFlag{"guid", "", "Guid of the app"},
+				cli.StringFlag{"version", "", "Version of the app"},
+				cli.IntFlag{"index", 0, "Index to start"},
+				cli.IntFlag{"delay", 0, "Seconds to wait before sending the message"},
+				cli.BoolFlag{"skip_verification", "If set, send the message even if the index is running or not desired"},
+				cli.StringFlag{"note", "", "Why the message is being enqueued, for the audit log"},
+				cli.BoolFlag{"confirm", "Enqueue the message; without it, only show what would be enqueued"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "status")
+				hm.QueueStart(logger, conf, c.String("guid"), c.String("version"), c.Int("index"), c.Int("delay"), c.Bool("skip_verification"), c.String("note"), c.Bool("confirm"))
+			},
+		},
+		{
+			Name:        "queue_stop",
+			Description: "Enqueues a stop message for an instance of an app, recording an OPERATOR reason",
+			Usage:       "hm queue_stop --config=/path/to/config --guid=APP_GUID --version=APP_VERSION --instance=INSTANCE_GUID --confirm",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				cli.StringFlag{"guid", "", "Guid of the app"},
+				cli.StringFlag{"version", "", "Version of the app"},
+				cli.StringFlag{"instance", "", "Guid of the instance to stop"},
+				cli.IntFlag{"delay", 0, "Seconds to wait before sending the message"},
+				cli.StringFlag{"note", "", "Why the message is being enqueued, for the audit log"},
+				cli.BoolFlag{"confirm", "Enqueue the message; without it, only show what would be enqueued"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "status")
+				hm.QueueStop(logger, conf, c.String("guid"), c.String("version"), c.String("instance"), c.Int("delay"), c.String("note"), c.Bool("confirm"))
+			},
+		},
+		{
+			Name:        "reset_crash_counts",
+			Description: "Forgets the crash counts, and restart backoff, of an app's instances",
+			Usage:       "hm reset_crash_counts --config=/path/to/config --guid=APP_GUID --version=APP_VERSION --indices=0,2",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				cli.StringFlag{"guid", "", "Guid of the app"},
+				cli.StringFlag{"version", "", "Version of the app"},
+				cli.StringFlag{"indices", "", "Comma-separated indices to reset; if not set, every index"},
+				cli.StringFlag{"note", "", "Why the crash counts are being reset, for the audit log"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "status")
+				hm.ResetCrashCounts(logger, conf, c.String("guid"), c.String("version"), c.String("indices"), c.String("note"))
+			},
+		},
+		{
+			Name:        "doctor",
+			Description: "Checks that NATS, the store, the Cloud Controller and the metrics server can all be reached and used",
+			Usage:       "hm doctor --config=/path/to/config --timeout=10",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				cli.IntFlag{"timeout", 10, "Seconds each check may take"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "status")
+				hm.Doctor(logger, conf, time.Duration(c.Int("timeout"))*time.Second)
+			},
+		},
+		{
+			Name:        "validate_config",
+			Description: "Checks the config file for missing settings, contradictions and unreachable endpoints",
+			Usage:       "hm validate_config --config=/path/to/config --skip_endpoint_checks",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				cli.BoolFlag{"skip_endpoint_checks", "If set, do not try to connect to the store, NATS and CC"},
+			},
+			Action: func(c *cli.Context) {
+				hm.ValidateConfig(loadConfig(c, ""), c.Bool("skip_endpoint_checks"))
+			},
+		},
+		{
+			Name:        "show_config",
+			Description: "Prints the effective config, including defaults and overrides, with credentials redacted",
+			Usage:       "hm show_config --config=/path/to/config --component=analyzer",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				cli.StringFlag{"component", "", "If set, apply the component's section of \"components\""},
+			},
+			Action: func(c *cli.Context) {
+				hm.ShowConfig(loadConfig(c, c.String("component")))
 			},
 		},
 		{
@@ -125,6 +384,8 @@ func main() {
 			Usage:       "hm dump --config=/path/to/config",
 			Flags: []cli.Flag{
 				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
 				cli.BoolFlag{"raw", "If set, dump the unstructured contents of the database"},
 			},
 			Action: func(c *cli.Context) {
@@ -132,35 +393,148 @@ func main() {
 				hm.Dump(logger, conf, c.Bool("raw"))
 			},
 		},
+		{
+			Name:        "replay",
+			Description: "Replays a capture of NATS messages to a listener and evacuator that save what they hear in the store, for reproducing field issues and load testing",
+			Usage:       "hm replay --config=/path/to/config --capture=/path/to/capture --speed=1",
+			Flags: []cli.Flag{
+				cli.StringFlag{"config", "", "Path to config file"},
+				configFormatFlag(),
+				overrideFlag(),
+				cli.StringFlag{"capture", "", "Path to the capture: one {\"timestamp\": ..., \"subject\": ..., \"data\": ...} object per message"},
+				cli.StringFlag{"speed", "1", "How many times faster than captured to replay the messages; 0 replays them as fast as possible"},
+			},
+			Action: func(c *cli.Context) {
+				logger, _, conf := loadLoggerAndConfig(c, "listener")
+				hm.Replay(logger, conf, c.String("capture"), c.String("speed"))
+			},
+		},
+		{
+			Name:        "version",
+			Description: "Prints the version, git SHA and build date of this binary",
+			Usage:       "hm version",
+			Action: func(c *cli.Context) {
+				err := hm.SetOutput(c.GlobalString("output"))
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(1)
+				}
+				hm.PrintVersion()
+			},
+		},
 	}
 
 	app.Run(os.Args)
 }
 
-func loadLoggerAndConfig(c *cli.Context, component string) (logger.Logger, *gosteno.Logger, *config.Config) {
+// loadConfig reads the config named on the command line, lays the
+// component's section over it (unless component is empty), and then applies
+// the overrides from the environment and the command line.
+func loadConfig(c *cli.Context, component string) *config.Config {
+	err := hm.SetOutput(c.GlobalString("output"))
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	err = hm.SetReadyFile(c.String("ready_file"))
+	if err != nil {
+		fmt.Printf("Failed to remove the old ready file: %s", err.Error())
+		os.Exit(1)
+	}
+
 	configPath := c.String("config")
 	if configPath == "" {
 		fmt.Printf("Config path required")
 		os.Exit(1)
 	}
 
-	conf, err := config.FromFile(configPath)
+	conf, err := config.FromFileInFormat(configPath, c.String("config_format"))
 	if err != nil {
 		fmt.Printf("Failed to load config: %s", err.Error())
 		os.Exit(1)
 	}
 
+	if component != "" {
+		conf, err = conf.ForComponent(component)
+		if err != nil {
+			fmt.Printf("Failed to load config: %s", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	err = conf.ApplyOverrides(config.EnvironmentOverrides(os.Environ()))
+	if err != nil {
+		fmt.Printf("Failed to apply config overrides from the environment: %s", err.Error())
+		os.Exit(1)
+	}
+
+	flagOverrides, err := config.FlagOverrides(c.StringSlice("set"))
+	if err == nil {
+		err = conf.ApplyOverrides(flagOverrides)
+	}
+	if err != nil {
+		fmt.Printf("Failed to apply config overrides from --set: %s", err.Error())
+		os.Exit(1)
+	}
+
+	return conf
+}
+
+// configFormatFlag forces the config file to be parsed as JSON or YAML,
+// whatever its extension.
+func configFormatFlag() cli.Flag {
+	return cli.StringFlag{"config_format", "", "Format of the config file: json or yaml (default: from the file extension)"}
+}
+
+// readyFileFlag names a file that a long-running command writes once it is
+// ready, and removes when it shuts down.
+func readyFileFlag() cli.Flag {
+	return cli.StringFlag{"ready_file", "", "If set, write this file once the component is ready"}
+}
+
+// overrideFlag lets any config setting be overridden on the command line.
+// It takes precedence over the environment, which takes precedence over the
+// config file.
+func overrideFlag() cli.Flag {
+	return cli.StringSliceFlag{"set", &cli.StringSlice{}, "Override a config setting, e.g. --set heartbeat_period_in_seconds=5 (may be repeated)"}
+}
+
+func loadLoggerAndConfig(c *cli.Context, component string) (logger.Logger, *gosteno.Logger, *config.Config) {
+	conf := loadConfig(c, component)
+	hmLogger, steno := initializeLogger(component, conf)
+	checkConfig(hmLogger, conf)
+	return hmLogger, steno, conf
+}
+
+func initializeLogger(name string, conf *config.Config) (logger.Logger, *gosteno.Logger) {
+	sinks, err := hm.LogSinks(name, conf)
+	if err != nil {
+		fmt.Printf("Failed to set up logging: %s", err.Error())
+		os.Exit(1)
+	}
 	stenoConf := &gosteno.Config{
-		Sinks: []gosteno.Sink{
-			gosteno.NewIOSink(os.Stdout),
-			gosteno.NewSyslogSink("vcap.hm9000." + component),
-		},
-		Level: conf.LogLevel(),
+		Sinks: sinks,
+		Level: gosteno.LOG_ALL,
 		Codec: gosteno.NewJsonCodec(),
 	}
 	gosteno.Init(stenoConf)
-	steno := gosteno.NewLogger("vcap.hm9000." + component)
-	hmLogger := logger.NewRealLogger(steno)
+	realLogger := logger.New(name, conf.LogLevel(), conf.LogFormat)
+	hmLogger := hm.SampleLogs(realLogger, conf)
+	hm.ChangeLogLevelsOnSignal(hmLogger)
+	hmLogger.Info("Starting hm9000 "+name, version.Get().LogData())
+	return hmLogger, realLogger.Steno()
+}
 
-	return hmLogger, steno, conf
+// checkConfig logs validation problems, and exits if conf.StrictStartup is
+// set.
+func checkConfig(hmLogger logger.Logger, conf *config.Config) {
+	err := conf.Validate()
+	if err != nil {
+		if conf.StrictStartup {
+			hmLogger.Error("Refusing to start with an invalid config", err)
+			os.Exit(1)
+		}
+		hmLogger.Error("Starting with an invalid config", err)
+	}
 }
@@ -55,7 +55,7 @@ func (runner *CLIRunner) generateConfig(storeURLs []string, ccBaseURL string, na
 	conf.MetricsServerUser = "bob"
 	conf.MetricsServerPassword = "password"
 	conf.StoreMaxConcurrentRequests = 10
-	conf.ListenerHeartbeatSyncIntervalInMilliseconds = 100
+	conf.ListenerHeartbeatSyncIntervalInMilliseconds.Duration = 100 * time.Millisecond
 	conf.APIServerPort = int(5155 + ginkgo.GinkgoParallelNode())
 
 	err = json.NewEncoder(tmpFile).Encode(conf)
@@ -5,6 +5,7 @@ import (
 
 	"github.com/cloudfoundry/gunk/workpool"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 	storepackage "github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/hm9000/testhelpers/desiredstateserver"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
@@ -14,12 +15,11 @@ import (
 	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
 	"github.com/cloudfoundry/storeadapter/storerunner"
 	"github.com/cloudfoundry/storeadapter/storerunner/etcdstorerunner"
-	"github.com/cloudfoundry/yagnats"
 	. "github.com/onsi/gomega"
 )
 
 type MCATCoordinator struct {
-	MessageBus   yagnats.NATSConn
+	MessageBus   messagebus.MessageBus
 	StateServer  *desiredstateserver.DesiredStateServer
 	StoreRunner  storerunner.StoreRunner
 	StoreAdapter storeadapter.StoreAdapter
@@ -2,14 +2,14 @@ package mcat_test
 
 import (
 	"github.com/apcera/nats"
-	"github.com/cloudfoundry/yagnats"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("registrations", func() {
-	var natsClient yagnats.NATSConn
+	var natsClient messagebus.MessageBus
 
 	BeforeEach(func() {
 		natsClient = coordinator.MessageBus
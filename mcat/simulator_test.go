@@ -2,11 +2,11 @@ package mcat_test
 
 import (
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/hm9000/testhelpers/desiredstateserver"
 	"github.com/cloudfoundry/storeadapter/storerunner"
-	"github.com/cloudfoundry/yagnats"
 	. "github.com/onsi/gomega"
 )
 
@@ -21,10 +21,10 @@ type Simulator struct {
 	TicksToAttainFreshness int
 	TicksToExpireHeartbeat int
 	GracePeriod            int
-	messageBus             yagnats.NATSConn
+	messageBus             messagebus.MessageBus
 }
 
-func NewSimulator(conf *config.Config, storeRunner storerunner.StoreRunner, store store.Store, desiredStateServer *desiredstateserver.DesiredStateServer, cliRunner *CLIRunner, messageBus yagnats.NATSConn) *Simulator {
+func NewSimulator(conf *config.Config, storeRunner storerunner.StoreRunner, store store.Store, desiredStateServer *desiredstateserver.DesiredStateServer, cliRunner *CLIRunner, messageBus messagebus.MessageBus) *Simulator {
 	desiredStateServer.Reset()
 
 	return &Simulator{
@@ -42,7 +42,7 @@ func NewSimulator(conf *config.Config, storeRunner storerunner.StoreRunner, stor
 }
 
 func (s *Simulator) Tick(numTicks int) {
-	timeBetweenTicks := int(s.conf.HeartbeatPeriod)
+	timeBetweenTicks := int(s.conf.HeartbeatPeriod.Seconds())
 
 	for i := 0; i < numTicks; i++ {
 		s.currentTimestamp += timeBetweenTicks
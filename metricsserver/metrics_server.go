@@ -8,9 +8,12 @@ import (
 	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
 	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/version"
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent"
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"github.com/cloudfoundry/storeadapter"
 	"strconv"
+	"time"
 )
 
 type CollectorRegistrar interface {
@@ -41,6 +44,9 @@ func New(registrar CollectorRegistrar, steno *gosteno.Logger, metricsAccountant
 
 func (s *MetricsServer) Emit() (context instrumentation.Context) {
 	context.Name = "HM9000"
+	defer func() {
+		s.tagMetrics(context.Metrics)
+	}()
 
 	NumberOfAppsWithAllInstancesReporting := 0
 	NumberOfAppsWithMissingInstances := 0
@@ -115,6 +121,12 @@ func (s *MetricsServer) Emit() (context instrumentation.Context) {
 		}
 	}
 
+	for _, component := range []string{"Analyzer", "Sender"} {
+		context.Metrics = append(context.Metrics, s.leaderMetric(component))
+	}
+	context.Metrics = append(context.Metrics, buildMetric())
+	context.Metrics = append(context.Metrics, s.zoneMetrics()...)
+
 	err = s.store.VerifyFreshness(s.timeProvider.Time())
 	if err != nil {
 		s.logger.Error("Failed to server metrics: store is not fresh", err)
@@ -131,7 +143,7 @@ func (s *MetricsServer) Emit() (context instrumentation.Context) {
 		return
 	}
 
-	apps, err := s.store.GetApps()
+	summaries, err := s.appSummaries()
 	if err != nil {
 		s.logger.Error("Failed to fetch apps: store is not fresh", err)
 		NumberOfAppsWithAllInstancesReporting = -1
@@ -147,45 +159,159 @@ func (s *MetricsServer) Emit() (context instrumentation.Context) {
 		return
 	}
 
-	for _, app := range apps {
-		numberOfMissingIndicesForApp := app.NumberOfDesiredInstances() - app.NumberOfDesiredIndicesReporting()
-		if app.IsDesired() {
-			if app.Desired.PackageState == models.AppPackageStatePending {
+	for _, summary := range summaries {
+		if summary.IsDesired() {
+			if summary.PackageState == models.AppPackageStatePending {
 				NumberOfDesiredAppsPendingStaging++
 			} else {
 				NumberOfDesiredApps += 1
-				NumberOfDesiredInstances += app.NumberOfDesiredInstances()
+				NumberOfDesiredInstances += summary.DesiredInstances
 
-				if numberOfMissingIndicesForApp == 0 {
+				if summary.MissingIndices == 0 {
 					NumberOfAppsWithAllInstancesReporting++
 				} else {
 					NumberOfAppsWithMissingInstances++
 				}
-				NumberOfMissingIndices += numberOfMissingIndicesForApp
+				NumberOfMissingIndices += summary.MissingIndices
 			}
 		} else {
-			if app.HasStartingOrRunningInstances() {
+			if summary.RunningInstances > 0 {
 				NumberOfUndesiredRunningApps++
 			}
 		}
 
-		NumberOfRunningInstances += app.NumberOfStartingOrRunningInstances()
-		NumberOfCrashedInstances += app.NumberOfCrashedInstances()
-		NumberOfCrashedIndices += app.NumberOfCrashedIndices()
+		NumberOfRunningInstances += summary.RunningInstances
+		NumberOfCrashedInstances += summary.CrashedInstances
+		NumberOfCrashedIndices += summary.CrashedIndices
 	}
 
 	return
 }
 
+// appSummaries are the aggregator's summaries with
+// metrics_server_use_app_summaries set, so long as they are fresh, and
+// otherwise summarize the apps in the store.
+func (s *MetricsServer) appSummaries() ([]models.AppSummary, error) {
+	summaries := []models.AppSummary{}
+
+	if s.config.MetricsServerUseAppSummaries {
+		fresh, err := s.store.AreAppSummariesFresh()
+		if err != nil {
+			return nil, err
+		}
+		if !fresh {
+			return nil, store.AppSummariesAreNotFreshError
+		}
+
+		stored, err := s.store.GetAppSummaries()
+		if err != nil {
+			return nil, err
+		}
+		for _, summary := range stored {
+			summaries = append(summaries, summary)
+		}
+		return summaries, nil
+	}
+
+	apps, err := s.store.GetApps()
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range apps {
+		summaries = append(summaries, models.NewAppSummary(app))
+	}
+	return summaries, nil
+}
+
+// leaderMetric is 1, tagged with the leader's candidate name, while a
+// process leads the component, and 0 otherwise.
+func (s *MetricsServer) leaderMetric(component string) instrumentation.Metric {
+	metric := instrumentation.Metric{Name: component + "Leader", Value: 0}
+
+	leader, err := s.store.GetLeader(component)
+	if err == nil {
+		metric.Value = 1
+		metric.Tags = map[string]interface{}{"node": leader}
+	} else if err != storeadapter.ErrorKeyNotFound {
+		s.logger.Error("Failed to fetch the leader", err, map[string]string{"Component": component})
+	}
+
+	return metric
+}
+
+// zoneMetrics are ZoneFresh, 1 while a zone's actual state is fresh and 0
+// once every DEA in it has stopped heartbeating, and ZoneFreshDEAs, for each
+// zone tagged with its name, along with the number of StaleZones.
+func (s *MetricsServer) zoneMetrics() []instrumentation.Metric {
+	deaZones, err := s.store.GetDeaZones()
+	if err != nil {
+		s.logger.Error("Failed to fetch the zones of DEAs", err)
+		return []instrumentation.Metric{}
+	}
+
+	ttl := time.Duration(s.config.HeartbeatTTL()) * time.Second
+	staleZones := 0
+	metrics := []instrumentation.Metric{}
+	for zone, freshness := range deaZones.Freshness(s.timeProvider.Time(), ttl) {
+		fresh := 0
+		if freshness.Fresh {
+			fresh = 1
+		} else {
+			staleZones++
+		}
+		tags := map[string]interface{}{"zone": zone}
+		metrics = append(metrics,
+			instrumentation.Metric{Name: "ZoneFresh", Value: fresh, Tags: tags},
+			instrumentation.Metric{Name: "ZoneFreshDEAs", Value: freshness.FreshDeas, Tags: tags},
+		)
+	}
+	return append(metrics, instrumentation.Metric{Name: "StaleZones", Value: staleZones})
+}
+
+// tagMetrics adds the config's metrics tags, its origin, job and index, to
+// each metric's own.
+func (s *MetricsServer) tagMetrics(metrics []instrumentation.Metric) {
+	if s.config.MetricsTags() == nil {
+		return
+	}
+	for i := range metrics {
+		tags := s.config.MetricsTags()
+		for name, value := range metrics[i].Tags {
+			tags[name] = value
+		}
+		metrics[i].Tags = tags
+	}
+}
+
+// buildMetric is always 1, tagged with the metrics server's build.
+func buildMetric() instrumentation.Metric {
+	info := version.Get()
+	return instrumentation.Metric{
+		Name:  "BuildInfo",
+		Value: 1,
+		Tags: map[string]interface{}{
+			"version":    info.Version,
+			"git_sha":    info.GitSHA,
+			"build_date": info.BuildDate,
+			"go_version": info.GoVersion,
+		},
+	}
+}
+
 func (s *MetricsServer) Ok() bool {
 	return true
 }
 
 func (s *MetricsServer) Start() error {
+	if s.config.MetricsDisabled {
+		s.logger.Info("Not serving metrics: metrics_disabled is set")
+		return nil
+	}
+
 	component, err := cfcomponent.NewComponent(
 		s.steno,
 		"HM9000",
-		0,
+		uint(s.config.MetricsIndex),
 		s,
 		uint32(s.config.MetricsServerPort),
 		[]string{s.config.MetricsServerUser, s.config.MetricsServerPassword},
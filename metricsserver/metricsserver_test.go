@@ -10,7 +10,9 @@ import (
 	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakemetricsaccountant"
+	"github.com/cloudfoundry/hm9000/version"
 	"github.com/cloudfoundry/loggregatorlib/cfcomponent/instrumentation"
+	"github.com/cloudfoundry/storeadapter"
 	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -24,10 +26,11 @@ var _ = Describe("Metrics Server", func() {
 		timeProvider      *faketimeprovider.FakeTimeProvider
 		metricsServer     *MetricsServer
 		metricsAccountant *fakemetricsaccountant.FakeMetricsAccountant
+		conf              *config.Config
 	)
 
 	BeforeEach(func() {
-		conf, _ := config.DefaultConfig()
+		conf, _ = config.DefaultConfig()
 		storeAdapter = fakestoreadapter.New()
 		store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
 		timeProvider = &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(100, 0)}
@@ -66,6 +69,76 @@ var _ = Describe("Metrics Server", func() {
 		})
 	})
 
+	Describe("leader metrics", func() {
+		It("reports the leader of the analyzer and the sender", func() {
+			storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/locks/Analyzer", Value: []byte("node-a"), TTL: 10}})
+
+			context := metricsServer.Emit()
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "AnalyzerLeader", Value: 1, Tags: map[string]interface{}{"node": "node-a"}}))
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "SenderLeader", Value: 0}))
+		})
+	})
+
+	Describe("zone metrics", func() {
+		It("reports the freshness of each zone", func() {
+			fresh := models.Heartbeat{DeaGuid: "dea-a", Zone: "a"}
+			stale := models.Heartbeat{DeaGuid: "dea-b", Zone: "b"}
+			store.SyncDeaZones(time.Unix(90, 0), []models.Heartbeat{fresh}, nil)
+			store.SyncDeaZones(time.Unix(10, 0), []models.Heartbeat{stale}, nil)
+
+			context := metricsServer.Emit()
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "ZoneFresh", Value: 1, Tags: map[string]interface{}{"zone": "a"}}))
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "ZoneFreshDEAs", Value: 1, Tags: map[string]interface{}{"zone": "a"}}))
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "ZoneFresh", Value: 0, Tags: map[string]interface{}{"zone": "b"}}))
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "ZoneFreshDEAs", Value: 0, Tags: map[string]interface{}{"zone": "b"}}))
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "StaleZones", Value: 1}))
+		})
+	})
+
+	Describe("build metrics", func() {
+		It("reports the build of the metrics server", func() {
+			info := version.Get()
+
+			context := metricsServer.Emit()
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "BuildInfo", Value: 1, Tags: map[string]interface{}{
+				"version":    info.Version,
+				"git_sha":    info.GitSHA,
+				"build_date": info.BuildDate,
+				"go_version": info.GoVersion,
+			}}))
+		})
+	})
+
+	Describe("origin tags", func() {
+		It("tags no metric when metrics_origin is not set", func() {
+			context := metricsServer.Emit()
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "SenderLeader", Value: 0}))
+		})
+
+		It("tags every metric with the origin, job and index when metrics_origin is set", func() {
+			conf.MetricsOrigin = "hm9000-z1"
+			conf.MetricsJob = "hm9000_z1"
+			conf.MetricsIndex = 2
+			storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/locks/Analyzer", Value: []byte("node-a"), TTL: 10}})
+
+			context := metricsServer.Emit()
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "SenderLeader", Value: 0, Tags: map[string]interface{}{
+				"origin": "hm9000-z1",
+				"job":    "hm9000_z1",
+				"index":  2,
+			}}))
+			Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "AnalyzerLeader", Value: 1, Tags: map[string]interface{}{
+				"origin": "hm9000-z1",
+				"job":    "hm9000_z1",
+				"index":  2,
+				"node":   "node-a",
+			}}))
+			for _, metric := range context.Metrics {
+				Ω(metric.Tags).Should(HaveKeyWithValue("origin", "hm9000-z1"))
+			}
+		})
+	})
+
 	Describe("app metrics", func() {
 		It("should have a name", func() {
 			context := metricsServer.Emit()
@@ -368,9 +441,58 @@ var _ = Describe("Metrics Server", func() {
 					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredAppsPendingStaging", Value: 0}))
 				})
 			})
+
+			Context("when counting from the app summaries", func() {
+				BeforeEach(func() {
+					conf, _ := config.DefaultConfig()
+					conf.MetricsServerUseAppSummaries = true
+					metricsServer = New(nil, nil, metricsAccountant, fakelogger.NewFakeLogger(), store, timeProvider, conf)
+
+					store.SyncDesiredState(a.DesiredState(3))
+					store.SyncHeartbeats(a.Heartbeat(3))
+					store.SyncAppSummaries(models.AppSummary{
+						AppGuid:          a.AppGuid,
+						AppVersion:       a.AppVersion,
+						State:            models.AppStateStarted,
+						PackageState:     models.AppPackageStateStaged,
+						DesiredInstances: 3,
+						RunningInstances: 2,
+						MissingIndices:   1,
+					})
+					store.BumpAppSummariesFreshness(timeProvider.Time())
+				})
+
+				It("should have the summaries' stats", func() {
+					context := metricsServer.Emit()
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfAppsWithAllInstancesReporting", Value: 0}))
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfAppsWithMissingInstances", Value: 1}))
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfRunningInstances", Value: 2}))
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfMissingIndices", Value: 1}))
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredApps", Value: 1}))
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredInstances", Value: 3}))
+				})
+
+				It("should emit -1 when the summaries are not fresh", func() {
+					storeAdapter.Delete("/hm/v1/app-summaries-fresh")
+					context := metricsServer.Emit()
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfRunningInstances", Value: -1}))
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfDesiredApps", Value: -1}))
+				})
+
+				It("should emit -1 when the summaries fail to load", func() {
+					storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("summaries", errors.New("oops"))
+					context := metricsServer.Emit()
+					Ω(context.Metrics).Should(ContainElement(instrumentation.Metric{Name: "NumberOfRunningInstances", Value: -1}))
+				})
+			})
 		})
 	})
 	It("should tell its health", func() {
 		Ω(metricsServer.Ok()).Should(BeTrue())
 	})
+
+	It("neither serves nor registers its metrics when metrics_disabled is set", func() {
+		conf.MetricsDisabled = true
+		Ω(metricsServer.Start()).Should(Succeed())
+	})
 })
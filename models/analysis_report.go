@@ -0,0 +1,33 @@
+package models
+
+import "encoding/json"
+
+// AnalysisReport is what the analyzer's latest run cost, in store requests,
+// apps, time and memory, and what it found to do.  Tracked over time, the
+// costs show the analyzer growing slower well before a run exceeds the
+// analyzer timeout.
+type AnalysisReport struct {
+	GeneratedAt            int64 `json:"generated_at"`
+	StoreReads             int   `json:"store_reads"`
+	StoreWrites            int   `json:"store_writes"`
+	AppsScanned            int   `json:"apps_scanned"`
+	DurationInMilliseconds int64 `json:"duration_in_milliseconds"`
+	Allocations            int64 `json:"allocations"`
+	AllocatedBytes         int64 `json:"allocated_bytes"`
+	StartMessages          int   `json:"start_messages"`
+	StopMessages           int   `json:"stop_messages"`
+}
+
+func NewAnalysisReportFromJSON(encoded []byte) (AnalysisReport, error) {
+	report := AnalysisReport{}
+	err := json.Unmarshal(encoded, &report)
+	if err != nil {
+		return AnalysisReport{}, err
+	}
+	return report, nil
+}
+
+func (report AnalysisReport) ToJSON() []byte {
+	result, _ := CanonicalJSON(report)
+	return result
+}
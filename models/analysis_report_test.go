@@ -0,0 +1,53 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AnalysisReport", func() {
+	var report AnalysisReport
+
+	BeforeEach(func() {
+		report = AnalysisReport{
+			GeneratedAt:            172,
+			StoreReads:             12,
+			StoreWrites:            3,
+			AppsScanned:            40,
+			DurationInMilliseconds: 250,
+			Allocations:            1000,
+			AllocatedBytes:         65536,
+			StartMessages:          2,
+		}
+	})
+
+	Describe("ToJSON", func() {
+		It("should have the right fields", func() {
+			json := string(report.ToJSON())
+			Ω(json).Should(ContainSubstring(`"generated_at":172`))
+			Ω(json).Should(ContainSubstring(`"store_reads":12`))
+			Ω(json).Should(ContainSubstring(`"store_writes":3`))
+			Ω(json).Should(ContainSubstring(`"apps_scanned":40`))
+			Ω(json).Should(ContainSubstring(`"duration_in_milliseconds":250`))
+			Ω(json).Should(ContainSubstring(`"allocations":1000`))
+			Ω(json).Should(ContainSubstring(`"allocated_bytes":65536`))
+			Ω(json).Should(ContainSubstring(`"start_messages":2`))
+			Ω(json).Should(ContainSubstring(`"stop_messages":0`))
+		})
+	})
+
+	Describe("NewAnalysisReportFromJSON", func() {
+		It("should create the right report", func() {
+			decoded, err := NewAnalysisReportFromJSON(report.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(report))
+		})
+
+		It("should error when passed invalid json", func() {
+			decoded, err := NewAnalysisReportFromJSON([]byte("∂"))
+			Ω(decoded).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -1,8 +1,8 @@
 package models
 
 import (
-	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
@@ -15,6 +15,9 @@ type App struct {
 	InstanceHeartbeats []InstanceHeartbeat
 	CrashCounts        map[int]CrashCount
 
+	// CrashReasons, in index order, are only filled in by the store's GetApp.
+	CrashReasons []CrashReason
+
 	instanceHeartbeatsByIndex map[int][]InstanceHeartbeat
 }
 
@@ -34,11 +37,15 @@ func (a *App) MarshalJSON() ([]byte, error) {
 }
 
 func (a *App) ToJSON() []byte {
-	crashCounts := make([]CrashCount, len(a.CrashCounts))
-	i := 0
-	for _, crashCount := range a.CrashCounts {
-		crashCounts[i] = crashCount
-		i++
+	indices := []int{}
+	for index := range a.CrashCounts {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	crashCounts := make([]CrashCount, len(indices))
+	for i, index := range indices {
+		crashCounts[i] = a.CrashCounts[index]
 	}
 
 	appForJson := struct {
@@ -48,15 +55,17 @@ func (a *App) ToJSON() []byte {
 		Desired            DesiredAppState     `json:"desired"`
 		InstanceHeartbeats []InstanceHeartbeat `json:"instance_heartbeats"`
 		CrashCounts        []CrashCount        `json:"crash_counts"`
+		CrashReasons       []CrashReason       `json:"crash_reasons,omitempty"`
 	}{
 		a.AppGuid,
 		a.AppVersion,
 		a.Desired,
 		a.InstanceHeartbeats,
 		crashCounts,
+		a.CrashReasons,
 	}
 
-	result, _ := json.Marshal(appForJson)
+	result, _ := CanonicalJSON(appForJson)
 	return result
 }
 
@@ -95,6 +104,12 @@ func (a *App) IsDesired() bool {
 	return a.Desired.AppGuid != ""
 }
 
+// IsUnmanaged is whether the app matched the fetcher_exclusions, and is
+// supervised by something other than hm9000.
+func (a *App) IsUnmanaged() bool {
+	return a.Desired.Unmanaged
+}
+
 func (a *App) NumberOfDesiredInstances() int {
 	return a.Desired.NumberOfInstances
 }
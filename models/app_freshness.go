@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AppFreshness is, with per_app_freshness set, when the listener last heard
+// of an app: the last heartbeat to carry any of its instances, and, by
+// index, the last to carry a starting or running instance at the index and
+// the DEA that sent it.  0 is an index never heard of.
+type AppFreshness struct {
+	AppGuid     string   `json:"droplet"`
+	AppVersion  string   `json:"version"`
+	LastSeen    int64    `json:"last_seen"`
+	IndicesSeen []int64  `json:"indices_seen"`
+	IndexDeas   []string `json:"index_deas"`
+}
+
+func NewAppFreshness(appGuid string, appVersion string) AppFreshness {
+	return AppFreshness{
+		AppGuid:     appGuid,
+		AppVersion:  appVersion,
+		IndicesSeen: []int64{},
+		IndexDeas:   []string{},
+	}
+}
+
+// Seen returns the freshness of the app after instanceHeartbeat was heard
+// of at now.
+func (freshness AppFreshness) Seen(instanceHeartbeat InstanceHeartbeat, now time.Time) AppFreshness {
+	seen := freshness
+	seen.LastSeen = now.Unix()
+	if !instanceHeartbeat.IsStartingOrRunning() || instanceHeartbeat.InstanceIndex < 0 {
+		return seen
+	}
+
+	seen.IndicesSeen = make([]int64, len(freshness.IndicesSeen))
+	copy(seen.IndicesSeen, freshness.IndicesSeen)
+	for len(seen.IndicesSeen) <= instanceHeartbeat.InstanceIndex {
+		seen.IndicesSeen = append(seen.IndicesSeen, 0)
+	}
+	seen.IndicesSeen[instanceHeartbeat.InstanceIndex] = now.Unix()
+
+	seen.IndexDeas = make([]string, len(seen.IndicesSeen))
+	copy(seen.IndexDeas, freshness.IndexDeas)
+	seen.IndexDeas[instanceHeartbeat.InstanceIndex] = instanceHeartbeat.DeaGuid
+	return seen
+}
+
+// IndexSeenAt is when a starting or running instance at index was last
+// heard of, or the zero time.
+func (freshness AppFreshness) IndexSeenAt(index int) time.Time {
+	if index < 0 || index >= len(freshness.IndicesSeen) || freshness.IndicesSeen[index] == 0 {
+		return time.Time{}
+	}
+	return time.Unix(freshness.IndicesSeen[index], 0)
+}
+
+// IndexDea is the DEA that last reported a starting or running instance at
+// index, or "".
+func (freshness AppFreshness) IndexDea(index int) string {
+	if index < 0 || index >= len(freshness.IndexDeas) {
+		return ""
+	}
+	return freshness.IndexDeas[index]
+}
+
+// IsIndexReported is true when a starting or running instance at index was
+// heard of within recent of now, from a DEA that is still among presentDeas.
+// Once the DEA's presence lapses the index is no longer reported, however
+// recently it was heard of.
+func (freshness AppFreshness) IsIndexReported(index int, presentDeas map[string]bool, now time.Time, recent time.Duration) bool {
+	seenAt := freshness.IndexSeenAt(index)
+	return !seenAt.IsZero() && now.Sub(seenAt) < recent && presentDeas[freshness.IndexDea(index)]
+}
+
+func NewAppFreshnessFromJSON(encoded []byte) (AppFreshness, error) {
+	freshness := AppFreshness{}
+	err := json.Unmarshal(encoded, &freshness)
+	if err != nil {
+		return AppFreshness{}, err
+	}
+	return freshness, nil
+}
+
+func (freshness AppFreshness) ToJSON() []byte {
+	result, _ := CanonicalJSON(freshness)
+	return result
+}
+
+func (freshness AppFreshness) StoreKey() string {
+	return freshness.AppGuid + "," + freshness.AppVersion
+}
@@ -0,0 +1,59 @@
+package models_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppFreshness", func() {
+	var freshness AppFreshness
+
+	BeforeEach(func() {
+		freshness = NewAppFreshness("app", "v")
+		freshness = freshness.Seen(InstanceHeartbeat{AppGuid: "app", AppVersion: "v", InstanceIndex: 2, State: InstanceStateRunning, DeaGuid: "dea-a"}, time.Unix(100, 0))
+		freshness = freshness.Seen(InstanceHeartbeat{AppGuid: "app", AppVersion: "v", InstanceIndex: 0, State: InstanceStateCrashed, DeaGuid: "dea-b"}, time.Unix(110, 0))
+	})
+
+	It("should record when each index was last seen starting or running", func() {
+		Ω(freshness.LastSeen).Should(BeNumerically("==", 110))
+		Ω(freshness.IndicesSeen).Should(Equal([]int64{0, 0, 100}))
+		Ω(freshness.IndexDeas).Should(Equal([]string{"", "", "dea-a"}))
+		Ω(freshness.IndexSeenAt(2)).Should(Equal(time.Unix(100, 0)))
+		Ω(freshness.IndexDea(2)).Should(Equal("dea-a"))
+		Ω(freshness.IndexDea(0)).Should(BeEmpty())
+		Ω(freshness.IndexDea(5)).Should(BeEmpty())
+		Ω(freshness.IndexSeenAt(0).IsZero()).Should(BeTrue())
+		Ω(freshness.IndexSeenAt(5).IsZero()).Should(BeTrue())
+		Ω(freshness.StoreKey()).Should(Equal("app,v"))
+	})
+
+	It("should not change the freshness it was seen from", func() {
+		later := freshness.Seen(InstanceHeartbeat{AppGuid: "app", AppVersion: "v", InstanceIndex: 2, State: InstanceStateRunning, DeaGuid: "dea-c"}, time.Unix(120, 0))
+		Ω(later.IndicesSeen).Should(Equal([]int64{0, 0, 120}))
+		Ω(later.IndexDeas).Should(Equal([]string{"", "", "dea-c"}))
+		Ω(freshness.IndicesSeen).Should(Equal([]int64{0, 0, 100}))
+		Ω(freshness.IndexDeas).Should(Equal([]string{"", "", "dea-a"}))
+	})
+
+	It("should know whether an index is still reported by a present DEA", func() {
+		present := map[string]bool{"dea-a": true, "dea-b": true}
+		Ω(freshness.IsIndexReported(2, present, time.Unix(119, 0), 20*time.Second)).Should(BeTrue())
+		Ω(freshness.IsIndexReported(2, present, time.Unix(120, 0), 20*time.Second)).Should(BeFalse())
+		Ω(freshness.IsIndexReported(2, map[string]bool{"dea-b": true}, time.Unix(119, 0), 20*time.Second)).Should(BeFalse())
+		Ω(freshness.IsIndexReported(0, present, time.Unix(110, 0), 20*time.Second)).Should(BeFalse())
+	})
+
+	It("should round trip through JSON", func() {
+		decoded, err := NewAppFreshnessFromJSON(freshness.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(freshness))
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewAppFreshnessFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+})
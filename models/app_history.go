@@ -0,0 +1,132 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+type AppEventType string
+
+const (
+	AppEventStartSent        AppEventType = "start_sent"
+	AppEventStopSent         AppEventType = "stop_sent"
+	AppEventCrashObserved    AppEventType = "crash_observed"
+	AppEventAnalyzerDecision AppEventType = "analyzer_decision"
+)
+
+// AppEvent is something hm9000 did to an app, or saw happen to it, at
+// Timestamp.  Description is a decision, in the words the analyzer logs it
+// with; Details identify the instance and say why.
+type AppEvent struct {
+	Type        AppEventType      `json:"type"`
+	Timestamp   int64             `json:"timestamp"`
+	AppGuid     string            `json:"droplet"`
+	AppVersion  string            `json:"version"`
+	Description string            `json:"description,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// NewStartSentEvent records a start message sent at now.
+func NewStartSentEvent(start PendingStartMessage, now time.Time) AppEvent {
+	return AppEvent{
+		Type:       AppEventStartSent,
+		Timestamp:  now.Unix(),
+		AppGuid:    start.AppGuid,
+		AppVersion: start.AppVersion,
+		Details: map[string]string{
+			"index":      strconv.Itoa(start.IndexToStart),
+			"reason":     string(start.StartReason),
+			"message_id": start.MessageId,
+		},
+	}
+}
+
+// NewStopSentEvent records a stop message sent at now, as the sender
+// categorized it.
+func NewStopSentEvent(stop PendingStopMessage, category StopCategory, now time.Time) AppEvent {
+	return AppEvent{
+		Type:       AppEventStopSent,
+		Timestamp:  now.Unix(),
+		AppGuid:    stop.AppGuid,
+		AppVersion: stop.AppVersion,
+		Details: map[string]string{
+			"instance":     stop.InstanceGuid,
+			"reason":       string(stop.StopReason),
+			"message_id":   stop.MessageId,
+			"category":     string(category),
+			"initiated_by": string(category.Initiator()),
+		},
+	}
+}
+
+// NewCrashObservedEvent records a crash the analyzer counted at now.
+func NewCrashObservedEvent(crashCount CrashCount, now time.Time) AppEvent {
+	return AppEvent{
+		Type:       AppEventCrashObserved,
+		Timestamp:  now.Unix(),
+		AppGuid:    crashCount.AppGuid,
+		AppVersion: crashCount.AppVersion,
+		Details: map[string]string{
+			"index":       strconv.Itoa(crashCount.InstanceIndex),
+			"crash_count": strconv.Itoa(crashCount.CrashCount),
+		},
+	}
+}
+
+// AppHistory lists the events of an app, across its versions, oldest first.
+type AppHistory struct {
+	AppGuid string     `json:"droplet"`
+	Events  []AppEvent `json:"events"`
+}
+
+func NewAppHistoryFromJSON(encoded []byte) (AppHistory, error) {
+	history := AppHistory{}
+	err := json.Unmarshal(encoded, &history)
+	if err != nil {
+		return AppHistory{}, err
+	}
+	return history, nil
+}
+
+func (history AppHistory) ToJSON() []byte {
+	result, _ := CanonicalJSON(history)
+	return result
+}
+
+func (history AppHistory) StoreKey() string {
+	return history.AppGuid
+}
+
+// Append adds events to the history and then keeps only the newest
+// maxEvents of those since cutoff.
+func (history AppHistory) Append(cutoff time.Time, maxEvents int, events ...AppEvent) AppHistory {
+	kept := []AppEvent{}
+	for _, event := range append(history.Events, events...) {
+		if event.Timestamp >= cutoff.Unix() {
+			kept = append(kept, event)
+		}
+	}
+	if len(kept) > maxEvents {
+		kept = kept[len(kept)-maxEvents:]
+	}
+	history.Events = kept
+	return history
+}
+
+// Between returns the events from since to until, inclusive, newest first.
+// A zero since or until leaves that end open.
+func (history AppHistory) Between(since int64, until int64) []AppEvent {
+	events := []AppEvent{}
+	for i := len(history.Events) - 1; i >= 0; i-- {
+		event := history.Events[i]
+		if since != 0 && event.Timestamp < since {
+			continue
+		}
+		if until != 0 && event.Timestamp > until {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
@@ -0,0 +1,106 @@
+package models_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppHistory", func() {
+	var history AppHistory
+
+	event := func(timestamp int64) AppEvent {
+		return AppEvent{Type: AppEventCrashObserved, Timestamp: timestamp, AppGuid: "app", AppVersion: "version"}
+	}
+
+	BeforeEach(func() {
+		history = AppHistory{
+			AppGuid: "app",
+			Events:  []AppEvent{event(100), event(200), event(300)},
+		}
+	})
+
+	It("should round trip through JSON", func() {
+		history.Events[0].Details = map[string]string{"index": "1"}
+		decoded, err := NewAppHistoryFromJSON(history.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(history))
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewAppHistoryFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should be keyed by app guid", func() {
+		Ω(history.StoreKey()).Should(Equal("app"))
+	})
+
+	Describe("Append", func() {
+		It("should add the events, dropping those before the cutoff", func() {
+			appended := history.Append(time.Unix(150, 0), 10, event(400))
+			Ω(appended.Events).Should(Equal([]AppEvent{event(200), event(300), event(400)}))
+		})
+
+		It("should keep only the newest events", func() {
+			appended := history.Append(time.Unix(0, 0), 2, event(400))
+			Ω(appended.Events).Should(Equal([]AppEvent{event(300), event(400)}))
+		})
+	})
+
+	Describe("Between", func() {
+		It("should return the events in the range, newest first", func() {
+			Ω(history.Between(200, 300)).Should(Equal([]AppEvent{event(300), event(200)}))
+		})
+
+		It("should leave zero ends open", func() {
+			Ω(history.Between(0, 200)).Should(Equal([]AppEvent{event(200), event(100)}))
+			Ω(history.Between(200, 0)).Should(Equal([]AppEvent{event(300), event(200)}))
+		})
+	})
+})
+
+var _ = Describe("AppEvents", func() {
+	now := time.Unix(1000, 0)
+
+	It("should describe a start sent", func() {
+		start := NewPendingStartMessage(now, 0, 0, "app", "version", 2, 1.0, PendingStartMessageReasonCrashed)
+		Ω(NewStartSentEvent(start, now)).Should(Equal(AppEvent{
+			Type:       AppEventStartSent,
+			Timestamp:  1000,
+			AppGuid:    "app",
+			AppVersion: "version",
+			Details:    map[string]string{"index": "2", "reason": "CRASHED", "message_id": start.MessageId},
+		}))
+	})
+
+	It("should describe a stop sent", func() {
+		stop := NewPendingStopMessage(now, 0, 0, "app", "version", "instance", PendingStopMessageReasonExtra)
+		Ω(NewStopSentEvent(stop, StopCategoryScaleDown, now)).Should(Equal(AppEvent{
+			Type:       AppEventStopSent,
+			Timestamp:  1000,
+			AppGuid:    "app",
+			AppVersion: "version",
+			Details: map[string]string{
+				"instance":     "instance",
+				"reason":       "EXTRA",
+				"message_id":   stop.MessageId,
+				"category":     "SCALE_DOWN",
+				"initiated_by": "cc",
+			},
+		}))
+	})
+
+	It("should describe a crash observed", func() {
+		crashCount := CrashCount{AppGuid: "app", AppVersion: "version", InstanceIndex: 1, CrashCount: 3}
+		Ω(NewCrashObservedEvent(crashCount, now)).Should(Equal(AppEvent{
+			Type:       AppEventCrashObserved,
+			Timestamp:  1000,
+			AppGuid:    "app",
+			AppVersion: "version",
+			Details:    map[string]string{"index": "1", "crash_count": "3"},
+		}))
+	})
+})
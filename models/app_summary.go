@@ -0,0 +1,98 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// AppSummary is what the aggregator keeps of an app's health, so that the
+// API and the metrics server can read one small key per app rather than
+// every instance heartbeat.  State and PackageState are the desired state's,
+// and empty when the app is not desired.
+type AppSummary struct {
+	AppGuid      string          `json:"droplet"`
+	AppVersion   string          `json:"version"`
+	State        AppState        `json:"state"`
+	PackageState AppPackageState `json:"package_state"`
+
+	DesiredInstances int `json:"desired_instances"`
+	RunningInstances int `json:"running_instances"`
+	CrashedInstances int `json:"crashed_instances"`
+
+	// MissingIndices are the desired indices with no heartbeat, and
+	// CrashedIndices the indices with a crashed instance and none starting or
+	// running.
+	MissingIndices int `json:"missing_indices"`
+	CrashedIndices int `json:"crashed_indices"`
+}
+
+// NewAppSummary summarizes app.  RunningInstances counts the instances that
+// are starting as well as those running.
+func NewAppSummary(app *App) AppSummary {
+	summary := AppSummary{
+		AppGuid:          app.AppGuid,
+		AppVersion:       app.AppVersion,
+		RunningInstances: app.NumberOfStartingOrRunningInstances(),
+		CrashedInstances: app.NumberOfCrashedInstances(),
+		CrashedIndices:   app.NumberOfCrashedIndices(),
+	}
+
+	if app.IsDesired() {
+		summary.State = app.Desired.State
+		summary.PackageState = app.Desired.PackageState
+		summary.DesiredInstances = app.NumberOfDesiredInstances()
+		summary.MissingIndices = app.NumberOfDesiredInstances() - app.NumberOfDesiredIndicesReporting()
+	}
+
+	return summary
+}
+
+func NewAppSummaryFromJSON(encoded []byte) (AppSummary, error) {
+	summary := AppSummary{}
+	err := json.Unmarshal(encoded, &summary)
+	if err != nil {
+		return AppSummary{}, err
+	}
+	return summary, nil
+}
+
+// IsDesired is true when the app is in the desired state, as App.IsDesired.
+func (summary AppSummary) IsDesired() bool {
+	return summary.State != AppStateInvalid
+}
+
+// HasInstances is true when the app has any starting, running or crashed
+// instances.
+func (summary AppSummary) HasInstances() bool {
+	return summary.RunningInstances > 0 || summary.CrashedInstances > 0
+}
+
+// IsSummaryOfDesiredState is true when the summary was made with desired,
+// as far as it keeps it.
+func (summary AppSummary) IsSummaryOfDesiredState(desired DesiredAppState) bool {
+	return summary.State == desired.State && summary.PackageState == desired.PackageState && summary.DesiredInstances == desired.NumberOfInstances
+}
+
+// WithInstanceHeartbeats summarizes the app again with instanceHeartbeats,
+// keeping the desired state the summary was made with.
+func (summary AppSummary) WithInstanceHeartbeats(instanceHeartbeats []InstanceHeartbeat) AppSummary {
+	desired := DesiredAppState{}
+	if summary.IsDesired() {
+		desired = DesiredAppState{
+			AppGuid:           summary.AppGuid,
+			AppVersion:        summary.AppVersion,
+			NumberOfInstances: summary.DesiredInstances,
+			State:             summary.State,
+			PackageState:      summary.PackageState,
+		}
+	}
+	return NewAppSummary(NewApp(summary.AppGuid, summary.AppVersion, desired, instanceHeartbeats, map[int]CrashCount{}))
+}
+
+func (summary AppSummary) ToJSON() []byte {
+	result, _ := CanonicalJSON(summary)
+	return result
+}
+
+func (summary AppSummary) StoreKey() string {
+	return summary.AppGuid + "," + summary.AppVersion
+}
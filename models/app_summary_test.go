@@ -0,0 +1,84 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppSummary", func() {
+	var fixture appfixture.AppFixture
+
+	BeforeEach(func() {
+		fixture = appfixture.NewAppFixture()
+	})
+
+	It("should count the instances of a desired app", func() {
+		crashed := fixture.CrashedInstanceHeartbeatAtIndex(2)
+		app := NewApp(fixture.AppGuid, fixture.AppVersion, fixture.DesiredState(4), []InstanceHeartbeat{
+			fixture.InstanceAtIndex(0).Heartbeat(),
+			fixture.InstanceAtIndex(1).Heartbeat(),
+			crashed,
+		}, map[int]CrashCount{})
+
+		Ω(NewAppSummary(app)).Should(Equal(AppSummary{
+			AppGuid:          fixture.AppGuid,
+			AppVersion:       fixture.AppVersion,
+			State:            AppStateStarted,
+			PackageState:     AppPackageStateStaged,
+			DesiredInstances: 4,
+			RunningInstances: 2,
+			CrashedInstances: 1,
+			MissingIndices:   1,
+			CrashedIndices:   1,
+		}))
+		Ω(NewAppSummary(app).IsDesired()).Should(BeTrue())
+	})
+
+	It("should count the running instances of an app that is not desired", func() {
+		app := NewApp(fixture.AppGuid, fixture.AppVersion, DesiredAppState{}, []InstanceHeartbeat{
+			fixture.InstanceAtIndex(0).Heartbeat(),
+		}, map[int]CrashCount{})
+
+		summary := NewAppSummary(app)
+		Ω(summary.IsDesired()).Should(BeFalse())
+		Ω(summary.DesiredInstances).Should(BeZero())
+		Ω(summary.MissingIndices).Should(BeZero())
+		Ω(summary.RunningInstances).Should(Equal(1))
+	})
+
+	It("should summarize the app again with new instance heartbeats, keeping the desired state", func() {
+		app := NewApp(fixture.AppGuid, fixture.AppVersion, fixture.DesiredState(2), []InstanceHeartbeat{}, map[int]CrashCount{})
+		summary := NewAppSummary(app)
+		Ω(summary.HasInstances()).Should(BeFalse())
+		Ω(summary.IsSummaryOfDesiredState(fixture.DesiredState(2))).Should(BeTrue())
+		Ω(summary.IsSummaryOfDesiredState(fixture.DesiredState(3))).Should(BeFalse())
+
+		resummarized := summary.WithInstanceHeartbeats([]InstanceHeartbeat{fixture.InstanceAtIndex(1).Heartbeat()})
+		Ω(resummarized).Should(Equal(NewAppSummary(NewApp(fixture.AppGuid, fixture.AppVersion, fixture.DesiredState(2), []InstanceHeartbeat{
+			fixture.InstanceAtIndex(1).Heartbeat(),
+		}, map[int]CrashCount{}))))
+		Ω(resummarized.HasInstances()).Should(BeTrue())
+
+		undesired := AppSummary{AppGuid: fixture.AppGuid, AppVersion: fixture.AppVersion}.WithInstanceHeartbeats([]InstanceHeartbeat{fixture.InstanceAtIndex(1).Heartbeat()})
+		Ω(undesired.IsDesired()).Should(BeFalse())
+		Ω(undesired.RunningInstances).Should(Equal(1))
+	})
+
+	It("should be keyed by app", func() {
+		Ω(AppSummary{AppGuid: "app", AppVersion: "v"}.StoreKey()).Should(Equal("app,v"))
+	})
+
+	It("should round trip through JSON", func() {
+		summary := AppSummary{AppGuid: "app", AppVersion: "v", State: AppStateStarted, DesiredInstances: 3, RunningInstances: 2, MissingIndices: 1}
+		decoded, err := NewAppSummaryFromJSON(summary.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(summary))
+	})
+
+	It("should fail to decode garbage", func() {
+		_, err := NewAppSummaryFromJSON([]byte("{"))
+		Ω(err).Should(HaveOccurred())
+	})
+})
@@ -137,6 +137,15 @@ var _ = Describe("App", func() {
 		})
 	})
 
+	Describe("IsUnmanaged", func() {
+		It("should be unmanaged only if the desired state is", func() {
+			desired = fixture.DesiredState(1)
+			Ω(app().IsUnmanaged()).Should(BeFalse())
+			desired.Unmanaged = true
+			Ω(app().IsUnmanaged()).Should(BeTrue())
+		})
+	})
+
 	Describe("NumberOfDesiredInstances", func() {
 		It("should return the number in the desired state", func() {
 			Ω(app().NumberOfDesiredInstances()).Should(Equal(0))
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// StartOutcome is what came of a start hm9000 sent.
+type StartOutcome string
+
+const (
+	// StartOutcomeSucceeded is a start followed by a new RUNNING instance
+	// at its index.
+	StartOutcomeSucceeded StartOutcome = "succeeded"
+
+	// StartOutcomeCrashed is a start followed by a new instance at its
+	// index that crashed before it was seen running.
+	StartOutcomeCrashed StartOutcome = "crashed"
+
+	// StartOutcomeTimedOut is a start followed by neither within the start
+	// effectiveness window.
+	StartOutcomeTimedOut StartOutcome = "timed_out"
+)
+
+// An AwaitedStart is a start hm9000 sent and has not yet seen come of
+// anything.  It remembers the instances at the start's index when it was
+// sent, so that they are not mistaken for the instance it started.
+type AwaitedStart struct {
+	AppGuid       string   `json:"droplet"`
+	AppVersion    string   `json:"version"`
+	IndexToStart  int      `json:"index"`
+	SentAt        int64    `json:"sent_at"`
+	InstanceGuids []string `json:"instance_guids"`
+}
+
+// NewAwaitedStart awaits startMessage, sent at now to app.  app may be nil
+// if hm9000 does not know the app.
+func NewAwaitedStart(startMessage PendingStartMessage, app *App, now time.Time) AwaitedStart {
+	start := AwaitedStart{
+		AppGuid:       startMessage.AppGuid,
+		AppVersion:    startMessage.AppVersion,
+		IndexToStart:  startMessage.IndexToStart,
+		SentAt:        now.Unix(),
+		InstanceGuids: []string{},
+	}
+	if app != nil {
+		for _, heartbeat := range app.InstanceHeartbeatsAtIndex(startMessage.IndexToStart) {
+			start.InstanceGuids = append(start.InstanceGuids, heartbeat.InstanceGuid)
+		}
+	}
+	return start
+}
+
+func NewAwaitedStartFromJSON(encoded []byte) (AwaitedStart, error) {
+	start := AwaitedStart{}
+	err := json.Unmarshal(encoded, &start)
+	if err != nil {
+		return AwaitedStart{}, err
+	}
+	return start, nil
+}
+
+func (start AwaitedStart) ToJSON() []byte {
+	result, _ := CanonicalJSON(start)
+	return result
+}
+
+func (start AwaitedStart) StoreKey() string {
+	return start.AppGuid + "," + start.AppVersion + "," + strconv.Itoa(start.IndexToStart)
+}
+
+// Outcome returns what came of the start, as of now, given the app's
+// heartbeats, and false if it is still too early to say.  A new RUNNING
+// instance at the start's index wins over a new crashed one, since the DEA
+// got as far as running the app.
+func (start AwaitedStart) Outcome(app *App, now time.Time, window time.Duration) (StartOutcome, bool) {
+	crashed := false
+	for _, heartbeat := range app.InstanceHeartbeatsAtIndex(start.IndexToStart) {
+		if start.knows(heartbeat.InstanceGuid) {
+			continue
+		}
+		if heartbeat.IsRunning() {
+			return StartOutcomeSucceeded, true
+		}
+		if heartbeat.IsCrashed() {
+			crashed = true
+		}
+	}
+	if crashed {
+		return StartOutcomeCrashed, true
+	}
+
+	if now.Sub(time.Unix(start.SentAt, 0)) >= window {
+		return StartOutcomeTimedOut, true
+	}
+	return "", false
+}
+
+func (start AwaitedStart) knows(instanceGuid string) bool {
+	for _, known := range start.InstanceGuids {
+		if known == instanceGuid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package models_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AwaitedStart", func() {
+	var (
+		fixture appfixture.AppFixture
+		sentAt  time.Time
+		window  time.Duration
+	)
+
+	BeforeEach(func() {
+		fixture = appfixture.NewAppFixture()
+		sentAt = time.Unix(100, 0)
+		window = 30 * time.Second
+	})
+
+	app := func(heartbeats ...InstanceHeartbeat) *App {
+		return NewApp(fixture.AppGuid, fixture.AppVersion, fixture.DesiredState(1), heartbeats, map[int]CrashCount{})
+	}
+
+	awaitedStart := func(heartbeats ...InstanceHeartbeat) AwaitedStart {
+		startMessage := NewPendingStartMessage(sentAt, 0, 0, fixture.AppGuid, fixture.AppVersion, 0, 1.0, PendingStartMessageReasonCrashed)
+		return NewAwaitedStart(startMessage, app(heartbeats...), sentAt)
+	}
+
+	It("should remember the instances at its index when it was sent", func() {
+		crashed := fixture.CrashedInstanceHeartbeatAtIndex(0)
+		start := awaitedStart(crashed, fixture.InstanceAtIndex(1).Heartbeat())
+		Ω(start.InstanceGuids).Should(Equal([]string{crashed.InstanceGuid}))
+		Ω(start.SentAt).Should(BeNumerically("==", 100))
+	})
+
+	It("should be keyed by app and index", func() {
+		Ω(awaitedStart().StoreKey()).Should(Equal(fixture.AppGuid + "," + fixture.AppVersion + ",0"))
+	})
+
+	It("should round trip through JSON", func() {
+		start := awaitedStart(fixture.CrashedInstanceHeartbeatAtIndex(0))
+		decoded, err := NewAwaitedStartFromJSON(start.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(start))
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewAwaitedStartFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+
+	Describe("Outcome", func() {
+		var start AwaitedStart
+		var oldCrash InstanceHeartbeat
+
+		BeforeEach(func() {
+			oldCrash = fixture.CrashedInstanceHeartbeatAtIndex(0)
+			start = awaitedStart(oldCrash)
+		})
+
+		It("should succeed once a new instance is running at the index", func() {
+			outcome, known := start.Outcome(app(oldCrash, fixture.InstanceAtIndex(0).Heartbeat()), sentAt.Add(time.Second), window)
+			Ω(known).Should(BeTrue())
+			Ω(outcome).Should(Equal(StartOutcomeSucceeded))
+		})
+
+		It("should have crashed once a new instance has crashed at the index", func() {
+			outcome, known := start.Outcome(app(oldCrash, fixture.CrashedInstanceHeartbeatAtIndex(0)), sentAt.Add(time.Second), window)
+			Ω(known).Should(BeTrue())
+			Ω(outcome).Should(Equal(StartOutcomeCrashed))
+		})
+
+		It("should not mistake the instances it knew of for new ones", func() {
+			_, known := start.Outcome(app(oldCrash), sentAt.Add(time.Second), window)
+			Ω(known).Should(BeFalse())
+		})
+
+		It("should not count an instance that is still starting", func() {
+			starting := fixture.InstanceAtIndex(0).Heartbeat()
+			starting.State = InstanceStateStarting
+			_, known := start.Outcome(app(oldCrash, starting), sentAt.Add(time.Second), window)
+			Ω(known).Should(BeFalse())
+		})
+
+		It("should time out once the window has passed", func() {
+			outcome, known := start.Outcome(app(oldCrash), sentAt.Add(window), window)
+			Ω(known).Should(BeTrue())
+			Ω(outcome).Should(Equal(StartOutcomeTimedOut))
+		})
+	})
+})
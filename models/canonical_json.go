@@ -0,0 +1,35 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// CanonicalJSON encodes value as JSON in a canonical form: object members
+// sorted by name, at every depth, and no insignificant whitespace.  Numbers
+// are written as encoding/json first wrote them, so none lose precision.
+// Equal models always encode to the same bytes, whichever version of
+// hm9000 encodes them, so encodings can be compared, hashed and diffed.
+// Every model's ToJSON is canonical.
+func CanonicalJSON(value interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalize(encoded)
+}
+
+// canonicalize rewrites the JSON encoded in canonical form.  encoding/json
+// sorts the members of maps, so decoding into generic values and encoding
+// them again is enough.
+func canonicalize(encoded []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var generic interface{}
+	err := decoder.Decode(&generic)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
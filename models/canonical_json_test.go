@@ -0,0 +1,358 @@
+package models_test
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"strings"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const roundTrips = 200
+
+var awkwardRunes = []rune{'a', 'Z', '0', ' ', ',', '"', '\\', '/', '<', '>', '&', '\n', '\t', '\x00', 'é', '世', ' ', '😀'}
+
+// randomize fills the value v points to with random contents, the way a
+// DEA, CC or another hm9000 might.
+func randomize(r *rand.Rand, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		runes := make([]rune, r.Intn(8))
+		for i := range runes {
+			runes[i] = awkwardRunes[r.Intn(len(awkwardRunes))]
+		}
+		v.SetString(string(runes))
+	case reflect.Bool:
+		v.SetBool(r.Intn(2) == 0)
+	case reflect.Int, reflect.Int64:
+		v.SetInt(r.Int63() - r.Int63())
+	case reflect.Uint64:
+		v.SetUint(uint64(r.Int63()) << uint(r.Intn(2)))
+	case reflect.Float64:
+		v.SetFloat(r.NormFloat64() * float64(r.Int63n(1<<40)))
+	case reflect.Ptr:
+		if r.Intn(2) == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		randomize(r, v.Elem())
+	case reflect.Map:
+		if r.Intn(2) == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		v.Set(reflect.MakeMap(v.Type()))
+		for i := r.Intn(3); i >= 0; i-- {
+			key := reflect.New(v.Type().Key()).Elem()
+			randomize(r, key)
+			value := reflect.New(v.Type().Elem()).Elem()
+			randomize(r, value)
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), r.Intn(4), r.Intn(4)+4))
+		for i := 0; i < v.Len(); i++ {
+			randomize(r, v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" || v.Type().Field(i).Type == reflect.TypeOf(map[string]json.RawMessage{}) {
+				continue
+			}
+			randomize(r, v.Field(i))
+		}
+	default:
+		Fail("randomize cannot fill a " + v.Type().String())
+	}
+}
+
+// randomJSON is a random JSON value, nested up to depth deep, in canonical
+// form.
+func randomJSON(r *rand.Rand, depth int) json.RawMessage {
+	var value interface{}
+	switch r.Intn(7) {
+	case 0:
+		value = nil
+	case 1:
+		value = r.Intn(2) == 0
+	case 2:
+		value = r.NormFloat64() * 1e6
+	case 3:
+		s := ""
+		randomize(r, reflect.ValueOf(&s).Elem())
+		value = s
+	case 4:
+		value = r.Int63()
+	case 5:
+		if depth > 0 {
+			array := []json.RawMessage{}
+			for i := r.Intn(3); i > 0; i-- {
+				array = append(array, randomJSON(r, depth-1))
+			}
+			value = array
+		}
+	case 6:
+		if depth > 0 {
+			value = randomExtra(r, depth-1, nil)
+		}
+	}
+	encoded, err := CanonicalJSON(value)
+	Ω(err).ShouldNot(HaveOccurred())
+	return json.RawMessage(encoded)
+}
+
+// randomExtra are random members for an object whose own members are named
+// by known.
+func randomExtra(r *rand.Rand, depth int, known interface{}) map[string]json.RawMessage {
+	names := map[string]bool{}
+	if known != nil {
+		encoded, err := json.Marshal(known)
+		Ω(err).ShouldNot(HaveOccurred())
+		members := map[string]json.RawMessage{}
+		Ω(json.Unmarshal(encoded, &members)).Should(Succeed())
+		for name := range members {
+			names[name] = true
+		}
+		typ := reflect.TypeOf(known)
+		for i := 0; i < typ.NumField(); i++ {
+			names[strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]] = true
+		}
+	}
+
+	extra := map[string]json.RawMessage{}
+	for i := r.Intn(4); i > 0; i-- {
+		name := ""
+		randomize(r, reflect.ValueOf(&name).Elem())
+		if names["x"+name] {
+			continue
+		}
+		extra["x"+name] = randomJSON(r, depth)
+	}
+	if len(extra) == 0 {
+		return nil
+	}
+	return extra
+}
+
+type roundTripper struct {
+	// keepsUnknown is set for models that keep the fields they do not know.
+	keepsUnknown bool
+
+	new    func(r *rand.Rand) interface{}
+	encode func(value interface{}) []byte
+	decode func(encoded []byte) (interface{}, error)
+}
+
+var _ = Describe("Canonical JSON", func() {
+	var r *rand.Rand
+
+	BeforeEach(func() {
+		r = rand.New(rand.NewSource(GinkgoRandomSeed()))
+	})
+
+	randomInstanceHeartbeat := func(r *rand.Rand, extra bool) InstanceHeartbeat {
+		instance := InstanceHeartbeat{}
+		randomize(r, reflect.ValueOf(&instance).Elem())
+		if len(instance.Uris) == 0 {
+			// omitempty: no routes decode as nil
+			instance.Uris = nil
+		}
+		if extra {
+			instance.Extra = randomExtra(r, 2, instance)
+		}
+		return instance
+	}
+
+	models := map[string]roundTripper{
+		"ComponentRun": {
+			new: func(r *rand.Rand) interface{} {
+				run := ComponentRun{}
+				randomize(r, reflect.ValueOf(&run).Elem())
+				return run
+			},
+			encode: func(value interface{}) []byte { return value.(ComponentRun).ToJSON() },
+			decode: func(encoded []byte) (interface{}, error) { return NewComponentRunFromJSON(encoded) },
+		},
+		"CrashCount": {
+			new: func(r *rand.Rand) interface{} {
+				crashCount := CrashCount{}
+				randomize(r, reflect.ValueOf(&crashCount).Elem())
+				return crashCount
+			},
+			encode: func(value interface{}) []byte { return value.(CrashCount).ToJSON() },
+			decode: func(encoded []byte) (interface{}, error) { return NewCrashCountFromJSON(encoded) },
+		},
+		"DesiredAppState": {
+			new: func(r *rand.Rand) interface{} {
+				desired := DesiredAppState{}
+				randomize(r, reflect.ValueOf(&desired).Elem())
+				return desired
+			},
+			encode: func(value interface{}) []byte { return value.(DesiredAppState).ToJSON() },
+			decode: func(encoded []byte) (interface{}, error) { return NewDesiredAppStateFromJSON(encoded) },
+		},
+		"DropletExited": {
+			new: func(r *rand.Rand) interface{} {
+				dropletExited := DropletExited{}
+				randomize(r, reflect.ValueOf(&dropletExited).Elem())
+				return dropletExited
+			},
+			encode: func(value interface{}) []byte { return value.(DropletExited).ToJSON() },
+			decode: func(encoded []byte) (interface{}, error) { return NewDropletExitedFromJSON(encoded) },
+		},
+		"Heartbeat": {
+			keepsUnknown: true,
+			new: func(r *rand.Rand) interface{} {
+				heartbeat := Heartbeat{}
+				randomize(r, reflect.ValueOf(&heartbeat).Elem())
+				for i := range heartbeat.InstanceHeartbeats {
+					heartbeat.InstanceHeartbeats[i] = randomInstanceHeartbeat(r, true)
+					heartbeat.InstanceHeartbeats[i].DeaGuid = heartbeat.DeaGuid
+				}
+				heartbeat.Extra = randomExtra(r, 2, heartbeat)
+				return heartbeat
+			},
+			encode: func(value interface{}) []byte { return value.(Heartbeat).ToJSON() },
+			decode: func(encoded []byte) (interface{}, error) { return NewHeartbeatFromJSON(encoded) },
+		},
+		"InstanceHeartbeat": {
+			keepsUnknown: true,
+			new:          func(r *rand.Rand) interface{} { return randomInstanceHeartbeat(r, true) },
+			encode:       func(value interface{}) []byte { return value.(InstanceHeartbeat).ToJSON() },
+			decode:       func(encoded []byte) (interface{}, error) { return NewInstanceHeartbeatFromJSON(encoded) },
+		},
+		"StartMessage": {
+			new: func(r *rand.Rand) interface{} {
+				message := StartMessage{}
+				randomize(r, reflect.ValueOf(&message).Elem())
+				return message
+			},
+			encode: func(value interface{}) []byte { return value.(StartMessage).ToJSON() },
+			decode: func(encoded []byte) (interface{}, error) { return NewStartMessageFromJSON(encoded) },
+		},
+		"StopMessage": {
+			new: func(r *rand.Rand) interface{} {
+				message := StopMessage{}
+				randomize(r, reflect.ValueOf(&message).Elem())
+				return message
+			},
+			encode: func(value interface{}) []byte { return value.(StopMessage).ToJSON() },
+			decode: func(encoded []byte) (interface{}, error) { return NewStopMessageFromJSON(encoded) },
+		},
+		"PendingStartMessage": {
+			new: func(r *rand.Rand) interface{} {
+				message := PendingStartMessage{}
+				randomize(r, reflect.ValueOf(&message).Elem())
+				return message
+			},
+			encode: func(value interface{}) []byte { return value.(PendingStartMessage).ToJSON() },
+			decode: func(encoded []byte) (interface{}, error) { return NewPendingStartMessageFromJSON(encoded) },
+		},
+		"PendingStopMessage": {
+			new: func(r *rand.Rand) interface{} {
+				message := PendingStopMessage{}
+				randomize(r, reflect.ValueOf(&message).Elem())
+				return message
+			},
+			encode: func(value interface{}) []byte { return value.(PendingStopMessage).ToJSON() },
+			decode: func(encoded []byte) (interface{}, error) { return NewPendingStopMessageFromJSON(encoded) },
+		},
+	}
+
+	for name, model := range models {
+		name, model := name, model
+
+		Describe(name, func() {
+			It("decodes what it encodes", func() {
+				for i := 0; i < roundTrips; i++ {
+					value := model.new(r)
+					decoded, err := model.decode(model.encode(value))
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(decoded).Should(Equal(value))
+				}
+			})
+
+			It("encodes canonically", func() {
+				for i := 0; i < roundTrips; i++ {
+					encoded := model.encode(model.new(r))
+					canonical, err := CanonicalJSON(json.RawMessage(encoded))
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(string(encoded)).Should(Equal(string(canonical)))
+
+					decoded, err := model.decode(encoded)
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(string(model.encode(decoded))).Should(Equal(string(encoded)))
+				}
+			})
+
+			It("decodes payloads with fields it does not know", func() {
+				for i := 0; i < roundTrips; i++ {
+					value := model.new(r)
+					members := map[string]json.RawMessage{}
+					Ω(json.Unmarshal(model.encode(value), &members)).Should(Succeed())
+					for name, member := range randomExtra(r, 3, nil) {
+						members["unknown_"+name] = member
+					}
+					encoded, err := json.Marshal(members)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					decoded, err := model.decode(encoded)
+					Ω(err).ShouldNot(HaveOccurred())
+					if model.keepsUnknown {
+						Ω(model.encode(decoded)).Should(MatchJSON(encoded))
+					} else {
+						Ω(decoded).Should(Equal(value))
+					}
+				}
+			})
+
+			It("does not panic on damaged payloads", func() {
+				for i := 0; i < roundTrips; i++ {
+					encoded := model.encode(model.new(r))
+					switch r.Intn(3) {
+					case 0:
+						encoded = encoded[:r.Intn(len(encoded))]
+					case 1:
+						encoded[r.Intn(len(encoded))] = byte(r.Intn(256))
+					case 2:
+						encoded = []byte(strings.Replace(string(encoded), `"`, `{`, 1))
+					}
+					Ω(func() { model.decode(encoded) }).ShouldNot(Panic())
+				}
+			})
+		})
+	}
+
+	Describe("App", func() {
+		It("encodes its crash counts in index order", func() {
+			crashCounts := map[int]CrashCount{}
+			for i := 0; i < 20; i++ {
+				crashCounts[i] = CrashCount{AppGuid: "abc", AppVersion: "xyz", InstanceIndex: i, CrashCount: r.Intn(10)}
+			}
+			app := NewApp("abc", "xyz", DesiredAppState{}, []InstanceHeartbeat{}, crashCounts)
+			encoded := string(app.ToJSON())
+			for i := 0; i < 10; i++ {
+				Ω(string(app.ToJSON())).Should(Equal(encoded))
+			}
+			Ω(strings.Index(encoded, `"instance_index":1,`)).Should(BeNumerically("<", strings.Index(encoded, `"instance_index":2,`)))
+		})
+	})
+
+	Describe("CanonicalJSON", func() {
+		It("sorts object members at every depth and drops whitespace", func() {
+			encoded, err := CanonicalJSON(json.RawMessage(`{"b": [ {"d": 1, "c": 2} ], "a": "x"}`))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(encoded)).Should(Equal(`{"a":"x","b":[{"c":2,"d":1}]}`))
+		})
+
+		It("keeps numbers as they were written", func() {
+			encoded, err := CanonicalJSON(json.RawMessage(`{"big":18446744073709551615,"small":1.25e-7}`))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(encoded)).Should(Equal(`{"big":18446744073709551615,"small":1.25e-7}`))
+		})
+	})
+})
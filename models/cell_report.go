@@ -0,0 +1,124 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+type ActualLRPState string
+
+const (
+	ActualLRPStateUnclaimed ActualLRPState = "UNCLAIMED"
+	ActualLRPStateClaimed   ActualLRPState = "CLAIMED"
+	ActualLRPStateRunning   ActualLRPState = "RUNNING"
+	ActualLRPStateCrashed   ActualLRPState = "CRASHED"
+)
+
+// ActualLRP is an instance as a Diego cell reports it, in the shape of the
+// BBS's actual LRPs.  Its process guid is the app guid and the app version
+// joined by a "-"; Since is in nanoseconds.
+type ActualLRP struct {
+	ProcessGuid  string         `json:"process_guid"`
+	Index        int            `json:"index"`
+	InstanceGuid string         `json:"instance_guid"`
+	State        ActualLRPState `json:"state"`
+	Since        int64          `json:"since"`
+	Evacuating   bool           `json:"evacuating,omitempty"`
+}
+
+// AppGuidAndVersion splits the process guid in the middle, as the app guid
+// and the app version are guids of the same length.  ok is false when the
+// process guid cannot be split.
+func (lrp ActualLRP) AppGuidAndVersion() (appGuid string, appVersion string, ok bool) {
+	length := len(lrp.ProcessGuid)
+	middle := length / 2
+	if length < 3 || length%2 == 0 || lrp.ProcessGuid[middle] != '-' {
+		return "", "", false
+	}
+	return lrp.ProcessGuid[:middle], lrp.ProcessGuid[middle+1:], true
+}
+
+// CellReport is what a Diego cell reports of the instances it runs.  hm9000
+// reads it as a heartbeat from a DEA named after the cell, so that apps are
+// monitored the same way while they move from DEAs to Diego.
+type CellReport struct {
+	CellID     string      `json:"cell_id"`
+	Zone       string      `json:"zone,omitempty"`
+	ActualLRPs []ActualLRP `json:"actual_lrps"`
+}
+
+func NewCellReportFromJSON(encoded []byte) (CellReport, error) {
+	report := CellReport{}
+	err := json.Unmarshal(encoded, &report)
+	if err != nil {
+		return CellReport{}, err
+	}
+	if report.CellID == "" {
+		return CellReport{}, errors.New("cell report has no cell_id")
+	}
+	return report, nil
+}
+
+func (report CellReport) ToJSON() []byte {
+	result, _ := CanonicalJSON(report)
+	return result
+}
+
+// ToHeartbeat translates the report.  Claimed LRPs are starting, and
+// evacuating LRPs that are running are evacuating.  Unclaimed LRPs, which
+// are not on the cell, and LRPs whose process guid names no app are left
+// out; skipped counts them.
+func (report CellReport) ToHeartbeat() (heartbeat Heartbeat, skipped int) {
+	heartbeat = Heartbeat{
+		SchemaVersion:      HeartbeatSchemaV2,
+		DeaGuid:            report.CellID,
+		InstanceHeartbeats: []InstanceHeartbeat{},
+		Zone:               report.Zone,
+		CellID:             report.CellID,
+	}
+
+	for _, lrp := range report.ActualLRPs {
+		appGuid, appVersion, ok := lrp.AppGuidAndVersion()
+		state := lrp.instanceState()
+		if !ok || state == InstanceStateInvalid {
+			skipped++
+			continue
+		}
+
+		heartbeat.InstanceHeartbeats = append(heartbeat.InstanceHeartbeats, InstanceHeartbeat{
+			AppGuid:        appGuid,
+			AppVersion:     appVersion,
+			InstanceGuid:   lrp.InstanceGuid,
+			InstanceIndex:  lrp.Index,
+			State:          state,
+			StateTimestamp: float64(lrp.Since) / 1e9,
+			DeaGuid:        report.CellID,
+		})
+	}
+
+	return heartbeat, skipped
+}
+
+func (lrp ActualLRP) instanceState() InstanceState {
+	switch lrp.State {
+	case ActualLRPStateClaimed:
+		return InstanceStateStarting
+	case ActualLRPStateRunning:
+		if lrp.Evacuating {
+			return InstanceStateEvacuating
+		}
+		return InstanceStateRunning
+	case ActualLRPStateCrashed:
+		return InstanceStateCrashed
+	}
+	return InstanceStateInvalid
+}
+
+func (report CellReport) LogDescription() map[string]string {
+	return map[string]string{
+		"CellID":     report.CellID,
+		"Zone":       report.Zone,
+		"ActualLRPs": strconv.Itoa(len(report.ActualLRPs)),
+	}
+}
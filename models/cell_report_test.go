@@ -0,0 +1,117 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CellReport", func() {
+	var (
+		appGuid    string
+		appVersion string
+		report     CellReport
+	)
+
+	BeforeEach(func() {
+		appGuid = Guid()
+		appVersion = Guid()
+
+		report = CellReport{
+			CellID: "cell_abc",
+			Zone:   "z1",
+			ActualLRPs: []ActualLRP{
+				{ProcessGuid: appGuid + "-" + appVersion, Index: 0, InstanceGuid: "a", State: ActualLRPStateRunning, Since: 1123500000000},
+				{ProcessGuid: appGuid + "-" + appVersion, Index: 1, InstanceGuid: "b", State: ActualLRPStateClaimed, Since: 1124000000000},
+				{ProcessGuid: appGuid + "-" + appVersion, Index: 2, InstanceGuid: "c", State: ActualLRPStateCrashed, Since: 1125000000000},
+				{ProcessGuid: appGuid + "-" + appVersion, Index: 3, InstanceGuid: "d", State: ActualLRPStateRunning, Since: 1126000000000, Evacuating: true},
+			},
+		}
+	})
+
+	Describe("Building from JSON", func() {
+		It("should decode the report", func() {
+			decoded, err := NewCellReportFromJSON(report.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(report))
+		})
+
+		It("should read the BBS's field names", func() {
+			decoded, err := NewCellReportFromJSON([]byte(`{
+				"cell_id": "cell_abc",
+				"zone": "z1",
+				"actual_lrps": [{"process_guid": "abc-def", "index": 1, "instance_guid": "ghi", "state": "RUNNING", "since": 1000000000, "evacuating": true}]
+			}`))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded.ActualLRPs).Should(Equal([]ActualLRP{
+				{ProcessGuid: "abc-def", Index: 1, InstanceGuid: "ghi", State: ActualLRPStateRunning, Since: 1000000000, Evacuating: true},
+			}))
+		})
+
+		It("should fail when the JSON is invalid", func() {
+			_, err := NewCellReportFromJSON([]byte(`{`))
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should fail when the report names no cell", func() {
+			_, err := NewCellReportFromJSON([]byte(`{"actual_lrps": []}`))
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Splitting the process guid", func() {
+		It("should return the app guid and version", func() {
+			guid, version, ok := ActualLRP{ProcessGuid: appGuid + "-" + appVersion}.AppGuidAndVersion()
+			Ω(ok).Should(BeTrue())
+			Ω(guid).Should(Equal(appGuid))
+			Ω(version).Should(Equal(appVersion))
+		})
+
+		It("should fail when the process guid cannot be split in the middle", func() {
+			for _, processGuid := range []string{"", "-", "abc", "abcd-ef", appGuid + appVersion} {
+				_, _, ok := ActualLRP{ProcessGuid: processGuid}.AppGuidAndVersion()
+				Ω(ok).Should(BeFalse(), processGuid)
+			}
+		})
+	})
+
+	Describe("Translating to a heartbeat", func() {
+		It("should name the DEA after the cell", func() {
+			heartbeat, _ := report.ToHeartbeat()
+			Ω(heartbeat.DeaGuid).Should(Equal("cell_abc"))
+			Ω(heartbeat.CellID).Should(Equal("cell_abc"))
+			Ω(heartbeat.Zone).Should(Equal("z1"))
+			Ω(heartbeat.SchemaVersion).Should(Equal(HeartbeatSchemaV2))
+		})
+
+		It("should translate each LRP", func() {
+			heartbeat, skipped := report.ToHeartbeat()
+			Ω(skipped).Should(BeZero())
+			Ω(heartbeat.InstanceHeartbeats).Should(HaveLen(4))
+
+			Ω(heartbeat.InstanceHeartbeats[0]).Should(Equal(InstanceHeartbeat{
+				AppGuid:        appGuid,
+				AppVersion:     appVersion,
+				InstanceGuid:   "a",
+				InstanceIndex:  0,
+				State:          InstanceStateRunning,
+				StateTimestamp: 1123.5,
+				DeaGuid:        "cell_abc",
+			}))
+			Ω(heartbeat.InstanceHeartbeats[1].State).Should(Equal(InstanceStateStarting))
+			Ω(heartbeat.InstanceHeartbeats[2].State).Should(Equal(InstanceStateCrashed))
+			Ω(heartbeat.InstanceHeartbeats[3].State).Should(Equal(InstanceStateEvacuating))
+		})
+
+		It("should skip unclaimed LRPs and LRPs that name no app", func() {
+			report.ActualLRPs = append(report.ActualLRPs,
+				ActualLRP{ProcessGuid: appGuid + "-" + appVersion, Index: 4, State: ActualLRPStateUnclaimed},
+				ActualLRP{ProcessGuid: "not-a-process-guid", Index: 0, State: ActualLRPStateRunning},
+			)
+
+			heartbeat, skipped := report.ToHeartbeat()
+			Ω(skipped).Should(Equal(2))
+			Ω(heartbeat.InstanceHeartbeats).Should(HaveLen(4))
+		})
+	})
+})
@@ -0,0 +1,34 @@
+package models
+
+import "encoding/json"
+
+// ComponentControl is how an operator has set a polling component through
+// the admin API.  A paused component skips its runs until it is resumed,
+// and a MessageLimit overrides the sender's sender_message_limit (0 keeps
+// the config's).
+type ComponentControl struct {
+	Component    string `json:"component"`
+	Paused       bool   `json:"paused"`
+	MessageLimit int    `json:"message_limit,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	ChangedBy    string `json:"changed_by,omitempty"`
+	ChangedAt    int64  `json:"changed_at,omitempty"`
+}
+
+func NewComponentControlFromJSON(encoded []byte) (ComponentControl, error) {
+	control := ComponentControl{}
+	err := json.Unmarshal(encoded, &control)
+	if err != nil {
+		return ComponentControl{}, err
+	}
+	return control, nil
+}
+
+func (control ComponentControl) ToJSON() []byte {
+	result, _ := CanonicalJSON(control)
+	return result
+}
+
+func (control ComponentControl) StoreKey() string {
+	return control.Component
+}
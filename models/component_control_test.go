@@ -0,0 +1,48 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ComponentControl", func() {
+	var control ComponentControl
+
+	BeforeEach(func() {
+		control = ComponentControl{
+			Component: "sender",
+			Paused:    true,
+			Reason:    "incident 42",
+			ChangedBy: "admin",
+			ChangedAt: 172,
+		}
+	})
+
+	Describe("ToJSON", func() {
+		It("should have the right fields", func() {
+			json := string(control.ToJSON())
+			Ω(json).Should(ContainSubstring(`"component":"sender"`))
+			Ω(json).Should(ContainSubstring(`"paused":true`))
+			Ω(json).Should(ContainSubstring(`"reason":"incident 42"`))
+			Ω(json).Should(ContainSubstring(`"changed_by":"admin"`))
+			Ω(json).Should(ContainSubstring(`"changed_at":172`))
+			Ω(json).ShouldNot(ContainSubstring(`"message_limit"`))
+		})
+	})
+
+	Describe("NewComponentControlFromJSON", func() {
+		It("should create the right control", func() {
+			control.MessageLimit = 10
+			decoded, err := NewComponentControlFromJSON(control.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(control))
+		})
+
+		It("should error when passed invalid json", func() {
+			decoded, err := NewComponentControlFromJSON([]byte("∂"))
+			Ω(decoded).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,34 @@
+package models
+
+import "encoding/json"
+
+// ComponentRun records the latest run of a polling component (the fetcher,
+// analyzer, sender or shredder).
+type ComponentRun struct {
+	Component              string `json:"component"`
+	StartedAt              int64  `json:"started_at"`
+	DurationInMilliseconds int64  `json:"duration_in_milliseconds"`
+	Error                  string `json:"error,omitempty"`
+}
+
+func NewComponentRunFromJSON(encoded []byte) (ComponentRun, error) {
+	run := ComponentRun{}
+	err := json.Unmarshal(encoded, &run)
+	if err != nil {
+		return ComponentRun{}, err
+	}
+	return run, nil
+}
+
+func (run ComponentRun) ToJSON() []byte {
+	result, _ := CanonicalJSON(run)
+	return result
+}
+
+func (run ComponentRun) StoreKey() string {
+	return run.Component
+}
+
+func (run ComponentRun) Succeeded() bool {
+	return run.Error == ""
+}
@@ -0,0 +1,50 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ComponentRun", func() {
+	var run ComponentRun
+
+	BeforeEach(func() {
+		run = ComponentRun{
+			Component:              "Analyzer",
+			StartedAt:              172,
+			DurationInMilliseconds: 1500,
+		}
+	})
+
+	Describe("ToJSON", func() {
+		It("should have the right fields", func() {
+			json := string(run.ToJSON())
+			Ω(json).Should(ContainSubstring(`"component":"Analyzer"`))
+			Ω(json).Should(ContainSubstring(`"started_at":172`))
+			Ω(json).Should(ContainSubstring(`"duration_in_milliseconds":1500`))
+			Ω(json).ShouldNot(ContainSubstring(`"error"`))
+		})
+	})
+
+	Describe("NewComponentRunFromJSON", func() {
+		It("should create the right run", func() {
+			run.Error = "oops"
+			decoded, err := NewComponentRunFromJSON(run.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(run))
+		})
+
+		It("should error when passed invalid json", func() {
+			decoded, err := NewComponentRunFromJSON([]byte("∂"))
+			Ω(decoded).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	It("succeeded if it has no error", func() {
+		Ω(run.Succeeded()).Should(BeTrue())
+		run.Error = "oops"
+		Ω(run.Succeeded()).Should(BeFalse())
+	})
+})
@@ -23,7 +23,7 @@ func NewCrashCountFromJSON(encoded []byte) (CrashCount, error) {
 }
 
 func (crashCount CrashCount) ToJSON() []byte {
-	result, _ := json.Marshal(crashCount)
+	result, _ := CanonicalJSON(crashCount)
 	return result
 }
 
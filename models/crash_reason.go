@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// CrashReason is why an instance last crashed, as the DEA said in its
+// droplet.exited message.
+type CrashReason struct {
+	AppGuid         string `json:"droplet"`
+	AppVersion      string `json:"version"`
+	InstanceGuid    string `json:"instance"`
+	InstanceIndex   int    `json:"index"`
+	ExitStatusCode  int    `json:"exit_status"`
+	ExitDescription string `json:"exit_description"`
+	CrashedAt       int64  `json:"crashed_at"`
+}
+
+// NewCrashReason records the crash described by exited.  It crashed at the
+// DEA's crash timestamp, or at now if the DEA did not send one.
+func NewCrashReason(exited DropletExited, now time.Time) CrashReason {
+	crashedAt := exited.CrashTimestamp
+	if crashedAt == 0 {
+		crashedAt = now.Unix()
+	}
+
+	return CrashReason{
+		AppGuid:         exited.AppGuid,
+		AppVersion:      exited.AppVersion,
+		InstanceGuid:    exited.InstanceGuid,
+		InstanceIndex:   exited.InstanceIndex,
+		ExitStatusCode:  exited.ExitStatusCode,
+		ExitDescription: exited.ExitDescription,
+		CrashedAt:       crashedAt,
+	}
+}
+
+func NewCrashReasonFromJSON(encoded []byte) (CrashReason, error) {
+	reason := CrashReason{}
+	err := json.Unmarshal(encoded, &reason)
+	if err != nil {
+		return CrashReason{}, err
+	}
+	return reason, nil
+}
+
+func (reason CrashReason) ToJSON() []byte {
+	result, _ := CanonicalJSON(reason)
+	return result
+}
+
+// StoreKey is the index: an app's crash reasons are kept together, and the
+// latest crash of an index replaces the one before.
+func (reason CrashReason) StoreKey() string {
+	return strconv.Itoa(reason.InstanceIndex)
+}
+
+func (reason CrashReason) LogDescription() map[string]string {
+	return map[string]string{
+		"AppGuid":         reason.AppGuid,
+		"AppVersion":      reason.AppVersion,
+		"InstanceGuid":    reason.InstanceGuid,
+		"InstanceIndex":   strconv.Itoa(reason.InstanceIndex),
+		"ExitStatusCode":  strconv.Itoa(reason.ExitStatusCode),
+		"ExitDescription": reason.ExitDescription,
+	}
+}
@@ -0,0 +1,59 @@
+package models_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CrashReason", func() {
+	var exited DropletExited
+
+	BeforeEach(func() {
+		exited = DropletExited{
+			AppGuid:         "app",
+			AppVersion:      "v",
+			InstanceGuid:    "instance",
+			InstanceIndex:   2,
+			Reason:          DropletExitedReasonCrashed,
+			ExitStatusCode:  137,
+			ExitDescription: "out of memory",
+			CrashTimestamp:  90,
+		}
+	})
+
+	It("should record why the instance crashed, and when the DEA says it did", func() {
+		Ω(NewCrashReason(exited, time.Unix(100, 0))).Should(Equal(CrashReason{
+			AppGuid:         "app",
+			AppVersion:      "v",
+			InstanceGuid:    "instance",
+			InstanceIndex:   2,
+			ExitStatusCode:  137,
+			ExitDescription: "out of memory",
+			CrashedAt:       90,
+		}))
+	})
+
+	It("should have crashed now when the DEA does not say when", func() {
+		exited.CrashTimestamp = 0
+		Ω(NewCrashReason(exited, time.Unix(100, 0)).CrashedAt).Should(BeNumerically("==", 100))
+	})
+
+	It("should be keyed by index", func() {
+		Ω(NewCrashReason(exited, time.Unix(100, 0)).StoreKey()).Should(Equal("2"))
+	})
+
+	It("should round trip through JSON", func() {
+		reason := NewCrashReason(exited, time.Unix(100, 0))
+		decoded, err := NewCrashReasonFromJSON(reason.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(reason))
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewCrashReasonFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+// DailyCrashCount is how many crashes of an app were counted on the UTC day
+// starting at Day.
+type DailyCrashCount struct {
+	Day     int64 `json:"day"`
+	Crashes int   `json:"crashes"`
+}
+
+// CrashTrend is the long-term crash record of an app, across its versions,
+// one count per day, oldest first.  It is what is left of the crashes in
+// the app's history once they have been compacted.
+type CrashTrend struct {
+	AppGuid string            `json:"droplet"`
+	Days    []DailyCrashCount `json:"days"`
+}
+
+func NewCrashTrendFromJSON(encoded []byte) (CrashTrend, error) {
+	trend := CrashTrend{}
+	err := json.Unmarshal(encoded, &trend)
+	if err != nil {
+		return CrashTrend{}, err
+	}
+	return trend, nil
+}
+
+func (trend CrashTrend) ToJSON() []byte {
+	result, _ := CanonicalJSON(trend)
+	return result
+}
+
+func (trend CrashTrend) StoreKey() string {
+	return trend.AppGuid
+}
+
+// Add counts the crashes among events into the days they happened on, and
+// then drops the days that ended before cutoff.  Other events are ignored.
+func (trend CrashTrend) Add(cutoff time.Time, events ...AppEvent) CrashTrend {
+	crashesByDay := map[int64]int{}
+	for _, day := range trend.Days {
+		crashesByDay[day.Day] += day.Crashes
+	}
+	for _, event := range events {
+		if event.Type == AppEventCrashObserved {
+			crashesByDay[event.Timestamp-event.Timestamp%secondsPerDay]++
+		}
+	}
+
+	days := []DailyCrashCount{}
+	for day, crashes := range crashesByDay {
+		if day+secondsPerDay > cutoff.Unix() {
+			days = append(days, DailyCrashCount{Day: day, Crashes: crashes})
+		}
+	}
+	sort.Sort(dailyCrashCountsByDay(days))
+
+	trend.Days = days
+	return trend
+}
+
+type dailyCrashCountsByDay []DailyCrashCount
+
+func (a dailyCrashCountsByDay) Len() int           { return len(a) }
+func (a dailyCrashCountsByDay) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a dailyCrashCountsByDay) Less(i, j int) bool { return a[i].Day < a[j].Day }
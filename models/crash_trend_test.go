@@ -0,0 +1,76 @@
+package models_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CrashTrend", func() {
+	const day = 24 * 60 * 60
+
+	crash := func(timestamp int64) AppEvent {
+		return AppEvent{Type: AppEventCrashObserved, Timestamp: timestamp, AppGuid: "abc", AppVersion: "def"}
+	}
+
+	Describe("Add", func() {
+		It("counts the crashes by the UTC day they happened on, oldest first", func() {
+			trend := CrashTrend{AppGuid: "abc"}.Add(time.Unix(0, 0), crash(3*day+10), crash(day+5), crash(3*day+20), crash(day))
+			Ω(trend).Should(Equal(CrashTrend{
+				AppGuid: "abc",
+				Days: []DailyCrashCount{
+					{Day: day, Crashes: 2},
+					{Day: 3 * day, Crashes: 2},
+				},
+			}))
+		})
+
+		It("adds to the days it already has", func() {
+			trend := CrashTrend{AppGuid: "abc", Days: []DailyCrashCount{{Day: day, Crashes: 3}}}
+			trend = trend.Add(time.Unix(0, 0), crash(day+100), crash(2*day))
+			Ω(trend.Days).Should(Equal([]DailyCrashCount{
+				{Day: day, Crashes: 4},
+				{Day: 2 * day, Crashes: 1},
+			}))
+		})
+
+		It("ignores events other than crashes", func() {
+			trend := CrashTrend{AppGuid: "abc"}.Add(time.Unix(0, 0), AppEvent{Type: AppEventStartSent, Timestamp: day})
+			Ω(trend.Days).Should(BeEmpty())
+		})
+
+		It("drops the days that ended before the cutoff", func() {
+			trend := CrashTrend{AppGuid: "abc", Days: []DailyCrashCount{{Day: day, Crashes: 3}, {Day: 2 * day, Crashes: 1}}}
+			trend = trend.Add(time.Unix(2*day+10, 0), crash(3*day))
+			Ω(trend.Days).Should(Equal([]DailyCrashCount{
+				{Day: 2 * day, Crashes: 1},
+				{Day: 3 * day, Crashes: 1},
+			}))
+		})
+	})
+
+	Describe("JSON", func() {
+		It("round trips", func() {
+			trend := CrashTrend{AppGuid: "abc", Days: []DailyCrashCount{{Day: day, Crashes: 3}}}
+			Ω(trend.ToJSON()).Should(MatchJSON(`{"droplet":"abc","days":[{"day":86400,"crashes":3}]}`))
+
+			decoded, err := NewCrashTrendFromJSON(trend.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(trend))
+		})
+
+		It("fails on invalid JSON", func() {
+			trend, err := NewCrashTrendFromJSON([]byte("{"))
+			Ω(trend).Should(BeZero())
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("StoreKey", func() {
+		It("is the app guid", func() {
+			Ω(CrashTrend{AppGuid: "abc"}.StoreKey()).Should(Equal("abc"))
+		})
+	})
+})
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeaShutdownsScheduled is what deployment tooling sends, on
+// dea_shutdown_scheduled_subject, when it is about to roll the DEAs it
+// lists.
+type DeaShutdownsScheduled struct {
+	DeaGuids []string `json:"deas"`
+}
+
+func NewDeaShutdownsScheduledFromJSON(encoded []byte) (DeaShutdownsScheduled, error) {
+	scheduled := DeaShutdownsScheduled{}
+	err := json.Unmarshal(encoded, &scheduled)
+	if err != nil {
+		return DeaShutdownsScheduled{}, err
+	}
+	return scheduled, nil
+}
+
+// ScheduledDeaShutdown records that a DEA is about to be shut down, and
+// when hm9000 heard so.
+type ScheduledDeaShutdown struct {
+	DeaGuid     string `json:"dea"`
+	ScheduledAt int64  `json:"scheduled_at"`
+}
+
+func NewScheduledDeaShutdown(deaGuid string, now time.Time) ScheduledDeaShutdown {
+	return ScheduledDeaShutdown{
+		DeaGuid:     deaGuid,
+		ScheduledAt: now.Unix(),
+	}
+}
+
+func NewScheduledDeaShutdownFromJSON(encoded []byte) (ScheduledDeaShutdown, error) {
+	shutdown := ScheduledDeaShutdown{}
+	err := json.Unmarshal(encoded, &shutdown)
+	if err != nil {
+		return ScheduledDeaShutdown{}, err
+	}
+	return shutdown, nil
+}
+
+func (shutdown ScheduledDeaShutdown) ToJSON() []byte {
+	result, _ := CanonicalJSON(shutdown)
+	return result
+}
+
+func (shutdown ScheduledDeaShutdown) StoreKey() string {
+	return shutdown.DeaGuid
+}
@@ -0,0 +1,40 @@
+package models_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DeaShutdownsScheduled", func() {
+	It("should read the DEAs", func() {
+		scheduled, err := NewDeaShutdownsScheduledFromJSON([]byte(`{"deas": ["dea-1", "dea-2"]}`))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(scheduled.DeaGuids).Should(Equal([]string{"dea-1", "dea-2"}))
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewDeaShutdownsScheduledFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+})
+
+var _ = Describe("ScheduledDeaShutdown", func() {
+	It("should be keyed by DEA", func() {
+		Ω(NewScheduledDeaShutdown("dea", time.Unix(100, 0)).StoreKey()).Should(Equal("dea"))
+	})
+
+	It("should round trip through JSON", func() {
+		shutdown := NewScheduledDeaShutdown("dea", time.Unix(100, 0))
+		decoded, err := NewScheduledDeaShutdownFromJSON(shutdown.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(ScheduledDeaShutdown{DeaGuid: "dea", ScheduledAt: 100}))
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewScheduledDeaShutdownFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"hash/fnv"
+)
+
+// DeaSummary is what the listener kept of a DEA's latest heartbeat while
+// sampling heartbeats: how many instances it reported, in which states, and
+// how many of each app's, by app key.
+type DeaSummary struct {
+	DeaGuid   string                `json:"dea"`
+	Instances int                   `json:"instances"`
+	States    map[InstanceState]int `json:"states"`
+	Apps      map[string]int        `json:"apps"`
+}
+
+func NewDeaSummary(heartbeat Heartbeat) DeaSummary {
+	summary := DeaSummary{
+		DeaGuid: heartbeat.DeaGuid,
+		States:  map[InstanceState]int{},
+		Apps:    map[string]int{},
+	}
+	for _, instanceHeartbeat := range heartbeat.InstanceHeartbeats {
+		summary.Instances++
+		summary.States[instanceHeartbeat.State]++
+		summary.Apps[instanceHeartbeat.AppGuid+","+instanceHeartbeat.AppVersion]++
+	}
+	return summary
+}
+
+// HeartbeatCohort is which of cohorts the DEA's heartbeats are sampled
+// with.  A DEA stays in its cohort for as long as cohorts is unchanged.
+func HeartbeatCohort(deaGuid string, cohorts int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(deaGuid))
+	return int(hash.Sum32() % uint32(cohorts))
+}
+
+func NewDeaSummaryFromJSON(encoded []byte) (DeaSummary, error) {
+	summary := DeaSummary{}
+	err := json.Unmarshal(encoded, &summary)
+	if err != nil {
+		return DeaSummary{}, err
+	}
+	return summary, nil
+}
+
+func (summary DeaSummary) ToJSON() []byte {
+	result, _ := CanonicalJSON(summary)
+	return result
+}
+
+func (summary DeaSummary) StoreKey() string {
+	return summary.DeaGuid
+}
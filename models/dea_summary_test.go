@@ -0,0 +1,66 @@
+package models_test
+
+import (
+	"fmt"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DeaSummary", func() {
+	var heartbeat Heartbeat
+
+	BeforeEach(func() {
+		heartbeat = Heartbeat{
+			DeaGuid: "dea",
+			InstanceHeartbeats: []InstanceHeartbeat{
+				{AppGuid: "app", AppVersion: "v", InstanceIndex: 0, State: InstanceStateRunning},
+				{AppGuid: "other", AppVersion: "v", InstanceIndex: 0, State: InstanceStateCrashed},
+				{AppGuid: "app", AppVersion: "v", InstanceIndex: 1, State: InstanceStateStarting},
+			},
+		}
+	})
+
+	It("should count the DEA's instances, by state and by app", func() {
+		Ω(NewDeaSummary(heartbeat)).Should(Equal(DeaSummary{
+			DeaGuid:   "dea",
+			Instances: 3,
+			States:    map[InstanceState]int{InstanceStateRunning: 1, InstanceStateStarting: 1, InstanceStateCrashed: 1},
+			Apps:      map[string]int{"app,v": 2, "other,v": 1},
+		}))
+	})
+
+	It("should be keyed by DEA", func() {
+		Ω(NewDeaSummary(heartbeat).StoreKey()).Should(Equal("dea"))
+	})
+
+	It("should round trip through JSON", func() {
+		summary := NewDeaSummary(heartbeat)
+		decoded, err := NewDeaSummaryFromJSON(summary.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(summary))
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewDeaSummaryFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+
+	Describe("HeartbeatCohort", func() {
+		It("should put a DEA in the same cohort every time", func() {
+			Ω(HeartbeatCohort("dea", 4)).Should(Equal(HeartbeatCohort("dea", 4)))
+		})
+
+		It("should spread DEAs over every cohort", func() {
+			cohorts := map[int]bool{}
+			for i := 0; i < 100; i++ {
+				cohort := HeartbeatCohort(fmt.Sprintf("dea-%d", i), 4)
+				Ω(cohort).Should(BeNumerically(">=", 0))
+				Ω(cohort).Should(BeNumerically("<", 4))
+				cohorts[cohort] = true
+			}
+			Ω(cohorts).Should(HaveLen(4))
+		})
+	})
+})
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// DeaAdvertisement is the part of a dea.advertise message hm9000 reads.
+type DeaAdvertisement struct {
+	DeaGuid             string `json:"id"`
+	PlacementProperties struct {
+		Zone string `json:"zone"`
+	} `json:"placement_properties"`
+}
+
+func NewDeaAdvertisementFromJSON(encoded []byte) (DeaAdvertisement, error) {
+	advertisement := DeaAdvertisement{}
+	err := json.Unmarshal(encoded, &advertisement)
+	if err != nil {
+		return DeaAdvertisement{}, err
+	}
+	return advertisement, nil
+}
+
+func (advertisement DeaAdvertisement) Zone() string {
+	return advertisement.PlacementProperties.Zone
+}
+
+// DeaZone is what hm9000 last heard from a DEA that reports its zone: when
+// it was last seen, heartbeating or advertising, and the indices it was
+// running of each app, by app key.
+type DeaZone struct {
+	DeaGuid  string           `json:"dea"`
+	Zone     string           `json:"zone"`
+	LastSeen int64            `json:"last_seen"`
+	Indices  map[string][]int `json:"indices,omitempty"`
+}
+
+// NewDeaZone records a heartbeat, received at now, from a DEA in a zone.
+func NewDeaZone(heartbeat Heartbeat, now time.Time) DeaZone {
+	deaZone := DeaZone{
+		DeaGuid:  heartbeat.DeaGuid,
+		Zone:     heartbeat.Zone,
+		LastSeen: now.Unix(),
+	}
+	for _, instanceHeartbeat := range heartbeat.InstanceHeartbeats {
+		if deaZone.Indices == nil {
+			deaZone.Indices = map[string][]int{}
+		}
+		key := instanceHeartbeat.AppGuid + "," + instanceHeartbeat.AppVersion
+		deaZone.Indices[key] = append(deaZone.Indices[key], instanceHeartbeat.InstanceIndex)
+	}
+	for _, indices := range deaZone.Indices {
+		sort.Ints(indices)
+	}
+	return deaZone
+}
+
+func NewDeaZoneFromJSON(encoded []byte) (DeaZone, error) {
+	deaZone := DeaZone{}
+	err := json.Unmarshal(encoded, &deaZone)
+	if err != nil {
+		return DeaZone{}, err
+	}
+	return deaZone, nil
+}
+
+func (deaZone DeaZone) ToJSON() []byte {
+	result, _ := CanonicalJSON(deaZone)
+	return result
+}
+
+func (deaZone DeaZone) StoreKey() string {
+	return deaZone.DeaGuid
+}
+
+// IsFresh is true when the DEA was seen within ttl of now.
+func (deaZone DeaZone) IsFresh(now time.Time, ttl time.Duration) bool {
+	return now.Sub(time.Unix(deaZone.LastSeen, 0)) < ttl
+}
+
+// ZoneFreshness describes a zone: it is fresh while any of its DEAs is.
+type ZoneFreshness struct {
+	Zone      string `json:"zone"`
+	Fresh     bool   `json:"fresh"`
+	Deas      int    `json:"deas"`
+	FreshDeas int    `json:"fresh_deas"`
+	LastSeen  int64  `json:"last_seen"`
+}
+
+// DeaZones are the zones of DEAs, by DEA guid.
+type DeaZones map[string]DeaZone
+
+// Freshness describes each zone at now, by name, counting a DEA fresh if it
+// was seen within ttl.
+func (deaZones DeaZones) Freshness(now time.Time, ttl time.Duration) map[string]ZoneFreshness {
+	zones := map[string]ZoneFreshness{}
+	for _, deaZone := range deaZones {
+		zone := zones[deaZone.Zone]
+		zone.Zone = deaZone.Zone
+		zone.Deas++
+		if deaZone.IsFresh(now, ttl) {
+			zone.FreshDeas++
+			zone.Fresh = true
+		}
+		if deaZone.LastSeen > zone.LastSeen {
+			zone.LastSeen = deaZone.LastSeen
+		}
+		zones[deaZone.Zone] = zone
+	}
+	return zones
+}
+
+// StaleIndices are the indices last seen on DEAs in zones that are not
+// fresh, as the zone of each index by app key.
+func (deaZones DeaZones) StaleIndices(now time.Time, ttl time.Duration) map[string]map[int]string {
+	zones := deaZones.Freshness(now, ttl)
+	staleIndices := map[string]map[int]string{}
+	for _, deaZone := range deaZones {
+		if zones[deaZone.Zone].Fresh {
+			continue
+		}
+		for key, indices := range deaZone.Indices {
+			if staleIndices[key] == nil {
+				staleIndices[key] = map[int]string{}
+			}
+			for _, index := range indices {
+				staleIndices[key][index] = deaZone.Zone
+			}
+		}
+	}
+	return staleIndices
+}
@@ -0,0 +1,97 @@
+package models_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DeaAdvertisement", func() {
+	It("should read the DEA and its zone", func() {
+		advertisement, err := NewDeaAdvertisementFromJSON([]byte(`{"id": "dea", "stacks": ["lucid64"], "placement_properties": {"zone": "z1"}}`))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(advertisement.DeaGuid).Should(Equal("dea"))
+		Ω(advertisement.Zone()).Should(Equal("z1"))
+	})
+
+	It("should have no zone when the DEA does not send one", func() {
+		advertisement, err := NewDeaAdvertisementFromJSON([]byte(`{"id": "dea"}`))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(advertisement.Zone()).Should(BeEmpty())
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewDeaAdvertisementFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+})
+
+var _ = Describe("DeaZone", func() {
+	var heartbeat Heartbeat
+
+	BeforeEach(func() {
+		heartbeat = Heartbeat{
+			DeaGuid: "dea",
+			Zone:    "z1",
+			InstanceHeartbeats: []InstanceHeartbeat{
+				{AppGuid: "app", AppVersion: "v", InstanceIndex: 2},
+				{AppGuid: "app", AppVersion: "v", InstanceIndex: 0},
+				{AppGuid: "other", AppVersion: "v", InstanceIndex: 1},
+			},
+		}
+	})
+
+	It("should record the indices of each app the DEA is running", func() {
+		deaZone := NewDeaZone(heartbeat, time.Unix(100, 0))
+		Ω(deaZone).Should(Equal(DeaZone{
+			DeaGuid:  "dea",
+			Zone:     "z1",
+			LastSeen: 100,
+			Indices: map[string][]int{
+				"app,v":   {0, 2},
+				"other,v": {1},
+			},
+		}))
+		Ω(deaZone.StoreKey()).Should(Equal("dea"))
+	})
+
+	It("should round trip through JSON", func() {
+		deaZone := NewDeaZone(heartbeat, time.Unix(100, 0))
+		decoded, err := NewDeaZoneFromJSON(deaZone.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(deaZone))
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewDeaZoneFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+})
+
+var _ = Describe("DeaZones", func() {
+	var deaZones DeaZones
+
+	BeforeEach(func() {
+		deaZones = DeaZones{
+			"a1": {DeaGuid: "a1", Zone: "a", LastSeen: 95, Indices: map[string][]int{"app,v": {0}}},
+			"a2": {DeaGuid: "a2", Zone: "a", LastSeen: 60, Indices: map[string][]int{"app,v": {1}}},
+			"b1": {DeaGuid: "b1", Zone: "b", LastSeen: 50, Indices: map[string][]int{"app,v": {2}, "other,v": {0}}},
+		}
+	})
+
+	It("should describe each zone, fresh while any of its DEAs is", func() {
+		Ω(deaZones.Freshness(time.Unix(100, 0), 30*time.Second)).Should(Equal(map[string]ZoneFreshness{
+			"a": {Zone: "a", Fresh: true, Deas: 2, FreshDeas: 1, LastSeen: 95},
+			"b": {Zone: "b", Fresh: false, Deas: 1, FreshDeas: 0, LastSeen: 50},
+		}))
+	})
+
+	It("should list the indices last seen in stale zones only", func() {
+		Ω(deaZones.StaleIndices(time.Unix(100, 0), 30*time.Second)).Should(Equal(map[string]map[int]string{
+			"app,v":   {2: "b"},
+			"other,v": {0: "b"},
+		}))
+	})
+})
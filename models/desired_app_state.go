@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -31,6 +32,25 @@ type DesiredAppState struct {
 	NumberOfInstances int             `json:"instances"`
 	State             AppState        `json:"state"`
 	PackageState      AppPackageState `json:"package_state"`
+
+	// The app's place in the CC, and the labels it was given there.  CCs that
+	// predate them send none.
+	OrganizationGuid string            `json:"organization_guid,omitempty"`
+	SpaceGuid        string            `json:"space_guid,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+
+	// MemoryInMB is the memory each instance needs, or 0 if the CC did not
+	// say.
+	MemoryInMB int `json:"memory,omitempty"`
+
+	// Name is the app's name in the CC, which the fetcher matches the
+	// fetcher_exclusions against.  It is not stored.
+	Name string `json:"name,omitempty"`
+
+	// Unmanaged apps matched the fetcher_exclusions: they are kept in the
+	// desired state, but the analyzer and sender leave them to whatever
+	// else supervises them.
+	Unmanaged bool `json:"unmanaged,omitempty"`
 }
 
 func NewDesiredAppStateFromJSON(encoded []byte) (DesiredAppState, error) {
@@ -42,11 +62,15 @@ func NewDesiredAppStateFromJSON(encoded []byte) (DesiredAppState, error) {
 	return desired, nil
 }
 
+// NewDesiredAppStateFromCSV decodes a desired state as the store keeps it.
+// States with an organization, space or labels have three more values,
+// states with a memory requirement four, and unmanaged states five (see
+// ToCSV).
 func NewDesiredAppStateFromCSV(appGuid, appVersion string, encoded []byte) (DesiredAppState, error) {
 	values := strings.Split(string(encoded), ",")
 
-	if len(values) != 3 {
-		return DesiredAppState{}, fmt.Errorf("invalid desired state (need 3 values, have %d)", len(values))
+	if len(values) != 3 && len(values) != 6 && len(values) != 7 && len(values) != 8 {
+		return DesiredAppState{}, fmt.Errorf("invalid desired state (need 3, 6, 7 or 8 values, have %d)", len(values))
 	}
 
 	numberOfInstances, err := strconv.Atoi(values[0])
@@ -54,22 +78,84 @@ func NewDesiredAppStateFromCSV(appGuid, appVersion string, encoded []byte) (Desi
 		return DesiredAppState{}, err
 	}
 
-	return DesiredAppState{
+	state := DesiredAppState{
 		AppGuid:           appGuid,
 		AppVersion:        appVersion,
 		NumberOfInstances: numberOfInstances,
 		State:             AppState(values[1]),
 		PackageState:      AppPackageState(values[2]),
-	}, nil
+	}
+
+	if len(values) >= 6 {
+		state.OrganizationGuid = values[3]
+		state.SpaceGuid = values[4]
+		state.Labels, err = decodeLabels(values[5])
+		if err != nil {
+			return DesiredAppState{}, err
+		}
+	}
+
+	if len(values) >= 7 {
+		state.MemoryInMB, err = strconv.Atoi(values[6])
+		if err != nil {
+			return DesiredAppState{}, err
+		}
+	}
+
+	if len(values) == 8 {
+		if values[7] != "unmanaged" {
+			return DesiredAppState{}, fmt.Errorf("invalid desired state (unknown flag %q)", values[7])
+		}
+		state.Unmanaged = true
+	}
+
+	return state, nil
 }
 
 func (state DesiredAppState) ToJSON() []byte {
-	result, _ := json.Marshal(state)
+	result, _ := CanonicalJSON(state)
 	return result
 }
 
+// ToCSV encodes the desired state for the store.  The organization, space
+// and labels are only written when there are any, and the memory
+// requirement when there is one, and the unmanaged flag when it is set, so
+// that states without them can still be read by versions of hm9000 that
+// predate them.
 func (state DesiredAppState) ToCSV() []byte {
-	return []byte(fmt.Sprintf("%d,%s,%s", state.NumberOfInstances, state.State, state.PackageState))
+	if state.Unmanaged {
+		return []byte(fmt.Sprintf("%d,%s,%s,%s,%s,%s,%d,unmanaged", state.NumberOfInstances, state.State, state.PackageState, state.OrganizationGuid, state.SpaceGuid, encodeLabels(state.Labels), state.MemoryInMB))
+	}
+	if state.MemoryInMB != 0 {
+		return []byte(fmt.Sprintf("%d,%s,%s,%s,%s,%s,%d", state.NumberOfInstances, state.State, state.PackageState, state.OrganizationGuid, state.SpaceGuid, encodeLabels(state.Labels), state.MemoryInMB))
+	}
+	if state.OrganizationGuid == "" && state.SpaceGuid == "" && len(state.Labels) == 0 {
+		return []byte(fmt.Sprintf("%d,%s,%s", state.NumberOfInstances, state.State, state.PackageState))
+	}
+	return []byte(fmt.Sprintf("%d,%s,%s,%s,%s,%s", state.NumberOfInstances, state.State, state.PackageState, state.OrganizationGuid, state.SpaceGuid, encodeLabels(state.Labels)))
+}
+
+// encodeLabels encodes labels as a query string, sorted by name, which
+// escapes the commas ToCSV separates values with.
+func encodeLabels(labels map[string]string) string {
+	values := url.Values{}
+	for name, value := range labels {
+		values.Set(name, value)
+	}
+	return values.Encode()
+}
+
+func decodeLabels(encoded string) (map[string]string, error) {
+	values, err := url.ParseQuery(encoded)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+
+	labels := map[string]string{}
+	for name := range values {
+		labels[name] = values.Get(name)
+	}
+	return labels, nil
 }
 
 func (state DesiredAppState) LogDescription() map[string]string {
@@ -87,7 +173,24 @@ func (state DesiredAppState) Equal(other DesiredAppState) bool {
 		state.AppVersion == other.AppVersion &&
 		state.NumberOfInstances == other.NumberOfInstances &&
 		state.State == other.State &&
-		state.PackageState == other.PackageState
+		state.PackageState == other.PackageState &&
+		state.OrganizationGuid == other.OrganizationGuid &&
+		state.SpaceGuid == other.SpaceGuid &&
+		state.MemoryInMB == other.MemoryInMB &&
+		state.Unmanaged == other.Unmanaged &&
+		len(state.Labels) == len(other.Labels) &&
+		state.HasLabels(other.Labels)
+}
+
+// HasLabels is whether the app has all of labels, with the same values.
+func (state DesiredAppState) HasLabels(labels map[string]string) bool {
+	for name, value := range labels {
+		actual, ok := state.Labels[name]
+		if !ok || actual != value {
+			return false
+		}
+	}
+	return true
 }
 
 func (state DesiredAppState) StoreKey() string {
@@ -87,6 +87,126 @@ var _ = Describe("DesiredAppState", func() {
 				Ω(string(desiredAppState.ToCSV())).Should(Equal("3,STOPPED,STAGED"))
 			})
 		})
+
+		Describe("organization, space and labels", func() {
+			BeforeEach(func() {
+				desiredAppState.OrganizationGuid = "org-guid"
+				desiredAppState.SpaceGuid = "space-guid"
+				desiredAppState.Labels = map[string]string{"team": "payments, billing", "tier": "a=b&c"}
+			})
+
+			It("should build from the CC's JSON", func() {
+				jsonDesired, err := NewDesiredAppStateFromJSON([]byte(`{
+                    "id":"app_guid_abc",
+                    "version":"app_version_123",
+                    "instances":3,
+                    "state":"STOPPED",
+                    "package_state":"STAGED",
+                    "organization_guid":"org-guid",
+                    "space_guid":"space-guid",
+                    "labels":{"team":"payments, billing","tier":"a=b&c"}
+                }`))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(jsonDesired).Should(Equal(desiredAppState))
+			})
+
+			It("should round trip through CSV, escaping the labels", func() {
+				Ω(string(desiredAppState.ToCSV())).Should(Equal("3,STOPPED,STAGED,org-guid,space-guid,team=payments%2C+billing&tier=a%3Db%26c"))
+
+				csvDesired, err := NewDesiredAppStateFromCSV("app_guid_abc", "app_version_123", desiredAppState.ToCSV())
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(csvDesired).Should(Equal(desiredAppState))
+			})
+
+			It("should be left out of the CSV when there are none", func() {
+				desiredAppState.OrganizationGuid = ""
+				desiredAppState.SpaceGuid = ""
+				desiredAppState.Labels = map[string]string{}
+				Ω(string(desiredAppState.ToCSV())).Should(Equal("3,STOPPED,STAGED"))
+			})
+
+			It("should tell whether the app has labels", func() {
+				Ω(desiredAppState.HasLabels(nil)).Should(BeTrue())
+				Ω(desiredAppState.HasLabels(map[string]string{"team": "payments, billing"})).Should(BeTrue())
+				Ω(desiredAppState.HasLabels(map[string]string{"team": "payments"})).Should(BeFalse())
+				Ω(desiredAppState.HasLabels(map[string]string{"owner": ""})).Should(BeFalse())
+			})
+		})
+
+		Describe("memory", func() {
+			BeforeEach(func() {
+				desiredAppState.MemoryInMB = 256
+			})
+
+			It("should build from the CC's JSON", func() {
+				jsonDesired, err := NewDesiredAppStateFromJSON([]byte(`{
+                    "id":"app_guid_abc",
+                    "version":"app_version_123",
+                    "instances":3,
+                    "state":"STOPPED",
+                    "package_state":"STAGED",
+                    "memory":256
+                }`))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(jsonDesired).Should(Equal(desiredAppState))
+			})
+
+			It("should round trip through CSV", func() {
+				Ω(string(desiredAppState.ToCSV())).Should(Equal("3,STOPPED,STAGED,,,,256"))
+
+				csvDesired, err := NewDesiredAppStateFromCSV("app_guid_abc", "app_version_123", desiredAppState.ToCSV())
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(csvDesired).Should(Equal(desiredAppState))
+			})
+
+			It("should round trip through CSV with an organization, space and labels", func() {
+				desiredAppState.OrganizationGuid = "org-guid"
+				desiredAppState.Labels = map[string]string{"team": "payments"}
+
+				csvDesired, err := NewDesiredAppStateFromCSV("app_guid_abc", "app_version_123", desiredAppState.ToCSV())
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(csvDesired).Should(Equal(desiredAppState))
+			})
+
+			It("should fail when it is not a number", func() {
+				_, err := NewDesiredAppStateFromCSV("app_guid_abc", "app_version_123", []byte("3,STOPPED,STAGED,,,,lots"))
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		Describe("unmanaged", func() {
+			BeforeEach(func() {
+				desiredAppState.Unmanaged = true
+			})
+
+			It("should round trip through CSV", func() {
+				Ω(string(desiredAppState.ToCSV())).Should(Equal("3,STOPPED,STAGED,,,,0,unmanaged"))
+
+				csvDesired, err := NewDesiredAppStateFromCSV("app_guid_abc", "app_version_123", desiredAppState.ToCSV())
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(csvDesired).Should(Equal(desiredAppState))
+			})
+
+			It("should not store the name", func() {
+				desiredAppState.Name = "router"
+
+				csvDesired, err := NewDesiredAppStateFromCSV("app_guid_abc", "app_version_123", desiredAppState.ToCSV())
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(csvDesired.Name).Should(BeEmpty())
+				Ω(csvDesired.Equal(desiredAppState)).Should(BeTrue())
+			})
+
+			It("should not equal the managed state", func() {
+				managed := desiredAppState
+				managed.Unmanaged = false
+				Ω(managed.Equal(desiredAppState)).Should(BeFalse())
+			})
+
+			It("should fail on an unknown flag", func() {
+				_, err := NewDesiredAppStateFromCSV("app_guid_abc", "app_version_123", []byte("3,STOPPED,STAGED,,,,0,orphaned"))
+				Ω(err).Should(HaveOccurred())
+			})
+		})
 	})
 
 	Describe("StoreKey", func() {
@@ -145,10 +265,36 @@ var _ = Describe("DesiredAppState", func() {
 			Ω(actual.Equal(other)).Should(BeFalse())
 		})
 
+		It("is inequal when the memory is different", func() {
+			other.MemoryInMB = 512
+			Ω(actual.Equal(other)).Should(BeFalse())
+		})
+
 		It("is inequal when the package state is different", func() {
 			other.PackageState = AppPackageStateFailed
 			Ω(actual.Equal(other)).Should(BeFalse())
 		})
+
+		It("is inequal when the organization or space is different", func() {
+			other.OrganizationGuid = "another org"
+			Ω(actual.Equal(other)).Should(BeFalse())
+
+			other = actual
+			other.SpaceGuid = "another space"
+			Ω(actual.Equal(other)).Should(BeFalse())
+		})
+
+		It("is inequal when the labels are different", func() {
+			actual.Labels = map[string]string{"team": "payments"}
+			other.Labels = map[string]string{"team": "payments"}
+			Ω(actual.Equal(other)).Should(BeTrue())
+
+			other.Labels = map[string]string{"team": "payments", "tier": "critical"}
+			Ω(actual.Equal(other)).Should(BeFalse())
+
+			other.Labels = map[string]string{"team": "marketing"}
+			Ω(actual.Equal(other)).Should(BeFalse())
+		})
 	})
 
 	Describe("LogDescription", func() {
@@ -37,7 +37,7 @@ func NewDropletExitedFromJSON(encoded []byte) (DropletExited, error) {
 }
 
 func (dropletExited DropletExited) ToJSON() []byte {
-	result, _ := json.Marshal(dropletExited)
+	result, _ := CanonicalJSON(dropletExited)
 	return result
 }
 
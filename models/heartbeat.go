@@ -2,14 +2,32 @@ package models
 
 import (
 	"encoding/json"
+	"reflect"
 	"strconv"
+	"time"
 )
 
 type Heartbeat struct {
+	// SchemaVersion is the version of the schema the DEA sent, or 0 for a
+	// DEA that predates versioning (see Version).
+	SchemaVersion int `json:"schema_version,omitempty"`
+
 	DeaGuid            string              `json:"dea"`
 	InstanceHeartbeats []InstanceHeartbeat `json:"droplets"`
+
+	// since HeartbeatSchemaV2
+	Zone   string `json:"zone,omitempty"`
+	CellID string `json:"cell_id,omitempty"`
+
+	// Extra holds the fields this version does not know, as they were sent.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
+var heartbeatFields = jsonFieldNames(reflect.TypeOf(Heartbeat{}))
+
+// plainHeartbeat is Heartbeat without its JSON methods.
+type plainHeartbeat Heartbeat
+
 func NewHeartbeatFromJSON(encoded []byte) (Heartbeat, error) {
 	var heartbeat Heartbeat
 	err := json.Unmarshal(encoded, &heartbeat)
@@ -24,10 +42,68 @@ func NewHeartbeatFromJSON(encoded []byte) (Heartbeat, error) {
 }
 
 func (heartbeat Heartbeat) ToJSON() []byte {
-	encoded, _ := json.Marshal(heartbeat)
+	encoded, _ := CanonicalJSON(heartbeat)
 	return encoded
 }
 
+func (heartbeat *Heartbeat) UnmarshalJSON(encoded []byte) error {
+	var plain plainHeartbeat
+	err := json.Unmarshal(encoded, &plain)
+	if err != nil {
+		return err
+	}
+
+	plain.Extra, err = extraFields(encoded, heartbeatFields)
+	if err != nil {
+		return err
+	}
+
+	*heartbeat = Heartbeat(plain)
+	return nil
+}
+
+func (heartbeat Heartbeat) MarshalJSON() ([]byte, error) {
+	return encodeWithExtra(plainHeartbeat(heartbeat), heartbeat.Extra)
+}
+
+// Version is the schema version of the heartbeat, HeartbeatSchemaV1 if the DEA
+// sent none.
+func (heartbeat Heartbeat) Version() int {
+	if heartbeat.SchemaVersion == 0 {
+		return HeartbeatSchemaV1
+	}
+	return heartbeat.SchemaVersion
+}
+
+// ClockSkew is how far ahead of now the newest state timestamp in the
+// heartbeat is, or 0 if none is ahead.  Instances enter their states in the
+// past, so a timestamp ahead of now means that the DEA's clock is ahead.  A
+// clock that is behind does not show.
+func (heartbeat Heartbeat) ClockSkew(now time.Time) time.Duration {
+	skew := time.Duration(0)
+	for _, instanceHeartbeat := range heartbeat.InstanceHeartbeats {
+		ahead := time.Duration((instanceHeartbeat.StateTimestamp - float64(now.UnixNano())/float64(time.Second)) * float64(time.Second))
+		if ahead > skew {
+			skew = ahead
+		}
+	}
+	return skew
+}
+
+// NormalizeTimestamps brings the state timestamps ahead of now back to now.
+func (heartbeat Heartbeat) NormalizeTimestamps(now time.Time) Heartbeat {
+	nowTimestamp := float64(now.UnixNano()) / float64(time.Second)
+	instanceHeartbeats := make([]InstanceHeartbeat, len(heartbeat.InstanceHeartbeats))
+	for i, instanceHeartbeat := range heartbeat.InstanceHeartbeats {
+		if instanceHeartbeat.StateTimestamp > nowTimestamp {
+			instanceHeartbeat.StateTimestamp = nowTimestamp
+		}
+		instanceHeartbeats[i] = instanceHeartbeat
+	}
+	heartbeat.InstanceHeartbeats = instanceHeartbeats
+	return heartbeat
+}
+
 func (heartbeat Heartbeat) LogDescription() map[string]string {
 	var evacuating, running, crashed, starting int
 	for _, instanceHeartbeat := range heartbeat.InstanceHeartbeats {
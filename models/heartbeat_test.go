@@ -1,6 +1,9 @@
 package models_test
 
 import (
+	"encoding/json"
+	"time"
+
 	. "github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
 	. "github.com/onsi/ginkgo"
@@ -47,6 +50,7 @@ var _ = Describe("Heartbeat", func() {
 
 				Ω(err).ShouldNot(HaveOccurred())
 
+				heartbeat.InstanceHeartbeats[0].Extra = map[string]json.RawMessage{"cc_partition": json.RawMessage(`"default"`)}
 				Ω(jsonHeartbeat).Should(Equal(heartbeat))
 			})
 		})
@@ -107,4 +111,29 @@ var _ = Describe("Heartbeat", func() {
 			})
 		})
 	})
+
+	Describe("ClockSkew", func() {
+		It("is how far ahead of now the newest state timestamp is", func() {
+			heartbeat.InstanceHeartbeats = append(heartbeat.InstanceHeartbeats, InstanceHeartbeat{StateTimestamp: 1130.5}, InstanceHeartbeat{StateTimestamp: 1000})
+			Ω(heartbeat.ClockSkew(time.Unix(1120, 0))).Should(BeNumerically("~", 10500*time.Millisecond, time.Millisecond))
+		})
+
+		It("is zero when no timestamp is ahead of now", func() {
+			Ω(heartbeat.ClockSkew(time.Unix(1200, 0))).Should(BeZero())
+		})
+	})
+
+	Describe("NormalizeTimestamps", func() {
+		It("brings the timestamps ahead of now back to now", func() {
+			heartbeat.InstanceHeartbeats = append(heartbeat.InstanceHeartbeats, InstanceHeartbeat{StateTimestamp: 1000})
+			normalized := heartbeat.NormalizeTimestamps(time.Unix(1100, 0))
+			Ω(normalized.InstanceHeartbeats[0].StateTimestamp).Should(Equal(1100.0))
+			Ω(normalized.InstanceHeartbeats[1].StateTimestamp).Should(Equal(1000.0))
+		})
+
+		It("leaves the original heartbeat alone", func() {
+			heartbeat.NormalizeTimestamps(time.Unix(1100, 0))
+			Ω(heartbeat.InstanceHeartbeats[0].StateTimestamp).Should(Equal(1123.2))
+		})
+	})
 })
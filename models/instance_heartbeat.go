@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 )
@@ -25,8 +26,38 @@ type InstanceHeartbeat struct {
 	State          InstanceState `json:"state"`
 	StateTimestamp float64       `json:"state_timestamp"`
 	DeaGuid        string        `json:"dea_guid"`
+
+	// since HeartbeatSchemaV2
+	Stats *InstanceStats `json:"stats,omitempty"`
+
+	// Where the router reaches the instance, and its routes, from DEAs that
+	// send them.
+	Host string   `json:"host,omitempty"`
+	Port int      `json:"port,omitempty"`
+	Uris []string `json:"uris,omitempty"`
+
+	// Extra holds the fields this version does not know, as they were sent.
+	// Like Stats, it is not kept in the store.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
+// InstanceStats are the resources an instance is using, as its DEA measured
+// them.
+type InstanceStats struct {
+	CPU           float64 `json:"cpu"`
+	MemoryInBytes uint64  `json:"mem"`
+	DiskInBytes   uint64  `json:"disk"`
+}
+
+var instanceHeartbeatFields = jsonFieldNames(reflect.TypeOf(InstanceHeartbeat{}))
+
+// plainInstanceHeartbeat is InstanceHeartbeat without its JSON methods.
+type plainInstanceHeartbeat InstanceHeartbeat
+
+// NewInstanceHeartbeatFromCSV decodes an instance heartbeat as the store
+// keeps it.  Entries may carry the instance's transitions after the
+// heartbeat (see NewInstanceTransitionsFromCSV), which are ignored here, and
+// then its address (see AddressToCSV).
 func NewInstanceHeartbeatFromCSV(appGuid, appVersion, instanceGuid string, encoded []byte) (InstanceHeartbeat, error) {
 	instance := InstanceHeartbeat{
 		AppGuid:      appGuid,
@@ -36,8 +67,8 @@ func NewInstanceHeartbeatFromCSV(appGuid, appVersion, instanceGuid string, encod
 
 	values := strings.Split(string(encoded), ",")
 
-	if len(values) != 4 {
-		return InstanceHeartbeat{}, fmt.Errorf("invalid CSV (need 4 entries, got %d)", len(values))
+	if len(values) != 4 && len(values) != 7 && len(values) != 10 {
+		return InstanceHeartbeat{}, fmt.Errorf("invalid CSV (need 4, 7 or 10 entries, got %d)", len(values))
 	}
 
 	instanceIndex, err := strconv.Atoi(values[0])
@@ -58,6 +89,17 @@ func NewInstanceHeartbeatFromCSV(appGuid, appVersion, instanceGuid string, encod
 
 	instance.DeaGuid = values[3]
 
+	if len(values) == 10 {
+		instance.Host = values[7]
+		instance.Port, err = strconv.Atoi(values[8])
+		if err != nil {
+			return InstanceHeartbeat{}, err
+		}
+		if values[9] != "" {
+			instance.Uris = strings.Split(values[9], " ")
+		}
+	}
+
 	return instance, nil
 }
 
@@ -65,6 +107,20 @@ func (instance InstanceHeartbeat) ToCSV() []byte {
 	return []byte(fmt.Sprintf("%d,%s,%.1f,%s", instance.InstanceIndex, instance.State, instance.StateTimestamp, instance.DeaGuid))
 }
 
+// HasAddress is true when the DEA said where the router reaches the
+// instance.
+func (instance InstanceHeartbeat) HasAddress() bool {
+	return instance.Host != "" && instance.Port > 0
+}
+
+// AddressToCSV encodes the instance's host, port and routes, separated by
+// spaces, to be appended to its CSV after its transitions.  Versions of
+// hm9000 that predate them cannot read the entries of instances with an
+// address.
+func (instance InstanceHeartbeat) AddressToCSV() []byte {
+	return []byte(fmt.Sprintf("%s,%d,%s", instance.Host, instance.Port, strings.Join(instance.Uris, " ")))
+}
+
 func NewInstanceHeartbeatFromJSON(encoded []byte) (InstanceHeartbeat, error) {
 	var instance InstanceHeartbeat
 	err := json.Unmarshal(encoded, &instance)
@@ -75,10 +131,30 @@ func NewInstanceHeartbeatFromJSON(encoded []byte) (InstanceHeartbeat, error) {
 }
 
 func (instance InstanceHeartbeat) ToJSON() []byte {
-	encoded, _ := json.Marshal(instance)
+	encoded, _ := CanonicalJSON(instance)
 	return encoded
 }
 
+func (instance *InstanceHeartbeat) UnmarshalJSON(encoded []byte) error {
+	var plain plainInstanceHeartbeat
+	err := json.Unmarshal(encoded, &plain)
+	if err != nil {
+		return err
+	}
+
+	plain.Extra, err = extraFields(encoded, instanceHeartbeatFields)
+	if err != nil {
+		return err
+	}
+
+	*instance = InstanceHeartbeat(plain)
+	return nil
+}
+
+func (instance InstanceHeartbeat) MarshalJSON() ([]byte, error) {
+	return encodeWithExtra(plainInstanceHeartbeat(instance), instance.Extra)
+}
+
 func (instance InstanceHeartbeat) StoreKey() string {
 	return instance.InstanceGuid
 }
@@ -68,6 +68,26 @@ var _ = Describe("InstanceHeartbeat", func() {
 
 				Ω(jsonInstance).Should(Equal(instance))
 			})
+
+			It("should ignore the instance's transitions", func() {
+				jsonInstance, err := NewInstanceHeartbeatFromCSV("abc", "xyz-123", "def", []byte(`3,RUNNING,1123.2,dea_abc,1400.0,1400.0,0.0`))
+
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(jsonInstance).Should(Equal(instance))
+			})
+
+			It("should read the instance's address after its transitions", func() {
+				jsonInstance, err := NewInstanceHeartbeatFromCSV("abc", "xyz-123", "def", []byte(`3,RUNNING,1123.2,dea_abc,1400.0,1400.0,0.0,10.0.0.1,61001,foo.example.com bar.example.com`))
+
+				Ω(err).ShouldNot(HaveOccurred())
+
+				expectedInstance := instance
+				expectedInstance.Host = "10.0.0.1"
+				expectedInstance.Port = 61001
+				expectedInstance.Uris = []string{"foo.example.com", "bar.example.com"}
+				Ω(jsonInstance).Should(Equal(expectedInstance))
+			})
 		})
 
 		Context("When the CSV is invalid", func() {
@@ -84,6 +104,10 @@ var _ = Describe("InstanceHeartbeat", func() {
 				instance, err = NewInstanceHeartbeatFromCSV("abc", "xyz-123", "def", []byte(`3,RUNNING,oops,dea_abc`))
 				Ω(instance).Should(BeZero())
 				Ω(err).Should(HaveOccurred())
+
+				instance, err = NewInstanceHeartbeatFromCSV("abc", "xyz-123", "def", []byte(`3,RUNNING,1123.2,dea_abc,1400.0,1400.0,0.0,10.0.0.1,oops,foo.example.com`))
+				Ω(instance).Should(BeZero())
+				Ω(err).Should(HaveOccurred())
 			})
 		})
 	})
@@ -97,6 +121,25 @@ var _ = Describe("InstanceHeartbeat", func() {
 		})
 	})
 
+	Describe("AddressToCSV", func() {
+		It("should encode the host, port and routes", func() {
+			instance.Host = "10.0.0.1"
+			instance.Port = 61001
+			instance.Uris = []string{"foo.example.com", "bar.example.com"}
+			Ω(string(instance.AddressToCSV())).Should(Equal("10.0.0.1,61001,foo.example.com bar.example.com"))
+		})
+	})
+
+	Describe("HasAddress", func() {
+		It("should be true only when the DEA sent a host and port", func() {
+			Ω(instance.HasAddress()).Should(BeFalse())
+			instance.Host = "10.0.0.1"
+			Ω(instance.HasAddress()).Should(BeFalse())
+			instance.Port = 61001
+			Ω(instance.HasAddress()).Should(BeTrue())
+		})
+	})
+
 	Describe("StoreKey", func() {
 		It("returns the key for the store", func() {
 			Ω(instance.StoreKey()).Should(Equal("def"))
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InstanceTransitions are when an instance last changed state, as hm9000
+// saw it: StateSince is when it entered the state it is in, StartedAt when
+// it last became RUNNING and LastCrashedAt when it last became CRASHED.
+// DEAs do not send them; the store keeps them as it writes heartbeats (see
+// Record).  Like StateTimestamp they are unix times in seconds, and 0 when
+// unknown.
+type InstanceTransitions struct {
+	StateSince    float64 `json:"state_since"`
+	StartedAt     float64 `json:"started_at,omitempty"`
+	LastCrashedAt float64 `json:"last_crashed_at,omitempty"`
+}
+
+// NewInstanceTransitionsFromCSV reads the transitions the store appends to
+// an instance heartbeat's CSV (see InstanceHeartbeat.ToCSV).  A heartbeat
+// written before the store kept them has none, and gives zero transitions.
+func NewInstanceTransitionsFromCSV(encoded []byte) (InstanceTransitions, error) {
+	values := strings.Split(string(encoded), ",")
+	if len(values) == 4 {
+		return InstanceTransitions{}, nil
+	}
+	if len(values) != 7 && len(values) != 10 {
+		return InstanceTransitions{}, fmt.Errorf("invalid CSV (need 4, 7 or 10 entries, got %d)", len(values))
+	}
+
+	transitions := InstanceTransitions{}
+	times := []*float64{&transitions.StateSince, &transitions.StartedAt, &transitions.LastCrashedAt}
+	for i, t := range times {
+		parsed, err := strconv.ParseFloat(values[4+i], 64)
+		if err != nil {
+			return InstanceTransitions{}, err
+		}
+		*t = parsed
+	}
+	return transitions, nil
+}
+
+// ToCSV encodes the transitions to be appended to an instance heartbeat's
+// CSV.
+func (transitions InstanceTransitions) ToCSV() []byte {
+	return []byte(fmt.Sprintf("%.1f,%.1f,%.1f", transitions.StateSince, transitions.StartedAt, transitions.LastCrashedAt))
+}
+
+// Record brings the transitions up to date for a heartbeat that arrived at
+// now in state, given the state the instance was last written in, if found.
+func (transitions InstanceTransitions) Record(previous InstanceState, found bool, state InstanceState, now time.Time) InstanceTransitions {
+	seconds := float64(now.UnixNano()) / float64(time.Second)
+
+	if !found || previous != state || transitions.StateSince == 0 {
+		transitions.StateSince = seconds
+	}
+	if state == InstanceStateRunning && (!found || previous != InstanceStateRunning) {
+		transitions.StartedAt = seconds
+	}
+	if state == InstanceStateCrashed && (!found || previous != InstanceStateCrashed) {
+		transitions.LastCrashedAt = seconds
+	}
+
+	return transitions
+}
+
+// InStateFor is how long, at now, the instance has been in its state, or 0
+// if that is unknown.
+func (transitions InstanceTransitions) InStateFor(now time.Time) time.Duration {
+	return since(transitions.StateSince, now)
+}
+
+// Uptime is how long, at now, a RUNNING instance has been running, or 0 if
+// hm9000 has not seen it start.
+func (transitions InstanceTransitions) Uptime(now time.Time) time.Duration {
+	return since(transitions.StartedAt, now)
+}
+
+// SinceLastCrash is how long, at now, it has been since the instance last
+// crashed, or 0 if hm9000 has not seen it crash.
+func (transitions InstanceTransitions) SinceLastCrash(now time.Time) time.Duration {
+	return since(transitions.LastCrashedAt, now)
+}
+
+func since(seconds float64, now time.Time) time.Duration {
+	if seconds == 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, int64(seconds*float64(time.Second))))
+}
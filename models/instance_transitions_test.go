@@ -0,0 +1,87 @@
+package models_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InstanceTransitions", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Unix(1400, 0)
+	})
+
+	Describe("Record", func() {
+		It("records when a new instance entered its state", func() {
+			transitions := InstanceTransitions{}.Record("", false, InstanceStateStarting, now)
+			Ω(transitions).Should(Equal(InstanceTransitions{StateSince: 1400}))
+
+			transitions = InstanceTransitions{}.Record("", false, InstanceStateRunning, now)
+			Ω(transitions).Should(Equal(InstanceTransitions{StateSince: 1400, StartedAt: 1400}))
+		})
+
+		It("records when the instance started and crashed", func() {
+			transitions := InstanceTransitions{}.Record("", false, InstanceStateStarting, now)
+			transitions = transitions.Record(InstanceStateStarting, true, InstanceStateRunning, now.Add(10*time.Second))
+			Ω(transitions).Should(Equal(InstanceTransitions{StateSince: 1410, StartedAt: 1410}))
+
+			transitions = transitions.Record(InstanceStateRunning, true, InstanceStateCrashed, now.Add(20*time.Second))
+			Ω(transitions).Should(Equal(InstanceTransitions{StateSince: 1420, StartedAt: 1410, LastCrashedAt: 1420}))
+
+			transitions = transitions.Record(InstanceStateCrashed, true, InstanceStateRunning, now.Add(30*time.Second))
+			Ω(transitions).Should(Equal(InstanceTransitions{StateSince: 1430, StartedAt: 1430, LastCrashedAt: 1420}))
+		})
+
+		It("keeps the transitions while the state holds", func() {
+			transitions := InstanceTransitions{StateSince: 1410, StartedAt: 1410}
+			Ω(transitions.Record(InstanceStateRunning, true, InstanceStateRunning, now.Add(time.Minute))).Should(Equal(transitions))
+		})
+
+		It("starts the clock on instances whose transitions are unknown", func() {
+			transitions := InstanceTransitions{}.Record(InstanceStateRunning, true, InstanceStateRunning, now)
+			Ω(transitions).Should(Equal(InstanceTransitions{StateSince: 1400}))
+		})
+	})
+
+	Describe("durations", func() {
+		It("reports how long the instance has been in its state and running", func() {
+			transitions := InstanceTransitions{StateSince: 1390, StartedAt: 1380, LastCrashedAt: 1370}
+			Ω(transitions.InStateFor(now)).Should(Equal(10 * time.Second))
+			Ω(transitions.Uptime(now)).Should(Equal(20 * time.Second))
+			Ω(transitions.SinceLastCrash(now)).Should(Equal(30 * time.Second))
+		})
+
+		It("reports zero when it does not know", func() {
+			Ω(InstanceTransitions{}.InStateFor(now)).Should(BeZero())
+			Ω(InstanceTransitions{}.Uptime(now)).Should(BeZero())
+			Ω(InstanceTransitions{}.SinceLastCrash(now)).Should(BeZero())
+		})
+	})
+
+	Describe("CSV", func() {
+		It("round trips", func() {
+			transitions := InstanceTransitions{StateSince: 1420.5, StartedAt: 1410, LastCrashedAt: 1420.5}
+			decoded, err := NewInstanceTransitionsFromCSV([]byte("3,RUNNING,1123.2,dea_abc," + string(transitions.ToCSV())))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(Equal(transitions))
+		})
+
+		It("gives zero transitions for heartbeats stored without them", func() {
+			decoded, err := NewInstanceTransitionsFromCSV([]byte("3,RUNNING,1123.2,dea_abc"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded).Should(BeZero())
+		})
+
+		It("errors on invalid CSV", func() {
+			_, err := NewInstanceTransitionsFromCSV([]byte("3,RUNNING,1123.2,dea_abc,oops,0.0,0.0"))
+			Ω(err).Should(HaveOccurred())
+
+			_, err = NewInstanceTransitionsFromCSV([]byte("3,RUNNING,1123.2,dea_abc,0.0"))
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
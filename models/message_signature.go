@@ -0,0 +1,91 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MessageSignature is the hex encoded HMAC-SHA256, keyed by secret, of the
+// signed fields of a message joined by newlines.  The signed fields are, in
+// this order:
+//
+//	start: "start", message_id, droplet, version, instance_index, signed_at, nonce
+//	stop:  "stop", message_id, droplet, version, instance_guid, instance_index, is_duplicate, signed_at, nonce
+//
+// with numbers in decimal and is_duplicate as "true" or "false".  Other
+// members of a message are not signed.
+func MessageSignature(secret string, fields []string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validSignature is true when signature signs fields with secret, and
+// signedAt is within maxAge of now.
+func validSignature(secret string, signature string, fields []string, signedAt int64, now time.Time, maxAge time.Duration) bool {
+	age := now.Sub(time.Unix(signedAt, 0))
+	if age > maxAge || age < -maxAge {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(MessageSignature(secret, fields)))
+}
+
+func (message StartMessage) signedFields() []string {
+	return []string{
+		"start",
+		message.MessageId,
+		message.AppGuid,
+		message.AppVersion,
+		strconv.Itoa(message.InstanceIndex),
+		strconv.FormatInt(message.SignedAt, 10),
+		message.Nonce,
+	}
+}
+
+// Signed returns the message signed with secret at now, with a fresh nonce.
+func (message StartMessage) Signed(secret string, now time.Time) StartMessage {
+	message.SignedAt = now.Unix()
+	message.Nonce = Guid()
+	message.Signature = MessageSignature(secret, message.signedFields())
+	return message
+}
+
+// HasValidSignature is true when the message was signed with secret within
+// maxAge of now, and its signed fields have not been changed since.  Telling
+// a replay within maxAge is up to the receiver, by the nonce.
+func (message StartMessage) HasValidSignature(secret string, now time.Time, maxAge time.Duration) bool {
+	return validSignature(secret, message.Signature, message.signedFields(), message.SignedAt, now, maxAge)
+}
+
+func (message StopMessage) signedFields() []string {
+	return []string{
+		"stop",
+		message.MessageId,
+		message.AppGuid,
+		message.AppVersion,
+		message.InstanceGuid,
+		strconv.Itoa(message.InstanceIndex),
+		strconv.FormatBool(message.IsDuplicate),
+		strconv.FormatInt(message.SignedAt, 10),
+		message.Nonce,
+	}
+}
+
+// Signed returns the message signed with secret at now, with a fresh nonce.
+func (message StopMessage) Signed(secret string, now time.Time) StopMessage {
+	message.SignedAt = now.Unix()
+	message.Nonce = Guid()
+	message.Signature = MessageSignature(secret, message.signedFields())
+	return message
+}
+
+// HasValidSignature is true when the message was signed with secret within
+// maxAge of now, and its signed fields have not been changed since.  Telling
+// a replay within maxAge is up to the receiver, by the nonce.
+func (message StopMessage) HasValidSignature(secret string, now time.Time, maxAge time.Duration) bool {
+	return validSignature(secret, message.Signature, message.signedFields(), message.SignedAt, now, maxAge)
+}
@@ -0,0 +1,90 @@
+package models_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Message signatures", func() {
+	var (
+		start StartMessage
+		stop  StopMessage
+		now   time.Time
+	)
+
+	BeforeEach(func() {
+		start = StartMessage{MessageId: "abc", AppGuid: "app", AppVersion: "version", InstanceIndex: 1, Reason: ReasonCodeCrashed}
+		stop = StopMessage{MessageId: "def", AppGuid: "app", AppVersion: "version", InstanceGuid: "instance", InstanceIndex: 2, IsDuplicate: true}
+		now = time.Unix(1000, 0)
+	})
+
+	It("signs the documented fields, with the time and a nonce", func() {
+		signed := start.Signed("secret", now)
+		Ω(signed.SignedAt).Should(BeNumerically("==", 1000))
+		Ω(signed.Nonce).ShouldNot(BeEmpty())
+		Ω(signed.Signature).Should(Equal(MessageSignature("secret", []string{"start", "abc", "app", "version", "1", "1000", signed.Nonce})))
+		Ω(signed.Signature).Should(HaveLen(64))
+
+		signedStop := stop.Signed("secret", now)
+		Ω(signedStop.Signature).Should(Equal(MessageSignature("secret", []string{"stop", "def", "app", "version", "instance", "2", "true", "1000", signedStop.Nonce})))
+	})
+
+	It("can be checked from the published JSON, whatever the order of its members", func() {
+		signed := stop.Signed("secret", now)
+
+		// What a DEA or the CC would do: pick the signed fields out of the payload.
+		decoded := map[string]interface{}{}
+		Ω(json.Unmarshal(signed.ToJSON(), &decoded)).Should(Succeed())
+		Ω(decoded["signed_at"]).Should(BeNumerically("==", 1000))
+		Ω(decoded["nonce"]).Should(Equal(signed.Nonce))
+		Ω(decoded["signature"]).Should(Equal(signed.Signature))
+	})
+
+	It("gives each signing a nonce of its own", func() {
+		Ω(start.Signed("secret", now).Nonce).ShouldNot(Equal(start.Signed("secret", now).Nonce))
+	})
+
+	It("leaves the signature out of unsigned messages", func() {
+		Ω(string(start.ToJSON())).ShouldNot(ContainSubstring("signature"))
+		Ω(string(start.ToJSON())).ShouldNot(ContainSubstring("nonce"))
+		Ω(string(stop.ToJSON())).ShouldNot(ContainSubstring("signature"))
+	})
+
+	It("verifies messages signed with the secret", func() {
+		Ω(start.Signed("secret", now).HasValidSignature("secret", now, time.Minute)).Should(BeTrue())
+		Ω(stop.Signed("secret", now).HasValidSignature("secret", now, time.Minute)).Should(BeTrue())
+
+		decoded, err := NewStopMessageFromJSON(stop.Signed("secret", now).ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded.HasValidSignature("secret", now.Add(30*time.Second), time.Minute)).Should(BeTrue())
+	})
+
+	It("rejects messages signed with another secret, changed since or not signed", func() {
+		Ω(start.Signed("other", now).HasValidSignature("secret", now, time.Minute)).Should(BeFalse())
+		Ω(start.HasValidSignature("secret", now, time.Minute)).Should(BeFalse())
+
+		tampered := stop.Signed("secret", now)
+		tampered.InstanceGuid = "another-instance"
+		Ω(tampered.HasValidSignature("secret", now, time.Minute)).Should(BeFalse())
+
+		backdated := stop.Signed("secret", now)
+		backdated.SignedAt = 2000
+		Ω(backdated.HasValidSignature("secret", time.Unix(2000, 0), time.Minute)).Should(BeFalse())
+	})
+
+	It("rejects messages signed longer than the max age ago, or as long ahead", func() {
+		signed := start.Signed("secret", now)
+		Ω(signed.HasValidSignature("secret", now.Add(time.Minute), time.Minute)).Should(BeTrue())
+		Ω(signed.HasValidSignature("secret", now.Add(61*time.Second), time.Minute)).Should(BeFalse())
+		Ω(signed.HasValidSignature("secret", now.Add(-61*time.Second), time.Minute)).Should(BeFalse())
+	})
+
+	It("does not depend on the signature already on a message", func() {
+		resigned := start.Signed("other", now).Signed("secret", now)
+		Ω(resigned.HasValidSignature("secret", now, time.Minute)).Should(BeTrue())
+	})
+})
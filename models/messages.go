@@ -5,19 +5,63 @@ import (
 )
 
 type StartMessage struct {
-	MessageId     string `json:"message_id"`
-	AppGuid       string `json:"droplet"`
-	AppVersion    string `json:"version"`
-	InstanceIndex int    `json:"instance_index"`
+	MessageId     string     `json:"message_id"`
+	AppGuid       string     `json:"droplet"`
+	AppVersion    string     `json:"version"`
+	InstanceIndex int        `json:"instance_index"`
+	Reason        ReasonCode `json:"reason,omitempty"`
+	Origin        Origin     `json:"origin,omitempty"`
+
+	PlacementHints *PlacementHints `json:"placement_hints,omitempty"`
+
+	SignedAt  int64  `json:"signed_at,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	Signature string `json:"signature,omitempty"`
 }
 
 type StopMessage struct {
-	MessageId     string `json:"message_id"`
-	AppGuid       string `json:"droplet"`
-	AppVersion    string `json:"version"`
-	InstanceGuid  string `json:"instance_guid"`
-	InstanceIndex int    `json:"instance_index"`
-	IsDuplicate   bool   `json:"is_duplicate"`
+	MessageId     string     `json:"message_id"`
+	AppGuid       string     `json:"droplet"`
+	AppVersion    string     `json:"version"`
+	InstanceGuid  string     `json:"instance_guid"`
+	InstanceIndex int        `json:"instance_index"`
+	IsDuplicate   bool       `json:"is_duplicate"`
+	Reason        ReasonCode `json:"reason,omitempty"`
+	Origin        Origin     `json:"origin,omitempty"`
+
+	// Category and InitiatedBy say why the sender sent the stop, so that
+	// stops hm9000 chose to send can be told from those the Cloud
+	// Controller asked for.
+	Category    StopCategory  `json:"category,omitempty"`
+	InitiatedBy StopInitiator `json:"initiated_by,omitempty"`
+
+	SignedAt  int64  `json:"signed_at,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// RouterUnregisterMessage asks the routers to stop sending an instance's
+// routes to it, as the DEA would when it stops the instance.
+type RouterUnregisterMessage struct {
+	Host              string   `json:"host"`
+	Port              int      `json:"port"`
+	Uris              []string `json:"uris"`
+	AppGuid           string   `json:"app"`
+	PrivateInstanceId string   `json:"private_instance_id"`
+}
+
+func NewRouterUnregisterMessage(instance InstanceHeartbeat) RouterUnregisterMessage {
+	uris := instance.Uris
+	if uris == nil {
+		uris = []string{}
+	}
+	return RouterUnregisterMessage{
+		Host:              instance.Host,
+		Port:              instance.Port,
+		Uris:              uris,
+		AppGuid:           instance.AppGuid,
+		PrivateInstanceId: instance.InstanceGuid,
+	}
 }
 
 func NewStartMessageFromJSON(encoded []byte) (StartMessage, error) {
@@ -39,11 +83,16 @@ func NewStopMessageFromJSON(encoded []byte) (StopMessage, error) {
 }
 
 func (message StartMessage) ToJSON() []byte {
-	result, _ := json.Marshal(message)
+	result, _ := CanonicalJSON(message)
 	return result
 }
 
 func (message StopMessage) ToJSON() []byte {
-	result, _ := json.Marshal(message)
+	result, _ := CanonicalJSON(message)
+	return result
+}
+
+func (message RouterUnregisterMessage) ToJSON() []byte {
+	result, _ := CanonicalJSON(message)
 	return result
 }
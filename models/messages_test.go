@@ -62,6 +62,18 @@ var _ = Describe("Messages", func() {
 				Ω(json).Should(ContainSubstring(`"instance_index":1`))
 				Ω(json).Should(ContainSubstring(`"is_duplicate":true`))
 				Ω(json).Should(ContainSubstring(`"message_id":"msg-id"`))
+				Ω(json).ShouldNot(ContainSubstring(`"category"`))
+			})
+
+			It("should carry the stop's category and initiator, when it has one", func() {
+				message := StopMessage{
+					MessageId:   "msg-id",
+					Category:    StopCategoryDuplicate,
+					InitiatedBy: StopInitiatorHM,
+				}
+				json := string(message.ToJSON())
+				Ω(json).Should(ContainSubstring(`"category":"DUPLICATE"`))
+				Ω(json).Should(ContainSubstring(`"initiated_by":"hm"`))
 			})
 		})
 		Describe("NewStopMessageFromJSON", func() {
@@ -86,4 +98,31 @@ var _ = Describe("Messages", func() {
 			})
 		})
 	})
+
+	Describe("RouterUnregisterMessages", func() {
+		Describe("ToJSON", func() {
+			It("should have the fields the routers expect", func() {
+				message := NewRouterUnregisterMessage(InstanceHeartbeat{
+					AppGuid:      "abc",
+					AppVersion:   "123",
+					InstanceGuid: "def",
+					Host:         "10.0.0.1",
+					Port:         61001,
+					Uris:         []string{"foo.example.com"},
+				})
+				Ω(message.ToJSON()).Should(MatchJSON(`{
+					"host": "10.0.0.1",
+					"port": 61001,
+					"uris": ["foo.example.com"],
+					"app": "abc",
+					"private_instance_id": "def"
+				}`))
+			})
+
+			It("should send an empty list of routes rather than null", func() {
+				message := NewRouterUnregisterMessage(InstanceHeartbeat{AppGuid: "abc", InstanceGuid: "def", Host: "10.0.0.1", Port: 61001})
+				Ω(string(message.ToJSON())).Should(ContainSubstring(`"uris":[]`))
+			})
+		})
+	})
 })
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// PendingMessageState is where a pending message is in its life: waiting
+// for its send time, ready for the sender to send, or sent and kept until
+// its keep alive runs out.
+type PendingMessageState string
+
+const (
+	PendingMessageStatePending PendingMessageState = "pending"
+	PendingMessageStateReady   PendingMessageState = "ready"
+	PendingMessageStateSent    PendingMessageState = "sent"
+)
+
+// State is the state of the message at currentTime.
+func (message PendingMessage) State(currentTime time.Time) PendingMessageState {
+	if message.HasBeenSent() {
+		return PendingMessageStateSent
+	}
+	if message.IsTimeToSend(currentTime) {
+		return PendingMessageStateReady
+	}
+	return PendingMessageStatePending
+}
+
+// PendingMessageCount is how many pending messages of a type ("start" or
+// "stop") and reason are in a state.
+type PendingMessageCount struct {
+	State  PendingMessageState `json:"state"`
+	Type   string              `json:"type"`
+	Reason string              `json:"reason"`
+	Count  int                 `json:"count"`
+}
+
+// PendingMessageDistribution counts the pending messages in the store, as
+// they were at ScannedAt, by state, type and reason.  The counts are sorted
+// by state, type and reason, and only the combinations with messages are
+// listed.
+type PendingMessageDistribution struct {
+	ScannedAt int64                 `json:"scanned_at"`
+	Total     int                   `json:"total"`
+	Counts    []PendingMessageCount `json:"counts"`
+}
+
+func NewPendingMessageDistribution(currentTime time.Time, starts map[string]PendingStartMessage, stops map[string]PendingStopMessage) PendingMessageDistribution {
+	counts := map[PendingMessageCount]int{}
+	for _, start := range starts {
+		counts[PendingMessageCount{State: start.State(currentTime), Type: "start", Reason: string(start.StartReason)}]++
+	}
+	for _, stop := range stops {
+		counts[PendingMessageCount{State: stop.State(currentTime), Type: "stop", Reason: string(stop.StopReason)}]++
+	}
+
+	distribution := PendingMessageDistribution{
+		ScannedAt: currentTime.Unix(),
+		Total:     len(starts) + len(stops),
+		Counts:    []PendingMessageCount{},
+	}
+	for bucket, count := range counts {
+		bucket.Count = count
+		distribution.Counts = append(distribution.Counts, bucket)
+	}
+	sort.Sort(pendingMessageCountsByBucket(distribution.Counts))
+
+	return distribution
+}
+
+func NewPendingMessageDistributionFromJSON(encoded []byte) (PendingMessageDistribution, error) {
+	distribution := PendingMessageDistribution{}
+	err := json.Unmarshal(encoded, &distribution)
+	if err != nil {
+		return PendingMessageDistribution{}, err
+	}
+	return distribution, nil
+}
+
+func (distribution PendingMessageDistribution) ToJSON() []byte {
+	result, _ := CanonicalJSON(distribution)
+	return result
+}
+
+type pendingMessageCountsByBucket []PendingMessageCount
+
+func (a pendingMessageCountsByBucket) Len() int      { return len(a) }
+func (a pendingMessageCountsByBucket) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a pendingMessageCountsByBucket) Less(i, j int) bool {
+	if a[i].State != a[j].State {
+		return a[i].State < a[j].State
+	}
+	if a[i].Type != a[j].Type {
+		return a[i].Type < a[j].Type
+	}
+	return a[i].Reason < a[j].Reason
+}
@@ -0,0 +1,82 @@
+package models_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PendingMessageDistribution", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Unix(100, 0)
+	})
+
+	sent := func(message PendingMessage) PendingMessage {
+		message.SentOn = 95
+		return message
+	}
+
+	Describe("State", func() {
+		It("is pending until the message's send time", func() {
+			message := NewPendingStartMessage(now, 10, 10, "app", "version", 0, 1, PendingStartMessageReasonMissing)
+			Ω(message.State(now)).Should(Equal(PendingMessageStatePending))
+			Ω(message.State(now.Add(10 * time.Second))).Should(Equal(PendingMessageStateReady))
+		})
+
+		It("is sent once the message has been sent", func() {
+			message := NewPendingStartMessage(now, 0, 10, "app", "version", 0, 1, PendingStartMessageReasonMissing)
+			message.PendingMessage = sent(message.PendingMessage)
+			Ω(message.State(now)).Should(Equal(PendingMessageStateSent))
+		})
+	})
+
+	It("counts the messages by state, type and reason", func() {
+		readyCrash := NewPendingStartMessage(now, 0, 10, "a", "version", 0, 1, PendingStartMessageReasonCrashed)
+		otherReadyCrash := NewPendingStartMessage(now, 0, 10, "a", "version", 1, 1, PendingStartMessageReasonCrashed)
+		pendingMissing := NewPendingStartMessage(now, 30, 10, "b", "version", 0, 1, PendingStartMessageReasonMissing)
+		sentExtra := NewPendingStopMessage(now, 0, 10, "c", "version", "instance", PendingStopMessageReasonExtra)
+		sentExtra.PendingMessage = sent(sentExtra.PendingMessage)
+
+		distribution := NewPendingMessageDistribution(now,
+			map[string]PendingStartMessage{
+				readyCrash.StoreKey():      readyCrash,
+				otherReadyCrash.StoreKey(): otherReadyCrash,
+				pendingMissing.StoreKey():  pendingMissing,
+			},
+			map[string]PendingStopMessage{sentExtra.StoreKey(): sentExtra},
+		)
+
+		Ω(distribution).Should(Equal(PendingMessageDistribution{
+			ScannedAt: 100,
+			Total:     4,
+			Counts: []PendingMessageCount{
+				{State: PendingMessageStatePending, Type: "start", Reason: "MISSING", Count: 1},
+				{State: PendingMessageStateReady, Type: "start", Reason: "CRASHED", Count: 2},
+				{State: PendingMessageStateSent, Type: "stop", Reason: "EXTRA", Count: 1},
+			},
+		}))
+	})
+
+	It("has no counts when there are no messages", func() {
+		distribution := NewPendingMessageDistribution(now, map[string]PendingStartMessage{}, map[string]PendingStopMessage{})
+		Ω(distribution.Total).Should(BeZero())
+		Ω(distribution.Counts).Should(BeEmpty())
+	})
+
+	It("round trips through JSON", func() {
+		distribution := PendingMessageDistribution{
+			ScannedAt: 100,
+			Total:     1,
+			Counts:    []PendingMessageCount{{State: PendingMessageStateReady, Type: "stop", Reason: "DUPLICATE", Count: 1}},
+		}
+		Ω(distribution.ToJSON()).Should(MatchJSON(`{"scanned_at":100,"total":1,"counts":[{"state":"ready","type":"stop","reason":"DUPLICATE","count":1}]}`))
+
+		decoded, err := NewPendingMessageDistributionFromJSON(distribution.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(distribution))
+	})
+})
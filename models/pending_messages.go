@@ -14,6 +14,11 @@ const (
 	PendingStartMessageReasonCrashed    PendingStartMessageReason = "CRASHED"
 	PendingStartMessageReasonMissing    PendingStartMessageReason = "MISSING"
 	PendingStartMessageReasonEvacuating PendingStartMessageReason = "EVACUATING"
+	PendingStartMessageReasonOperator   PendingStartMessageReason = "OPERATOR"
+
+	// PendingStartMessageReasonPreemptive starts a replacement for an
+	// instance on a DEA that is about to be shut down.
+	PendingStartMessageReasonPreemptive PendingStartMessageReason = "PREEMPTIVE"
 )
 
 type PendingStopMessageReason string
@@ -23,8 +28,75 @@ const (
 	PendingStopMessageReasonExtra              PendingStopMessageReason = "EXTRA"
 	PendingStopMessageReasonDuplicate          PendingStopMessageReason = "DUPLICATE"
 	PendingStopMessageReasonEvacuationComplete PendingStopMessageReason = "EVACUATION_COMPLETE"
+	PendingStopMessageReasonOperator           PendingStopMessageReason = "OPERATOR"
+)
+
+// ReasonCode is why a start or stop was sent, as downstream systems are
+// told in the start and stop payloads.  It is coarser than the pending
+// message reasons: an evacuation start and the stop that completes it share
+// EVACUATION.
+type ReasonCode string
+
+const (
+	ReasonCodeInvalid    ReasonCode = ""
+	ReasonCodeCrashed    ReasonCode = "CRASHED"
+	ReasonCodeMissing    ReasonCode = "MISSING"
+	ReasonCodeEvacuation ReasonCode = "EVACUATION"
+	ReasonCodeDuplicate  ReasonCode = "DUPLICATE"
+	ReasonCodeExtra      ReasonCode = "EXTRA"
+	ReasonCodeOperator   ReasonCode = "OPERATOR"
+)
+
+// Origin is the component that decided a start or stop was needed.
+// Messages enqueued by versions of hm9000 that did not record it have none.
+type Origin string
+
+const (
+	OriginUnknown   Origin = ""
+	OriginAnalyzer  Origin = "analyzer"
+	OriginEvacuator Origin = "evacuator"
+	OriginOperator  Origin = "operator"
+)
+
+// StopCategory is why the sender found a stop was still needed when it sent
+// it.  Scale downs and stops of apps that are no longer desired, in any
+// version, carry out what the Cloud Controller asked for; the rest are
+// hm9000's own decisions about instances the Cloud Controller still wants
+// running, and are what to audit.
+type StopCategory string
+
+const (
+	StopCategoryInvalid           StopCategory = ""
+	StopCategoryScaleDown         StopCategory = "SCALE_DOWN"
+	StopCategoryAppStopped        StopCategory = "APP_STOPPED"
+	StopCategoryMismatchedVersion StopCategory = "MISMATCHED_VERSION"
+	StopCategoryDuplicate         StopCategory = "DUPLICATE"
+	StopCategoryEvacuation        StopCategory = "EVACUATION"
+	StopCategoryOperator          StopCategory = "OPERATOR"
+)
+
+// StopInitiator is who a stop carries out the wishes of.
+type StopInitiator string
+
+const (
+	StopInitiatorUnknown  StopInitiator = ""
+	StopInitiatorCC       StopInitiator = "cc"
+	StopInitiatorHM       StopInitiator = "hm"
+	StopInitiatorOperator StopInitiator = "operator"
 )
 
+func (category StopCategory) Initiator() StopInitiator {
+	switch category {
+	case StopCategoryScaleDown, StopCategoryAppStopped:
+		return StopInitiatorCC
+	case StopCategoryMismatchedVersion, StopCategoryDuplicate, StopCategoryEvacuation:
+		return StopInitiatorHM
+	case StopCategoryOperator:
+		return StopInitiatorOperator
+	}
+	return StopInitiatorUnknown
+}
+
 type PendingMessage struct {
 	MessageId  string `json:"message_id"`
 	SendOn     int64  `json:"send_on"`
@@ -32,6 +104,7 @@ type PendingMessage struct {
 	KeepAlive  int    `json:"keep_alive"`
 	AppGuid    string `json:"droplet"`
 	AppVersion string `json:"version"`
+	Origin     Origin `json:"origin,omitempty"`
 }
 
 type PendingStartMessage struct {
@@ -40,6 +113,10 @@ type PendingStartMessage struct {
 	Priority         float64                   `json:"priority"`
 	SkipVerification bool                      `json:"skip_verification"` //This only exists to allow the evacuator to specify that a message *must* be sent, regardless of verification status
 	StartReason      PendingStartMessageReason `json:"start_reason"`
+
+	// PlacementHints, if any, are sent with the start message.  They are
+	// advice, and are not compared by Equal.
+	PlacementHints *PlacementHints `json:"placement_hints,omitempty"`
 }
 
 type PendingStopMessage struct {
@@ -67,6 +144,7 @@ func (message PendingMessage) pendingLogDescription() map[string]string {
 		"MessageId":  message.MessageId,
 		"AppGuid":    message.AppGuid,
 		"AppVersion": message.AppVersion,
+		"Origin":     string(message.Origin),
 	}
 }
 
@@ -135,8 +213,30 @@ func (message PendingStartMessage) StoreKey() string {
 	return message.AppGuid + "-" + message.AppVersion + "-" + strconv.Itoa(message.IndexToStart)
 }
 
+// EquivalenceKey identifies what a start message asks for.  Two messages with
+// the same key start the same index of the same app, whatever their reasons,
+// and only one of them needs to be pending.
+func (message PendingStartMessage) EquivalenceKey() string {
+	return message.AppGuid + "," + message.AppVersion + "," + strconv.Itoa(message.IndexToStart)
+}
+
+// ReasonCode is the reason code sent with the start message.
+func (message PendingStartMessage) ReasonCode() ReasonCode {
+	switch message.StartReason {
+	case PendingStartMessageReasonCrashed:
+		return ReasonCodeCrashed
+	case PendingStartMessageReasonMissing:
+		return ReasonCodeMissing
+	case PendingStartMessageReasonEvacuating, PendingStartMessageReasonPreemptive:
+		return ReasonCodeEvacuation
+	case PendingStartMessageReasonOperator:
+		return ReasonCodeOperator
+	}
+	return ReasonCodeInvalid
+}
+
 func (message PendingStartMessage) ToJSON() []byte {
-	encoded, _ := json.Marshal(message)
+	encoded, _ := CanonicalJSON(message)
 	return encoded
 }
 
@@ -145,6 +245,11 @@ func (message PendingStartMessage) LogDescription() map[string]string {
 	base["IndexToStart"] = strconv.Itoa(message.IndexToStart)
 	base["SkipVerification"] = strconv.FormatBool(message.SkipVerification)
 	base["StartReason"] = string(message.StartReason)
+	if message.PlacementHints != nil {
+		for key, value := range message.PlacementHints.LogDescription() {
+			base[key] = value
+		}
+	}
 	return base
 }
 
@@ -173,15 +278,57 @@ func NewPendingStopMessageFromJSON(encoded []byte) (PendingStopMessage, error) {
 	return message, nil
 }
 
+type sortablePendingStopMessagesBySendOn []PendingStopMessage
+
+func (s sortablePendingStopMessagesBySendOn) Len() int      { return len(s) }
+func (s sortablePendingStopMessagesBySendOn) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sortablePendingStopMessagesBySendOn) Less(i, j int) bool {
+	if s[i].SendOn == s[j].SendOn {
+		return s[i].InstanceGuid < s[j].InstanceGuid
+	}
+	return s[i].SendOn < s[j].SendOn
+}
+
+func SortStopMessagesBySendOn(messages map[string]PendingStopMessage) []PendingStopMessage {
+	sortedStopMessages := make(sortablePendingStopMessagesBySendOn, 0, len(messages))
+	for _, message := range messages {
+		sortedStopMessages = append(sortedStopMessages, message)
+	}
+	sort.Sort(sortedStopMessages)
+	return sortedStopMessages
+}
+
 func (message PendingStopMessage) ToJSON() []byte {
-	encoded, _ := json.Marshal(message)
+	encoded, _ := CanonicalJSON(message)
 	return encoded
 }
 
+// ReasonCode is the reason code sent with the stop message.
+func (message PendingStopMessage) ReasonCode() ReasonCode {
+	switch message.StopReason {
+	case PendingStopMessageReasonExtra:
+		return ReasonCodeExtra
+	case PendingStopMessageReasonDuplicate:
+		return ReasonCodeDuplicate
+	case PendingStopMessageReasonEvacuationComplete:
+		return ReasonCodeEvacuation
+	case PendingStopMessageReasonOperator:
+		return ReasonCodeOperator
+	}
+	return ReasonCodeInvalid
+}
+
 func (message PendingStopMessage) StoreKey() string {
 	return message.InstanceGuid
 }
 
+// EquivalenceKey identifies what a stop message asks for, whatever its
+// reason.  The instance guid stands in for the index: an instance only ever
+// runs at one index.
+func (message PendingStopMessage) EquivalenceKey() string {
+	return message.AppGuid + "," + message.AppVersion + "," + message.InstanceGuid
+}
+
 func (message PendingStopMessage) LogDescription() map[string]string {
 	base := message.pendingLogDescription()
 	base["InstanceGuid"] = message.InstanceGuid
@@ -80,6 +80,23 @@ var _ = Describe("Pending Messages", func() {
 			})
 		})
 
+		Describe("EquivalenceKey", func() {
+			It("should be shared by messages that start the same index", func() {
+				anotherMessage := NewPendingStartMessage(time.Unix(200, 0), 0, 30, "app-guid", "app-version", 1, 0.5, PendingStartMessageReasonCrashed)
+				Ω(message.EquivalenceKey()).Should(Equal(anotherMessage.EquivalenceKey()))
+			})
+
+			It("should not differ by reason", func() {
+				anotherMessage := NewPendingStartMessage(time.Unix(100, 0), 30, 10, "app-guid", "app-version", 1, 1.0, PendingStartMessageReasonMissing)
+				Ω(message.EquivalenceKey()).Should(Equal(anotherMessage.EquivalenceKey()))
+			})
+
+			It("should differ by index", func() {
+				anotherMessage := NewPendingStartMessage(time.Unix(100, 0), 30, 10, "app-guid", "app-version", 2, 1.0, PendingStartMessageReasonCrashed)
+				Ω(message.EquivalenceKey()).ShouldNot(Equal(anotherMessage.EquivalenceKey()))
+			})
+		})
+
 		Describe("LogDescription", func() {
 			It("should generate an appropriate map", func() {
 				Ω(message.LogDescription()).Should(Equal(map[string]string{
@@ -88,6 +105,7 @@ var _ = Describe("Pending Messages", func() {
 					"KeepAlive":        "10",
 					"AppGuid":          "app-guid",
 					"AppVersion":       "app-version",
+					"Origin":           "",
 					"IndexToStart":     "1",
 					"MessageId":        message.MessageId,
 					"SkipVerification": "false",
@@ -219,6 +237,23 @@ var _ = Describe("Pending Messages", func() {
 			})
 		})
 
+		Describe("EquivalenceKey", func() {
+			It("should be shared by messages that stop the same instance", func() {
+				anotherMessage := NewPendingStopMessage(time.Unix(200, 0), 0, 30, "app-guid", "app-version", "instance-guid", PendingStopMessageReasonExtra)
+				Ω(message.EquivalenceKey()).Should(Equal(anotherMessage.EquivalenceKey()))
+			})
+
+			It("should not differ by reason", func() {
+				anotherMessage := NewPendingStopMessage(time.Unix(100, 0), 30, 10, "app-guid", "app-version", "instance-guid", PendingStopMessageReasonDuplicate)
+				Ω(message.EquivalenceKey()).Should(Equal(anotherMessage.EquivalenceKey()))
+			})
+
+			It("should differ by instance", func() {
+				anotherMessage := NewPendingStopMessage(time.Unix(100, 0), 30, 10, "app-guid", "app-version", "another-instance-guid", PendingStopMessageReasonExtra)
+				Ω(message.EquivalenceKey()).ShouldNot(Equal(anotherMessage.EquivalenceKey()))
+			})
+		})
+
 		Describe("LogDescription", func() {
 			It("should generate an appropriate map", func() {
 				Ω(message.LogDescription()).Should(Equal(map[string]string{
@@ -228,6 +263,7 @@ var _ = Describe("Pending Messages", func() {
 					"InstanceGuid": "instance-guid",
 					"AppGuid":      "app-guid",
 					"AppVersion":   "app-version",
+					"Origin":       "",
 					"MessageId":    message.MessageId,
 					"StopReason":   "EXTRA",
 				}))
@@ -268,6 +304,22 @@ var _ = Describe("Pending Messages", func() {
 				Ω(message.Equal(mutatedMessage)).Should(BeFalse())
 			})
 		})
+
+		Describe("Sorting stop messages", func() {
+			It("should sort the passed in hash in order of time, then instance", func() {
+				stopMessages := map[string]PendingStopMessage{
+					"C": NewPendingStopMessage(time.Unix(100, 0), 30, 10, "app-guid", "app-version", "C", PendingStopMessageReasonExtra),
+					"B": NewPendingStopMessage(time.Unix(100, 0), 30, 10, "app-guid", "app-version", "B", PendingStopMessageReasonExtra),
+					"A": NewPendingStopMessage(time.Unix(110, 0), 30, 10, "app-guid", "app-version", "A", PendingStopMessageReasonExtra),
+				}
+
+				sortedStopMessages := SortStopMessagesBySendOn(stopMessages)
+				Ω(sortedStopMessages).Should(HaveLen(3))
+				Ω(sortedStopMessages[0].InstanceGuid).Should(Equal("B"))
+				Ω(sortedStopMessages[1].InstanceGuid).Should(Equal("C"))
+				Ω(sortedStopMessages[2].InstanceGuid).Should(Equal("A"))
+			})
+		})
 	})
 
 	Describe("Pending Message", func() {
@@ -331,4 +383,64 @@ var _ = Describe("Pending Messages", func() {
 			})
 		})
 	})
+
+	Describe("Reason codes", func() {
+		It("should give every start reason a reason code", func() {
+			codes := map[PendingStartMessageReason]ReasonCode{
+				PendingStartMessageReasonCrashed:    ReasonCodeCrashed,
+				PendingStartMessageReasonMissing:    ReasonCodeMissing,
+				PendingStartMessageReasonEvacuating: ReasonCodeEvacuation,
+				PendingStartMessageReasonOperator:   ReasonCodeOperator,
+				PendingStartMessageReasonInvalid:    ReasonCodeInvalid,
+			}
+			for reason, code := range codes {
+				message := NewPendingStartMessage(time.Unix(100, 0), 0, 0, "app-guid", "app-version", 1, 1.0, reason)
+				Ω(message.ReasonCode()).Should(Equal(code))
+			}
+		})
+
+		It("should give every stop reason a reason code", func() {
+			codes := map[PendingStopMessageReason]ReasonCode{
+				PendingStopMessageReasonExtra:              ReasonCodeExtra,
+				PendingStopMessageReasonDuplicate:          ReasonCodeDuplicate,
+				PendingStopMessageReasonEvacuationComplete: ReasonCodeEvacuation,
+				PendingStopMessageReasonOperator:           ReasonCodeOperator,
+				PendingStopMessageReasonInvalid:            ReasonCodeInvalid,
+			}
+			for reason, code := range codes {
+				message := NewPendingStopMessage(time.Unix(100, 0), 0, 0, "app-guid", "app-version", "instance-guid", reason)
+				Ω(message.ReasonCode()).Should(Equal(code))
+			}
+		})
+	})
+
+	Describe("Stop categories", func() {
+		It("should say who initiated every category of stop", func() {
+			initiators := map[StopCategory]StopInitiator{
+				StopCategoryScaleDown:         StopInitiatorCC,
+				StopCategoryAppStopped:        StopInitiatorCC,
+				StopCategoryMismatchedVersion: StopInitiatorHM,
+				StopCategoryDuplicate:         StopInitiatorHM,
+				StopCategoryEvacuation:        StopInitiatorHM,
+				StopCategoryOperator:          StopInitiatorOperator,
+				StopCategoryInvalid:           StopInitiatorUnknown,
+			}
+			for category, initiator := range initiators {
+				Ω(category.Initiator()).Should(Equal(initiator))
+			}
+		})
+	})
+
+	Describe("Origin", func() {
+		It("should round trip through JSON, and be left out when unknown", func() {
+			message := NewPendingStopMessage(time.Unix(100, 0), 0, 0, "app-guid", "app-version", "instance-guid", PendingStopMessageReasonOperator)
+			Ω(string(message.ToJSON())).ShouldNot(ContainSubstring("origin"))
+
+			message.Origin = OriginOperator
+			Ω(string(message.ToJSON())).Should(ContainSubstring(`"origin":"operator"`))
+			decoded, err := NewPendingStopMessageFromJSON(message.ToJSON())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decoded.Origin).Should(Equal(OriginOperator))
+		})
+	})
 })
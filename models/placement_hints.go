@@ -0,0 +1,29 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PlacementHints help whoever places a restarted instance to place it well:
+// away from the DEAs it recently crashed on, in the zone the app has fewest
+// instances in, and on a DEA with the memory it needs.  They are advice; a
+// DEA or CC that does not know them can ignore them.
+type PlacementHints struct {
+	AvoidDEAs     []string `json:"avoid_deas"`
+	PreferredZone string   `json:"preferred_zone,omitempty"`
+	MemoryInMB    int      `json:"memory_mb,omitempty"`
+}
+
+// IsEmpty is true when the hints say nothing.
+func (hints PlacementHints) IsEmpty() bool {
+	return len(hints.AvoidDEAs) == 0 && hints.PreferredZone == "" && hints.MemoryInMB == 0
+}
+
+func (hints PlacementHints) LogDescription() map[string]string {
+	return map[string]string{
+		"AvoidDEAs":     strings.Join(hints.AvoidDEAs, ","),
+		"PreferredZone": hints.PreferredZone,
+		"MemoryInMB":    strconv.Itoa(hints.MemoryInMB),
+	}
+}
@@ -0,0 +1,33 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PlacementHints", func() {
+	It("should be empty when it advises nothing", func() {
+		Ω(PlacementHints{}.IsEmpty()).Should(BeTrue())
+		Ω(PlacementHints{AvoidDEAs: []string{}}.IsEmpty()).Should(BeTrue())
+		Ω(PlacementHints{AvoidDEAs: []string{"dea"}}.IsEmpty()).Should(BeFalse())
+		Ω(PlacementHints{PreferredZone: "z1"}.IsEmpty()).Should(BeFalse())
+		Ω(PlacementHints{MemoryInMB: 256}.IsEmpty()).Should(BeFalse())
+	})
+
+	It("should be sent with start messages that have them", func() {
+		message := StartMessage{MessageId: "abc", PlacementHints: &PlacementHints{AvoidDEAs: []string{"dea-1", "dea-2"}, PreferredZone: "z2", MemoryInMB: 256}}
+		Ω(string(message.ToJSON())).Should(ContainSubstring(`"placement_hints":{"avoid_deas":["dea-1","dea-2"],"memory_mb":256,"preferred_zone":"z2"}`))
+
+		message.PlacementHints = nil
+		Ω(string(message.ToJSON())).ShouldNot(ContainSubstring("placement_hints"))
+	})
+
+	It("should describe itself for the logs", func() {
+		Ω(PlacementHints{AvoidDEAs: []string{"dea-1", "dea-2"}, PreferredZone: "z2", MemoryInMB: 256}.LogDescription()).Should(Equal(map[string]string{
+			"AvoidDEAs":     "dea-1,dea-2",
+			"PreferredZone": "z2",
+			"MemoryInMB":    "256",
+		}))
+	})
+})
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Restart is a start hm9000 sent for one of an app's instances.
+type Restart struct {
+	Index  int                       `json:"index"`
+	Reason PendingStartMessageReason `json:"reason"`
+	SentAt int64                     `json:"sent_at"`
+}
+
+// RestartHistory lists the starts hm9000 sent for an app in the restart
+// report window, oldest first.
+type RestartHistory struct {
+	AppGuid    string    `json:"droplet"`
+	AppVersion string    `json:"version"`
+	Restarts   []Restart `json:"restarts"`
+}
+
+func NewRestartHistoryFromJSON(encoded []byte) (RestartHistory, error) {
+	history := RestartHistory{}
+	err := json.Unmarshal(encoded, &history)
+	if err != nil {
+		return RestartHistory{}, err
+	}
+	return history, nil
+}
+
+func (history RestartHistory) ToJSON() []byte {
+	result, _ := CanonicalJSON(history)
+	return result
+}
+
+func (history RestartHistory) StoreKey() string {
+	return history.AppGuid + "," + history.AppVersion
+}
+
+// Since drops the restarts sent before cutoff.
+func (history RestartHistory) Since(cutoff time.Time) RestartHistory {
+	kept := []Restart{}
+	for _, restart := range history.Restarts {
+		if restart.SentAt >= cutoff.Unix() {
+			kept = append(kept, restart)
+		}
+	}
+	history.Restarts = kept
+	return history
+}
+
+// RestartReportReasons is how many of an app's latest restart reasons a
+// restart report lists.
+const RestartReportReasons = 3
+
+// RestartedApp is an app in a restart report.
+type RestartedApp struct {
+	AppGuid         string                      `json:"droplet"`
+	AppVersion      string                      `json:"version"`
+	Restarts        int                         `json:"restarts"`
+	LastRestartedAt int64                       `json:"last_restarted_at"`
+	LastReasons     []PendingStartMessageReason `json:"last_reasons"`
+}
+
+// RestartReport lists the apps hm9000 restarted more than Threshold times in
+// the window before GeneratedAt, those restarted most often first.
+type RestartReport struct {
+	GeneratedAt     int64          `json:"generated_at"`
+	WindowInSeconds int64          `json:"window_in_seconds"`
+	Threshold       int            `json:"threshold"`
+	Apps            []RestartedApp `json:"apps"`
+}
+
+func NewRestartReport(histories map[string]RestartHistory, threshold int, window time.Duration, now time.Time) RestartReport {
+	report := RestartReport{
+		GeneratedAt:     now.Unix(),
+		WindowInSeconds: int64(window / time.Second),
+		Threshold:       threshold,
+		Apps:            []RestartedApp{},
+	}
+
+	for _, history := range histories {
+		restarts := history.Since(now.Add(-window)).Restarts
+		if len(restarts) <= threshold {
+			continue
+		}
+
+		app := RestartedApp{
+			AppGuid:         history.AppGuid,
+			AppVersion:      history.AppVersion,
+			Restarts:        len(restarts),
+			LastRestartedAt: restarts[len(restarts)-1].SentAt,
+			LastReasons:     []PendingStartMessageReason{},
+		}
+		for i := len(restarts) - 1; i >= 0 && len(app.LastReasons) < RestartReportReasons; i-- {
+			app.LastReasons = append(app.LastReasons, restarts[i].Reason)
+		}
+		report.Apps = append(report.Apps, app)
+	}
+
+	sort.Sort(restartedAppsByRestarts(report.Apps))
+	return report
+}
+
+func NewRestartReportFromJSON(encoded []byte) (RestartReport, error) {
+	report := RestartReport{}
+	err := json.Unmarshal(encoded, &report)
+	if err != nil {
+		return RestartReport{}, err
+	}
+	return report, nil
+}
+
+func (report RestartReport) ToJSON() []byte {
+	result, _ := CanonicalJSON(report)
+	return result
+}
+
+type restartedAppsByRestarts []RestartedApp
+
+func (apps restartedAppsByRestarts) Len() int      { return len(apps) }
+func (apps restartedAppsByRestarts) Swap(i, j int) { apps[i], apps[j] = apps[j], apps[i] }
+func (apps restartedAppsByRestarts) Less(i, j int) bool {
+	if apps[i].Restarts != apps[j].Restarts {
+		return apps[i].Restarts > apps[j].Restarts
+	}
+	if apps[i].AppGuid != apps[j].AppGuid {
+		return apps[i].AppGuid < apps[j].AppGuid
+	}
+	return apps[i].AppVersion < apps[j].AppVersion
+}
@@ -0,0 +1,104 @@
+package models_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RestartHistory", func() {
+	var history RestartHistory
+
+	BeforeEach(func() {
+		history = RestartHistory{
+			AppGuid:    "app",
+			AppVersion: "version",
+			Restarts: []Restart{
+				{Index: 0, Reason: PendingStartMessageReasonCrashed, SentAt: 100},
+				{Index: 1, Reason: PendingStartMessageReasonMissing, SentAt: 200},
+			},
+		}
+	})
+
+	It("should round trip through JSON", func() {
+		decoded, err := NewRestartHistoryFromJSON(history.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(history))
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewRestartHistoryFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("should be keyed by app", func() {
+		Ω(history.StoreKey()).Should(Equal("app,version"))
+	})
+
+	It("should drop the restarts before a cutoff", func() {
+		Ω(history.Since(time.Unix(150, 0)).Restarts).Should(Equal([]Restart{history.Restarts[1]}))
+	})
+})
+
+var _ = Describe("RestartReport", func() {
+	restarts := func(reasons ...PendingStartMessageReason) []Restart {
+		result := []Restart{}
+		for i, reason := range reasons {
+			result = append(result, Restart{Index: 0, Reason: reason, SentAt: int64(1000 + i)})
+		}
+		return result
+	}
+
+	It("should list the apps restarted more than the threshold in the window, most restarted first", func() {
+		histories := map[string]RestartHistory{
+			"quiet,v": {AppGuid: "quiet", AppVersion: "v", Restarts: restarts(PendingStartMessageReasonCrashed, PendingStartMessageReasonCrashed)},
+			"noisy,v": {AppGuid: "noisy", AppVersion: "v", Restarts: restarts(
+				PendingStartMessageReasonMissing,
+				PendingStartMessageReasonCrashed,
+				PendingStartMessageReasonEvacuating,
+				PendingStartMessageReasonCrashed,
+				PendingStartMessageReasonMissing,
+			)},
+			"busy,v": {AppGuid: "busy", AppVersion: "v", Restarts: restarts(PendingStartMessageReasonCrashed, PendingStartMessageReasonCrashed, PendingStartMessageReasonCrashed)},
+		}
+
+		report := NewRestartReport(histories, 2, time.Hour, time.Unix(2000, 0))
+		Ω(report.GeneratedAt).Should(BeNumerically("==", 2000))
+		Ω(report.WindowInSeconds).Should(BeNumerically("==", 3600))
+		Ω(report.Threshold).Should(Equal(2))
+		Ω(report.Apps).Should(Equal([]RestartedApp{
+			{
+				AppGuid:         "noisy",
+				AppVersion:      "v",
+				Restarts:        5,
+				LastRestartedAt: 1004,
+				LastReasons:     []PendingStartMessageReason{PendingStartMessageReasonMissing, PendingStartMessageReasonCrashed, PendingStartMessageReasonEvacuating},
+			},
+			{
+				AppGuid:         "busy",
+				AppVersion:      "v",
+				Restarts:        3,
+				LastRestartedAt: 1002,
+				LastReasons:     []PendingStartMessageReason{PendingStartMessageReasonCrashed, PendingStartMessageReasonCrashed, PendingStartMessageReasonCrashed},
+			},
+		}))
+	})
+
+	It("should not count restarts from before the window", func() {
+		histories := map[string]RestartHistory{
+			"old,v": {AppGuid: "old", AppVersion: "v", Restarts: restarts(PendingStartMessageReasonCrashed, PendingStartMessageReasonCrashed, PendingStartMessageReasonCrashed)},
+		}
+
+		report := NewRestartReport(histories, 2, time.Second, time.Unix(2000, 0))
+		Ω(report.Apps).Should(BeEmpty())
+	})
+
+	It("should round trip through JSON", func() {
+		report := RestartReport{GeneratedAt: 10, WindowInSeconds: 60, Threshold: 1, Apps: []RestartedApp{{AppGuid: "a", AppVersion: "b", Restarts: 2, LastRestartedAt: 5, LastReasons: []PendingStartMessageReason{PendingStartMessageReasonCrashed}}}}
+		decoded, err := NewRestartReportFromJSON(report.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(report))
+	})
+})
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// The versions of the heartbeat schema.  DEAs that predate versioning send
+// no "schema_version" and are version 1.  Version 2 adds the DEA's zone and
+// cell id and each instance's resource stats.
+//
+// Decoding is forward compatible: fields a version of hm9000 does not know,
+// from a newer schema or a newer DEA, are kept in Extra and written back out
+// by ToJSON, rather than dropped, so that anything hm9000 passes on loses
+// nothing.
+const (
+	HeartbeatSchemaV1 = 1
+	HeartbeatSchemaV2 = 2
+
+	CurrentHeartbeatSchemaVersion = HeartbeatSchemaV2
+)
+
+// jsonFieldNames are the JSON names of the fields of the struct type t.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// extraFields are the members of the JSON object encoded not in known, in
+// canonical form, or nil if it has none.
+func extraFields(encoded []byte, known map[string]bool) (map[string]json.RawMessage, error) {
+	members := map[string]json.RawMessage{}
+	err := json.Unmarshal(encoded, &members)
+	if err != nil {
+		return nil, err
+	}
+
+	var extra map[string]json.RawMessage
+	for name, value := range members {
+		if known[name] {
+			continue
+		}
+		if extra == nil {
+			extra = map[string]json.RawMessage{}
+		}
+		canonical, err := canonicalize(value)
+		if err != nil {
+			return nil, err
+		}
+		extra[name] = json.RawMessage(canonical)
+	}
+	return extra, nil
+}
+
+// encodeWithExtra encodes value, a struct, as a JSON object with the members
+// of extra that it does not have itself.
+func encodeWithExtra(value interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil || len(extra) == 0 {
+		return encoded, err
+	}
+
+	members := map[string]json.RawMessage{}
+	err = json.Unmarshal(encoded, &members)
+	if err != nil {
+		return nil, err
+	}
+	for name, member := range extra {
+		if _, ok := members[name]; !ok {
+			members[name] = member
+		}
+	}
+	return json.Marshal(members)
+}
@@ -0,0 +1,125 @@
+package models_test
+
+import (
+	"encoding/json"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Heartbeat schema versions", func() {
+	type schemaCase struct {
+		description string
+		encoded     string
+		check       func(Heartbeat)
+	}
+
+	cases := []schemaCase{
+		{
+			description: "an unversioned heartbeat, from a DEA that predates versioning",
+			encoded: `{
+				"dea": "dea_abc",
+				"droplets": [{"droplet": "abc", "version": "xyz-123", "instance": "def", "index": 3, "state": "RUNNING", "state_timestamp": 1123.2, "dea_guid": "dea_abc"}]
+			}`,
+			check: func(heartbeat Heartbeat) {
+				Ω(heartbeat.SchemaVersion).Should(BeZero())
+				Ω(heartbeat.Version()).Should(Equal(HeartbeatSchemaV1))
+				Ω(heartbeat.Extra).Should(BeNil())
+				Ω(heartbeat.InstanceHeartbeats[0].Stats).Should(BeNil())
+				Ω(heartbeat.InstanceHeartbeats[0].Extra).Should(BeNil())
+			},
+		},
+		{
+			description: "a version 1 heartbeat carrying fields hm9000 never used",
+			encoded: `{
+				"schema_version": 1,
+				"dea": "dea_abc",
+				"prod": false,
+				"droplets": [{"cc_partition": "default", "droplet": "abc", "version": "xyz-123", "instance": "def", "index": 3, "state": "RUNNING", "state_timestamp": 1123.2, "dea_guid": "dea_abc"}]
+			}`,
+			check: func(heartbeat Heartbeat) {
+				Ω(heartbeat.Version()).Should(Equal(HeartbeatSchemaV1))
+				Ω(heartbeat.Extra).Should(Equal(map[string]json.RawMessage{"prod": json.RawMessage(`false`)}))
+				Ω(heartbeat.InstanceHeartbeats[0].Extra).Should(Equal(map[string]json.RawMessage{"cc_partition": json.RawMessage(`"default"`)}))
+			},
+		},
+		{
+			description: "a version 2 heartbeat, with a zone, a cell id and stats",
+			encoded: `{
+				"schema_version": 2,
+				"dea": "dea_abc",
+				"zone": "z1",
+				"cell_id": "cell-7",
+				"droplets": [{"droplet": "abc", "version": "xyz-123", "instance": "def", "index": 3, "state": "RUNNING", "state_timestamp": 1123.2, "dea_guid": "dea_abc", "stats": {"cpu": 0.25, "mem": 268435456, "disk": 1073741824}}]
+			}`,
+			check: func(heartbeat Heartbeat) {
+				Ω(heartbeat.Version()).Should(Equal(HeartbeatSchemaV2))
+				Ω(heartbeat.Zone).Should(Equal("z1"))
+				Ω(heartbeat.CellID).Should(Equal("cell-7"))
+				Ω(heartbeat.Extra).Should(BeNil())
+				Ω(heartbeat.InstanceHeartbeats[0].Stats).Should(Equal(&InstanceStats{CPU: 0.25, MemoryInBytes: 268435456, DiskInBytes: 1073741824}))
+			},
+		},
+		{
+			description: "a heartbeat from a newer schema than this hm9000 knows",
+			encoded: `{
+				"schema_version": 3,
+				"dea": "dea_abc",
+				"zone": "z1",
+				"rack": {"name": "r12", "row": 4},
+				"droplets": [{"droplet": "abc", "version": "xyz-123", "instance": "def", "index": 3, "state": "RUNNING", "state_timestamp": 1123.2, "dea_guid": "dea_abc", "gpu": [0, 1]}]
+			}`,
+			check: func(heartbeat Heartbeat) {
+				Ω(heartbeat.Version()).Should(Equal(3))
+				Ω(heartbeat.Zone).Should(Equal("z1"))
+				Ω(heartbeat.Extra).Should(HaveKey("rack"))
+				Ω(heartbeat.InstanceHeartbeats[0].Extra).Should(HaveKey("gpu"))
+				Ω(heartbeat.InstanceHeartbeats[0].IsRunning()).Should(BeTrue())
+			},
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+
+		Context("decoding "+c.description, func() {
+			var heartbeat Heartbeat
+
+			BeforeEach(func() {
+				var err error
+				heartbeat, err = NewHeartbeatFromJSON([]byte(c.encoded))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("understands the fields it knows", func() {
+				Ω(heartbeat.DeaGuid).Should(Equal("dea_abc"))
+				Ω(heartbeat.InstanceHeartbeats).Should(HaveLen(1))
+				Ω(heartbeat.InstanceHeartbeats[0].AppGuid).Should(Equal("abc"))
+				Ω(heartbeat.InstanceHeartbeats[0].DeaGuid).Should(Equal("dea_abc"))
+				c.check(heartbeat)
+			})
+
+			It("encodes it again without losing anything", func() {
+				Ω(heartbeat.ToJSON()).Should(MatchJSON(c.encoded))
+			})
+
+			It("survives a round trip unchanged", func() {
+				decoded, err := NewHeartbeatFromJSON(heartbeat.ToJSON())
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(decoded).Should(Equal(heartbeat))
+			})
+		})
+	}
+
+	It("does not let an unknown field override a known one", func() {
+		heartbeat := Heartbeat{DeaGuid: "dea_abc", Extra: map[string]json.RawMessage{"dea": json.RawMessage(`"impostor"`)}}
+		Ω(heartbeat.ToJSON()).Should(MatchJSON(`{"dea": "dea_abc", "droplets": null}`))
+	})
+
+	It("keeps unknown fields of single instance heartbeats", func() {
+		instance, err := NewInstanceHeartbeatFromJSON([]byte(`{"droplet": "abc", "index": 1, "state": "RUNNING", "cc_partition": "default"}`))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(instance.ToJSON()).Should(MatchJSON(`{"droplet": "abc", "version": "", "instance": "", "index": 1, "state": "RUNNING", "state_timestamp": 0, "dea_guid": "", "cc_partition": "default"}`))
+	})
+})
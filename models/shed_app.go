@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// ShedApp is what the listener kept of an app's instances on a DEA while it
+// was shedding heartbeat detail: how many there were, and in which states.
+type ShedApp struct {
+	AppGuid    string                `json:"droplet"`
+	AppVersion string                `json:"version"`
+	DeaGuid    string                `json:"dea"`
+	Instances  int                   `json:"instances"`
+	States     map[InstanceState]int `json:"states"`
+}
+
+// NewShedApps summarizes the instances of heartbeat that shed selects, by
+// app.
+func NewShedApps(heartbeat Heartbeat, shed func(InstanceHeartbeat) bool) []ShedApp {
+	byApp := map[string]*ShedApp{}
+	order := []string{}
+	for _, instanceHeartbeat := range heartbeat.InstanceHeartbeats {
+		if !shed(instanceHeartbeat) {
+			continue
+		}
+		key := instanceHeartbeat.AppGuid + "," + instanceHeartbeat.AppVersion
+		shedApp, ok := byApp[key]
+		if !ok {
+			shedApp = &ShedApp{
+				AppGuid:    instanceHeartbeat.AppGuid,
+				AppVersion: instanceHeartbeat.AppVersion,
+				DeaGuid:    heartbeat.DeaGuid,
+				States:     map[InstanceState]int{},
+			}
+			byApp[key] = shedApp
+			order = append(order, key)
+		}
+		shedApp.Instances++
+		shedApp.States[instanceHeartbeat.State]++
+	}
+
+	shedApps := []ShedApp{}
+	for _, key := range order {
+		shedApps = append(shedApps, *byApp[key])
+	}
+	return shedApps
+}
+
+func NewShedAppFromJSON(encoded []byte) (ShedApp, error) {
+	shedApp := ShedApp{}
+	err := json.Unmarshal(encoded, &shedApp)
+	if err != nil {
+		return ShedApp{}, err
+	}
+	return shedApp, nil
+}
+
+func (shedApp ShedApp) ToJSON() []byte {
+	result, _ := CanonicalJSON(shedApp)
+	return result
+}
+
+func (shedApp ShedApp) StoreKey() string {
+	return shedApp.AppGuid + "," + shedApp.AppVersion + "," + shedApp.DeaGuid
+}
@@ -0,0 +1,59 @@
+package models_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ShedApp", func() {
+	var heartbeat Heartbeat
+
+	BeforeEach(func() {
+		heartbeat = Heartbeat{
+			DeaGuid: "dea",
+			InstanceHeartbeats: []InstanceHeartbeat{
+				{AppGuid: "app", AppVersion: "v", InstanceIndex: 0, State: InstanceStateRunning},
+				{AppGuid: "priority", AppVersion: "v", InstanceIndex: 0, State: InstanceStateRunning},
+				{AppGuid: "app", AppVersion: "v", InstanceIndex: 1, State: InstanceStateStarting},
+				{AppGuid: "app", AppVersion: "v", InstanceIndex: 2, State: InstanceStateRunning},
+			},
+		}
+	})
+
+	It("should count the shed instances of each app, by state", func() {
+		shedApps := NewShedApps(heartbeat, func(instanceHeartbeat InstanceHeartbeat) bool {
+			return instanceHeartbeat.AppGuid != "priority"
+		})
+		Ω(shedApps).Should(Equal([]ShedApp{
+			{
+				AppGuid:    "app",
+				AppVersion: "v",
+				DeaGuid:    "dea",
+				Instances:  3,
+				States:     map[InstanceState]int{InstanceStateRunning: 2, InstanceStateStarting: 1},
+			},
+		}))
+	})
+
+	It("should be empty when nothing is shed", func() {
+		shedApps := NewShedApps(heartbeat, func(InstanceHeartbeat) bool { return false })
+		Ω(shedApps).Should(BeEmpty())
+	})
+
+	It("should be keyed by app and DEA", func() {
+		Ω(ShedApp{AppGuid: "app", AppVersion: "v", DeaGuid: "dea"}.StoreKey()).Should(Equal("app,v,dea"))
+	})
+
+	It("should round trip through JSON", func() {
+		shedApp := NewShedApps(heartbeat, func(InstanceHeartbeat) bool { return true })[0]
+		decoded, err := NewShedAppFromJSON(shedApp.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(shedApp))
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewShedAppFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+})
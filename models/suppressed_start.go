@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// SuppressedStart is a start the analyzer held back because the app was in
+// a maintenance window: which index, why it would have been started, and
+// when the analyzer first and last held it back.
+type SuppressedStart struct {
+	AppGuid           string                    `json:"droplet"`
+	AppVersion        string                    `json:"version"`
+	IndexToStart      int                       `json:"index"`
+	StartReason       PendingStartMessageReason `json:"start_reason"`
+	MaintenanceWindow string                    `json:"maintenance_window"`
+	FirstSuppressedAt int64                     `json:"first_suppressed_at"`
+	LastSuppressedAt  int64                     `json:"last_suppressed_at"`
+}
+
+func NewSuppressedStart(start PendingStartMessage, maintenanceWindow string, now time.Time) SuppressedStart {
+	return SuppressedStart{
+		AppGuid:           start.AppGuid,
+		AppVersion:        start.AppVersion,
+		IndexToStart:      start.IndexToStart,
+		StartReason:       start.StartReason,
+		MaintenanceWindow: maintenanceWindow,
+		FirstSuppressedAt: now.Unix(),
+		LastSuppressedAt:  now.Unix(),
+	}
+}
+
+// SuppressedAgain is the start held back once more at now.
+func (suppressed SuppressedStart) SuppressedAgain(start PendingStartMessage, now time.Time) SuppressedStart {
+	suppressed.StartReason = start.StartReason
+	suppressed.LastSuppressedAt = now.Unix()
+	return suppressed
+}
+
+func NewSuppressedStartFromJSON(encoded []byte) (SuppressedStart, error) {
+	suppressed := SuppressedStart{}
+	err := json.Unmarshal(encoded, &suppressed)
+	if err != nil {
+		return SuppressedStart{}, err
+	}
+	return suppressed, nil
+}
+
+func (suppressed SuppressedStart) ToJSON() []byte {
+	result, _ := CanonicalJSON(suppressed)
+	return result
+}
+
+// StoreKey names the index held back, so that a start held back run after
+// run is recorded once.
+func (suppressed SuppressedStart) StoreKey() string {
+	return suppressed.AppGuid + "," + suppressed.AppVersion + "," + strconv.Itoa(suppressed.IndexToStart)
+}
@@ -0,0 +1,53 @@
+package models_test
+
+import (
+	"time"
+
+	. "github.com/cloudfoundry/hm9000/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SuppressedStart", func() {
+	var start PendingStartMessage
+
+	BeforeEach(func() {
+		start = NewPendingStartMessage(time.Unix(100, 0), 0, 0, "app", "v", 2, 1.0, PendingStartMessageReasonMissing)
+	})
+
+	It("should record the start held back and the maintenance window", func() {
+		Ω(NewSuppressedStart(start, "patching", time.Unix(100, 0))).Should(Equal(SuppressedStart{
+			AppGuid:           "app",
+			AppVersion:        "v",
+			IndexToStart:      2,
+			StartReason:       PendingStartMessageReasonMissing,
+			MaintenanceWindow: "patching",
+			FirstSuppressedAt: 100,
+			LastSuppressedAt:  100,
+		}))
+	})
+
+	It("should keep when it was first held back when it is held back again", func() {
+		crashed := NewPendingStartMessage(time.Unix(200, 0), 0, 0, "app", "v", 2, 1.0, PendingStartMessageReasonCrashed)
+		suppressed := NewSuppressedStart(start, "patching", time.Unix(100, 0)).SuppressedAgain(crashed, time.Unix(200, 0))
+		Ω(suppressed.FirstSuppressedAt).Should(BeNumerically("==", 100))
+		Ω(suppressed.LastSuppressedAt).Should(BeNumerically("==", 200))
+		Ω(suppressed.StartReason).Should(Equal(PendingStartMessageReasonCrashed))
+	})
+
+	It("should be keyed by app and index", func() {
+		Ω(NewSuppressedStart(start, "patching", time.Unix(100, 0)).StoreKey()).Should(Equal("app,v,2"))
+	})
+
+	It("should round trip through JSON", func() {
+		suppressed := NewSuppressedStart(start, "patching", time.Unix(100, 0))
+		decoded, err := NewSuppressedStartFromJSON(suppressed.ToJSON())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decoded).Should(Equal(suppressed))
+	})
+
+	It("should error when passed invalid json", func() {
+		_, err := NewSuppressedStartFromJSON([]byte("∂"))
+		Ω(err).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,142 @@
+// Package replay publishes a capture of NATS messages, such as the DEAs'
+// heartbeats and droplet.exited messages, again, spaced out as they were
+// recorded or faster, so that a field issue can be reproduced, or the
+// listener and analyzer loaded, with real traffic.
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+)
+
+// Message is one message of a capture: when it was received, in unix
+// seconds, and its subject and JSON body.
+type Message struct {
+	Timestamp float64         `json:"timestamp"`
+	Subject   string          `json:"subject"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Time is when the message was received.
+func (message Message) Time() time.Time {
+	seconds, fraction := math.Modf(message.Timestamp)
+	return time.Unix(int64(seconds), int64(fraction*float64(time.Second)))
+}
+
+// Reader reads a capture: a stream of Messages, as JSON objects, usually one
+// a line.
+type Reader struct {
+	decoder *json.Decoder
+	read    int
+}
+
+func NewReader(capture io.Reader) *Reader {
+	return &Reader{decoder: json.NewDecoder(capture)}
+}
+
+// Next returns the next message of the capture, or io.EOF after the last.
+func (reader *Reader) Next() (Message, error) {
+	message := Message{}
+	err := reader.decoder.Decode(&message)
+	if err == io.EOF {
+		return Message{}, err
+	}
+	reader.read++
+	if err != nil {
+		return Message{}, fmt.Errorf("message %d of the capture is invalid: %s", reader.read, err.Error())
+	}
+	if message.Subject == "" {
+		return Message{}, fmt.Errorf("message %d of the capture has no subject", reader.read)
+	}
+	return message, nil
+}
+
+// Stats count what a replay published.  Lag is how far behind the
+// capture's pace, scaled by the speed, the replay fell at worst.
+type Stats struct {
+	Messages  int            `json:"messages"`
+	BySubject map[string]int `json:"by_subject"`
+	Duration  time.Duration  `json:"duration"`
+	Lag       time.Duration  `json:"lag"`
+}
+
+type Replayer struct {
+	messageBus   messagebus.MessageBus
+	timeProvider timeprovider.TimeProvider
+	speed        float64
+	logger       logger.Logger
+}
+
+// New returns a Replayer that publishes on messageBus at speed times the
+// pace the messages were captured at.  A speed of 0 publishes them as fast
+// as possible.
+func New(messageBus messagebus.MessageBus, timeProvider timeprovider.TimeProvider, speed float64, logger logger.Logger) *Replayer {
+	return &Replayer{
+		messageBus:   messageBus,
+		timeProvider: timeProvider,
+		speed:        speed,
+		logger:       logger,
+	}
+}
+
+// Replay publishes the messages of the capture until it runs out or stop
+// is closed.  A message captured out of order is published at once.
+func (replayer *Replayer) Replay(reader *Reader, stop <-chan struct{}) (Stats, error) {
+	stats := Stats{BySubject: map[string]int{}}
+	startedAt := replayer.timeProvider.Time()
+	var capturedAt time.Time
+
+	for {
+		message, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		if stats.Messages == 0 {
+			capturedAt = message.Time()
+		}
+
+		if replayer.speed > 0 {
+			offset := time.Duration(float64(message.Time().Sub(capturedAt)) / replayer.speed)
+			wait := startedAt.Add(offset).Sub(replayer.timeProvider.Time())
+			if wait > 0 {
+				replayer.timeProvider.Sleep(wait)
+			} else if -wait > stats.Lag {
+				stats.Lag = -wait
+			}
+		}
+
+		select {
+		case <-stop:
+			stats.Duration = replayer.timeProvider.Time().Sub(startedAt)
+			return stats, nil
+		default:
+		}
+
+		err = replayer.messageBus.Publish(message.Subject, message.Data)
+		if err != nil {
+			return stats, err
+		}
+		stats.Messages++
+		stats.BySubject[message.Subject]++
+
+		if stats.Messages%1000 == 0 {
+			replayer.logger.Info("Replaying", map[string]string{
+				"Messages": fmt.Sprintf("%d", stats.Messages),
+			})
+		}
+	}
+
+	stats.Duration = replayer.timeProvider.Time().Sub(startedAt)
+	return stats, nil
+}
@@ -0,0 +1,136 @@
+package replay_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/apcera/nats"
+	. "github.com/cloudfoundry/hm9000/replay"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// sleepingClock is a time provider whose Sleep moves its time on.
+type sleepingClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (clock *sleepingClock) Time() time.Time { return clock.now }
+
+func (clock *sleepingClock) Sleep(d time.Duration) {
+	clock.slept = append(clock.slept, d)
+	clock.now = clock.now.Add(d)
+}
+
+func (clock *sleepingClock) NewTickerChannel(name string, d time.Duration) <-chan time.Time {
+	return time.NewTicker(d).C
+}
+
+var _ = Describe("Replay", func() {
+	const capture = `{"timestamp": 100, "subject": "dea.heartbeat", "data": {"dea": "dea-1"}}
+{"timestamp": 101.5, "subject": "droplet.exited", "data": {"droplet": "app"}}
+{"timestamp": 104, "subject": "dea.heartbeat", "data": {"dea": "dea-2"}}
+`
+
+	Describe("Reader", func() {
+		It("reads the messages of a capture in order", func() {
+			reader := NewReader(strings.NewReader(capture))
+
+			message, err := reader.Next()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(message.Subject).Should(Equal("dea.heartbeat"))
+			Ω(string(message.Data)).Should(MatchJSON(`{"dea": "dea-1"}`))
+			Ω(message.Time()).Should(Equal(time.Unix(100, 0)))
+
+			message, err = reader.Next()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(message.Time()).Should(Equal(time.Unix(101, int64(500*time.Millisecond))))
+
+			_, err = reader.Next()
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = reader.Next()
+			Ω(err).Should(Equal(io.EOF))
+		})
+
+		It("says which message is invalid", func() {
+			reader := NewReader(strings.NewReader(`{"timestamp": 100, "subject": "dea.heartbeat", "data": {}}
+{"timestamp": "soon"}`))
+			reader.Next()
+			_, err := reader.Next()
+			Ω(err).Should(MatchError(ContainSubstring("message 2 of the capture is invalid")))
+		})
+
+		It("rejects messages without a subject", func() {
+			_, err := NewReader(strings.NewReader(`{"timestamp": 100, "data": {}}`)).Next()
+			Ω(err).Should(MatchError("message 1 of the capture has no subject"))
+		})
+	})
+
+	Describe("Replayer", func() {
+		var (
+			messageBus *fakeyagnats.FakeNATSConn
+			clock      *sleepingClock
+			stop       chan struct{}
+		)
+
+		BeforeEach(func() {
+			messageBus = fakeyagnats.Connect()
+			clock = &sleepingClock{now: time.Unix(5000, 0)}
+			stop = make(chan struct{})
+		})
+
+		replay := func(speed float64) (Stats, error) {
+			return New(messageBus, clock, speed, fakelogger.NewFakeLogger()).Replay(NewReader(strings.NewReader(capture)), stop)
+		}
+
+		It("publishes the messages at the captured pace", func() {
+			stats, err := replay(1)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(messageBus.PublishedMessages("dea.heartbeat")).Should(HaveLen(2))
+			Ω(string(messageBus.PublishedMessages("dea.heartbeat")[1].Data)).Should(MatchJSON(`{"dea": "dea-2"}`))
+			Ω(messageBus.PublishedMessages("droplet.exited")).Should(HaveLen(1))
+			Ω(clock.slept).Should(Equal([]time.Duration{1500 * time.Millisecond, 2500 * time.Millisecond}))
+
+			Ω(stats.Messages).Should(Equal(3))
+			Ω(stats.BySubject).Should(Equal(map[string]int{"dea.heartbeat": 2, "droplet.exited": 1}))
+			Ω(stats.Duration).Should(Equal(4 * time.Second))
+		})
+
+		It("speeds the pace up", func() {
+			_, err := replay(4)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(clock.slept).Should(Equal([]time.Duration{375 * time.Millisecond, 625 * time.Millisecond}))
+		})
+
+		It("publishes as fast as it can at speed 0", func() {
+			_, err := replay(0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(messageBus.PublishedMessageCount()).Should(Equal(3))
+			Ω(clock.slept).Should(BeEmpty())
+		})
+
+		It("stops when told to", func() {
+			close(stop)
+			stats, err := replay(0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(stats.Messages).Should(BeZero())
+			Ω(messageBus.PublishedMessageCount()).Should(BeZero())
+		})
+
+		It("returns the error when a message cannot be published", func() {
+			messageBus.WhenPublishing("droplet.exited", func(*nats.Msg) error {
+				return errors.New("oops")
+			})
+
+			stats, err := replay(0)
+			Ω(err).Should(MatchError("oops"))
+			Ω(stats.Messages).Should(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,115 @@
+package sender_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/scriptednats"
+	"github.com/cloudfoundry/hm9000/testhelpers/senderharness"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scenarios", func() {
+	var (
+		harness *senderharness.Harness
+		conf    *config.Config
+		dea     appfixture.DeaFixture
+		apps    []appfixture.AppFixture
+	)
+
+	crashEveryApp := func() {
+		crashed := []models.InstanceHeartbeat{}
+		for _, app := range apps {
+			crashed = append(crashed, app.CrashedInstanceHeartbeatAtIndex(0))
+		}
+		Ω(harness.Heartbeat(dea.HeartbeatWith(crashed...))).Should(Succeed())
+	}
+
+	startedApps := func() []string {
+		guids := []string{}
+		for _, start := range harness.StartsSent() {
+			guids = append(guids, start.AppGuid)
+		}
+		return guids
+	}
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		conf.SenderMessageLimit = 3
+		harness = senderharness.New(conf)
+
+		dea = appfixture.NewDeaFixture()
+		apps = []appfixture.AppFixture{}
+		desired := []models.DesiredAppState{}
+		for i := 0; i < 5; i++ {
+			app := dea.GetApp(i)
+			apps = append(apps, app)
+			desired = append(desired, app.DesiredState(1))
+		}
+		Ω(harness.Desire(desired...)).Should(Succeed())
+	})
+
+	Context("a crash storm", func() {
+		BeforeEach(func() {
+			crashEveryApp()
+		})
+
+		It("should restart every app, sender_message_limit at a time", func() {
+			Ω(harness.Cycle()).Should(Succeed())
+			Ω(harness.StartsSent()).Should(HaveLen(3))
+
+			Ω(harness.Send()).Should(Succeed())
+			Ω(harness.StartsSent()).Should(HaveLen(5))
+			for _, start := range harness.StartsSent() {
+				Ω(start.Reason).Should(Equal(models.ReasonCodeCrashed))
+			}
+			for _, app := range apps {
+				Ω(startedApps()).Should(ContainElement(app.AppGuid))
+			}
+		})
+
+		Context("then a NATS partition", func() {
+			BeforeEach(func() {
+				Ω(harness.Cycle()).Should(Succeed())
+				harness.MessageBus.Partition()
+			})
+
+			It("should keep the unsent starts until the partition heals", func() {
+				Ω(harness.Send()).ShouldNot(Succeed())
+				Ω(harness.StartsSent()).Should(HaveLen(3))
+				Ω(harness.MessageBus.Attempts(conf.SenderNatsStartSubject)).Should(Equal(5))
+				Ω(harness.Logger.LoggedErrors).Should(ContainElement(scriptednats.PartitionedError))
+
+				unsent := 0
+				for _, message := range harness.PendingStarts() {
+					if !message.HasBeenSent() {
+						unsent++
+					}
+				}
+				Ω(unsent).Should(Equal(2))
+
+				harness.MessageBus.Heal()
+				Ω(harness.Send()).Should(Succeed())
+				Ω(harness.StartsSent()).Should(HaveLen(5))
+			})
+		})
+
+		Context("over a flaky bus", func() {
+			BeforeEach(func() {
+				harness.MessageBus.Fail(conf.SenderNatsStartSubject, 1, errors.New("flaky"))
+			})
+
+			It("should not count the failed start against the limit, and send it on a later run", func() {
+				Ω(harness.Cycle()).ShouldNot(Succeed())
+				Ω(harness.MessageBus.Attempts(conf.SenderNatsStartSubject)).Should(Equal(4))
+				Ω(harness.StartsSent()).Should(HaveLen(3))
+
+				Ω(harness.Send()).Should(Succeed())
+				Ω(harness.StartsSent()).Should(HaveLen(5))
+			})
+		})
+	})
+})
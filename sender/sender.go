@@ -3,15 +3,18 @@ package sender
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/cloudfoundry/gunk/timeprovider"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
+	"github.com/cloudfoundry/hm9000/helpers/webhooks"
 	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/hm9000/store"
-	"github.com/cloudfoundry/yagnats"
 )
 
 type Sender struct {
@@ -20,22 +23,31 @@ type Sender struct {
 	logger logger.Logger
 
 	apps        map[string]*models.App
-	messageBus  yagnats.NATSConn
+	messageBus  messagebus.MessageBus
 	currentTime time.Time
 
+	messageLimit              int
 	numberOfStartMessagesSent int
+	stopsSentToDea            map[string]int
+	numberOfStopsDeferred     int
 	sentStartMessages         []models.PendingStartMessage
 	startMessagesToSave       []models.PendingStartMessage
 	startMessagesToDelete     []models.PendingStartMessage
 	sentStopMessages          []models.PendingStopMessage
+	sentStopCategories        []models.StopCategory
 	stopMessagesToSave        []models.PendingStopMessage
 	stopMessagesToDelete      []models.PendingStopMessage
 	metricsAccountant         metricsaccountant.MetricsAccountant
+	notifier                  webhooks.Notifier
+	events                    []webhooks.Event
 
-	didSucceed bool
+	transitions  map[string]models.InstanceTransitions
+	timesToReact []time.Duration
+
+	failure error
 }
 
-func New(store store.Store, metricsAccountant metricsaccountant.MetricsAccountant, conf *config.Config, messageBus yagnats.NATSConn, logger logger.Logger) *Sender {
+func New(store store.Store, metricsAccountant metricsaccountant.MetricsAccountant, notifier webhooks.Notifier, conf *config.Config, messageBus messagebus.MessageBus, logger logger.Logger) *Sender {
 	return &Sender{
 		store:                 store,
 		conf:                  conf,
@@ -45,10 +57,14 @@ func New(store store.Store, metricsAccountant metricsaccountant.MetricsAccountan
 		startMessagesToSave:   []models.PendingStartMessage{},
 		startMessagesToDelete: []models.PendingStartMessage{},
 		sentStopMessages:      []models.PendingStopMessage{},
+		sentStopCategories:    []models.StopCategory{},
 		stopMessagesToSave:    []models.PendingStopMessage{},
 		stopMessagesToDelete:  []models.PendingStopMessage{},
+		stopsSentToDea:        map[string]int{},
 		metricsAccountant:     metricsAccountant,
-		didSucceed:            true,
+		notifier:              notifier,
+		events:                []webhooks.Event{},
+		timesToReact:          []time.Duration{},
 	}
 }
 
@@ -78,46 +94,223 @@ func (sender *Sender) Send(timeProvider timeprovider.TimeProvider) error {
 		return err
 	}
 
+	sender.messageLimit = sender.loadMessageLimit()
+
 	sender.sendStartMessages(pendingStartMessages)
 	sender.sendStopMessages(pendingStopMessages)
 
 	err = sender.metricsAccountant.IncrementSentMessageMetrics(sender.sentStartMessages, sender.sentStopMessages)
 	if err != nil {
 		sender.logger.Error("Failed to increment metrics", err)
-		sender.didSucceed = false
+		sender.fail(err)
+	}
+
+	err = sender.metricsAccountant.IncrementStopCategoryMetrics(sender.sentStopCategories)
+	if err != nil {
+		sender.logger.Error("Failed to increment stop category metrics", err)
+		sender.fail(err)
+	}
+
+	sender.notifier.Notify(sender.events...)
+
+	err = sender.metricsAccountant.TrackTimesToReact(sender.timesToReact, sender.conf.TimeToReactSLO())
+	if err != nil {
+		sender.logger.Error("Failed to track times to react", err)
+		sender.fail(err)
 	}
 
 	err = sender.store.SavePendingStartMessages(sender.startMessagesToSave...)
 	if err != nil {
 		sender.logger.Error("Failed to save start messages", err)
-		sender.didSucceed = false
+		sender.fail(err)
 	}
 
 	err = sender.store.DeletePendingStartMessages(sender.startMessagesToDelete...)
 	if err != nil {
 		sender.logger.Error("Failed to delete start messages", err)
-		sender.didSucceed = false
+		sender.fail(err)
 	}
 
 	err = sender.store.SavePendingStopMessages(sender.stopMessagesToSave...)
 	if err != nil {
 		sender.logger.Error("Failed to save stop messages", err)
-		sender.didSucceed = false
+		sender.fail(err)
 	}
 
 	err = sender.store.DeletePendingStopMessages(sender.stopMessagesToDelete...)
 	if err != nil {
 		sender.logger.Error("Failed to delete stop messages", err)
-		sender.didSucceed = false
+		sender.fail(err)
+	}
+
+	err = sender.store.RecordRestarts(sender.currentTime, sender.sentStartMessages...)
+	if err != nil {
+		sender.logger.Error("Failed to record restarts", err)
+		sender.fail(err)
+	} else {
+		sender.reportRestarts()
 	}
 
-	if !sender.didSucceed {
-		return errors.New("Sender failed. See logs for details.")
+	sender.trackStartEffectiveness()
+
+	sender.recordAppEvents()
+
+	if sender.failure != nil {
+		return errorcategory.New(errorcategory.Of(sender.failure), errors.New("Sender failed. See logs for details."))
 	}
 
 	return nil
 }
 
+// fail marks the run as failed.  The run's error has the category of its
+// first failure.
+func (sender *Sender) fail(err error) {
+	if sender.failure == nil {
+		sender.failure = err
+	}
+}
+
+// recordAppEvents adds the messages sent to the apps' histories.  Like the
+// analyzer's, a failure to record them is only logged.
+func (sender *Sender) recordAppEvents() {
+	events := []models.AppEvent{}
+	for _, start := range sender.sentStartMessages {
+		events = append(events, models.NewStartSentEvent(start, sender.currentTime))
+	}
+	for i, stop := range sender.sentStopMessages {
+		events = append(events, models.NewStopSentEvent(stop, sender.sentStopCategories[i], sender.currentTime))
+	}
+
+	err := sender.store.RecordAppEvents(sender.currentTime, events...)
+	if err != nil {
+		sender.logger.Error("Failed to record app history", err)
+	}
+}
+
+// reportRestarts saves a restart report, listing the apps restarted more
+// than restart_report_threshold times in the restart report window.
+func (sender *Sender) reportRestarts() {
+	histories, err := sender.store.GetRestartHistories()
+	if err != nil {
+		sender.logger.Error("Failed to fetch restart histories", err)
+		sender.fail(err)
+		return
+	}
+
+	report := models.NewRestartReport(histories, sender.conf.RestartReportThreshold, sender.conf.RestartReportWindow(), sender.currentTime)
+
+	err = sender.store.SaveRestartReport(report)
+	if err != nil {
+		sender.logger.Error("Failed to save restart report", err)
+		sender.fail(err)
+		return
+	}
+
+	err = sender.metricsAccountant.TrackRestartReport(report)
+	if err != nil {
+		sender.logger.Error("Failed to track restart report", err)
+		sender.fail(err)
+	}
+}
+
+// trackStartEffectiveness counts what came of the starts sent by earlier
+// runs, by the heartbeats this run read, and awaits the starts this run
+// sent.  A start sent to an index whose earlier start is still awaited
+// replaces it, and the earlier start counts as timed out: the analyzer
+// would not have asked for another had it worked.  Starts for apps hm9000
+// no longer knows of are forgotten.
+func (sender *Sender) trackStartEffectiveness() {
+	window := sender.conf.StartEffectivenessWindow()
+	if window == 0 {
+		return
+	}
+
+	awaited, err := sender.store.GetAwaitedStarts()
+	if err != nil {
+		sender.logger.Error("Failed to fetch awaited starts", err)
+		sender.fail(err)
+		return
+	}
+
+	outcomes := []models.StartOutcome{}
+	resolved := []models.AwaitedStart{}
+	for key, start := range awaited {
+		app, found := sender.apps[sender.store.AppKey(start.AppGuid, start.AppVersion)]
+		if found {
+			outcome, known := start.Outcome(app, sender.currentTime, window)
+			if !known {
+				continue
+			}
+			sender.recordStartOutcome(start, outcome)
+			outcomes = append(outcomes, outcome)
+		}
+		resolved = append(resolved, start)
+		delete(awaited, key)
+	}
+
+	toAwait := []models.AwaitedStart{}
+	for _, startMessage := range sender.sentStartMessages {
+		start := models.NewAwaitedStart(startMessage, sender.apps[sender.store.AppKey(startMessage.AppGuid, startMessage.AppVersion)], sender.currentTime)
+		if replaced, ok := awaited[start.StoreKey()]; ok {
+			sender.recordStartOutcome(replaced, models.StartOutcomeTimedOut)
+			outcomes = append(outcomes, models.StartOutcomeTimedOut)
+			delete(awaited, start.StoreKey())
+		}
+		toAwait = append(toAwait, start)
+	}
+
+	err = sender.store.DeleteAwaitedStarts(resolved...)
+	if err != nil {
+		sender.logger.Error("Failed to delete awaited starts", err)
+		sender.fail(err)
+		return
+	}
+
+	err = sender.store.SaveAwaitedStarts(toAwait...)
+	if err != nil {
+		sender.logger.Error("Failed to save awaited starts", err)
+		sender.fail(err)
+		return
+	}
+
+	err = sender.metricsAccountant.TrackStartOutcomes(outcomes)
+	if err != nil {
+		sender.logger.Error("Failed to track start outcomes", err)
+		sender.fail(err)
+	}
+}
+
+// recordStartOutcome logs the starts that did not work.
+func (sender *Sender) recordStartOutcome(start models.AwaitedStart, outcome models.StartOutcome) {
+	if outcome == models.StartOutcomeSucceeded {
+		return
+	}
+
+	sender.logger.Info("A start did not result in a running instance", map[string]string{
+		"AppGuid":      start.AppGuid,
+		"AppVersion":   start.AppVersion,
+		"IndexToStart": strconv.Itoa(start.IndexToStart),
+		"Sent At":      time.Unix(start.SentAt, 0).String(),
+		"Outcome":      string(outcome),
+	})
+}
+
+// loadMessageLimit is the limit an operator has set through the admin API,
+// or sender_message_limit if they have set none.  A limit that cannot be
+// read is left at sender_message_limit.
+func (sender *Sender) loadMessageLimit() int {
+	controls, err := sender.store.GetComponentControls()
+	if err != nil {
+		sender.logger.Error("Failed to fetch component controls", err)
+		return sender.conf.SenderMessageLimit
+	}
+
+	if limit := controls["sender"].MessageLimit; limit > 0 {
+		return limit
+	}
+	return sender.conf.SenderMessageLimit
+}
+
 func (sender *Sender) sendStartMessages(startMessages map[string]models.PendingStartMessage) {
 	sortedStartMessages := models.SortStartMessagesByPriority(startMessages)
 
@@ -130,30 +323,43 @@ func (sender *Sender) sendStartMessages(startMessages map[string]models.PendingS
 	}
 }
 
+// sendStopMessages sends the stops that are due, oldest first, so that with
+// sender_stops_per_dea_limit the stops deferred to later runs are the newest.
 func (sender *Sender) sendStopMessages(stopMessages map[string]models.PendingStopMessage) {
-	for _, stopMessage := range stopMessages {
+	for _, stopMessage := range models.SortStopMessagesBySendOn(stopMessages) {
 		if stopMessage.IsTimeToSend(sender.currentTime) {
 			sender.sendStopMessage(stopMessage)
 		} else if stopMessage.IsExpired(sender.currentTime) {
 			sender.queueStopMessageForDeletion(stopMessage, "expired stop message")
 		}
 	}
+
+	if sender.numberOfStopsDeferred > 0 {
+		sender.logger.Info("Deferred stop messages to DEAs sent their limit of stops", map[string]string{
+			"Deferred": strconv.Itoa(sender.numberOfStopsDeferred),
+			"Limit":    strconv.Itoa(sender.conf.SenderStopsPerDeaLimit),
+		})
+	}
 }
 
 func (sender *Sender) sendStartMessage(startMessage models.PendingStartMessage) {
 	messageToSend, shouldSend := sender.startMessageToSend(startMessage)
 	if shouldSend {
-		if sender.numberOfStartMessagesSent < sender.conf.SenderMessageLimit {
+		if sender.numberOfStartMessagesSent < sender.messageLimit {
 			sender.logger.Info("Sending message", startMessage.LogDescription())
-			err := sender.messageBus.Publish(sender.conf.SenderNatsStartSubject, messageToSend.ToJSON())
+			err := sender.messageBus.Publish(sender.conf.SenderNatsStartSubject, sender.startPayload(messageToSend))
 
 			if err != nil {
 				sender.logger.Error("Failed to send start message", err, startMessage.LogDescription())
-				sender.didSucceed = false
+				sender.fail(err)
 				return
 			}
 
 			sender.sentStartMessages = append(sender.sentStartMessages, startMessage)
+			sender.events = append(sender.events, startSentEvent(messageToSend))
+			if startMessage.StartReason == models.PendingStartMessageReasonCrashed && !startMessage.HasBeenSent() {
+				sender.recordTimeToReact(startMessage)
+			}
 
 			if startMessage.KeepAlive == 0 {
 				sender.queueStartMessageForDeletion(startMessage, "a sent start message with no keep alive")
@@ -171,15 +377,27 @@ func (sender *Sender) sendStartMessage(startMessage models.PendingStartMessage)
 func (sender *Sender) sendStopMessage(stopMessage models.PendingStopMessage) {
 	messageToSend, shouldSend := sender.stopMessageToSend(stopMessage)
 	if shouldSend {
-		err := sender.messageBus.Publish(sender.conf.SenderNatsStopSubject, messageToSend.ToJSON())
+		deaGuid := sender.deaToStopOn(stopMessage)
+		if sender.conf.SenderStopsPerDeaLimit > 0 && deaGuid != "" && sender.stopsSentToDea[deaGuid] >= sender.conf.SenderStopsPerDeaLimit {
+			sender.logger.Debug("Deferring stop message: its DEA has been sent its limit of stops", stopMessage.LogDescription(), map[string]string{"DEA": deaGuid})
+			sender.numberOfStopsDeferred += 1
+			return
+		}
+
+		err := sender.messageBus.Publish(sender.conf.SenderNatsStopSubject, sender.stopPayload(messageToSend))
 
 		if err != nil {
 			sender.logger.Error("Failed to send stop message", err, stopMessage.LogDescription())
-			sender.didSucceed = false
+			sender.fail(err)
 			return
 		}
 
+		sender.unregisterRoutes(stopMessage)
+
 		sender.sentStopMessages = append(sender.sentStopMessages, stopMessage)
+		sender.sentStopCategories = append(sender.sentStopCategories, messageToSend.Category)
+		sender.events = append(sender.events, stopSentEvent(messageToSend))
+		sender.stopsSentToDea[deaGuid] += 1
 
 		if stopMessage.KeepAlive == 0 {
 			sender.queueStopMessageForDeletion(stopMessage, "sent stop message with no keep alive")
@@ -191,6 +409,137 @@ func (sender *Sender) sendStopMessage(stopMessage models.PendingStopMessage) {
 	}
 }
 
+// deaToStopOn is the DEA running the instance stopMessage stops, or empty if
+// no DEA is heartbeating it.
+func (sender *Sender) deaToStopOn(stopMessage models.PendingStopMessage) string {
+	app, found := sender.apps[sender.store.AppKey(stopMessage.AppGuid, stopMessage.AppVersion)]
+	if !found {
+		return ""
+	}
+	return app.InstanceWithGuid(stopMessage.InstanceGuid).DeaGuid
+}
+
+// startPayload is the start message as it is published, signed when a
+// signing secret is configured.
+func (sender *Sender) startPayload(message models.StartMessage) []byte {
+	if sender.conf.SenderSigningSecret != "" {
+		message = message.Signed(sender.conf.SenderSigningSecret, sender.currentTime)
+	}
+	return message.ToJSON()
+}
+
+// stopPayload is the stop message as it is published, signed when a signing
+// secret is configured.
+func (sender *Sender) stopPayload(message models.StopMessage) []byte {
+	if sender.conf.SenderSigningSecret != "" {
+		message = message.Signed(sender.conf.SenderSigningSecret, sender.currentTime)
+	}
+	return message.ToJSON()
+}
+
+// unregisterRoutes asks the routers to stop sending traffic to an extra or
+// duplicate instance that has just been sent its stop, if its DEA said where
+// it is and what its routes are, rather than wait for the DEA to unregister
+// it.  It is only a hint, so a failure to publish it is logged and does not
+// fail the run.
+func (sender *Sender) unregisterRoutes(stopMessage models.PendingStopMessage) {
+	if sender.conf.SenderRouterUnregisterSubject == "" {
+		return
+	}
+	if stopMessage.StopReason != models.PendingStopMessageReasonExtra && stopMessage.StopReason != models.PendingStopMessageReasonDuplicate {
+		return
+	}
+
+	app := sender.apps[sender.store.AppKey(stopMessage.AppGuid, stopMessage.AppVersion)]
+	instance := app.InstanceWithGuid(stopMessage.InstanceGuid)
+	if !instance.HasAddress() || len(instance.Uris) == 0 {
+		return
+	}
+
+	err := sender.messageBus.Publish(sender.conf.SenderRouterUnregisterSubject, models.NewRouterUnregisterMessage(instance).ToJSON())
+	if err != nil {
+		sender.logger.Error("Failed to unregister the routes of an instance being stopped", err, stopMessage.LogDescription())
+		return
+	}
+	sender.logger.Info("Unregistered the routes of an instance being stopped", stopMessage.LogDescription(), map[string]string{
+		"Host": instance.Host,
+		"Port": strconv.Itoa(instance.Port),
+	})
+}
+
+// recordTimeToReact measures how long it took to first send a start for a
+// crashed instance, since the store saw the most recent crash at its index.
+// Crashes the store has no transitions for are not measured.
+func (sender *Sender) recordTimeToReact(startMessage models.PendingStartMessage) {
+	if sender.transitions == nil {
+		transitions, err := sender.store.GetInstanceTransitions()
+		if err != nil {
+			sender.logger.Error("Failed to fetch instance transitions", err)
+			transitions = map[string]models.InstanceTransitions{}
+		}
+		sender.transitions = transitions
+	}
+
+	app, found := sender.apps[sender.store.AppKey(startMessage.AppGuid, startMessage.AppVersion)]
+	if !found {
+		return
+	}
+
+	var timeToReact time.Duration
+	for _, heartbeat := range app.InstanceHeartbeats {
+		if heartbeat.InstanceIndex != startMessage.IndexToStart || heartbeat.State != models.InstanceStateCrashed {
+			continue
+		}
+		sinceCrash := sender.transitions[heartbeat.InstanceGuid].SinceLastCrash(sender.currentTime)
+		if sinceCrash > 0 && (timeToReact == 0 || sinceCrash < timeToReact) {
+			timeToReact = sinceCrash
+		}
+	}
+	if timeToReact == 0 {
+		return
+	}
+
+	sender.timesToReact = append(sender.timesToReact, timeToReact)
+	if slo := sender.conf.TimeToReactSLO(); slo > 0 && timeToReact > slo {
+		sender.logger.Info("Time to react to a crash exceeded the SLO", startMessage.LogDescription(), map[string]string{
+			"Time To React": timeToReact.String(),
+			"SLO":           slo.String(),
+		})
+	}
+}
+
+func startSentEvent(message models.StartMessage) webhooks.Event {
+	return webhooks.Event{
+		Type:       webhooks.EventStartSent,
+		AppGuid:    message.AppGuid,
+		AppVersion: message.AppVersion,
+		Details: map[string]string{
+			"message_id": message.MessageId,
+			"index":      strconv.Itoa(message.InstanceIndex),
+			"reason":     string(message.Reason),
+			"origin":     string(message.Origin),
+		},
+	}
+}
+
+func stopSentEvent(message models.StopMessage) webhooks.Event {
+	return webhooks.Event{
+		Type:       webhooks.EventStopSent,
+		AppGuid:    message.AppGuid,
+		AppVersion: message.AppVersion,
+		Details: map[string]string{
+			"message_id":   message.MessageId,
+			"index":        strconv.Itoa(message.InstanceIndex),
+			"instance":     message.InstanceGuid,
+			"is_duplicate": strconv.FormatBool(message.IsDuplicate),
+			"reason":       string(message.Reason),
+			"origin":       string(message.Origin),
+			"category":     string(message.Category),
+			"initiated_by": string(message.InitiatedBy),
+		},
+	}
+}
+
 func (sender *Sender) markStartMessageSent(startMessage models.PendingStartMessage) {
 	startMessage.SentOn = sender.currentTime.Unix()
 	sender.startMessagesToSave = append(sender.startMessagesToSave, startMessage)
@@ -217,6 +566,18 @@ func (sender *Sender) startMessageToSend(message models.PendingStartMessage) (mo
 		AppGuid:       message.AppGuid,
 		AppVersion:    message.AppVersion,
 		InstanceIndex: message.IndexToStart,
+		Reason:        message.ReasonCode(),
+		Origin:        message.Origin,
+
+		PlacementHints: message.PlacementHints,
+	}
+
+	appKey := sender.store.AppKey(message.AppGuid, message.AppVersion)
+	app, found := sender.apps[appKey]
+
+	if found && app.IsUnmanaged() {
+		sender.logger.Info("Skipping sending start message: the app is unmanaged", message.LogDescription(), app.LogDescription())
+		return models.StartMessage{}, false
 	}
 
 	if message.SkipVerification {
@@ -224,9 +585,6 @@ func (sender *Sender) startMessageToSend(message models.PendingStartMessage) (mo
 		return messageToSend, true
 	}
 
-	appKey := sender.store.AppKey(message.AppGuid, message.AppVersion)
-	app, found := sender.apps[appKey]
-
 	if !found {
 		sender.logger.Info("Skipping sending start message: app is no longer desired", message.LogDescription())
 		return models.StartMessage{}, false
@@ -242,6 +600,15 @@ func (sender *Sender) startMessageToSend(message models.PendingStartMessage) (mo
 		return models.StartMessage{}, false
 	}
 
+	if message.StartReason == models.PendingStartMessageReasonPreemptive {
+		if hasReplacementAtIndex(app, message) {
+			sender.logger.Info("Skipping sending start message: the instance already has a replacement", message.LogDescription(), app.LogDescription())
+			return models.StartMessage{}, false
+		}
+		sender.logger.Info("Sending start message: the instance is on a DEA about to shut down", message.LogDescription(), app.LogDescription())
+		return messageToSend, true
+	}
+
 	if app.HasStartingOrRunningInstanceAtIndex(message.IndexToStart) {
 		sender.logger.Info("Skipping sending start message: instance is already running", message.LogDescription(), app.LogDescription())
 		return models.StartMessage{}, false
@@ -251,6 +618,25 @@ func (sender *Sender) startMessageToSend(message models.PendingStartMessage) (mo
 	return messageToSend, true
 }
 
+// hasReplacementAtIndex is true when the index a preemptive start is for has
+// a starting or running instance on a DEA that its placement hints do not
+// avoid: one that is not about to shut down.
+func hasReplacementAtIndex(app *models.App, message models.PendingStartMessage) bool {
+	avoid := map[string]bool{}
+	if message.PlacementHints != nil {
+		for _, deaGuid := range message.PlacementHints.AvoidDEAs {
+			avoid[deaGuid] = true
+		}
+	}
+
+	for _, instance := range app.StartingOrRunningInstancesAtIndex(message.IndexToStart) {
+		if !avoid[instance.DeaGuid] {
+			return true
+		}
+	}
+	return false
+}
+
 func (sender *Sender) stopMessageToSend(message models.PendingStopMessage) (models.StopMessage, bool) {
 	appKey := sender.store.AppKey(message.AppGuid, message.AppVersion)
 	app, found := sender.apps[appKey]
@@ -260,6 +646,11 @@ func (sender *Sender) stopMessageToSend(message models.PendingStopMessage) (mode
 		return models.StopMessage{}, false
 	}
 
+	if app.IsUnmanaged() {
+		sender.logger.Info("Skipping sending stop message: the app is unmanaged", message.LogDescription(), app.LogDescription())
+		return models.StopMessage{}, false
+	}
+
 	instanceToStop := app.InstanceWithGuid(message.InstanceGuid)
 	messageToSend := models.StopMessage{
 		AppGuid:       message.AppGuid,
@@ -267,32 +658,69 @@ func (sender *Sender) stopMessageToSend(message models.PendingStopMessage) (mode
 		InstanceGuid:  message.InstanceGuid,
 		InstanceIndex: instanceToStop.InstanceIndex,
 		MessageId:     message.MessageId,
+		Reason:        message.ReasonCode(),
+		Origin:        message.Origin,
+	}
+
+	if message.StopReason == models.PendingStopMessageReasonOperator {
+		if instanceToStop.InstanceGuid == "" {
+			sender.logger.Info("Skipping sending stop message: instance is no longer running", message.LogDescription(), app.LogDescription())
+			return models.StopMessage{}, false
+		}
+		sender.logger.Info("Sending stop message: an operator asked for the instance to be stopped", message.LogDescription(), app.LogDescription())
+		messageToSend.IsDuplicate = app.IsDesired() && app.IsIndexDesired(instanceToStop.InstanceIndex)
+		return categorized(messageToSend, models.StopCategoryOperator), true
 	}
 
 	if !app.IsDesired() {
+		if sender.isAnotherVersionDesired(app) {
+			sender.logger.Info("Sending stop message: instance is running a version of the app that is no longer desired", message.LogDescription(), app.LogDescription())
+			messageToSend.IsDuplicate = false
+			return categorized(messageToSend, models.StopCategoryMismatchedVersion), true
+		}
 		sender.logger.Info("Sending stop message: instance is running, app is no longer desired", message.LogDescription(), app.LogDescription())
 		messageToSend.IsDuplicate = false
-		return messageToSend, true
+		return categorized(messageToSend, models.StopCategoryAppStopped), true
 	}
 
 	if !app.IsIndexDesired(instanceToStop.InstanceIndex) {
 		sender.logger.Info("Sending stop message: index of instance to stop is beyond desired # of instances", message.LogDescription(), app.LogDescription())
 		messageToSend.IsDuplicate = false
-		return messageToSend, true
+		return categorized(messageToSend, models.StopCategoryScaleDown), true
 	}
 
 	if instanceToStop.State == models.InstanceStateEvacuating {
 		sender.logger.Info("Sending stop message for evacuating app", message.LogDescription(), app.LogDescription())
 		messageToSend.IsDuplicate = true
-		return messageToSend, true
+		return categorized(messageToSend, models.StopCategoryEvacuation), true
 	}
 
 	if len(app.StartingOrRunningInstancesAtIndex(instanceToStop.InstanceIndex)) > 1 {
 		sender.logger.Info("Sending stop message: instance is a duplicate running at a desired index", message.LogDescription(), app.LogDescription())
 		messageToSend.IsDuplicate = true
-		return messageToSend, true
+		return categorized(messageToSend, models.StopCategoryDuplicate), true
 	}
 
 	sender.logger.Info("Skipping sending stop message: instance is running on a desired index (and there are no other instances running at that index)", message.LogDescription(), app.LogDescription())
 	return models.StopMessage{}, false
 }
+
+// categorized tags message with category, and who that category of stop is
+// initiated by.
+func categorized(message models.StopMessage, category models.StopCategory) models.StopMessage {
+	message.Category = category
+	message.InitiatedBy = category.Initiator()
+	return message
+}
+
+// isAnotherVersionDesired is true when the Cloud Controller wants some other
+// version of app running: app's instances are left over from an update,
+// rather than from the app being stopped.
+func (sender *Sender) isAnotherVersionDesired(app *models.App) bool {
+	for _, other := range sender.apps {
+		if other.AppGuid == app.AppGuid && other.AppVersion != app.AppVersion && other.IsDesired() {
+			return true
+		}
+	}
+	return false
+}
@@ -7,12 +7,15 @@ import (
 	"github.com/apcera/nats"
 	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/errorcategory"
+	"github.com/cloudfoundry/hm9000/helpers/webhooks"
 	"github.com/cloudfoundry/hm9000/models"
 	. "github.com/cloudfoundry/hm9000/sender"
 	storepackage "github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakemetricsaccountant"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakenotifier"
 	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
 	"github.com/cloudfoundry/yagnats/fakeyagnats"
 	. "github.com/onsi/ginkgo"
@@ -30,6 +33,7 @@ var _ = Describe("Sender", func() {
 		app               appfixture.AppFixture
 		conf              *config.Config
 		metricsAccountant *fakemetricsaccountant.FakeMetricsAccountant
+		notifier          *fakenotifier.FakeNotifier
 	)
 
 	BeforeEach(func() {
@@ -38,6 +42,7 @@ var _ = Describe("Sender", func() {
 		app = dea.GetApp(0)
 		conf, _ = config.DefaultConfig()
 		metricsAccountant = fakemetricsaccountant.New()
+		notifier = fakenotifier.New()
 
 		timeProvider = &faketimeprovider.FakeTimeProvider{
 			TimeToProvide: time.Unix(int64(10+conf.ActualFreshnessTTL()), 0),
@@ -45,7 +50,7 @@ var _ = Describe("Sender", func() {
 
 		storeAdapter = fakestoreadapter.New()
 		store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
-		sender = New(store, metricsAccountant, conf, messageBus, fakelogger.NewFakeLogger())
+		sender = New(store, metricsAccountant, notifier, conf, messageBus, fakelogger.NewFakeLogger())
 		store.BumpActualFreshness(time.Unix(10, 0))
 		store.BumpDesiredFreshness(time.Unix(10, 0))
 	})
@@ -107,12 +112,17 @@ var _ = Describe("Sender", func() {
 		var sentOn int64
 		var err error
 		var pendingMessage models.PendingStartMessage
+		var startReason models.PendingStartMessageReason
+		var origin models.Origin
+		var placementHints *models.PlacementHints
 		var storeSetErrInjector *fakestoreadapter.FakeStoreAdapterErrorInjector
 
 		JustBeforeEach(func() {
 			store.SyncDesiredState(app.DesiredState(1))
-			pendingMessage = models.NewPendingStartMessage(time.Unix(100, 0), 30, keepAliveTime, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonInvalid)
+			pendingMessage = models.NewPendingStartMessage(time.Unix(100, 0), 30, keepAliveTime, app.AppGuid, app.AppVersion, 0, 1.0, startReason)
 			pendingMessage.SentOn = sentOn
+			pendingMessage.Origin = origin
+			pendingMessage.PlacementHints = placementHints
 			store.SavePendingStartMessages(
 				pendingMessage,
 			)
@@ -123,6 +133,9 @@ var _ = Describe("Sender", func() {
 		BeforeEach(func() {
 			keepAliveTime = 0
 			sentOn = 0
+			startReason = models.PendingStartMessageReasonInvalid
+			origin = models.OriginUnknown
+			placementHints = nil
 			err = nil
 			storeSetErrInjector = nil
 		})
@@ -166,6 +179,30 @@ var _ = Describe("Sender", func() {
 				}))
 			})
 
+			Context("when the message has a reason and an origin", func() {
+				BeforeEach(func() {
+					startReason = models.PendingStartMessageReasonEvacuating
+					origin = models.OriginEvacuator
+				})
+
+				It("should send them with the message", func() {
+					message, _ := models.NewStartMessageFromJSON([]byte(messageBus.PublishedMessages("hm9000.start")[0].Data))
+					Ω(message.Reason).Should(Equal(models.ReasonCodeEvacuation))
+					Ω(message.Origin).Should(Equal(models.OriginEvacuator))
+				})
+			})
+
+			Context("when the message has placement hints", func() {
+				BeforeEach(func() {
+					placementHints = &models.PlacementHints{AvoidDEAs: []string{"dea-1"}, PreferredZone: "z2", MemoryInMB: 256}
+				})
+
+				It("should send them with the message", func() {
+					message, _ := models.NewStartMessageFromJSON([]byte(messageBus.PublishedMessages("hm9000.start")[0].Data))
+					Ω(message.PlacementHints).Should(Equal(placementHints))
+				})
+			})
+
 			It("should increment the metrics for that message", func() {
 				Ω(metricsAccountant.IncrementedStarts).Should(ContainElement(pendingMessage))
 			})
@@ -222,7 +259,7 @@ var _ = Describe("Sender", func() {
 			Context("when the message fails to send", func() {
 				BeforeEach(func() {
 					messageBus.WhenPublishing("hm9000.start", func(*nats.Msg) error {
-						return errors.New("oops")
+						return errorcategory.New(errorcategory.MessageBusError, errors.New("oops"))
 					})
 				})
 
@@ -230,6 +267,10 @@ var _ = Describe("Sender", func() {
 					Ω(err).Should(HaveOccurred())
 				})
 
+				It("should keep the category of the failure", func() {
+					Ω(errorcategory.Of(err)).Should(Equal(errorcategory.MessageBusError))
+				})
+
 				It("should not increment the metrics", func() {
 					Ω(metricsAccountant.IncrementedStarts).Should(BeEmpty())
 				})
@@ -341,11 +382,14 @@ var _ = Describe("Sender", func() {
 					InstanceGuid:  app.InstanceAtIndex(0).InstanceGuid,
 					IsDuplicate:   false,
 					MessageId:     pendingMessage.MessageId,
+					Category:      models.StopCategoryAppStopped,
+					InitiatedBy:   models.StopInitiatorCC,
 				}))
 			})
 
 			It("should increment the metrics", func() {
 				Ω(metricsAccountant.IncrementedStops).Should(ContainElement(pendingMessage))
+				Ω(metricsAccountant.IncrementedStopCategories).Should(Equal([]models.StopCategory{models.StopCategoryAppStopped}))
 			})
 
 			Context("when the message should be kept alive", func() {
@@ -451,6 +495,221 @@ var _ = Describe("Sender", func() {
 		})
 	})
 
+	Describe("Limiting the stops sent to each DEA", func() {
+		var otherDea appfixture.DeaFixture
+
+		BeforeEach(func() {
+			conf.SenderStopsPerDeaLimit = 2
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+			otherDea = appfixture.NewDeaFixture()
+			otherApp := otherDea.GetApp(0)
+
+			store.SyncHeartbeats(app.Heartbeat(3), otherApp.Heartbeat(1))
+			store.SavePendingStopMessages(
+				models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonExtra),
+				models.NewPendingStopMessage(time.Unix(100, 0), 1, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(1).InstanceGuid, models.PendingStopMessageReasonExtra),
+				models.NewPendingStopMessage(time.Unix(100, 0), 2, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(2).InstanceGuid, models.PendingStopMessageReasonExtra),
+				models.NewPendingStopMessage(time.Unix(100, 0), 2, 0, otherApp.AppGuid, otherApp.AppVersion, otherApp.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonExtra),
+			)
+		})
+
+		It("should defer the newest stops over the limit to the next run", func() {
+			err := sender.Send(timeProvider)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(messageBus.PublishedMessages("hm9000.stop")).Should(HaveLen(3))
+
+			pending, _ := store.GetPendingStopMessages()
+			Ω(pending).Should(HaveLen(1))
+			Ω(pending).Should(HaveKey(app.InstanceAtIndex(2).InstanceGuid))
+			Ω(pending[app.InstanceAtIndex(2).InstanceGuid].HasBeenSent()).Should(BeFalse())
+
+			sender = New(store, metricsAccountant, notifier, conf, messageBus, fakelogger.NewFakeLogger())
+			err = sender.Send(timeProvider)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(messageBus.PublishedMessages("hm9000.stop")).Should(HaveLen(4))
+
+			pending, _ = store.GetPendingStopMessages()
+			Ω(pending).Should(BeEmpty())
+		})
+
+		Context("when there is no limit", func() {
+			BeforeEach(func() {
+				conf.SenderStopsPerDeaLimit = 0
+			})
+
+			It("should send every stop", func() {
+				sender.Send(timeProvider)
+				Ω(messageBus.PublishedMessages("hm9000.stop")).Should(HaveLen(4))
+			})
+		})
+	})
+
+	Describe("Unregistering the routes of stopped instances", func() {
+		var err error
+		var stopReason models.PendingStopMessageReason
+		var instance models.InstanceHeartbeat
+
+		BeforeEach(func() {
+			conf.SenderRouterUnregisterSubject = "router.unregister"
+			stopReason = models.PendingStopMessageReasonExtra
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+
+			instance = app.InstanceAtIndex(0).Heartbeat()
+			instance.Host = "10.0.0.1"
+			instance.Port = 61001
+			instance.Uris = []string{"foo.example.com", "bar.example.com"}
+		})
+
+		JustBeforeEach(func() {
+			store.SyncHeartbeats(dea.HeartbeatWith(instance))
+
+			pendingMessage := models.NewPendingStopMessage(time.Unix(100, 0), 30, 0, app.AppGuid, app.AppVersion, instance.InstanceGuid, stopReason)
+			store.SavePendingStopMessages(pendingMessage)
+
+			err = sender.Send(timeProvider)
+		})
+
+		It("should ask the routers to drop the routes of the instance", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(messageBus.PublishedMessages("router.unregister")).Should(HaveLen(1))
+			Ω(messageBus.PublishedMessages("router.unregister")[0].Data).Should(MatchJSON(`{
+				"host": "10.0.0.1",
+				"port": 61001,
+				"uris": ["foo.example.com", "bar.example.com"],
+				"app": "` + app.AppGuid + `",
+				"private_instance_id": "` + instance.InstanceGuid + `"
+			}`))
+			Ω(messageBus.PublishedMessages("hm9000.stop")).Should(HaveLen(1))
+		})
+
+		Context("when the instance is a duplicate", func() {
+			BeforeEach(func() {
+				stopReason = models.PendingStopMessageReasonDuplicate
+			})
+
+			It("should ask the routers to drop the routes of the instance", func() {
+				Ω(messageBus.PublishedMessages("router.unregister")).Should(HaveLen(1))
+			})
+		})
+
+		Context("when the instance is stopped for any other reason", func() {
+			BeforeEach(func() {
+				stopReason = models.PendingStopMessageReasonInvalid
+			})
+
+			It("should leave the routes to the DEA", func() {
+				Ω(messageBus.PublishedMessages("router.unregister")).Should(BeEmpty())
+				Ω(messageBus.PublishedMessages("hm9000.stop")).Should(HaveLen(1))
+			})
+		})
+
+		Context("when the DEA did not say where the instance is", func() {
+			BeforeEach(func() {
+				instance.Host = ""
+				instance.Port = 0
+			})
+
+			It("should leave the routes to the DEA", func() {
+				Ω(messageBus.PublishedMessages("router.unregister")).Should(BeEmpty())
+				Ω(messageBus.PublishedMessages("hm9000.stop")).Should(HaveLen(1))
+			})
+		})
+
+		Context("when the instance has no routes", func() {
+			BeforeEach(func() {
+				instance.Uris = nil
+			})
+
+			It("should not ask the routers to drop them", func() {
+				Ω(messageBus.PublishedMessages("router.unregister")).Should(BeEmpty())
+				Ω(messageBus.PublishedMessages("hm9000.stop")).Should(HaveLen(1))
+			})
+		})
+
+		Context("when no subject is configured", func() {
+			BeforeEach(func() {
+				conf.SenderRouterUnregisterSubject = ""
+			})
+
+			It("should leave the routes to the DEA", func() {
+				Ω(messageBus.PublishedMessageCount()).Should(Equal(1))
+				Ω(messageBus.PublishedMessages("hm9000.stop")).Should(HaveLen(1))
+			})
+		})
+
+		Context("when publishing the unregister fails", func() {
+			BeforeEach(func() {
+				messageBus.WhenPublishing("router.unregister", func(*nats.Msg) error {
+					return errors.New("oops")
+				})
+			})
+
+			It("should still stop the instance", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages("hm9000.stop")).Should(HaveLen(1))
+			})
+		})
+
+		Context("when publishing the stop fails", func() {
+			BeforeEach(func() {
+				messageBus.WhenPublishing("hm9000.stop", func(*nats.Msg) error {
+					return errors.New("oops")
+				})
+			})
+
+			It("should leave the instance its routes", func() {
+				Ω(err).Should(HaveOccurred())
+				Ω(messageBus.PublishedMessages("router.unregister")).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Signing messages", func() {
+		var err error
+
+		BeforeEach(func() {
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+		})
+
+		JustBeforeEach(func() {
+			start := models.NewPendingStartMessage(time.Unix(100, 0), 30, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing)
+			start.SkipVerification = true
+			store.SavePendingStartMessages(start)
+
+			store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(1).Heartbeat()))
+			store.SavePendingStopMessages(models.NewPendingStopMessage(time.Unix(100, 0), 30, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(1).InstanceGuid, models.PendingStopMessageReasonExtra))
+
+			err = sender.Send(timeProvider)
+		})
+
+		Context("with a signing secret", func() {
+			BeforeEach(func() {
+				conf.SenderSigningSecret = "hush"
+			})
+
+			It("should sign the starts and stops it sends", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(messageBus.PublishedMessages("hm9000.start")).Should(HaveLen(1))
+				start, _ := models.NewStartMessageFromJSON(messageBus.PublishedMessages("hm9000.start")[0].Data)
+				Ω(start.Signature).ShouldNot(BeEmpty())
+				Ω(start.HasValidSignature("hush", timeProvider.Time(), time.Minute)).Should(BeTrue())
+
+				Ω(messageBus.PublishedMessages("hm9000.stop")).Should(HaveLen(1))
+				stop, _ := models.NewStopMessageFromJSON(messageBus.PublishedMessages("hm9000.stop")[0].Data)
+				Ω(stop.HasValidSignature("hush", timeProvider.Time(), time.Minute)).Should(BeTrue())
+			})
+		})
+
+		Context("without a signing secret", func() {
+			It("should send the messages unsigned", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(messageBus.PublishedMessages("hm9000.start")[0].Data)).ShouldNot(ContainSubstring("signature"))
+				Ω(string(messageBus.PublishedMessages("hm9000.stop")[0].Data)).ShouldNot(ContainSubstring("signature"))
+			})
+		})
+	})
+
 	Describe("Verifying that start messages should be sent", func() {
 		var err error
 		var indexToStart int
@@ -576,6 +835,24 @@ var _ = Describe("Sender", func() {
 			assertMessageWasNotSent()
 		})
 
+		Context("When the app is unmanaged", func() {
+			BeforeEach(func() {
+				desired := app.DesiredState(1)
+				desired.Unmanaged = true
+				store.SyncDesiredState(desired)
+			})
+
+			assertMessageWasNotSent()
+
+			Context("even when the message is marked with SkipVerification", func() {
+				BeforeEach(func() {
+					skipVerification = true
+				})
+
+				assertMessageWasNotSent()
+			})
+		})
+
 		Context("when the message fails verification", func() {
 			assertMessageWasNotSent()
 
@@ -589,14 +866,306 @@ var _ = Describe("Sender", func() {
 		})
 	})
 
+	Describe("Verifying that preemptive start messages should be sent", func() {
+		BeforeEach(func() {
+			store.SyncDesiredState(app.DesiredState(1))
+
+			message := models.NewPendingStartMessage(time.Unix(100, 0), 0, 10, app.AppGuid, app.AppVersion, 0, 0.5, models.PendingStartMessageReasonPreemptive)
+			message.PlacementHints = &models.PlacementHints{AvoidDEAs: []string{dea.DeaGuid}}
+			store.SavePendingStartMessages(message)
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+		})
+
+		Context("when the index only runs on the DEAs to avoid", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+			})
+
+			It("should send the start message, as an evacuation", func() {
+				err := sender.Send(timeProvider)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages("hm9000.start")).Should(HaveLen(1))
+				message, _ := models.NewStartMessageFromJSON([]byte(messageBus.PublishedMessages("hm9000.start")[0].Data))
+				Ω(message.Reason).Should(Equal(models.ReasonCodeEvacuation))
+			})
+		})
+
+		Context("when the index already runs elsewhere", func() {
+			BeforeEach(func() {
+				otherDea := appfixture.NewDeaFixture()
+				replacement := app.InstanceAtIndex(0)
+				replacement.InstanceGuid = models.Guid()
+				replacementHeartbeat := replacement.Heartbeat()
+				replacementHeartbeat.DeaGuid = otherDea.DeaGuid
+				store.SyncHeartbeats(
+					dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()),
+					otherDea.HeartbeatWith(replacementHeartbeat),
+				)
+			})
+
+			It("should not send the start message", func() {
+				err := sender.Send(timeProvider)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages("hm9000.start")).Should(BeEmpty())
+				messages, _ := store.GetPendingStartMessages()
+				Ω(messages).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Notifying webhooks", func() {
+		BeforeEach(func() {
+			store.SyncDesiredState(app.DesiredState(3))
+			store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat(), app.InstanceAtIndex(1).Heartbeat()))
+
+			start := models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 2, 1.0, models.PendingStartMessageReasonMissing)
+			start.Origin = models.OriginAnalyzer
+			stop := models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(1).InstanceGuid, models.PendingStopMessageReasonOperator)
+			store.SavePendingStartMessages(start)
+			store.SavePendingStopMessages(stop)
+
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+		})
+
+		It("should notify of every start and stop sent", func() {
+			err := sender.Send(timeProvider)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			starts := notifier.EventsOfType(webhooks.EventStartSent)
+			Ω(starts).Should(HaveLen(1))
+			Ω(starts[0].AppGuid).Should(Equal(app.AppGuid))
+			Ω(starts[0].Details["index"]).Should(Equal("2"))
+			Ω(starts[0].Details["reason"]).Should(Equal("MISSING"))
+			Ω(starts[0].Details["origin"]).Should(Equal("analyzer"))
+
+			stops := notifier.EventsOfType(webhooks.EventStopSent)
+			Ω(stops).Should(HaveLen(1))
+			Ω(stops[0].Details["instance"]).Should(Equal(app.InstanceAtIndex(1).InstanceGuid))
+			Ω(stops[0].Details["index"]).Should(Equal("1"))
+			Ω(stops[0].Details["reason"]).Should(Equal("OPERATOR"))
+		})
+
+		It("should not notify of messages that fail to send", func() {
+			messageBus.WhenPublishing("hm9000.start", func(*nats.Msg) error {
+				return errors.New("kaboom")
+			})
+			sender.Send(timeProvider)
+
+			Ω(notifier.EventsOfType(webhooks.EventStartSent)).Should(BeEmpty())
+		})
+	})
+
+	Describe("Tracking the time to react to crashes", func() {
+		var crashedAt time.Time
+		var startReason models.PendingStartMessageReason
+		var pendingMessage models.PendingStartMessage
+
+		BeforeEach(func() {
+			startReason = models.PendingStartMessageReasonCrashed
+			store.SyncDesiredState(app.DesiredState(1))
+
+			crashedAt = time.Now()
+			store.SyncHeartbeats(dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0)))
+			timeProvider.TimeToProvide = crashedAt.Add(90 * time.Second)
+		})
+
+		JustBeforeEach(func() {
+			pendingMessage = models.NewPendingStartMessage(crashedAt, 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, startReason)
+			store.SavePendingStartMessages(pendingMessage)
+
+			err := sender.Send(timeProvider)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should track the time from the crash to sending the start", func() {
+			Ω(messageBus.PublishedMessages("hm9000.start")).Should(HaveLen(1))
+			Ω(metricsAccountant.TrackedTimesToReact).Should(HaveLen(1))
+			Ω(metricsAccountant.TrackedTimesToReact[0]).Should(BeNumerically("~", 90*time.Second, time.Second))
+			Ω(metricsAccountant.TrackedSLO).Should(Equal(conf.TimeToReactSLO()))
+		})
+
+		Context("when the start is not for a crash", func() {
+			BeforeEach(func() {
+				startReason = models.PendingStartMessageReasonMissing
+			})
+
+			It("should not track a time to react", func() {
+				Ω(messageBus.PublishedMessages("hm9000.start")).Should(HaveLen(1))
+				Ω(metricsAccountant.TrackedTimesToReact).Should(BeEmpty())
+			})
+		})
+
+		Context("when the store has not seen the instance crash", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(1).Heartbeat()))
+			})
+
+			It("should not track a time to react", func() {
+				Ω(messageBus.PublishedMessages("hm9000.start")).Should(HaveLen(1))
+				Ω(metricsAccountant.TrackedTimesToReact).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Reporting apps restarted too often", func() {
+		BeforeEach(func() {
+			conf.RestartReportThreshold = 1
+			store.SyncDesiredState(app.DesiredState(2))
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+			store.SavePendingStartMessages(
+				models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonCrashed),
+				models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 1, 1.0, models.PendingStartMessageReasonMissing),
+			)
+
+			err := sender.Send(timeProvider)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should record the starts it sent", func() {
+			histories, err := store.GetRestartHistories()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(histories[store.AppKey(app.AppGuid, app.AppVersion)].Restarts).Should(HaveLen(2))
+		})
+
+		It("should save and track a restart report", func() {
+			report, err := store.GetRestartReport()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.GeneratedAt).Should(BeNumerically("==", 130))
+			Ω(report.Apps).Should(HaveLen(1))
+			Ω(report.Apps[0].AppGuid).Should(Equal(app.AppGuid))
+			Ω(report.Apps[0].Restarts).Should(Equal(2))
+
+			Ω(metricsAccountant.TrackedRestartReports).Should(Equal([]models.RestartReport{report}))
+		})
+	})
+
+	Describe("Tracking start effectiveness", func() {
+		BeforeEach(func() {
+			conf.StartEffectivenessWindowInSeconds.Duration = 30 * time.Second
+			store.SyncDesiredState(app.DesiredState(1))
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+			store.SavePendingStartMessages(
+				models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing),
+			)
+
+			Ω(sender.Send(timeProvider)).Should(Succeed())
+		})
+
+		sendAgainAt := func(timestamp int64) {
+			timeProvider.TimeToProvide = time.Unix(timestamp, 0)
+			sender = New(store, metricsAccountant, notifier, conf, messageBus, fakelogger.NewFakeLogger())
+			Ω(sender.Send(timeProvider)).Should(Succeed())
+		}
+
+		It("should await the starts it sent", func() {
+			awaited, err := store.GetAwaitedStarts()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(awaited).Should(HaveLen(1))
+			for _, start := range awaited {
+				Ω(start.AppGuid).Should(Equal(app.AppGuid))
+				Ω(start.IndexToStart).Should(Equal(0))
+				Ω(start.SentAt).Should(BeNumerically("==", 130))
+			}
+			Ω(metricsAccountant.TrackedStartOutcomes).Should(BeEmpty())
+		})
+
+		Context("when the instance starts running", func() {
+			It("should count the start as succeeded", func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+				sendAgainAt(140)
+
+				Ω(metricsAccountant.TrackedStartOutcomes).Should(Equal([]models.StartOutcome{models.StartOutcomeSucceeded}))
+				awaited, err := store.GetAwaitedStarts()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(awaited).Should(BeEmpty())
+			})
+		})
+
+		Context("when the instance crashes", func() {
+			It("should count the start as crashed", func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(app.CrashedInstanceHeartbeatAtIndex(0)))
+				sendAgainAt(140)
+
+				Ω(metricsAccountant.TrackedStartOutcomes).Should(Equal([]models.StartOutcome{models.StartOutcomeCrashed}))
+			})
+		})
+
+		Context("when nothing comes of the start", func() {
+			It("should wait out the window, then count the start as timed out", func() {
+				sendAgainAt(150)
+				Ω(metricsAccountant.TrackedStartOutcomes).Should(BeEmpty())
+
+				sendAgainAt(160)
+				Ω(metricsAccountant.TrackedStartOutcomes).Should(Equal([]models.StartOutcome{models.StartOutcomeTimedOut}))
+			})
+		})
+
+		Context("when tracking start effectiveness is disabled", func() {
+			BeforeEach(func() {
+				conf.StartEffectivenessWindowInSeconds.Duration = 0
+				store.SavePendingStartMessages(
+					models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing),
+				)
+				sendAgainAt(200)
+			})
+
+			It("should not await anything new", func() {
+				awaited, err := store.GetAwaitedStarts()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(awaited).Should(HaveLen(1))
+				for _, start := range awaited {
+					Ω(start.SentAt).Should(BeNumerically("==", 130))
+				}
+				Ω(metricsAccountant.TrackedStartOutcomes).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Recording app history", func() {
+		BeforeEach(func() {
+			conf.AppHistoryMaxEvents = 10
+			store.SyncDesiredState(app.DesiredState(1))
+			store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(1).Heartbeat()))
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+			store.SavePendingStartMessages(
+				models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing),
+			)
+			store.SavePendingStopMessages(
+				models.NewPendingStopMessage(time.Unix(100, 0), 0, 0, app.AppGuid, app.AppVersion, app.InstanceAtIndex(1).InstanceGuid, models.PendingStopMessageReasonExtra),
+			)
+		})
+
+		It("should record the starts and stops it sent", func() {
+			Ω(sender.Send(timeProvider)).Should(Succeed())
+
+			history, err := store.GetAppHistory(app.AppGuid)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(history.Events).Should(HaveLen(2))
+			Ω(history.Events[0].Type).Should(Equal(models.AppEventStartSent))
+			Ω(history.Events[0].Timestamp).Should(BeNumerically("==", 130))
+			Ω(history.Events[0].Details["index"]).Should(Equal("0"))
+			Ω(history.Events[1].Type).Should(Equal(models.AppEventStopSent))
+			Ω(history.Events[1].Details["instance"]).Should(Equal(app.InstanceAtIndex(1).InstanceGuid))
+			Ω(history.Events[1].Details["category"]).Should(Equal("SCALE_DOWN"))
+			Ω(history.Events[1].Details["initiated_by"]).Should(Equal("cc"))
+		})
+
+		It("should still succeed when the history cannot be recorded", func() {
+			storeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("app-history", errors.New("oops"))
+			Ω(sender.Send(timeProvider)).Should(Succeed())
+			Ω(messageBus.PublishedMessages("hm9000.start")).Should(HaveLen(1))
+		})
+	})
+
 	Describe("Verifying that stop messages should be sent", func() {
 		var err error
 		var indexToStop int
+		var stopReason models.PendingStopMessageReason
 		var pendingMessage models.PendingStopMessage
 
 		JustBeforeEach(func() {
 			timeProvider.TimeToProvide = time.Unix(130, 0)
-			pendingMessage = models.NewPendingStopMessage(time.Unix(100, 0), 30, 10, app.AppGuid, app.AppVersion, app.InstanceAtIndex(indexToStop).InstanceGuid, models.PendingStopMessageReasonInvalid)
+			pendingMessage = models.NewPendingStopMessage(time.Unix(100, 0), 30, 10, app.AppGuid, app.AppVersion, app.InstanceAtIndex(indexToStop).InstanceGuid, stopReason)
 			pendingMessage.SentOn = 0
 			store.SavePendingStopMessages(
 				pendingMessage,
@@ -607,6 +1176,7 @@ var _ = Describe("Sender", func() {
 
 		BeforeEach(func() {
 			indexToStop = 0
+			stopReason = models.PendingStopMessageReasonInvalid
 		})
 
 		assertMessageWasNotSent := func() {
@@ -624,7 +1194,7 @@ var _ = Describe("Sender", func() {
 			})
 		}
 
-		assertMessageWasSent := func(indexToStop int, isDuplicate bool) {
+		assertMessageWasSent := func(indexToStop int, isDuplicate bool, category models.StopCategory) {
 			It("should honor the keep alive of the stop message", func() {
 				messages, _ := store.GetPendingStopMessages()
 				Ω(messages).Should(HaveLen(1))
@@ -643,14 +1213,33 @@ var _ = Describe("Sender", func() {
 					InstanceGuid:  app.InstanceAtIndex(indexToStop).InstanceGuid,
 					IsDuplicate:   isDuplicate,
 					MessageId:     pendingMessage.MessageId,
+					Reason:        pendingMessage.ReasonCode(),
+					Category:      category,
+					InitiatedBy:   category.Initiator(),
 				}))
 			})
 
 			It("should increment the metrics", func() {
 				Ω(metricsAccountant.IncrementedStops).Should(ContainElement(pendingMessage))
+				Ω(metricsAccountant.IncrementedStopCategories).Should(Equal([]models.StopCategory{category}))
 			})
 		}
 
+		Context("When the app is unmanaged", func() {
+			BeforeEach(func() {
+				desired := app.DesiredState(1)
+				desired.Unmanaged = true
+				store.SyncDesiredState(desired)
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					app.InstanceAtIndex(0).Heartbeat(),
+					app.InstanceAtIndex(1).Heartbeat(),
+				))
+				indexToStop = 1
+			})
+
+			assertMessageWasNotSent()
+		})
+
 		Context("When the app is still desired", func() {
 			BeforeEach(func() {
 				store.SyncDesiredState(app.DesiredState(1))
@@ -681,7 +1270,7 @@ var _ = Describe("Sender", func() {
 							))
 						})
 
-						assertMessageWasSent(0, true)
+						assertMessageWasSent(0, true, models.StopCategoryDuplicate)
 					})
 
 					Context("when there are other, crashed, instances on the index, and no running instances", func() {
@@ -706,7 +1295,7 @@ var _ = Describe("Sender", func() {
 						indexToStop = 1
 					})
 
-					assertMessageWasSent(1, false)
+					assertMessageWasSent(1, false, models.StopCategoryScaleDown)
 				})
 			})
 
@@ -720,7 +1309,45 @@ var _ = Describe("Sender", func() {
 					))
 				})
 
-				assertMessageWasSent(0, true)
+				assertMessageWasSent(0, true, models.StopCategoryEvacuation)
+			})
+
+			Context("When an operator asked for the instance to be stopped", func() {
+				BeforeEach(func() {
+					stopReason = models.PendingStopMessageReasonOperator
+				})
+
+				Context("and it is the only instance running at a desired index", func() {
+					BeforeEach(func() {
+						store.SyncHeartbeats(dea.HeartbeatWith(
+							app.InstanceAtIndex(0).Heartbeat(),
+						))
+					})
+
+					assertMessageWasSent(0, true, models.StopCategoryOperator)
+				})
+
+				Context("and it is running beyond the number of desired instances", func() {
+					BeforeEach(func() {
+						indexToStop = 1
+						store.SyncHeartbeats(dea.HeartbeatWith(
+							app.InstanceAtIndex(0).Heartbeat(),
+							app.InstanceAtIndex(1).Heartbeat(),
+						))
+					})
+
+					assertMessageWasSent(1, false, models.StopCategoryOperator)
+				})
+
+				Context("and the instance is not running", func() {
+					BeforeEach(func() {
+						store.SyncHeartbeats(dea.HeartbeatWith(
+							app.InstanceAtIndex(1).Heartbeat(),
+						))
+					})
+
+					assertMessageWasNotSent()
+				})
 			})
 
 			Context("When instance is not running", func() {
@@ -733,7 +1360,17 @@ var _ = Describe("Sender", func() {
 				BeforeEach(func() {
 					store.SyncHeartbeats(app.Heartbeat(2))
 				})
-				assertMessageWasSent(0, false)
+				assertMessageWasSent(0, false, models.StopCategoryAppStopped)
+			})
+
+			Context("when another version of the app is desired", func() {
+				BeforeEach(func() {
+					desired := app.DesiredState(1)
+					desired.AppVersion = models.Guid()
+					store.SyncDesiredState(desired)
+					store.SyncHeartbeats(app.Heartbeat(2))
+				})
+				assertMessageWasSent(0, false, models.StopCategoryMismatchedVersion)
 			})
 
 			Context("when the instance is not running", func() {
@@ -749,7 +1386,7 @@ var _ = Describe("Sender", func() {
 			conf, _ = config.DefaultConfig()
 			conf.SenderMessageLimit = 20
 
-			sender = New(store, metricsAccountant, conf, messageBus, fakelogger.NewFakeLogger())
+			sender = New(store, metricsAccountant, notifier, conf, messageBus, fakelogger.NewFakeLogger())
 
 			desiredStates := []models.DesiredAppState{}
 			for i := 0; i < 40; i += 1 {
@@ -828,4 +1465,37 @@ var _ = Describe("Sender", func() {
 			Ω(metricsAccountant.IncrementedStops).Should(HaveLen(40))
 		})
 	})
+
+	Context("When an operator has limited the sender through the admin API", func() {
+		BeforeEach(func() {
+			desiredStates := []models.DesiredAppState{}
+			for i := 0; i < 5; i++ {
+				a := appfixture.NewAppFixture()
+				desiredStates = append(desiredStates, a.DesiredState(1))
+				store.SavePendingStartMessages(models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, a.AppGuid, a.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing))
+			}
+			store.SyncDesiredState(desiredStates...)
+			store.SaveComponentControl(models.ComponentControl{Component: "sender", MessageLimit: 2})
+
+			timeProvider.TimeToProvide = time.Unix(130, 0)
+		})
+
+		It("should send no more start messages than the operator's limit", func() {
+			err := sender.Send(timeProvider)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(messageBus.PublishedMessages("hm9000.start")).Should(HaveLen(2))
+		})
+
+		Context("and then lifted the limit", func() {
+			BeforeEach(func() {
+				store.SaveComponentControl(models.ComponentControl{Component: "sender"})
+			})
+
+			It("should go back to sender_message_limit", func() {
+				err := sender.Send(timeProvider)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(messageBus.PublishedMessages("hm9000.start")).Should(HaveLen(5))
+			})
+		})
+	})
 })
@@ -1,17 +1,90 @@
 package shredder
 
 import (
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+	"github.com/cloudfoundry/hm9000/helpers/metricsaccountant"
 	storepackage "github.com/cloudfoundry/hm9000/store"
 )
 
+const LockName = "shredder"
+
 type Shredder struct {
-	store storepackage.Store
+	store             storepackage.Store
+	metricsAccountant metricsaccountant.MetricsAccountant
+	owner             string
+	ttl               time.Duration
+	timeProvider      timeprovider.TimeProvider
+	logger            logger.Logger
 }
 
-func New(store storepackage.Store) *Shredder {
-	return &Shredder{store}
+// New returns a shredder that holds the shredder lock, as owner and for at
+// most ttl, while it compacts the store, so that a one-off shred and the
+// shredder daemon (or two daemons) never compact, or migrate, at once.
+func New(store storepackage.Store, metricsAccountant metricsaccountant.MetricsAccountant, owner string, ttl time.Duration, timeProvider timeprovider.TimeProvider, logger logger.Logger) *Shredder {
+	return &Shredder{
+		store:             store,
+		metricsAccountant: metricsAccountant,
+		owner:             owner,
+		ttl:               ttl,
+		timeProvider:      timeProvider,
+		logger:            logger,
+	}
 }
 
+// Shred compacts the store, and then the crash history.  It skips the run, without error, when another
+// shredder holds the lock, and stops, returning LockLostError, if it loses the lock part way through.
 func (s *Shredder) Shred() error {
-	return s.store.Compact()
+	lock, err := s.store.Lock(LockName, s.owner, s.ttl, s.timeProvider.Time())
+	if err == storepackage.LockHeldError {
+		s.logger.Info("Skipping shred: another shredder holds the lock")
+		return nil
+	}
+	if err != nil {
+		s.logger.Error("Failed to take the shredder lock", err)
+		return err
+	}
+
+	err = s.store.CompactHoldingLock(lock, s.timeProvider.Time)
+	if err == nil {
+		err = s.store.CheckLock(lock, s.timeProvider.Time())
+	}
+	if err == nil {
+		err = s.compactCrashHistory()
+	}
+	if err == storepackage.LockLostError {
+		s.logger.Error("Stopping shred: lost the shredder lock", err, map[string]string{"Owner": s.owner})
+		return err
+	}
+
+	unlockErr := s.store.Unlock(lock)
+	if unlockErr != nil {
+		s.logger.Error("Failed to give up the shredder lock", unlockErr, map[string]string{"Owner": s.owner})
+	}
+	return err
+}
+
+func (s *Shredder) compactCrashHistory() error {
+	stats, err := s.store.CompactCrashHistory(s.timeProvider.Time())
+	if err != nil {
+		s.logger.Error("Failed to compact the crash history", err)
+		return err
+	}
+
+	if stats.Apps > 0 {
+		s.logger.Info("Compacted the crash history", map[string]string{
+			"Apps":     strconv.Itoa(stats.Apps),
+			"Crashes":  strconv.Itoa(stats.Crashes),
+			"Duration": stats.Duration.String(),
+		})
+	}
+
+	err = s.metricsAccountant.TrackCrashCompaction(stats)
+	if err != nil {
+		s.logger.Error("Failed to track the crash compaction metrics", err)
+	}
+	return nil
 }
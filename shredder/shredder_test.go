@@ -1,10 +1,16 @@
 package shredder_test
 
 import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
 	. "github.com/cloudfoundry/hm9000/shredder"
 	storepackage "github.com/cloudfoundry/hm9000/store"
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakemetricsaccountant"
 	"github.com/cloudfoundry/storeadapter"
 	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
 	. "github.com/onsi/ginkgo"
@@ -13,16 +19,24 @@ import (
 
 var _ = Describe("Shredder", func() {
 	var (
-		shredder     *Shredder
-		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		shredder          *Shredder
+		storeAdapter      *fakestoreadapter.FakeStoreAdapter
+		store             storepackage.Store
+		logger            *fakelogger.FakeLogger
+		timeProvider      *faketimeprovider.FakeTimeProvider
+		conf              *config.Config
+		metricsAccountant *fakemetricsaccountant.FakeMetricsAccountant
 	)
 
 	BeforeEach(func() {
 		storeAdapter = fakestoreadapter.New()
-		conf, _ := config.DefaultConfig()
+		conf, _ = config.DefaultConfig()
 		conf.StoreSchemaVersion = 2
-		store := storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
-		shredder = New(store)
+		logger = fakelogger.NewFakeLogger()
+		store = storepackage.NewStore(conf, storeAdapter, logger)
+		timeProvider = faketimeprovider.New(time.Unix(1000, 0))
+		metricsAccountant = fakemetricsaccountant.New()
+		shredder = New(store, metricsAccountant, "alice", time.Minute, timeProvider, logger)
 
 		storeAdapter.SetMulti([]storeadapter.StoreNode{
 			{Key: "/hm/v2/pokemon/geodude", Value: []byte{}},
@@ -69,4 +83,100 @@ var _ = Describe("Shredder", func() {
 		_, err := storeAdapter.Get("/let/me/be")
 		Ω(err).ShouldNot(HaveOccurred())
 	})
+
+	It("should give up the shredder lock once it is done", func() {
+		_, err := store.GetLock(LockName)
+		Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+	})
+
+	Describe("compacting the crash history", func() {
+		BeforeEach(func() {
+			conf.AppHistoryMaxEvents = 10
+			conf.CrashCompactionWindowInSeconds.Duration = 100 * time.Second
+			store.RecordAppEvents(timeProvider.Time(),
+				models.AppEvent{Type: models.AppEventCrashObserved, Timestamp: 500, AppGuid: "abc"},
+				models.AppEvent{Type: models.AppEventCrashObserved, Timestamp: 950, AppGuid: "abc"},
+			)
+		})
+
+		It("should roll the old crashes into daily counts and track the compaction", func() {
+			Ω(shredder.Shred()).Should(Succeed())
+
+			trend, err := store.GetCrashTrend("abc")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(trend.Days).Should(Equal([]models.DailyCrashCount{{Day: 0, Crashes: 1}}))
+
+			Ω(metricsAccountant.TrackedCrashCompactions).Should(HaveLen(2))
+			Ω(metricsAccountant.TrackedCrashCompactions[1].Apps).Should(Equal(1))
+			Ω(metricsAccountant.TrackedCrashCompactions[1].Crashes).Should(Equal(1))
+		})
+
+		Context("when the crash history fails to compact", func() {
+			BeforeEach(func() {
+				storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("crash-trends", errors.New("oops"))
+			})
+
+			It("should return the error and give up the lock", func() {
+				Ω(shredder.Shred()).Should(Equal(errors.New("oops")))
+
+				_, err := store.GetLock(LockName)
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			})
+		})
+	})
+
+	Context("when another shredder holds the lock", func() {
+		BeforeEach(func() {
+			storeAdapter.SetMulti([]storeadapter.StoreNode{
+				{Key: "/hm/nuke/me/cause/im/not/versioned", Value: []byte("abc")},
+			})
+			_, err := store.Lock(LockName, "bob", time.Minute, timeProvider.Time())
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should skip the run", func() {
+			Ω(shredder.Shred()).Should(Succeed())
+
+			_, err := storeAdapter.Get("/hm/nuke/me/cause/im/not/versioned")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(logger.LoggedSubjects).Should(ContainElement("Skipping shred: another shredder holds the lock"))
+		})
+
+		It("should shred once the other shredder's lock expires", func() {
+			timeProvider.IncrementBySeconds(60)
+			Ω(shredder.Shred()).Should(Succeed())
+
+			_, err := storeAdapter.Get("/hm/nuke/me/cause/im/not/versioned")
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+	})
+
+	Context("when the shredder loses the lock part way through", func() {
+		BeforeEach(func() {
+			storeAdapter.SetMulti([]storeadapter.StoreNode{
+				{Key: "/hm/nuke/me/cause/im/not/versioned", Value: []byte("abc")},
+			})
+			shredder = New(store, metricsAccountant, "alice", time.Minute, stallingTimeProvider{timeProvider}, logger)
+		})
+
+		It("should stop, deleting nothing, and return the error", func() {
+			Ω(shredder.Shred()).Should(Equal(storepackage.LockLostError))
+
+			_, err := storeAdapter.Get("/hm/nuke/me/cause/im/not/versioned")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(logger.LoggedSubjects).Should(ContainElement("Stopping shred: lost the shredder lock"))
+		})
+	})
 })
+
+// stallingTimeProvider lets a minute pass each time it is asked the time, so
+// that the shredder's lock has expired by the time it first checks it.
+type stallingTimeProvider struct {
+	*faketimeprovider.FakeTimeProvider
+}
+
+func (p stallingTimeProvider) Time() time.Time {
+	now := p.FakeTimeProvider.Time()
+	p.IncrementBySeconds(60)
+	return now
+}
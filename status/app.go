@@ -0,0 +1,185 @@
+package status
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/analyzer"
+	"github.com/cloudfoundry/hm9000/models"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+)
+
+type Instance struct {
+	InstanceGuid string               `json:"instance_guid"`
+	Index        int                  `json:"index"`
+	State        models.InstanceState `json:"state"`
+	DeaGuid      string               `json:"dea_guid"`
+
+	// Uptime is how long the instance has been in its state.
+	Uptime     time.Duration `json:"uptime"`
+	CrashCount int           `json:"crash_count"`
+}
+
+type AppReport struct {
+	AppGuid    string `json:"app_guid"`
+	AppVersion string `json:"app_version"`
+
+	// Desired is nil if the app is not desired.
+	Desired   *models.DesiredAppState `json:"desired"`
+	Instances []Instance              `json:"instances"`
+
+	// CrashReasons are why the app's indices last crashed, in index order.
+	CrashReasons []models.CrashReason `json:"crash_reasons"`
+
+	PendingStarts []models.PendingStartMessage `json:"pending_starts"`
+	PendingStops  []models.PendingStopMessage  `json:"pending_stops"`
+
+	// Explanation is what the analyzer would do for the app now.  If the
+	// store is not fresh the analyzer does nothing and Fresh is false.
+	Fresh       bool                 `json:"fresh"`
+	Explanation analyzer.Explanation `json:"explanation"`
+}
+
+// InspectApp reports on every version of the app that the store knows of,
+// or on appVersion alone if it is not empty.  It returns
+// store.AppNotFoundError if there is nothing to report.
+func (collector *Collector) InspectApp(appGuid string, appVersion string) ([]AppReport, error) {
+	now := collector.timeProvider.Time()
+
+	apps, err := collector.findApp(appGuid, appVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	starts, err := collector.store.GetPendingStartMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	stops, err := collector.store.GetPendingStopMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	fresh := collector.store.VerifyFreshness(now) == nil
+
+	reports := []AppReport{}
+	for _, app := range apps {
+		report := AppReport{
+			AppGuid:       app.AppGuid,
+			AppVersion:    app.AppVersion,
+			Instances:     []Instance{},
+			PendingStarts: []models.PendingStartMessage{},
+			PendingStops:  []models.PendingStopMessage{},
+			Fresh:         fresh,
+			Explanation:   analyzer.Explain(app, now, starts, stops, collector.conf),
+		}
+
+		if app.IsDesired() {
+			desired := app.Desired
+			report.Desired = &desired
+		}
+
+		for _, heartbeat := range app.InstanceHeartbeats {
+			report.Instances = append(report.Instances, Instance{
+				InstanceGuid: heartbeat.InstanceGuid,
+				Index:        heartbeat.InstanceIndex,
+				State:        heartbeat.State,
+				DeaGuid:      heartbeat.DeaGuid,
+				Uptime:       now.Sub(time.Unix(0, int64(heartbeat.StateTimestamp*float64(time.Second)))),
+				CrashCount:   app.CrashCountAtIndex(heartbeat.InstanceIndex, now).CrashCount,
+			})
+		}
+		sort.Sort(instancesByIndex(report.Instances))
+
+		report.CrashReasons, err = collector.store.GetCrashReasonsForApp(app.AppGuid, app.AppVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		startKeys := []string{}
+		for key := range starts {
+			startKeys = append(startKeys, key)
+		}
+		sort.Strings(startKeys)
+		for _, key := range startKeys {
+			if starts[key].AppGuid == app.AppGuid && starts[key].AppVersion == app.AppVersion {
+				report.PendingStarts = append(report.PendingStarts, starts[key])
+			}
+		}
+
+		stopKeys := []string{}
+		for key := range stops {
+			stopKeys = append(stopKeys, key)
+		}
+		sort.Strings(stopKeys)
+		for _, key := range stopKeys {
+			if stops[key].AppGuid == app.AppGuid && stops[key].AppVersion == app.AppVersion {
+				report.PendingStops = append(report.PendingStops, stops[key])
+			}
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func (collector *Collector) findApp(appGuid string, appVersion string) ([]*models.App, error) {
+	if appVersion != "" {
+		app, err := collector.store.GetApp(appGuid, appVersion)
+		if err != nil {
+			return nil, err
+		}
+		return []*models.App{app}, nil
+	}
+
+	apps, err := collector.store.GetApps()
+	if err != nil {
+		return nil, err
+	}
+
+	found := []*models.App{}
+	for _, app := range apps {
+		if app.AppGuid == appGuid {
+			found = append(found, app)
+		}
+	}
+	if len(found) == 0 {
+		return nil, storepackage.AppNotFoundError
+	}
+	sort.Sort(appsByVersion(found))
+
+	return found, nil
+}
+
+type instancesByIndex []Instance
+
+func (instances instancesByIndex) Len() int {
+	return len(instances)
+}
+
+func (instances instancesByIndex) Swap(i, j int) {
+	instances[i], instances[j] = instances[j], instances[i]
+}
+
+func (instances instancesByIndex) Less(i, j int) bool {
+	if instances[i].Index != instances[j].Index {
+		return instances[i].Index < instances[j].Index
+	}
+	return instances[i].InstanceGuid < instances[j].InstanceGuid
+}
+
+type appsByVersion []*models.App
+
+func (apps appsByVersion) Len() int {
+	return len(apps)
+}
+
+func (apps appsByVersion) Swap(i, j int) {
+	apps[i], apps[j] = apps[j], apps[i]
+}
+
+func (apps appsByVersion) Less(i, j int) bool {
+	return apps[i].AppVersion < apps[j].AppVersion
+}
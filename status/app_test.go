@@ -0,0 +1,155 @@
+package status_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/status"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inspecting an app", func() {
+	var (
+		conf      *config.Config
+		store     storepackage.Store
+		collector *Collector
+		app       appfixture.AppFixture
+		now       time.Time
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		store = storepackage.NewStore(conf, fakestoreadapter.New(), fakelogger.NewFakeLogger())
+		now = time.Unix(10000, 0)
+		collector = New(store, faketimeprovider.New(now), conf)
+
+		app = appfixture.NewAppFixture()
+		store.BumpDesiredFreshness(time.Unix(100, 0))
+		store.BumpActualFreshness(time.Unix(100, 0))
+		store.SyncDesiredState(app.DesiredState(3))
+
+		running := app.InstanceAtIndex(0).Heartbeat()
+		running.StateTimestamp = float64(now.Add(-time.Minute).Unix())
+		crashed := app.CrashedInstanceHeartbeatAtIndex(1)
+		crashed.StateTimestamp = float64(now.Add(-time.Second).Unix())
+		store.SyncHeartbeats(models.Heartbeat{
+			DeaGuid:            app.DeaGuid,
+			InstanceHeartbeats: []models.InstanceHeartbeat{crashed, running},
+		})
+		store.SaveCrashCounts(models.CrashCount{AppGuid: app.AppGuid, AppVersion: app.AppVersion, InstanceIndex: 1, CrashCount: 4})
+	})
+
+	It("reports the desired state", func() {
+		reports, err := collector.InspectApp(app.AppGuid, "")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reports).Should(HaveLen(1))
+		Ω(reports[0].AppGuid).Should(Equal(app.AppGuid))
+		Ω(reports[0].AppVersion).Should(Equal(app.AppVersion))
+		Ω(*reports[0].Desired).Should(Equal(app.DesiredState(3)))
+	})
+
+	It("reports every instance, by index, with its uptime and crash count", func() {
+		reports, err := collector.InspectApp(app.AppGuid, "")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		instances := reports[0].Instances
+		Ω(instances).Should(HaveLen(2))
+		Ω(instances[0].Index).Should(Equal(0))
+		Ω(instances[0].State).Should(Equal(models.InstanceStateRunning))
+		Ω(instances[0].InstanceGuid).Should(Equal(app.InstanceAtIndex(0).InstanceGuid))
+		Ω(instances[0].Uptime).Should(Equal(time.Minute))
+		Ω(instances[0].CrashCount).Should(Equal(0))
+
+		Ω(instances[1].Index).Should(Equal(1))
+		Ω(instances[1].State).Should(Equal(models.InstanceStateCrashed))
+		Ω(instances[1].Uptime).Should(Equal(time.Second))
+		Ω(instances[1].CrashCount).Should(Equal(4))
+	})
+
+	It("reports why the app's indices last crashed", func() {
+		exited := app.InstanceAtIndex(1).DropletExited(models.DropletExitedReasonCrashed)
+		exited.ExitDescription = "out of memory"
+		reason := models.NewCrashReason(exited, now)
+		store.SaveCrashReasons(reason)
+
+		reports, err := collector.InspectApp(app.AppGuid, "")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reports[0].CrashReasons).Should(Equal([]models.CrashReason{reason}))
+	})
+
+	It("reports the app's pending messages and no one else's", func() {
+		start := models.NewPendingStartMessage(now, 30, 0, app.AppGuid, app.AppVersion, 2, 1.0, models.PendingStartMessageReasonMissing)
+		otherStart := models.NewPendingStartMessage(now, 30, 0, "other-app", app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing)
+		stop := models.NewPendingStopMessage(now, 30, 0, app.AppGuid, app.AppVersion, "extra-instance", models.PendingStopMessageReasonExtra)
+		store.SavePendingStartMessages(start, otherStart)
+		store.SavePendingStopMessages(stop)
+
+		reports, err := collector.InspectApp(app.AppGuid, "")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reports[0].PendingStarts).Should(Equal([]models.PendingStartMessage{start}))
+		Ω(reports[0].PendingStops).Should(Equal([]models.PendingStopMessage{stop}))
+	})
+
+	It("explains what the analyzer would do", func() {
+		reports, err := collector.InspectApp(app.AppGuid, "")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reports[0].Fresh).Should(BeTrue())
+		Ω(reports[0].Explanation.StartMessages).Should(HaveLen(2))
+		Ω(reports[0].Explanation.Steps).Should(HaveLen(3))
+
+		pending, _ := store.GetPendingStartMessages()
+		Ω(pending).Should(BeEmpty())
+	})
+
+	It("says when the store is not fresh", func() {
+		store.RevokeDesiredFreshness()
+
+		reports, err := collector.InspectApp(app.AppGuid, "")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reports[0].Fresh).Should(BeFalse())
+	})
+
+	Context("when the app has several versions", func() {
+		var newVersion appfixture.AppFixture
+
+		BeforeEach(func() {
+			newVersion = appfixture.NewAppFixture()
+			newVersion.AppGuid = app.AppGuid
+			newVersion.AppVersion = "zzz-" + app.AppVersion
+			store.SyncDesiredState(app.DesiredState(3), newVersion.DesiredState(1))
+		})
+
+		It("reports every version", func() {
+			reports, err := collector.InspectApp(app.AppGuid, "")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reports).Should(HaveLen(2))
+			Ω(reports[0].AppVersion).Should(Equal(app.AppVersion))
+			Ω(reports[1].AppVersion).Should(Equal(newVersion.AppVersion))
+		})
+
+		It("reports one version if asked", func() {
+			reports, err := collector.InspectApp(app.AppGuid, newVersion.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reports).Should(HaveLen(1))
+			Ω(reports[0].AppVersion).Should(Equal(newVersion.AppVersion))
+			Ω(reports[0].Instances).Should(BeEmpty())
+		})
+	})
+
+	Context("when the store knows nothing of the app", func() {
+		It("returns AppNotFoundError", func() {
+			_, err := collector.InspectApp("no-such-app", "")
+			Ω(err).Should(Equal(storepackage.AppNotFoundError))
+
+			_, err = collector.InspectApp("no-such-app", "v1")
+			Ω(err).Should(Equal(storepackage.AppNotFoundError))
+		})
+	})
+})
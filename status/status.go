@@ -0,0 +1,264 @@
+package status
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// A component whose last run started more than StaleRunIntervals polling
+// intervals ago is reported as having stopped running.
+const StaleRunIntervals = 3
+
+type Freshness struct {
+	Present bool          `json:"present"`
+	Fresh   bool          `json:"fresh"`
+	Age     time.Duration `json:"age"`
+	TTL     time.Duration `json:"ttl"`
+}
+
+type Component struct {
+	Name string `json:"name"`
+
+	// Leader is the candidate leading the component's election, for the
+	// components that hold one.  It is empty if nobody leads.
+	Leader   string `json:"leader,omitempty"`
+	Electing bool   `json:"electing"`
+
+	LastRun      *models.ComponentRun `json:"last_run,omitempty"`
+	SinceLastRun time.Duration        `json:"since_last_run"`
+
+	// Control is how an operator has set the component through the admin
+	// API, if they have.
+	Control *models.ComponentControl `json:"control,omitempty"`
+}
+
+type Report struct {
+	DesiredFreshness Freshness `json:"desired_freshness"`
+	ActualFreshness  Freshness `json:"actual_freshness"`
+
+	PendingStarts      int `json:"pending_starts"`
+	PendingStartsReady int `json:"pending_starts_ready"`
+	PendingStops       int `json:"pending_stops"`
+	PendingStopsReady  int `json:"pending_stops_ready"`
+
+	Components []Component `json:"components"`
+
+	DesiredApps      int `json:"desired_apps"`
+	DesiredInstances int `json:"desired_instances"`
+	RunningInstances int `json:"running_instances"`
+	CrashedInstances int `json:"crashed_instances"`
+
+	Alarms []string `json:"alarms"`
+}
+
+func (report Report) IsHealthy() bool {
+	return len(report.Alarms) == 0
+}
+
+type polledComponent struct {
+	name     string
+	interval func() time.Duration
+	electing bool
+	required bool
+}
+
+type Collector struct {
+	store        storepackage.Store
+	timeProvider timeprovider.TimeProvider
+	conf         *config.Config
+}
+
+func New(store storepackage.Store, timeProvider timeprovider.TimeProvider, conf *config.Config) *Collector {
+	return &Collector{
+		store:        store,
+		timeProvider: timeProvider,
+		conf:         conf,
+	}
+}
+
+func (collector *Collector) polledComponents() []polledComponent {
+	return []polledComponent{
+		{name: "Fetcher", interval: collector.conf.FetcherPollingInterval, required: true},
+		{name: "Analyzer", interval: collector.conf.AnalyzerPollingInterval, electing: true, required: true},
+		{name: "Sender", interval: collector.conf.SenderPollingInterval, electing: true, required: true},
+		{name: "Shredder", interval: collector.conf.ShredderPollingInterval},
+		{name: "Aggregator", interval: collector.conf.AggregatorPollingInterval},
+	}
+}
+
+// Collect reads the store and reports on it as of the time provider's now.
+// Problems an operator should act on are listed in Alarms.
+func (collector *Collector) Collect() (Report, error) {
+	now := collector.timeProvider.Time()
+	report := Report{Alarms: []string{}}
+
+	err := collector.collectFreshness(&report, now)
+	if err != nil {
+		return Report{}, err
+	}
+
+	err = collector.collectPendingMessages(&report, now)
+	if err != nil {
+		return Report{}, err
+	}
+
+	err = collector.collectComponents(&report, now)
+	if err != nil {
+		return Report{}, err
+	}
+
+	err = collector.collectApps(&report)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+func (collector *Collector) collectFreshness(report *Report, now time.Time) error {
+	desired, err := collector.store.GetDesiredFreshness()
+	if err != nil {
+		return err
+	}
+	report.DesiredFreshness = freshness(desired, now)
+	report.DesiredFreshness.Fresh, err = collector.store.IsDesiredStateFresh()
+	if err != nil {
+		return err
+	}
+
+	actual, err := collector.store.GetActualFreshness()
+	if err != nil {
+		return err
+	}
+	report.ActualFreshness = freshness(actual, now)
+	report.ActualFreshness.Fresh, err = collector.store.IsActualStateFresh(now)
+	if err != nil {
+		return err
+	}
+
+	if !report.DesiredFreshness.Fresh {
+		report.Alarms = append(report.Alarms, "Desired state is not fresh: the fetcher has not synced with the Cloud Controller recently")
+	}
+	if !report.ActualFreshness.Present {
+		report.Alarms = append(report.Alarms, "Actual state is not fresh: the listener is not receiving heartbeats")
+	} else if !report.ActualFreshness.Fresh {
+		report.Alarms = append(report.Alarms, "Actual state is not fresh yet: the listener has not been receiving heartbeats for long enough")
+	}
+
+	return nil
+}
+
+func freshness(stored storepackage.Freshness, now time.Time) Freshness {
+	if !stored.Present {
+		return Freshness{}
+	}
+	return Freshness{
+		Present: true,
+		Age:     now.Sub(stored.Since),
+		TTL:     time.Duration(stored.TTL) * time.Second,
+	}
+}
+
+func (collector *Collector) collectPendingMessages(report *Report, now time.Time) error {
+	starts, err := collector.store.GetPendingStartMessages()
+	if err != nil {
+		return err
+	}
+	report.PendingStarts = len(starts)
+	for _, start := range starts {
+		if start.IsTimeToSend(now) {
+			report.PendingStartsReady++
+		}
+	}
+
+	stops, err := collector.store.GetPendingStopMessages()
+	if err != nil {
+		return err
+	}
+	report.PendingStops = len(stops)
+	for _, stop := range stops {
+		if stop.IsTimeToSend(now) {
+			report.PendingStopsReady++
+		}
+	}
+
+	return nil
+}
+
+func (collector *Collector) collectComponents(report *Report, now time.Time) error {
+	runs, err := collector.store.GetComponentRuns()
+	if err != nil {
+		return err
+	}
+
+	controls, err := collector.store.GetComponentControls()
+	if err != nil {
+		return err
+	}
+
+	report.Components = []Component{}
+	for _, polled := range collector.polledComponents() {
+		component := Component{Name: polled.name, Electing: polled.electing}
+
+		if polled.electing {
+			component.Leader, err = collector.store.GetLeader(polled.name)
+			if err == storeadapter.ErrorKeyNotFound {
+				report.Alarms = append(report.Alarms, fmt.Sprintf("%s has no leader", polled.name))
+			} else if err != nil {
+				return err
+			}
+		}
+
+		run, ok := runs[polled.name]
+		if ok {
+			component.LastRun = &run
+			component.SinceLastRun = now.Sub(time.Unix(run.StartedAt, 0))
+		}
+
+		control, controlled := controls[strings.ToLower(polled.name)]
+		if controlled {
+			component.Control = &control
+		}
+
+		switch {
+		case controlled && control.Paused:
+			report.Alarms = append(report.Alarms, fmt.Sprintf("%s was paused by %s: %s", polled.name, control.ChangedBy, control.Reason))
+		case !ok && polled.required:
+			report.Alarms = append(report.Alarms, fmt.Sprintf("%s has never run", polled.name))
+		case !ok:
+		case component.SinceLastRun > StaleRunIntervals*polled.interval():
+			report.Alarms = append(report.Alarms, fmt.Sprintf("%s has not run for %s", polled.name, component.SinceLastRun))
+		case !run.Succeeded():
+			report.Alarms = append(report.Alarms, fmt.Sprintf("%s failed its last run: %s", polled.name, run.Error))
+		}
+
+		report.Components = append(report.Components, component)
+	}
+
+	return nil
+}
+
+func (collector *Collector) collectApps(report *Report) error {
+	apps, err := collector.store.GetApps()
+	if err != nil {
+		return err
+	}
+
+	for _, app := range apps {
+		if app.IsDesired() {
+			report.DesiredApps++
+			report.DesiredInstances += app.NumberOfDesiredInstances()
+		}
+		report.RunningInstances += app.NumberOfStartingOrRunningInstances()
+		report.CrashedInstances += app.NumberOfCrashedInstances()
+	}
+
+	return nil
+}
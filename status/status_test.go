@@ -0,0 +1,245 @@
+package status_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/leaderelection"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/status"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Status", func() {
+	var (
+		conf         *config.Config
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		store        *storepackage.RealStore
+		timeProvider *faketimeprovider.FakeTimeProvider
+		collector    *Collector
+		app          appfixture.AppFixture
+		freshSince   time.Time
+		now          time.Time
+	)
+
+	elect := func(component string, candidate string) {
+		storeAdapter.Create(storeadapter.StoreNode{
+			Key:   leaderelection.LockKey(component),
+			Value: []byte(candidate),
+		})
+	}
+
+	run := func(component string, ago time.Duration, err string) {
+		store.SaveComponentRun(models.ComponentRun{
+			Component:              component,
+			StartedAt:              now.Add(-ago).Unix(),
+			DurationInMilliseconds: 120,
+			Error:                  err,
+		})
+	}
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = storepackage.NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		freshSince = time.Unix(1000, 0)
+		now = freshSince.Add(time.Hour)
+		timeProvider = faketimeprovider.New(now)
+		collector = New(store, timeProvider, conf)
+
+		app = appfixture.NewAppFixture()
+		store.BumpDesiredFreshness(freshSince)
+		store.BumpActualFreshness(freshSince)
+		store.SyncDesiredState(app.DesiredState(3))
+		store.SyncHeartbeats(app.Heartbeat(2))
+
+		elect("Analyzer", "analyzer-0")
+		elect("Sender", "sender-1")
+		run("Fetcher", time.Second, "")
+		run("Analyzer", time.Second, "")
+		run("Sender", time.Second, "")
+		run("Shredder", time.Second, "")
+	})
+
+	Context("when everything is healthy", func() {
+		It("reports no alarms", func() {
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Alarms).Should(BeEmpty())
+			Ω(report.IsHealthy()).Should(BeTrue())
+		})
+
+		It("reports the freshness of the desired and actual state", func() {
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.DesiredFreshness).Should(Equal(Freshness{
+				Present: true,
+				Fresh:   true,
+				Age:     time.Hour,
+				TTL:     time.Duration(conf.DesiredFreshnessTTL()) * time.Second,
+			}))
+			Ω(report.ActualFreshness).Should(Equal(Freshness{
+				Present: true,
+				Fresh:   true,
+				Age:     time.Hour,
+				TTL:     time.Duration(conf.ActualFreshnessTTL()) * time.Second,
+			}))
+		})
+
+		It("reports the leaders and last runs of the polling components", func() {
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Components).Should(HaveLen(5))
+
+			fetcher := report.Components[0]
+			Ω(fetcher.Name).Should(Equal("Fetcher"))
+			Ω(fetcher.Electing).Should(BeFalse())
+			Ω(fetcher.LastRun.DurationInMilliseconds).Should(BeNumerically("==", 120))
+			Ω(fetcher.SinceLastRun).Should(Equal(time.Second))
+
+			analyzer := report.Components[1]
+			Ω(analyzer.Name).Should(Equal("Analyzer"))
+			Ω(analyzer.Electing).Should(BeTrue())
+			Ω(analyzer.Leader).Should(Equal("analyzer-0"))
+
+			Ω(report.Components[2].Name).Should(Equal("Sender"))
+			Ω(report.Components[2].Leader).Should(Equal("sender-1"))
+			Ω(report.Components[3].Name).Should(Equal("Shredder"))
+			Ω(report.Components[4].Name).Should(Equal("Aggregator"))
+			Ω(report.Components[4].LastRun).Should(BeNil())
+		})
+
+		It("reports app and instance totals", func() {
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.DesiredApps).Should(Equal(1))
+			Ω(report.DesiredInstances).Should(Equal(3))
+			Ω(report.RunningInstances).Should(Equal(2))
+			Ω(report.CrashedInstances).Should(Equal(0))
+		})
+	})
+
+	It("counts crashed instances", func() {
+		crashed := app.CrashedInstanceHeartbeatAtIndex(2)
+		crashed.DeaGuid = "dea-crashed"
+		store.SyncHeartbeats(models.Heartbeat{
+			DeaGuid:            crashed.DeaGuid,
+			InstanceHeartbeats: []models.InstanceHeartbeat{crashed},
+		})
+
+		report, err := collector.Collect()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(report.CrashedInstances).Should(Equal(1))
+	})
+
+	It("reports pending queue depths and how many are ready to send", func() {
+		store.SavePendingStartMessages(
+			models.NewPendingStartMessage(now, 0, 10, app.AppGuid, app.AppVersion, 2, 1.0, models.PendingStartMessageReasonMissing),
+			models.NewPendingStartMessage(now, 30, 10, "other-app", app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing),
+		)
+		store.SavePendingStopMessages(
+			models.NewPendingStopMessage(now, 30, 10, app.AppGuid, app.AppVersion, app.InstanceAtIndex(0).InstanceGuid, models.PendingStopMessageReasonExtra),
+		)
+
+		report, err := collector.Collect()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(report.PendingStarts).Should(Equal(2))
+		Ω(report.PendingStartsReady).Should(Equal(1))
+		Ω(report.PendingStops).Should(Equal(1))
+		Ω(report.PendingStopsReady).Should(Equal(0))
+	})
+
+	Describe("alarms", func() {
+		It("raises one when the desired state is not fresh", func() {
+			store.RevokeDesiredFreshness()
+
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.DesiredFreshness).Should(Equal(Freshness{}))
+			Ω(report.Alarms).Should(ConsistOf(ContainSubstring("Desired state is not fresh")))
+		})
+
+		It("raises one when the actual state is missing", func() {
+			store.RevokeActualFreshness()
+
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Alarms).Should(ConsistOf(ContainSubstring("listener is not receiving heartbeats")))
+		})
+
+		It("raises one when the actual state has not been fresh for long enough", func() {
+			timeProvider.TimeToProvide = freshSince.Add(time.Second)
+			now = timeProvider.TimeToProvide
+			run("Fetcher", 0, "")
+			run("Analyzer", 0, "")
+			run("Sender", 0, "")
+			run("Shredder", 0, "")
+
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.ActualFreshness.Present).Should(BeTrue())
+			Ω(report.ActualFreshness.Fresh).Should(BeFalse())
+			Ω(report.Alarms).Should(ConsistOf(ContainSubstring("Actual state is not fresh yet")))
+		})
+
+		It("raises one for each electing component without a leader", func() {
+			storeAdapter.Delete(leaderelection.LockKey("Analyzer"), leaderelection.LockKey("Sender"))
+
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Components[1].Leader).Should(BeEmpty())
+			Ω(report.Alarms).Should(ConsistOf("Analyzer has no leader", "Sender has no leader"))
+		})
+
+		It("raises one when a required component has never run", func() {
+			storeAdapter.Delete(store.SchemaRoot()+"/component-runs/Analyzer", store.SchemaRoot()+"/component-runs/Shredder")
+
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Components[1].LastRun).Should(BeNil())
+			Ω(report.Alarms).Should(ConsistOf("Analyzer has never run"))
+		})
+
+		It("raises one when a component has not run for several polling intervals", func() {
+			run("Sender", StaleRunIntervals*conf.SenderPollingInterval()+time.Second, "")
+
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Alarms).Should(ConsistOf(HavePrefix("Sender has not run for")))
+		})
+
+		It("raises one when a component's last run failed", func() {
+			run("Fetcher", time.Second, "the cloud controller is down")
+
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Alarms).Should(ConsistOf("Fetcher failed its last run: the cloud controller is down"))
+		})
+
+		It("raises one, instead of any about its runs, when a component is paused", func() {
+			run("Sender", StaleRunIntervals*conf.SenderPollingInterval()+time.Second, "")
+			store.SaveComponentControl(models.ComponentControl{Component: "sender", Paused: true, ChangedBy: "admin", Reason: "incident 42"})
+
+			report, err := collector.Collect()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(report.Components[2].Control.Paused).Should(BeTrue())
+			Ω(report.Alarms).Should(ConsistOf("Sender was paused by admin: incident 42"))
+		})
+	})
+
+	Context("when the store fails", func() {
+		It("returns the error", func() {
+			storeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("desired-fresh", storeadapter.ErrorTimeout)
+
+			_, err := collector.Collect()
+			Ω(err).Should(Equal(storeadapter.ErrorTimeout))
+		})
+	})
+})
@@ -15,15 +15,24 @@ func (store *RealStore) ensureCacheIsReady() error {
 
 	if time.Since(store.instanceHeartbeatCacheTimestamp) >= store.config.StoreHeartbeatCacheRefreshInterval() {
 		t := time.Now()
-		heartbeats, err := store.GetInstanceHeartbeats()
+		heartbeats, transitions, err := store.instanceHeartbeats()
 		if err != nil {
 			return err
 		}
 
-		store.instanceHeartbeatCache = map[string]models.InstanceHeartbeat{}
+		refreshed := map[string]models.InstanceHeartbeat{}
 		for _, heartbeat := range heartbeats {
-			store.instanceHeartbeatCache[heartbeat.InstanceGuid] = heartbeat
+			refreshed[heartbeat.InstanceGuid] = heartbeat
 		}
+		if store.config.ListenerUpdatesAppSummaries {
+			for instanceGuid, heartbeat := range store.instanceHeartbeatCache {
+				if _, ok := refreshed[instanceGuid]; !ok {
+					store.appsToResummarize[store.AppKey(heartbeat.AppGuid, heartbeat.AppVersion)] = models.AppSummary{AppGuid: heartbeat.AppGuid, AppVersion: heartbeat.AppVersion}
+				}
+			}
+		}
+		store.instanceHeartbeatCache = refreshed
+		store.instanceTransitionsCache = transitions
 		store.instanceHeartbeatCacheTimestamp = time.Now()
 		store.logger.Debug("Busting store cache", map[string]string{
 			"Duration":                   time.Since(t).String(),
@@ -36,6 +45,13 @@ func (store *RealStore) ensureCacheIsReady() error {
 }
 
 func (store *RealStore) SyncHeartbeats(incomingHeartbeats ...models.Heartbeat) error {
+	return store.syncHeartbeats(func(models.InstanceHeartbeat) bool { return true }, incomingHeartbeats)
+}
+
+// syncHeartbeats saves the instances that sync selects.  The stored state of
+// the others, whether they are in the heartbeats or have left them, is left
+// as it was.
+func (store *RealStore) syncHeartbeats(sync func(models.InstanceHeartbeat) bool, incomingHeartbeats []models.Heartbeat) error {
 	t := time.Now()
 
 	err := store.ensureCacheIsReady()
@@ -49,37 +65,57 @@ func (store *RealStore) SyncHeartbeats(incomingHeartbeats ...models.Heartbeat) e
 
 	store.instanceHeartbeatCacheMutex.Lock()
 
+	changedApps := store.appsToResummarize
+	store.appsToResummarize = map[string]models.AppSummary{}
+
 	for _, incomingHeartbeat := range incomingHeartbeats {
 		numberOfInstanceHeartbeats += len(incomingHeartbeat.InstanceHeartbeats)
 		incomingInstanceGuids := map[string]bool{}
 		nodesToSave = append(nodesToSave, store.deaPresenceNode(incomingHeartbeat.DeaGuid))
 		for _, incomingInstanceHeartbeat := range incomingHeartbeat.InstanceHeartbeats {
 			incomingInstanceGuids[incomingInstanceHeartbeat.InstanceGuid] = true
+			if !sync(incomingInstanceHeartbeat) {
+				continue
+			}
 			existingInstanceHeartbeat, found := store.instanceHeartbeatCache[incomingInstanceHeartbeat.InstanceGuid]
 
 			if found && existingInstanceHeartbeat.State == incomingInstanceHeartbeat.State {
 				continue
 			}
 
-			nodesToSave = append(nodesToSave, store.storeNodeForInstanceHeartbeat(incomingInstanceHeartbeat))
+			transitions := store.instanceTransitionsCache[incomingInstanceHeartbeat.InstanceGuid]
+			transitions = transitions.Record(existingInstanceHeartbeat.State, found, incomingInstanceHeartbeat.State, t)
+
+			nodesToSave = append(nodesToSave, store.storeNodeForInstanceHeartbeat(incomingInstanceHeartbeat, transitions))
+			changedApps[store.AppKey(incomingInstanceHeartbeat.AppGuid, incomingInstanceHeartbeat.AppVersion)] = models.AppSummary{AppGuid: incomingInstanceHeartbeat.AppGuid, AppVersion: incomingInstanceHeartbeat.AppVersion}
 			store.instanceHeartbeatCache[incomingInstanceHeartbeat.InstanceGuid] = incomingInstanceHeartbeat
+			store.instanceTransitionsCache[incomingInstanceHeartbeat.InstanceGuid] = transitions
 		}
 
 		cacheKeysToDelete := []string{}
 
 		for _, existingInstanceHeartbeat := range store.instanceHeartbeatCache {
-			if existingInstanceHeartbeat.DeaGuid == incomingHeartbeat.DeaGuid && !incomingInstanceGuids[existingInstanceHeartbeat.InstanceGuid] {
+			if existingInstanceHeartbeat.DeaGuid == incomingHeartbeat.DeaGuid && !incomingInstanceGuids[existingInstanceHeartbeat.InstanceGuid] && sync(existingInstanceHeartbeat) {
 				key := store.instanceHeartbeatStoreKey(existingInstanceHeartbeat.AppGuid, existingInstanceHeartbeat.AppVersion, existingInstanceHeartbeat.InstanceGuid)
 				keysToDelete = append(keysToDelete, key)
 				cacheKeysToDelete = append(cacheKeysToDelete, existingInstanceHeartbeat.InstanceGuid)
+				changedApps[store.AppKey(existingInstanceHeartbeat.AppGuid, existingInstanceHeartbeat.AppVersion)] = models.AppSummary{AppGuid: existingInstanceHeartbeat.AppGuid, AppVersion: existingInstanceHeartbeat.AppVersion}
 			}
 		}
 
 		for _, key := range cacheKeysToDelete {
 			delete(store.instanceHeartbeatCache, key)
+			delete(store.instanceTransitionsCache, key)
 		}
 	}
 
+	nodesToSave = append(nodesToSave, store.appFreshnessNodes(incomingHeartbeats, t)...)
+
+	instancesOfChangedApps := map[string][]models.InstanceHeartbeat{}
+	if store.config.ListenerUpdatesAppSummaries {
+		instancesOfChangedApps = store.instancesOfApps(changedApps)
+	}
+
 	store.instanceHeartbeatCacheMutex.Unlock()
 
 	tSave := time.Now()
@@ -100,6 +136,13 @@ func (store *RealStore) SyncHeartbeats(incomingHeartbeats ...models.Heartbeat) e
 		return err
 	}
 
+	if store.config.ListenerUpdatesAppSummaries {
+		err = store.resummarizeApps(changedApps, instancesOfChangedApps)
+		if err != nil {
+			return err
+		}
+	}
+
 	store.logger.Debug(fmt.Sprintf("Save Duration Actual"), map[string]string{
 		"Number of Heartbeats":          fmt.Sprintf("%d", len(incomingHeartbeats)),
 		"Number of Instance Heartbeats": fmt.Sprintf("%d", numberOfInstanceHeartbeats),
@@ -114,26 +157,42 @@ func (store *RealStore) SyncHeartbeats(incomingHeartbeats ...models.Heartbeat) e
 }
 
 func (store *RealStore) GetInstanceHeartbeats() (results []models.InstanceHeartbeat, err error) {
+	results, _, err = store.instanceHeartbeats()
+	return results, err
+}
+
+// GetInstanceTransitions returns when each instance with a heartbeat last
+// changed state, keyed by instance guid.  Instances last written by a
+// version of hm9000 that did not keep transitions have zero transitions
+// until their state next changes.
+func (store *RealStore) GetInstanceTransitions() (map[string]models.InstanceTransitions, error) {
+	_, transitions, err := store.instanceHeartbeats()
+	return transitions, err
+}
+
+func (store *RealStore) instanceHeartbeats() (results []models.InstanceHeartbeat, transitions map[string]models.InstanceTransitions, err error) {
 	results = []models.InstanceHeartbeat{}
+	transitions = map[string]models.InstanceTransitions{}
 	node, err := store.adapter.ListRecursively(store.SchemaRoot() + "/apps/actual")
 	if err == storeadapter.ErrorKeyNotFound {
-		return results, nil
+		return results, transitions, nil
 	} else if err != nil {
-		return results, err
+		return results, transitions, err
 	}
 
 	unexpiredDeas, err := store.unexpiredDeas()
 	if err != nil {
-		return results, err
+		return results, transitions, err
 	}
 
 	expiredKeys := []string{}
-	for _, actualNode := range node.ChildNodes {
-		heartbeats, toDelete, err := store.heartbeatsForNode(actualNode, unexpiredDeas)
+	seen := map[string]bool{}
+	for _, actualNode := range store.appNodes(node) {
+		heartbeats, toDelete, err := store.heartbeatsForNode(actualNode, unexpiredDeas, transitions)
 		if err != nil {
-			return []models.InstanceHeartbeat{}, nil
+			return []models.InstanceHeartbeat{}, map[string]models.InstanceTransitions{}, nil
 		}
-		results = append(results, heartbeats...)
+		results = appendUnseenHeartbeats(results, heartbeats, seen)
 		expiredKeys = append(expiredKeys, toDelete...)
 	}
 
@@ -141,14 +200,14 @@ func (store *RealStore) GetInstanceHeartbeats() (results []models.InstanceHeartb
 	if err == storeadapter.ErrorKeyNotFound {
 		store.logger.Debug("store.GetInstanceHeartbeats Failed to delete a key, soldiering on...")
 	} else if err != nil {
-		return []models.InstanceHeartbeat{}, err
+		return []models.InstanceHeartbeat{}, map[string]models.InstanceTransitions{}, err
 	}
 
-	return results, nil
+	return results, transitions, nil
 }
 
 func (store *RealStore) GetInstanceHeartbeatsForApp(appGuid string, appVersion string) (results []models.InstanceHeartbeat, err error) {
-	node, err := store.adapter.ListRecursively(store.SchemaRoot() + "/apps/actual/" + store.AppKey(appGuid, appVersion))
+	node, err := store.fetchApp(store.adapter.ListRecursively, store.SchemaRoot()+"/apps/actual", appGuid, appVersion)
 	if err == storeadapter.ErrorKeyNotFound {
 		return []models.InstanceHeartbeat{}, nil
 	} else if err != nil {
@@ -160,7 +219,7 @@ func (store *RealStore) GetInstanceHeartbeatsForApp(appGuid string, appVersion s
 		return results, err
 	}
 
-	results, expiredKeys, err := store.heartbeatsForNode(node, unexpiredDeas)
+	results, expiredKeys, err := store.heartbeatsForNode(node, unexpiredDeas, map[string]models.InstanceTransitions{})
 	if err != nil {
 		return []models.InstanceHeartbeat{}, err
 	}
@@ -175,7 +234,9 @@ func (store *RealStore) GetInstanceHeartbeatsForApp(appGuid string, appVersion s
 	return results, nil
 }
 
-func (store *RealStore) heartbeatsForNode(node storeadapter.StoreNode, unexpiredDeas map[string]bool) (results []models.InstanceHeartbeat, toDelete []string, err error) {
+// heartbeatsForNode decodes the instance heartbeats under node, adding their
+// transitions to transitions.
+func (store *RealStore) heartbeatsForNode(node storeadapter.StoreNode, unexpiredDeas map[string]bool, transitions map[string]models.InstanceTransitions) (results []models.InstanceHeartbeat, toDelete []string, err error) {
 	results = []models.InstanceHeartbeat{}
 	for _, heartbeatNode := range node.ChildNodes {
 		components := strings.Split(heartbeatNode.Key, "/")
@@ -186,10 +247,16 @@ func (store *RealStore) heartbeatsForNode(node storeadapter.StoreNode, unexpired
 			return []models.InstanceHeartbeat{}, []string{}, err
 		}
 
+		instanceTransitions, err := models.NewInstanceTransitionsFromCSV(heartbeatNode.Value)
+		if err != nil {
+			return []models.InstanceHeartbeat{}, []string{}, err
+		}
+
 		_, deaIsPresent := unexpiredDeas[heartbeat.DeaGuid]
 
 		if deaIsPresent {
 			results = append(results, heartbeat)
+			transitions[heartbeat.InstanceGuid] = instanceTransitions
 		} else {
 			toDelete = append(toDelete, heartbeatNode.Key)
 		}
@@ -198,6 +265,19 @@ func (store *RealStore) heartbeatsForNode(node storeadapter.StoreNode, unexpired
 	return results, toDelete, nil
 }
 
+// appendUnseenHeartbeats appends the heartbeats of the instances not yet
+// seen, so that an instance whose app is in both app layouts is taken once.
+func appendUnseenHeartbeats(results []models.InstanceHeartbeat, heartbeats []models.InstanceHeartbeat, seen map[string]bool) []models.InstanceHeartbeat {
+	for _, heartbeat := range heartbeats {
+		if seen[heartbeat.InstanceGuid] {
+			continue
+		}
+		seen[heartbeat.InstanceGuid] = true
+		results = append(results, heartbeat)
+	}
+	return results
+}
+
 func (store *RealStore) unexpiredDeas() (results map[string]bool, err error) {
 	results = map[string]bool{}
 
@@ -216,20 +296,26 @@ func (store *RealStore) unexpiredDeas() (results map[string]bool, err error) {
 }
 
 func (store *RealStore) instanceHeartbeatStoreKey(appGuid string, appVersion string, instanceGuid string) string {
-	return store.SchemaRoot() + "/apps/actual/" + store.AppKey(appGuid, appVersion) + "/" + instanceGuid
+	return store.appKeyUnder(store.SchemaRoot()+"/apps/actual", appGuid, appVersion) + "/" + instanceGuid
 }
 
 func (store *RealStore) deaPresenceNode(deaGuid string) storeadapter.StoreNode {
 	return storeadapter.StoreNode{
 		Key:   store.SchemaRoot() + "/dea-presence/" + deaGuid,
 		Value: []byte(deaGuid),
-		TTL:   store.config.HeartbeatTTL(),
+		TTL:   store.config.InstanceMissingGracePeriod(),
 	}
 }
 
-func (store *RealStore) storeNodeForInstanceHeartbeat(instanceHeartbeat models.InstanceHeartbeat) storeadapter.StoreNode {
+func (store *RealStore) storeNodeForInstanceHeartbeat(instanceHeartbeat models.InstanceHeartbeat, transitions models.InstanceTransitions) storeadapter.StoreNode {
+	value := append(instanceHeartbeat.ToCSV(), ',')
+	value = append(value, transitions.ToCSV()...)
+	if instanceHeartbeat.HasAddress() {
+		value = append(value, ',')
+		value = append(value, instanceHeartbeat.AddressToCSV()...)
+	}
 	return storeadapter.StoreNode{
 		Key:   store.instanceHeartbeatStoreKey(instanceHeartbeat.AppGuid, instanceHeartbeat.AppVersion, instanceHeartbeat.InstanceGuid),
-		Value: instanceHeartbeat.ToCSV(),
+		Value: value,
 	}
 }
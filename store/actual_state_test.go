@@ -12,6 +12,8 @@ import (
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
 	"github.com/cloudfoundry/storeadapter"
 	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+
+	"time"
 )
 
 var _ = Describe("Actual State", func() {
@@ -31,7 +33,7 @@ var _ = Describe("Actual State", func() {
 			workpool.NewWorkPool(conf.StoreMaxConcurrentRequests))
 		err = storeAdapter.Connect()
 		Ω(err).ShouldNot(HaveOccurred())
-		conf.StoreHeartbeatCacheRefreshIntervalInMilliseconds = 100
+		conf.StoreHeartbeatCacheRefreshIntervalInMilliseconds.Duration = 100 * time.Millisecond
 		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
 
 		dea = appfixture.NewDeaFixture()
@@ -50,6 +52,28 @@ var _ = Describe("Actual State", func() {
 			))
 		})
 
+		It("should keep the DEA's instances for the heartbeat TTL", func() {
+			node, err := storeAdapter.Get("/hm/v1/dea-presence/" + dea.DeaGuid)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(BeNumerically("~", conf.HeartbeatTTL(), 1))
+		})
+
+		Context("with an instance missing grace period", func() {
+			BeforeEach(func() {
+				conf.InstanceMissingGracePeriodInSeconds = config.DurationInSeconds{time.Minute}
+				store.SyncHeartbeats(dea.HeartbeatWith(
+					dea.GetApp(0).InstanceAtIndex(1).Heartbeat(),
+					dea.GetApp(1).InstanceAtIndex(3).Heartbeat(),
+				))
+			})
+
+			It("should keep the DEA's instances for the grace period", func() {
+				node, err := storeAdapter.Get("/hm/v1/dea-presence/" + dea.DeaGuid)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(node.TTL).Should(BeNumerically("~", 60, 1))
+			})
+		})
+
 		It("should save the instance heartbeats for the passed-in heartbeat", func() {
 			results, err := store.GetInstanceHeartbeats()
 			Ω(err).ShouldNot(HaveOccurred())
@@ -58,6 +82,24 @@ var _ = Describe("Actual State", func() {
 			Ω(results).Should(ContainElement(dea.GetApp(1).InstanceAtIndex(3).Heartbeat()))
 		})
 
+		Context("when the DEA sent the address of an instance", func() {
+			var instance models.InstanceHeartbeat
+
+			BeforeEach(func() {
+				instance = dea.GetApp(2).InstanceAtIndex(0).Heartbeat()
+				instance.Host = "10.0.0.1"
+				instance.Port = 61001
+				instance.Uris = []string{"foo.example.com", "bar.example.com"}
+				store.SyncHeartbeats(dea.HeartbeatWith(instance))
+			})
+
+			It("should keep the address with the instance", func() {
+				results, err := NewStore(conf, storeAdapter, fakelogger.NewFakeLogger()).GetInstanceHeartbeats()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(results).Should(ConsistOf(instance))
+			})
+		})
+
 		Context("when there are already instance heartbeats stored for the DEA in question", func() {
 			var modifiedHeartbeat models.InstanceHeartbeat
 			BeforeEach(func() {
@@ -404,4 +446,94 @@ var _ = Describe("Actual State", func() {
 			})
 		})
 	})
+
+	Describe("Instance transitions", func() {
+		var heartbeat models.InstanceHeartbeat
+
+		BeforeEach(func() {
+			heartbeat = dea.GetApp(0).InstanceAtIndex(1).Heartbeat()
+			heartbeat.State = models.InstanceStateStarting
+		})
+
+		transitionsFor := func(instanceGuid string) models.InstanceTransitions {
+			transitions, err := store.GetInstanceTransitions()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(transitions).Should(HaveKey(instanceGuid))
+			return transitions[instanceGuid]
+		}
+
+		It("records when a new instance entered its state", func() {
+			before := float64(time.Now().Add(-time.Second).Unix())
+			store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+
+			transitions := transitionsFor(heartbeat.InstanceGuid)
+			Ω(transitions.StateSince).Should(BeNumerically(">=", before))
+			Ω(transitions.StartedAt).Should(BeZero())
+			Ω(transitions.LastCrashedAt).Should(BeZero())
+		})
+
+		It("records when the instance started and crashed", func() {
+			store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+			starting := transitionsFor(heartbeat.InstanceGuid)
+
+			time.Sleep(200 * time.Millisecond)
+			heartbeat.State = models.InstanceStateRunning
+			store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+			running := transitionsFor(heartbeat.InstanceGuid)
+			Ω(running.StateSince).Should(BeNumerically(">", starting.StateSince))
+			Ω(running.StartedAt).Should(Equal(running.StateSince))
+
+			time.Sleep(200 * time.Millisecond)
+			heartbeat.State = models.InstanceStateCrashed
+			store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+			crashed := transitionsFor(heartbeat.InstanceGuid)
+			Ω(crashed.StateSince).Should(BeNumerically(">", running.StateSince))
+			Ω(crashed.StartedAt).Should(Equal(running.StartedAt))
+			Ω(crashed.LastCrashedAt).Should(Equal(crashed.StateSince))
+		})
+
+		It("keeps the transitions while the state holds", func() {
+			store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+			first := transitionsFor(heartbeat.InstanceGuid)
+
+			time.Sleep(200 * time.Millisecond)
+			store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+			Ω(transitionsFor(heartbeat.InstanceGuid)).Should(Equal(first))
+		})
+
+		It("picks up the transitions another store wrote", func() {
+			heartbeat.State = models.InstanceStateRunning
+			store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+			running := transitionsFor(heartbeat.InstanceGuid)
+
+			time.Sleep(200 * time.Millisecond)
+			otherStore := NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+			heartbeat.State = models.InstanceStateCrashed
+			otherStore.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+
+			crashed := transitionsFor(heartbeat.InstanceGuid)
+			Ω(crashed.StartedAt).Should(Equal(running.StartedAt))
+			Ω(crashed.LastCrashedAt).Should(BeNumerically(">", running.StartedAt))
+		})
+
+		It("does not change the instance heartbeats", func() {
+			store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+			Ω(store.GetInstanceHeartbeats()).Should(Equal([]models.InstanceHeartbeat{heartbeat}))
+		})
+
+		Context("when the heartbeat was written without transitions", func() {
+			BeforeEach(func() {
+				store.SyncHeartbeats(dea.HeartbeatWith(heartbeat))
+				storeAdapter.SetMulti([]storeadapter.StoreNode{{
+					Key:   "/hm/v1/apps/actual/" + store.AppKey(heartbeat.AppGuid, heartbeat.AppVersion) + "/" + heartbeat.StoreKey(),
+					Value: heartbeat.ToCSV(),
+				}})
+			})
+
+			It("reads the heartbeat with zero transitions", func() {
+				Ω(store.GetInstanceHeartbeats()).Should(Equal([]models.InstanceHeartbeat{heartbeat}))
+				Ω(transitionsFor(heartbeat.InstanceGuid)).Should(BeZero())
+			})
+		})
+	})
 })
@@ -0,0 +1,29 @@
+package store
+
+import (
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// The latest analysis report lives in /reports/analysis.
+
+func (store *RealStore) analysisReportKey() string {
+	return store.SchemaRoot() + "/reports/analysis"
+}
+
+func (store *RealStore) SaveAnalysisReport(report models.AnalysisReport) error {
+	return store.adapter.SetMulti([]storeadapter.StoreNode{{
+		Key:   store.analysisReportKey(),
+		Value: report.ToJSON(),
+	}})
+}
+
+// GetAnalysisReport returns the latest analysis report, or
+// storeadapter.ErrorKeyNotFound if the analyzer has not run yet.
+func (store *RealStore) GetAnalysisReport() (models.AnalysisReport, error) {
+	node, err := store.adapter.Get(store.analysisReportKey())
+	if err != nil {
+		return models.AnalysisReport{}, err
+	}
+	return models.NewAnalysisReportFromJSON(node.Value)
+}
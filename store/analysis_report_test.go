@@ -0,0 +1,36 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("The analysis report", func() {
+	var store Store
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		store = NewStore(conf, fakestoreadapter.New(), fakelogger.NewFakeLogger())
+	})
+
+	It("saves and returns the latest report", func() {
+		report := models.AnalysisReport{GeneratedAt: 100, StoreReads: 12, StoreWrites: 3, AppsScanned: 40, DurationInMilliseconds: 250}
+		err := store.SaveAnalysisReport(report)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		saved, err := store.GetAnalysisReport()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(saved).Should(Equal(report))
+	})
+
+	It("returns ErrorKeyNotFound when there is none", func() {
+		_, err := store.GetAnalysisReport()
+		Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+	})
+})
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// With per_app_freshness set, each app the listener hears of has a key,
+// which expires once the app has not been heard of for the heartbeat TTL:
+//
+//	/apps/freshness/<guid>,<version>
+//
+// An app's key is rewritten at most once a heartbeat period, when a
+// heartbeat carries an index it has not been written with since, or from
+// another DEA, so that keeping it costs no more than the DEA presence keys.
+
+func (store *RealStore) appFreshnessRoot() string {
+	return store.SchemaRoot() + "/apps/freshness"
+}
+
+// appFreshnessNodes records the instances of heartbeats, received at now,
+// in the freshness of their apps, and returns the nodes of the apps due to
+// be rewritten.  It must be called with the instance heartbeat cache
+// locked.
+func (store *RealStore) appFreshnessNodes(heartbeats []models.Heartbeat, now time.Time) []storeadapter.StoreNode {
+	if !store.config.PerAppFreshness {
+		return []storeadapter.StoreNode{}
+	}
+
+	due := map[string]bool{}
+	order := []string{}
+	updated := map[string]models.AppFreshness{}
+	for _, heartbeat := range heartbeats {
+		for _, instanceHeartbeat := range heartbeat.InstanceHeartbeats {
+			key := store.AppKey(instanceHeartbeat.AppGuid, instanceHeartbeat.AppVersion)
+			freshness, ok := updated[key]
+			if !ok {
+				freshness, ok = store.appFreshnessCache[key]
+				if !ok {
+					freshness = models.NewAppFreshness(instanceHeartbeat.AppGuid, instanceHeartbeat.AppVersion)
+				}
+				order = append(order, key)
+			}
+
+			written := store.appFreshnessCache[key]
+			if now.Sub(time.Unix(written.LastSeen, 0)) >= store.config.HeartbeatPeriod.Duration {
+				due[key] = true
+			}
+			if instanceHeartbeat.IsStartingOrRunning() {
+				index := instanceHeartbeat.InstanceIndex
+				if now.Sub(written.IndexSeenAt(index)) >= store.config.HeartbeatPeriod.Duration || written.IndexDea(index) != instanceHeartbeat.DeaGuid {
+					due[key] = true
+				}
+			}
+			updated[key] = freshness.Seen(instanceHeartbeat, now)
+		}
+	}
+
+	nodes := []storeadapter.StoreNode{}
+	for _, key := range order {
+		if !due[key] {
+			continue
+		}
+		freshness := updated[key]
+		store.appFreshnessCache[key] = freshness
+		nodes = append(nodes, storeadapter.StoreNode{
+			Key:   store.appFreshnessRoot() + "/" + freshness.StoreKey(),
+			Value: freshness.ToJSON(),
+			TTL:   store.config.HeartbeatTTL(),
+		})
+	}
+	return nodes
+}
+
+// GetPresentDeas returns the DEAs whose presence has not lapsed.
+func (store *RealStore) GetPresentDeas() (map[string]bool, error) {
+	return store.unexpiredDeas()
+}
+
+// GetAppFreshness returns the freshness of the apps heard of within the
+// heartbeat TTL, by app key.
+func (store *RealStore) GetAppFreshness() (map[string]models.AppFreshness, error) {
+	freshness, err := store.get(store.appFreshnessRoot(), reflect.TypeOf(map[string]models.AppFreshness{}), reflect.ValueOf(models.NewAppFreshnessFromJSON))
+	return freshness.Interface().(map[string]models.AppFreshness), err
+}
@@ -0,0 +1,104 @@
+package store_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("App freshness", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+		dea          appfixture.DeaFixture
+		app          appfixture.AppFixture
+		key          string
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		conf.PerAppFreshness = true
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		dea = appfixture.NewDeaFixture()
+		app = dea.GetApp(0)
+		key = "/hm/v1/apps/freshness/" + app.AppGuid + "," + app.AppVersion
+	})
+
+	It("should record when each index of an app was last heard of, expiring with the heartbeat", func() {
+		crashed := app.InstanceAtIndex(1).Heartbeat()
+		crashed.State = models.InstanceStateCrashed
+		err := store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat(), crashed, app.InstanceAtIndex(2).Heartbeat()))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		freshness, err := store.GetAppFreshness()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(freshness).Should(HaveLen(1))
+
+		appFreshness := freshness[store.AppKey(app.AppGuid, app.AppVersion)]
+		Ω(appFreshness.AppGuid).Should(Equal(app.AppGuid))
+		Ω(appFreshness.IndexDea(0)).Should(Equal(dea.DeaGuid))
+
+		presentDeas, err := store.GetPresentDeas()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(presentDeas).Should(Equal(map[string]bool{dea.DeaGuid: true}))
+		Ω(appFreshness.IsIndexReported(0, presentDeas, time.Now(), time.Minute)).Should(BeTrue())
+		Ω(appFreshness.IsIndexReported(1, presentDeas, time.Now(), time.Minute)).Should(BeFalse())
+		Ω(appFreshness.IsIndexReported(2, presentDeas, time.Now(), time.Minute)).Should(BeTrue())
+
+		node, err := storeAdapter.Get(key)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.TTL).Should(BeNumerically("==", conf.HeartbeatTTL()))
+	})
+
+	It("should rewrite an app no more than once a heartbeat period, unless an index is heard of for the first time", func() {
+		err := store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+		Ω(err).ShouldNot(HaveOccurred())
+		storeAdapter.Delete(key)
+
+		err = store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = storeAdapter.Get(key)
+		Ω(err).Should(HaveOccurred())
+
+		err = store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat(), app.InstanceAtIndex(1).Heartbeat()))
+		Ω(err).ShouldNot(HaveOccurred())
+		freshness, err := store.GetAppFreshness()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(freshness[store.AppKey(app.AppGuid, app.AppVersion)].IndexSeenAt(1).IsZero()).Should(BeFalse())
+	})
+
+	It("should rewrite an app within a heartbeat period when an index is heard of from another DEA", func() {
+		err := store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		otherDea := appfixture.NewDeaFixture()
+		moved := app.InstanceAtIndex(0).Heartbeat()
+		moved.DeaGuid = otherDea.DeaGuid
+		err = store.SyncHeartbeats(otherDea.HeartbeatWith(moved))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		freshness, err := store.GetAppFreshness()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(freshness[store.AppKey(app.AppGuid, app.AppVersion)].IndexDea(0)).Should(Equal(otherDea.DeaGuid))
+	})
+
+	It("should record nothing when per_app_freshness is not set", func() {
+		conf.PerAppFreshness = false
+		err := store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		freshness, err := store.GetAppFreshness()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(freshness).Should(BeEmpty())
+	})
+})
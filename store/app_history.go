@@ -0,0 +1,56 @@
+package store
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// App histories live one key per app guid, and expire once nothing has
+// happened to the app for app_history_ttl_in_seconds:
+//
+//	/app-history/<guid>
+
+func (store *RealStore) appHistoriesRoot() string {
+	return store.SchemaRoot() + "/app-history"
+}
+
+// RecordAppEvents adds events to their apps' histories, keeping the newest
+// app_history_max_events of each within the app history TTL of now.  It does
+// nothing when app history is disabled.
+func (store *RealStore) RecordAppEvents(now time.Time, events ...models.AppEvent) error {
+	if !store.config.AppHistoryEnabled() || len(events) == 0 {
+		return nil
+	}
+
+	eventsByApp := map[string][]models.AppEvent{}
+	for _, event := range events {
+		eventsByApp[event.AppGuid] = append(eventsByApp[event.AppGuid], event)
+	}
+
+	ttl := store.config.AppHistoryTTL()
+	toSave := []models.AppHistory{}
+	for appGuid, appEvents := range eventsByApp {
+		history, err := store.GetAppHistory(appGuid)
+		if err != nil {
+			return err
+		}
+		history.AppGuid = appGuid
+		toSave = append(toSave, history.Append(now.Add(-ttl), store.config.AppHistoryMaxEvents, appEvents...))
+	}
+	return store.save(toSave, store.appHistoriesRoot(), uint64(ttl/time.Second))
+}
+
+// GetAppHistory returns the history of an app, which is empty if nothing has
+// happened to it within the app history TTL.
+func (store *RealStore) GetAppHistory(appGuid string) (models.AppHistory, error) {
+	node, err := store.adapter.Get(store.appHistoriesRoot() + "/" + appGuid)
+	if err == storeadapter.ErrorKeyNotFound {
+		return models.AppHistory{AppGuid: appGuid, Events: []models.AppEvent{}}, nil
+	}
+	if err != nil {
+		return models.AppHistory{}, err
+	}
+	return models.NewAppHistoryFromJSON(node.Value)
+}
@@ -0,0 +1,100 @@
+package store_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("App history", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+	)
+
+	event := func(appGuid string, timestamp int64) models.AppEvent {
+		return models.AppEvent{Type: models.AppEventStartSent, Timestamp: timestamp, AppGuid: appGuid, AppVersion: "version"}
+	}
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		conf.AppHistoryMaxEvents = 3
+		conf.AppHistoryTTLInSeconds.Duration = time.Hour
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+	})
+
+	Describe("RecordAppEvents", func() {
+		It("adds the events to their apps' histories", func() {
+			err := store.RecordAppEvents(time.Unix(1000, 0), event("a", 1000), event("b", 1000))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = store.RecordAppEvents(time.Unix(1010, 0), event("a", 1010))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			history, err := store.GetAppHistory("a")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(history).Should(Equal(models.AppHistory{
+				AppGuid: "a",
+				Events:  []models.AppEvent{event("a", 1000), event("a", 1010)},
+			}))
+
+			history, _ = store.GetAppHistory("b")
+			Ω(history.Events).Should(Equal([]models.AppEvent{event("b", 1000)}))
+		})
+
+		It("keeps the newest app_history_max_events events", func() {
+			store.RecordAppEvents(time.Unix(1000, 0), event("a", 1000), event("a", 1001), event("a", 1002))
+			store.RecordAppEvents(time.Unix(1003, 0), event("a", 1003))
+
+			history, _ := store.GetAppHistory("a")
+			Ω(history.Events).Should(Equal([]models.AppEvent{event("a", 1001), event("a", 1002), event("a", 1003)}))
+		})
+
+		It("forgets events older than the TTL", func() {
+			store.RecordAppEvents(time.Unix(1000, 0), event("a", 1000))
+			store.RecordAppEvents(time.Unix(1000+3601, 0), event("a", 1000+3601))
+
+			history, _ := store.GetAppHistory("a")
+			Ω(history.Events).Should(Equal([]models.AppEvent{event("a", 1000+3601)}))
+		})
+
+		It("expires a history once the TTL passes", func() {
+			store.RecordAppEvents(time.Unix(1000, 0), event("a", 1000))
+
+			node, err := storeAdapter.Get("/hm/v1/app-history/a")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(BeNumerically("==", 3600))
+		})
+
+		It("writes nothing when app history is disabled", func() {
+			conf.AppHistoryMaxEvents = 0
+			err := store.RecordAppEvents(time.Unix(1000, 0), event("a", 1000))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = storeAdapter.Get("/hm/v1/app-history/a")
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("returns an error when a history cannot be read", func() {
+			storeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("app-history", errors.New("oops"))
+			err := store.RecordAppEvents(time.Unix(1000, 0), event("a", 1000))
+			Ω(err).Should(Equal(errors.New("oops")))
+		})
+	})
+
+	Describe("GetAppHistory", func() {
+		It("returns an empty history for an app with none", func() {
+			history, err := store.GetAppHistory("a")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(history).Should(Equal(models.AppHistory{AppGuid: "a", Events: []models.AppEvent{}}))
+		})
+	})
+})
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// The desired and actual state are kept in a directory per app, under
+// /apps/desired and /apps/actual.  In the flat layout (store_app_layout_version
+// 1) those are the app directories themselves:
+//
+//	/apps/actual/<guid>,<version>/<instance-guid>
+//
+// With 100k apps etcd is slow to list and delete such wide directories, so the
+// bucketed layout (store_app_layout_version 2) spreads the apps over 256
+// buckets, named after a hash of the app guid:
+//
+//	/apps/actual/<bucket>/<guid>,<version>/<instance-guid>
+//
+// Reads take both layouts, so that the store can be switched between them
+// while running; Compact moves the apps left in the other layout.
+const AppLayoutVersionFlat = 1
+const AppLayoutVersionBucketed = 2
+
+const numberOfAppBuckets = 256
+
+// AppBucket is the bucket the bucketed layout keeps the app's versions in.
+func AppBucket(appGuid string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(appGuid))
+	return fmt.Sprintf("%02x", hash.Sum32()%numberOfAppBuckets)
+}
+
+// IsAppBucket tells a bucket under /apps/desired or /apps/actual from an app
+// key, which always has a comma.
+func IsAppBucket(name string) bool {
+	return name != "" && !strings.Contains(name, ",")
+}
+
+func (store *RealStore) bucketedAppLayout() bool {
+	return store.config.StoreAppLayoutVersion == AppLayoutVersionBucketed
+}
+
+// appKeyUnder is where the app is kept under root in the configured layout.
+func (store *RealStore) appKeyUnder(root string, appGuid string, appVersion string) string {
+	return store.appKeysUnder(root, appGuid, appVersion)[0]
+}
+
+// appKeysUnder is where the app may be kept under root: in the configured
+// layout, and then in the other one.
+func (store *RealStore) appKeysUnder(root string, appGuid string, appVersion string) []string {
+	flat := root + "/" + store.AppKey(appGuid, appVersion)
+	bucketed := root + "/" + AppBucket(appGuid) + "/" + store.AppKey(appGuid, appVersion)
+	if store.bucketedAppLayout() {
+		return []string{bucketed, flat}
+	}
+	return []string{flat, bucketed}
+}
+
+// appNodes flattens a listing of root into its app nodes, whichever layout
+// each is in: those in the configured layout first, so that where an app, or
+// one of its instances, is in both the configured layout wins.
+func (store *RealStore) appNodes(root storeadapter.StoreNode) []storeadapter.StoreNode {
+	flat := []storeadapter.StoreNode{}
+	bucketed := []storeadapter.StoreNode{}
+	for _, child := range root.ChildNodes {
+		if child.Dir && IsAppBucket(lastKeyComponent(child.Key)) {
+			bucketed = append(bucketed, child.ChildNodes...)
+		} else {
+			flat = append(flat, child)
+		}
+	}
+
+	if store.bucketedAppLayout() {
+		return append(bucketed, flat...)
+	}
+	return append(flat, bucketed...)
+}
+
+// fetchApp fetches the app under root in the configured layout or, failing
+// that, in the other one, where it is until Compact moves it.
+func (store *RealStore) fetchApp(fetch func(key string) (storeadapter.StoreNode, error), root string, appGuid string, appVersion string) (storeadapter.StoreNode, error) {
+	var node storeadapter.StoreNode
+	var err error
+	for _, key := range store.appKeysUnder(root, appGuid, appVersion) {
+		node, err = fetch(key)
+		if err != storeadapter.ErrorKeyNotFound {
+			return node, err
+		}
+	}
+	return node, err
+}
+
+// MigrateAppLayout moves the apps under /apps/desired and /apps/actual that
+// are not in the configured layout into it, keeping their TTLs.  Where an
+// app's key is in both layouts the one in the configured layout wins.
+func (store *RealStore) MigrateAppLayout() error {
+	return store.migrateAppLayout(noLockCheck)
+}
+
+func (store *RealStore) migrateAppLayout(checkLock lockCheck) error {
+	for _, root := range []string{store.SchemaRoot() + "/apps/desired", store.SchemaRoot() + "/apps/actual"} {
+		err := store.migrateAppLayoutUnder(root, checkLock)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *RealStore) migrateAppLayoutUnder(root string, checkLock lockCheck) error {
+	node, err := store.adapter.ListRecursively(root)
+	if err == storeadapter.ErrorKeyNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	misplaced := []storeadapter.StoreNode{}
+	inPlace := map[string]bool{}
+	for _, child := range node.ChildNodes {
+		isBucket := child.Dir && IsAppBucket(lastKeyComponent(child.Key))
+		if isBucket == store.bucketedAppLayout() {
+			collectLeafKeys(child, inPlace)
+			continue
+		}
+
+		if isBucket {
+			misplaced = append(misplaced, child.ChildNodes...)
+		} else {
+			misplaced = append(misplaced, child)
+		}
+	}
+
+	if len(misplaced) == 0 {
+		return nil
+	}
+
+	nodesToSave := []storeadapter.StoreNode{}
+	keysToDelete := []string{}
+	for _, appNode := range misplaced {
+		appGuid, appVersion, ok := splitAppKey(lastKeyComponent(appNode.Key))
+		if !ok {
+			store.logger.Info("Skipping malformed app key", map[string]string{"Key": appNode.Key})
+			continue
+		}
+
+		newAppKey := store.appKeyUnder(root, appGuid, appVersion)
+		for _, leaf := range leafNodes(appNode) {
+			newKey := newAppKey + strings.TrimPrefix(leaf.Key, appNode.Key)
+			if inPlace[newKey] {
+				continue
+			}
+			nodesToSave = append(nodesToSave, storeadapter.StoreNode{
+				Key:   newKey,
+				Value: leaf.Value,
+				TTL:   leaf.TTL,
+			})
+		}
+		keysToDelete = append(keysToDelete, appNode.Key)
+	}
+
+	err = checkLock()
+	if err != nil {
+		return err
+	}
+	err = store.adapter.SetMulti(nodesToSave)
+	if err != nil {
+		return err
+	}
+
+	store.logger.Info("Migrated apps to the configured layout", map[string]string{
+		"Root":           root,
+		"Layout Version": fmt.Sprintf("%d", store.config.StoreAppLayoutVersion),
+		"Number of Apps": fmt.Sprintf("%d", len(keysToDelete)),
+	})
+
+	err = checkLock()
+	if err != nil {
+		return err
+	}
+	err = store.adapter.Delete(keysToDelete...)
+	if err == storeadapter.ErrorKeyNotFound {
+		return nil
+	}
+	return err
+}
+
+func lastKeyComponent(key string) string {
+	return key[strings.LastIndex(key, "/")+1:]
+}
+
+func splitAppKey(appKey string) (appGuid string, appVersion string, ok bool) {
+	guidVersion := strings.Split(appKey, ",")
+	if len(guidVersion) != 2 {
+		return "", "", false
+	}
+	return guidVersion[0], guidVersion[1], true
+}
+
+func leafNodes(node storeadapter.StoreNode) []storeadapter.StoreNode {
+	if !node.Dir {
+		return []storeadapter.StoreNode{node}
+	}
+
+	leaves := []storeadapter.StoreNode{}
+	for _, child := range node.ChildNodes {
+		leaves = append(leaves, leafNodes(child)...)
+	}
+	return leaves
+}
+
+func collectLeafKeys(node storeadapter.StoreNode, keys map[string]bool) {
+	for _, leaf := range leafNodes(node) {
+		keys[leaf.Key] = true
+	}
+}
@@ -0,0 +1,217 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/gunk/workpool"
+	. "github.com/cloudfoundry/hm9000/store"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+)
+
+var _ = Describe("App layout", func() {
+	var (
+		flatStore     Store
+		bucketedStore Store
+		storeAdapter  storeadapter.StoreAdapter
+		app           appfixture.AppFixture
+		otherApp      appfixture.AppFixture
+	)
+
+	desiredKey := func(bucketed bool, app appfixture.AppFixture) string {
+		if bucketed {
+			return "/hm/v1/apps/desired/" + AppBucket(app.AppGuid) + "/" + app.AppGuid + "," + app.AppVersion
+		}
+		return "/hm/v1/apps/desired/" + app.AppGuid + "," + app.AppVersion
+	}
+
+	actualKey := func(bucketed bool, app appfixture.AppFixture) string {
+		instanceGuid := app.InstanceAtIndex(0).InstanceGuid
+		if bucketed {
+			return "/hm/v1/apps/actual/" + AppBucket(app.AppGuid) + "/" + app.AppGuid + "," + app.AppVersion + "/" + instanceGuid
+		}
+		return "/hm/v1/apps/actual/" + app.AppGuid + "," + app.AppVersion + "/" + instanceGuid
+	}
+
+	BeforeEach(func() {
+		conf, err := config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+		storeAdapter = etcdstoreadapter.NewETCDStoreAdapter(etcdRunner.NodeURLS(),
+			workpool.NewWorkPool(conf.StoreMaxConcurrentRequests))
+		err = storeAdapter.Connect()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		flatStore = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		bucketedConf, _ := config.DefaultConfig()
+		bucketedConf.StoreAppLayoutVersion = AppLayoutVersionBucketed
+		bucketedStore = NewStore(bucketedConf, storeAdapter, fakelogger.NewFakeLogger())
+
+		app = appfixture.NewAppFixture()
+		otherApp = appfixture.NewAppFixture()
+	})
+
+	AfterEach(func() {
+		storeAdapter.Disconnect()
+	})
+
+	Describe("AppBucket", func() {
+		It("names one of 256 buckets after the app guid", func() {
+			Ω(AppBucket(app.AppGuid)).Should(MatchRegexp(`^[0-9a-f]{2}$`))
+			Ω(AppBucket(app.AppGuid)).Should(Equal(AppBucket(app.AppGuid)))
+			Ω(IsAppBucket(AppBucket(app.AppGuid))).Should(BeTrue())
+			Ω(IsAppBucket(app.AppGuid + "," + app.AppVersion)).Should(BeFalse())
+		})
+	})
+
+	Context("with the bucketed layout", func() {
+		BeforeEach(func() {
+			err := bucketedStore.SyncDesiredState(app.DesiredState(1))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = bucketedStore.SyncHeartbeats(app.Heartbeat(1))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("keeps each app in its bucket", func() {
+			_, err := storeAdapter.Get(desiredKey(true, app))
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = storeAdapter.Get(actualKey(true, app))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("reads the apps back", func() {
+			desired, err := bucketedStore.GetDesiredState()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(desired).Should(HaveKey(app.DesiredState(1).StoreKey()))
+
+			heartbeats, err := bucketedStore.GetInstanceHeartbeats()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(heartbeats).Should(ConsistOf(app.InstanceAtIndex(0).Heartbeat()))
+
+			heartbeats, err = bucketedStore.GetInstanceHeartbeatsForApp(app.AppGuid, app.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(heartbeats).Should(ConsistOf(app.InstanceAtIndex(0).Heartbeat()))
+
+			fetched, err := bucketedStore.GetApp(app.AppGuid, app.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(fetched.Desired).Should(Equal(app.DesiredState(1)))
+		})
+
+		It("deletes apps that are no longer desired from their bucket", func() {
+			err := bucketedStore.SyncDesiredState(otherApp.DesiredState(1))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = storeAdapter.Get(desiredKey(true, app))
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+	})
+
+	Context("when the layout is switched while apps are in the old one", func() {
+		BeforeEach(func() {
+			err := flatStore.SyncDesiredState(app.DesiredState(1), otherApp.DesiredState(1))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = flatStore.SyncHeartbeats(app.Heartbeat(1))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("still reads them", func() {
+			desired, err := bucketedStore.GetDesiredState()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(desired).Should(HaveLen(2))
+
+			heartbeats, err := bucketedStore.GetInstanceHeartbeats()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(heartbeats).Should(ConsistOf(app.InstanceAtIndex(0).Heartbeat()))
+
+			heartbeats, err = bucketedStore.GetInstanceHeartbeatsForApp(app.AppGuid, app.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(heartbeats).Should(ConsistOf(app.InstanceAtIndex(0).Heartbeat()))
+		})
+
+		It("moves the desired state on the next sync, and deletes what is no longer desired", func() {
+			err := bucketedStore.SyncDesiredState(app.DesiredState(1))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = storeAdapter.Get(desiredKey(true, app))
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = storeAdapter.Get(desiredKey(false, app))
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			_, err = storeAdapter.Get(desiredKey(false, otherApp))
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+
+		It("deletes every copy out of place, where an app is in both layouts", func() {
+			err := storeAdapter.SetMulti([]storeadapter.StoreNode{
+				{Key: desiredKey(true, app), Value: app.DesiredState(1).ToCSV()},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = bucketedStore.SyncDesiredState(app.DesiredState(1))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = storeAdapter.Get(desiredKey(true, app))
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = storeAdapter.Get(desiredKey(false, app))
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+
+			desired, err := bucketedStore.GetDesiredState()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(desired).Should(HaveLen(1))
+		})
+
+		It("moves them when compacting", func() {
+			err := bucketedStore.Compact()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			for _, key := range []string{desiredKey(true, app), desiredKey(true, otherApp), actualKey(true, app)} {
+				_, err = storeAdapter.Get(key)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			_, err = storeAdapter.ListRecursively("/hm/v1/apps/actual/" + app.AppGuid + "," + app.AppVersion)
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			_, err = storeAdapter.Get(desiredKey(false, otherApp))
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+
+			heartbeats, err := bucketedStore.GetInstanceHeartbeats()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(heartbeats).Should(ConsistOf(app.InstanceAtIndex(0).Heartbeat()))
+		})
+
+		It("keeps the entries already in the new layout", func() {
+			running := app.Heartbeat(1)
+			running.InstanceHeartbeats[0].State = "CRASHED"
+			err := bucketedStore.SyncHeartbeats(running)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			heartbeats, err := bucketedStore.GetInstanceHeartbeats()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(heartbeats).Should(ConsistOf(running.InstanceHeartbeats[0]))
+
+			err = bucketedStore.Compact()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			heartbeats, err = bucketedStore.GetInstanceHeartbeats()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(heartbeats).Should(ConsistOf(running.InstanceHeartbeats[0]))
+		})
+
+		It("moves them back when the layout is switched back", func() {
+			err := bucketedStore.Compact()
+			Ω(err).ShouldNot(HaveOccurred())
+			err = flatStore.Compact()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			for _, key := range []string{desiredKey(false, app), desiredKey(false, otherApp), actualKey(false, app)} {
+				_, err = storeAdapter.Get(key)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+			_, err = storeAdapter.Get(desiredKey(true, app))
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+	})
+})
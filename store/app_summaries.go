@@ -0,0 +1,177 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// The aggregator keeps a summary of each app's health, one key per app, with
+// no TTL: it deletes the summaries of the apps that are gone.  With
+// listener_updates_app_summaries set, the listener also resummarizes the
+// apps whose instances change as it syncs heartbeats.  Each aggregator run
+// marks the summaries fresh, for three of its polling intervals.
+//
+//	/apps/summaries/<guid>,<version>
+//	/app-summaries-fresh
+
+func (store *RealStore) appSummariesRoot() string {
+	return store.SchemaRoot() + "/apps/summaries"
+}
+
+func (store *RealStore) appSummariesFreshnessKey() string {
+	return store.SchemaRoot() + "/app-summaries-fresh"
+}
+
+// SyncAppSummaries makes summaries the stored app summaries, writing only
+// those that changed and deleting those of the apps not in summaries.  It
+// returns how many it wrote and how many it deleted.
+func (store *RealStore) SyncAppSummaries(summaries ...models.AppSummary) (saved int, deleted int, err error) {
+	t := time.Now()
+
+	current, err := store.GetAppSummaries()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	changed := []models.AppSummary{}
+	synced := map[string]bool{}
+	for _, summary := range summaries {
+		synced[summary.StoreKey()] = true
+		if existing, found := current[summary.StoreKey()]; !found || existing != summary {
+			changed = append(changed, summary)
+		}
+	}
+
+	gone := []models.AppSummary{}
+	for key, summary := range current {
+		if !synced[key] {
+			gone = append(gone, summary)
+		}
+	}
+
+	err = store.save(changed, store.appSummariesRoot(), 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = store.delete(gone, store.appSummariesRoot())
+	if err == storeadapter.ErrorKeyNotFound {
+		store.logger.Debug("store.SyncAppSummaries Failed to delete a key, soldiering on...")
+	} else if err != nil {
+		return len(changed), 0, err
+	}
+
+	store.logger.Debug("Sync Duration App Summaries", map[string]string{
+		"Number of Items Synced":  fmt.Sprintf("%d", len(summaries)),
+		"Number of Items Saved":   fmt.Sprintf("%d", len(changed)),
+		"Number of Items Deleted": fmt.Sprintf("%d", len(gone)),
+		"Duration":                fmt.Sprintf("%.4f seconds", time.Since(t).Seconds()),
+	})
+	return len(changed), len(gone), nil
+}
+
+// SaveAppSummaries writes summaries, leaving the others alone.
+func (store *RealStore) SaveAppSummaries(summaries ...models.AppSummary) error {
+	return store.save(summaries, store.appSummariesRoot(), 0)
+}
+
+// DeleteAppSummaries deletes summaries, leaving the others alone.
+func (store *RealStore) DeleteAppSummaries(summaries ...models.AppSummary) error {
+	err := store.delete(summaries, store.appSummariesRoot())
+	if err == storeadapter.ErrorKeyNotFound {
+		store.logger.Debug("store.DeleteAppSummaries Failed to delete a key, soldiering on...")
+		return nil
+	}
+	return err
+}
+
+// BumpAppSummariesFreshness marks the summaries fresh as of timestamp.
+func (store *RealStore) BumpAppSummariesFreshness(timestamp time.Time) error {
+	bumpedAt, _ := json.Marshal(models.FreshnessTimestamp{Timestamp: timestamp.Unix()})
+	return store.adapter.SetMulti([]storeadapter.StoreNode{{
+		Key:   store.appSummariesFreshnessKey(),
+		Value: bumpedAt,
+		TTL:   store.config.AppSummariesFreshnessTTL(),
+	}})
+}
+
+// AreAppSummariesFresh is true while the summaries' freshness has not
+// expired.
+func (store *RealStore) AreAppSummariesFresh() (bool, error) {
+	_, err := store.adapter.Get(store.appSummariesFreshnessKey())
+	if err == storeadapter.ErrorKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// instancesOfApps returns the cached instance heartbeats of each of apps,
+// by app key.  It must be called with the instance heartbeat cache locked.
+func (store *RealStore) instancesOfApps(apps map[string]models.AppSummary) map[string][]models.InstanceHeartbeat {
+	instances := map[string][]models.InstanceHeartbeat{}
+	for _, instanceHeartbeat := range store.instanceHeartbeatCache {
+		key := store.AppKey(instanceHeartbeat.AppGuid, instanceHeartbeat.AppVersion)
+		if _, ok := apps[key]; ok {
+			instances[key] = append(instances[key], instanceHeartbeat)
+		}
+	}
+	return instances
+}
+
+// resummarizeApps updates the summaries of apps, by app key, with their
+// instances, deleting those of the apps that are neither desired nor have
+// instances left.
+func (store *RealStore) resummarizeApps(apps map[string]models.AppSummary, instances map[string][]models.InstanceHeartbeat) error {
+	changed := []models.AppSummary{}
+	gone := []models.AppSummary{}
+	for key, app := range apps {
+		summary, err := store.GetAppSummary(app.AppGuid, app.AppVersion)
+		found := err == nil
+		if err == AppNotFoundError {
+			summary = app
+		} else if err != nil {
+			return err
+		}
+
+		resummarized := summary.WithInstanceHeartbeats(instances[key])
+		if !resummarized.IsDesired() && !resummarized.HasInstances() {
+			if found {
+				gone = append(gone, resummarized)
+			}
+		} else if !found || resummarized != summary {
+			changed = append(changed, resummarized)
+		}
+	}
+
+	err := store.SaveAppSummaries(changed...)
+	if err != nil {
+		return err
+	}
+	return store.DeleteAppSummaries(gone...)
+}
+
+// GetAppSummaries returns the summary of every app, by app key.
+func (store *RealStore) GetAppSummaries() (map[string]models.AppSummary, error) {
+	summaries, err := store.get(store.appSummariesRoot(), reflect.TypeOf(map[string]models.AppSummary{}), reflect.ValueOf(models.NewAppSummaryFromJSON))
+	return summaries.Interface().(map[string]models.AppSummary), err
+}
+
+// GetAppSummary returns the summary of one app, or AppNotFoundError.
+func (store *RealStore) GetAppSummary(appGuid string, appVersion string) (models.AppSummary, error) {
+	node, err := store.adapter.Get(store.appSummariesRoot() + "/" + store.AppKey(appGuid, appVersion))
+	if err == storeadapter.ErrorKeyNotFound {
+		return models.AppSummary{}, AppNotFoundError
+	} else if err != nil {
+		return models.AppSummary{}, err
+	}
+
+	return models.NewAppSummaryFromJSON(node.Value)
+}
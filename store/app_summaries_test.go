@@ -0,0 +1,184 @@
+package store_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("App summaries", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+		summary      models.AppSummary
+		other        models.AppSummary
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		summary = models.AppSummary{AppGuid: "app", AppVersion: "v1", State: models.AppStateStarted, DesiredInstances: 2, RunningInstances: 2}
+		other = models.AppSummary{AppGuid: "other", AppVersion: "v1", RunningInstances: 1}
+
+		saved, deleted, err := store.SyncAppSummaries(summary, other)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(saved).Should(Equal(2))
+		Ω(deleted).Should(BeZero())
+	})
+
+	It("reads the summaries back", func() {
+		summaries, err := store.GetAppSummaries()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(summaries).Should(Equal(map[string]models.AppSummary{"app,v1": summary, "other,v1": other}))
+
+		fetched, err := store.GetAppSummary("app", "v1")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(fetched).Should(Equal(summary))
+	})
+
+	It("returns AppNotFoundError for an app without a summary", func() {
+		_, err := store.GetAppSummary("app", "v2")
+		Ω(err).Should(Equal(AppNotFoundError))
+	})
+
+	It("only saves the summaries that changed, and deletes those missing", func() {
+		summary.RunningInstances = 1
+		saved, deleted, err := store.SyncAppSummaries(summary)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(saved).Should(Equal(1))
+		Ω(deleted).Should(Equal(1))
+
+		saved, deleted, err = store.SyncAppSummaries(summary)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(saved).Should(BeZero())
+		Ω(deleted).Should(BeZero())
+
+		summaries, _ := store.GetAppSummaries()
+		Ω(summaries).Should(Equal(map[string]models.AppSummary{"app,v1": summary}))
+	})
+
+	It("saves and deletes summaries, leaving the others alone", func() {
+		summary.RunningInstances = 1
+		err := store.SaveAppSummaries(summary)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		summaries, _ := store.GetAppSummaries()
+		Ω(summaries).Should(Equal(map[string]models.AppSummary{"app,v1": summary, "other,v1": other}))
+
+		err = store.DeleteAppSummaries(other, models.AppSummary{AppGuid: "gone", AppVersion: "v1"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		summaries, _ = store.GetAppSummaries()
+		Ω(summaries).Should(Equal(map[string]models.AppSummary{"app,v1": summary}))
+	})
+
+	It("marks the summaries fresh, for three aggregator polling intervals", func() {
+		fresh, err := store.AreAppSummariesFresh()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(fresh).Should(BeFalse())
+
+		err = store.BumpAppSummariesFreshness(time.Unix(100, 0))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fresh, err = store.AreAppSummariesFresh()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(fresh).Should(BeTrue())
+
+		node, _ := storeAdapter.Get("/hm/v1/app-summaries-fresh")
+		Ω(node.TTL).Should(BeNumerically("==", 3*conf.AggregatorPollingIntervalInHeartbeats*int(conf.HeartbeatPeriod.Seconds())))
+	})
+
+	Describe("with listener_updates_app_summaries set", func() {
+		var (
+			dea          appfixture.DeaFixture
+			app          appfixture.AppFixture
+			undesiredApp appfixture.AppFixture
+		)
+
+		BeforeEach(func() {
+			conf.ListenerUpdatesAppSummaries = true
+			store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+			dea = appfixture.NewDeaFixture()
+			app = dea.GetApp(0)
+			undesiredApp = dea.GetApp(1)
+
+			err := store.SaveAppSummaries(models.NewAppSummary(models.NewApp(app.AppGuid, app.AppVersion, app.DesiredState(3), []models.InstanceHeartbeat{}, map[int]models.CrashCount{})))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("resummarizes the apps whose instances change, keeping their desired state", func() {
+			err := store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat(), app.InstanceAtIndex(1).Heartbeat(), undesiredApp.InstanceAtIndex(0).Heartbeat()))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			summary, err := store.GetAppSummary(app.AppGuid, app.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary.DesiredInstances).Should(Equal(3))
+			Ω(summary.RunningInstances).Should(Equal(2))
+			Ω(summary.MissingIndices).Should(Equal(1))
+
+			summary, err = store.GetAppSummary(undesiredApp.AppGuid, undesiredApp.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary.IsDesired()).Should(BeFalse())
+			Ω(summary.RunningInstances).Should(Equal(1))
+		})
+
+		It("deletes the summaries of the apps that are neither desired nor have instances left", func() {
+			err := store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat(), undesiredApp.InstanceAtIndex(0).Heartbeat()))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.SyncHeartbeats(dea.HeartbeatWith())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = store.GetAppSummary(undesiredApp.AppGuid, undesiredApp.AppVersion)
+			Ω(err).Should(Equal(AppNotFoundError))
+
+			summary, err := store.GetAppSummary(app.AppGuid, app.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary.RunningInstances).Should(BeZero())
+			Ω(summary.MissingIndices).Should(Equal(3))
+		})
+
+		It("leaves the summaries of the apps whose instances did not change alone", func() {
+			err := store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			summaryKey := "/hm/v1/apps/summaries/" + app.AppGuid + "," + app.AppVersion
+			node, _ := storeAdapter.Get(summaryKey)
+			untouched := append(node.Value, ' ')
+			storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: summaryKey, Value: untouched}})
+
+			err = store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			node, _ = storeAdapter.Get(summaryKey)
+			Ω(node.Value).Should(Equal(untouched))
+		})
+
+		It("resummarizes the apps whose instances left the store by the next heartbeat sync after the cache is refreshed", func() {
+			conf.StoreHeartbeatCacheRefreshIntervalInMilliseconds.Duration = 0
+			err := store.SyncHeartbeats(dea.HeartbeatWith(app.InstanceAtIndex(0).Heartbeat()))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			storeAdapter.Delete("/hm/v1/dea-presence/" + dea.DeaGuid)
+
+			err = store.SyncHeartbeats(appfixture.NewDeaFixture().HeartbeatWith())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			summary, err := store.GetAppSummary(app.AppGuid, app.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summary.RunningInstances).Should(BeZero())
+		})
+	})
+})
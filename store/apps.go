@@ -39,7 +39,7 @@ func (store *RealStore) GetApp(appGuid string, appVersion string) (*models.App,
 	}
 
 	tCrash := time.Now()
-	representation.crashCounts, err = store.getCrashCountForApp(appGuid, appVersion)
+	representation.crashCounts, err = store.getCrashCountForApp(appGuid, appVersion, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -50,6 +50,11 @@ func (store *RealStore) GetApp(appGuid string, appVersion string) (*models.App,
 		return nil, AppNotFoundError
 	}
 
+	app.CrashReasons, err = store.GetCrashReasonsForApp(appGuid, appVersion)
+	if err != nil {
+		return nil, err
+	}
+
 	store.logger.Debug(fmt.Sprintf("Get Duration App"), map[string]string{
 		"Duration":                   fmt.Sprintf("%.4f seconds", time.Since(t).Seconds()),
 		"Time to Fetch Desired":      fmt.Sprintf("%.4f seconds", dtDesired),
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// The starts the sender is waiting to see come of something each have a
+// key, which expires after twice the start effectiveness window in case the
+// sender stops resolving them:
+//
+//	/starts/awaited/<guid>,<version>,<index>
+
+func (store *RealStore) awaitedStartsRoot() string {
+	return store.SchemaRoot() + "/starts/awaited"
+}
+
+// SaveAwaitedStarts saves the starts, replacing any awaited at the same
+// index.
+func (store *RealStore) SaveAwaitedStarts(starts ...models.AwaitedStart) error {
+	ttl := 2 * store.config.StartEffectivenessWindow()
+	return store.save(starts, store.awaitedStartsRoot(), uint64(ttl/time.Second))
+}
+
+// GetAwaitedStarts returns the awaited starts, by store key.
+func (store *RealStore) GetAwaitedStarts() (map[string]models.AwaitedStart, error) {
+	starts, err := store.get(store.awaitedStartsRoot(), reflect.TypeOf(map[string]models.AwaitedStart{}), reflect.ValueOf(models.NewAwaitedStartFromJSON))
+	return starts.Interface().(map[string]models.AwaitedStart), err
+}
+
+func (store *RealStore) DeleteAwaitedStarts(starts ...models.AwaitedStart) error {
+	return store.delete(starts, store.awaitedStartsRoot())
+}
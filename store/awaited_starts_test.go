@@ -0,0 +1,47 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Awaited starts", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		start        models.AwaitedStart
+	)
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		start = models.AwaitedStart{AppGuid: "app", AppVersion: "version", IndexToStart: 1, SentAt: 100, InstanceGuids: []string{"crashed"}}
+	})
+
+	It("saves, fetches and deletes them", func() {
+		Ω(store.SaveAwaitedStarts(start)).Should(Succeed())
+
+		starts, err := store.GetAwaitedStarts()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(starts).Should(Equal(map[string]models.AwaitedStart{"app,version,1": start}))
+
+		Ω(store.DeleteAwaitedStarts(start)).Should(Succeed())
+		starts, err = store.GetAwaitedStarts()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(starts).Should(BeEmpty())
+	})
+
+	It("expires them after twice the start effectiveness window", func() {
+		store.SaveAwaitedStarts(start)
+
+		node, err := storeAdapter.Get("/hm/v1/starts/awaited/app,version,1")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.TTL).Should(BeNumerically("==", 360))
+	})
+})
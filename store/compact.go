@@ -6,22 +6,56 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// A lockCheck returns an error, such as LockLostError, when the step about
+// to delete or move keys must not go ahead.
+type lockCheck func() error
+
+func noLockCheck() error {
+	return nil
+}
+
 func (store *RealStore) Compact() error {
-	err := store.deleteOldSchemaVersionsAndUnversionedData()
+	return store.compact(noLockCheck)
+}
+
+// CompactHoldingLock compacts the store as Compact does, on behalf of the
+// holder of lock: before each step that deletes or moves keys it checks,
+// as of now, that lock is still held, and stops with LockLostError once it
+// is not, so that a holder that stalled past its TTL does not compact
+// alongside the next one.
+func (store *RealStore) CompactHoldingLock(lock Lock, now func() time.Time) error {
+	return store.compact(func() error {
+		return store.CheckLock(lock, now())
+	})
+}
+
+func (store *RealStore) compact(checkLock lockCheck) error {
+	err := store.deleteOldSchemaVersionsAndUnversionedData(checkLock)
+	if err != nil {
+		return err
+	}
+
+	err = store.migrateCrashCounts(checkLock)
 	if err != nil {
 		return err
 	}
 
-	err = store.deleteEmptyDirectories()
+	err = store.migrateAppLayout(checkLock)
+	if err != nil {
+		return err
+	}
+
+	err = store.deleteEmptyDirectories(checkLock)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (store *RealStore) deleteOldSchemaVersionsAndUnversionedData() error {
+func (store *RealStore) deleteOldSchemaVersionsAndUnversionedData(checkLock lockCheck) error {
 	everything, err := store.adapter.ListRecursively("/hm")
 	if err != nil {
 		return err
@@ -49,16 +83,25 @@ func (store *RealStore) deleteOldSchemaVersionsAndUnversionedData() error {
 		}
 	}
 
+	err = checkLock()
+	if err != nil {
+		return err
+	}
 	return store.adapter.Delete(keysToDelete...)
 }
 
-func (store *RealStore) deleteEmptyDirectories() error {
+func (store *RealStore) deleteEmptyDirectories(checkLock lockCheck) error {
 	node, err := store.adapter.ListRecursively(store.SchemaRoot() + "/")
 	if err != nil {
 		store.logger.Error(fmt.Sprintf("Failed to recursively fetch %s/", store.SchemaRoot()), err)
 		return err
 	}
 
+	err = checkLock()
+	if err != nil {
+		return err
+	}
+
 	store.deleteEmptyDirectoriesUnder(node)
 	return nil
 }
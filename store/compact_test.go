@@ -1,6 +1,8 @@
 package store_test
 
 import (
+	"time"
+
 	"github.com/cloudfoundry/gunk/workpool"
 	. "github.com/cloudfoundry/hm9000/store"
 	. "github.com/onsi/ginkgo"
@@ -164,4 +166,35 @@ var _ = Describe("Compact", func() {
 		})
 
 	})
+
+	Describe("Compacting while holding a lock", func() {
+		var lock Lock
+
+		BeforeEach(func() {
+			storeAdapter.SetMulti([]storeadapter.StoreNode{
+				{Key: "/hm/v3/delete/me", Value: []byte("abc")},
+				{Key: "/hm/v17/leave/me/alone", Value: []byte("abc")},
+			})
+
+			var err error
+			lock, err = store.Lock("shredder", "alice", time.Minute, time.Unix(1000, 0))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should compact while the lock is held", func() {
+			err := store.CompactHoldingLock(lock, func() time.Time { return time.Unix(1030, 0) })
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = storeAdapter.Get("/hm/v3/delete/me")
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+
+		It("should stop, deleting nothing, once the lock is lost", func() {
+			err := store.CompactHoldingLock(lock, func() time.Time { return time.Unix(1060, 0) })
+			Ω(err).Should(Equal(LockLostError))
+
+			_, err = storeAdapter.Get("/hm/v3/delete/me")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
 })
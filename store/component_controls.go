@@ -0,0 +1,20 @@
+package store
+
+import (
+	"reflect"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// SaveComponentControl records how an operator has set a component,
+// replacing what was set before.
+func (store *RealStore) SaveComponentControl(control models.ComponentControl) error {
+	return store.save([]models.ComponentControl{control}, store.SchemaRoot()+"/component-controls", 0)
+}
+
+// GetComponentControls returns how an operator has set each component, by
+// component.  Components that have never been set are missing.
+func (store *RealStore) GetComponentControls() (map[string]models.ComponentControl, error) {
+	controls, err := store.get(store.SchemaRoot()+"/component-controls", reflect.TypeOf(map[string]models.ComponentControl{}), reflect.ValueOf(models.NewComponentControlFromJSON))
+	return controls.Interface().(map[string]models.ComponentControl), err
+}
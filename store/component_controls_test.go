@@ -0,0 +1,46 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Component controls", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+	)
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+	})
+
+	It("keeps the latest control of each component", func() {
+		err := store.SaveComponentControl(models.ComponentControl{Component: "sender", Paused: true})
+		Ω(err).ShouldNot(HaveOccurred())
+		err = store.SaveComponentControl(models.ComponentControl{Component: "sender", MessageLimit: 10})
+		Ω(err).ShouldNot(HaveOccurred())
+		err = store.SaveComponentControl(models.ComponentControl{Component: "analyzer", Paused: true})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		controls, err := store.GetComponentControls()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(controls).Should(Equal(map[string]models.ComponentControl{
+			"sender":   {Component: "sender", MessageLimit: 10},
+			"analyzer": {Component: "analyzer", Paused: true},
+		}))
+	})
+
+	It("returns no controls when there are none", func() {
+		controls, err := store.GetComponentControls()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(controls).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,19 @@
+package store
+
+import (
+	"reflect"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// SaveComponentRun records the latest run of a component, replacing the one
+// before.
+func (store *RealStore) SaveComponentRun(run models.ComponentRun) error {
+	return store.save([]models.ComponentRun{run}, store.SchemaRoot()+"/component-runs", 0)
+}
+
+// GetComponentRuns returns the latest run of each component, by component.
+func (store *RealStore) GetComponentRuns() (map[string]models.ComponentRun, error) {
+	runs, err := store.get(store.SchemaRoot()+"/component-runs", reflect.TypeOf(map[string]models.ComponentRun{}), reflect.ValueOf(models.NewComponentRunFromJSON))
+	return runs.Interface().(map[string]models.ComponentRun), err
+}
@@ -0,0 +1,46 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Component runs", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+	)
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+	})
+
+	It("keeps the latest run of each component", func() {
+		err := store.SaveComponentRun(models.ComponentRun{Component: "Analyzer", StartedAt: 100})
+		Ω(err).ShouldNot(HaveOccurred())
+		err = store.SaveComponentRun(models.ComponentRun{Component: "Analyzer", StartedAt: 110, Error: "oops"})
+		Ω(err).ShouldNot(HaveOccurred())
+		err = store.SaveComponentRun(models.ComponentRun{Component: "Sender", StartedAt: 105})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		runs, err := store.GetComponentRuns()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(runs).Should(Equal(map[string]models.ComponentRun{
+			"Analyzer": {Component: "Analyzer", StartedAt: 110, Error: "oops"},
+			"Sender":   {Component: "Sender", StartedAt: 105},
+		}))
+	})
+
+	It("returns no runs when there are none", func() {
+		runs, err := store.GetComponentRuns()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(runs).Should(BeEmpty())
+	})
+})
@@ -1,30 +1,78 @@
 package store
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/cloudfoundry/hm9000/models"
 	"github.com/cloudfoundry/storeadapter"
-	"strconv"
+	"sort"
+	"strings"
 	"time"
 )
 
-func (store *RealStore) crashCountStoreKey(crashCount models.CrashCount) string {
-	return store.SchemaRoot() + "/apps/crashes/" + store.AppKey(crashCount.AppGuid, crashCount.AppVersion) + "/" + strconv.Itoa(crashCount.InstanceIndex)
+// Crash counts for all the instances of an app live in a single key:
+//
+//	/apps/crash-history/<guid>,<version>
+//
+// Each index's entry expires on its own (ExpiresAt), the key as a whole
+// expires once no index has crashed for the crash count TTL.
+//
+// Crash counts used to be stored one key per instance under /apps/crashes.
+// Those keys are still read, and Compact folds them into the new layout.
+//
+// A history is only written if nobody has written it since it was read, so
+// that the analyzer, resets and the migration do not lose each other's
+// entries; on a conflict it is read again and the write retried.
+type crashHistoryEntry struct {
+	models.CrashCount
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+func (store *RealStore) crashHistoryRoot() string {
+	return store.SchemaRoot() + "/apps/crash-history"
+}
+
+func (store *RealStore) legacyCrashCountRoot() string {
+	return store.SchemaRoot() + "/apps/crashes"
+}
+
+func (store *RealStore) crashHistoryStoreKey(appGuid string, appVersion string) string {
+	return store.crashHistoryRoot() + "/" + store.AppKey(appGuid, appVersion)
+}
+
+const crashHistoryWriteAttempts = 3
+
+func (store *RealStore) crashCountTTL() uint64 {
+	return uint64(store.config.MaximumBackoffDelay().Seconds()) * 2
 }
 
 func (store *RealStore) SaveCrashCounts(crashCounts ...models.CrashCount) error {
 	t := time.Now()
 
-	nodes := make([]storeadapter.StoreNode, len(crashCounts))
-	for i, crashCount := range crashCounts {
-		nodes[i] = storeadapter.StoreNode{
-			Key:   store.crashCountStoreKey(crashCount),
-			Value: crashCount.ToJSON(),
-			TTL:   uint64(store.config.MaximumBackoffDelay().Seconds()) * 2,
-		}
+	expiresAt := t.Unix() + int64(store.crashCountTTL())
+	updates := map[string][]crashHistoryEntry{}
+	for _, crashCount := range crashCounts {
+		appKey := store.AppKey(crashCount.AppGuid, crashCount.AppVersion)
+		updates[appKey] = append(updates[appKey], crashHistoryEntry{CrashCount: crashCount, ExpiresAt: expiresAt})
+	}
+
+	histories, err := store.listCrashHistories()
+	if err != nil {
+		return err
 	}
 
-	err := store.adapter.SetMulti(nodes)
+	for appKey, entries := range updates {
+		entries := entries
+		err = store.updateCrashHistory(store.crashHistoryRoot()+"/"+appKey, histories, t, func(merged map[int]crashHistoryEntry) bool {
+			for _, entry := range entries {
+				merged[entry.InstanceIndex] = entry
+			}
+			return true
+		})
+		if err != nil {
+			break
+		}
+	}
 
 	store.logger.Debug(fmt.Sprintf("Save Duration Crash Counts"), map[string]string{
 		"Number of Items": fmt.Sprintf("%d", len(crashCounts)),
@@ -33,35 +81,349 @@ func (store *RealStore) SaveCrashCounts(crashCounts ...models.CrashCount) error
 	return err
 }
 
-func (store *RealStore) getCrashCounts() (results []models.CrashCount, err error) {
-	node, err := store.adapter.ListRecursively(store.SchemaRoot() + "/apps/crashes")
+// ResetCrashCounts forgets the crash counts of the given indices of an app,
+// or of every index if indices is empty, and brings forward to currentTime
+// the unsent start messages for crashed instances at those indices, which
+// the backoff had delayed.  The next crash at those indices is then treated as
+// the first.  It returns the crash counts it forgot and the start messages it
+// rescheduled.
+func (store *RealStore) ResetCrashCounts(appGuid string, appVersion string, indices []int, currentTime time.Time) (reset []models.CrashCount, rescheduled []models.PendingStartMessage, err error) {
+	selected := func(index int) bool {
+		if len(indices) == 0 {
+			return true
+		}
+		for _, selectedIndex := range indices {
+			if index == selectedIndex {
+				return true
+			}
+		}
+		return false
+	}
 
+	crashCounts, err := store.getCrashCountForApp(appGuid, appVersion, currentTime)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reset = []models.CrashCount{}
+	for _, crashCount := range crashCounts {
+		if selected(crashCount.InstanceIndex) {
+			reset = append(reset, crashCount)
+		}
+	}
+	sort.Sort(crashCountsByInstanceIndex(reset))
+
+	err = store.updateCrashHistory(store.crashHistoryStoreKey(appGuid, appVersion), nil, currentTime, func(entries map[int]crashHistoryEntry) bool {
+		changed := false
+		for index := range entries {
+			if selected(index) {
+				delete(entries, index)
+				changed = true
+			}
+		}
+		return changed
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, crashCount := range reset {
+		err = store.adapter.Delete(fmt.Sprintf("%s/%s/%d", store.legacyCrashCountRoot(), store.AppKey(appGuid, appVersion), crashCount.InstanceIndex))
+		if err != nil && err != storeadapter.ErrorKeyNotFound {
+			return nil, nil, err
+		}
+	}
+
+	starts, err := store.GetPendingStartMessages()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rescheduled = []models.PendingStartMessage{}
+	for _, start := range starts {
+		if start.AppGuid != appGuid || start.AppVersion != appVersion || start.StartReason != models.PendingStartMessageReasonCrashed {
+			continue
+		}
+		if start.HasBeenSent() || start.SendOn <= currentTime.Unix() || !selected(start.IndexToStart) {
+			continue
+		}
+		start.SendOn = currentTime.Unix()
+		rescheduled = append(rescheduled, start)
+	}
+
+	err = store.SavePendingStartMessages(rescheduled...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reset, rescheduled, nil
+}
+
+// MigrateCrashCounts folds crash counts stored in the legacy one-key-per-
+// instance layout into the per-app layout and deletes the legacy keys.
+// Where both layouts have an entry for an index the per-app entry wins.
+func (store *RealStore) MigrateCrashCounts() error {
+	return store.migrateCrashCounts(noLockCheck)
+}
+
+func (store *RealStore) migrateCrashCounts(checkLock lockCheck) error {
+	legacy, err := store.adapter.ListRecursively(store.legacyCrashCountRoot())
 	if err == storeadapter.ErrorKeyNotFound {
-		return results, nil
+		return nil
 	} else if err != nil {
-		return results, err
+		return err
 	}
 
-	for _, crashNode := range node.ChildNodes {
-		crashCounts, err := store.crashCountsForNode(crashNode)
+	now := time.Now()
+	legacyEntries := map[string][]crashHistoryEntry{}
+	legacyKeys := []string{}
+	for _, appNode := range legacy.ChildNodes {
+		appKey := appNode.Key[strings.LastIndex(appNode.Key, "/")+1:]
+		for _, crashNode := range appNode.ChildNodes {
+			legacyKeys = append(legacyKeys, crashNode.Key)
+			crashCount, err := models.NewCrashCountFromJSON(crashNode.Value)
+			if err != nil {
+				store.logger.Error("Dropping undecodable legacy crash count", err, map[string]string{"Key": crashNode.Key})
+				continue
+			}
+			legacyEntries[appKey] = append(legacyEntries[appKey], crashHistoryEntry{
+				CrashCount: crashCount,
+				ExpiresAt:  now.Unix() + int64(crashNode.TTL),
+			})
+		}
+	}
+
+	histories, err := store.listCrashHistories()
+	if err != nil {
+		return err
+	}
+
+	for appKey, entries := range legacyEntries {
+		entries := entries
+		err = checkLock()
 		if err != nil {
-			return []models.CrashCount{}, nil
+			return err
+		}
+		err = store.updateCrashHistory(store.crashHistoryRoot()+"/"+appKey, histories, now, func(merged map[int]crashHistoryEntry) bool {
+			for _, entry := range entries {
+				if _, ok := merged[entry.InstanceIndex]; !ok {
+					merged[entry.InstanceIndex] = entry
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return err
 		}
-		results = append(results, crashCounts...)
 	}
 
-	return results, nil
+	store.logger.Info("Migrated legacy crash counts", map[string]string{
+		"Number of Apps": fmt.Sprintf("%d", len(legacyEntries)),
+	})
+
+	if len(legacyKeys) == 0 {
+		return nil
+	}
+
+	// Only the keys that were migrated: crash counts saved in the legacy
+	// layout since (by an analyzer not yet upgraded) are left for the next
+	// migration.
+	err = checkLock()
+	if err != nil {
+		return err
+	}
+	err = store.adapter.Delete(legacyKeys...)
+	if err == storeadapter.ErrorKeyNotFound {
+		return nil
+	}
+	return err
 }
 
-func (store *RealStore) getCrashCountForApp(appGuid string, appVersion string) (results []models.CrashCount, err error) {
-	node, err := store.adapter.ListRecursively(store.SchemaRoot() + "/apps/crashes/" + store.AppKey(appGuid, appVersion))
+// listCrashHistories returns every crash history node, by key.
+func (store *RealStore) listCrashHistories() (map[string]storeadapter.StoreNode, error) {
+	histories := map[string]storeadapter.StoreNode{}
+	node, err := store.adapter.ListRecursively(store.crashHistoryRoot())
 	if err == storeadapter.ErrorKeyNotFound {
-		return []models.CrashCount{}, nil
+		return histories, nil
 	} else if err != nil {
+		return nil, err
+	}
+
+	for _, historyNode := range node.ChildNodes {
+		histories[historyNode.Key] = historyNode
+	}
+	return histories, nil
+}
+
+// updateCrashHistory has update change the unexpired entries of the crash
+// history under key, and writes them back if it reports a change: deleting
+// the key if no entries are left.  The history is first taken from histories
+// (which may be nil), and read again from the store if someone has written
+// it in the meantime.
+func (store *RealStore) updateCrashHistory(key string, histories map[string]storeadapter.StoreNode, now time.Time, update func(map[int]crashHistoryEntry) bool) error {
+	node, found := histories[key]
+
+	var err error
+	for attempt := 0; attempt < crashHistoryWriteAttempts; attempt++ {
+		if histories == nil || attempt > 0 {
+			node, err = store.adapter.Get(key)
+			found = err == nil
+			if err != nil && err != storeadapter.ErrorKeyNotFound {
+				return err
+			}
+		}
+
+		entries := map[int]crashHistoryEntry{}
+		if found {
+			history, err := decodeCrashHistory(node.Value, now)
+			if err != nil {
+				return err
+			}
+			for _, entry := range history {
+				entries[entry.InstanceIndex] = entry
+			}
+		}
+
+		if !update(entries) {
+			return nil
+		}
+
+		switch {
+		case len(entries) == 0 && !found:
+			return nil
+		case len(entries) == 0:
+			err = store.adapter.CompareAndDeleteByIndex(node)
+			if err == storeadapter.ErrorKeyNotFound {
+				return nil
+			}
+		case found:
+			err = store.adapter.CompareAndSwapByIndex(node.Index, store.crashHistoryNode(key, entries))
+		default:
+			err = store.adapter.Create(store.crashHistoryNode(key, entries))
+		}
+
+		if err != storeadapter.ErrorKeyExists && err != storeadapter.ErrorKeyComparisonFailed && err != storeadapter.ErrorKeyNotFound {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (store *RealStore) crashHistoryNode(key string, entries map[int]crashHistoryEntry) storeadapter.StoreNode {
+	sorted := []crashHistoryEntry{}
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Sort(byInstanceIndex(sorted))
+
+	value, _ := json.Marshal(sorted)
+	return storeadapter.StoreNode{
+		Key:   key,
+		Value: value,
+		TTL:   store.crashCountTTL(),
+	}
+}
+
+// getCrashHistory returns the unexpired entries stored under key
+func (store *RealStore) getCrashHistory(key string, now time.Time) ([]crashHistoryEntry, error) {
+	node, err := store.adapter.Get(key)
+	if err == storeadapter.ErrorKeyNotFound {
+		return []crashHistoryEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return decodeCrashHistory(node.Value, now)
+}
+
+func decodeCrashHistory(value []byte, now time.Time) ([]crashHistoryEntry, error) {
+	entries := []crashHistoryEntry{}
+	err := json.Unmarshal(value, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	unexpired := []crashHistoryEntry{}
+	for _, entry := range entries {
+		if entry.ExpiresAt > now.Unix() {
+			unexpired = append(unexpired, entry)
+		}
+	}
+	return unexpired, nil
+}
+
+func (store *RealStore) getCrashCounts() (results []models.CrashCount, err error) {
+	now := time.Now()
+	indexed := map[string]models.CrashCount{}
+
+	legacy, err := store.adapter.ListRecursively(store.legacyCrashCountRoot())
+	if err == nil {
+		for _, crashNode := range legacy.ChildNodes {
+			crashCounts, err := store.crashCountsForNode(crashNode)
+			if err != nil {
+				return []models.CrashCount{}, nil
+			}
+			for _, crashCount := range crashCounts {
+				indexed[crashCount.StoreKey()] = crashCount
+			}
+		}
+	} else if err != storeadapter.ErrorKeyNotFound {
+		return results, err
+	}
+
+	node, err := store.adapter.ListRecursively(store.crashHistoryRoot())
+	if err == nil {
+		for _, historyNode := range node.ChildNodes {
+			entries, err := decodeCrashHistory(historyNode.Value, now)
+			if err != nil {
+				return []models.CrashCount{}, nil
+			}
+			for _, entry := range entries {
+				indexed[entry.StoreKey()] = entry.CrashCount
+			}
+		}
+	} else if err != storeadapter.ErrorKeyNotFound {
+		return results, err
+	}
+
+	for _, crashCount := range indexed {
+		results = append(results, crashCount)
+	}
+
+	return results, nil
+}
+
+func (store *RealStore) getCrashCountForApp(appGuid string, appVersion string, now time.Time) (results []models.CrashCount, err error) {
+	indexed := map[int]models.CrashCount{}
+
+	node, err := store.adapter.ListRecursively(store.legacyCrashCountRoot() + "/" + store.AppKey(appGuid, appVersion))
+	if err == nil {
+		crashCounts, err := store.crashCountsForNode(node)
+		if err != nil {
+			return []models.CrashCount{}, err
+		}
+		for _, crashCount := range crashCounts {
+			indexed[crashCount.InstanceIndex] = crashCount
+		}
+	} else if err != storeadapter.ErrorKeyNotFound {
+		return []models.CrashCount{}, err
+	}
+
+	entries, err := store.getCrashHistory(store.crashHistoryStoreKey(appGuid, appVersion), now)
+	if err != nil {
 		return []models.CrashCount{}, err
 	}
+	for _, entry := range entries {
+		indexed[entry.InstanceIndex] = entry.CrashCount
+	}
+
+	results = []models.CrashCount{}
+	for _, crashCount := range indexed {
+		results = append(results, crashCount)
+	}
 
-	return store.crashCountsForNode(node)
+	return results, nil
 }
 
 func (store *RealStore) crashCountsForNode(node storeadapter.StoreNode) (results []models.CrashCount, err error) {
@@ -75,3 +437,19 @@ func (store *RealStore) crashCountsForNode(node storeadapter.StoreNode) (results
 	}
 	return results, nil
 }
+
+type byInstanceIndex []crashHistoryEntry
+
+func (entries byInstanceIndex) Len() int           { return len(entries) }
+func (entries byInstanceIndex) Swap(i, j int)      { entries[i], entries[j] = entries[j], entries[i] }
+func (entries byInstanceIndex) Less(i, j int) bool { return entries[i].InstanceIndex < entries[j].InstanceIndex }
+
+type crashCountsByInstanceIndex []models.CrashCount
+
+func (crashCounts crashCountsByInstanceIndex) Len() int { return len(crashCounts) }
+func (crashCounts crashCountsByInstanceIndex) Swap(i, j int) {
+	crashCounts[i], crashCounts[j] = crashCounts[j], crashCounts[i]
+}
+func (crashCounts crashCountsByInstanceIndex) Less(i, j int) bool {
+	return crashCounts[i].InstanceIndex < crashCounts[j].InstanceIndex
+}
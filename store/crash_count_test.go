@@ -1,9 +1,10 @@
 package store_test
 
 import (
+	"time"
+
 	"github.com/cloudfoundry/gunk/workpool"
 	. "github.com/cloudfoundry/hm9000/store"
-	"github.com/cloudfoundry/storeadapter/storenodematchers"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -44,30 +45,217 @@ var _ = Describe("Crash Count", func() {
 		storeAdapter.Disconnect()
 	})
 
+	appCrashCounts := func(app models.CrashCount) []models.CrashCount {
+		storedApp, err := store.GetApp(app.AppGuid, app.AppVersion)
+		Ω(err).ShouldNot(HaveOccurred())
+		crashCounts := []models.CrashCount{}
+		for _, crashCount := range storedApp.CrashCounts {
+			crashCounts = append(crashCounts, crashCount)
+		}
+		return crashCounts
+	}
+
+	desire := func(crashCounts ...models.CrashCount) {
+		desiredStates := []models.DesiredAppState{}
+		for _, crashCount := range crashCounts {
+			desiredStates = append(desiredStates, models.DesiredAppState{AppGuid: crashCount.AppGuid, AppVersion: crashCount.AppVersion, NumberOfInstances: 5, State: models.AppStateStarted, PackageState: models.AppPackageStateStaged})
+		}
+		err := store.SyncDesiredState(desiredStates...)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
 	Describe("Saving crash state", func() {
 		BeforeEach(func() {
 			err := store.SaveCrashCounts(crashCount1, crashCount2)
 			Ω(err).ShouldNot(HaveOccurred())
 		})
 
-		It("stores the passed in crash state", func() {
+		It("stores the crash counts for each app in a single key", func() {
 			expectedTTL := uint64(conf.MaximumBackoffDelay().Seconds()) * 2
 
-			node, err := storeAdapter.Get("/hm/v1/apps/crashes/" + crashCount1.AppGuid + "," + crashCount1.AppVersion + "/1")
+			node, err := storeAdapter.Get("/hm/v1/apps/crash-history/" + crashCount1.AppGuid + "," + crashCount1.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(Equal(expectedTTL))
+			Ω(string(node.Value)).Should(ContainSubstring(`"instance_index":1`))
+
+			node, err = storeAdapter.Get("/hm/v1/apps/crash-history/" + crashCount2.AppGuid + "," + crashCount2.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(Equal(expectedTTL))
+			Ω(string(node.Value)).Should(ContainSubstring(`"instance_index":4`))
+		})
+
+		It("merges crash counts for other indices of the same app", func() {
+			anotherIndex := crashCount1
+			anotherIndex.InstanceIndex = 3
+			anotherIndex.CrashCount = 2
+			updated := crashCount1
+			updated.CrashCount = 18
+
+			err := store.SaveCrashCounts(anotherIndex, updated)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			desire(crashCount1)
+			Ω(appCrashCounts(crashCount1)).Should(ConsistOf(updated, anotherIndex))
+
+			node, err := storeAdapter.ListRecursively("/hm/v1/apps/crash-history")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.ChildNodes).Should(HaveLen(2))
+		})
+
+		It("makes the crash counts available on the apps", func() {
+			desire(crashCount1, crashCount2)
+
+			apps, err := store.GetApps()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(apps[store.AppKey(crashCount1.AppGuid, crashCount1.AppVersion)].CrashCounts[1]).Should(Equal(crashCount1))
+			Ω(apps[store.AppKey(crashCount2.AppGuid, crashCount2.AppVersion)].CrashCounts[4]).Should(Equal(crashCount2))
+		})
+	})
+
+	Describe("Resetting crash counts", func() {
+		var anotherIndex models.CrashCount
+		var now time.Time
+
+		BeforeEach(func() {
+			anotherIndex = crashCount1
+			anotherIndex.InstanceIndex = 3
+			anotherIndex.CrashCount = 2
+			now = time.Unix(1000, 0)
+
+			err := store.SaveCrashCounts(crashCount1, anotherIndex, crashCount2)
+			Ω(err).ShouldNot(HaveOccurred())
+			desire(crashCount1, crashCount2)
+		})
+
+		It("forgets the crash counts of the given indices", func() {
+			reset, _, err := store.ResetCrashCounts(crashCount1.AppGuid, crashCount1.AppVersion, []int{3}, now)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reset).Should(Equal([]models.CrashCount{anotherIndex}))
+
+			Ω(appCrashCounts(crashCount1)).Should(Equal([]models.CrashCount{crashCount1}))
+			Ω(appCrashCounts(crashCount2)).Should(Equal([]models.CrashCount{crashCount2}))
+		})
+
+		It("forgets every index's crash count, and deletes the key, if no indices are given", func() {
+			reset, _, err := store.ResetCrashCounts(crashCount1.AppGuid, crashCount1.AppVersion, []int{}, now)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reset).Should(Equal([]models.CrashCount{crashCount1, anotherIndex}))
+
+			Ω(appCrashCounts(crashCount1)).Should(BeEmpty())
+			_, err = storeAdapter.Get("/hm/v1/apps/crash-history/" + crashCount1.AppGuid + "," + crashCount1.AppVersion)
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+
+		It("forgets legacy per-instance crash counts", func() {
+			legacy := crashCount1
+			legacy.InstanceIndex = 4
+			storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/apps/crashes/" + legacy.AppGuid + "," + legacy.AppVersion + "/4", Value: legacy.ToJSON(), TTL: 100}})
+
+			reset, _, err := store.ResetCrashCounts(crashCount1.AppGuid, crashCount1.AppVersion, []int{4}, now)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reset).Should(Equal([]models.CrashCount{legacy}))
+			Ω(appCrashCounts(crashCount1)).Should(ConsistOf(crashCount1, anotherIndex))
+		})
+
+		It("goes by currentTime for which crash counts have expired", func() {
+			later := time.Now().Add(2 * conf.MaximumBackoffDelay() * 2)
+			reset, _, err := store.ResetCrashCounts(crashCount1.AppGuid, crashCount1.AppVersion, []int{3}, later)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reset).Should(BeEmpty())
+			Ω(appCrashCounts(crashCount1)).Should(ConsistOf(crashCount1, anotherIndex))
+		})
+
+		It("does nothing for an index that has not crashed", func() {
+			reset, rescheduled, err := store.ResetCrashCounts(crashCount1.AppGuid, crashCount1.AppVersion, []int{0}, now)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reset).Should(BeEmpty())
+			Ω(rescheduled).Should(BeEmpty())
+			Ω(appCrashCounts(crashCount1)).Should(ConsistOf(crashCount1, anotherIndex))
+		})
+
+		It("brings forward the delayed start messages for crashed instances at those indices", func() {
+			delayed := models.NewPendingStartMessage(now, 900, 0, crashCount1.AppGuid, crashCount1.AppVersion, 1, 1.0, models.PendingStartMessageReasonCrashed)
+			otherIndex := models.NewPendingStartMessage(now, 900, 0, crashCount1.AppGuid, crashCount1.AppVersion, 3, 1.0, models.PendingStartMessageReasonCrashed)
+			missing := models.NewPendingStartMessage(now, 900, 0, crashCount1.AppGuid, crashCount1.AppVersion, 2, 1.0, models.PendingStartMessageReasonMissing)
+			store.SavePendingStartMessages(delayed, otherIndex, missing)
+
+			_, rescheduled, err := store.ResetCrashCounts(crashCount1.AppGuid, crashCount1.AppVersion, []int{1}, now)
 			Ω(err).ShouldNot(HaveOccurred())
-			Ω(node).Should(storenodematchers.MatchStoreNode(storeadapter.StoreNode{
-				Key:   "/hm/v1/apps/crashes/" + crashCount1.AppGuid + "," + crashCount1.AppVersion + "/1",
-				Value: crashCount1.ToJSON(),
-				TTL:   expectedTTL,
-			}))
 
-			node, err = storeAdapter.Get("/hm/v1/apps/crashes/" + crashCount2.AppGuid + "," + crashCount2.AppVersion + "/4")
+			delayed.SendOn = now.Unix()
+			Ω(rescheduled).Should(Equal([]models.PendingStartMessage{delayed}))
+
+			starts, err := store.GetPendingStartMessages()
 			Ω(err).ShouldNot(HaveOccurred())
-			Ω(node).Should(storenodematchers.MatchStoreNode(storeadapter.StoreNode{
-				Key:   "/hm/v1/apps/crashes/" + crashCount2.AppGuid + "," + crashCount2.AppVersion + "/4",
-				Value: crashCount2.ToJSON(),
-				TTL:   expectedTTL,
-			}))
+			Ω(starts[delayed.StoreKey()].SendOn).Should(Equal(now.Unix()))
+			Ω(starts[otherIndex.StoreKey()].SendOn).Should(Equal(now.Unix() + 900))
+			Ω(starts[missing.StoreKey()].SendOn).Should(Equal(now.Unix() + 900))
+		})
+	})
+
+	Describe("Expired entries", func() {
+		It("ignores them", func() {
+			storeAdapter.SetMulti([]storeadapter.StoreNode{{
+				Key:   "/hm/v1/apps/crash-history/" + crashCount1.AppGuid + "," + crashCount1.AppVersion,
+				Value: []byte(`[{"droplet":"` + crashCount1.AppGuid + `","version":"` + crashCount1.AppVersion + `","instance_index":1,"crash_count":17,"expires_at":10}]`),
+				TTL:   100,
+			}})
+
+			desire(crashCount1)
+			Ω(appCrashCounts(crashCount1)).Should(BeEmpty())
+		})
+	})
+
+	Describe("Legacy per-instance crash counts", func() {
+		var legacyKey string
+
+		BeforeEach(func() {
+			legacyKey = "/hm/v1/apps/crashes/" + crashCount3.AppGuid + "," + crashCount3.AppVersion + "/3"
+			storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: legacyKey, Value: crashCount3.ToJSON(), TTL: 100}})
+			desire(crashCount3)
+		})
+
+		It("still reads them", func() {
+			Ω(appCrashCounts(crashCount3)).Should(Equal([]models.CrashCount{crashCount3}))
+
+			apps, err := store.GetApps()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(apps[store.AppKey(crashCount3.AppGuid, crashCount3.AppVersion)].CrashCounts[3]).Should(Equal(crashCount3))
+		})
+
+		It("prefers the per-app crash counts", func() {
+			updated := crashCount3
+			updated.CrashCount = 20
+			store.SaveCrashCounts(updated)
+
+			Ω(appCrashCounts(crashCount3)).Should(Equal([]models.CrashCount{updated}))
+		})
+
+		Describe("migrating them", func() {
+			BeforeEach(func() {
+				anotherIndex := crashCount3
+				anotherIndex.InstanceIndex = 0
+				anotherIndex.CrashCount = 5
+				store.SaveCrashCounts(anotherIndex)
+
+				err := store.(*RealStore).MigrateCrashCounts()
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("moves them into the per-app key and deletes the legacy keys", func() {
+				_, err := storeAdapter.Get(legacyKey)
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+
+				crashCounts := appCrashCounts(crashCount3)
+				Ω(crashCounts).Should(HaveLen(2))
+				Ω(crashCounts).Should(ContainElement(crashCount3))
+			})
+
+			It("is a no-op when there is nothing to migrate", func() {
+				err := store.(*RealStore).MigrateCrashCounts()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(appCrashCounts(crashCount3)).Should(HaveLen(2))
+			})
 		})
 	})
 })
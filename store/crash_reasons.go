@@ -0,0 +1,64 @@
+package store
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// The reason each index of an app last crashed, from the DEA's
+// droplet.exited message, has a key that expires with the index's crash
+// count:
+//
+//	/crash-reasons/<guid>,<version>/<index>
+
+func (store *RealStore) crashReasonsRoot() string {
+	return store.SchemaRoot() + "/crash-reasons"
+}
+
+func (store *RealStore) crashReasonsRootForApp(appGuid string, appVersion string) string {
+	return store.crashReasonsRoot() + "/" + store.AppKey(appGuid, appVersion)
+}
+
+// SaveCrashReasons records why instances crashed, replacing the reason
+// their index last crashed.
+func (store *RealStore) SaveCrashReasons(reasons ...models.CrashReason) error {
+	for _, reason := range reasons {
+		err := store.save([]models.CrashReason{reason}, store.crashReasonsRootForApp(reason.AppGuid, reason.AppVersion), store.crashCountTTL())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCrashReasonsForApp returns why the app's indices last crashed, by
+// index.
+func (store *RealStore) GetCrashReasonsForApp(appGuid string, appVersion string) ([]models.CrashReason, error) {
+	reasonsByIndex, err := store.get(store.crashReasonsRootForApp(appGuid, appVersion), reflect.TypeOf(map[string]models.CrashReason{}), reflect.ValueOf(models.NewCrashReasonFromJSON))
+	if err != nil {
+		return []models.CrashReason{}, err
+	}
+
+	reasons := []models.CrashReason{}
+	for _, reason := range reasonsByIndex.Interface().(map[string]models.CrashReason) {
+		reasons = append(reasons, reason)
+	}
+	sort.Sort(crashReasonsByIndex(reasons))
+	return reasons, nil
+}
+
+type crashReasonsByIndex []models.CrashReason
+
+func (reasons crashReasonsByIndex) Len() int {
+	return len(reasons)
+}
+
+func (reasons crashReasonsByIndex) Swap(i, j int) {
+	reasons[i], reasons[j] = reasons[j], reasons[i]
+}
+
+func (reasons crashReasonsByIndex) Less(i, j int) bool {
+	return reasons[i].InstanceIndex < reasons[j].InstanceIndex
+}
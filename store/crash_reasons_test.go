@@ -0,0 +1,72 @@
+package store_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Crash reasons", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+		app          appfixture.AppFixture
+		reason       models.CrashReason
+	)
+
+	crashed := func(index int, description string) models.CrashReason {
+		exited := app.InstanceAtIndex(index).DropletExited(models.DropletExitedReasonCrashed)
+		exited.ExitDescription = description
+		return models.NewCrashReason(exited, time.Unix(100, 0))
+	}
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		app = appfixture.NewAppFixture()
+		reason = crashed(1, "out of memory")
+	})
+
+	It("records why each index last crashed, in index order", func() {
+		err := store.SaveCrashReasons(reason, crashed(0, "segfault"))
+		Ω(err).ShouldNot(HaveOccurred())
+		err = store.SaveCrashReasons(crashed(0, "exited"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		reasons, err := store.GetCrashReasonsForApp(app.AppGuid, app.AppVersion)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reasons).Should(Equal([]models.CrashReason{crashed(0, "exited"), reason}))
+	})
+
+	It("expires them with the crash counts", func() {
+		store.SaveCrashReasons(reason)
+
+		node, err := storeAdapter.Get("/hm/v1/crash-reasons/" + store.AppKey(app.AppGuid, app.AppVersion) + "/1")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.TTL).Should(BeNumerically("==", conf.MaximumBackoffDelay().Seconds()*2))
+	})
+
+	It("returns none for an app that has not crashed", func() {
+		reasons, err := store.GetCrashReasonsForApp(app.AppGuid, app.AppVersion)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reasons).Should(BeEmpty())
+	})
+
+	It("includes them in the app", func() {
+		store.SyncDesiredState(app.DesiredState(2))
+		store.SaveCrashReasons(reason)
+
+		found, err := store.GetApp(app.AppGuid, app.AppVersion)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(found.CrashReasons).Should(Equal([]models.CrashReason{reason}))
+	})
+})
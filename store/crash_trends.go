@@ -0,0 +1,113 @@
+package store
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// Crash trends live one key per app guid, and expire once the app has not
+// had a crash compacted for crash_trend_ttl_in_seconds:
+//
+//	/crash-trends/<guid>
+
+func (store *RealStore) crashTrendsRoot() string {
+	return store.SchemaRoot() + "/crash-trends"
+}
+
+// CrashCompactionStats describe a CompactCrashHistory run: how many apps had
+// crashes compacted, how many crashes were rolled into daily counts, and
+// how long it took.
+type CrashCompactionStats struct {
+	Apps     int
+	Crashes  int
+	Duration time.Duration
+}
+
+// CompactCrashHistory rolls the crashes in the app histories that are older
+// than crash_compaction_window_in_seconds into their apps' daily crash
+// counts, and takes them out of the histories.  The histories keep the time
+// they have left to live.  It does nothing when crash compaction is
+// disabled.
+func (store *RealStore) CompactCrashHistory(now time.Time) (CrashCompactionStats, error) {
+	stats := CrashCompactionStats{}
+	if !store.config.CrashCompactionEnabled() {
+		return stats, nil
+	}
+
+	t := time.Now()
+	histories, err := store.adapter.ListRecursively(store.appHistoriesRoot())
+	if err == storeadapter.ErrorKeyNotFound {
+		return stats, nil
+	} else if err != nil {
+		return stats, err
+	}
+
+	cutoff := now.Add(-store.config.CrashCompactionWindow()).Unix()
+	trendTTL := store.config.CrashTrendTTL()
+
+	nodes := []storeadapter.StoreNode{}
+	for _, node := range histories.ChildNodes {
+		history, err := models.NewAppHistoryFromJSON(node.Value)
+		if err != nil {
+			store.logger.Error("Failed to decode an app history, skipping its compaction", err, map[string]string{"Key": node.Key})
+			continue
+		}
+
+		crashes := []models.AppEvent{}
+		kept := []models.AppEvent{}
+		for _, event := range history.Events {
+			if event.Type == models.AppEventCrashObserved && event.Timestamp < cutoff {
+				crashes = append(crashes, event)
+			} else {
+				kept = append(kept, event)
+			}
+		}
+		if len(crashes) == 0 {
+			continue
+		}
+
+		trend, err := store.GetCrashTrend(history.AppGuid)
+		if err != nil {
+			return stats, err
+		}
+		trend = trend.Add(now.Add(-trendTTL), crashes...)
+
+		history.Events = kept
+		ttl := node.TTL
+		if ttl == 0 {
+			ttl = uint64(store.config.AppHistoryTTL().Seconds())
+		}
+
+		nodes = append(nodes,
+			storeadapter.StoreNode{Key: node.Key, Value: history.ToJSON(), TTL: ttl},
+			storeadapter.StoreNode{Key: store.crashTrendsRoot() + "/" + trend.StoreKey(), Value: trend.ToJSON(), TTL: uint64(trendTTL.Seconds())},
+		)
+		stats.Apps++
+		stats.Crashes += len(crashes)
+	}
+
+	if len(nodes) > 0 {
+		err = store.adapter.SetMulti(nodes)
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	stats.Duration = time.Since(t)
+	return stats, nil
+}
+
+// GetCrashTrend returns the daily crash counts of an app, which are empty if
+// none of its crashes have been compacted within the crash trend TTL.
+func (store *RealStore) GetCrashTrend(appGuid string) (models.CrashTrend, error) {
+	node, err := store.adapter.Get(store.crashTrendsRoot() + "/" + appGuid)
+	if err == storeadapter.ErrorKeyNotFound {
+		return models.CrashTrend{AppGuid: appGuid, Days: []models.DailyCrashCount{}}, nil
+	}
+	if err != nil {
+		return models.CrashTrend{}, err
+	}
+	return models.NewCrashTrendFromJSON(node.Value)
+}
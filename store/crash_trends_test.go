@@ -0,0 +1,134 @@
+package store_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Crash trends", func() {
+	const day = 24 * 60 * 60
+
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+		now          time.Time
+	)
+
+	crash := func(appGuid string, timestamp int64) models.AppEvent {
+		return models.AppEvent{Type: models.AppEventCrashObserved, Timestamp: timestamp, AppGuid: appGuid, AppVersion: "version"}
+	}
+
+	start := func(appGuid string, timestamp int64) models.AppEvent {
+		return models.AppEvent{Type: models.AppEventStartSent, Timestamp: timestamp, AppGuid: appGuid, AppVersion: "version"}
+	}
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		conf.AppHistoryMaxEvents = 10
+		conf.AppHistoryTTLInSeconds.Duration = 7 * day * time.Second
+		conf.CrashCompactionWindowInSeconds.Duration = day * time.Second
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		now = time.Unix(10*day, 0)
+
+		err := store.RecordAppEvents(now, crash("a", 8*day), start("a", 8*day+1), crash("a", 8*day+2), crash("a", 10*day-10))
+		Ω(err).ShouldNot(HaveOccurred())
+		err = store.RecordAppEvents(now, crash("b", 7*day), start("b", 7*day))
+		Ω(err).ShouldNot(HaveOccurred())
+		err = store.RecordAppEvents(now, crash("c", 10*day-10))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Describe("CompactCrashHistory", func() {
+		It("rolls the crashes older than the window into daily counts", func() {
+			stats, err := store.CompactCrashHistory(now)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(stats.Apps).Should(Equal(2))
+			Ω(stats.Crashes).Should(Equal(3))
+
+			trend, err := store.GetCrashTrend("a")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(trend).Should(Equal(models.CrashTrend{AppGuid: "a", Days: []models.DailyCrashCount{{Day: 8 * day, Crashes: 2}}}))
+
+			trend, _ = store.GetCrashTrend("b")
+			Ω(trend.Days).Should(Equal([]models.DailyCrashCount{{Day: 7 * day, Crashes: 1}}))
+
+			trend, _ = store.GetCrashTrend("c")
+			Ω(trend.Days).Should(BeEmpty())
+		})
+
+		It("takes the compacted crashes out of the histories", func() {
+			store.CompactCrashHistory(now)
+
+			history, _ := store.GetAppHistory("a")
+			Ω(history.Events).Should(Equal([]models.AppEvent{start("a", 8*day+1), crash("a", 10*day-10)}))
+
+			history, _ = store.GetAppHistory("c")
+			Ω(history.Events).Should(Equal([]models.AppEvent{crash("c", 10*day-10)}))
+		})
+
+		It("keeps the crash trends for the crash trend TTL", func() {
+			store.CompactCrashHistory(now)
+
+			node, err := storeAdapter.Get("/hm/v1/crash-trends/a")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(Equal(uint64(conf.CrashTrendTTL().Seconds())))
+		})
+
+		It("adds to the daily counts of earlier compactions", func() {
+			store.CompactCrashHistory(now)
+			store.RecordAppEvents(now, crash("a", 8*day+3))
+			store.CompactCrashHistory(now)
+
+			trend, _ := store.GetCrashTrend("a")
+			Ω(trend.Days).Should(Equal([]models.DailyCrashCount{{Day: 8 * day, Crashes: 3}}))
+		})
+
+		Context("when crash compaction is disabled", func() {
+			BeforeEach(func() {
+				conf.CrashCompactionWindowInSeconds.Duration = 0
+			})
+
+			It("leaves the histories alone", func() {
+				stats, err := store.CompactCrashHistory(now)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(stats).Should(BeZero())
+
+				history, _ := store.GetAppHistory("a")
+				Ω(history.Events).Should(HaveLen(4))
+			})
+		})
+
+		Context("when there are no app histories", func() {
+			BeforeEach(func() {
+				storeAdapter.Delete("/hm/v1/app-history")
+			})
+
+			It("does nothing", func() {
+				stats, err := store.CompactCrashHistory(now)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(stats.Apps).Should(BeZero())
+			})
+		})
+
+		Context("when the store fails", func() {
+			BeforeEach(func() {
+				storeAdapter.SetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("crash-trends", errors.New("oops"))
+			})
+
+			It("returns the error", func() {
+				_, err := store.CompactCrashHistory(now)
+				Ω(err).Should(Equal(errors.New("oops")))
+			})
+		})
+	})
+})
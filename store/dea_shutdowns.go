@@ -0,0 +1,33 @@
+package store
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// The DEAs that deployment tooling is about to shut down each have a key,
+// which expires after dea_shutdown_scheduled_ttl_in_seconds:
+//
+//	/dea-shutdowns/<dea-guid>
+
+func (store *RealStore) deaShutdownsRoot() string {
+	return store.SchemaRoot() + "/dea-shutdowns"
+}
+
+// ScheduleDeaShutdowns records that the DEAs are about to be shut down, as
+// of now.  Scheduling a DEA again renews its TTL.
+func (store *RealStore) ScheduleDeaShutdowns(now time.Time, deaGuids ...string) error {
+	shutdowns := []models.ScheduledDeaShutdown{}
+	for _, deaGuid := range deaGuids {
+		shutdowns = append(shutdowns, models.NewScheduledDeaShutdown(deaGuid, now))
+	}
+	return store.save(shutdowns, store.deaShutdownsRoot(), uint64(store.config.DeaShutdownScheduledTTL().Seconds()))
+}
+
+// GetScheduledDeaShutdowns returns the DEAs about to be shut down, by DEA.
+func (store *RealStore) GetScheduledDeaShutdowns() (map[string]models.ScheduledDeaShutdown, error) {
+	shutdowns, err := store.get(store.deaShutdownsRoot(), reflect.TypeOf(map[string]models.ScheduledDeaShutdown{}), reflect.ValueOf(models.NewScheduledDeaShutdownFromJSON))
+	return shutdowns.Interface().(map[string]models.ScheduledDeaShutdown), err
+}
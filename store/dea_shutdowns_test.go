@@ -0,0 +1,52 @@
+package store_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scheduled DEA shutdowns", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+	)
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+	})
+
+	It("records the DEAs about to be shut down", func() {
+		err := store.ScheduleDeaShutdowns(time.Unix(100, 0), "dea-1", "dea-2")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		shutdowns, err := store.GetScheduledDeaShutdowns()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(shutdowns).Should(Equal(map[string]models.ScheduledDeaShutdown{
+			"dea-1": {DeaGuid: "dea-1", ScheduledAt: 100},
+			"dea-2": {DeaGuid: "dea-2", ScheduledAt: 100},
+		}))
+	})
+
+	It("expires them after the scheduled shutdown TTL", func() {
+		store.ScheduleDeaShutdowns(time.Unix(100, 0), "dea-1")
+
+		node, err := storeAdapter.Get("/hm/v1/dea-shutdowns/dea-1")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.TTL).Should(BeNumerically("==", 900))
+	})
+
+	It("returns none when none are scheduled", func() {
+		shutdowns, err := store.GetScheduledDeaShutdowns()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(shutdowns).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"reflect"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// While the listener samples heartbeats, every DEA's latest heartbeat is
+// kept, in counts, in a key that expires with the DEA's presence:
+//
+//	/dea-summaries/<dea-guid>
+
+func (store *RealStore) deaSummariesRoot() string {
+	return store.SchemaRoot() + "/dea-summaries"
+}
+
+// SyncHeartbeatsSampling saves the instances of the DEAs on sampledDeas, by
+// guid, as SyncHeartbeats would.  The instances of every other DEA are left
+// as they were until its cohort is next sampled, but its presence is kept
+// up, and every DEA's heartbeat is summarized (see GetDeaSummaries).
+func (store *RealStore) SyncHeartbeatsSampling(sampledDeas map[string]bool, heartbeats ...models.Heartbeat) error {
+	err := store.syncHeartbeats(func(instanceHeartbeat models.InstanceHeartbeat) bool {
+		return sampledDeas[instanceHeartbeat.DeaGuid]
+	}, heartbeats)
+	if err != nil {
+		return err
+	}
+
+	summaries := []models.DeaSummary{}
+	for _, heartbeat := range heartbeats {
+		summaries = append(summaries, models.NewDeaSummary(heartbeat))
+	}
+	if len(summaries) == 0 {
+		return nil
+	}
+	return store.save(summaries, store.deaSummariesRoot(), store.config.InstanceMissingGracePeriod())
+}
+
+// GetDeaSummaries returns the summaries of the heartbeats the listener
+// received, while sampling, within the instance missing grace period, by
+// DEA guid.
+func (store *RealStore) GetDeaSummaries() (map[string]models.DeaSummary, error) {
+	summaries, err := store.get(store.deaSummariesRoot(), reflect.TypeOf(map[string]models.DeaSummary{}), reflect.ValueOf(models.NewDeaSummaryFromJSON))
+	return summaries.Interface().(map[string]models.DeaSummary), err
+}
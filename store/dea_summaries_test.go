@@ -0,0 +1,93 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sampling heartbeats", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+		sampledDea   appfixture.DeaFixture
+		otherDea     appfixture.DeaFixture
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		sampledDea = appfixture.NewDeaFixture()
+		otherDea = appfixture.NewDeaFixture()
+
+		err := store.SyncHeartbeats(
+			sampledDea.HeartbeatWith(sampledDea.GetApp(0).InstanceAtIndex(0).Heartbeat()),
+			otherDea.HeartbeatWith(otherDea.GetApp(0).InstanceAtIndex(0).Heartbeat()),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Context("when the listener samples some of the DEAs", func() {
+		BeforeEach(func() {
+			err := store.SyncHeartbeatsSampling(map[string]bool{sampledDea.DeaGuid: true},
+				sampledDea.HeartbeatWith(sampledDea.GetApp(0).InstanceAtIndex(1).Heartbeat()),
+				otherDea.HeartbeatWith(
+					otherDea.GetApp(0).InstanceAtIndex(1).Heartbeat(),
+					otherDea.GetApp(1).InstanceAtIndex(0).Heartbeat(),
+				),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fully sync the instances of the sampled DEAs", func() {
+			results, err := store.GetInstanceHeartbeatsForApp(sampledDea.GetApp(0).AppGuid, sampledDea.GetApp(0).AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(results).Should(ConsistOf(sampledDea.GetApp(0).InstanceAtIndex(1).Heartbeat()))
+		})
+
+		It("should leave the stored instances of every other DEA alone, and keep them present", func() {
+			results, err := store.GetInstanceHeartbeatsForApp(otherDea.GetApp(0).AppGuid, otherDea.GetApp(0).AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(results).Should(ConsistOf(otherDea.GetApp(0).InstanceAtIndex(0).Heartbeat()))
+
+			_, err = storeAdapter.Get("/hm/v1/dea-presence/" + otherDea.DeaGuid)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should summarize every DEA's heartbeat, expiring with the DEA's presence", func() {
+			summaries, err := store.GetDeaSummaries()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summaries).Should(HaveLen(2))
+			Ω(summaries[sampledDea.DeaGuid].Instances).Should(Equal(1))
+			Ω(summaries[otherDea.DeaGuid]).Should(Equal(models.DeaSummary{
+				DeaGuid:   otherDea.DeaGuid,
+				Instances: 2,
+				States:    map[models.InstanceState]int{models.InstanceStateRunning: 2},
+				Apps: map[string]int{
+					store.AppKey(otherDea.GetApp(0).AppGuid, otherDea.GetApp(0).AppVersion): 1,
+					store.AppKey(otherDea.GetApp(1).AppGuid, otherDea.GetApp(1).AppVersion): 1,
+				},
+			}))
+
+			node, err := storeAdapter.Get("/hm/v1/dea-summaries/" + otherDea.DeaGuid)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(Equal(conf.InstanceMissingGracePeriod()))
+		})
+	})
+
+	Context("when nothing has been sampled", func() {
+		It("should return no summaries", func() {
+			summaries, err := store.GetDeaSummaries()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(summaries).Should(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// The DEAs that report their zone each have a key, which expires once the
+// DEA has not been seen for stale_zone_timeout_in_seconds:
+//
+//	/dea-zones/<dea-guid>
+
+func (store *RealStore) deaZonesRoot() string {
+	return store.SchemaRoot() + "/dea-zones"
+}
+
+// SyncDeaZones records the DEAs that sent heartbeats or advertisements with
+// a zone as seen at now.  A heartbeat replaces the indices the DEA was
+// running; an advertisement keeps them.  It does nothing when the stale zone
+// timeout is 0.
+func (store *RealStore) SyncDeaZones(now time.Time, heartbeats []models.Heartbeat, advertisements []models.DeaAdvertisement) error {
+	timeout := store.config.StaleZoneTimeout()
+	if timeout == 0 {
+		return nil
+	}
+
+	updated := map[string]models.DeaZone{}
+	for _, heartbeat := range heartbeats {
+		if heartbeat.Zone != "" {
+			updated[heartbeat.DeaGuid] = models.NewDeaZone(heartbeat, now)
+		}
+	}
+
+	var existing models.DeaZones
+	for _, advertisement := range advertisements {
+		if advertisement.Zone() == "" {
+			continue
+		}
+		if _, ok := updated[advertisement.DeaGuid]; ok {
+			continue
+		}
+		if existing == nil {
+			var err error
+			existing, err = store.GetDeaZones()
+			if err != nil {
+				return err
+			}
+		}
+		deaZone := existing[advertisement.DeaGuid]
+		deaZone.DeaGuid = advertisement.DeaGuid
+		deaZone.Zone = advertisement.Zone()
+		deaZone.LastSeen = now.Unix()
+		updated[advertisement.DeaGuid] = deaZone
+	}
+
+	if len(updated) == 0 {
+		return nil
+	}
+
+	toSave := []models.DeaZone{}
+	for _, deaZone := range updated {
+		toSave = append(toSave, deaZone)
+	}
+	return store.save(toSave, store.deaZonesRoot(), uint64(timeout/time.Second))
+}
+
+// GetDeaZones returns the DEAs seen with a zone within the stale zone
+// timeout.
+func (store *RealStore) GetDeaZones() (models.DeaZones, error) {
+	deaZones, err := store.get(store.deaZonesRoot(), reflect.TypeOf(map[string]models.DeaZone{}), reflect.ValueOf(models.NewDeaZoneFromJSON))
+	return models.DeaZones(deaZones.Interface().(map[string]models.DeaZone)), err
+}
@@ -0,0 +1,86 @@
+package store_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DEA zones", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+		app          appfixture.AppFixture
+		heartbeat    models.Heartbeat
+	)
+
+	advertisement := func(deaGuid string, zone string) models.DeaAdvertisement {
+		advertisement := models.DeaAdvertisement{DeaGuid: deaGuid}
+		advertisement.PlacementProperties.Zone = zone
+		return advertisement
+	}
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		app = appfixture.NewAppFixture()
+		heartbeat = app.Heartbeat(1)
+		heartbeat.Zone = "z1"
+	})
+
+	It("records the DEAs that heartbeat with a zone", func() {
+		err := store.SyncDeaZones(time.Unix(100, 0), []models.Heartbeat{heartbeat, app.Heartbeat(1)}, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		deaZones, err := store.GetDeaZones()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(deaZones).Should(Equal(models.DeaZones{app.DeaGuid: models.NewDeaZone(heartbeat, time.Unix(100, 0))}))
+	})
+
+	It("expires them after the stale zone timeout", func() {
+		store.SyncDeaZones(time.Unix(100, 0), []models.Heartbeat{heartbeat}, nil)
+
+		node, err := storeAdapter.Get("/hm/v1/dea-zones/" + app.DeaGuid)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.TTL).Should(BeNumerically("==", 600))
+	})
+
+	It("keeps the indices of a DEA that only advertises", func() {
+		store.SyncDeaZones(time.Unix(100, 0), []models.Heartbeat{heartbeat}, nil)
+		err := store.SyncDeaZones(time.Unix(110, 0), nil, []models.DeaAdvertisement{
+			advertisement(app.DeaGuid, "z1"),
+			advertisement("new-dea", "z2"),
+			advertisement("zoneless-dea", ""),
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		deaZones, _ := store.GetDeaZones()
+		Ω(deaZones).Should(HaveLen(2))
+		Ω(deaZones[app.DeaGuid].LastSeen).Should(BeNumerically("==", 110))
+		Ω(deaZones[app.DeaGuid].Indices).Should(Equal(map[string][]int{store.AppKey(app.AppGuid, app.AppVersion): {0}}))
+		Ω(deaZones["new-dea"]).Should(Equal(models.DeaZone{DeaGuid: "new-dea", Zone: "z2", LastSeen: 110}))
+	})
+
+	Context("when the stale zone timeout is 0", func() {
+		BeforeEach(func() {
+			conf.StaleZoneTimeoutInSeconds.Duration = 0
+		})
+
+		It("records nothing", func() {
+			err := store.SyncDeaZones(time.Unix(100, 0), []models.Heartbeat{heartbeat}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			deaZones, _ := store.GetDeaZones()
+			Ω(deaZones).Should(BeEmpty())
+		})
+	})
+})
@@ -9,14 +9,14 @@ import (
 )
 
 func (store *RealStore) desiredStateStoreKey(desiredState models.DesiredAppState) string {
-	return store.SchemaRoot() + "/apps/desired/" + store.AppKey(desiredState.AppGuid, desiredState.AppVersion)
+	return store.appKeyUnder(store.SchemaRoot()+"/apps/desired", desiredState.AppGuid, desiredState.AppVersion)
 }
 
 func (store *RealStore) SyncDesiredState(newDesiredStates ...models.DesiredAppState) error {
 	t := time.Now()
 
 	tGet := time.Now()
-	currentDesiredStates, err := store.GetDesiredState()
+	currentDesiredStates, currentStoreKeys, err := store.desiredStates()
 	dtGet := time.Since(tGet).Seconds()
 
 	if err != nil {
@@ -30,7 +30,8 @@ func (store *RealStore) SyncDesiredState(newDesiredStates ...models.DesiredAppSt
 		newDesiredStateKeys[key] = true
 
 		currentDesiredState, present := currentDesiredStates[key]
-		if !(present && newDesiredState.Equal(currentDesiredState)) {
+		inPlace := len(currentStoreKeys[key]) > 0 && currentStoreKeys[key][0] == store.desiredStateStoreKey(newDesiredState)
+		if !(present && inPlace && newDesiredState.Equal(currentDesiredState)) {
 			nodesToSave = append(nodesToSave, storeadapter.StoreNode{
 				Key:   store.desiredStateStoreKey(newDesiredState),
 				Value: newDesiredState.ToCSV(),
@@ -47,9 +48,11 @@ func (store *RealStore) SyncDesiredState(newDesiredStates ...models.DesiredAppSt
 	}
 
 	keysToDelete := []string{}
-	for key, currentDesiredState := range currentDesiredStates {
-		if !newDesiredStateKeys[key] {
-			keysToDelete = append(keysToDelete, store.desiredStateStoreKey(currentDesiredState))
+	for key, storeKeys := range currentStoreKeys {
+		for _, storeKey := range storeKeys {
+			if !newDesiredStateKeys[key] || storeKey != store.desiredStateStoreKey(currentDesiredStates[key]) {
+				keysToDelete = append(keysToDelete, storeKey)
+			}
 		}
 	}
 
@@ -61,6 +64,11 @@ func (store *RealStore) SyncDesiredState(newDesiredStates ...models.DesiredAppSt
 		return err
 	}
 
+	err = store.syncUndesiredApps(currentDesiredStates, newDesiredStateKeys)
+	if err != nil {
+		return err
+	}
+
 	store.logger.Debug(fmt.Sprintf("Save Duration Desired"), map[string]string{
 		"Number of Items Synced":  fmt.Sprintf("%d", len(newDesiredStates)),
 		"Number of Items Saved":   fmt.Sprintf("%d", len(nodesToSave)),
@@ -74,39 +82,51 @@ func (store *RealStore) SyncDesiredState(newDesiredStates ...models.DesiredAppSt
 }
 
 func (store *RealStore) GetDesiredState() (results map[string]models.DesiredAppState, err error) {
+	results, _, err = store.desiredStates()
+	return results, err
+}
+
+// desiredStates returns the desired states, and every key each is stored
+// under, by store key.  Where an app is in both layouts the state and key in
+// the configured layout come first.
+func (store *RealStore) desiredStates() (results map[string]models.DesiredAppState, storeKeys map[string][]string, err error) {
 	t := time.Now()
 
 	results = make(map[string]models.DesiredAppState)
+	storeKeys = make(map[string][]string)
 
 	node, err := store.adapter.ListRecursively(store.SchemaRoot() + "/apps/desired")
 
 	if err == storeadapter.ErrorKeyNotFound {
-		return results, nil
+		return results, storeKeys, nil
 	} else if err != nil {
-		return results, err
+		return results, storeKeys, err
 	}
 
-	for _, desiredNode := range node.ChildNodes {
+	for _, desiredNode := range store.appNodes(node) {
 		components := strings.Split(desiredNode.Key, "/")
 		appGuidVersion := strings.Split(components[len(components)-1], ",")
 
 		desiredState, err := models.NewDesiredAppStateFromCSV(appGuidVersion[0], appGuidVersion[1], desiredNode.Value)
 		if err != nil {
-			return results, err
+			return results, storeKeys, err
 		}
 
-		results[desiredState.StoreKey()] = desiredState
+		if _, found := results[desiredState.StoreKey()]; !found {
+			results[desiredState.StoreKey()] = desiredState
+		}
+		storeKeys[desiredState.StoreKey()] = append(storeKeys[desiredState.StoreKey()], desiredNode.Key)
 	}
 
 	store.logger.Debug(fmt.Sprintf("Get Duration Desired"), map[string]string{
 		"Number of Items": fmt.Sprintf("%d", len(results)),
 		"Duration":        fmt.Sprintf("%.4f seconds", time.Since(t).Seconds()),
 	})
-	return results, nil
+	return results, storeKeys, nil
 }
 
 func (store *RealStore) getDesiredStateForApp(appGuid string, appVersion string) (desired models.DesiredAppState, err error) {
-	node, err := store.adapter.Get(store.SchemaRoot() + "/apps/desired/" + store.AppKey(appGuid, appVersion))
+	node, err := store.fetchApp(store.adapter.Get, store.SchemaRoot()+"/apps/desired", appGuid, appVersion)
 	if err == storeadapter.ErrorKeyNotFound {
 		return desired, nil
 	} else if err != nil {
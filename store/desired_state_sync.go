@@ -0,0 +1,57 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// While the fetcher writes the desired state it holds a marker, with the time
+// the sync began, so that the analyzer knows the desired state may be half
+// written:
+//
+//	/desired-sync
+//
+// The marker expires with the desired freshness, so a fetcher that dies
+// mid-sync holds the analyzer up no longer than a stale desired state would.
+// A sync ends by deleting its own marker only, so a fetcher whose marker
+// expired mid-sync leaves the marker of any sync that began since alone.
+
+func (store *RealStore) desiredStateSyncKey() string {
+	return store.SchemaRoot() + "/desired-sync"
+}
+
+func (store *RealStore) desiredStateSyncNode(timestamp time.Time) storeadapter.StoreNode {
+	value, _ := json.Marshal(models.FreshnessTimestamp{Timestamp: timestamp.Unix()})
+	return storeadapter.StoreNode{
+		Key:   store.desiredStateSyncKey(),
+		Value: value,
+		TTL:   store.config.DesiredFreshnessTTL(),
+	}
+}
+
+func (store *RealStore) BeginDesiredStateSync(timestamp time.Time) error {
+	return store.adapter.SetMulti([]storeadapter.StoreNode{store.desiredStateSyncNode(timestamp)})
+}
+
+// EndDesiredStateSync deletes the marker of the sync that began at
+// timestamp, if it is still there.
+func (store *RealStore) EndDesiredStateSync(timestamp time.Time) error {
+	err := store.adapter.CompareAndDelete(store.desiredStateSyncNode(timestamp))
+	if err == storeadapter.ErrorKeyNotFound || err == storeadapter.ErrorKeyComparisonFailed {
+		return nil
+	}
+	return err
+}
+
+func (store *RealStore) IsDesiredStateSyncInProgress() (bool, error) {
+	_, err := store.adapter.Get(store.desiredStateSyncKey())
+	if err == storeadapter.ErrorKeyNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,66 @@
+package store_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Desired state sync marker", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+	})
+
+	It("should not be in progress when no sync has begun", func() {
+		Ω(store.IsDesiredStateSyncInProgress()).Should(BeFalse())
+	})
+
+	It("should be in progress from the beginning of a sync to its end", func() {
+		Ω(store.BeginDesiredStateSync(time.Unix(100, 0))).Should(Succeed())
+		Ω(store.IsDesiredStateSyncInProgress()).Should(BeTrue())
+
+		node, err := storeAdapter.Get("/hm/v1/desired-sync")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.Value).Should(MatchJSON(`{"timestamp":100}`))
+		Ω(node.TTL).Should(Equal(conf.DesiredFreshnessTTL()))
+
+		Ω(store.EndDesiredStateSync(time.Unix(100, 0))).Should(Succeed())
+		Ω(store.IsDesiredStateSyncInProgress()).Should(BeFalse())
+	})
+
+	It("should not mind ending a sync that never began", func() {
+		Ω(store.EndDesiredStateSync(time.Unix(100, 0))).Should(Succeed())
+	})
+
+	It("should leave the marker of a sync that began since alone", func() {
+		Ω(store.BeginDesiredStateSync(time.Unix(100, 0))).Should(Succeed())
+		Ω(store.BeginDesiredStateSync(time.Unix(200, 0))).Should(Succeed())
+
+		Ω(store.EndDesiredStateSync(time.Unix(100, 0))).Should(Succeed())
+		Ω(store.IsDesiredStateSyncInProgress()).Should(BeTrue())
+
+		node, err := storeAdapter.Get("/hm/v1/desired-sync")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.Value).Should(MatchJSON(`{"timestamp":200}`))
+	})
+
+	It("should return errors from the store", func() {
+		storeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("desired-sync", errors.New("oops"))
+		_, err := store.IsDesiredStateSyncInProgress()
+		Ω(err).Should(MatchError("oops"))
+	})
+})
@@ -62,6 +62,25 @@ var _ = Describe("Desired State", func() {
 			Ω(desiredState[app2.DesiredState(1).StoreKey()]).Should(EqualDesiredState(app2.DesiredState(1)))
 		})
 
+		It("should store the organization, space and labels, and changes to them", func() {
+			desired := app1.DesiredState(1)
+			desired.OrganizationGuid = "org-guid"
+			desired.SpaceGuid = "space-guid"
+			desired.Labels = map[string]string{"team": "payments"}
+			Ω(store.SyncDesiredState(desired, app2.DesiredState(1))).Should(Succeed())
+
+			desiredState, err := store.GetDesiredState()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(desiredState[desired.StoreKey()]).Should(Equal(desired))
+
+			desired.Labels = map[string]string{"team": "billing"}
+			Ω(store.SyncDesiredState(desired, app2.DesiredState(1))).Should(Succeed())
+
+			desiredState, err = store.GetDesiredState()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(desiredState[desired.StoreKey()].Labels).Should(Equal(map[string]string{"team": "billing"}))
+		})
+
 		Context("When the desired state already exists", func() {
 			Context("and the state-to-sync has differences", func() {
 				BeforeEach(func() {
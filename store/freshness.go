@@ -7,26 +7,104 @@ import (
 	"time"
 )
 
+// Freshness describes a freshness key: whether it is set, since when (the
+// first bump after it was last missing) and how many seconds its TTL has left.
+type Freshness struct {
+	Present bool
+	Since   time.Time
+	TTL     uint64
+}
+
+func (store *RealStore) GetDesiredFreshness() (Freshness, error) {
+	return store.getFreshness(store.SchemaRoot() + store.config.DesiredFreshnessKey)
+}
+
+func (store *RealStore) GetActualFreshness() (Freshness, error) {
+	return store.getFreshness(store.SchemaRoot() + store.config.ActualFreshnessKey)
+}
+
+func (store *RealStore) getFreshness(key string) (Freshness, error) {
+	node, err := store.adapter.Get(key)
+	if err == storeadapter.ErrorKeyNotFound {
+		return Freshness{}, nil
+	}
+	if err != nil {
+		return Freshness{}, err
+	}
+
+	freshnessTimestamp := models.FreshnessTimestamp{}
+	err = json.Unmarshal(node.Value, &freshnessTimestamp)
+	if err != nil {
+		return Freshness{}, err
+	}
+
+	return Freshness{
+		Present: true,
+		Since:   time.Unix(freshnessTimestamp.Timestamp, 0),
+		TTL:     node.TTL,
+	}, nil
+}
+
+// Each bump also records its time, without a TTL, so that how long the state
+// has been stale is known once the freshness key has expired:
+//
+//	/last-fresh/actual
+//	/last-fresh/desired
+
+func (store *RealStore) lastFreshKey(state string) string {
+	return store.SchemaRoot() + "/last-fresh/" + state
+}
+
 func (store *RealStore) BumpDesiredFreshness(timestamp time.Time) error {
-	return store.bumpFreshness(store.SchemaRoot()+store.config.DesiredFreshnessKey, store.config.DesiredFreshnessTTL(), timestamp)
+	return store.bumpFreshness(store.SchemaRoot()+store.config.DesiredFreshnessKey, store.config.DesiredFreshnessTTL(), store.lastFreshKey("desired"), timestamp)
 }
 
 func (store *RealStore) BumpActualFreshness(timestamp time.Time) error {
-	return store.bumpFreshness(store.SchemaRoot()+store.config.ActualFreshnessKey, store.config.ActualFreshnessTTL(), timestamp)
+	return store.bumpFreshness(store.SchemaRoot()+store.config.ActualFreshnessKey, store.config.ActualFreshnessTTL(), store.lastFreshKey("actual"), timestamp)
+}
+
+// GetDesiredLastFresh returns the time of the last bump of the desired
+// freshness, or the zero time if it has never been bumped.
+func (store *RealStore) GetDesiredLastFresh() (time.Time, error) {
+	return store.getLastFresh(store.lastFreshKey("desired"))
+}
+
+// GetActualLastFresh does the same for the actual freshness.
+func (store *RealStore) GetActualLastFresh() (time.Time, error) {
+	return store.getLastFresh(store.lastFreshKey("actual"))
+}
+
+func (store *RealStore) getLastFresh(key string) (time.Time, error) {
+	node, err := store.adapter.Get(key)
+	if err == storeadapter.ErrorKeyNotFound {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	freshnessTimestamp := models.FreshnessTimestamp{}
+	err = json.Unmarshal(node.Value, &freshnessTimestamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(freshnessTimestamp.Timestamp, 0), nil
 }
 
 func (store *RealStore) RevokeActualFreshness() error {
 	return store.adapter.Delete(store.SchemaRoot() + store.config.ActualFreshnessKey)
 }
 
-func (store *RealStore) bumpFreshness(key string, ttl uint64, timestamp time.Time) error {
-	var jsonTimestamp []byte
-	oldTimestamp, err := store.adapter.Get(key)
+func (store *RealStore) RevokeDesiredFreshness() error {
+	return store.adapter.Delete(store.SchemaRoot() + store.config.DesiredFreshnessKey)
+}
+
+func (store *RealStore) bumpFreshness(key string, ttl uint64, lastFreshKey string, timestamp time.Time) error {
+	bumpedAt, _ := json.Marshal(models.FreshnessTimestamp{Timestamp: timestamp.Unix()})
 
+	jsonTimestamp := bumpedAt
+	oldTimestamp, err := store.adapter.Get(key)
 	if err == nil {
 		jsonTimestamp = oldTimestamp.Value
-	} else {
-		jsonTimestamp, _ = json.Marshal(models.FreshnessTimestamp{Timestamp: timestamp.Unix()})
 	}
 
 	return store.adapter.SetMulti([]storeadapter.StoreNode{
@@ -35,6 +113,10 @@ func (store *RealStore) bumpFreshness(key string, ttl uint64, timestamp time.Tim
 			Value: jsonTimestamp,
 			TTL:   ttl,
 		},
+		{
+			Key:   lastFreshKey,
+			Value: bumpedAt,
+		},
 	})
 }
 
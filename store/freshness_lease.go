@@ -0,0 +1,141 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/helpers/logger"
+)
+
+const ActualFreshnessLeaseTimer = "ActualFreshnessLease"
+const DesiredFreshnessLeaseTimer = "DesiredFreshnessLease"
+
+// FreshnessLease keeps a freshness key alive on behalf of the component that
+// owns it.  Once started it bumps the key every third of its TTL for as long
+// as the owner reports itself healthy.  An owner that becomes unhealthy (or
+// stops the lease) lets the key expire within one TTL; an owner that knows
+// its data is bad revokes the key outright.
+type FreshnessLease struct {
+	timerName    string
+	ttl          uint64
+	bump         func(time.Time) error
+	revoke       func() error
+	timeProvider timeprovider.TimeProvider
+	logger       logger.Logger
+
+	healthy bool
+	stop    chan bool
+	lock    *sync.Mutex
+}
+
+func (store *RealStore) NewActualFreshnessLease(timeProvider timeprovider.TimeProvider) *FreshnessLease {
+	return newFreshnessLease(ActualFreshnessLeaseTimer, store.config.ActualFreshnessTTL(), store.BumpActualFreshness, store.RevokeActualFreshness, timeProvider, store.logger)
+}
+
+func (store *RealStore) NewDesiredFreshnessLease(timeProvider timeprovider.TimeProvider) *FreshnessLease {
+	return newFreshnessLease(DesiredFreshnessLeaseTimer, store.config.DesiredFreshnessTTL(), store.BumpDesiredFreshness, store.RevokeDesiredFreshness, timeProvider, store.logger)
+}
+
+func newFreshnessLease(timerName string, ttl uint64, bump func(time.Time) error, revoke func() error, timeProvider timeprovider.TimeProvider, logger logger.Logger) *FreshnessLease {
+	return &FreshnessLease{
+		timerName:    timerName,
+		ttl:          ttl,
+		bump:         bump,
+		revoke:       revoke,
+		timeProvider: timeProvider,
+		logger:       logger,
+		healthy:      true,
+		lock:         &sync.Mutex{},
+	}
+}
+
+// RefreshInterval is how often a started lease bumps its key.
+func (lease *FreshnessLease) RefreshInterval() time.Duration {
+	interval := time.Duration(lease.ttl) * time.Second / 3
+	if interval < time.Second {
+		return time.Second
+	}
+	return interval
+}
+
+// Start bumps the key straight away (if the owner is healthy) and then
+// keeps refreshing it in the background.  Starting a running lease does
+// nothing.
+func (lease *FreshnessLease) Start() {
+	lease.lock.Lock()
+	if lease.stop != nil {
+		lease.lock.Unlock()
+		return
+	}
+	stop := make(chan bool)
+	lease.stop = stop
+	lease.lock.Unlock()
+
+	ticker := lease.timeProvider.NewTickerChannel(lease.timerName, lease.RefreshInterval())
+	lease.refresh()
+
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker:
+				select {
+				case <-stop:
+					return
+				default:
+					lease.refresh()
+				}
+			}
+		}
+	}()
+}
+
+// SetHealthy tells the lease whether its owner is in a state to vouch for
+// the data behind the key.  Unhealthy owners are not refreshed.
+func (lease *FreshnessLease) SetHealthy(healthy bool) {
+	lease.lock.Lock()
+	defer lease.lock.Unlock()
+	lease.healthy = healthy
+}
+
+func (lease *FreshnessLease) IsHealthy() bool {
+	lease.lock.Lock()
+	defer lease.lock.Unlock()
+	return lease.healthy
+}
+
+func (lease *FreshnessLease) IsRunning() bool {
+	lease.lock.Lock()
+	defer lease.lock.Unlock()
+	return lease.stop != nil
+}
+
+// Stop stops refreshing the key and leaves it to expire.
+func (lease *FreshnessLease) Stop() {
+	lease.lock.Lock()
+	defer lease.lock.Unlock()
+	if lease.stop != nil {
+		close(lease.stop)
+		lease.stop = nil
+	}
+}
+
+// Revoke stops refreshing the key and deletes it.
+func (lease *FreshnessLease) Revoke() error {
+	lease.Stop()
+	return lease.revoke()
+}
+
+func (lease *FreshnessLease) refresh() {
+	if !lease.IsHealthy() {
+		lease.logger.Info("Not refreshing freshness: owner is unhealthy", map[string]string{"Lease": lease.timerName})
+		return
+	}
+
+	err := lease.bump(lease.timeProvider.Time())
+	if err != nil {
+		lease.logger.Error("Failed to refresh freshness", err, map[string]string{"Lease": lease.timerName})
+	}
+}
@@ -0,0 +1,138 @@
+package store_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Freshness leases", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		timeProvider *faketimeprovider.FakeTimeProvider
+		conf         *config.Config
+		lease        *FreshnessLease
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		timeProvider = faketimeprovider.New(time.Unix(100, 0))
+		timeProvider.ProvideFakeChannels = true
+
+		lease = store.NewActualFreshnessLease(timeProvider)
+	})
+
+	AfterEach(func() {
+		lease.Stop()
+	})
+
+	freshnessKey := func() (storeadapter.StoreNode, error) {
+		return storeAdapter.Get("/hm/v1" + conf.ActualFreshnessKey)
+	}
+
+	tick := func() {
+		ticker := timeProvider.TickerChannelFor(ActualFreshnessLeaseTimer)
+		ticker <- time.Now()
+		// the second tick is only received once the first refresh is done
+		ticker <- time.Now()
+	}
+
+	It("refreshes every third of the TTL", func() {
+		Ω(lease.RefreshInterval()).Should(Equal(time.Duration(conf.ActualFreshnessTTL()) * time.Second / 3))
+
+		lease.Start()
+		Ω(timeProvider.TickerDurationFor(ActualFreshnessLeaseTimer)).Should(Equal(lease.RefreshInterval()))
+	})
+
+	It("bumps the freshness when it starts, and again on every tick", func() {
+		lease.Start()
+		Ω(lease.IsRunning()).Should(BeTrue())
+
+		node, err := freshnessKey()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.TTL).Should(Equal(conf.ActualFreshnessTTL()))
+
+		storeAdapter.Delete(node.Key)
+		tick()
+
+		_, err = freshnessKey()
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("keeps the original freshness timestamp", func() {
+		lease.Start()
+		timeProvider.IncrementBySeconds(conf.ActualFreshnessTTL())
+		tick()
+
+		fresh, err := store.IsActualStateFresh(timeProvider.Time())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(fresh).Should(BeTrue())
+	})
+
+	Context("when the owner is unhealthy", func() {
+		It("does not refresh the freshness until the owner recovers", func() {
+			lease.SetHealthy(false)
+			lease.Start()
+
+			_, err := freshnessKey()
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+
+			tick()
+			_, err = freshnessKey()
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+
+			lease.SetHealthy(true)
+			tick()
+			_, err = freshnessKey()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("when the lease is stopped", func() {
+		It("stops refreshing but leaves the key to expire", func() {
+			lease.Start()
+			ticker := timeProvider.TickerChannelFor(ActualFreshnessLeaseTimer)
+			lease.Stop()
+			Ω(lease.IsRunning()).Should(BeFalse())
+
+			_, err := freshnessKey()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Consistently(ticker).ShouldNot(BeSent(time.Now()))
+		})
+	})
+
+	Context("when the lease is revoked", func() {
+		It("stops refreshing and deletes the key", func() {
+			lease.Start()
+			err := lease.Revoke()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(lease.IsRunning()).Should(BeFalse())
+
+			_, err = freshnessKey()
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+	})
+
+	It("leases the desired freshness too", func() {
+		desiredLease := store.NewDesiredFreshnessLease(timeProvider)
+		desiredLease.Start()
+		defer desiredLease.Stop()
+
+		fresh, err := store.IsDesiredStateFresh()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(fresh).Should(BeTrue())
+		Ω(timeProvider.TickerDurationFor(DesiredFreshnessLeaseTimer)).Should(Equal(time.Duration(conf.DesiredFreshnessTTL()) * time.Second / 3))
+	})
+})
@@ -8,6 +8,7 @@ import (
 	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
 	"github.com/cloudfoundry/storeadapter"
 	"github.com/cloudfoundry/storeadapter/etcdstoreadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -112,6 +113,24 @@ var _ = Describe("Freshness", func() {
 
 		Context("the desired state", func() {
 			bumpingFreshness("/hm/v1"+conf.DesiredFreshnessKey, conf.DesiredFreshnessTTL(), Store.BumpDesiredFreshness)
+
+			Context("revoking desired state freshness", func() {
+				BeforeEach(func() {
+					store.BumpDesiredFreshness(time.Unix(100, 0))
+				})
+
+				It("should no longer be fresh", func() {
+					fresh, err := store.IsDesiredStateFresh()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(fresh).Should(BeTrue())
+
+					store.RevokeDesiredFreshness()
+
+					fresh, err = store.IsDesiredStateFresh()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(fresh).Should(BeFalse())
+				})
+			})
 		})
 	})
 
@@ -256,3 +275,55 @@ var _ = Describe("Freshness", func() {
 		})
 	})
 })
+
+var _ = Describe("Reading freshness", func() {
+	var (
+		store Store
+		conf  *config.Config
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		store = NewStore(conf, fakestoreadapter.New(), fakelogger.NewFakeLogger())
+	})
+
+	It("reports a missing key as not present", func() {
+		freshness, err := store.GetActualFreshness()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(freshness).Should(BeZero())
+	})
+
+	It("reports when the state became fresh and the TTL", func() {
+		store.BumpDesiredFreshness(time.Unix(100, 0))
+		store.BumpDesiredFreshness(time.Unix(120, 0))
+		store.BumpActualFreshness(time.Unix(130, 0))
+
+		desired, err := store.GetDesiredFreshness()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(desired).Should(Equal(Freshness{Present: true, Since: time.Unix(100, 0), TTL: conf.DesiredFreshnessTTL()}))
+
+		actual, err := store.GetActualFreshness()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(actual).Should(Equal(Freshness{Present: true, Since: time.Unix(130, 0), TTL: conf.ActualFreshnessTTL()}))
+	})
+
+	It("remembers when the state was last fresh after the freshness is gone", func() {
+		lastFresh, err := store.GetActualLastFresh()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(lastFresh).Should(BeZero())
+
+		store.BumpDesiredFreshness(time.Unix(100, 0))
+		store.BumpDesiredFreshness(time.Unix(120, 0))
+		store.BumpActualFreshness(time.Unix(130, 0))
+		store.RevokeDesiredFreshness()
+		store.RevokeActualFreshness()
+
+		lastFresh, err = store.GetDesiredLastFresh()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(lastFresh).Should(Equal(time.Unix(120, 0)))
+
+		lastFresh, err = store.GetActualLastFresh()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(lastFresh).Should(Equal(time.Unix(130, 0)))
+	})
+})
@@ -0,0 +1,9 @@
+package store
+
+import "github.com/cloudfoundry/hm9000/helpers/leaderelection"
+
+// GetLeader returns the candidate name of the process that leads the
+// component, or storeadapter.ErrorKeyNotFound if none does.
+func (store *RealStore) GetLeader(component string) (string, error) {
+	return leaderelection.Leader(store.adapter, leaderelection.LockKey(component))
+}
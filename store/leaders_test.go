@@ -0,0 +1,35 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Leaders", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+	)
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+	})
+
+	It("reads the leader from the component's lock", func() {
+		storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/locks/Analyzer", Value: []byte("node-a"), TTL: 10}})
+
+		Ω(store.GetLeader("Analyzer")).Should(Equal("node-a"))
+	})
+
+	It("returns ErrorKeyNotFound when nobody leads", func() {
+		_, err := store.GetLeader("Sender")
+		Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+	})
+})
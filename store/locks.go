@@ -0,0 +1,236 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/storeadapter"
+)
+
+var LockHeldError = errors.New("Lock is held by another owner")
+var LockLostError = errors.New("Lock is no longer held")
+
+const maxFencingTokenAttempts = 10
+
+// Locks keep singleton maintenance tasks (the shredder, migrations) from
+// running twice at once.  They live outside the schema, so compaction and
+// schema bumps leave them alone:
+//
+//	/hm/locks/tasks/<name>
+//	/hm/locks/fencing-tokens/<name>
+//
+// A lock expires ttl after it was taken or last refreshed.  Every time a
+// lock is taken it gets a fencing token higher than any before it, kept in a
+// key that outlives the lock, so a holder that stalls (or crashes) past its
+// TTL can tell, with CheckLock, that someone else has since taken over.
+type Lock struct {
+	Name      string `json:"name"`
+	Owner     string `json:"owner"`
+	Token     uint64 `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+	TTL       uint64 `json:"ttl"`
+}
+
+func NewLockFromJSON(encoded []byte) (Lock, error) {
+	lock := Lock{}
+	err := json.Unmarshal(encoded, &lock)
+	if err != nil {
+		return Lock{}, err
+	}
+	return lock, nil
+}
+
+func (lock Lock) ToJSON() []byte {
+	result, _ := json.Marshal(lock)
+	return result
+}
+
+// IsExpired is true once the lock's TTL has run out at now.
+func (lock Lock) IsExpired(now time.Time) bool {
+	return !now.Before(time.Unix(lock.ExpiresAt, 0))
+}
+
+func (store *RealStore) lockKey(name string) string {
+	return "/hm/locks/tasks/" + name
+}
+
+func (store *RealStore) fencingTokenKey(name string) string {
+	return "/hm/locks/fencing-tokens/" + name
+}
+
+// Lock takes the named lock for owner until ttl after now.  It returns
+// LockHeldError if anyone, owner included, holds the lock and it has not
+// expired: holders extend their lock with RefreshLock.
+func (store *RealStore) Lock(name string, owner string, ttl time.Duration, now time.Time) (Lock, error) {
+	existing, err := store.adapter.Get(store.lockKey(name))
+	if err != nil && err != storeadapter.ErrorKeyNotFound {
+		return Lock{}, err
+	}
+	found := err == nil
+
+	if found {
+		held, err := NewLockFromJSON(existing.Value)
+		if err == nil && !held.IsExpired(now) {
+			return Lock{}, LockHeldError
+		}
+	}
+
+	token, err := store.nextFencingToken(name)
+	if err != nil {
+		return Lock{}, err
+	}
+
+	lock := newLock(name, owner, token, ttl, now)
+	if found {
+		err = store.adapter.CompareAndSwap(existing, lock.node(store.lockKey(name)))
+	} else {
+		err = store.adapter.Create(lock.node(store.lockKey(name)))
+	}
+	if err == storeadapter.ErrorKeyExists || err == storeadapter.ErrorKeyComparisonFailed || err == storeadapter.ErrorKeyNotFound {
+		return Lock{}, LockHeldError
+	}
+	if err != nil {
+		return Lock{}, err
+	}
+	return lock, nil
+}
+
+// RefreshLock extends a lock the caller holds, keeping its fencing token.  It
+// returns LockLostError if the lock has expired or been taken since.
+func (store *RealStore) RefreshLock(lock Lock, now time.Time) (Lock, error) {
+	existing, err := store.heldLock(lock, now)
+	if err != nil {
+		return Lock{}, err
+	}
+
+	refreshed := newLock(lock.Name, lock.Owner, lock.Token, time.Duration(lock.TTL)*time.Second, now)
+	err = store.adapter.CompareAndSwap(existing, refreshed.node(store.lockKey(lock.Name)))
+	if err == storeadapter.ErrorKeyComparisonFailed || err == storeadapter.ErrorKeyNotFound {
+		return Lock{}, LockLostError
+	}
+	if err != nil {
+		return Lock{}, err
+	}
+	return refreshed, nil
+}
+
+// Unlock gives up a lock the caller holds, so that the next owner need not
+// wait for it to expire.  It returns LockLostError if someone else has taken
+// the lock since; a lock that merely expired is still given up.
+func (store *RealStore) Unlock(lock Lock) error {
+	existing, err := store.adapter.Get(store.lockKey(lock.Name))
+	if err == storeadapter.ErrorKeyNotFound {
+		return LockLostError
+	}
+	if err != nil {
+		return err
+	}
+
+	held, err := NewLockFromJSON(existing.Value)
+	if err != nil || held.Token != lock.Token {
+		return LockLostError
+	}
+
+	err = store.adapter.CompareAndDelete(existing)
+	if err == storeadapter.ErrorKeyComparisonFailed || err == storeadapter.ErrorKeyNotFound {
+		return LockLostError
+	}
+	return err
+}
+
+// CheckLock returns LockLostError unless the caller still holds the lock at
+// now.  Holders check before each write that must not interleave with the
+// next holder's.
+func (store *RealStore) CheckLock(lock Lock, now time.Time) error {
+	_, err := store.heldLock(lock, now)
+	return err
+}
+
+// GetLock returns the named lock, or storeadapter.ErrorKeyNotFound if nobody
+// has held it within its TTL.
+func (store *RealStore) GetLock(name string) (Lock, error) {
+	node, err := store.adapter.Get(store.lockKey(name))
+	if err != nil {
+		return Lock{}, err
+	}
+	return NewLockFromJSON(node.Value)
+}
+
+func (store *RealStore) heldLock(lock Lock, now time.Time) (storeadapter.StoreNode, error) {
+	existing, err := store.adapter.Get(store.lockKey(lock.Name))
+	if err == storeadapter.ErrorKeyNotFound {
+		return storeadapter.StoreNode{}, LockLostError
+	}
+	if err != nil {
+		return storeadapter.StoreNode{}, err
+	}
+
+	held, err := NewLockFromJSON(existing.Value)
+	if err != nil || held.Token != lock.Token || held.IsExpired(now) {
+		return storeadapter.StoreNode{}, LockLostError
+	}
+	return existing, nil
+}
+
+// nextFencingToken bumps the named lock's fencing token, retrying when
+// another owner bumps it at the same time.
+func (store *RealStore) nextFencingToken(name string) (uint64, error) {
+	key := store.fencingTokenKey(name)
+
+	var err error
+	for attempt := 0; attempt < maxFencingTokenAttempts; attempt++ {
+		var node storeadapter.StoreNode
+		node, err = store.adapter.Get(key)
+		if err == storeadapter.ErrorKeyNotFound {
+			err = store.adapter.Create(storeadapter.StoreNode{Key: key, Value: []byte("1")})
+			if err == nil {
+				return 1, nil
+			}
+			if err == storeadapter.ErrorKeyExists {
+				continue
+			}
+			return 0, err
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		current, parseErr := strconv.ParseUint(string(node.Value), 10, 64)
+		if parseErr != nil {
+			return 0, parseErr
+		}
+		next := current + 1
+		err = store.adapter.CompareAndSwap(node, storeadapter.StoreNode{Key: key, Value: []byte(strconv.FormatUint(next, 10))})
+		if err == nil {
+			return next, nil
+		}
+		if err != storeadapter.ErrorKeyComparisonFailed {
+			return 0, err
+		}
+	}
+	return 0, err
+}
+
+func newLock(name string, owner string, token uint64, ttl time.Duration, now time.Time) Lock {
+	ttlInSeconds := uint64(ttl.Seconds())
+	if ttlInSeconds < 1 {
+		ttlInSeconds = 1
+	}
+	return Lock{
+		Name:      name,
+		Owner:     owner,
+		Token:     token,
+		ExpiresAt: now.Unix() + int64(ttlInSeconds),
+		TTL:       ttlInSeconds,
+	}
+}
+
+func (lock Lock) node(key string) storeadapter.StoreNode {
+	return storeadapter.StoreNode{
+		Key:   key,
+		Value: lock.ToJSON(),
+		TTL:   lock.TTL,
+	}
+}
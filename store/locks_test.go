@@ -0,0 +1,218 @@
+package store_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Locks", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+		now          time.Time
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		now = time.Unix(1000, 0)
+	})
+
+	Describe("taking a lock", func() {
+		It("should store the lock, with its TTL, outside the schema", func() {
+			lock, err := store.Lock("shredder", "alice", 30*time.Second, now)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(lock).Should(Equal(Lock{Name: "shredder", Owner: "alice", Token: 1, ExpiresAt: 1030, TTL: 30}))
+
+			node, err := storeAdapter.Get("/hm/locks/tasks/shredder")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(BeNumerically("==", 30))
+
+			Ω(store.GetLock("shredder")).Should(Equal(lock))
+		})
+
+		It("should keep locks of different names apart", func() {
+			_, err := store.Lock("shredder", "alice", 30*time.Second, now)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			lock, err := store.Lock("migrations", "bob", 30*time.Second, now)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(lock.Token).Should(BeNumerically("==", 1))
+		})
+
+		It("should pass store errors on", func() {
+			storeAdapter.GetErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("locks", errors.New("oops"))
+			_, err := store.Lock("shredder", "alice", 30*time.Second, now)
+			Ω(err).Should(Equal(errors.New("oops")))
+		})
+	})
+
+	Context("when the lock is held", func() {
+		var lock Lock
+
+		BeforeEach(func() {
+			var err error
+			lock, err = store.Lock("shredder", "alice", 30*time.Second, now)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should not let anyone else take it", func() {
+			_, err := store.Lock("shredder", "bob", 30*time.Second, now.Add(29*time.Second))
+			Ω(err).Should(Equal(LockHeldError))
+		})
+
+		It("should not let the holder take it twice", func() {
+			_, err := store.Lock("shredder", "alice", 30*time.Second, now)
+			Ω(err).Should(Equal(LockHeldError))
+		})
+
+		It("should let the holder refresh it, keeping its token", func() {
+			refreshed, err := store.RefreshLock(lock, now.Add(20*time.Second))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(refreshed.Token).Should(Equal(lock.Token))
+			Ω(refreshed.ExpiresAt).Should(BeNumerically("==", 1050))
+
+			_, err = store.Lock("shredder", "bob", 30*time.Second, now.Add(40*time.Second))
+			Ω(err).Should(Equal(LockHeldError))
+			Ω(store.CheckLock(refreshed, now.Add(40*time.Second))).Should(Succeed())
+		})
+
+		It("should be held, as far as its holder can tell", func() {
+			Ω(store.CheckLock(lock, now.Add(29*time.Second))).Should(Succeed())
+		})
+
+		Describe("unlocking", func() {
+			BeforeEach(func() {
+				Ω(store.Unlock(lock)).Should(Succeed())
+			})
+
+			It("should delete the lock", func() {
+				_, err := store.GetLock("shredder")
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+				Ω(store.CheckLock(lock, now)).Should(Equal(LockLostError))
+			})
+
+			It("should let the next owner take it straight away, with a higher token", func() {
+				next, err := store.Lock("shredder", "bob", 30*time.Second, now)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(next.Token).Should(BeNumerically(">", lock.Token))
+			})
+		})
+	})
+
+	Context("when the lock expires", func() {
+		var lock Lock
+
+		BeforeEach(func() {
+			var err error
+			lock, err = store.Lock("shredder", "alice", 30*time.Second, now)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should no longer be held by its holder", func() {
+			Ω(store.CheckLock(lock, now.Add(30*time.Second))).Should(Equal(LockLostError))
+
+			_, err := store.RefreshLock(lock, now.Add(30*time.Second))
+			Ω(err).Should(Equal(LockLostError))
+		})
+
+		It("should let the holder give it up, if nobody took it since", func() {
+			Ω(store.Unlock(lock)).Should(Succeed())
+		})
+
+		It("should let someone else take it, with a higher token", func() {
+			next, err := store.Lock("shredder", "bob", 30*time.Second, now.Add(30*time.Second))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(next.Owner).Should(Equal("bob"))
+			Ω(next.Token).Should(BeNumerically("==", 2))
+		})
+
+		Context("and the store has expired the key", func() {
+			It("should hand out a higher token all the same", func() {
+				storeAdapter.Delete("/hm/locks/tasks/shredder")
+
+				next, err := store.Lock("shredder", "bob", 30*time.Second, now.Add(30*time.Second))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(next.Token).Should(BeNumerically("==", 2))
+			})
+		})
+	})
+
+	Context("when the holder crashes while holding the lock", func() {
+		var crashed, next Lock
+
+		BeforeEach(func() {
+			var err error
+			crashed, err = store.Lock("shredder", "alice", 30*time.Second, now)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = store.Lock("shredder", "bob", 30*time.Second, now.Add(10*time.Second))
+			Ω(err).Should(Equal(LockHeldError))
+
+			next, err = store.Lock("shredder", "bob", 30*time.Second, now.Add(31*time.Second))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fence the crashed holder out when it comes back", func() {
+			Ω(store.CheckLock(crashed, now.Add(32*time.Second))).Should(Equal(LockLostError))
+
+			_, err := store.RefreshLock(crashed, now.Add(32*time.Second))
+			Ω(err).Should(Equal(LockLostError))
+
+			Ω(store.Unlock(crashed)).Should(Equal(LockLostError))
+		})
+
+		It("should leave the new holder's lock alone", func() {
+			store.Unlock(crashed)
+			Ω(store.CheckLock(next, now.Add(32*time.Second))).Should(Succeed())
+			Ω(store.GetLock("shredder")).Should(Equal(next))
+		})
+	})
+
+	Context("when two owners race for the lock", func() {
+		It("should give it to only one of them", func() {
+			results := make(chan error, 10)
+			for i := 0; i < 10; i++ {
+				go func() {
+					_, err := store.Lock("shredder", "racer", 30*time.Second, now)
+					results <- err
+				}()
+			}
+
+			taken := 0
+			for i := 0; i < 10; i++ {
+				err := <-results
+				if err == nil {
+					taken++
+				} else {
+					Ω(err).Should(Equal(LockHeldError))
+				}
+			}
+			Ω(taken).Should(Equal(1))
+		})
+	})
+
+	Describe("compaction", func() {
+		It("should leave locks and their fencing tokens alone", func() {
+			storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/pokemon", Value: []byte("151")}})
+			lock, err := store.Lock("shredder", "alice", 30*time.Second, now)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(store.Compact()).Should(Succeed())
+
+			Ω(store.CheckLock(lock, now)).Should(Succeed())
+			_, err = storeAdapter.Get("/hm/locks/fencing-tokens/shredder")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
@@ -2,6 +2,7 @@ package store
 
 import (
 	"github.com/cloudfoundry/storeadapter"
+	"path"
 	"strconv"
 )
 
@@ -21,3 +22,43 @@ func (store *RealStore) GetMetric(metric string) (float64, error) {
 
 	return strconv.ParseFloat(string(node.Value), 64)
 }
+
+// Instance metrics are kept per instance of a component, and expire unless
+// the instance saves them again within the actual freshness TTL:
+//
+//	/instance-metrics/<metric>/<instance>
+
+func (store *RealStore) instanceMetricsRoot(metric string) string {
+	return store.SchemaRoot() + "/instance-metrics/" + metric
+}
+
+func (store *RealStore) SaveInstanceMetric(metric string, instance string, value float64) error {
+	node := storeadapter.StoreNode{
+		Key:   store.instanceMetricsRoot(metric) + "/" + instance,
+		Value: []byte(strconv.FormatFloat(value, 'f', 5, 64)),
+		TTL:   store.config.ActualFreshnessTTL(),
+	}
+	return store.adapter.SetMulti([]storeadapter.StoreNode{node})
+}
+
+// GetInstanceMetrics returns the value of a metric for each instance that has
+// saved it recently, by instance.
+func (store *RealStore) GetInstanceMetrics(metric string) (map[string]float64, error) {
+	values := map[string]float64{}
+
+	node, err := store.adapter.ListRecursively(store.instanceMetricsRoot(metric))
+	if err == storeadapter.ErrorKeyNotFound {
+		return values, nil
+	} else if err != nil {
+		return values, err
+	}
+
+	for _, child := range node.ChildNodes {
+		value, err := strconv.ParseFloat(string(child.Value), 64)
+		if err != nil {
+			return map[string]float64{}, err
+		}
+		values[path.Base(child.Key)] = value
+	}
+	return values, nil
+}
@@ -69,4 +69,33 @@ var _ = Describe("Metrics", func() {
 			})
 		})
 	})
+
+	Describe("Getting and setting an instance metric", func() {
+		BeforeEach(func() {
+			err := store.SaveInstanceMetric("sprockets", "listener-0", 17)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = store.SaveInstanceMetric("sprockets", "listener-1", 3)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should store the metric under /instance-metrics, for the actual freshness TTL", func() {
+			node, err := storeAdapter.Get("/hm/v1/instance-metrics/sprockets/listener-0")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(BeNumerically("~", conf.ActualFreshnessTTL(), 1))
+		})
+
+		It("should return the value of every instance", func() {
+			values, err := store.GetInstanceMetrics("sprockets")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(values).Should(Equal(map[string]float64{"listener-0": 17, "listener-1": 3}))
+		})
+
+		Context("when no instance has saved the metric", func() {
+			It("should return no values and no error", func() {
+				values, err := store.GetInstanceMetrics("nonexistent")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(values).Should(BeEmpty())
+			})
+		})
+	})
 })
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// EnqueueResult is what an EnqueuePendingMessages did: the messages it
+// dropped as equivalent to ones already pending, the apps whose messages it
+// did not write (by app key), how many of those it could not write because
+// someone else changed their pending messages first, and how long it took.
+type EnqueueResult struct {
+	DeduplicatedStarts []models.PendingStartMessage
+	DeduplicatedStops  []models.PendingStopMessage
+	FailedApps         map[string]bool
+	Conflicts          int
+	Duration           time.Duration
+}
+
+// EnqueuePendingMessages saves the start and stop messages that are not
+// equivalent to a message that is already pending (or earlier in the same
+// slice) and returns the ones it dropped.  Messages are equivalent whatever
+// their reasons, so that a start for a crashed index and a start for the
+// same index gone missing are never both pending.  A start message that must
+// skip verification is never dropped in favour of one that does not.  Of two
+// equivalent messages that have not been sent, the one kept is sent as soon
+// as the earlier of the two would have been.
+//
+// Each app's messages are written all-or-nothing: every key is written with
+// a compare-and-swap against what was pending when the call began, and if
+// any write for an app fails the writes already made for that app are
+// rolled back.  A failure for one app does not stop the other apps' messages
+// from being written; the first failure is returned, and every app whose
+// messages were not written is in FailedApps.  The apps' messages are
+// written side by side, up to store_max_concurrent_requests apps at a time.
+func (store *RealStore) EnqueuePendingMessages(startMessages []models.PendingStartMessage, stopMessages []models.PendingStopMessage) (result EnqueueResult, err error) {
+	t := time.Now()
+	defer func() {
+		result.Duration = time.Since(t)
+	}()
+
+	result = EnqueueResult{
+		DeduplicatedStarts: []models.PendingStartMessage{},
+		DeduplicatedStops:  []models.PendingStopMessage{},
+		FailedApps:         map[string]bool{},
+	}
+
+	existingNodes := map[string]storeadapter.StoreNode{}
+
+	startNodes, err := store.listPendingMessageNodes(store.SchemaRoot() + "/start")
+	if err != nil {
+		result.FailedApps = store.appsOfMessages(startMessages, stopMessages)
+		return result, err
+	}
+	pendingStarts := map[string]models.PendingStartMessage{}
+	for _, node := range startNodes {
+		existingNodes[node.Key] = node
+		message, err := models.NewPendingStartMessageFromJSON(node.Value)
+		if err == nil {
+			pendingStarts[message.EquivalenceKey()] = message
+		}
+	}
+
+	stopNodes, err := store.listPendingMessageNodes(store.SchemaRoot() + "/stop")
+	if err != nil {
+		result.FailedApps = store.appsOfMessages(startMessages, stopMessages)
+		return result, err
+	}
+	pendingStops := map[string]models.PendingStopMessage{}
+	for _, node := range stopNodes {
+		existingNodes[node.Key] = node
+		message, err := models.NewPendingStopMessageFromJSON(node.Value)
+		if err == nil {
+			pendingStops[message.EquivalenceKey()] = message
+		}
+	}
+
+	queuedStarts := map[string]models.PendingStartMessage{}
+	queuedStartKeys := []string{}
+	for _, message := range startMessages {
+		key := message.EquivalenceKey()
+		kept := message
+		equivalent, isPending := pendingStarts[key]
+		if isPending {
+			var replaced bool
+			kept, replaced = keptStartMessage(equivalent, message)
+			if !replaced {
+				result.DeduplicatedStarts = append(result.DeduplicatedStarts, message)
+			}
+			if kept.Equal(equivalent) {
+				continue
+			}
+		}
+		pendingStarts[key] = kept
+
+		if _, queued := queuedStarts[key]; !queued {
+			queuedStartKeys = append(queuedStartKeys, key)
+		}
+		queuedStarts[key] = kept
+	}
+
+	queuedStops := map[string]models.PendingStopMessage{}
+	queuedStopKeys := []string{}
+	for _, message := range stopMessages {
+		key := message.EquivalenceKey()
+		kept := message
+		equivalent, isPending := pendingStops[key]
+		if isPending {
+			kept = keptStopMessage(equivalent, message)
+			result.DeduplicatedStops = append(result.DeduplicatedStops, message)
+			if kept.Equal(equivalent) {
+				continue
+			}
+		}
+		pendingStops[key] = kept
+
+		if _, queued := queuedStops[key]; !queued {
+			queuedStopKeys = append(queuedStopKeys, key)
+		}
+		queuedStops[key] = kept
+	}
+
+	nodesByApp := map[string][]storeadapter.StoreNode{}
+	for _, key := range queuedStartKeys {
+		message := queuedStarts[key]
+		appKey := store.AppKey(message.AppGuid, message.AppVersion)
+		nodesByApp[appKey] = append(nodesByApp[appKey], storeadapter.StoreNode{
+			Key:   store.SchemaRoot() + "/start/" + message.StoreKey(),
+			Value: message.ToJSON(),
+		})
+	}
+	for _, key := range queuedStopKeys {
+		message := queuedStops[key]
+		appKey := store.AppKey(message.AppGuid, message.AppVersion)
+		nodesByApp[appKey] = append(nodesByApp[appKey], storeadapter.StoreNode{
+			Key:   store.SchemaRoot() + "/stop/" + message.StoreKey(),
+			Value: message.ToJSON(),
+		})
+	}
+
+	appKeys := []string{}
+	for appKey := range nodesByApp {
+		appKeys = append(appKeys, appKey)
+	}
+	sort.Strings(appKeys)
+
+	writeErrs := store.writePendingMessages(nodesByApp, existingNodes)
+	for _, appKey := range appKeys {
+		writeErr := writeErrs[appKey]
+		if writeErr == storeadapter.ErrorKeyExists || writeErr == storeadapter.ErrorKeyComparisonFailed {
+			result.Conflicts++
+		}
+		if writeErr != nil {
+			result.FailedApps[appKey] = true
+			store.logger.Error("Failed to enqueue pending messages for app", writeErr, map[string]string{
+				"App":                appKey,
+				"Number of Messages": fmt.Sprintf("%d", len(nodesByApp[appKey])),
+			})
+			if err == nil {
+				err = writeErr
+			}
+		}
+	}
+
+	return result, err
+}
+
+// keptStartMessage picks which of a pending start message and an equivalent
+// new one to keep, and whether that is the new one.  The pending message is
+// kept unless only the new one must skip verification.  If the pending
+// message has not been sent, the one kept is due as soon as either was.
+func keptStartMessage(pending models.PendingStartMessage, message models.PendingStartMessage) (kept models.PendingStartMessage, replaced bool) {
+	kept, dropped := pending, message
+	if message.SkipVerification && !pending.SkipVerification {
+		kept, dropped, replaced = message, pending, true
+	}
+	if !pending.HasBeenSent() && dropped.SendOn < kept.SendOn {
+		kept.SendOn = dropped.SendOn
+	}
+	return kept, replaced
+}
+
+// keptStopMessage is the pending stop message, brought forward to the new
+// equivalent one's SendOn if it has not been sent and the new one is due
+// first.
+func keptStopMessage(pending models.PendingStopMessage, message models.PendingStopMessage) models.PendingStopMessage {
+	kept := pending
+	if !pending.HasBeenSent() && message.SendOn < kept.SendOn {
+		kept.SendOn = message.SendOn
+	}
+	return kept
+}
+
+func (store *RealStore) listPendingMessageNodes(root string) ([]storeadapter.StoreNode, error) {
+	node, err := store.adapter.ListRecursively(root)
+	if err == storeadapter.ErrorKeyNotFound {
+		return []storeadapter.StoreNode{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return node.ChildNodes, nil
+}
+
+// appsOfMessages are the app keys of the apps with messages.
+func (store *RealStore) appsOfMessages(startMessages []models.PendingStartMessage, stopMessages []models.PendingStopMessage) map[string]bool {
+	apps := map[string]bool{}
+	for _, message := range startMessages {
+		apps[store.AppKey(message.AppGuid, message.AppVersion)] = true
+	}
+	for _, message := range stopMessages {
+		apps[store.AppKey(message.AppGuid, message.AppVersion)] = true
+	}
+	return apps
+}
+
+// writePendingMessages writes each app's nodes with
+// writePendingMessagesAtomically, for up to store_max_concurrent_requests
+// apps at a time, and returns the error of each app that failed, by app key.
+func (store *RealStore) writePendingMessages(nodesByApp map[string][]storeadapter.StoreNode, existingNodes map[string]storeadapter.StoreNode) map[string]error {
+	concurrency := store.config.StoreMaxConcurrentRequests
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	errs := map[string]error{}
+	lock := &sync.Mutex{}
+	slots := make(chan bool, concurrency)
+	wg := &sync.WaitGroup{}
+	for appKey, nodes := range nodesByApp {
+		wg.Add(1)
+		slots <- true
+		go func(appKey string, nodes []storeadapter.StoreNode) {
+			defer wg.Done()
+			err := store.writePendingMessagesAtomically(nodes, existingNodes)
+			if err != nil {
+				lock.Lock()
+				errs[appKey] = err
+				lock.Unlock()
+			}
+			<-slots
+		}(appKey, nodes)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// writePendingMessagesAtomically writes nodes one at a time, creating keys
+// that were not pending and swapping keys that were.  If a write fails, or
+// finds that someone else has changed the key in the meantime, the nodes
+// already written are restored to what they were before.
+func (store *RealStore) writePendingMessagesAtomically(nodes []storeadapter.StoreNode, existingNodes map[string]storeadapter.StoreNode) error {
+	written := []storeadapter.StoreNode{}
+
+	for _, node := range nodes {
+		var err error
+		previous, existed := existingNodes[node.Key]
+		if existed {
+			err = store.adapter.CompareAndSwapByIndex(previous.Index, node)
+		} else {
+			err = store.adapter.Create(node)
+		}
+
+		if err != nil {
+			store.rollBackPendingMessages(written, existingNodes)
+			return err
+		}
+		written = append(written, node)
+	}
+
+	return nil
+}
+
+// rollBackPendingMessages only undoes writes that have not been overwritten
+// since: a key that no longer holds the value we wrote is left alone.
+func (store *RealStore) rollBackPendingMessages(written []storeadapter.StoreNode, existingNodes map[string]storeadapter.StoreNode) {
+	for _, node := range written {
+		var err error
+		previous, existed := existingNodes[node.Key]
+		if existed {
+			err = store.adapter.CompareAndSwap(node, storeadapter.StoreNode{
+				Key:   previous.Key,
+				Value: previous.Value,
+				TTL:   previous.TTL,
+			})
+		} else {
+			err = store.adapter.CompareAndDelete(node)
+		}
+
+		if err != nil {
+			store.logger.Error("Failed to roll back pending message", err, map[string]string{"Key": node.Key})
+		}
+	}
+}
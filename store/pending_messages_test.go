@@ -0,0 +1,162 @@
+package store_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Enqueuing pending messages", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		startA       models.PendingStartMessage
+		stopA        models.PendingStopMessage
+		startB       models.PendingStartMessage
+	)
+
+	BeforeEach(func() {
+		conf, err := config.DefaultConfig()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		startA = models.NewPendingStartMessage(time.Unix(100, 0), 10, 4, "A", "1", 0, 1.0, models.PendingStartMessageReasonEvacuating)
+		stopA = models.NewPendingStopMessage(time.Unix(100, 0), 10, 4, "A", "1", "instance-a", models.PendingStopMessageReasonEvacuationComplete)
+		startB = models.NewPendingStartMessage(time.Unix(100, 0), 10, 4, "B", "1", 0, 1.0, models.PendingStartMessageReasonMissing)
+	})
+
+	It("writes start and stop messages", func() {
+		result, err := store.EnqueuePendingMessages([]models.PendingStartMessage{startA, startB}, []models.PendingStopMessage{stopA})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(result.DeduplicatedStarts).Should(BeEmpty())
+		Ω(result.DeduplicatedStops).Should(BeEmpty())
+		Ω(result.Conflicts).Should(BeZero())
+
+		starts, _ := store.GetPendingStartMessages()
+		Ω(starts).Should(HaveLen(2))
+		stops, _ := store.GetPendingStopMessages()
+		Ω(stops).Should(HaveLen(1))
+	})
+
+	Context("when one of an app's writes fails", func() {
+		BeforeEach(func() {
+			storeAdapter.CreateErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("instance-a", errors.New("oops"))
+		})
+
+		It("rolls back the app's other writes and returns the error", func() {
+			result, err := store.EnqueuePendingMessages([]models.PendingStartMessage{startA, startB}, []models.PendingStopMessage{stopA})
+			Ω(err).Should(Equal(errors.New("oops")))
+			Ω(result.FailedApps).Should(Equal(map[string]bool{store.AppKey("A", "1"): true}))
+
+			starts, _ := store.GetPendingStartMessages()
+			Ω(starts).Should(HaveLen(1))
+			Ω(starts).Should(ContainElement(startB))
+
+			stops, _ := store.GetPendingStopMessages()
+			Ω(stops).Should(BeEmpty())
+		})
+
+		It("restores messages that the app's writes replaced", func() {
+			missingA := models.NewPendingStartMessage(time.Unix(50, 0), 10, 4, "A", "1", 0, 0.5, models.PendingStartMessageReasonMissing)
+			err := store.SavePendingStartMessages(missingA)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = store.EnqueuePendingMessages([]models.PendingStartMessage{startA}, []models.PendingStopMessage{stopA})
+			Ω(err).Should(Equal(errors.New("oops")))
+
+			starts, _ := store.GetPendingStartMessages()
+			Ω(starts).Should(HaveLen(1))
+			Ω(starts).Should(ContainElement(missingA))
+		})
+	})
+
+	Context("when the pending messages fail to list", func() {
+		BeforeEach(func() {
+			storeAdapter.ListErrInjector = fakestoreadapter.NewFakeStoreAdapterErrorInjector("stop", errors.New("oops"))
+		})
+
+		It("writes nothing, and reports every app as failed", func() {
+			result, err := store.EnqueuePendingMessages([]models.PendingStartMessage{startA, startB}, []models.PendingStopMessage{stopA})
+			Ω(err).Should(Equal(errors.New("oops")))
+			Ω(result.FailedApps).Should(Equal(map[string]bool{store.AppKey("A", "1"): true, store.AppKey("B", "1"): true}))
+
+			starts, _ := store.GetPendingStartMessages()
+			Ω(starts).Should(BeEmpty())
+		})
+	})
+
+	Context("when someone else enqueues a message for the app first", func() {
+		BeforeEach(func() {
+			conf, _ := config.DefaultConfig()
+			store = NewStore(conf, &racingStoreAdapter{
+				FakeStoreAdapter: storeAdapter,
+				onCreate: func(node storeadapter.StoreNode) error {
+					if node.Key == "/hm/v1/start/"+startA.StoreKey() {
+						storeAdapter.SetMulti([]storeadapter.StoreNode{node})
+					}
+					return nil
+				},
+			}, fakelogger.NewFakeLogger())
+		})
+
+		It("counts the conflict, and still writes the other apps' messages", func() {
+			result, err := store.EnqueuePendingMessages([]models.PendingStartMessage{startA, startB}, []models.PendingStopMessage{})
+			Ω(err).Should(Equal(storeadapter.ErrorKeyExists))
+			Ω(result.Conflicts).Should(Equal(1))
+
+			starts, _ := store.GetPendingStartMessages()
+			Ω(starts).Should(ContainElement(startB))
+		})
+	})
+
+	Context("when someone else overwrites a message before the app's writes are rolled back", func() {
+		var otherWriter models.PendingStartMessage
+
+		BeforeEach(func() {
+			otherWriter = models.NewPendingStartMessage(time.Unix(200, 0), 0, 4, "A", "1", 0, 1.0, models.PendingStartMessageReasonCrashed)
+			conf, _ := config.DefaultConfig()
+			store = NewStore(conf, &racingStoreAdapter{
+				FakeStoreAdapter: storeAdapter,
+				onCreate: func(node storeadapter.StoreNode) error {
+					if node.Key != "/hm/v1/stop/instance-a" {
+						return nil
+					}
+					storeAdapter.SetMulti([]storeadapter.StoreNode{{Key: "/hm/v1/start/" + otherWriter.StoreKey(), Value: otherWriter.ToJSON()}})
+					return errors.New("oops")
+				},
+			}, fakelogger.NewFakeLogger())
+		})
+
+		It("leaves the other writer's message in place", func() {
+			_, err := store.EnqueuePendingMessages([]models.PendingStartMessage{startA}, []models.PendingStopMessage{stopA})
+			Ω(err).Should(Equal(errors.New("oops")))
+
+			starts, _ := store.GetPendingStartMessages()
+			Ω(starts).Should(HaveLen(1))
+			Ω(starts).Should(ContainElement(otherWriter))
+		})
+	})
+})
+
+type racingStoreAdapter struct {
+	*fakestoreadapter.FakeStoreAdapter
+	onCreate func(node storeadapter.StoreNode) error
+}
+
+func (adapter *racingStoreAdapter) Create(node storeadapter.StoreNode) error {
+	err := adapter.onCreate(node)
+	if err != nil {
+		return err
+	}
+	return adapter.FakeStoreAdapter.Create(node)
+}
@@ -9,6 +9,14 @@ func (store *RealStore) SavePendingStartMessages(messages ...models.PendingStart
 	return store.save(messages, store.SchemaRoot()+"/start", 0)
 }
 
+// EnqueuePendingStartMessages is EnqueuePendingMessages for start messages
+// alone.  Use SavePendingStartMessages to update a message that is already
+// pending.
+func (store *RealStore) EnqueuePendingStartMessages(messages ...models.PendingStartMessage) (deduplicated []models.PendingStartMessage, err error) {
+	result, err := store.EnqueuePendingMessages(messages, []models.PendingStopMessage{})
+	return result.DeduplicatedStarts, err
+}
+
 func (store *RealStore) GetPendingStartMessages() (map[string]models.PendingStartMessage, error) {
 	slice, err := store.get(store.SchemaRoot()+"/start", reflect.TypeOf(map[string]models.PendingStartMessage{}), reflect.ValueOf(models.NewPendingStartMessageFromJSON))
 	return slice.Interface().(map[string]models.PendingStartMessage), err
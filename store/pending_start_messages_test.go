@@ -71,6 +71,86 @@ var _ = Describe("Storing PendingStartMessages", func() {
 		})
 	})
 
+	Describe("Enqueuing start messages", func() {
+		BeforeEach(func() {
+			err := store.SavePendingStartMessages(message1)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("saves messages that are not already pending", func() {
+			deduplicated, err := store.EnqueuePendingStartMessages(message2, message3)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deduplicated).Should(BeEmpty())
+
+			pending, err := store.GetPendingStartMessages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pending).Should(HaveLen(3))
+		})
+
+		It("drops messages equivalent to one that is already pending, leaving the pending message untouched", func() {
+			equivalent := models.NewPendingStartMessage(time.Unix(200, 0), 0, 30, "ABC", "123", 1, 0.5, models.PendingStartMessageReasonInvalid)
+			deduplicated, err := store.EnqueuePendingStartMessages(equivalent, message2)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deduplicated).Should(Equal([]models.PendingStartMessage{equivalent}))
+
+			pending, err := store.GetPendingStartMessages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pending).Should(HaveLen(2))
+			Ω(pending).Should(ContainElement(message1))
+			Ω(pending).Should(ContainElement(message2))
+		})
+
+		It("drops messages equivalent to an earlier message in the same batch", func() {
+			equivalent := models.NewPendingStartMessage(time.Unix(200, 0), 0, 30, "DEF", "123", 1, 0.5, models.PendingStartMessageReasonInvalid)
+			deduplicated, err := store.EnqueuePendingStartMessages(message2, equivalent)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deduplicated).Should(Equal([]models.PendingStartMessage{equivalent}))
+
+			pending, err := store.GetPendingStartMessages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pending).Should(ContainElement(message2))
+		})
+
+		It("replaces an equivalent pending message with one that must skip verification", func() {
+			mustSend := models.NewPendingStartMessage(time.Unix(200, 0), 0, 30, "ABC", "123", 1, 2.0, models.PendingStartMessageReasonInvalid)
+			mustSend.SkipVerification = true
+			deduplicated, err := store.EnqueuePendingStartMessages(mustSend)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deduplicated).Should(BeEmpty())
+
+			mustSend.SendOn = message1.SendOn
+			pending, err := store.GetPendingStartMessages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pending).Should(ContainElement(mustSend))
+		})
+
+		It("drops messages for the same index with a different reason", func() {
+			evacuating := models.NewPendingStartMessage(time.Unix(200, 0), 0, 30, "ABC", "123", 1, 2.0, models.PendingStartMessageReasonEvacuating)
+			deduplicated, err := store.EnqueuePendingStartMessages(evacuating)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deduplicated).Should(Equal([]models.PendingStartMessage{evacuating}))
+
+			pending, err := store.GetPendingStartMessages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pending).Should(HaveLen(1))
+			Ω(pending).Should(ContainElement(message1))
+		})
+
+		It("brings the pending message forward when the message it drops is due first", func() {
+			missing := models.NewPendingStartMessage(time.Unix(50, 0), 0, 30, "ABC", "123", 1, 1.0, models.PendingStartMessageReasonMissing)
+			deduplicated, err := store.EnqueuePendingStartMessages(missing)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deduplicated).Should(Equal([]models.PendingStartMessage{missing}))
+
+			expected := message1
+			expected.SendOn = missing.SendOn
+			pending, err := store.GetPendingStartMessages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pending).Should(HaveLen(1))
+			Ω(pending).Should(ContainElement(expected))
+		})
+	})
+
 	Describe("Fetching start message", func() {
 		Context("When the start message is present", func() {
 			BeforeEach(func() {
@@ -9,6 +9,14 @@ func (store *RealStore) SavePendingStopMessages(messages ...models.PendingStopMe
 	return store.save(messages, store.SchemaRoot()+"/stop", 0)
 }
 
+// EnqueuePendingStopMessages is EnqueuePendingMessages for stop messages
+// alone.  Use SavePendingStopMessages to update a message that is already
+// pending.
+func (store *RealStore) EnqueuePendingStopMessages(messages ...models.PendingStopMessage) (deduplicated []models.PendingStopMessage, err error) {
+	result, err := store.EnqueuePendingMessages([]models.PendingStartMessage{}, messages)
+	return result.DeduplicatedStops, err
+}
+
 func (store *RealStore) GetPendingStopMessages() (map[string]models.PendingStopMessage, error) {
 	slice, err := store.get(store.SchemaRoot()+"/stop", reflect.TypeOf(map[string]models.PendingStopMessage{}), reflect.ValueOf(models.NewPendingStopMessageFromJSON))
 	return slice.Interface().(map[string]models.PendingStopMessage), err
@@ -71,6 +71,52 @@ var _ = Describe("Storing PendingStopMessages", func() {
 		})
 	})
 
+	Describe("Enqueuing stop messages", func() {
+		BeforeEach(func() {
+			err := store.SavePendingStopMessages(message1)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("drops messages equivalent to one that is already pending and saves the rest", func() {
+			equivalent := models.NewPendingStopMessage(time.Unix(200, 0), 0, 30, "ABC", "123", "XYZ", models.PendingStopMessageReasonInvalid)
+			deduplicated, err := store.EnqueuePendingStopMessages(equivalent, message2)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deduplicated).Should(Equal([]models.PendingStopMessage{equivalent}))
+
+			pending, err := store.GetPendingStopMessages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pending).Should(HaveLen(2))
+			Ω(pending).Should(ContainElement(message1))
+			Ω(pending).Should(ContainElement(message2))
+		})
+
+		It("drops messages for the same instance with a different reason", func() {
+			duplicate := models.NewPendingStopMessage(time.Unix(200, 0), 0, 30, "ABC", "123", "XYZ", models.PendingStopMessageReasonDuplicate)
+			deduplicated, err := store.EnqueuePendingStopMessages(duplicate)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deduplicated).Should(Equal([]models.PendingStopMessage{duplicate}))
+
+			pending, err := store.GetPendingStopMessages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pending).Should(HaveLen(1))
+			Ω(pending).Should(ContainElement(message1))
+		})
+
+		It("brings the pending message forward when the message it drops is due first", func() {
+			duplicate := models.NewPendingStopMessage(time.Unix(50, 0), 0, 30, "ABC", "123", "XYZ", models.PendingStopMessageReasonDuplicate)
+			deduplicated, err := store.EnqueuePendingStopMessages(duplicate)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(deduplicated).Should(Equal([]models.PendingStopMessage{duplicate}))
+
+			expected := message1
+			expected.SendOn = duplicate.SendOn
+			pending, err := store.GetPendingStopMessages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pending).Should(HaveLen(1))
+			Ω(pending).Should(ContainElement(expected))
+		})
+	})
+
 	Describe("Fetching stop message", func() {
 		Context("When the stop message is present", func() {
 			BeforeEach(func() {
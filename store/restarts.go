@@ -0,0 +1,87 @@
+package store
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// Restart histories live one key per app, and expire once the app has not
+// been restarted for the restart report window:
+//
+//	/restarts/<guid>,<version>
+//
+// The latest restart report lives in /reports/restarts.
+
+func (store *RealStore) restartsRoot() string {
+	return store.SchemaRoot() + "/restarts"
+}
+
+func (store *RealStore) restartReportKey() string {
+	return store.SchemaRoot() + "/reports/restarts"
+}
+
+// RecordRestarts adds the start messages, sent at now, to their apps'
+// restart histories, and forgets the restarts that have left the restart
+// report window.
+func (store *RealStore) RecordRestarts(now time.Time, starts ...models.PendingStartMessage) error {
+	if len(starts) == 0 {
+		return nil
+	}
+
+	histories, err := store.GetRestartHistories()
+	if err != nil {
+		return err
+	}
+
+	window := store.config.RestartReportWindow()
+	updated := map[string]models.RestartHistory{}
+	for _, start := range starts {
+		key := store.AppKey(start.AppGuid, start.AppVersion)
+		history, ok := updated[key]
+		if !ok {
+			history = histories[key].Since(now.Add(-window))
+			history.AppGuid = start.AppGuid
+			history.AppVersion = start.AppVersion
+		}
+		history.Restarts = append(history.Restarts, models.Restart{
+			Index:  start.IndexToStart,
+			Reason: start.StartReason,
+			SentAt: now.Unix(),
+		})
+		updated[key] = history
+	}
+
+	toSave := []models.RestartHistory{}
+	for _, history := range updated {
+		toSave = append(toSave, history)
+	}
+	return store.save(toSave, store.restartsRoot(), uint64(window/time.Second))
+}
+
+// GetRestartHistories returns the restart history of every app restarted in
+// the restart report window, by app key.  They may still include restarts
+// from before the window.
+func (store *RealStore) GetRestartHistories() (map[string]models.RestartHistory, error) {
+	histories, err := store.get(store.restartsRoot(), reflect.TypeOf(map[string]models.RestartHistory{}), reflect.ValueOf(models.NewRestartHistoryFromJSON))
+	return histories.Interface().(map[string]models.RestartHistory), err
+}
+
+func (store *RealStore) SaveRestartReport(report models.RestartReport) error {
+	return store.adapter.SetMulti([]storeadapter.StoreNode{{
+		Key:   store.restartReportKey(),
+		Value: report.ToJSON(),
+	}})
+}
+
+// GetRestartReport returns the latest restart report, or
+// storeadapter.ErrorKeyNotFound if there has not been one.
+func (store *RealStore) GetRestartReport() (models.RestartReport, error) {
+	node, err := store.adapter.Get(store.restartReportKey())
+	if err != nil {
+		return models.RestartReport{}, err
+	}
+	return models.NewRestartReportFromJSON(node.Value)
+}
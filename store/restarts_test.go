@@ -0,0 +1,100 @@
+package store_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Restarts", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+		app          appfixture.AppFixture
+	)
+
+	start := func(index int, reason models.PendingStartMessageReason) models.PendingStartMessage {
+		return models.NewPendingStartMessage(time.Unix(0, 0), 0, 0, app.AppGuid, app.AppVersion, index, 1.0, reason)
+	}
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		conf.RestartReportWindowInSeconds.Duration = time.Hour
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+		app = appfixture.NewAppFixture()
+	})
+
+	Describe("RecordRestarts", func() {
+		It("adds the starts to their apps' histories", func() {
+			err := store.RecordRestarts(time.Unix(1000, 0), start(0, models.PendingStartMessageReasonCrashed), start(1, models.PendingStartMessageReasonMissing))
+			Ω(err).ShouldNot(HaveOccurred())
+			err = store.RecordRestarts(time.Unix(1010, 0), start(0, models.PendingStartMessageReasonCrashed))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			histories, err := store.GetRestartHistories()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(histories).Should(Equal(map[string]models.RestartHistory{
+				store.AppKey(app.AppGuid, app.AppVersion): {
+					AppGuid:    app.AppGuid,
+					AppVersion: app.AppVersion,
+					Restarts: []models.Restart{
+						{Index: 0, Reason: models.PendingStartMessageReasonCrashed, SentAt: 1000},
+						{Index: 1, Reason: models.PendingStartMessageReasonMissing, SentAt: 1000},
+						{Index: 0, Reason: models.PendingStartMessageReasonCrashed, SentAt: 1010},
+					},
+				},
+			}))
+		})
+
+		It("forgets restarts that have left the window", func() {
+			store.RecordRestarts(time.Unix(1000, 0), start(0, models.PendingStartMessageReasonCrashed))
+			store.RecordRestarts(time.Unix(1000+3601, 0), start(0, models.PendingStartMessageReasonCrashed))
+
+			histories, _ := store.GetRestartHistories()
+			Ω(histories[store.AppKey(app.AppGuid, app.AppVersion)].Restarts).Should(HaveLen(1))
+		})
+
+		It("expires a history once the window passes", func() {
+			store.RecordRestarts(time.Unix(1000, 0), start(0, models.PendingStartMessageReasonCrashed))
+
+			node, err := storeAdapter.Get("/hm/v1/restarts/" + store.AppKey(app.AppGuid, app.AppVersion))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(BeNumerically("==", 3600))
+		})
+
+		It("writes nothing when there were no starts", func() {
+			err := store.RecordRestarts(time.Unix(1000, 0))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			histories, _ := store.GetRestartHistories()
+			Ω(histories).Should(BeEmpty())
+		})
+	})
+
+	Describe("the restart report", func() {
+		It("saves and returns the latest report", func() {
+			report := models.RestartReport{GeneratedAt: 100, Threshold: 1, Apps: []models.RestartedApp{{AppGuid: "a", AppVersion: "b", Restarts: 2, LastReasons: []models.PendingStartMessageReason{}}}}
+			err := store.SaveRestartReport(report)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			saved, err := store.GetRestartReport()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(saved).Should(Equal(report))
+		})
+
+		It("returns ErrorKeyNotFound when there is none", func() {
+			_, err := store.GetRestartReport()
+			Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+		})
+	})
+})
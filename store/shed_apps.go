@@ -0,0 +1,57 @@
+package store
+
+import (
+	"reflect"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// While the listener sheds heartbeat detail, the apps off the priority list
+// keep only counts of their instances, one key per app per DEA, which expire
+// with the DEA's presence:
+//
+//	/apps/shed/<guid>,<version>,<dea-guid>
+
+func (store *RealStore) shedAppsRoot() string {
+	return store.SchemaRoot() + "/apps/shed"
+}
+
+// SyncHeartbeatsShedding saves the instances of the apps on priorityApps, by
+// guid, as SyncHeartbeats would.  The instances of every other app are only
+// counted: their stored heartbeats are left as they were until the next full
+// sync, so the analyzer must leave those apps alone (see GetShedApps).
+func (store *RealStore) SyncHeartbeatsShedding(priorityApps map[string]bool, heartbeats ...models.Heartbeat) error {
+	prioritized := func(instanceHeartbeat models.InstanceHeartbeat) bool {
+		return priorityApps[instanceHeartbeat.AppGuid]
+	}
+	shed := func(instanceHeartbeat models.InstanceHeartbeat) bool {
+		return !prioritized(instanceHeartbeat)
+	}
+
+	err := store.syncHeartbeats(prioritized, heartbeats)
+	if err != nil {
+		return err
+	}
+
+	shedApps := []models.ShedApp{}
+	for _, heartbeat := range heartbeats {
+		shedApps = append(shedApps, models.NewShedApps(heartbeat, shed)...)
+	}
+	if len(shedApps) == 0 {
+		return nil
+	}
+	return store.save(shedApps, store.shedAppsRoot(), store.config.InstanceMissingGracePeriod())
+}
+
+// GetShedApps returns the instance counts of the apps whose heartbeats were
+// shed by the listener within the instance missing grace period, by app key,
+// one per DEA.
+func (store *RealStore) GetShedApps() (map[string][]models.ShedApp, error) {
+	summaries, err := store.get(store.shedAppsRoot(), reflect.TypeOf(map[string]models.ShedApp{}), reflect.ValueOf(models.NewShedAppFromJSON))
+	shedApps := map[string][]models.ShedApp{}
+	for _, shedApp := range summaries.Interface().(map[string]models.ShedApp) {
+		key := store.AppKey(shedApp.AppGuid, shedApp.AppVersion)
+		shedApps[key] = append(shedApps[key], shedApp)
+	}
+	return shedApps, err
+}
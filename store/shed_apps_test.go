@@ -0,0 +1,98 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Shedding heartbeats", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+		dea          appfixture.DeaFixture
+		priorityApp  appfixture.AppFixture
+		sheddableApp appfixture.AppFixture
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		dea = appfixture.NewDeaFixture()
+		priorityApp = dea.GetApp(0)
+		sheddableApp = dea.GetApp(1)
+
+		err := store.SyncHeartbeats(dea.HeartbeatWith(
+			priorityApp.InstanceAtIndex(0).Heartbeat(),
+			sheddableApp.InstanceAtIndex(0).Heartbeat(),
+		))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Context("when the listener sheds the heartbeats of apps off the priority list", func() {
+		var evacuating models.InstanceHeartbeat
+
+		BeforeEach(func() {
+			evacuating = priorityApp.InstanceAtIndex(0).Heartbeat()
+			evacuating.State = models.InstanceStateEvacuating
+
+			err := store.SyncHeartbeatsShedding(map[string]bool{priorityApp.AppGuid: true}, dea.HeartbeatWith(
+				evacuating,
+				priorityApp.InstanceAtIndex(1).Heartbeat(),
+				sheddableApp.InstanceAtIndex(1).Heartbeat(),
+				sheddableApp.InstanceAtIndex(2).Heartbeat(),
+			))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fully sync the instances of the priority apps", func() {
+			results, err := store.GetInstanceHeartbeatsForApp(priorityApp.AppGuid, priorityApp.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(results).Should(HaveLen(2))
+			Ω(results).Should(ContainElement(evacuating))
+			Ω(results).Should(ContainElement(priorityApp.InstanceAtIndex(1).Heartbeat()))
+		})
+
+		It("should leave the stored instances of every other app alone", func() {
+			results, err := store.GetInstanceHeartbeatsForApp(sheddableApp.AppGuid, sheddableApp.AppVersion)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(results).Should(ConsistOf(sheddableApp.InstanceAtIndex(0).Heartbeat()))
+		})
+
+		It("should record how many instances of the other apps were shed, expiring with the heartbeat", func() {
+			shedApps, err := store.GetShedApps()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(shedApps).Should(Equal(map[string][]models.ShedApp{
+				store.AppKey(sheddableApp.AppGuid, sheddableApp.AppVersion): {
+					{
+						AppGuid:    sheddableApp.AppGuid,
+						AppVersion: sheddableApp.AppVersion,
+						DeaGuid:    dea.DeaGuid,
+						Instances:  2,
+						States:     map[models.InstanceState]int{models.InstanceStateRunning: 2},
+					},
+				},
+			}))
+
+			node, err := storeAdapter.Get("/hm/v1/apps/shed/" + sheddableApp.AppGuid + "," + sheddableApp.AppVersion + "," + dea.DeaGuid)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(Equal(conf.InstanceMissingGracePeriod()))
+		})
+	})
+
+	Context("when nothing has been shed", func() {
+		It("should return no shed apps", func() {
+			shedApps, err := store.GetShedApps()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(shedApps).Should(BeEmpty())
+		})
+	})
+})
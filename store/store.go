@@ -3,6 +3,7 @@ package store
 import (
 	"errors"
 	"fmt"
+	"github.com/cloudfoundry/gunk/timeprovider"
 	"github.com/cloudfoundry/hm9000/config"
 	"github.com/cloudfoundry/hm9000/helpers/logger"
 	"github.com/cloudfoundry/hm9000/models"
@@ -16,6 +17,7 @@ import (
 var ActualIsNotFreshError = errors.New("Actual state is not fresh")
 var DesiredIsNotFreshError = errors.New("Desired state is not fresh")
 var ActualAndDesiredAreNotFreshError = errors.New("Actual and desired state are not fresh")
+var AppSummariesAreNotFreshError = errors.New("App summaries are not fresh")
 var AppNotFoundError = errors.New("App not found")
 
 type Storeable interface {
@@ -27,6 +29,9 @@ type Store interface {
 	BumpDesiredFreshness(timestamp time.Time) error
 	BumpActualFreshness(timestamp time.Time) error
 	RevokeActualFreshness() error
+	RevokeDesiredFreshness() error
+	NewActualFreshnessLease(timeProvider timeprovider.TimeProvider) *FreshnessLease
+	NewDesiredFreshnessLease(timeProvider timeprovider.TimeProvider) *FreshnessLease
 
 	IsDesiredStateFresh() (bool, error)
 	IsActualStateFresh(time.Time) (bool, error)
@@ -39,25 +44,99 @@ type Store interface {
 
 	SyncDesiredState(desiredStates ...models.DesiredAppState) error
 	GetDesiredState() (map[string]models.DesiredAppState, error)
+	GetUndesiredApps() (map[string]int, error)
+	BeginDesiredStateSync(timestamp time.Time) error
+	EndDesiredStateSync(timestamp time.Time) error
+	IsDesiredStateSyncInProgress() (bool, error)
 
 	SyncHeartbeats(heartbeat ...models.Heartbeat) error
 	GetInstanceHeartbeats() (results []models.InstanceHeartbeat, err error)
 	GetInstanceHeartbeatsForApp(appGuid string, appVersion string) (results []models.InstanceHeartbeat, err error)
+	GetInstanceTransitions() (map[string]models.InstanceTransitions, error)
+	SyncHeartbeatsShedding(priorityApps map[string]bool, heartbeats ...models.Heartbeat) error
+	GetShedApps() (map[string][]models.ShedApp, error)
+	SyncHeartbeatsSampling(sampledDeas map[string]bool, heartbeats ...models.Heartbeat) error
+	GetDeaSummaries() (map[string]models.DeaSummary, error)
+	GetAppFreshness() (map[string]models.AppFreshness, error)
+	GetPresentDeas() (map[string]bool, error)
 
 	SaveCrashCounts(crashCounts ...models.CrashCount) error
+	ResetCrashCounts(appGuid string, appVersion string, indices []int, currentTime time.Time) (reset []models.CrashCount, rescheduled []models.PendingStartMessage, err error)
+
+	EnqueuePendingMessages(startMessages []models.PendingStartMessage, stopMessages []models.PendingStopMessage) (EnqueueResult, error)
 
 	SavePendingStartMessages(startMessages ...models.PendingStartMessage) error
+	EnqueuePendingStartMessages(startMessages ...models.PendingStartMessage) (deduplicated []models.PendingStartMessage, err error)
 	GetPendingStartMessages() (map[string]models.PendingStartMessage, error)
 	DeletePendingStartMessages(startMessages ...models.PendingStartMessage) error
 
 	SavePendingStopMessages(stopMessages ...models.PendingStopMessage) error
+	EnqueuePendingStopMessages(stopMessages ...models.PendingStopMessage) (deduplicated []models.PendingStopMessage, err error)
 	GetPendingStopMessages() (map[string]models.PendingStopMessage, error)
 	DeletePendingStopMessages(stopMessages ...models.PendingStopMessage) error
 
 	SaveMetric(metric string, value float64) error
 	GetMetric(metric string) (float64, error)
+	SaveInstanceMetric(metric string, instance string, value float64) error
+	GetInstanceMetrics(metric string) (map[string]float64, error)
+
+	GetLeader(component string) (string, error)
+
+	Lock(name string, owner string, ttl time.Duration, now time.Time) (Lock, error)
+	RefreshLock(lock Lock, now time.Time) (Lock, error)
+	Unlock(lock Lock) error
+	CheckLock(lock Lock, now time.Time) error
+	GetLock(name string) (Lock, error)
+
+	SaveComponentRun(run models.ComponentRun) error
+	GetComponentRuns() (map[string]models.ComponentRun, error)
+
+	SaveComponentControl(control models.ComponentControl) error
+	GetComponentControls() (map[string]models.ComponentControl, error)
+
+	RecordRestarts(now time.Time, starts ...models.PendingStartMessage) error
+	GetRestartHistories() (map[string]models.RestartHistory, error)
+	SaveRestartReport(report models.RestartReport) error
+	GetRestartReport() (models.RestartReport, error)
+	SaveAnalysisReport(report models.AnalysisReport) error
+	GetAnalysisReport() (models.AnalysisReport, error)
+
+	SaveAwaitedStarts(starts ...models.AwaitedStart) error
+	GetAwaitedStarts() (map[string]models.AwaitedStart, error)
+	DeleteAwaitedStarts(starts ...models.AwaitedStart) error
+
+	RecordAppEvents(now time.Time, events ...models.AppEvent) error
+	GetAppHistory(appGuid string) (models.AppHistory, error)
+	CompactCrashHistory(now time.Time) (CrashCompactionStats, error)
+	GetCrashTrend(appGuid string) (models.CrashTrend, error)
+
+	SyncDeaZones(now time.Time, heartbeats []models.Heartbeat, advertisements []models.DeaAdvertisement) error
+	GetDeaZones() (models.DeaZones, error)
+
+	ScheduleDeaShutdowns(now time.Time, deaGuids ...string) error
+	GetScheduledDeaShutdowns() (map[string]models.ScheduledDeaShutdown, error)
+
+	SaveSuppressedStarts(starts ...models.SuppressedStart) error
+	GetSuppressedStarts() (map[string]models.SuppressedStart, error)
+
+	SaveCrashReasons(reasons ...models.CrashReason) error
+	GetCrashReasonsForApp(appGuid string, appVersion string) ([]models.CrashReason, error)
+
+	SyncAppSummaries(summaries ...models.AppSummary) (saved int, deleted int, err error)
+	GetAppSummaries() (map[string]models.AppSummary, error)
+	GetAppSummary(appGuid string, appVersion string) (models.AppSummary, error)
+	SaveAppSummaries(summaries ...models.AppSummary) error
+	DeleteAppSummaries(summaries ...models.AppSummary) error
+	BumpAppSummariesFreshness(timestamp time.Time) error
+	AreAppSummariesFresh() (bool, error)
+
+	GetDesiredFreshness() (Freshness, error)
+	GetActualFreshness() (Freshness, error)
+	GetDesiredLastFresh() (time.Time, error)
+	GetActualLastFresh() (time.Time, error)
 
 	Compact() error
+	CompactHoldingLock(lock Lock, now func() time.Time) error
 }
 
 type RealStore struct {
@@ -66,8 +145,17 @@ type RealStore struct {
 	logger  logger.Logger
 
 	instanceHeartbeatCache          map[string]models.InstanceHeartbeat
+	instanceTransitionsCache        map[string]models.InstanceTransitions
 	instanceHeartbeatCacheMutex     *sync.Mutex
 	instanceHeartbeatCacheTimestamp time.Time
+
+	// appFreshnessCache is the freshness of each app as last written.
+	appFreshnessCache map[string]models.AppFreshness
+
+	// appsToResummarize are the apps whose instances left the instance
+	// heartbeat cache when it was last refreshed, by app key, for the next
+	// heartbeat sync to resummarize.
+	appsToResummarize map[string]models.AppSummary
 }
 
 func NewStore(config *config.Config, adapter storeadapter.StoreAdapter, logger logger.Logger) *RealStore {
@@ -76,8 +164,11 @@ func NewStore(config *config.Config, adapter storeadapter.StoreAdapter, logger l
 		adapter:                         adapter,
 		logger:                          logger,
 		instanceHeartbeatCache:          map[string]models.InstanceHeartbeat{},
+		instanceTransitionsCache:        map[string]models.InstanceTransitions{},
 		instanceHeartbeatCacheMutex:     &sync.Mutex{},
 		instanceHeartbeatCacheTimestamp: time.Unix(0, 0),
+		appFreshnessCache:               map[string]models.AppFreshness{},
+		appsToResummarize:               map[string]models.AppSummary{},
 	}
 }
 
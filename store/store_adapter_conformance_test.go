@@ -0,0 +1,13 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/testhelpers/storeadapterconformance"
+	"github.com/cloudfoundry/storeadapter"
+	. "github.com/onsi/ginkgo"
+)
+
+var _ = Describe("ETCDStoreAdapter", func() {
+	storeadapterconformance.ItBehavesLikeAStoreAdapter(func() storeadapter.StoreAdapter {
+		return etcdRunner.Adapter()
+	})
+})
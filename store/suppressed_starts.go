@@ -0,0 +1,32 @@
+package store
+
+import (
+	"reflect"
+
+	"github.com/cloudfoundry/hm9000/models"
+)
+
+// The starts the analyzer held back during maintenance windows each have a
+// key, which expires maintenance_suppressed_starts_ttl_in_seconds after the
+// start was last held back:
+//
+//	/suppressed-starts/<guid>,<version>,<index>
+
+func (store *RealStore) suppressedStartsRoot() string {
+	return store.SchemaRoot() + "/suppressed-starts"
+}
+
+// SaveSuppressedStarts records the starts held back, renewing the TTL of
+// those held back before.
+func (store *RealStore) SaveSuppressedStarts(starts ...models.SuppressedStart) error {
+	if len(starts) == 0 {
+		return nil
+	}
+	return store.save(starts, store.suppressedStartsRoot(), uint64(store.config.MaintenanceSuppressedStartsTTL().Seconds()))
+}
+
+// GetSuppressedStarts returns the starts held back, by store key.
+func (store *RealStore) GetSuppressedStarts() (map[string]models.SuppressedStart, error) {
+	starts, err := store.get(store.suppressedStartsRoot(), reflect.TypeOf(map[string]models.SuppressedStart{}), reflect.ValueOf(models.NewSuppressedStartFromJSON))
+	return starts.Interface().(map[string]models.SuppressedStart), err
+}
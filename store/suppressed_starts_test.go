@@ -0,0 +1,53 @@
+package store_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Suppressed starts", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		suppressed   models.SuppressedStart
+	)
+
+	BeforeEach(func() {
+		conf, _ := config.DefaultConfig()
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		start := models.NewPendingStartMessage(time.Unix(100, 0), 0, 0, "app", "v", 1, 1.0, models.PendingStartMessageReasonMissing)
+		suppressed = models.NewSuppressedStart(start, "patching", time.Unix(100, 0))
+	})
+
+	It("records the starts held back", func() {
+		err := store.SaveSuppressedStarts(suppressed)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		starts, err := store.GetSuppressedStarts()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(starts).Should(Equal(map[string]models.SuppressedStart{"app,v,1": suppressed}))
+	})
+
+	It("expires them after the suppressed starts TTL", func() {
+		store.SaveSuppressedStarts(suppressed)
+
+		node, err := storeAdapter.Get("/hm/v1/suppressed-starts/app,v,1")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(node.TTL).Should(BeNumerically("==", 7*24*60*60))
+	})
+
+	It("returns none when none were held back", func() {
+		starts, err := store.GetSuppressedStarts()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(starts).Should(BeEmpty())
+	})
+})
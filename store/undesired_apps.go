@@ -0,0 +1,92 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/storeadapter"
+)
+
+// While stopped_app_requires_two_syncs is set, each desired state sync
+// counts, for the apps that have left the desired state, how many syncs in a
+// row they have been missing from, up to 2:
+//
+//	/apps/undesired/<guid>,<version>
+//
+// The count is rewritten only while it grows, and so expires two desired
+// freshness TTLs after it reaches 2; an app with no count has been gone for
+// long enough to be stopped.
+
+const confirmingSyncs = 2
+
+func (store *RealStore) undesiredAppsRoot() string {
+	return store.SchemaRoot() + "/apps/undesired"
+}
+
+func (store *RealStore) syncUndesiredApps(currentDesiredStates map[string]models.DesiredAppState, newDesiredStateKeys map[string]bool) error {
+	if !store.config.StoppedAppRequiresTwoSyncs {
+		return nil
+	}
+
+	undesiredApps, err := store.GetUndesiredApps()
+	if err != nil {
+		return err
+	}
+
+	ttl := 2 * store.config.DesiredFreshnessTTL()
+	nodesToSave := []storeadapter.StoreNode{}
+	keysToDelete := []string{}
+
+	for key, syncs := range undesiredApps {
+		if newDesiredStateKeys[key] {
+			keysToDelete = append(keysToDelete, store.undesiredAppsRoot()+"/"+key)
+		} else if syncs < confirmingSyncs {
+			nodesToSave = append(nodesToSave, store.undesiredAppNode(key, syncs+1, ttl))
+		}
+	}
+
+	for key := range currentDesiredStates {
+		if _, counted := undesiredApps[key]; !counted && !newDesiredStateKeys[key] {
+			nodesToSave = append(nodesToSave, store.undesiredAppNode(key, 1, ttl))
+		}
+	}
+
+	err = store.adapter.SetMulti(nodesToSave)
+	if err != nil {
+		return err
+	}
+	return store.adapter.Delete(keysToDelete...)
+}
+
+func (store *RealStore) undesiredAppNode(key string, syncs int, ttl uint64) storeadapter.StoreNode {
+	return storeadapter.StoreNode{
+		Key:   store.undesiredAppsRoot() + "/" + key,
+		Value: []byte(strconv.Itoa(syncs)),
+		TTL:   ttl,
+	}
+}
+
+// GetUndesiredApps returns, by app key, how many desired state syncs in a row
+// each app that recently left the desired state has been missing from.
+func (store *RealStore) GetUndesiredApps() (map[string]int, error) {
+	results := map[string]int{}
+
+	node, err := store.adapter.ListRecursively(store.undesiredAppsRoot())
+	if err == storeadapter.ErrorKeyNotFound {
+		return results, nil
+	} else if err != nil {
+		return results, err
+	}
+
+	for _, undesiredNode := range node.ChildNodes {
+		components := strings.Split(undesiredNode.Key, "/")
+		syncs, err := strconv.Atoi(string(undesiredNode.Value))
+		if err != nil {
+			return map[string]int{}, err
+		}
+		results[components[len(components)-1]] = syncs
+	}
+
+	return results, nil
+}
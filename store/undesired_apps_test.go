@@ -0,0 +1,83 @@
+package store_test
+
+import (
+	"github.com/cloudfoundry/hm9000/config"
+	. "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Undesired apps", func() {
+	var (
+		store        Store
+		storeAdapter *fakestoreadapter.FakeStoreAdapter
+		conf         *config.Config
+		app1         appfixture.AppFixture
+		app2         appfixture.AppFixture
+	)
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		conf.StoppedAppRequiresTwoSyncs = true
+		storeAdapter = fakestoreadapter.New()
+		store = NewStore(conf, storeAdapter, fakelogger.NewFakeLogger())
+
+		app1 = appfixture.NewAppFixture()
+		app2 = appfixture.NewAppFixture()
+
+		Ω(store.SyncDesiredState(app1.DesiredState(1), app2.DesiredState(1))).Should(Succeed())
+	})
+
+	It("should count nothing while every app is desired", func() {
+		Ω(store.GetUndesiredApps()).Should(BeEmpty())
+	})
+
+	Context("when an app leaves the desired state", func() {
+		BeforeEach(func() {
+			Ω(store.SyncDesiredState(app1.DesiredState(1))).Should(Succeed())
+		})
+
+		It("should count the sync it left in", func() {
+			Ω(store.GetUndesiredApps()).Should(Equal(map[string]int{
+				store.AppKey(app2.AppGuid, app2.AppVersion): 1,
+			}))
+		})
+
+		It("should keep the count for two desired freshness TTLs", func() {
+			node, err := storeAdapter.Get("/hm/v1/apps/undesired/" + store.AppKey(app2.AppGuid, app2.AppVersion))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(node.TTL).Should(Equal(2 * conf.DesiredFreshnessTTL()))
+		})
+
+		It("should count each further sync it is missing from, up to two", func() {
+			Ω(store.SyncDesiredState(app1.DesiredState(1))).Should(Succeed())
+			Ω(store.GetUndesiredApps()).Should(Equal(map[string]int{
+				store.AppKey(app2.AppGuid, app2.AppVersion): 2,
+			}))
+
+			Ω(store.SyncDesiredState(app1.DesiredState(1))).Should(Succeed())
+			Ω(store.GetUndesiredApps()).Should(Equal(map[string]int{
+				store.AppKey(app2.AppGuid, app2.AppVersion): 2,
+			}))
+		})
+
+		It("should forget the count when the app comes back", func() {
+			Ω(store.SyncDesiredState(app1.DesiredState(1), app2.DesiredState(1))).Should(Succeed())
+			Ω(store.GetUndesiredApps()).Should(BeEmpty())
+		})
+	})
+
+	Context("when the apps are not required to stay stopped across two syncs", func() {
+		BeforeEach(func() {
+			conf.StoppedAppRequiresTwoSyncs = false
+		})
+
+		It("should count nothing", func() {
+			Ω(store.SyncDesiredState(app1.DesiredState(1))).Should(Succeed())
+			Ω(store.GetUndesiredApps()).Should(BeEmpty())
+		})
+	})
+})
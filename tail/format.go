@@ -0,0 +1,39 @@
+package tail
+
+import (
+	"fmt"
+)
+
+const (
+	colorReset   = "\033[0m"
+	colorRed     = "\033[31m"
+	colorGreen   = "\033[32m"
+	colorYellow  = "\033[33m"
+	colorMagenta = "\033[35m"
+	colorCyan    = "\033[36m"
+	colorGray    = "\033[90m"
+)
+
+var kindColors = map[Kind]string{
+	KindFreshness: colorCyan,
+	KindInstance:  colorGray,
+	KindExited:    colorMagenta,
+	KindDecision:  colorYellow,
+	KindStartSent: colorGreen,
+	KindStopSent:  colorRed,
+}
+
+// Format renders event as one line: its time, kind, app and description,
+// colored by kind for a terminal when color is true.
+func Format(event Event, color bool) string {
+	app := "-"
+	if event.AppGuid != "" {
+		app = event.AppGuid + "," + event.AppVersion
+	}
+
+	line := fmt.Sprintf("%s %-9s %s %s", event.Time.Format("15:04:05"), event.Kind, app, event.Description)
+	if !color {
+		return line
+	}
+	return kindColors[event.Kind] + line + colorReset
+}
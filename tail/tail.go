@@ -0,0 +1,291 @@
+// Package tail follows what hm9000 sees and does as it happens, for an
+// operator watching it work: the DEAs' instances and exits and the starts and
+// stops the sender publishes, from NATS, and the freshness of the store and
+// the analyzer's decisions, by polling the store.
+package tail
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/gunk/timeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
+)
+
+type Kind string
+
+const (
+	KindFreshness Kind = "freshness"
+	KindInstance  Kind = "instance"
+	KindExited    Kind = "exited"
+	KindDecision  Kind = "decision"
+	KindStartSent Kind = "start"
+	KindStopSent  Kind = "stop"
+)
+
+// Event is one thing that happened.  AppGuid and AppVersion are empty for
+// events, such as freshness changes, that are about no one app.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Kind        Kind      `json:"kind"`
+	AppGuid     string    `json:"droplet,omitempty"`
+	AppVersion  string    `json:"version,omitempty"`
+	Description string    `json:"description"`
+}
+
+// Tailer turns what it hears and polls into Events, which it hands to
+// onEvent one at a time.  With an app guid it only emits the events of that
+// app and those about no one app.
+type Tailer struct {
+	messageBus   messagebus.MessageBus
+	store        store.Store
+	timeProvider timeprovider.TimeProvider
+	conf         *config.Config
+	appGuid      string
+	onEvent      func(Event)
+
+	lock           sync.Mutex
+	subscriptions  []*nats.Subscription
+	polled         bool
+	actualFresh    bool
+	desiredFresh   bool
+	pendingStarts  map[string]bool
+	pendingStops   map[string]bool
+	instanceStates map[string]models.InstanceState
+}
+
+func New(messageBus messagebus.MessageBus, store store.Store, timeProvider timeprovider.TimeProvider, conf *config.Config, appGuid string, onEvent func(Event)) *Tailer {
+	return &Tailer{
+		messageBus:     messageBus,
+		store:          store,
+		timeProvider:   timeProvider,
+		conf:           conf,
+		appGuid:        appGuid,
+		onEvent:        onEvent,
+		pendingStarts:  map[string]bool{},
+		pendingStops:   map[string]bool{},
+		instanceStates: map[string]models.InstanceState{},
+	}
+}
+
+// Subscribe listens for heartbeats, exits and the sender's starts and stops.
+// It subscribes outside any queue group, so that it takes no messages from
+// the listener or the evacuator.
+func (tailer *Tailer) Subscribe() error {
+	handlers := map[string]func([]byte){
+		"dea.heartbeat":                    tailer.heard,
+		"droplet.exited":                   tailer.exited,
+		tailer.conf.SenderNatsStartSubject: tailer.sentStart,
+		tailer.conf.SenderNatsStopSubject:  tailer.sentStop,
+	}
+
+	subjects := []string{}
+	for subject := range handlers {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+
+	for _, subject := range subjects {
+		handler := handlers[subject]
+		subscription, err := tailer.messageBus.Subscribe(subject, func(message *nats.Msg) {
+			handler(message.Data)
+		})
+		if err != nil {
+			tailer.Unsubscribe()
+			return err
+		}
+		tailer.subscriptions = append(tailer.subscriptions, subscription)
+	}
+	return nil
+}
+
+func (tailer *Tailer) Unsubscribe() {
+	for _, subscription := range tailer.subscriptions {
+		tailer.messageBus.Unsubscribe(subscription)
+	}
+	tailer.subscriptions = nil
+}
+
+// Poll reads the freshness and the pending messages from the store, and
+// emits what changed since the last poll.  The first poll emits the
+// freshness, but not the messages already pending.
+func (tailer *Tailer) Poll() error {
+	now := tailer.timeProvider.Time()
+
+	actualFresh, err := tailer.store.IsActualStateFresh(now)
+	if err != nil {
+		return err
+	}
+	desiredFresh, err := tailer.store.IsDesiredStateFresh()
+	if err != nil {
+		return err
+	}
+	starts, err := tailer.store.GetPendingStartMessages()
+	if err != nil {
+		return err
+	}
+	stops, err := tailer.store.GetPendingStopMessages()
+	if err != nil {
+		return err
+	}
+
+	tailer.lock.Lock()
+	defer tailer.lock.Unlock()
+
+	if !tailer.polled || actualFresh != tailer.actualFresh {
+		tailer.emitLocked(Event{Time: now, Kind: KindFreshness, Description: "actual state is " + describeFreshness(actualFresh)})
+	}
+	if !tailer.polled || desiredFresh != tailer.desiredFresh {
+		tailer.emitLocked(Event{Time: now, Kind: KindFreshness, Description: "desired state is " + describeFreshness(desiredFresh)})
+	}
+	tailer.actualFresh = actualFresh
+	tailer.desiredFresh = desiredFresh
+
+	pendingStarts := map[string]bool{}
+	for _, start := range models.SortStartMessagesByPriority(starts) {
+		pendingStarts[start.StoreKey()] = true
+		if tailer.polled && !tailer.pendingStarts[start.StoreKey()] {
+			tailer.emitLocked(Event{
+				Time:        now,
+				Kind:        KindDecision,
+				AppGuid:     start.AppGuid,
+				AppVersion:  start.AppVersion,
+				Description: fmt.Sprintf("start index %d (%s), priority %.2f, %s", start.IndexToStart, start.StartReason, start.Priority, describeSendOn(start.SendOn, now)),
+			})
+		}
+	}
+
+	stopKeys := []string{}
+	for key := range stops {
+		stopKeys = append(stopKeys, key)
+	}
+	sort.Strings(stopKeys)
+
+	pendingStops := map[string]bool{}
+	for _, key := range stopKeys {
+		stop := stops[key]
+		pendingStops[key] = true
+		if tailer.polled && !tailer.pendingStops[key] {
+			tailer.emitLocked(Event{
+				Time:        now,
+				Kind:        KindDecision,
+				AppGuid:     stop.AppGuid,
+				AppVersion:  stop.AppVersion,
+				Description: fmt.Sprintf("stop instance %s (%s), %s", stop.InstanceGuid, stop.StopReason, describeSendOn(stop.SendOn, now)),
+			})
+		}
+	}
+
+	tailer.pendingStarts = pendingStarts
+	tailer.pendingStops = pendingStops
+	tailer.polled = true
+	return nil
+}
+
+// heard emits the instances of a heartbeat that are new or whose state
+// changed.  It only follows instances when tailing one app, to keep from
+// emitting every instance of every DEA.
+func (tailer *Tailer) heard(data []byte) {
+	if tailer.appGuid == "" {
+		return
+	}
+
+	heartbeat, err := models.NewHeartbeatFromJSON(data)
+	if err != nil {
+		return
+	}
+
+	tailer.lock.Lock()
+	defer tailer.lock.Unlock()
+
+	for _, instance := range heartbeat.InstanceHeartbeats {
+		if instance.AppGuid != tailer.appGuid || tailer.instanceStates[instance.InstanceGuid] == instance.State {
+			continue
+		}
+		tailer.instanceStates[instance.InstanceGuid] = instance.State
+		tailer.emitLocked(Event{
+			Time:        tailer.timeProvider.Time(),
+			Kind:        KindInstance,
+			AppGuid:     instance.AppGuid,
+			AppVersion:  instance.AppVersion,
+			Description: fmt.Sprintf("index %d %s on %s (instance %s)", instance.InstanceIndex, instance.State, heartbeat.DeaGuid, instance.InstanceGuid),
+		})
+	}
+}
+
+func (tailer *Tailer) exited(data []byte) {
+	exited, err := models.NewDropletExitedFromJSON(data)
+	if err != nil {
+		return
+	}
+
+	tailer.emit(Event{
+		Kind:        KindExited,
+		AppGuid:     exited.AppGuid,
+		AppVersion:  exited.AppVersion,
+		Description: fmt.Sprintf("index %d exited (%s, status %d) instance %s", exited.InstanceIndex, exited.Reason, exited.ExitStatusCode, exited.InstanceGuid),
+	})
+}
+
+func (tailer *Tailer) sentStart(data []byte) {
+	start, err := models.NewStartMessageFromJSON(data)
+	if err != nil {
+		return
+	}
+
+	tailer.emit(Event{
+		Kind:        KindStartSent,
+		AppGuid:     start.AppGuid,
+		AppVersion:  start.AppVersion,
+		Description: fmt.Sprintf("sent start of index %d (%s)", start.InstanceIndex, start.Reason),
+	})
+}
+
+func (tailer *Tailer) sentStop(data []byte) {
+	stop, err := models.NewStopMessageFromJSON(data)
+	if err != nil {
+		return
+	}
+
+	tailer.emit(Event{
+		Kind:        KindStopSent,
+		AppGuid:     stop.AppGuid,
+		AppVersion:  stop.AppVersion,
+		Description: fmt.Sprintf("sent stop of index %d, instance %s (%s)", stop.InstanceIndex, stop.InstanceGuid, stop.Reason),
+	})
+}
+
+func (tailer *Tailer) emit(event Event) {
+	tailer.lock.Lock()
+	defer tailer.lock.Unlock()
+	event.Time = tailer.timeProvider.Time()
+	tailer.emitLocked(event)
+}
+
+func (tailer *Tailer) emitLocked(event Event) {
+	if tailer.appGuid != "" && event.AppGuid != "" && event.AppGuid != tailer.appGuid {
+		return
+	}
+	tailer.onEvent(event)
+}
+
+func describeFreshness(fresh bool) string {
+	if fresh {
+		return "fresh"
+	}
+	return "NOT fresh"
+}
+
+func describeSendOn(sendOn int64, now time.Time) string {
+	delay := time.Unix(sendOn, 0).Sub(now)
+	if delay <= 0 {
+		return "to send now"
+	}
+	return "to send in " + delay.String()
+}
@@ -0,0 +1,13 @@
+package tail_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTail(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tail Suite")
+}
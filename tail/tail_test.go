@@ -0,0 +1,186 @@
+package tail_test
+
+import (
+	"time"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	. "github.com/cloudfoundry/hm9000/tail"
+	"github.com/cloudfoundry/hm9000/testhelpers/appfixture"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tail", func() {
+	var (
+		conf         *config.Config
+		messageBus   *fakeyagnats.FakeNATSConn
+		store        storepackage.Store
+		timeProvider *faketimeprovider.FakeTimeProvider
+		app          appfixture.AppFixture
+		otherApp     appfixture.AppFixture
+		events       []Event
+	)
+
+	newTailer := func(appGuid string) *Tailer {
+		tailer := New(messageBus, store, timeProvider, conf, appGuid, func(event Event) {
+			events = append(events, event)
+		})
+		err := tailer.Subscribe()
+		Ω(err).ShouldNot(HaveOccurred())
+		return tailer
+	}
+
+	publish := func(subject string, data []byte) {
+		for _, callback := range messageBus.SubjectCallbacks(subject) {
+			callback(&nats.Msg{Subject: subject, Data: data})
+		}
+	}
+
+	descriptions := func(kind Kind) []string {
+		result := []string{}
+		for _, event := range events {
+			if event.Kind == kind {
+				result = append(result, event.Description)
+			}
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		conf, _ = config.DefaultConfig()
+		messageBus = fakeyagnats.Connect()
+		store = storepackage.NewStore(conf, fakestoreadapter.New(), fakelogger.NewFakeLogger())
+		timeProvider = &faketimeprovider.FakeTimeProvider{TimeToProvide: time.Unix(1000, 0)}
+		app = appfixture.NewAppFixture()
+		otherApp = appfixture.NewAppFixture()
+		events = []Event{}
+	})
+
+	It("subscribes outside any queue group", func() {
+		newTailer("")
+		for _, subject := range []string{"dea.heartbeat", "droplet.exited", conf.SenderNatsStartSubject, conf.SenderNatsStopSubject} {
+			Ω(messageBus.Subscriptions(subject)).Should(HaveLen(1))
+			Ω(messageBus.Subscriptions(subject)[0].Queue).Should(BeEmpty())
+		}
+	})
+
+	It("unsubscribes", func() {
+		newTailer("").Unsubscribe()
+		Ω(messageBus.Subscriptions("dea.heartbeat")).Should(BeEmpty())
+	})
+
+	Describe("polling the store", func() {
+		var tailer *Tailer
+
+		BeforeEach(func() {
+			tailer = newTailer("")
+			store.BumpActualFreshness(time.Unix(100, 0))
+			store.SavePendingStartMessages(models.NewPendingStartMessage(time.Unix(1000, 0), 0, 0, app.AppGuid, app.AppVersion, 0, 1.0, models.PendingStartMessageReasonMissing))
+
+			err := tailer.Poll()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("emits the freshness on the first poll, but not the messages already pending", func() {
+			Ω(descriptions(KindFreshness)).Should(Equal([]string{"actual state is fresh", "desired state is NOT fresh"}))
+			Ω(descriptions(KindDecision)).Should(BeEmpty())
+		})
+
+		It("emits freshness changes and new pending messages", func() {
+			events = []Event{}
+			store.BumpDesiredFreshness(time.Unix(1000, 0))
+			store.SavePendingStartMessages(models.NewPendingStartMessage(time.Unix(1000, 0), 30, 0, app.AppGuid, app.AppVersion, 2, 1.0, models.PendingStartMessageReasonCrashed))
+			store.SavePendingStopMessages(models.NewPendingStopMessage(time.Unix(1000, 0), 0, 0, otherApp.AppGuid, otherApp.AppVersion, "instance-guid", models.PendingStopMessageReasonExtra))
+
+			err := tailer.Poll()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(descriptions(KindFreshness)).Should(Equal([]string{"desired state is fresh"}))
+			Ω(descriptions(KindDecision)).Should(ConsistOf(
+				"start index 2 (CRASHED), priority 1.00, to send in 30s",
+				"stop instance instance-guid (EXTRA), to send now",
+			))
+		})
+
+		It("emits nothing when nothing changed", func() {
+			events = []Event{}
+			tailer.Poll()
+			Ω(events).Should(BeEmpty())
+		})
+	})
+
+	Describe("listening", func() {
+		It("emits exits and the messages the sender sends", func() {
+			newTailer("")
+			publish("droplet.exited", app.InstanceAtIndex(1).DropletExited(models.DropletExitedReasonCrashed).ToJSON())
+			publish(conf.SenderNatsStartSubject, models.StartMessage{AppGuid: app.AppGuid, AppVersion: app.AppVersion, InstanceIndex: 1, Reason: "crashed"}.ToJSON())
+			publish(conf.SenderNatsStopSubject, models.StopMessage{AppGuid: app.AppGuid, AppVersion: app.AppVersion, InstanceGuid: "instance-guid", InstanceIndex: 3, Reason: "extra"}.ToJSON())
+
+			Ω(events).Should(HaveLen(3))
+			Ω(events[0].Kind).Should(Equal(KindExited))
+			Ω(events[0].AppGuid).Should(Equal(app.AppGuid))
+			Ω(events[0].Time).Should(Equal(time.Unix(1000, 0)))
+			Ω(descriptions(KindStartSent)).Should(Equal([]string{"sent start of index 1 (crashed)"}))
+			Ω(descriptions(KindStopSent)).Should(Equal([]string{"sent stop of index 3, instance instance-guid (extra)"}))
+		})
+
+		It("ignores what it cannot decode", func() {
+			newTailer("")
+			publish("droplet.exited", []byte("ß"))
+			publish(conf.SenderNatsStartSubject, []byte("ß"))
+			Ω(events).Should(BeEmpty())
+		})
+
+		It("ignores heartbeats unless tailing an app", func() {
+			newTailer("")
+			publish("dea.heartbeat", app.Heartbeat(1).ToJSON())
+			Ω(events).Should(BeEmpty())
+		})
+	})
+
+	Context("when tailing an app", func() {
+		BeforeEach(func() {
+			newTailer(app.AppGuid)
+		})
+
+		It("only emits that app's events", func() {
+			publish(conf.SenderNatsStartSubject, models.StartMessage{AppGuid: otherApp.AppGuid, AppVersion: otherApp.AppVersion}.ToJSON())
+			publish(conf.SenderNatsStartSubject, models.StartMessage{AppGuid: app.AppGuid, AppVersion: app.AppVersion}.ToJSON())
+
+			Ω(events).Should(HaveLen(1))
+			Ω(events[0].AppGuid).Should(Equal(app.AppGuid))
+		})
+
+		It("emits the app's instances when they are new or change state", func() {
+			heartbeat := app.Heartbeat(2)
+			publish("dea.heartbeat", heartbeat.ToJSON())
+			publish("dea.heartbeat", heartbeat.ToJSON())
+			Ω(descriptions(KindInstance)).Should(HaveLen(2))
+
+			heartbeat.InstanceHeartbeats[1].State = models.InstanceStateCrashed
+			publish("dea.heartbeat", heartbeat.ToJSON())
+			Ω(descriptions(KindInstance)).Should(HaveLen(3))
+			Ω(descriptions(KindInstance)[2]).Should(ContainSubstring("index 1 CRASHED on " + heartbeat.DeaGuid))
+		})
+	})
+
+	Describe("Format", func() {
+		event := Event{Time: time.Date(2014, 1, 1, 12, 30, 5, 0, time.UTC), Kind: KindStartSent, AppGuid: "app", AppVersion: "v", Description: "sent start of index 1"}
+
+		It("renders an event as a line", func() {
+			Ω(Format(event, false)).Should(Equal("12:30:05 start     app,v sent start of index 1"))
+			Ω(Format(Event{Time: event.Time, Kind: KindFreshness, Description: "actual state is fresh"}, false)).Should(Equal("12:30:05 freshness - actual state is fresh"))
+		})
+
+		It("colors it by kind", func() {
+			Ω(Format(event, true)).Should(Equal("\033[32m12:30:05 start     app,v sent start of index 1\033[0m"))
+		})
+	})
+})
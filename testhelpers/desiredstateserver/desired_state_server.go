@@ -42,6 +42,10 @@ func (server *DesiredStateServer) SpinUp(port int) {
 	})
 
 	http.HandleFunc("/bulk/counts", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("model") == "app" {
+			fmt.Fprintf(w, `{"counts":{"app":%d}}`, len(server.Apps))
+			return
+		}
 		fmt.Fprintf(w, `{"counts":{"user":17}}`)
 	})
 
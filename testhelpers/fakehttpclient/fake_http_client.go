@@ -50,10 +50,15 @@ func (request *Request) Succeed(body []byte) {
 }
 
 func (request *Request) Respond(statusCode int, body []byte, err error) {
+	request.RespondWithHeader(statusCode, http.Header{}, body, err)
+}
+
+func (request *Request) RespondWithHeader(statusCode int, header http.Header, body []byte, err error) {
 	reader := strings.NewReader(string(body))
 	response := &http.Response{
 		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
 		StatusCode: statusCode,
+		Header:     header,
 
 		ContentLength: int64(reader.Len()),
 		Body:          ioutil.NopCloser(reader),
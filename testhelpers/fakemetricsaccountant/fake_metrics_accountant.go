@@ -1,7 +1,10 @@
 package fakemetricsaccountant
 
 import (
+	"github.com/cloudfoundry/hm9000/helpers/httpclient"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/store"
 	"time"
 )
 
@@ -9,15 +12,59 @@ type FakeMetricsAccountant struct {
 	IncrementSentMessageMetricsError error
 	IncrementedStarts                []models.PendingStartMessage
 	IncrementedStops                 []models.PendingStopMessage
+	IncrementedStopCategories        []models.StopCategory
+
+	DeduplicatedStarts []models.PendingStartMessage
+	DeduplicatedStops  []models.PendingStopMessage
+
+	TrackedPendingMessageEnqueues []store.EnqueueResult
 
 	TrackedDesiredStateSyncTime                  time.Duration
 	TrackedActualStateListenerStoreUsageFraction float64
+	DesiredStatePageCacheHits                    int
+	DesiredStatePageCacheMisses                  int
 
 	GetMetricsError   error
 	GetMetricsMetrics map[string]float64
 
-	ReceivedHeartbeats int
-	SavedHeartbeats    int
+	ReceivedHeartbeats     int
+	SavedHeartbeats        int
+	ShedInstanceHeartbeats int
+	StoreFailovers         int
+
+	AbortedDesiredStateSyncs int
+
+	TrackedNATSCluster int
+	NATSFailovers      int
+	EvacuationsMissed  int
+
+	LeaderElections map[string]int
+	DaemonPanics    map[string]int
+	WatchdogTrips   map[string]int
+	Errors          map[string][]error
+
+	TrackedCCRequestStats []httpclient.Stats
+
+	TrackedTimesToReact []time.Duration
+	TrackedSLO          time.Duration
+
+	TrackedStartOutcomes []models.StartOutcome
+
+	TrackedRestartReports []models.RestartReport
+
+	TrackedAnalysisReports []models.AnalysisReport
+
+	TrackedCrashCompactions []store.CrashCompactionStats
+
+	QueueGroupMessages map[string]map[string]int
+
+	TrackedDeaClockSkews []map[string]time.Duration
+
+	TrackedAPIRateLimiting []map[string]int
+
+	TrackedAPIRequestDeadlines [][3]int
+
+	TrackedNATSSubscriptions map[string][]messagebus.SubscriptionStats
 }
 
 func New() *FakeMetricsAccountant {
@@ -25,7 +72,19 @@ func New() *FakeMetricsAccountant {
 		IncrementedStarts: []models.PendingStartMessage{},
 		IncrementedStops:  []models.PendingStopMessage{},
 
+		DeduplicatedStarts: []models.PendingStartMessage{},
+		DeduplicatedStops:  []models.PendingStopMessage{},
+
 		GetMetricsMetrics: map[string]float64{},
+
+		LeaderElections: map[string]int{},
+		DaemonPanics:    map[string]int{},
+		WatchdogTrips:   map[string]int{},
+		Errors:          map[string][]error{},
+
+		QueueGroupMessages: map[string]map[string]int{},
+
+		TrackedNATSSubscriptions: map[string][]messagebus.SubscriptionStats{},
 	}
 }
 
@@ -39,6 +98,11 @@ func (m *FakeMetricsAccountant) TrackSavedHeartbeats(metric int) error {
 	return nil
 }
 
+func (m *FakeMetricsAccountant) TrackShedInstanceHeartbeats(metric int) error {
+	m.ShedInstanceHeartbeats = metric
+	return nil
+}
+
 func (m *FakeMetricsAccountant) IncrementSentMessageMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error {
 	m.IncrementedStarts = starts
 	m.IncrementedStops = stops
@@ -46,6 +110,22 @@ func (m *FakeMetricsAccountant) IncrementSentMessageMetrics(starts []models.Pend
 	return m.IncrementSentMessageMetricsError
 }
 
+func (m *FakeMetricsAccountant) IncrementStopCategoryMetrics(categories []models.StopCategory) error {
+	m.IncrementedStopCategories = append(m.IncrementedStopCategories, categories...)
+	return nil
+}
+
+func (m *FakeMetricsAccountant) IncrementDeduplicatedMessageMetrics(starts []models.PendingStartMessage, stops []models.PendingStopMessage) error {
+	m.DeduplicatedStarts = append(m.DeduplicatedStarts, starts...)
+	m.DeduplicatedStops = append(m.DeduplicatedStops, stops...)
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackPendingMessageEnqueue(result store.EnqueueResult) error {
+	m.TrackedPendingMessageEnqueues = append(m.TrackedPendingMessageEnqueues, result)
+	return nil
+}
+
 func (m *FakeMetricsAccountant) TrackDesiredStateSyncTime(dt time.Duration) error {
 	m.TrackedDesiredStateSyncTime = dt
 	return nil
@@ -56,6 +136,116 @@ func (m *FakeMetricsAccountant) TrackActualStateListenerStoreUsageFraction(usage
 	return nil
 }
 
+func (m *FakeMetricsAccountant) IncrementStoreFailovers() error {
+	m.StoreFailovers++
+	return nil
+}
+
+func (m *FakeMetricsAccountant) IncrementAbortedDesiredStateSyncs() error {
+	m.AbortedDesiredStateSyncs++
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackNATSCluster(index int) error {
+	m.TrackedNATSCluster = index
+	return nil
+}
+
+func (m *FakeMetricsAccountant) IncrementNATSFailovers() error {
+	m.NATSFailovers++
+	return nil
+}
+
+func (m *FakeMetricsAccountant) IncrementEvacuationsMissed() error {
+	m.EvacuationsMissed++
+	return nil
+}
+
+func (m *FakeMetricsAccountant) IncrementLeaderElections(component string) error {
+	m.LeaderElections[component]++
+	return nil
+}
+
+func (m *FakeMetricsAccountant) IncrementDaemonPanics(component string) error {
+	m.DaemonPanics[component]++
+	return nil
+}
+
+func (m *FakeMetricsAccountant) IncrementWatchdogTrips(component string) error {
+	m.WatchdogTrips[component]++
+	return nil
+}
+
+func (m *FakeMetricsAccountant) IncrementErrors(component string, err error) error {
+	m.Errors[component] = append(m.Errors[component], err)
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackCCRequestStats(stats httpclient.Stats) error {
+	m.TrackedCCRequestStats = append(m.TrackedCCRequestStats, stats)
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackTimesToReact(timesToReact []time.Duration, slo time.Duration) error {
+	m.TrackedTimesToReact = append(m.TrackedTimesToReact, timesToReact...)
+	m.TrackedSLO = slo
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackDesiredStatePageCache(hits int, misses int) error {
+	m.DesiredStatePageCacheHits += hits
+	m.DesiredStatePageCacheMisses += misses
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackStartOutcomes(outcomes []models.StartOutcome) error {
+	m.TrackedStartOutcomes = append(m.TrackedStartOutcomes, outcomes...)
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackRestartReport(report models.RestartReport) error {
+	m.TrackedRestartReports = append(m.TrackedRestartReports, report)
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackAnalysisReport(report models.AnalysisReport) error {
+	m.TrackedAnalysisReports = append(m.TrackedAnalysisReports, report)
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackQueueGroupMessages(component string, instance string, messages int) error {
+	if m.QueueGroupMessages[component] == nil {
+		m.QueueGroupMessages[component] = map[string]int{}
+	}
+	m.QueueGroupMessages[component][instance] = messages
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackDeaClockSkews(skews map[string]time.Duration) error {
+	m.TrackedDeaClockSkews = append(m.TrackedDeaClockSkews, skews)
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackNATSSubscriptions(component string, stats []messagebus.SubscriptionStats) error {
+	m.TrackedNATSSubscriptions[component] = stats
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackAPIRateLimiting(rejections map[string]int) error {
+	m.TrackedAPIRateLimiting = append(m.TrackedAPIRateLimiting, rejections)
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackAPIRequestDeadlines(timedOut int, abandoned int, inFlight int) error {
+	m.TrackedAPIRequestDeadlines = append(m.TrackedAPIRequestDeadlines, [3]int{timedOut, abandoned, inFlight})
+	return nil
+}
+
+func (m *FakeMetricsAccountant) TrackCrashCompaction(stats store.CrashCompactionStats) error {
+	m.TrackedCrashCompactions = append(m.TrackedCrashCompactions, stats)
+	return nil
+}
+
 func (m *FakeMetricsAccountant) GetMetrics() (map[string]float64, error) {
 	return m.GetMetricsMetrics, m.GetMetricsError
 }
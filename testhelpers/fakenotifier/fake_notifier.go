@@ -0,0 +1,47 @@
+package fakenotifier
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry/hm9000/helpers/webhooks"
+)
+
+type FakeNotifier struct {
+	Events            []webhooks.Event
+	ReportedFreshness []error
+
+	lock *sync.Mutex
+}
+
+func New() *FakeNotifier {
+	return &FakeNotifier{
+		Events:            []webhooks.Event{},
+		ReportedFreshness: []error{},
+		lock:              &sync.Mutex{},
+	}
+}
+
+func (notifier *FakeNotifier) Notify(events ...webhooks.Event) {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+	notifier.Events = append(notifier.Events, events...)
+}
+
+func (notifier *FakeNotifier) ReportFreshness(err error) {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+	notifier.ReportedFreshness = append(notifier.ReportedFreshness, err)
+}
+
+func (notifier *FakeNotifier) EventsOfType(eventType string) []webhooks.Event {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	events := []webhooks.Event{}
+	for _, event := range notifier.Events {
+		if event.Type == eventType {
+			events = append(events, event)
+		}
+	}
+	return events
+}
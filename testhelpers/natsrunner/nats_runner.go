@@ -1,23 +1,17 @@
 package natsrunner
 
 import (
-	"fmt"
-	"os"
-
 	. "github.com/onsi/gomega"
 
-	"github.com/cloudfoundry/yagnats"
-
-	"os/exec"
-	"strconv"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 )
 
-var natsCommand *exec.Cmd
-
+// NATSRunner runs an embedded NATS server for the mcat, so that it needs no
+// gnatsd binary on the path.
 type NATSRunner struct {
-	port        int
-	natsCommand *exec.Cmd
-	MessageBus  yagnats.NATSConn
+	port       int
+	server     *messagebus.EmbeddedServer
+	MessageBus messagebus.MessageBus
 }
 
 func NewNATSRunner(port int) *NATSRunner {
@@ -27,18 +21,13 @@ func NewNATSRunner(port int) *NATSRunner {
 }
 
 func (runner *NATSRunner) Start() {
-	_, err := exec.LookPath("gnatsd")
-	if err != nil {
-		fmt.Println("You need gnatsd installed!")
-		os.Exit(1)
-	}
+	server, err := messagebus.StartEmbeddedServer("127.0.0.1", runner.port)
+	Ω(err).ShouldNot(HaveOccurred())
+	runner.server = server
 
-	runner.natsCommand = exec.Command("gnatsd", "-p", strconv.Itoa(runner.port))
-	err = runner.natsCommand.Start()
-	Ω(err).ShouldNot(HaveOccurred(), "Make sure to have gnatsd on your path")
-	var messageBus yagnats.NATSConn
+	var messageBus messagebus.MessageBus
 	Eventually(func() error {
-		messageBus, err = yagnats.Connect([]string{fmt.Sprintf("nats://127.0.0.1:%d", runner.port)})
+		messageBus, err = server.Connect()
 		return err
 	}, 5, 0.1).ShouldNot(HaveOccurred())
 
@@ -46,9 +35,10 @@ func (runner *NATSRunner) Start() {
 }
 
 func (runner *NATSRunner) Stop() {
-	if runner.natsCommand != nil {
-		runner.natsCommand.Process.Kill()
+	if runner.server != nil {
+		runner.MessageBus.Close()
+		runner.server.Shutdown()
 		runner.MessageBus = nil
-		runner.natsCommand = nil
+		runner.server = nil
 	}
 }
@@ -0,0 +1,145 @@
+package scriptednats
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+)
+
+var PartitionedError = errors.New("scripted NATS partition")
+
+// A Step scripts one publish on a subject: the publish is held for Delay
+// and then, if Err is set, fails with it instead of being published.
+type Step struct {
+	Delay time.Duration
+	Err   error
+}
+
+// Conn is a fakeyagnats.FakeNATSConn whose publishes can be scripted, to
+// test components against a message bus that is slow, fails or partitions.
+// Scripted steps are used up in order, one per publish on their subject;
+// once they run out publishes go through as usual.  While partitioned every
+// publish fails with PartitionedError, before any step is used up, and
+// Ping is false.  Attempts counts every publish, failed or not; the
+// embedded PublishedMessages only those that went through.
+type Conn struct {
+	*fakeyagnats.FakeNATSConn
+
+	lock        *sync.Mutex
+	steps       map[string][]Step
+	attempts    map[string]int
+	responders  map[string]func(*nats.Msg) []byte
+	partitioned bool
+}
+
+func New() *Conn {
+	return &Conn{
+		FakeNATSConn: fakeyagnats.Connect(),
+		lock:         &sync.Mutex{},
+		steps:        map[string][]Step{},
+		attempts:     map[string]int{},
+		responders:   map[string]func(*nats.Msg) []byte{},
+	}
+}
+
+// Script queues steps for the next publishes on subject, after any steps
+// already queued.
+func (conn *Conn) Script(subject string, steps ...Step) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	conn.steps[subject] = append(conn.steps[subject], steps...)
+}
+
+// Delay holds each of the next count publishes on subject for delay.
+func (conn *Conn) Delay(subject string, count int, delay time.Duration) {
+	for i := 0; i < count; i++ {
+		conn.Script(subject, Step{Delay: delay})
+	}
+}
+
+// Fail fails each of the next count publishes on subject with err.
+func (conn *Conn) Fail(subject string, count int, err error) {
+	for i := 0; i < count; i++ {
+		conn.Script(subject, Step{Err: err})
+	}
+}
+
+// Partition cuts the connection off until Heal.
+func (conn *Conn) Partition() {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	conn.partitioned = true
+}
+
+func (conn *Conn) Heal() {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	conn.partitioned = false
+}
+
+// RespondTo answers requests published on subject with a reply subject:
+// respond is called with each request and what it returns is published on
+// the reply subject.
+func (conn *Conn) RespondTo(subject string, respond func(request *nats.Msg) []byte) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	conn.responders[subject] = respond
+}
+
+// Attempts is the number of publishes tried on subject.
+func (conn *Conn) Attempts(subject string) int {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	return conn.attempts[subject]
+}
+
+// PendingSteps is the number of steps for subject not yet used up.
+func (conn *Conn) PendingSteps(subject string) int {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	return len(conn.steps[subject])
+}
+
+func (conn *Conn) Ping() bool {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	return !conn.partitioned
+}
+
+func (conn *Conn) Publish(subject string, data []byte) error {
+	return conn.PublishRequest(subject, "", data)
+}
+
+func (conn *Conn) PublishRequest(subject, reply string, data []byte) error {
+	conn.lock.Lock()
+	conn.attempts[subject]++
+	if conn.partitioned {
+		conn.lock.Unlock()
+		return PartitionedError
+	}
+	step := Step{}
+	if len(conn.steps[subject]) > 0 {
+		step = conn.steps[subject][0]
+		conn.steps[subject] = conn.steps[subject][1:]
+	}
+	respond := conn.responders[subject]
+	conn.lock.Unlock()
+
+	time.Sleep(step.Delay)
+	if step.Err != nil {
+		return step.Err
+	}
+
+	err := conn.FakeNATSConn.PublishRequest(subject, reply, data)
+	if err != nil {
+		return err
+	}
+
+	if respond != nil && reply != "" {
+		return conn.FakeNATSConn.Publish(reply, respond(&nats.Msg{Subject: subject, Reply: reply, Data: data}))
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package scriptednats_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestScriptedNATS(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Scripted NATS Suite")
+}
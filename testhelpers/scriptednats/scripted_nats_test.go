@@ -0,0 +1,97 @@
+package scriptednats_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/apcera/nats"
+	. "github.com/cloudfoundry/hm9000/testhelpers/scriptednats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Conn", func() {
+	var conn *Conn
+
+	BeforeEach(func() {
+		conn = New()
+	})
+
+	It("should publish as usual when nothing is scripted", func() {
+		received := []string{}
+		conn.Subscribe("foo", func(message *nats.Msg) {
+			received = append(received, string(message.Data))
+		})
+
+		Ω(conn.Publish("foo", []byte("bar"))).Should(Succeed())
+		Ω(received).Should(Equal([]string{"bar"}))
+		Ω(conn.PublishedMessages("foo")).Should(HaveLen(1))
+		Ω(conn.Attempts("foo")).Should(Equal(1))
+	})
+
+	It("should use up scripted steps in order, one per publish on their subject", func() {
+		conn.Fail("foo", 1, errors.New("boom"))
+		conn.Script("foo", Step{}, Step{Err: errors.New("bang")})
+
+		Ω(conn.Publish("bar", []byte("unscripted"))).Should(Succeed())
+		Ω(conn.Publish("foo", []byte("1"))).Should(MatchError("boom"))
+		Ω(conn.Publish("foo", []byte("2"))).Should(Succeed())
+		Ω(conn.PendingSteps("foo")).Should(Equal(1))
+		Ω(conn.Publish("foo", []byte("3"))).Should(MatchError("bang"))
+		Ω(conn.Publish("foo", []byte("4"))).Should(Succeed())
+
+		Ω(conn.Attempts("foo")).Should(Equal(4))
+		Ω(conn.PublishedMessages("foo")).Should(HaveLen(2))
+		Ω(string(conn.PublishedMessages("foo")[1].Data)).Should(Equal("4"))
+	})
+
+	It("should hold delayed publishes", func() {
+		conn.Delay("foo", 1, 50*time.Millisecond)
+
+		start := time.Now()
+		Ω(conn.Publish("foo", []byte("slow"))).Should(Succeed())
+		Ω(time.Since(start)).Should(BeNumerically(">=", 50*time.Millisecond))
+
+		start = time.Now()
+		Ω(conn.Publish("foo", []byte("fast"))).Should(Succeed())
+		Ω(time.Since(start)).Should(BeNumerically("<", 50*time.Millisecond))
+	})
+
+	Context("when partitioned", func() {
+		BeforeEach(func() {
+			conn.Fail("foo", 1, errors.New("boom"))
+			conn.Partition()
+		})
+
+		It("should fail every publish without using up steps", func() {
+			Ω(conn.Publish("foo", []byte("bar"))).Should(Equal(PartitionedError))
+			Ω(conn.Publish("baz", []byte("bar"))).Should(Equal(PartitionedError))
+			Ω(conn.PublishedMessageCount()).Should(BeZero())
+			Ω(conn.Attempts("foo")).Should(Equal(1))
+			Ω(conn.PendingSteps("foo")).Should(Equal(1))
+			Ω(conn.Ping()).Should(BeFalse())
+		})
+
+		It("should recover once healed", func() {
+			conn.Heal()
+			Ω(conn.Ping()).Should(BeTrue())
+			Ω(conn.Publish("foo", []byte("bar"))).Should(MatchError("boom"))
+			Ω(conn.Publish("foo", []byte("bar"))).Should(Succeed())
+		})
+	})
+
+	It("should simulate replies to requests", func() {
+		conn.RespondTo("app.state", func(request *nats.Msg) []byte {
+			return append([]byte("state of "), request.Data...)
+		})
+
+		replies := []string{}
+		conn.Subscribe("inbox", func(message *nats.Msg) {
+			replies = append(replies, string(message.Data))
+		})
+
+		Ω(conn.PublishRequest("app.state", "inbox", []byte("app-guid"))).Should(Succeed())
+		Ω(conn.Publish("app.state", []byte("no reply wanted"))).Should(Succeed())
+		Ω(replies).Should(Equal([]string{"state of app-guid"}))
+	})
+})
@@ -0,0 +1,147 @@
+package senderharness
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider/faketimeprovider"
+	"github.com/cloudfoundry/hm9000/analyzer"
+	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/models"
+	"github.com/cloudfoundry/hm9000/sender"
+	storepackage "github.com/cloudfoundry/hm9000/store"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakelogger"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakemetricsaccountant"
+	"github.com/cloudfoundry/hm9000/testhelpers/fakenotifier"
+	"github.com/cloudfoundry/hm9000/testhelpers/scriptednats"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+)
+
+// Harness runs the sender, and the analyzer that feeds it, against an
+// in-memory store and a scripted message bus, so that tests can play out
+// scenarios (a crash storm, then a NATS partition) over many runs.  Each
+// run uses a new sender and analyzer, as the daemons do, sharing the
+// harness's store, bus, clock and fakes.
+//
+// The store starts fresh: the clock starts one actual_freshness_ttl after
+// the actual state was first heard of.  Heartbeat and Desire keep it
+// fresh.
+type Harness struct {
+	Conf              *config.Config
+	StoreAdapter      *fakestoreadapter.FakeStoreAdapter
+	Store             storepackage.Store
+	MessageBus        *scriptednats.Conn
+	TimeProvider      *faketimeprovider.FakeTimeProvider
+	Logger            *fakelogger.FakeLogger
+	MetricsAccountant *fakemetricsaccountant.FakeMetricsAccountant
+	Notifier          *fakenotifier.FakeNotifier
+}
+
+// New builds a harness around conf, or the default config if conf is nil.
+func New(conf *config.Config) *Harness {
+	if conf == nil {
+		conf, _ = config.DefaultConfig()
+	}
+
+	storeAdapter := fakestoreadapter.New()
+	logger := fakelogger.NewFakeLogger()
+	start := time.Unix(1000, 0)
+
+	harness := &Harness{
+		Conf:              conf,
+		StoreAdapter:      storeAdapter,
+		Store:             storepackage.NewStore(conf, storeAdapter, logger),
+		MessageBus:        scriptednats.New(),
+		TimeProvider:      faketimeprovider.New(start.Add(time.Duration(conf.ActualFreshnessTTL()) * time.Second)),
+		Logger:            logger,
+		MetricsAccountant: fakemetricsaccountant.New(),
+		Notifier:          fakenotifier.New(),
+	}
+
+	harness.Store.BumpActualFreshness(start)
+	harness.Store.BumpDesiredFreshness(start)
+
+	return harness
+}
+
+// Desire syncs the desired state of apps.
+func (harness *Harness) Desire(desired ...models.DesiredAppState) error {
+	err := harness.Store.SyncDesiredState(desired...)
+	if err != nil {
+		return err
+	}
+	return harness.Store.BumpDesiredFreshness(harness.TimeProvider.Time())
+}
+
+// Heartbeat syncs heartbeats, as the listener would on receiving them.
+func (harness *Harness) Heartbeat(heartbeats ...models.Heartbeat) error {
+	err := harness.Store.SyncHeartbeats(heartbeats...)
+	if err != nil {
+		return err
+	}
+	return harness.Store.BumpActualFreshness(harness.TimeProvider.Time())
+}
+
+// Enqueue enqueues start messages, as the analyzer, evacuator or an
+// operator would.
+func (harness *Harness) Enqueue(messages ...models.PendingStartMessage) error {
+	return harness.Store.SavePendingStartMessages(messages...)
+}
+
+// Analyze runs the analyzer once.
+func (harness *Harness) Analyze() error {
+	return analyzer.New(harness.Store, harness.MetricsAccountant, harness.Notifier, harness.TimeProvider, harness.Logger, harness.Conf).Analyze()
+}
+
+// Send runs the sender once.
+func (harness *Harness) Send() error {
+	return sender.New(harness.Store, harness.MetricsAccountant, harness.Notifier, harness.Conf, harness.MessageBus, harness.Logger).Send(harness.TimeProvider)
+}
+
+// Cycle runs the analyzer and then, if it succeeds, the sender.
+func (harness *Harness) Cycle() error {
+	err := harness.Analyze()
+	if err != nil {
+		return err
+	}
+	return harness.Send()
+}
+
+// Advance moves the clock on.
+func (harness *Harness) Advance(seconds uint64) {
+	harness.TimeProvider.IncrementBySeconds(seconds)
+}
+
+// StartsSent are the start messages that reached the bus, in order.
+func (harness *Harness) StartsSent() []models.StartMessage {
+	starts := []models.StartMessage{}
+	for _, message := range harness.MessageBus.PublishedMessages(harness.Conf.SenderNatsStartSubject) {
+		start, err := models.NewStartMessageFromJSON(message.Data)
+		if err != nil {
+			panic(err)
+		}
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// StopsSent are the stop messages that reached the bus, in order.
+func (harness *Harness) StopsSent() []models.StopMessage {
+	stops := []models.StopMessage{}
+	for _, message := range harness.MessageBus.PublishedMessages(harness.Conf.SenderNatsStopSubject) {
+		stop, err := models.NewStopMessageFromJSON(message.Data)
+		if err != nil {
+			panic(err)
+		}
+		stops = append(stops, stop)
+	}
+	return stops
+}
+
+// PendingStarts are the start messages in the queue, sent or not.
+func (harness *Harness) PendingStarts() []models.PendingStartMessage {
+	messages, err := harness.Store.GetPendingStartMessages()
+	if err != nil {
+		panic(err)
+	}
+	return models.SortStartMessagesByPriority(messages)
+}
@@ -5,18 +5,18 @@ import (
 
 	"github.com/apcera/nats"
 	"github.com/cloudfoundry/hm9000/config"
+	"github.com/cloudfoundry/hm9000/helpers/messagebus"
 	"github.com/cloudfoundry/hm9000/models"
-	"github.com/cloudfoundry/yagnats"
 )
 
 type StartStopListener struct {
 	mutex      sync.Mutex
 	starts     []models.StartMessage
 	stops      []models.StopMessage
-	messageBus yagnats.NATSConn
+	messageBus messagebus.MessageBus
 }
 
-func NewStartStopListener(messageBus yagnats.NATSConn, conf *config.Config) *StartStopListener {
+func NewStartStopListener(messageBus messagebus.MessageBus, conf *config.Config) *StartStopListener {
 	listener := &StartStopListener{
 		messageBus: messageBus,
 	}
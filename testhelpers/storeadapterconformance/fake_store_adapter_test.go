@@ -0,0 +1,14 @@
+package storeadapterconformance_test
+
+import (
+	. "github.com/cloudfoundry/hm9000/testhelpers/storeadapterconformance"
+	"github.com/cloudfoundry/storeadapter"
+	"github.com/cloudfoundry/storeadapter/fakestoreadapter"
+	. "github.com/onsi/ginkgo"
+)
+
+var _ = Describe("FakeStoreAdapter", func() {
+	ItBehavesLikeAStoreAdapter(func() storeadapter.StoreAdapter {
+		return fakestoreadapter.New()
+	})
+})
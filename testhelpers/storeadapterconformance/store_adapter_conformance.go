@@ -0,0 +1,202 @@
+package storeadapterconformance
+
+import (
+	"github.com/cloudfoundry/storeadapter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// ItBehavesLikeAStoreAdapter registers the specs every StoreAdapter hm9000
+// runs against must pass.  newAdapter is called before each spec and must
+// return a connected adapter; the specs only touch keys under /conformance
+// and delete them afterwards.
+func ItBehavesLikeAStoreAdapter(newAdapter func() storeadapter.StoreAdapter) {
+	Describe("StoreAdapter conformance", func() {
+		var adapter storeadapter.StoreAdapter
+
+		childKeys := func(node storeadapter.StoreNode) []string {
+			keys := []string{}
+			for _, child := range node.ChildNodes {
+				keys = append(keys, child.Key)
+			}
+			return keys
+		}
+
+		BeforeEach(func() {
+			adapter = newAdapter()
+
+			err := adapter.SetMulti([]storeadapter.StoreNode{
+				{Key: "/conformance/leaf", Value: []byte("leaf")},
+				{Key: "/conformance/expiring", Value: []byte("expiring"), TTL: 60},
+				{Key: "/conformance/dir/a", Value: []byte("a")},
+				{Key: "/conformance/dir/nested/b", Value: []byte("b")},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			adapter.Delete("/conformance")
+		})
+
+		Describe("Get", func() {
+			It("returns the value that was set", func() {
+				node, err := adapter.Get("/conformance/leaf")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(node.Key).Should(Equal("/conformance/leaf"))
+				Ω(node.Value).Should(Equal([]byte("leaf")))
+				Ω(node.Dir).Should(BeFalse())
+				Ω(node.TTL).Should(BeZero())
+			})
+
+			It("reports the remaining TTL of expiring keys", func() {
+				node, err := adapter.Get("/conformance/expiring")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(node.TTL).Should(BeNumerically(">", 0))
+				Ω(node.TTL).Should(BeNumerically("<=", 60))
+			})
+
+			It("returns ErrorKeyNotFound for missing keys", func() {
+				_, err := adapter.Get("/conformance/missing")
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			})
+
+			It("returns ErrorNodeIsDirectory for directories", func() {
+				_, err := adapter.Get("/conformance/dir")
+				Ω(err).Should(Equal(storeadapter.ErrorNodeIsDirectory))
+			})
+		})
+
+		Describe("SetMulti", func() {
+			It("overwrites existing values", func() {
+				err := adapter.SetMulti([]storeadapter.StoreNode{{Key: "/conformance/leaf", Value: []byte("new")}})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				node, _ := adapter.Get("/conformance/leaf")
+				Ω(node.Value).Should(Equal([]byte("new")))
+			})
+
+			It("refuses to overwrite a directory", func() {
+				err := adapter.SetMulti([]storeadapter.StoreNode{{Key: "/conformance/dir", Value: []byte("new")}})
+				Ω(err).Should(Equal(storeadapter.ErrorNodeIsDirectory))
+			})
+		})
+
+		Describe("ListRecursively", func() {
+			It("returns the whole tree", func() {
+				node, err := adapter.ListRecursively("/conformance/dir")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(node.Dir).Should(BeTrue())
+				Ω(childKeys(node)).Should(ConsistOf("/conformance/dir/a", "/conformance/dir/nested"))
+
+				for _, child := range node.ChildNodes {
+					if child.Key == "/conformance/dir/a" {
+						Ω(child.Value).Should(Equal([]byte("a")))
+					} else {
+						Ω(child.Dir).Should(BeTrue())
+						Ω(childKeys(child)).Should(Equal([]string{"/conformance/dir/nested/b"}))
+						Ω(child.ChildNodes[0].Value).Should(Equal([]byte("b")))
+					}
+				}
+			})
+
+			It("returns ErrorKeyNotFound for missing keys", func() {
+				_, err := adapter.ListRecursively("/conformance/missing")
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			})
+
+			It("returns ErrorNodeIsNotDirectory for leaves", func() {
+				_, err := adapter.ListRecursively("/conformance/leaf")
+				Ω(err).Should(Equal(storeadapter.ErrorNodeIsNotDirectory))
+			})
+		})
+
+		Describe("Create and Update", func() {
+			It("creates keys that do not exist", func() {
+				err := adapter.Create(storeadapter.StoreNode{Key: "/conformance/created", Value: []byte("created")})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				node, _ := adapter.Get("/conformance/created")
+				Ω(node.Value).Should(Equal([]byte("created")))
+			})
+
+			It("does not create keys that already exist", func() {
+				err := adapter.Create(storeadapter.StoreNode{Key: "/conformance/leaf", Value: []byte("new")})
+				Ω(err).Should(Equal(storeadapter.ErrorKeyExists))
+			})
+
+			It("updates keys that exist", func() {
+				err := adapter.Update(storeadapter.StoreNode{Key: "/conformance/leaf", Value: []byte("updated")})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				node, _ := adapter.Get("/conformance/leaf")
+				Ω(node.Value).Should(Equal([]byte("updated")))
+			})
+
+			It("does not update keys that do not exist", func() {
+				err := adapter.Update(storeadapter.StoreNode{Key: "/conformance/missing", Value: []byte("new")})
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			})
+		})
+
+		Describe("compare and swap", func() {
+			var current storeadapter.StoreNode
+
+			BeforeEach(func() {
+				var err error
+				current, err = adapter.Get("/conformance/leaf")
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("swaps by value", func() {
+				err := adapter.CompareAndSwap(current, storeadapter.StoreNode{Key: "/conformance/leaf", Value: []byte("swapped")})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				stale := storeadapter.StoreNode{Key: "/conformance/leaf", Value: []byte("leaf")}
+				err = adapter.CompareAndSwap(stale, storeadapter.StoreNode{Key: "/conformance/leaf", Value: []byte("again")})
+				Ω(err).Should(Equal(storeadapter.ErrorKeyComparisonFailed))
+			})
+
+			It("swaps by index", func() {
+				err := adapter.CompareAndSwapByIndex(current.Index, storeadapter.StoreNode{Key: "/conformance/leaf", Value: []byte("swapped")})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = adapter.CompareAndSwapByIndex(current.Index, storeadapter.StoreNode{Key: "/conformance/leaf", Value: []byte("again")})
+				Ω(err).Should(Equal(storeadapter.ErrorKeyComparisonFailed))
+
+				node, _ := adapter.Get("/conformance/leaf")
+				Ω(node.Value).Should(Equal([]byte("swapped")))
+			})
+
+			It("deletes by value and by index", func() {
+				err := adapter.CompareAndDelete(storeadapter.StoreNode{Key: "/conformance/leaf", Value: []byte("other")})
+				Ω(err).Should(Equal(storeadapter.ErrorKeyComparisonFailed))
+
+				err = adapter.CompareAndDeleteByIndex(current)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = adapter.Get("/conformance/leaf")
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			})
+		})
+
+		Describe("Delete", func() {
+			It("deletes leaves and whole directories", func() {
+				err := adapter.Delete("/conformance/leaf", "/conformance/dir")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = adapter.Get("/conformance/leaf")
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+				_, err = adapter.ListRecursively("/conformance/dir")
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+
+				_, err = adapter.Get("/conformance/expiring")
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("returns ErrorKeyNotFound for missing keys", func() {
+				err := adapter.Delete("/conformance/missing")
+				Ω(err).Should(Equal(storeadapter.ErrorKeyNotFound))
+			})
+		})
+	})
+}
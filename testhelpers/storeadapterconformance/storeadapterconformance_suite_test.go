@@ -0,0 +1,13 @@
+package storeadapterconformance_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestStoreAdapterConformance(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "StoreAdapter Conformance Suite")
+}
@@ -0,0 +1,229 @@
+package virtualtime
+
+import (
+	"sync"
+	"time"
+)
+
+// TimeProvider is a timeprovider.TimeProvider whose time only moves when a
+// test calls Advance.  Unlike faketimeprovider it keeps every ticker it
+// hands out, however many share a name, and fires them (and wakes
+// sleepers) itself as time passes, in time order, so tests of components
+// with several tickers need no real sleeps and can assert on the order in
+// which things were scheduled.
+type TimeProvider struct {
+	// DeliveryTimeout is how long, in real time, Advance waits for each tick
+	// to be received before dropping it.  It defaults to a second.
+	DeliveryTimeout time.Duration
+
+	now      time.Time
+	tickers  []*ticker
+	sleepers []*sleeper
+	ticks    []Tick
+	sequence int
+
+	lock *sync.Mutex
+}
+
+// A Tick is a tick Advance fired.
+type Tick struct {
+	Name string
+	Time time.Time
+
+	// Dropped is set if nothing received the tick within DeliveryTimeout.
+	Dropped bool
+}
+
+type ticker struct {
+	name     string
+	period   time.Duration
+	next     time.Time
+	sequence int
+	c        chan time.Time
+}
+
+type sleeper struct {
+	until    time.Time
+	sequence int
+	wake     chan struct{}
+}
+
+func New(now time.Time) *TimeProvider {
+	return &TimeProvider{
+		DeliveryTimeout: time.Second,
+		now:             now,
+		lock:            &sync.Mutex{},
+	}
+}
+
+func (provider *TimeProvider) Time() time.Time {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	return provider.now
+}
+
+// Sleep blocks until Advance has moved time on by d.
+func (provider *TimeProvider) Sleep(d time.Duration) {
+	provider.lock.Lock()
+	if d <= 0 {
+		provider.lock.Unlock()
+		return
+	}
+	provider.sequence++
+	s := &sleeper{until: provider.now.Add(d), sequence: provider.sequence, wake: make(chan struct{})}
+	provider.sleepers = append(provider.sleepers, s)
+	provider.lock.Unlock()
+
+	<-s.wake
+}
+
+// NewTickerChannel returns a channel that Advance sends the time on every d.
+// Its sends block, as if the ticker's buffer were full, until they are
+// received or DeliveryTimeout passes.
+func (provider *TimeProvider) NewTickerChannel(name string, d time.Duration) <-chan time.Time {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.sequence++
+	t := &ticker{
+		name:     name,
+		period:   d,
+		next:     provider.now.Add(d),
+		sequence: provider.sequence,
+		c:        make(chan time.Time),
+	}
+	provider.tickers = append(provider.tickers, t)
+	return t.c
+}
+
+// Tickers are the names of the tickers handed out, in the order they were
+// asked for.  Tests can wait with Eventually for a component to start its
+// tickers.
+func (provider *TimeProvider) Tickers() []string {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	names := []string{}
+	for _, t := range provider.tickers {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+// TickerDurationFor is the period of the first ticker named name, or 0.
+func (provider *TimeProvider) TickerDurationFor(name string) time.Duration {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	for _, t := range provider.tickers {
+		if t.name == name {
+			return t.period
+		}
+	}
+	return 0
+}
+
+// Sleepers is the number of goroutines blocked in Sleep.
+func (provider *TimeProvider) Sleepers() int {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	return len(provider.sleepers)
+}
+
+// Ticks are the ticks fired so far, in the order they were fired.
+func (provider *TimeProvider) Ticks() []Tick {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	ticks := make([]Tick, len(provider.ticks))
+	copy(ticks, provider.ticks)
+	return ticks
+}
+
+// Advance moves time on by d.  Each tick and wake-up due on the way happens
+// in turn, at its own time: the earliest first, and those due at once in the
+// order the tickers and sleepers were made.  Advance returns once every tick
+// has been received (or dropped), so whatever a receiver does after its
+// receive races only with the next tick.
+func (provider *TimeProvider) Advance(d time.Duration) {
+	provider.lock.Lock()
+	target := provider.now.Add(d)
+	provider.lock.Unlock()
+
+	for {
+		provider.lock.Lock()
+		t, s := provider.nextEvent(target)
+		if t == nil && s == nil {
+			provider.now = target
+			provider.lock.Unlock()
+			return
+		}
+
+		if s != nil {
+			provider.now = s.until
+			provider.removeSleeper(s)
+			provider.lock.Unlock()
+			close(s.wake)
+			continue
+		}
+
+		now := t.next
+		provider.now = now
+		t.next = t.next.Add(t.period)
+		timeout := provider.DeliveryTimeout
+		provider.lock.Unlock()
+
+		tick := Tick{Name: t.name, Time: now}
+		select {
+		case t.c <- now:
+		case <-time.After(timeout):
+			tick.Dropped = true
+		}
+
+		provider.lock.Lock()
+		provider.ticks = append(provider.ticks, tick)
+		provider.lock.Unlock()
+	}
+}
+
+// nextEvent is the ticker or sleeper due first, no later than target.
+func (provider *TimeProvider) nextEvent(target time.Time) (*ticker, *sleeper) {
+	var firstTicker *ticker
+	var firstSleeper *sleeper
+	var first time.Time
+	sequence := 0
+
+	earlier := func(at time.Time, atSequence int) bool {
+		if at.After(target) {
+			return false
+		}
+		if firstTicker == nil && firstSleeper == nil {
+			return true
+		}
+		return at.Before(first) || (at.Equal(first) && atSequence < sequence)
+	}
+
+	for _, t := range provider.tickers {
+		if t.period > 0 && earlier(t.next, t.sequence) {
+			firstTicker, firstSleeper, first, sequence = t, nil, t.next, t.sequence
+		}
+	}
+	for _, s := range provider.sleepers {
+		if earlier(s.until, s.sequence) {
+			firstTicker, firstSleeper, first, sequence = nil, s, s.until, s.sequence
+		}
+	}
+
+	return firstTicker, firstSleeper
+}
+
+func (provider *TimeProvider) removeSleeper(s *sleeper) {
+	for i, other := range provider.sleepers {
+		if other == s {
+			provider.sleepers = append(provider.sleepers[:i], provider.sleepers[i+1:]...)
+			return
+		}
+	}
+}
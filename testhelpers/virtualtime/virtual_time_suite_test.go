@@ -0,0 +1,13 @@
+package virtualtime_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestVirtualTime(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Virtual Time Suite")
+}
@@ -0,0 +1,115 @@
+package virtualtime_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/gunk/timeprovider"
+	. "github.com/cloudfoundry/hm9000/testhelpers/virtualtime"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Virtual time", func() {
+	var (
+		provider *TimeProvider
+		start    time.Time
+	)
+
+	BeforeEach(func() {
+		start = time.Unix(100, 0)
+		provider = New(start)
+		provider.DeliveryTimeout = 50 * time.Millisecond
+	})
+
+	var _ timeprovider.TimeProvider = New(time.Now())
+
+	receive := func(c <-chan time.Time, lock *sync.Mutex, received *[]string, name string) {
+		go func() {
+			for _ = range c {
+				lock.Lock()
+				*received = append(*received, name)
+				lock.Unlock()
+			}
+		}()
+	}
+
+	It("only moves when advanced", func() {
+		Ω(provider.Time()).Should(Equal(start))
+		provider.Advance(90 * time.Second)
+		Ω(provider.Time()).Should(Equal(start.Add(90 * time.Second)))
+	})
+
+	It("fires every ticker, however many share a name, in time order", func() {
+		lock := &sync.Mutex{}
+		received := []string{}
+		receive(provider.NewTickerChannel("sync", 3*time.Second), lock, &received, "sync")
+		receive(provider.NewTickerChannel("lease", 2*time.Second), lock, &received, "lease")
+		receive(provider.NewTickerChannel("lease", 5*time.Second), lock, &received, "other lease")
+
+		Ω(provider.Tickers()).Should(Equal([]string{"sync", "lease", "lease"}))
+		Ω(provider.TickerDurationFor("lease")).Should(Equal(2 * time.Second))
+
+		provider.Advance(6 * time.Second)
+
+		ticks := provider.Ticks()
+		names := []string{}
+		for _, tick := range ticks {
+			names = append(names, tick.Name)
+			Ω(tick.Dropped).Should(BeFalse())
+		}
+		Ω(names).Should(Equal([]string{"lease", "sync", "lease", "lease", "sync", "lease"}), "ticks due at once fire in the order the tickers were made")
+		Ω(ticks[0].Time).Should(Equal(start.Add(2 * time.Second)))
+		Ω(ticks[5].Time).Should(Equal(start.Add(6 * time.Second)))
+		Ω(provider.Time()).Should(Equal(start.Add(6 * time.Second)))
+
+		Eventually(func() []string {
+			lock.Lock()
+			defer lock.Unlock()
+			return append([]string{}, received...)
+		}).Should(ConsistOf("lease", "lease", "lease", "other lease", "sync", "sync"))
+	})
+
+	It("gives each receiver the time of its tick", func() {
+		c := provider.NewTickerChannel("sync", time.Second)
+		times := make(chan time.Time, 2)
+		go func() {
+			for t := range c {
+				times <- t
+			}
+		}()
+
+		provider.Advance(2 * time.Second)
+		Ω(<-times).Should(Equal(start.Add(time.Second)))
+		Ω(<-times).Should(Equal(start.Add(2 * time.Second)))
+	})
+
+	It("drops ticks nothing receives", func() {
+		provider.NewTickerChannel("ignored", time.Second)
+		provider.Advance(time.Second)
+		Ω(provider.Ticks()).Should(Equal([]Tick{{Name: "ignored", Time: start.Add(time.Second), Dropped: true}}))
+	})
+
+	It("wakes sleepers when their time comes", func() {
+		woken := make(chan time.Time, 1)
+		go func() {
+			provider.Sleep(10 * time.Second)
+			woken <- provider.Time()
+		}()
+		Eventually(provider.Sleepers).Should(Equal(1))
+
+		provider.Advance(9 * time.Second)
+		Consistently(woken, 10*time.Millisecond).ShouldNot(Receive())
+
+		provider.Advance(5 * time.Second)
+		var at time.Time
+		Eventually(woken).Should(Receive(&at))
+		Ω(at).Should(BeTemporally(">=", start.Add(10*time.Second)))
+		Ω(provider.Sleepers()).Should(Equal(0))
+	})
+
+	It("does not block a Sleep of nothing", func() {
+		provider.Sleep(0)
+		Ω(provider.Sleepers()).Should(Equal(0))
+	})
+})
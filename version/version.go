@@ -0,0 +1,44 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// The build of hm9000, stamped in at link time with -ldflags "-X ..." (see
+// the README).  A binary built without them reports the defaults.
+var (
+	Version   = "0.0.9000"
+	GitSHA    = "unknown"
+	BuildDate = "unknown"
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	GitSHA    string `json:"git_sha"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+func Get() Info {
+	return Info{
+		Version:   Version,
+		GitSHA:    GitSHA,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+func (info Info) String() string {
+	return fmt.Sprintf("%s (git %s, built %s with %s)", info.Version, info.GitSHA, info.BuildDate, info.GoVersion)
+}
+
+// LogData is the build, as details for a log line.
+func (info Info) LogData() map[string]string {
+	return map[string]string{
+		"Version":    info.Version,
+		"Git SHA":    info.GitSHA,
+		"Build Date": info.BuildDate,
+		"Go Version": info.GoVersion,
+	}
+}
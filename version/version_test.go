@@ -0,0 +1,40 @@
+package version_test
+
+import (
+	"runtime"
+
+	. "github.com/cloudfoundry/hm9000/version"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Version", func() {
+	var original Info
+
+	BeforeEach(func() {
+		original = Info{Version: Version, GitSHA: GitSHA, BuildDate: BuildDate}
+		Version, GitSHA, BuildDate = "1.2.3", "abc123", "2014-06-01T12:00:00Z"
+	})
+
+	AfterEach(func() {
+		Version, GitSHA, BuildDate = original.Version, original.GitSHA, original.BuildDate
+	})
+
+	It("reports the build stamped in at link time", func() {
+		Ω(Get()).Should(Equal(Info{
+			Version:   "1.2.3",
+			GitSHA:    "abc123",
+			BuildDate: "2014-06-01T12:00:00Z",
+			GoVersion: runtime.Version(),
+		}))
+	})
+
+	It("describes the build in one line", func() {
+		Ω(Get().String()).Should(Equal("1.2.3 (git abc123, built 2014-06-01T12:00:00Z with " + runtime.Version() + ")"))
+	})
+
+	It("describes the build for the logs", func() {
+		Ω(Get().LogData()).Should(HaveKeyWithValue("Git SHA", "abc123"))
+		Ω(Get().LogData()).Should(HaveKeyWithValue("Build Date", "2014-06-01T12:00:00Z"))
+	})
+})